@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync" // Package for guarding the sample buffer
+	"time" // Package for sample timestamps
+)
+
+// maxAccelWindow is the longest window an accel rule may use
+// Samples are kept in memory for two windows, so this bounds the buffer
+const maxAccelWindow = 12 * time.Hour
+
+// maxRecentSamples caps the in-memory buffer per currency regardless of window
+const maxRecentSamples = 10000
+
+// priceSample is one price observation held in memory
+type priceSample struct {
+	time  time.Time
+	price float64
+}
+
+// recentPriceBuffer keeps the latest samples per currency for rules that need
+// more than the newest value. It lives in memory only, so it starts empty on
+// every restart and fills as prices are fetched.
+type recentPriceBuffer struct {
+	mu      sync.Mutex
+	samples map[string][]priceSample // currency -> samples, oldest first
+}
+
+// recentPrices is the process-wide sample buffer fed by evaluateAlerts
+var recentPrices = &recentPriceBuffer{samples: make(map[string][]priceSample)}
+
+// add appends a sample and drops those older than retention
+func (b *recentPriceBuffer) add(currency string, price float64, at time.Time, retention time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	samples := append(b.samples[currency], priceSample{time: at, price: price})
+
+	// Drop samples older than the cutoff, but keep the newest one at or before it:
+	// it is the reference price for the start of the oldest window
+	cutoff := at.Add(-retention)
+	drop := 0
+	for drop+1 < len(samples) && !samples[drop+1].time.After(cutoff) {
+		drop++
+	}
+	if len(samples)-drop > maxRecentSamples {
+		drop = len(samples) - maxRecentSamples
+	}
+	b.samples[currency] = samples[drop:]
+}
+
+// priceAt returns the newest sample at or before t; false when the buffer doesn't reach back that far
+func (b *recentPriceBuffer) priceAt(currency string, t time.Time) (float64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	samples := b.samples[currency]
+	for i := len(samples) - 1; i >= 0; i-- {
+		if !samples[i].time.After(t) {
+			return samples[i].price, true
+		}
+	}
+	return 0, false
+}
+
+// accelRetention returns how long samples must be kept for the given rules
+func accelRetention(rules []AlertRule) time.Duration {
+	retention := time.Duration(0)
+	for _, r := range rules {
+		if r.Kind == AlertAccel && 2*r.Window > retention {
+			retention = 2 * r.Window
+		}
+	}
+	return retention
+}
+
+// evaluateAccel checks an accel rule against the buffered samples
+// It compares the percent change over the latest window with the change over the
+// window before it: the rule is met when the latest move is at least the threshold
+// and is faster in its own direction than the previous one (including reversals).
+func evaluateAccel(rule AlertRule, price float64, now time.Time) (met bool, change, prevChange float64) {
+	mid, ok := recentPrices.priceAt(rule.Currency, now.Add(-rule.Window))
+	if !ok {
+		return false, 0, 0
+	}
+	start, ok := recentPrices.priceAt(rule.Currency, now.Add(-2*rule.Window))
+	if !ok {
+		return false, 0, 0
+	}
+
+	change = percentChange(mid, price)
+	prevChange = percentChange(start, mid)
+
+	fastEnough := change >= rule.Threshold || change <= -rule.Threshold
+	accelerating := change*(change-prevChange) > 0
+	return fastEnough && accelerating, change, prevChange
+}
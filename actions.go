@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"          // Package for Slack response bodies
+	"crypto/ed25519" // Package for the Discord public key type
+	"crypto/hmac"    // Package for verifying Slack signatures
+	"crypto/sha256"  // Package for verifying Slack signatures
+	"crypto/subtle"  // Package for comparing the Telegram secret token
+	"encoding/hex"   // Package for decoding Slack signatures
+	"encoding/json"  // Package for callback payloads
+	"fmt"            // Package for formatted I/O operations
+	"io"             // Package for reading request bodies
+	"log/slog"       // Package for structured logging
+	"net/http"       // Package for the callback endpoints
+	"net/url"        // Package for decoding Slack form bodies
+	"strconv"        // Package for parsing rule IDs and timestamps
+	"strings"        // Package for string manipulation
+	"time"           // Package for snooze durations
+)
+
+// Actions recipients can take on a rule from a notification or the CLI
+const (
+	ActionSnooze   = "snooze"   // Pause the rule for a duration
+	ActionUnsnooze = "unsnooze" // End a snooze early
+	ActionDisable  = "disable"  // Pause the rule until it is re-enabled
+	ActionEnable   = "enable"   // Re-enable a disabled rule
+)
+
+// alertSnoozeOptions are the snooze durations offered as notification buttons
+var alertSnoozeOptions = []string{"1h", "24h"}
+
+// slackSignatureMaxAge rejects Slack requests older than this, preventing replays
+const slackSignatureMaxAge = 5 * time.Minute
+
+// chatBotConfig holds the secrets that authenticate button callbacks and chat commands
+// Buttons are only attached to notifications when the matching secret is set
+type chatBotConfig struct {
+	slackSecret    string            // SLACK_SIGNING_SECRET from the Slack app's Basic Information page
+	telegramSecret string            // TELEGRAM_WEBHOOK_SECRET, the secret_token passed to setWebhook
+	telegramToken  string            // TELEGRAM_BOT_TOKEN, for uploading charts
+	telegramChatID string            // Only callbacks and commands from this chat are accepted
+	discordKey     ed25519.PublicKey // DISCORD_PUBLIC_KEY from the Discord application's General Information page
+}
+
+// chatBots is the callback and command configuration, loaded with the notifiers
+var chatBots chatBotConfig
+
+// alertActionButton is one button attached to an alert notification
+type alertActionButton struct {
+	id    string // Stable button identifier, e.g. "snooze_1h"
+	label string // Text shown on the button
+	value string // Encoded action sent back when pressed, e.g. "snooze:3:1h"
+}
+
+// alertActionButtons returns the snooze and disable buttons for a rule
+// The values stay well below Telegram's 64-byte callback_data limit
+func alertActionButtons(ruleID int) []alertActionButton {
+	var buttons []alertActionButton
+	for _, d := range alertSnoozeOptions {
+		buttons = append(buttons, alertActionButton{
+			id:    ActionSnooze + "_" + d,
+			label: "Snooze " + d,
+			value: fmt.Sprintf("%s:%d:%s", ActionSnooze, ruleID, d),
+		})
+	}
+	return append(buttons, alertActionButton{
+		id:    ActionDisable,
+		label: "Disable",
+		value: fmt.Sprintf("%s:%d", ActionDisable, ruleID),
+	})
+}
+
+// parseAlertAction decodes a button value: "snooze:<id>:<duration>" or "disable:<id>"
+func parseAlertAction(value string) (int, string, time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 {
+		return 0, "", 0, fmt.Errorf("invalid action %q", value)
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, "", 0, fmt.Errorf("invalid rule id in action %q", value)
+	}
+
+	switch action := parts[0]; {
+	case action == ActionSnooze && len(parts) == 3:
+		d, err := time.ParseDuration(parts[2])
+		if err != nil || d <= 0 {
+			return 0, "", 0, fmt.Errorf("invalid snooze duration in action %q", value)
+		}
+		return id, action, d, nil
+	case action == ActionDisable && len(parts) == 2:
+		return id, action, 0, nil
+	}
+	return 0, "", 0, fmt.Errorf("unknown action %q", value)
+}
+
+// applyAlertAction snoozes, disables, or re-enables a rule and returns a confirmation
+// d is the snooze duration and is ignored by the other actions
+func applyAlertAction(repo *Repository, ruleID int, action string, d time.Duration) (string, error) {
+	var err error
+	var message string
+	switch action {
+	case ActionSnooze:
+		until := time.Now().Add(d).UTC()
+		err = repo.SnoozeAlertRule(ruleID, &until)
+		message = fmt.Sprintf("Alert %d snoozed until %s", ruleID, until.Format("2006-01-02 15:04 UTC"))
+	case ActionUnsnooze:
+		err = repo.SnoozeAlertRule(ruleID, nil)
+		message = fmt.Sprintf("Alert %d is no longer snoozed", ruleID)
+	case ActionDisable:
+		err = repo.SetAlertDisabled(ruleID, true)
+		message = fmt.Sprintf("Alert %d disabled; re-enable it with: alerts enable %d", ruleID, ruleID)
+	case ActionEnable:
+		err = repo.SetAlertDisabled(ruleID, false)
+		message = fmt.Sprintf("Alert %d enabled", ruleID)
+	default:
+		return "", fmt.Errorf("unknown action %q", action)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	slog.Info("Applied alert action", "rule", ruleID, "action", action, "duration", d)
+	incCounter("tracker_alert_actions_total", map[string]string{"action": action}, 1)
+	return message, nil
+}
+
+// verifySlackSignature checks the X-Slack-Signature header of an interaction request
+// Signature format: "v0=" + hex(HMAC-SHA256(secret, "v0:" + timestamp + ":" + body))
+func verifySlackSignature(secret, timestamp, signature string, body []byte, now time.Time) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > slackSignatureMaxAge || age < -slackSignatureMaxAge {
+		return false
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "v0="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// handleSlackAction serves POST /actions/slack, the Slack app's interactivity request URL
+// Slack only needs a quick 200; the confirmation is posted to the interaction's response_url
+func (s *apiServer) handleSlackAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	secret := chatBots.slackSecret
+	if secret == "" {
+		writeAPIError(w, http.StatusNotFound, "slack actions are not configured")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	if !verifySlackSignature(secret, r.Header.Get("X-Slack-Request-Timestamp"), r.Header.Get("X-Slack-Signature"), body, time.Now()) {
+		writeAPIError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+
+	// Body format: payload={"type": "block_actions", "user": {...}, "response_url": "...", "actions": [...]}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid form body")
+		return
+	}
+	var payload struct {
+		Type string `json:"type"`
+		User struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+		ResponseURL string `json:"response_url"`
+		Actions     []struct {
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if payload.Type != "block_actions" {
+		return
+	}
+
+	for _, action := range payload.Actions {
+		message, err := runCallbackAction(s.repo, action.Value, "slack", payload.User.Username)
+		if err != nil {
+			message = "Failed to update the alert: " + err.Error()
+		} else {
+			message += " by <@" + payload.User.ID + ">"
+		}
+		if payload.ResponseURL != "" {
+			postSlackResponse(payload.ResponseURL, message)
+		}
+	}
+}
+
+// postSlackResponse posts a confirmation below the alert message
+func postSlackResponse(responseURL, text string) {
+	body, _ := json.Marshal(map[string]interface{}{"response_type": "in_channel", "replace_original": false, "text": text})
+	resp, err := httpClient.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("Failed to post slack action response", "error", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// handleTelegramWebhook serves POST /actions/telegram, the bot's webhook
+// Telegram sends the TELEGRAM_WEBHOOK_SECRET in a header on every update. The answer
+// to a button press is returned in the response body as an answerCallbackQuery call,
+// so no separate API request is needed. Messages starting with "/" are chat commands.
+func (s *apiServer) handleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	secret := chatBots.telegramSecret
+	if secret == "" {
+		writeAPIError(w, http.StatusNotFound, "telegram actions are not configured")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(secret)) != 1 {
+		writeAPIError(w, http.StatusUnauthorized, "invalid secret token")
+		return
+	}
+
+	// Update format: {"update_id": 1, "callback_query": {"id": "...", "from": {...}, "message": {"chat": {"id": -100...}}, "data": "snooze:3:1h"}}
+	// or {"update_id": 2, "message": {"chat": {"id": -100...}, "from": {...}, "text": "/chart 90d eur"}}
+	var update struct {
+		Message *struct {
+			Chat struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+			From struct {
+				Username string `json:"username"`
+			} `json:"from"`
+			Text string `json:"text"`
+		} `json:"message"`
+		CallbackQuery *struct {
+			ID   string `json:"id"`
+			From struct {
+				Username string `json:"username"`
+			} `json:"from"`
+			Message *struct {
+				Chat struct {
+					ID int64 `json:"id"`
+				} `json:"chat"`
+			} `json:"message"`
+			Data string `json:"data"`
+		} `json:"callback_query"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&update); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid update")
+		return
+	}
+
+	// Channel usernames (@name) can't be compared with the numeric chat ID of the update
+	chatID := chatBots.telegramChatID
+	fromChat := func(id int64) bool {
+		return strings.HasPrefix(chatID, "@") || chatID == strconv.FormatInt(id, 10)
+	}
+
+	if msg := update.Message; msg != nil && strings.HasPrefix(msg.Text, "/") {
+		if !fromChat(msg.Chat.ID) {
+			slog.Warn("Ignoring telegram command from another chat", "user", msg.From.Username)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		answerTelegramCommand(s.repo, w, strconv.FormatInt(msg.Chat.ID, 10), msg.From.Username, msg.Text)
+		return
+	}
+	query := update.CallbackQuery
+	if query == nil {
+		// Other updates (plain messages to the bot) are acknowledged and ignored
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var message string
+	if query.Message == nil || !fromChat(query.Message.Chat.ID) {
+		slog.Warn("Ignoring telegram callback from another chat", "user", query.From.Username)
+		message = "This alert belongs to another chat"
+	} else if msg, err := runCallbackAction(s.repo, query.Data, "telegram", query.From.Username); err != nil {
+		message = "Failed to update the alert: " + err.Error()
+	} else {
+		message = msg
+	}
+
+	// Always answer with 200, otherwise Telegram keeps redelivering the update
+	writeJSON(w, http.StatusOK, map[string]string{
+		"method":            "answerCallbackQuery",
+		"callback_query_id": query.ID,
+		"text":              message,
+	})
+}
+
+// runCallbackAction decodes and applies an action from a notification button
+func runCallbackAction(repo *Repository, value, channel, user string) (string, error) {
+	ruleID, action, d, err := parseAlertAction(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid alert action", "channel", channel, "user", user, "error", err)
+		return "", err
+	}
+	slog.Info("Alert action requested", "channel", channel, "user", user, "rule", ruleID, "action", action)
+	return applyAlertAction(repo, ruleID, action, d)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"  // Package for fetching within the fetch deadline
+	"errors"   // Package for combining source errors
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"slices"   // Package for ordering contributing sources
+	"strconv"  // Package for parsing weights and the quorum
+	"strings"  // Package for parsing PRICE_SOURCE_WEIGHTS
+	"sync"     // Package for fetching every source at once
+	"time"     // Package for quote times
+
+	"bitcoin-tracker/tracker" // Sources, partial errors, and price validation
+)
+
+// Ways prices are combined from the sources of PRICE_SOURCES
+const (
+	aggregationFailover = "failover" // The first source that answers supplies the price
+	aggregationWeighted = "weighted" // Every source is asked, and their prices are averaged by weight
+)
+
+// AggregationConfig controls how one consolidated price per currency is made from the
+// sources of PRICE_SOURCES
+type AggregationConfig struct {
+	Mode    string             // aggregationFailover or aggregationWeighted
+	Weights map[string]float64 // Weight of each source in a weighted price; 1 when not listed
+	Quorum  int                // Fewest sources that must price a currency before it is stored
+}
+
+// aggregationConfig is the active configuration, loaded at startup
+var aggregationConfig = AggregationConfig{Mode: aggregationFailover, Quorum: 1}
+
+// weighted reports whether prices are averaged across sources
+func (c AggregationConfig) weighted() bool {
+	return c.Mode == aggregationWeighted
+}
+
+// weight returns the weight of a source
+func (c AggregationConfig) weight(source string) float64 {
+	if w, ok := c.Weights[source]; ok {
+		return w
+	}
+	return 1
+}
+
+// loadAggregationConfig reads PRICE_AGGREGATION (failover or weighted),
+// PRICE_SOURCE_WEIGHTS (e.g. "coinbase=2,kraken=1"), and PRICE_QUORUM
+// Call it after the price sources have been loaded; the quorum defaults to a majority of them.
+func loadAggregationConfig(sources []PriceSource) (AggregationConfig, error) {
+	c := AggregationConfig{Mode: aggregationFailover, Weights: make(map[string]float64), Quorum: 1}
+	switch v := strings.ToLower(os.Getenv("PRICE_AGGREGATION")); v {
+	case "", aggregationFailover:
+	case aggregationWeighted:
+		c.Mode = aggregationWeighted
+	default:
+		return c, fmt.Errorf("invalid PRICE_AGGREGATION %q (expected failover or weighted)", v)
+	}
+
+	names := make([]string, len(sources))
+	for i, source := range sources {
+		names[i] = source.Name()
+	}
+	if v := os.Getenv("PRICE_SOURCE_WEIGHTS"); v != "" {
+		for _, pair := range strings.Split(v, ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if !ok || err != nil || w <= 0 {
+				return c, fmt.Errorf("invalid PRICE_SOURCE_WEIGHTS entry %q (expected source=weight, e.g. kraken=2)", pair)
+			}
+			if !slices.Contains(names, name) {
+				return c, fmt.Errorf("PRICE_SOURCE_WEIGHTS names %q, which is not in PRICE_SOURCES", name)
+			}
+			c.Weights[name] = w
+		}
+	}
+
+	if !c.weighted() {
+		if len(c.Weights) > 0 || os.Getenv("PRICE_QUORUM") != "" {
+			return c, fmt.Errorf("PRICE_SOURCE_WEIGHTS and PRICE_QUORUM need PRICE_AGGREGATION=weighted")
+		}
+		return c, nil
+	}
+	if len(sources) < 2 {
+		return c, fmt.Errorf("PRICE_AGGREGATION=weighted needs at least two PRICE_SOURCES")
+	}
+	c.Quorum = len(sources)/2 + 1
+	if v := os.Getenv("PRICE_QUORUM"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > len(sources) {
+			return c, fmt.Errorf("invalid PRICE_QUORUM %q (expected 1 to %d, the number of PRICE_SOURCES)", v, len(sources))
+		}
+		c.Quorum = n
+	}
+	return c, nil
+}
+
+// aggregateSourceSeparator joins the sources of a weighted price in its source,
+// e.g. "coinbase+kraken"
+const aggregateSourceSeparator = "+"
+
+// quorumDegraded reports whether a price with the given source was aggregated from
+// fewer than every source of PRICE_SOURCES
+func quorumDegraded(source string) bool {
+	if !aggregationConfig.weighted() {
+		return false
+	}
+	return len(strings.Split(source, aggregateSourceSeparator)) < len(priceSources)
+}
+
+// fetchWeighted asks every source of PRICE_SOURCES at once and averages the prices each
+// currency got by the sources' weights. A currency priced by fewer than PRICE_QUORUM
+// sources is left out and reported in a *tracker.PartialError (wrapped when no currency
+// met the quorum). The source of each price lists the sources that contributed, and it
+// counts as quoted when the oldest of their prices was.
+func fetchWeighted(ctx context.Context, repo *Repository, asset string, currencies []string) (map[string]float64, map[string]string, map[string]time.Time, error) {
+	quotes := make([]map[string]float64, len(priceSources))
+	quoteTimes := make([]map[string]time.Time, len(priceSources))
+	errs := make([]error, len(priceSources))
+	var wg sync.WaitGroup
+	for i, source := range priceSources {
+		wg.Add(1)
+		go func(i int, source PriceSource) {
+			defer wg.Done()
+			// A panic on a bad response only fails this source
+			errs[i] = runRecovered("source "+source.Name(), func() error {
+				got, at, err := tracker.FetchQuotes(ctx, providerFetcher{repo: repo}, source, asset, currencies)
+				quotes[i], quoteTimes[i] = got, at // Whatever a partial failure still priced
+				return err
+			})
+		}(i, source)
+	}
+	wg.Wait()
+
+	prices := make(map[string]float64, len(currencies))
+	sources := make(map[string]string, len(currencies))
+	quoted := make(map[string]time.Time, len(currencies))
+	failed := make(map[string]error)
+	for _, currency := range currencies {
+		var contributors []string
+		var sum, weights float64
+		var missing []error
+		for i, source := range priceSources {
+			price, ok := quotes[i][currency]
+			err := tracker.CurrencyError(errs[i], currency)
+			if ok && err == nil {
+				err = tracker.ValidatePrice(currency, price)
+			}
+			if !ok && err == nil {
+				err = fmt.Errorf("no %s price returned", currency)
+			}
+			if !ok || err != nil {
+				missing = append(missing, fmt.Errorf("%s: %w", source.Name(), err))
+				continue
+			}
+			w := aggregationConfig.weight(source.Name())
+			sum += price * w
+			weights += w
+			contributors = append(contributors, source.Name())
+			if at := quoteTimes[i][currency]; quoted[currency].IsZero() || at.Before(quoted[currency]) {
+				quoted[currency] = at
+			}
+		}
+
+		if len(contributors) < aggregationConfig.Quorum {
+			failed[currency] = fmt.Errorf("only %d of %d sources priced it, short of PRICE_QUORUM=%d: %w",
+				len(contributors), len(priceSources), aggregationConfig.Quorum, errors.Join(missing...))
+			incCounter("tracker_quorum_failures_total", map[string]string{"currency": currency}, 1)
+			continue
+		}
+		slices.Sort(contributors)
+		prices[currency] = sum / weights
+		sources[currency] = strings.Join(contributors, aggregateSourceSeparator)
+		if len(missing) > 0 {
+			slog.Warn("Price aggregated with degraded quorum", "coin", asset, "currency", currency,
+				"sources", sources[currency], "quorum", aggregationConfig.Quorum, "error", errors.Join(missing...))
+			incCounter("tracker_quorum_degraded_total", map[string]string{"currency": currency}, 1)
+		}
+	}
+
+	if len(failed) == 0 {
+		return prices, sources, quoted, nil
+	}
+	partial := &tracker.PartialError{Failed: failed}
+	if len(prices) == 0 {
+		return nil, nil, nil, fmt.Errorf("price quorum not met: %w", partial)
+	}
+	return prices, sources, quoted, partial
+}
@@ -0,0 +1,812 @@
+package main
+
+import (
+	"context"  // Package for valuing the portfolio within the fetch's context
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for absolute percent changes
+	"os"       // Package for environment variables
+	"slices"   // Package for checking configured indicators and rule IDs
+	"strconv"  // Package for parsing CLI arguments
+	"strings"  // Package for string manipulation
+	"sync"     // Package for guarding engine state
+	"time"     // Package for windows and timestamps
+)
+
+// Alert rule kinds
+const (
+	AlertAbove     = "above"     // Price rises above the threshold
+	AlertBelow     = "below"     // Price falls below the threshold
+	AlertChange    = "change"    // Price moves by at least threshold percent (either direction) within the window
+	AlertAccel     = "accel"     // Like change, and the move is faster than in the window before it
+	AlertPattern   = "pattern"   // A candlestick pattern with at least threshold confidence is detected
+	AlertLevel     = "level"     // Price comes within threshold percent of a support/resistance level
+	AlertIndicator = "indicator" // An indicator condition such as sma50>sma200 (golden cross) starts to hold
+	AlertPortfolio = "portfolio" // Portfolio value or a position's gain crosses a threshold, e.g. value>50000
+)
+
+// AlertRule is a condition evaluated against every new price sample
+type AlertRule struct {
+	ID            int           `json:"id"`
+	Kind          string        `json:"kind"`                // One of the Alert* constants
+	Threshold     float64       `json:"threshold"`           // Price for above/below, percent for change and level, seconds for latency
+	Window        time.Duration `json:"window,omitempty"`    // Look-back window for change and accel rules
+	Currency      string        `json:"currency"`            // Fiat currency the rule watches
+	Regime        string        `json:"regime,omitempty"`    // Only fire during this volatility regime (empty = any)
+	Channels      []string      `json:"channels,omitempty"`  // Notifier channels to use (empty = all)
+	Cooldown      time.Duration `json:"cooldown,omitempty"`  // Minimum time between notifications (0 = ALERT_COOLDOWN)
+	Pattern       string        `json:"pattern,omitempty"`   // Candlestick pattern for pattern rules (empty = any)
+	Indicator     string        `json:"indicator,omitempty"` // Condition for indicator rules, e.g. "1d:sma50>sma200"
+	Portfolio     string        `json:"portfolio,omitempty"` // Condition for portfolio rules, e.g. "bitcoin:gain_pct>25"
+	Basket        string        `json:"basket,omitempty"`    // Basket whose value above, below, and change rules watch instead of the Bitcoin price
+	Triggered     bool          `json:"triggered"`           // Condition was met at the last evaluation
+	LastTriggered *time.Time    `json:"last_triggered,omitempty"`
+	SnoozedUntil  *time.Time    `json:"snoozed_until,omitempty"` // Rule is paused until this time
+	Disabled      bool          `json:"disabled,omitempty"`      // Rule is paused until re-enabled
+	CreatedAt     time.Time     `json:"created_at"`
+	Tenant        string        `json:"tenant,omitempty"` // Tenant the rule belongs to; empty for alerts that don't come from rules
+}
+
+// paused reports whether a rule is disabled or snoozed, so it must not be evaluated
+func (r AlertRule) paused(now time.Time) bool {
+	return r.Disabled || (r.SnoozedUntil != nil && now.Before(*r.SnoozedUntil))
+}
+
+// Condition describes the rule in human-readable form, e.g. "above 50,000.00 USD"
+func (r AlertRule) Condition() string {
+	if r.Basket != "" {
+		return r.Basket + " " + AlertRule{Kind: r.Kind, Threshold: r.Threshold, Window: r.Window, Currency: r.Currency}.Condition()
+	}
+	switch r.Kind {
+	case AlertChange:
+		return fmt.Sprintf("moves %.2f%% within %s", r.Threshold, r.Window)
+	case AlertAccel:
+		return fmt.Sprintf("accelerates past %.2f%% per %s", r.Threshold, r.Window)
+	case AlertPattern:
+		pattern := r.Pattern
+		if pattern == "" {
+			pattern = "any"
+		}
+		return fmt.Sprintf("pattern %s (confidence >= %.2f)", pattern, r.Threshold)
+	case AlertLevel:
+		return fmt.Sprintf("within %.2f%% of a level", r.Threshold)
+	case AlertLatency:
+		return "latency above " + formatLatency(r.Threshold)
+	case AlertPeg:
+		return fmt.Sprintf("more than %.2f%% off the 1.00 USD peg", r.Threshold)
+	case AlertIndicator:
+		c, err := parseIndicatorCondition(r.Indicator, CandleDaily)
+		if err != nil {
+			return "indicator " + r.Indicator
+		}
+		return fmt.Sprintf("%s %s %s (%s)", c.Left, c.Op, c.Right, c.Resolution)
+	case AlertPortfolio:
+		c, err := parsePortfolioCondition(r.Portfolio)
+		if err != nil {
+			return "portfolio " + r.Portfolio
+		}
+		return fmt.Sprintf("%s %s %s %s", c.Target(), c.Metric, c.Op, formatPortfolioMetric(c.Metric, c.Threshold, r.Currency))
+	case AlertDigest:
+		return "digest of held alerts"
+	case AlertATH:
+		return fmt.Sprintf("new all-time high above %s %s", formatPrice(r.Threshold), strings.ToUpper(r.Currency))
+	case AlertStale:
+		return fmt.Sprintf("no %s price for %s", strings.ToUpper(r.Currency), r.Window)
+	default:
+		return fmt.Sprintf("%s %s %s", r.Kind, formatPrice(r.Threshold), strings.ToUpper(r.Currency))
+	}
+}
+
+// Alert is a rule that fired, ready to be delivered by notifiers
+type Alert struct {
+	Rule       AlertRule
+	Price      float64        // Price that triggered the rule
+	Change     float64        // Percent change over the window (change and accel rules), or from the level (level rules)
+	PrevChange float64        // Percent change over the window before that (accel rules only)
+	Pattern    *CandlePattern // Detected pattern (pattern rules only)
+	Level      *PriceLevel    // Nearest support/resistance level (level rules only)
+	Left       float64        // Left operand of the condition (indicator rules only)
+	Right      float64        // Right operand of the condition (indicator rules only)
+	Metric     float64        // Watched portfolio metric (portfolio rules only)
+	Latency    float64        // Seconds from quote to write of the newest price (latency rules only)
+	Stablecoin string         // Ticker of the stablecoin, e.g. "usdt" (peg alerts only)
+	Target     *PriceTarget   // Crossed price target (target alerts only)
+	Age        time.Duration  // Time without a stored price (stale alerts only)
+	Message    string         // Localized notification text
+	Time       time.Time      // When the rule fired
+}
+
+// Event type emitted when an alert fires
+const EventAlertTriggered = "alert.triggered"
+
+// alertEngineState holds live information about rule evaluation for the status command
+type alertEngineState struct {
+	mu             sync.Mutex
+	lastEvaluation time.Time // When rules were last evaluated
+	lastFired      time.Time // When any rule last fired
+	lastError      string    // Most recent evaluation error, if any
+}
+
+// alertEngine is the process-wide rule engine state
+var alertEngine = &alertEngineState{}
+
+// AlertStatus describes the alert engine for the status command
+type AlertStatus struct {
+	Rules          int              `json:"rules"`     // Stored rules
+	Triggered      int              `json:"triggered"` // Rules whose condition is currently met
+	LastEvaluation time.Time        `json:"last_evaluation,omitempty"`
+	LastFired      time.Time        `json:"last_fired,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	Notifiers      []NotifierStatus `json:"notifiers"`
+}
+
+// evaluateRule checks a rule against the current price
+// It returns whether the condition is met and the alert that would fire, with the
+// percent changes filled in for change and accel rules
+func evaluateRule(repo *Repository, rule AlertRule, price float64, now time.Time) (bool, Alert, error) {
+	a := Alert{Rule: rule, Price: price, Time: now.UTC()}
+
+	// Rules restricted to a volatility regime are dormant outside it
+	if rule.Regime != "" && currentVolatilityRegime(repo, rule.Currency) != rule.Regime {
+		return false, a, nil
+	}
+
+	switch rule.Kind {
+	case AlertAbove:
+		return price > rule.Threshold, a, nil
+	case AlertBelow:
+		return price < rule.Threshold, a, nil
+	case AlertChange:
+		past, ok, err := repo.PriceBefore(rule.Currency, rule.Window)
+		if err != nil || !ok {
+			return false, a, err
+		}
+		a.Change = percentChange(past, price)
+		return math.Abs(a.Change) >= rule.Threshold, a, nil
+	case AlertAccel:
+		// Evaluated over the in-memory sample buffer rather than the database
+		var met bool
+		met, a.Change, a.PrevChange = evaluateAccel(rule, price, now)
+		return met, a, nil
+	case AlertPattern:
+		// Fired by routePatternAlerts when candles complete, not by price samples
+		return false, a, nil
+	case AlertPortfolio:
+		// Evaluated by evaluatePortfolioRule against a portfolio valuation
+		return false, a, nil
+	case AlertLevel:
+		levels, err := repo.PriceLevels(rule.Currency)
+		if err != nil {
+			return false, a, err
+		}
+		level, distance, ok := nearestLevel(levels, price)
+		if !ok {
+			return false, a, nil
+		}
+		a.Level = &level
+		a.Change = percentChange(level.Price, price)
+		return distance <= rule.Threshold, a, nil
+	case AlertIndicator:
+		c, err := parseIndicatorCondition(rule.Indicator, CandleDaily)
+		if err != nil {
+			return false, a, err
+		}
+		met, left, right, ok, err := evaluateIndicatorCondition(repo, c, rule.Currency, price)
+		if err != nil || !ok {
+			return false, a, err
+		}
+		a.Left, a.Right = left, right
+		return met, a, nil
+	case AlertLatency:
+		latency, ok := latestLatency(rule.Currency)
+		a.Latency = latency
+		return ok && latency > rule.Threshold, a, nil
+	default:
+		return false, a, fmt.Errorf("unknown alert kind %q", rule.Kind)
+	}
+}
+
+// evaluatePortfolioRule checks a portfolio rule against a valuation of its tenant's
+// holdings in the rule's currency. Valuations are shared through valuations, so each
+// portfolio is valued once per evaluation however many rules watch it; price is the
+// Bitcoin price, if fetched in that currency, for the alert's context only.
+func evaluatePortfolioRule(ctx context.Context, repo *Repository, rule AlertRule, price float64, valuations map[string]PortfolioValuation, now time.Time) (bool, Alert, error) {
+	a := Alert{Rule: rule, Price: price, Time: now.UTC()}
+	if rule.Regime != "" && currentVolatilityRegime(repo, rule.Currency) != rule.Regime {
+		return false, a, nil
+	}
+
+	c, err := parsePortfolioCondition(rule.Portfolio)
+	if err != nil {
+		return false, a, err
+	}
+	key := rule.Tenant + "/" + rule.Currency
+	v, ok := valuations[key]
+	if !ok {
+		if v, err = valuePortfolio(ctx, repo, rule.Tenant, rule.Currency); err != nil {
+			return false, a, fmt.Errorf("failed to value portfolio: %w", err)
+		}
+		valuations[key] = v
+	}
+
+	metric, ok, err := portfolioMetric(v, c)
+	if err != nil || !ok {
+		return false, a, err
+	}
+	a.Metric = metric
+	if c.Op == ">" {
+		return metric > c.Threshold, a, nil
+	}
+	return metric < c.Threshold, a, nil
+}
+
+// formatPortfolioMetric renders a metric value: a signed percentage for gain_pct,
+// otherwise an amount in currency
+func formatPortfolioMetric(metric string, v float64, currency string) string {
+	if metric == MetricGainPct {
+		return fmt.Sprintf("%+.2f%%", v)
+	}
+	return formatPrice(v) + " " + strings.ToUpper(currency)
+}
+
+// alertMessage renders the localized notification text for a fired rule
+// Reference prices in the rule's currency are appended so the recipient sees
+// how the move compares against their own price points
+func alertMessage(repo *Repository, a Alert) string {
+	data := map[string]interface{}{
+		"Price":      a.Price,
+		"Currency":   a.Rule.Currency,
+		"Threshold":  a.Rule.Threshold,
+		"Change":     a.Change,
+		"PrevChange": a.PrevChange,
+		"Window":     a.Rule.Window.String(),
+	}
+	if a.Pattern != nil {
+		data["Pattern"] = a.Pattern.Pattern
+		data["Resolution"] = a.Pattern.Resolution
+		data["Confidence"] = a.Pattern.Confidence
+	}
+	if a.Level != nil {
+		data["Level"] = a.Level.Price
+		data["LevelKind"] = a.Level.Kind
+		data["Touches"] = a.Level.Touches
+	}
+	if a.Rule.Kind == AlertIndicator {
+		if c, err := parseIndicatorCondition(a.Rule.Indicator, CandleDaily); err == nil {
+			data["Indicator"] = c.Left + " " + c.Op + " " + c.Right
+			data["Resolution"] = c.Resolution
+		}
+		data["Left"] = a.Left
+		data["Right"] = a.Right
+	}
+	if a.Rule.Basket != "" {
+		// Basket rules are about the basket's value, which reference prices don't compare to
+		data["Basket"] = a.Rule.Basket
+		return renderMessage("", "alert.basket_"+a.Rule.Kind, data)
+	}
+	if a.Rule.Kind == AlertLatency {
+		// Latency rules are about the pipeline rather than the price, so reference
+		// price comparisons would be noise
+		data["Latency"] = formatLatency(a.Latency)
+		data["Limit"] = formatLatency(a.Rule.Threshold)
+		return renderMessage("", "alert.latency", data)
+	}
+	if a.Rule.Kind == AlertPeg {
+		// Peg alerts are about a stablecoin, so reference prices of Bitcoin don't apply
+		data["Coin"] = strings.ToUpper(a.Stablecoin)
+		data["Samples"] = pegConfig.Samples
+		if math.Abs(a.Change) <= a.Rule.Threshold {
+			return renderMessage("", "alert.peg_restored", data)
+		}
+		return renderMessage("", "alert.peg", data)
+	}
+	if a.Rule.Kind == AlertStale {
+		// Stale alerts are about the scheduler rather than the price
+		data["Age"] = a.Age.Round(time.Second).String()
+		data["Intervals"] = int(a.Rule.Threshold)
+		if a.Age > a.Rule.Window {
+			return renderMessage("", "alert.stale", data)
+		}
+		return renderMessage("", "alert.stale_restored", data)
+	}
+	if a.Rule.Kind == AlertPortfolio {
+		// Portfolio rules are about the holdings rather than the Bitcoin price, so they
+		// get a message per direction and no reference price comparisons
+		c, err := parsePortfolioCondition(a.Rule.Portfolio)
+		if err != nil {
+			return renderMessage("", "alert.portfolio_above", data)
+		}
+		data["Target"] = c.Target()
+		data["Metric"] = c.Metric
+		data["Limit"] = formatPortfolioMetric(c.Metric, c.Threshold, a.Rule.Currency)
+		data["Amount"] = formatPortfolioMetric(c.Metric, a.Metric, a.Rule.Currency)
+		if c.Op == "<" {
+			return renderMessage("", "alert.portfolio_below", data)
+		}
+		return renderMessage("", "alert.portfolio_above", data)
+	}
+	key := "alert." + a.Rule.Kind
+	if a.Target != nil {
+		data["Note"] = a.Target.Note
+		key = "alert.target_" + a.Target.Direction
+	}
+	lines := []string{renderMessage("", key, data)}
+
+	refs, err := repo.References(a.Rule.Currency)
+	if err != nil {
+		slog.Warn("Failed to load reference prices for alert", "rule", a.Rule.ID, "error", err)
+	}
+	for _, ref := range refs {
+		lines = append(lines, renderMessage("", "reference.comparison", map[string]interface{}{
+			"Name":     ref.Name,
+			"Price":    ref.Price,
+			"Currency": ref.Currency,
+			"Change":   percentChange(ref.Price, a.Price),
+			"Date":     ref.Date.Format("2006-01-02"),
+		}))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// alertCooldown is the default minimum time between two notifications for one rule
+// Configured via ALERT_COOLDOWN; rules can override it individually
+var alertCooldown = time.Hour
+
+// loadAlertCooldown reads ALERT_COOLDOWN (e.g. "30m"); "0" disables rate limiting
+func loadAlertCooldown() (time.Duration, error) {
+	v := os.Getenv("ALERT_COOLDOWN")
+	if v == "" {
+		return time.Hour, nil
+	}
+	if v == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid ALERT_COOLDOWN %q", v)
+	}
+	return d, nil
+}
+
+// inCooldown reports whether a rule notified too recently to notify again
+func (r AlertRule) inCooldown(now time.Time) bool {
+	cooldown := r.Cooldown
+	if cooldown == 0 {
+		cooldown = alertCooldown
+	}
+	return r.LastTriggered != nil && now.Sub(*r.LastTriggered) < cooldown
+}
+
+// evaluateAlerts checks every rule against the latest prices and fires those whose
+// condition has just become true. A rule fires once when its condition is met and
+// re-arms only after the condition clears, so a price sitting above a threshold
+// does not notify on every fetch. A price flapping around a threshold re-arms the
+// rule repeatedly, so each rule is also held to a cooldown between notifications.
+// Portfolio rules are checked against a valuation of the holdings taken under ctx.
+func evaluateAlerts(ctx context.Context, repo *Repository, prices map[string]float64) {
+	rules, err := repo.AlertRules(allTenants)
+	if err != nil {
+		slog.Error("Failed to load alert rules", "error", err)
+		alertEngine.setError(err)
+		return
+	}
+
+	// Feed the sample buffer used by accel rules, keeping only what they need
+	now := time.Now()
+	retention := accelRetention(rules)
+	for currency, price := range prices {
+		recentPrices.add(currency, price, now, retention)
+	}
+
+	valuations := make(map[string]PortfolioValuation)
+	stats := make(alertStatsBatch)
+	defer stats.save(repo)
+	for _, rule := range rules {
+		if rule.paused(now) {
+			continue
+		}
+
+		// Portfolio rules may be valued in a currency that isn't fetched
+		price, ok := prices[rule.Currency]
+		var met bool
+		var alert Alert
+		var err error
+		switch {
+		case rule.Kind == AlertPattern:
+			continue // Checked by routePatternAlerts as candles complete
+		case rule.Basket != "":
+			continue // Checked by evaluateBasketAlerts as basket values are stored
+		case rule.Kind == AlertPortfolio:
+			met, alert, err = evaluatePortfolioRule(ctx, repo, rule, price, valuations, now)
+		case ok:
+			met, alert, err = evaluateRule(repo, rule, price, now)
+		default:
+			continue
+		}
+		settleAlert(repo, rule, met, alert, err, stats, now)
+	}
+
+	alertEngine.mu.Lock()
+	alertEngine.lastEvaluation = time.Now()
+	alertEngine.mu.Unlock()
+}
+
+// settleAlert stores the outcome of evaluating a rule and fires the alert when its
+// condition has just become true outside the rule's cooldown
+func settleAlert(repo *Repository, rule AlertRule, met bool, alert Alert, err error, stats alertStatsBatch, now time.Time) {
+	stats.evaluated(rule, now, err)
+	if err != nil {
+		slog.Error("Failed to evaluate alert", "rule", rule.ID, "kind", rule.Kind, "error", err)
+		alertEngine.setError(err)
+		return
+	}
+	if met == rule.Triggered {
+		return
+	}
+
+	notify := met && !rule.inCooldown(now)
+	if err := repo.SetAlertTriggered(rule.ID, met, notify); err != nil {
+		slog.Error("Failed to store alert state", "rule", rule.ID, "error", err)
+		return
+	}
+	if met {
+		stats.triggered(rule, now, notify)
+	}
+	if notify {
+		fireAlert(repo, alert)
+	} else if met {
+		slog.Info("Alert triggered again within its cooldown, notification suppressed", "rule", rule.ID, "currency", rule.Currency, "price", alert.Price)
+	}
+}
+
+// evaluateBasketAlerts checks the basket rules against newly stored basket values
+// Rules of baskets that weren't valued in this tick keep their state.
+func evaluateBasketAlerts(ctx context.Context, repo *Repository, values []BasketValue) {
+	rules, err := repo.AlertRules(allTenants)
+	if err != nil {
+		slog.Error("Failed to load alert rules", "error", err)
+		alertEngine.setError(err)
+		return
+	}
+
+	now := time.Now()
+	stats := make(alertStatsBatch)
+	defer stats.save(repo)
+	for _, rule := range rules {
+		if rule.Basket == "" || rule.paused(now) {
+			continue
+		}
+		for _, v := range values {
+			if v.Basket == rule.Basket && v.Currency == rule.Currency {
+				met, alert, err := evaluateBasketRule(ctx, repo, rule, v.Value, now)
+				settleAlert(repo, rule, met, alert, err, stats, now)
+			}
+		}
+	}
+}
+
+// evaluateBasketRule checks an above, below, or change rule against a basket's value
+func evaluateBasketRule(ctx context.Context, repo *Repository, rule AlertRule, value float64, now time.Time) (bool, Alert, error) {
+	a := Alert{Rule: rule, Price: value, Time: now.UTC()}
+	switch rule.Kind {
+	case AlertAbove:
+		return value > rule.Threshold, a, nil
+	case AlertBelow:
+		return value < rule.Threshold, a, nil
+	case AlertChange:
+		past, ok, err := repo.BasketValueBefore(ctx, rule.Basket, rule.Currency, rule.Window)
+		if err != nil || !ok {
+			return false, a, err
+		}
+		a.Change = percentChange(past, value)
+		return math.Abs(a.Change) >= rule.Threshold, a, nil
+	default:
+		return false, a, fmt.Errorf("basket rules can't be of kind %q", rule.Kind)
+	}
+}
+
+// fireAlert renders the alert, sends it to every notifier, and publishes it as an event
+func fireAlert(repo *Repository, a Alert) {
+	rule := a.Rule
+	a.Message = alertMessage(repo, a)
+
+	subject := "bitcoin/" + rule.Currency
+	if rule.Basket != "" {
+		subject = "basket/" + rule.Basket
+	}
+	if a.Stablecoin != "" {
+		subject = "stablecoin/" + a.Stablecoin
+	}
+	sendNotifications(a)
+	publishEvent(repo, newEvent(EventAlertTriggered, subject, newAlertPayload(a)))
+	incCounter("tracker_alerts_fired_total", map[string]string{"kind": rule.Kind}, 1)
+
+	alertEngine.mu.Lock()
+	alertEngine.lastFired = a.Time
+	alertEngine.mu.Unlock()
+}
+
+// setError records the most recent evaluation error
+func (e *alertEngineState) setError(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastError = err.Error()
+}
+
+// collectAlertStatus summarizes the stored rules, engine state, and notifier health
+func collectAlertStatus(repo *Repository) AlertStatus {
+	alertEngine.mu.Lock()
+	status := AlertStatus{
+		LastEvaluation: alertEngine.lastEvaluation,
+		LastFired:      alertEngine.lastFired,
+		LastError:      alertEngine.lastError,
+	}
+	alertEngine.mu.Unlock()
+
+	if rules, err := repo.AlertRules(allTenants); err == nil {
+		status.Rules = len(rules)
+		for _, r := range rules {
+			if r.Triggered {
+				status.Triggered++
+			}
+		}
+	}
+	status.Notifiers = notifierStatuses()
+	return status
+}
+
+// parseRegime validates an optional volatility regime argument
+func parseRegime(s string) (string, error) {
+	switch s {
+	case RegimeLow, RegimeNormal, RegimeHigh:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid regime %q (expected %s, %s, or %s)", s, RegimeLow, RegimeNormal, RegimeHigh)
+}
+
+// runAlertCommand handles the "alerts" CLI command
+//
+//	alerts add [--channels email,telegram] [--cooldown 30m] above|below <price> [currency] [regime]
+//	alerts add [--channels email,telegram] [--cooldown 30m] change|accel <percent> <window> [currency] [regime]
+//	alerts add [--channels email,telegram] [--cooldown 30m] pattern <min-confidence> <pattern|any> [currency] [regime]
+//	alerts add [--channels email,telegram] [--cooldown 30m] level <percent> [currency] [regime]
+//	alerts add [--channels email,telegram] [--cooldown 30m] [--resolution 1h|1d] indicator <condition|golden|death> [currency] [regime]
+//	alerts add [--channels email,telegram] [--cooldown 30m] portfolio <[asset|#holding:]value|gain|gain_pct>|<threshold> [currency] [regime]
+//	alerts list
+//	alerts stats
+//	alerts delete <id>
+//	alerts snooze <id> <duration> | alerts unsnooze <id>
+//	alerts disable <id> | alerts enable <id>
+func runAlertCommand(repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: alerts add|list|stats|delete|snooze|unsnooze|disable|enable")
+	}
+
+	switch args[0] {
+	case "add":
+		// Options come before the rule, e.g. "alerts add --channels telegram above 50000"
+		fs := newFlagSet("alerts add")
+		channels := fs.String("channels", "", "Comma-separated notifier channels (default: all)")
+		cooldown := fs.Duration("cooldown", 0, "Minimum time between notifications (default: ALERT_COOLDOWN)")
+		resolution := fs.String("resolution", CandleDaily, "Candle resolution of indicator rules (1h or 1d)")
+		basket := fs.String("basket", "", "Basket of BASKETS whose value an above, below, or change rule watches")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		args = append(args[:1], fs.Args()...)
+
+		if len(args) < 3 {
+			return validationErrorf("usage: alerts add [options] above|below <price> [currency] [regime] | alerts add [options] change|accel <percent> <window> [currency] [regime] | alerts add [options] pattern <min-confidence> <pattern|any> [currency] [regime] | alerts add [options] level <percent> [currency] [regime] | alerts add [options] indicator <condition|golden|death> [currency] [regime] | alerts add [options] portfolio <condition> [currency] [regime] | alerts add [options] latency <duration> [currency] [regime]")
+		}
+
+		rule := AlertRule{Kind: args[1], Currency: "usd", Cooldown: *cooldown}
+		if *channels != "" {
+			for _, c := range strings.Split(*channels, ",") {
+				c = strings.ToLower(strings.TrimSpace(c))
+				if !isNotifierChannel(c) {
+					return fmt.Errorf("unknown notifier channel %q (expected one of %s)", c, strings.Join(notifierChannels, ", "))
+				}
+				rule.Channels = append(rule.Channels, c)
+			}
+		}
+		rest := args[3:]
+		var err error
+		if rule.Kind == AlertIndicator {
+			// Indicator rules take a condition instead of a threshold
+			res, err := parseCandleResolution(*resolution)
+			if err != nil {
+				return err
+			}
+			c, err := parseIndicatorCondition(args[2], res)
+			if err != nil {
+				return err
+			}
+			rule.Indicator = c.String()
+			for _, operand := range []string{c.Left, c.Right} {
+				if indicatorNamePattern.MatchString(operand) && !slices.Contains(indicatorConfig.names(), operand) {
+					slog.Warn("Indicator is not configured; the rule can't fire until it is", "indicator", operand)
+				}
+			}
+		} else if rule.Kind == AlertPortfolio {
+			// Portfolio rules take a condition on a metric and default to the valuation currency
+			c, err := parsePortfolioCondition(args[2])
+			if err != nil {
+				return err
+			}
+			rule.Portfolio, rule.Threshold, rule.Currency = c.String(), c.Threshold, portfolioConfig.Currency
+		} else if rule.Kind == AlertLatency {
+			// Latency rules take a duration, or plain seconds
+			d, err := time.ParseDuration(args[2])
+			if err != nil {
+				secs, perr := strconv.ParseFloat(args[2], 64)
+				d, err = time.Duration(secs*float64(time.Second)), perr
+			}
+			if err != nil || d <= 0 {
+				return validationErrorf("invalid latency %q (expected a duration such as 30s)", args[2])
+			}
+			rule.Threshold = d.Seconds()
+		} else {
+			threshold, err := strconv.ParseFloat(strings.TrimSuffix(strings.ReplaceAll(args[2], ",", ""), "%"), 64)
+			if err != nil || threshold <= 0 {
+				return fmt.Errorf("invalid threshold %q", args[2])
+			}
+			rule.Threshold = threshold
+		}
+
+		switch rule.Kind {
+		case AlertIndicator, AlertPortfolio:
+		case AlertAbove, AlertBelow, AlertLevel, AlertLatency:
+		case AlertChange, AlertAccel:
+			if len(rest) == 0 {
+				return validationErrorf("usage: alerts add %s <percent> <window> [currency] [regime]", rule.Kind)
+			}
+			if rule.Window, err = time.ParseDuration(rest[0]); err != nil || rule.Window <= 0 {
+				return fmt.Errorf("invalid window %q", rest[0])
+			}
+			if rule.Kind == AlertAccel {
+				if rule.Window > maxAccelWindow {
+					return fmt.Errorf("accel window %s exceeds the maximum of %s", rule.Window, maxAccelWindow)
+				}
+				// Each window needs at least one sample for the comparison to mean anything
+				if rule.Window < fetchInterval {
+					slog.Warn("Window is shorter than the fetch interval; the rule needs a sample in every window to fire", "window", rule.Window, "fetch_interval", fetchInterval)
+				}
+			}
+			rest = rest[1:]
+		case AlertPattern:
+			if rule.Threshold > 1 {
+				return fmt.Errorf("invalid confidence %q (expected 0-1)", args[2])
+			}
+			if len(rest) == 0 {
+				return validationErrorf("usage: alerts add pattern <min-confidence> <pattern|any> [currency] [regime]")
+			}
+			if rest[0] != "any" {
+				if !isCandlePattern(rest[0]) {
+					return fmt.Errorf("unknown pattern %q (expected any or one of %s)", rest[0], strings.Join(candlePatterns, ", "))
+				}
+				rule.Pattern = rest[0]
+			}
+			rest = rest[1:]
+		default:
+			return fmt.Errorf("unknown alert kind %q (expected %s, %s, %s, %s, %s, %s, %s, %s, or %s)", rule.Kind, AlertAbove, AlertBelow, AlertChange, AlertAccel, AlertPattern, AlertLevel, AlertIndicator, AlertPortfolio, AlertLatency)
+		}
+
+		if *basket != "" {
+			// Basket rules watch a basket's value in BASKET_CURRENCY
+			b, err := basketConfig.lookup(*basket)
+			if err != nil {
+				return err
+			}
+			if rule.Kind != AlertAbove && rule.Kind != AlertBelow && rule.Kind != AlertChange {
+				return validationErrorf("basket rules must be above, below, or change rules")
+			}
+			if len(rest) > 0 {
+				return validationErrorf("basket rules take no currency or regime; baskets are valued in BASKET_CURRENCY (%s)", strings.ToUpper(basketConfig.Currency))
+			}
+			rule.Basket, rule.Currency = b.Name, basketConfig.Currency
+		}
+		if len(rest) > 0 {
+			rule.Currency = strings.ToLower(rest[0])
+		}
+		if len(rest) > 1 {
+			if rule.Regime, err = parseRegime(rest[1]); err != nil {
+				return err
+			}
+		}
+
+		rule.Tenant = cliTenant
+		id, err := repo.SaveAlertRule(rule)
+		if err != nil {
+			return err
+		}
+		slog.Info("Added alert", "rule", id, "condition", rule.Condition(), "currency", rule.Currency)
+
+	case "list":
+		rules, err := repo.AlertRules(cliTenant)
+		if err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			slog.Info("No alert rules stored")
+			return nil
+		}
+
+		now := time.Now()
+		fmt.Printf("\n%-5s %-32s %-8s %-8s %-16s %-24s %-20s\n", "ID", "Condition", "Currency", "Regime", "Channels", "State", "Last triggered")
+		fmt.Println("-----------------------------------------------------------------------------------------------------------------------")
+		for _, r := range rules {
+			regime, channels, state, last := "any", "all", "armed", "never"
+			if r.Regime != "" {
+				regime = r.Regime
+			}
+			if len(r.Channels) > 0 {
+				channels = strings.Join(r.Channels, ",")
+			}
+			switch {
+			case r.Disabled:
+				state = "disabled"
+			case r.paused(now):
+				state = "snoozed to " + r.SnoozedUntil.In(displayLocation).Format("01-02 15:04")
+			case r.Triggered:
+				state = "triggered"
+			}
+			if r.LastTriggered != nil {
+				last = formatDisplayTime(*r.LastTriggered)
+			}
+			fmt.Printf("%-5d %-32s %-8s %-8s %-16s %-24s %-20s\n",
+				r.ID, r.Condition(), strings.ToUpper(r.Currency), regime, channels, state, last)
+		}
+		fmt.Println()
+
+	case "stats":
+		return displayAlertStats(repo)
+
+	case "delete":
+		if len(args) < 2 {
+			return validationErrorf("usage: alerts delete <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid alert id %q", args[1])
+		}
+		if err := repo.DeleteAlertRule(cliTenant, id); err != nil {
+			return err
+		}
+		slog.Info("Deleted alert", "rule", id)
+
+	case "snooze", "unsnooze", "disable", "enable":
+		usage := "usage: alerts " + args[0] + " <id>"
+		if args[0] == "snooze" {
+			usage = "usage: alerts snooze <id> <duration>"
+		}
+		if len(args) < 2 || (args[0] == "snooze" && len(args) < 3) {
+			return fmt.Errorf("%s", usage)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid alert id %q", args[1])
+		}
+		var d time.Duration
+		if args[0] == "snooze" {
+			if d, err = time.ParseDuration(args[2]); err != nil || d <= 0 {
+				return fmt.Errorf("invalid snooze duration %q", args[2])
+			}
+		}
+		rules, err := repo.AlertRules(cliTenant)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(rules, func(r AlertRule) bool { return r.ID == id }) {
+			return validationErrorf("no alert rule with id %d", id)
+		}
+		message, err := applyAlertAction(repo, id, args[0], d)
+		if err != nil {
+			return err
+		}
+		fmt.Println(message)
+
+	default:
+		return validationErrorf("unknown alerts command: %s", args[0])
+	}
+	return nil
+}
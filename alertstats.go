@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for rounding rates
+	"net/http" // Package for serving the statistics
+	"sort"     // Package for ordering rules by noise
+	"strconv"  // Package for metric labels
+	"strings"  // Package for string manipulation
+	"time"     // Package for timestamps and rates
+)
+
+// noisyAlertsPerDay is the notification rate from which a rule is flagged as noisy
+const noisyAlertsPerDay = 10
+
+// AlertRuleStats counts how often a rule was evaluated, triggered, and notified
+type AlertRuleStats struct {
+	RuleID              int        `json:"rule_id"`
+	Condition           string     `json:"condition,omitempty"` // Filled in from the rule when reporting
+	Currency            string     `json:"currency,omitempty"`
+	Evaluations         int64      `json:"evaluations"`   // Times the rule was checked against new data
+	Triggers            int64      `json:"triggers"`      // Times its condition started to hold (or a pattern matched)
+	Notifications       int64      `json:"notifications"` // Triggers that sent a notification
+	Suppressed          int64      `json:"suppressed"`    // Triggers silenced by the rule's cooldown
+	Errors              int64      `json:"errors"`        // Evaluations that failed
+	LastEvaluated       *time.Time `json:"last_evaluated,omitempty"`
+	LastTriggered       *time.Time `json:"last_triggered,omitempty"`
+	LastNotified        *time.Time `json:"last_notified,omitempty"`
+	Since               time.Time  `json:"since"`                 // When counting started
+	NotificationsPerDay float64    `json:"notifications_per_day"` // Average since counting started
+	TriggerRate         float64    `json:"trigger_rate"`          // Share of evaluations that triggered
+	Noisy               bool       `json:"noisy"`                 // At least noisyAlertsPerDay notifications a day
+}
+
+// alertStatsBatch collects the counts of one evaluation pass, so they are stored in a
+// single transaction rather than with a write per rule
+type alertStatsBatch map[int]*AlertRuleStats
+
+// ruleLabels returns the metric labels of a rule
+func ruleLabels(rule AlertRule) map[string]string {
+	return map[string]string{"rule": strconv.Itoa(rule.ID), "kind": rule.Kind}
+}
+
+// rule returns the batch entry for a rule, adding it on first use
+func (b alertStatsBatch) rule(rule AlertRule) *AlertRuleStats {
+	st, ok := b[rule.ID]
+	if !ok {
+		st = &AlertRuleStats{RuleID: rule.ID}
+		b[rule.ID] = st
+	}
+	return st
+}
+
+// evaluated counts a check of a rule, and a failure when err is set
+func (b alertStatsBatch) evaluated(rule AlertRule, now time.Time, err error) {
+	st := b.rule(rule)
+	st.Evaluations++
+	st.LastEvaluated = &now
+	incCounter("tracker_alert_rule_evaluations_total", ruleLabels(rule), 1)
+	if err != nil {
+		st.Errors++
+		incCounter("tracker_alert_rule_errors_total", ruleLabels(rule), 1)
+	}
+}
+
+// triggered counts a rule's condition starting to hold, either notifying or
+// suppressed by the rule's cooldown
+func (b alertStatsBatch) triggered(rule AlertRule, now time.Time, notified bool) {
+	st := b.rule(rule)
+	st.Triggers++
+	st.LastTriggered = &now
+	incCounter("tracker_alert_rule_triggers_total", ruleLabels(rule), 1)
+	if notified {
+		st.Notifications++
+		st.LastNotified = &now
+		incCounter("tracker_alert_rule_notifications_total", ruleLabels(rule), 1)
+		setGauge("tracker_alert_rule_last_notified_timestamp_seconds", ruleLabels(rule), float64(now.Unix()))
+	} else {
+		st.Suppressed++
+		incCounter("tracker_alerts_suppressed_total", map[string]string{"kind": rule.Kind}, 1)
+	}
+}
+
+// save stores the batch, logging a failure instead of returning it; statistics
+// never hold up alerting
+func (b alertStatsBatch) save(repo *Repository) {
+	if len(b) == 0 {
+		return
+	}
+	stats := make([]AlertRuleStats, 0, len(b))
+	for _, st := range b {
+		stats = append(stats, *st)
+	}
+	if err := repo.RecordAlertStats(stats); err != nil {
+		slog.Warn("Failed to store alert statistics", "error", err)
+	}
+}
+
+// alertStatsReport returns the statistics of every rule of a tenant, noisiest first
+// Rules that were never evaluated are included with zero counts
+func alertStatsReport(repo *Repository, tenant string, now time.Time) ([]AlertRuleStats, error) {
+	rules, err := repo.AlertRules(tenant)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := repo.AlertStats()
+	if err != nil {
+		return nil, err
+	}
+	byRule := make(map[int]AlertRuleStats, len(stored))
+	for _, st := range stored {
+		byRule[st.RuleID] = st
+	}
+
+	report := make([]AlertRuleStats, 0, len(rules))
+	for _, r := range rules {
+		st, ok := byRule[r.ID]
+		if !ok {
+			st = AlertRuleStats{RuleID: r.ID, Since: r.CreatedAt}
+		}
+		st.Condition, st.Currency = r.Condition(), r.Currency
+		// Rates cover at least a day, so a new rule's first notification isn't a storm
+		days := math.Max(now.Sub(st.Since).Hours()/24, 1)
+		st.NotificationsPerDay = math.Round(float64(st.Notifications)/days*100) / 100
+		if st.Evaluations > 0 {
+			st.TriggerRate = math.Round(float64(st.Triggers)/float64(st.Evaluations)*10000) / 10000
+		}
+		st.Noisy = st.NotificationsPerDay >= noisyAlertsPerDay
+		report = append(report, st)
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		if report[i].NotificationsPerDay != report[j].NotificationsPerDay {
+			return report[i].NotificationsPerDay > report[j].NotificationsPerDay
+		}
+		return report[i].Triggers > report[j].Triggers
+	})
+	return report, nil
+}
+
+// displayAlertStats prints the statistics of every rule of the CLI's tenant, noisiest first
+func displayAlertStats(repo *Repository) error {
+	report, err := alertStatsReport(repo, cliTenant, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(report) == 0 {
+		slog.Info("No alert rules stored")
+		return nil
+	}
+
+	fmt.Printf("\n%-5s %-32s %-8s %-11s %-9s %-9s %-10s %-7s %-8s %-20s\n",
+		"ID", "Condition", "Currency", "Evaluations", "Triggers", "Notified", "Suppressed", "Errors", "Per day", "Last notified")
+	fmt.Println("-----------------------------------------------------------------------------------------------------------------------------------")
+	for _, st := range report {
+		last := "never"
+		if st.LastNotified != nil {
+			last = formatDisplayTime(*st.LastNotified)
+		}
+		perDay := strconv.FormatFloat(st.NotificationsPerDay, 'f', 2, 64)
+		if st.Noisy {
+			perDay += " !"
+		}
+		fmt.Printf("%-5d %-32s %-8s %-11d %-9d %-9d %-10d %-7d %-8s %-20s\n", st.RuleID, st.Condition,
+			strings.ToUpper(st.Currency), st.Evaluations, st.Triggers, st.Notifications, st.Suppressed, st.Errors, perDay, last)
+	}
+	fmt.Printf("\n! = %d or more notifications a day; raise the threshold or cooldown, or snooze the rule\n\n", noisyAlertsPerDay)
+	return nil
+}
+
+// handleAlertStats serves GET /alerts/stats
+// It returns the statistics of every rule of the request's tenant, noisiest first
+func (s *apiServer) handleAlertStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	report, err := alertStatsReport(s.repo, requestTenant(r), time.Now())
+	if err != nil {
+		slog.Error("API failed to fetch alert statistics", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query alert statistics")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"  // Package for bounding analytical queries
+	"errors"   // Package for recognizing timed-out queries
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"net/http" // Package for the error responses
+	"os"       // Package for environment variables
+	"strconv"  // Package for parsing the point cap
+	"time"     // Package for ranges and timeouts
+)
+
+// AnalyticsConfig caps what a single stats or candles request may ask the database for,
+// so one unbounded request can't tie up the process or run it out of memory
+type AnalyticsConfig struct {
+	MaxRange  time.Duration // Longest from..to span accepted
+	MaxPoints int           // Most candles a from..to span may cover at the requested resolution
+	Timeout   time.Duration // Longest a query may run before the request fails; 0 means no limit
+}
+
+// analyticsConfig is the active configuration, loaded at startup
+var analyticsConfig = AnalyticsConfig{MaxRange: 730 * 24 * time.Hour, MaxPoints: maxRangeLimit, Timeout: 10 * time.Second}
+
+// loadAnalyticsConfig reads ANALYTICS_MAX_RANGE (e.g. 730d), ANALYTICS_MAX_POINTS, and
+// ANALYTICS_TIMEOUT (e.g. 10s, 0 to disable)
+func loadAnalyticsConfig() (AnalyticsConfig, error) {
+	c := AnalyticsConfig{MaxRange: 730 * 24 * time.Hour, MaxPoints: maxRangeLimit, Timeout: 10 * time.Second}
+	if v := os.Getenv("ANALYTICS_MAX_RANGE"); v != "" {
+		d, err := parseStatsWindow(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid ANALYTICS_MAX_RANGE %q (expected e.g. 90d or 730d)", v)
+		}
+		c.MaxRange = d
+	}
+	if v := os.Getenv("ANALYTICS_MAX_POINTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c, fmt.Errorf("invalid ANALYTICS_MAX_POINTS %q (expected a positive number)", v)
+		}
+		c.MaxPoints = n
+	}
+	if v := os.Getenv("ANALYTICS_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return c, fmt.Errorf("invalid ANALYTICS_TIMEOUT %q (expected a duration, e.g. 10s)", v)
+		}
+		c.Timeout = d
+	}
+	return c, nil
+}
+
+// checkAnalyticsRange rejects a from..to span longer than the configured maximum or, when
+// resolution is set, one covering more candles than the point cap
+func checkAnalyticsRange(from, to time.Time, resolution string) error {
+	cfg := analyticsConfig
+	span := to.Sub(from)
+	if span > cfg.MaxRange {
+		return validationErrorf("range of %s exceeds the maximum of %s; narrow from/to",
+			formatAnalyticsSpan(span), formatAnalyticsSpan(cfg.MaxRange))
+	}
+	if resolution == "" {
+		return nil
+	}
+	if points := int64(span / candleDuration(resolution)); points > int64(cfg.MaxPoints) {
+		hint := "narrow from/to"
+		if resolution != CandleDaily {
+			hint = "use resolution=" + CandleDaily + " or narrow from/to"
+		}
+		return validationErrorf("range covers %d %s candles, more than the maximum of %d; %s",
+			points, resolution, cfg.MaxPoints, hint)
+	}
+	return nil
+}
+
+// formatAnalyticsSpan formats a span in days once it is a day or longer
+func formatAnalyticsSpan(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%.0fd", d.Hours()/24)
+	}
+	return d.Round(time.Second).String()
+}
+
+// withAnalyticsTimeout derives the context of an analytical query from ctx
+func withAnalyticsTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if analyticsConfig.Timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, analyticsConfig.Timeout)
+}
+
+// writeAnalyticsError answers a failed analytical query; one that ran out of time is a
+// 503 that says how to get an answer rather than a generic storage failure
+func writeAnalyticsError(w http.ResponseWriter, r *http.Request, what string, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("API query timed out", "path", r.URL.Path, "query", what, "timeout", analyticsConfig.Timeout)
+		writeAPIProblem(w, http.StatusServiceUnavailable, KindStorage,
+			fmt.Sprintf("%s took longer than %s; narrow from/to", what, analyticsConfig.Timeout))
+		return
+	}
+	slog.Error("API failed to query "+what, "path", r.URL.Path, "error", err)
+	writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query "+what)
+}
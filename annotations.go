@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"       // Package for the commands' database calls
+	"encoding/json" // Package for the API bodies
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for limiting request bodies
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for the /annotations endpoints
+	"slices"        // Package for filtering by tag
+	"strconv"       // Package for parsing IDs
+	"strings"       // Package for string manipulation
+	"time"          // Package for timestamps
+)
+
+// Annotations label points in time: "halving", "ETF approval", "I bought here". They
+// are drawn as markers on charts, served to Grafana by the "annotations" annotation
+// query, and carried into exports as an annotation column on the first record of each
+// currency at or after them. They are managed with the annotations command and under
+// /annotations.
+
+// maxAnnotationText is the longest annotation text accepted, in characters
+const maxAnnotationText = 200
+
+// Annotation is a label attached to a point in time
+type Annotation struct {
+	ID        int       `json:"id"`
+	Time      time.Time `json:"time"`
+	Text      string    `json:"text"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// hasTag reports whether the annotation carries tag; every annotation has the empty tag
+func (a Annotation) hasTag(tag string) bool {
+	return tag == "" || slices.Contains(a.Tags, tag)
+}
+
+// annotationRequest is the body of POST /annotations
+type annotationRequest struct {
+	Time time.Time `json:"time,omitempty"` // Now when omitted
+	Text string    `json:"text"`
+	Tags []string  `json:"tags,omitempty"`
+}
+
+// annotation validates the request and returns the annotation it adds
+func (req annotationRequest) annotation(now time.Time) (Annotation, error) {
+	a := Annotation{Time: req.Time.UTC(), Text: strings.TrimSpace(req.Text), CreatedAt: now.UTC()}
+	if req.Time.IsZero() {
+		a.Time = a.CreatedAt
+	}
+	if a.Text == "" {
+		return a, validationErrorf("annotation text is required")
+	}
+	if n := len([]rune(a.Text)); n > maxAnnotationText {
+		return a, validationErrorf("annotation text is %d characters long (at most %d)", n, maxAnnotationText)
+	}
+	for _, tag := range req.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(a.Tags, tag) {
+			continue
+		}
+		if strings.ContainsAny(tag, ", \t\n") {
+			return a, validationErrorf("invalid tag %q (tags can't contain commas or spaces)", tag)
+		}
+		a.Tags = append(a.Tags, tag)
+	}
+	return a, nil
+}
+
+// taggedAnnotations returns the annotations in [from, to) carrying tag, oldest first
+// An empty tag matches every annotation, and a zero to leaves the range open.
+func taggedAnnotations(ctx context.Context, repo *Repository, from, to time.Time, tag string) ([]Annotation, error) {
+	annotations, err := repo.Annotations(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	return slices.DeleteFunc(annotations, func(a Annotation) bool { return !a.hasTag(tag) }), nil
+}
+
+// annotationLabels attaches annotations to exported records, which come oldest first:
+// each annotation labels the first record of every currency stamped at or after it
+type annotationLabels struct {
+	annotations []Annotation
+	next        map[string]int // Index of the first annotation not yet attached, per currency
+}
+
+// loadAnnotationLabels reads the annotations of an export of [from, to)
+func loadAnnotationLabels(repo *Repository, from, to time.Time) (*annotationLabels, error) {
+	annotations, err := repo.Annotations(context.Background(), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load annotations: %w", err)
+	}
+	return &annotationLabels{annotations: annotations, next: make(map[string]int)}, nil
+}
+
+// any reports whether the export has annotations, and so an annotation column
+func (l *annotationLabels) any() bool {
+	return len(l.annotations) > 0
+}
+
+// label returns the texts of the annotations r is the first record after, joined by "; "
+func (l *annotationLabels) label(r PriceRecord) string {
+	i := l.next[r.Currency]
+	var texts []string
+	for ; i < len(l.annotations) && !l.annotations[i].Time.After(r.Timestamp); i++ {
+		texts = append(texts, l.annotations[i].Text)
+	}
+	l.next[r.Currency] = i
+	return strings.Join(texts, "; ")
+}
+
+// runAnnotationCommand runs "annotations add|list|remove"
+func runAnnotationCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: annotations add|list|remove ...")
+	}
+
+	switch args[0] {
+	case "add":
+		// Options come before the text, e.g. "annotations add --time 2024-04-20 --tags halving Halving"
+		fs := newFlagSet("annotations add")
+		at := fs.String("time", "now", "Point in time to annotate: now, YYYY-MM-DD, or RFC 3339")
+		tags := fs.String("tags", "", "Comma-separated tags, e.g. halving,event")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if fs.NArg() == 0 {
+			return validationErrorf("usage: annotations add [--time now|YYYY-MM-DD|RFC 3339] [--tags a,b] <text>")
+		}
+		t, err := parseTimeFlag("time", *at)
+		if err != nil {
+			return err
+		}
+		req := annotationRequest{Time: t, Text: strings.Join(fs.Args(), " ")}
+		if *tags != "" {
+			req.Tags = strings.Split(*tags, ",")
+		}
+		a, err := req.annotation(time.Now())
+		if err != nil {
+			return err
+		}
+		id, err := repo.SaveAnnotation(ctx, a)
+		if err != nil {
+			return err
+		}
+		slog.Info("Added annotation", "id", id, "time", a.Time.Format(time.RFC3339), "text", a.Text)
+
+	case "list":
+		fs := newFlagSet("annotations list")
+		fromFlag := fs.String("from", "", "Start of the range: YYYY-MM-DD or RFC 3339 (default: the first annotation)")
+		toFlag := fs.String("to", "now", "End of the range: now, YYYY-MM-DD, or RFC 3339")
+		tag := fs.String("tag", "", "Only show annotations with this tag")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		var from, to time.Time
+		var err error
+		if *fromFlag != "" {
+			if from, err = parseTimeFlag("from", *fromFlag); err != nil {
+				return err
+			}
+		}
+		// "now" leaves the range open so annotations of future events are listed too
+		if !strings.EqualFold(*toFlag, "now") {
+			if to, err = parseTimeFlag("to", *toFlag); err != nil {
+				return err
+			}
+		}
+		annotations, err := taggedAnnotations(ctx, repo, from, to, *tag)
+		if err != nil {
+			return err
+		}
+		displayAnnotations(annotations)
+
+	case "remove":
+		if len(args) < 2 {
+			return validationErrorf("usage: annotations remove <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return validationErrorf("invalid annotation id %q", args[1])
+		}
+		if err := repo.DeleteAnnotation(ctx, id); err != nil {
+			return err
+		}
+		slog.Info("Removed annotation", "id", id)
+
+	default:
+		return validationErrorf("unknown annotations command: %s", args[0])
+	}
+	return nil
+}
+
+// displayAnnotations prints annotations as a table
+func displayAnnotations(annotations []Annotation) {
+	if len(annotations) == 0 {
+		slog.Info("No annotations found")
+		return
+	}
+
+	fmt.Printf("\n%-5s %-20s %-20s %s\n", "ID", "Time", "Tags", "Text")
+	fmt.Println("--------------------------------------------------------------------------------")
+	for _, a := range annotations {
+		tags := strings.Join(a.Tags, ",")
+		if tags == "" {
+			tags = "-"
+		}
+		fmt.Printf("%-5d %-20s %-20s %s\n", a.ID, formatDisplayTime(a.Time), tags, a.Text)
+	}
+	fmt.Println()
+}
+
+// handleAnnotations serves GET /annotations?from=...&to=...&tag=..., POST /annotations,
+// and DELETE /annotations/<id>
+func (s *apiServer) handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/annotations"), "/")
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			s.handleListAnnotations(w, r)
+		case http.MethodPost:
+			s.handleCreateAnnotation(w, r)
+		default:
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(rest)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	err = s.repo.DeleteAnnotation(r.Context(), id)
+	if errorKind(err) == KindValidation {
+		writeAPIError(w, http.StatusNotFound, "no annotation with id %d", id)
+		return
+	}
+	if err != nil {
+		slog.Error("API failed to delete annotation", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to delete annotation")
+		return
+	}
+	slog.Info("Removed annotation", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListAnnotations serves GET /annotations; the range is open at both ends by default
+func (s *apiServer) handleListAnnotations(w http.ResponseWriter, r *http.Request) {
+	from, to, err := requestWindow(r, "")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	annotations, err := taggedAnnotations(r.Context(), s.repo, from, to, r.URL.Query().Get("tag"))
+	if err != nil {
+		slog.Error("API failed to fetch annotations", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query annotations")
+		return
+	}
+	if annotations == nil {
+		annotations = []Annotation{} // Encode no annotations as [] rather than null
+	}
+	writeJSON(w, http.StatusOK, annotations)
+}
+
+// handleCreateAnnotation serves POST /annotations
+func (s *apiServer) handleCreateAnnotation(w http.ResponseWriter, r *http.Request) {
+	var req annotationRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<12)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid annotation: %v", err)
+		return
+	}
+	a, err := req.annotation(time.Now().Truncate(time.Second))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if a.ID, err = s.repo.SaveAnnotation(r.Context(), a); err != nil {
+		slog.Error("API failed to save annotation", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to save annotation")
+		return
+	}
+
+	slog.Info("Added annotation", "id", a.ID, "time", a.Time.Format(time.RFC3339), "text", a.Text)
+	w.Header().Set("Location", fmt.Sprintf("/annotations/%d", a.ID))
+	writeJSON(w, http.StatusCreated, a)
+}
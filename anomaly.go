@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"  // Package for releasing quarantined prices
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for absolute deviations
+	"net/http" // Package for the anomalies endpoint
+	"os"       // Package for environment variables
+	"slices"   // Package for the median of recent prices
+	"strconv"  // Package for parsing numbers
+	"strings"  // Package for parsing ANOMALY_ACTION
+	"time"     // Package for the comparison window
+)
+
+// Actions taken on a price that deviates too far, stored with each anomaly
+const (
+	anomalyQuarantined = "quarantined" // Kept out of bitcoin_prices until released
+	anomalyFlagged     = "flagged"     // Stored anyway, and recorded for review
+)
+
+// anomalyMinSamples is the fewest recent prices a new one is compared with
+// With fewer, e.g. right after the first start or a long outage, every price is accepted.
+const anomalyMinSamples = 5
+
+// EventPriceAnomaly is emitted when a fetched price deviates too far from recent history
+const EventPriceAnomaly = "price.anomaly"
+
+// AnomalyConfig controls the sanity filter on fetched prices
+type AnomalyConfig struct {
+	MaxDeviation float64       // Largest accepted percent difference from the recent median; 0 disables the filter
+	Window       time.Duration // Stored prices the median is taken over
+	Action       string        // anomalyQuarantined or anomalyFlagged
+}
+
+// anomalyConfig is the active configuration, loaded at startup
+var anomalyConfig = AnomalyConfig{Window: time.Hour, Action: anomalyQuarantined}
+
+// loadAnomalyConfig reads ANOMALY_MAX_DEVIATION (percent), ANOMALY_WINDOW (e.g. 1h),
+// and ANOMALY_ACTION (quarantine or flag)
+func loadAnomalyConfig() (AnomalyConfig, error) {
+	c := AnomalyConfig{Window: time.Hour, Action: anomalyQuarantined}
+	if v := os.Getenv("ANOMALY_MAX_DEVIATION"); v != "" {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if err != nil || pct < 0 {
+			return c, fmt.Errorf("invalid ANOMALY_MAX_DEVIATION %q (expected a percentage, e.g. 10)", v)
+		}
+		c.MaxDeviation = pct
+	}
+	if v := os.Getenv("ANOMALY_WINDOW"); v != "" {
+		d, err := parseStatsWindow(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid ANOMALY_WINDOW %q", v)
+		}
+		c.Window = d
+	}
+	switch v := strings.ToLower(os.Getenv("ANOMALY_ACTION")); v {
+	case "", "quarantine":
+	case "flag":
+		c.Action = anomalyFlagged
+	default:
+		return c, fmt.Errorf("invalid ANOMALY_ACTION %q (expected quarantine or flag)", v)
+	}
+	return c, nil
+}
+
+// PriceAnomaly is a fetched price that deviated too far from recent history
+type PriceAnomaly struct {
+	ID         int        `json:"id"`
+	Currency   string     `json:"currency"`
+	Price      float64    `json:"price"`
+	Source     string     `json:"source"`
+	Baseline   float64    `json:"baseline"`  // Median of the recent prices it was compared with
+	Deviation  float64    `json:"deviation"` // Percent difference from Baseline
+	Action     string     `json:"action"`    // quarantined or flagged
+	DetectedAt time.Time  `json:"detected_at"`
+	ReleasedAt *time.Time `json:"released_at,omitempty"` // When a quarantined price was stored after all
+}
+
+// anomalyBaseline returns the median of the prices stored for currency in the window
+// before now; ok is false when there are too few to judge a new price by
+func anomalyBaseline(repo *Repository, currency string, now time.Time) (float64, bool, error) {
+	recent, err := repo.PriceRange(currency, now.Add(-anomalyConfig.Window), now, maxRangeLimit)
+	if err != nil || len(recent) < anomalyMinSamples {
+		return 0, false, err
+	}
+	prices := make([]float64, len(recent))
+	for i, r := range recent {
+		prices[i] = r.Price
+	}
+	slices.Sort(prices)
+	mid := len(prices) / 2
+	if len(prices)%2 == 0 {
+		return (prices[mid-1] + prices[mid]) / 2, true, nil
+	}
+	return prices[mid], true, nil
+}
+
+// screenPrices compares freshly fetched prices with the recent median of their
+// currency and records each one that deviates by more than ANOMALY_MAX_DEVIATION. It
+// returns the prices to store: quarantined ones are left out. The filter fails open:
+// a price is stored when the recent history can't be read.
+func screenPrices(repo *Repository, prices map[string]float64, source string) map[string]float64 {
+	if anomalyConfig.MaxDeviation == 0 {
+		return prices
+	}
+
+	now := time.Now().UTC()
+	accepted := make(map[string]float64, len(prices))
+	for currency, price := range prices {
+		baseline, ok, err := anomalyBaseline(repo, currency, now)
+		if err != nil {
+			slog.Error("Failed to read recent prices for the anomaly check", "currency", currency, "error", err)
+		}
+		if !ok || baseline == 0 {
+			accepted[currency] = price
+			continue
+		}
+		deviation := (price - baseline) / baseline * 100
+		if math.Abs(deviation) <= anomalyConfig.MaxDeviation {
+			accepted[currency] = price
+			continue
+		}
+
+		a := PriceAnomaly{Currency: currency, Price: price, Source: source, Baseline: baseline,
+			Deviation: deviation, Action: anomalyConfig.Action, DetectedAt: now}
+		if a.Action == anomalyFlagged {
+			accepted[currency] = price
+		}
+		if a.ID, err = repo.SaveAnomaly(a); err != nil {
+			slog.Error("Failed to record price anomaly", "currency", currency, "error", err)
+		}
+		slog.Warn("Price deviates from recent history", "coin", "bitcoin", "currency", currency, "price", price,
+			"source", source, "median", baseline, "deviation_pct", math.Round(deviation*100)/100, "action", a.Action, "id", a.ID)
+		incCounter("tracker_price_anomalies_total", map[string]string{"currency": currency, "action": a.Action}, 1)
+		publishEvent(repo, newEvent(EventPriceAnomaly, "bitcoin/"+currency, a))
+	}
+	return accepted
+}
+
+// releaseAnomaly stores a quarantined price after all, at the time it was fetched
+func releaseAnomaly(ctx context.Context, repo *Repository, id int) error {
+	a, ok, err := repo.Anomaly(id)
+	if err != nil {
+		return err
+	}
+	if !ok || a.Action != anomalyQuarantined || a.ReleasedAt != nil {
+		return fmt.Errorf("no quarantined price anomaly with id %d", id)
+	}
+
+	record := PriceRecord{Price: a.Price, Currency: a.Currency, Source: a.Source, Timestamp: a.DetectedAt}
+	inserted, err := repo.SaveHistoricalPrices(ctx, []PriceRecord{record})
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return fmt.Errorf("a %s price is already stored for %s", a.Currency, a.DetectedAt.Format("2006-01-02 15:04"))
+	}
+	if err := repo.ReleaseAnomaly(id); err != nil {
+		return err
+	}
+	refreshCandles(ctx, repo) // Fold the price into candles that were rolled up without it
+	return nil
+}
+
+// handleAnomalies serves GET /anomalies?limit=..., the newest price anomalies first
+func (s *apiServer) handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	limit := defaultRangeLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxRangeLimit {
+			writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and %d", maxRangeLimit)
+			return
+		}
+	}
+
+	anomalies, err := s.repo.Anomalies(limit)
+	if err != nil {
+		slog.Error("API failed to fetch price anomalies", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query price anomalies")
+		return
+	}
+	if anomalies == nil {
+		anomalies = []PriceAnomaly{} // Encode no anomalies as [] rather than null
+	}
+	writeJSON(w, http.StatusOK, anomalies)
+}
+
+// runAnomaliesCommand handles "anomalies list [--limit N]" and "anomalies release <id>"
+func runAnomaliesCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: anomalies list|release")
+	}
+
+	switch args[0] {
+	case "list":
+		fs := newFlagSet("anomalies list")
+		limit := fs.Int("limit", 50, "Number of anomalies to show, newest first")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if *limit < 1 {
+			return validationErrorf("invalid --limit %d", *limit)
+		}
+		anomalies, err := repo.Anomalies(*limit)
+		if err != nil {
+			return err
+		}
+		if len(anomalies) == 0 {
+			slog.Info("No price anomalies recorded")
+			return nil
+		}
+
+		fmt.Printf("\n%-5s %-20s %-8s %-14s %-14s %-10s %-12s %-12s\n", "ID", "Detected", "Currency", "Price", "Median", "Deviation", "Source", "Status")
+		fmt.Println("---------------------------------------------------------------------------------------------------")
+		for _, a := range anomalies {
+			status := a.Action
+			if a.ReleasedAt != nil {
+				status = "released"
+			}
+			fmt.Printf("%-5d %-20s %-8s %-14.2f %-14.2f %+9.2f%% %-12s %-12s\n", a.ID, formatDisplayTime(a.DetectedAt),
+				strings.ToUpper(a.Currency), a.Price, a.Baseline, a.Deviation, a.Source, status)
+		}
+		fmt.Println()
+
+	case "release":
+		if len(args) < 2 {
+			return validationErrorf("usage: anomalies release <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid anomaly id %q", args[1])
+		}
+		if err := releaseAnomaly(ctx, repo, id); err != nil {
+			return err
+		}
+		slog.Info("Released quarantined price", "id", id)
+
+	default:
+		return validationErrorf("unknown anomalies subcommand %q", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"       // Package for graceful server shutdown
+	"encoding/json" // Package for JSON responses
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for the HTTP API
+	"os"            // Package for environment variables
+	"reflect"       // Package for moving response times into the requested zone
+	"strconv"       // Package for parsing query parameters
+	"strings"       // Package for string manipulation
+	"time"          // Package for range boundaries
+)
+
+// defaultAPIAddr is where `serve` listens when API_ADDR is not set
+const defaultAPIAddr = ":8080"
+
+// Range query limits for GET /prices and GET /candles
+const (
+	defaultRangeLimit = 1000  // Records returned when ?limit is omitted
+	maxRangeLimit     = 10000 // Largest ?limit accepted
+)
+
+// apiError is the body of every failed API response: RFC 7807 problem details
+// Error repeats Detail for clients written before problem details.
+type apiError struct {
+	Type   string    `json:"type"`           // urn:bitcoin-tracker:error:<kind>, or about:blank
+	Title  string    `json:"title"`          // Summary of the kind, or the status text
+	Status int       `json:"status"`         // HTTP status code
+	Detail string    `json:"detail"`         // What went wrong with this request
+	Kind   ErrorKind `json:"kind,omitempty"` // See errors.go
+	Error  string    `json:"error"`
+}
+
+// writeJSON writes v as a JSON response with the given status code
+// Times are in the zone a request asked for with ?tz (see withResponseZone).
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	if zw, ok := w.(*zonedResponseWriter); ok && v != nil {
+		v = inZone(reflect.ValueOf(v), zw.loc).Interface()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes a problem details response, of the kind the status implies
+func writeAPIError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeAPIProblem(w, status, statusErrorKind(status), format, args...)
+}
+
+// writeAPIProblem writes a problem details response of a kind
+func writeAPIProblem(w http.ResponseWriter, status int, kind ErrorKind, format string, args ...interface{}) {
+	title, ok := errorKindTitles[kind]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	detail := fmt.Sprintf(format, args...)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Type: problemType(kind), Title: title, Status: status, Detail: detail, Kind: kind, Error: detail})
+}
+
+// requestCurrency returns the ?currency parameter, defaulting to the first configured currency
+func requestCurrency(r *http.Request) string {
+	if c := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("currency"))); c != "" {
+		return c
+	}
+	return currencies[0]
+}
+
+// parseTimeParam parses an RFC 3339 query parameter, returning fallback when it is absent
+func parseTimeParam(r *http.Request, name string, fallback time.Time) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q: expected RFC 3339, e.g. 2024-01-02T15:04:05Z", name, v)
+	}
+	return t, nil
+}
+
+// apiServer serves the price API from the repository it was built with
+type apiServer struct {
+	repo *Repository
+}
+
+// handleLatestPrice serves GET /prices/latest?currency=usd&precision=N
+// It returns the newest stored record for the currency, with its change over the last
+// 24 hours, 7 days, and 30 days
+func (s *apiServer) handleLatestPrice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	precision, err := requestPrecision(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	currency := requestCurrency(r)
+	prices, err := s.repo.LatestPrices(r.Context(), 1, currency)
+	if err != nil {
+		slog.Error("API failed to fetch latest price", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query prices")
+		return
+	}
+	if len(prices) == 0 {
+		writeAPIError(w, http.StatusNotFound, "no prices recorded for %s", currency)
+		return
+	}
+	changes, err := priceChanges(r.Context(), s.repo, prices[0])
+	if err != nil {
+		slog.Error("API failed to compute price changes", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query prices")
+		return
+	}
+	setAttribution(w, recordSources(prices))
+	writeJSON(w, http.StatusOK, latestPrice{
+		precisePriceRecord: precisePriceRecord{PriceRecord: prices[0], Price: fixedDecimal{prices[0].Price, precision}},
+		PriceChanges:       changes,
+	})
+}
+
+// latestPerCurrency returns the newest stored price of every configured currency, in
+// the order of CURRENCIES, from a single query
+func latestPerCurrency(ctx context.Context, repo *Repository) ([]PriceRecord, error) {
+	latest, err := repo.LatestPerCurrency(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byCurrency := make(map[string]PriceRecord, len(latest))
+	for _, r := range latest {
+		byCurrency[r.Currency] = r
+	}
+	prices := []PriceRecord{}
+	for _, currency := range currencies {
+		if r, ok := byCurrency[currency]; ok {
+			prices = append(prices, r)
+		}
+	}
+	return prices, nil
+}
+
+// handleFetch serves POST /fetch?precision=N
+// It fetches and stores the current prices now and returns the newest price of every
+// currency. It calls the providers and spends their budget, so it is only served
+// when API_AUTH or passkeys ask clients to authenticate.
+func (s *apiServer) handleFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !writesAuthenticated() {
+		writeAPIError(w, http.StatusForbidden, "fetching needs API_AUTH=writes or API_AUTH=all, or passkeys (PASSKEY_RP_ID)")
+		return
+	}
+	precision, err := requestPrecision(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	slog.Info("Fetch triggered via API")
+	if err := requestFetch(r.Context(), s.repo); err != nil {
+		writeAPIError(w, http.StatusBadGateway, "fetch failed: %v", err)
+		return
+	}
+	// A read replica may not have the new prices yet
+	prices, err := latestPerCurrency(readPrimary(r.Context()), s.repo)
+	if err != nil {
+		slog.Error("API failed to fetch latest prices", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query prices")
+		return
+	}
+	writeJSON(w, http.StatusOK, pricesWithPrecision(prices, precision))
+}
+
+// handlePriceRange serves GET /prices?currency=usd&from=...&to=...&limit=...&precision=N
+// &before=...&after=...&order=asc|desc
+// window= may replace from and to; from defaults to 24 hours ago and to to now; records
+// are returned oldest first unless order=desc. A full page links to the next one in a
+// Link header, and the keyset parameters also report the number of records in the range
+// in X-Total-Count.
+func (s *apiServer) handlePriceRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// An open end leaves the range open so samples stamped a moment
+	// after the request arrived are not cut off
+	from, to, err := requestWindow(r, "24h")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	limit := defaultRangeLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxRangeLimit {
+			writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and %d", maxRangeLimit)
+			return
+		}
+	}
+	precision, err := requestPrecision(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	filter, paged, err := requestPricePage(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	filter.Currency, filter.Since, filter.Until = requestCurrency(r), from, to
+
+	// One record beyond the page tells whether there is a next one
+	var prices []PriceRecord
+	if paged {
+		var total int
+		filter.Limit = limit + 1
+		prices, total, err = s.repo.SearchPrices(filter)
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	} else {
+		// A plain range is served the way dashboards poll it, from the cache and archives
+		prices, err = s.repo.PriceRange(filter.Currency, from, to, limit+1)
+	}
+	if err != nil {
+		slog.Error("API failed to fetch price range", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query prices")
+		return
+	}
+	if len(prices) > limit {
+		prices = prices[:limit]
+		setNextPageLink(w, r, filter, prices[limit-1].ID)
+	}
+	if prices == nil {
+		prices = []PriceRecord{} // Encode an empty range as [] rather than null
+	}
+	setAttribution(w, recordSources(prices))
+	writeJSON(w, http.StatusOK, pricesWithPrecision(prices, precision))
+}
+
+// requestPricePage reads the keyset paging parameters of GET /prices: before and after,
+// each a record ID or an RFC 3339 time, and order, asc (the default) or desc. paged is
+// false when none is given.
+func requestPricePage(r *http.Request) (filter PriceFilter, paged bool, err error) {
+	q := r.URL.Query()
+	parseTime := func(v string) (time.Time, error) { return time.Parse(time.RFC3339, v) }
+	if v := q.Get("before"); v != "" {
+		if filter.Before, err = parsePriceCursor(v, parseTime); err != nil {
+			return filter, false, fmt.Errorf("before: %w", err)
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		if filter.After, err = parsePriceCursor(v, parseTime); err != nil {
+			return filter, false, fmt.Errorf("after: %w", err)
+		}
+	}
+	switch q.Get("order") {
+	case "", "asc":
+		filter.Ascending = true
+	case "desc":
+	default:
+		return filter, false, fmt.Errorf("invalid order %q: expected asc or desc", q.Get("order"))
+	}
+	return filter, q.Has("before") || q.Has("after") || q.Has("order"), nil
+}
+
+// setNextPageLink points a Link header with rel="next" at the page after the record
+// with lastID, keeping the request's other parameters
+func setNextPageLink(w http.ResponseWriter, r *http.Request, filter PriceFilter, lastID int) {
+	q := r.URL.Query()
+	if filter.Ascending {
+		q.Set("after", strconv.Itoa(lastID))
+	} else {
+		q.Set("before", strconv.Itoa(lastID))
+	}
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, q.Encode()))
+}
+
+// handleCandles serves GET /candles?currency=usd&resolution=1h&from=...&to=...&limit=...&precision=N&tz=...
+// from defaults to the newest 48 candles; candles are returned oldest first, daily ones
+// aligned to midnight in the tz zone
+func (s *apiServer) handleCandles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	resolution := CandleHourly
+	if v := r.URL.Query().Get("resolution"); v != "" {
+		res, err := parseCandleResolution(v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		resolution = res
+	}
+
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	defaultFrom := candleStart(time.Now(), resolution).Add(-(defaultCandleCount - 1) * candleDuration(resolution))
+	if resolution == CandleDaily {
+		defaultFrom = localMidnight(time.Now(), loc).AddDate(0, 0, -(defaultCandleCount - 1))
+	}
+	from, to, err := requestWindow(r, "")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if from.IsZero() {
+		from = defaultFrom
+		if !to.IsZero() && !to.After(from) {
+			writeAPIError(w, http.StatusBadRequest, "to must be after from")
+			return
+		}
+	}
+
+	limit := defaultRangeLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxRangeLimit {
+			writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and %d", maxRangeLimit)
+			return
+		}
+	}
+	precision, err := requestPrecision(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	// An open-ended range is bounded by limit instead
+	if !to.IsZero() {
+		if err := checkAnalyticsRange(from, to, resolution); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+
+	ctx, cancel := withAnalyticsTimeout(r.Context())
+	defer cancel()
+	candles, err := candlesIn(ctx, s.repo, requestCurrency(r), resolution, from, to, limit, loc)
+	if err != nil {
+		writeAnalyticsError(w, r, "candles", err)
+		return
+	}
+	if candles == nil {
+		candles = []Candle{} // Encode an empty range as [] rather than null
+	}
+	writeJSON(w, http.StatusOK, candlesWithPrecision(candles, precision))
+}
+
+// handlePatterns serves GET /patterns?currency=usd&resolution=1d&from=...&limit=...
+// from defaults to 30 days ago and an omitted resolution returns every resolution
+func (s *apiServer) handlePatterns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	resolution := ""
+	if v := r.URL.Query().Get("resolution"); v != "" {
+		res, err := parseCandleResolution(v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		resolution = res
+	}
+
+	from, err := parseTimeParam(r, "from", time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	limit := defaultRangeLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxRangeLimit {
+			writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and %d", maxRangeLimit)
+			return
+		}
+	}
+
+	patterns, err := s.repo.CandlePatterns(requestCurrency(r), resolution, from, limit)
+	if err != nil {
+		slog.Error("API failed to fetch candle patterns", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query candle patterns")
+		return
+	}
+	if patterns == nil {
+		patterns = []CandlePattern{} // Encode an empty range as [] rather than null
+	}
+	writeJSON(w, http.StatusOK, patterns)
+}
+
+// handlePriceLevels serves GET /levels?currency=usd
+// It returns the detected support/resistance levels ordered by price
+func (s *apiServer) handlePriceLevels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	levels, err := s.repo.PriceLevels(requestCurrency(r))
+	if err != nil {
+		slog.Error("API failed to fetch price levels", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query price levels")
+		return
+	}
+	if levels == nil {
+		levels = []PriceLevel{} // Encode no levels as [] rather than null
+	}
+	writeJSON(w, http.StatusOK, levels)
+}
+
+// newAPIHandler returns the router for the price API and the dashboard, behind the
+// API-key check of API_AUTH. The /actions endpoints receive notification button
+// callbacks and verify them with their platform's secret instead, and /passkeys signs
+// dashboard users in; /dashboard/layout saves dashboard layouts and POST /fetch
+// fetches prices now. /grafana serves Grafana's JSON datasource. Every response credits the price providers in X-Data-Attribution.
+// A request may ask for the times of its JSON response in a zone with ?tz. Requests are
+// traced when OTEL_EXPORTER_OTLP_ENDPOINT is set. /public serves the public endpoints of
+// PUBLIC_API, which with PUBLIC_API=only are all there is.
+func newAPIHandler(repo *Repository) http.Handler {
+	if publicConfig.Mode == publicOnly {
+		return newPublicHandler(repo)
+	}
+	s := &apiServer{repo: repo}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleDashboard)
+	mux.HandleFunc("/dashboard/layout", s.handleDashboardLayout)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/openapi.json", handleOpenAPI)
+	mux.HandleFunc("/prices", s.handlePriceRange)
+	mux.HandleFunc("/prices/latest", s.handleLatestPrice)
+	mux.HandleFunc("/prices/at", s.handlePriceAt)
+	mux.HandleFunc("/prices/stream", s.handlePriceStream)
+	mux.HandleFunc("/prices/", s.handlePriceCorrection)
+	mux.HandleFunc("/corrections", s.handlePriceCorrections)
+	mux.HandleFunc("/candles", s.handleCandles)
+	mux.HandleFunc("/chart", s.handleChart)
+	mux.HandleFunc("/indicators", s.handleIndicators)
+	mux.HandleFunc("/patterns", s.handlePatterns)
+	mux.HandleFunc("/levels", s.handlePriceLevels)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/providers", s.handleProviders)
+	mux.HandleFunc("/portfolio", s.handlePortfolio)
+	mux.HandleFunc("/portfolio/history", s.handlePortfolioHistory)
+	mux.HandleFunc("/alerts/stats", s.handleAlertStats)
+	mux.HandleFunc("/targets", s.handleTargets)
+	mux.HandleFunc("/targets/", s.handleTargets)
+	mux.HandleFunc("/annotations", s.handleAnnotations)
+	mux.HandleFunc("/annotations/", s.handleAnnotations)
+	mux.HandleFunc("/anomalies", s.handleAnomalies)
+	mux.HandleFunc("/spread", s.handleSpread)
+	mux.HandleFunc("/baskets", s.handleBaskets)
+	mux.HandleFunc("/baskets/", s.handleBaskets)
+	mux.HandleFunc("/collectors", s.handleCollectors)
+	mux.HandleFunc("/collectors/", s.handleCollectors)
+	mux.HandleFunc("/feed", s.handleFeed)
+	mux.HandleFunc("/exports", s.handleExports)
+	mux.HandleFunc("/exports/", s.handleExports)
+	mux.HandleFunc("/actions/slack", s.handleSlackAction)
+	mux.HandleFunc("/actions/telegram", s.handleTelegramWebhook)
+	mux.HandleFunc("/actions/discord", s.handleDiscordInteraction)
+	mux.HandleFunc("/fetch", s.handleFetch)
+	mux.HandleFunc("/passkeys/", s.handlePasskeys)
+	mux.HandleFunc("/share", s.handleShares)
+	mux.HandleFunc("/share/", s.handleShares)
+	mux.HandleFunc("/embed/", s.handleEmbedChart)
+	mux.HandleFunc("/public/", s.handlePublic)
+	mux.HandleFunc(grafanaPathPrefix, s.handleGrafana)
+	mux.HandleFunc(grafanaPathPrefix+"/", s.handleGrafana)
+	return withTracing(requireAPIKey(repo, refuseAPIWrites(withAttribution(withResponseZone(mux)))))
+}
+
+// startAPIServer serves the price API on addr from repo in the background, and runs
+// the export jobs queued through it. It returns a function that shuts the server down,
+// letting in-flight requests finish
+func startAPIServer(addr string, repo *Repository) func() {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           newAPIHandler(repo),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// The live price feed stops when shutdown starts, which ends open streams so
+	// Shutdown doesn't wait on them; it keeps running for a gRPC server that still uses it
+	server.RegisterOnShutdown(livePrices.start(repo))
+	stopExports := func() {}
+	if writeMode == "" {
+		stopExports = exportJobs.start(repo) // Jobs write their progress to the database
+	}
+
+	go func() {
+		slog.Info("Serving price API", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("API server stopped", "error", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+		stopExports()
+	}
+}
+
+// runAPIServer serves the price API from repo on API_ADDR (default :8080), and the gRPC
+// API on GRPC_ADDR when it is set, until ctx is cancelled
+func runAPIServer(ctx context.Context, repo *Repository) {
+	addr := os.Getenv("API_ADDR")
+	if addr == "" {
+		addr = defaultAPIAddr
+	}
+
+	stopAPI := startAPIServer(addr, repo)
+	if grpcConfig.Addr != "" {
+		stopGRPC := startGRPCServer(repo, grpcConfig)
+		defer stopGRPC()
+	}
+	<-ctx.Done()
+	slog.Info("API server stopping")
+	stopAPI()
+}
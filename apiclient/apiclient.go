@@ -0,0 +1,1218 @@
+// Code generated by "bitcoin-tracker openapi --client"; DO NOT EDIT.
+
+// Package apiclient is a client for the Bitcoin Price Tracker HTTP API, generated from
+// the OpenAPI document the tracker serves at /openapi.json.
+//
+//	c := apiclient.New("http://tracker:8080")
+//	prices, err := c.ListPrices(ctx, apiclient.ListPricesParams{Currency: "usd"})
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API of one tracker instance
+// Its methods are safe for concurrent use.
+type Client struct {
+	BaseURL    string       // e.g. "http://localhost:8080"
+	HTTPClient *http.Client // Client used for requests
+	APIKey     string       // Sent as a bearer token when set
+}
+
+// New returns a client for the tracker at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTPClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Error is a failed response, with the RFC 7807 problem details the tracker sent
+type Error struct {
+	Status int    `json:"status"`
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Kind   string `json:"kind,omitempty"` // Kind of failure, e.g. "validation" or "storage"
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("tracker returned status %d", e.Status)
+	}
+	return fmt.Sprintf("tracker returned status %d: %s", e.Status, e.Detail)
+}
+
+// do sends a request with body encoded as JSON, unless nil, and decodes the response
+// into out, unless nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{Status: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Detail == "" {
+			apiErr.Detail = strings.TrimSpace(string(data))
+		}
+		apiErr.Status = resp.StatusCode
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// AlertRuleStats is a schema of the API
+type AlertRuleStats struct {
+	RuleID              int        `json:"rule_id"`
+	Condition           string     `json:"condition,omitempty"`
+	Currency            string     `json:"currency,omitempty"`
+	Evaluations         int64      `json:"evaluations"`
+	Triggers            int64      `json:"triggers"`
+	Notifications       int64      `json:"notifications"`
+	Suppressed          int64      `json:"suppressed"`
+	Errors              int64      `json:"errors"`
+	LastEvaluated       *time.Time `json:"last_evaluated,omitempty"`
+	LastTriggered       *time.Time `json:"last_triggered,omitempty"`
+	LastNotified        *time.Time `json:"last_notified,omitempty"`
+	Since               time.Time  `json:"since"`
+	NotificationsPerDay float64    `json:"notifications_per_day"`
+	TriggerRate         float64    `json:"trigger_rate"`
+	Noisy               bool       `json:"noisy"`
+}
+
+// Annotation is a schema of the API
+type Annotation struct {
+	ID        int       `json:"id"`
+	Time      time.Time `json:"time"`
+	Text      string    `json:"text"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AnnotationRequest is a schema of the API
+type AnnotationRequest struct {
+	Time time.Time `json:"time,omitempty"`
+	Text string    `json:"text"`
+	Tags []string  `json:"tags,omitempty"`
+}
+
+// BasketSummary is a schema of the API
+type BasketSummary struct {
+	Name       string       `json:"name"`
+	Definition string       `json:"definition"`
+	Currency   string       `json:"currency"`
+	Latest     *BasketValue `json:"latest,omitempty"`
+	Change24h  *float64     `json:"change_24h,omitempty"`
+}
+
+// BasketValue is a schema of the API
+type BasketValue struct {
+	Basket    string    `json:"basket"`
+	Currency  string    `json:"currency"`
+	Value     float64   `json:"value"`
+	Members   []string  `json:"members,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Candle is a schema of the API
+type Candle struct {
+	Currency   string    `json:"currency"`
+	Resolution string    `json:"resolution"`
+	Start      time.Time `json:"start"`
+	Open       float64   `json:"open"`
+	High       float64   `json:"high"`
+	Low        float64   `json:"low"`
+	Close      float64   `json:"close"`
+	Samples    int       `json:"samples"`
+}
+
+// CandlePattern is a schema of the API
+type CandlePattern struct {
+	Currency   string    `json:"currency"`
+	Resolution string    `json:"resolution"`
+	Start      time.Time `json:"start"`
+	Pattern    string    `json:"pattern"`
+	Direction  string    `json:"direction"`
+	Confidence float64   `json:"confidence"`
+	Close      float64   `json:"close"`
+}
+
+// CollectorSample is a schema of the API
+type CollectorSample struct {
+	ID        int       `json:"id"`
+	Collector string    `json:"collector"`
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// CollectorSummary is a schema of the API
+type CollectorSummary struct {
+	ID        int       `json:"id"`
+	Collector string    `json:"collector"`
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+	Unit      string    `json:"unit"`
+}
+
+// DatabaseStatus is a schema of the API
+type DatabaseStatus struct {
+	Connected bool             `json:"connected"`
+	Error     string           `json:"error,omitempty"`
+	Rows      map[string]int64 `json:"rows,omitempty"`
+}
+
+// ExportJob is a schema of the API
+type ExportJob struct {
+	ID         int        `json:"id"`
+	Kind       string     `json:"kind"`
+	Format     string     `json:"format,omitempty"`
+	Currency   string     `json:"currency,omitempty"`
+	Precision  *int       `json:"precision,omitempty"`
+	From       *time.Time `json:"from,omitempty"`
+	To         time.Time  `json:"to"`
+	Status     string     `json:"status"`
+	Done       int64      `json:"done"`
+	Total      int64      `json:"total"`
+	Records    int64      `json:"records"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Progress   float64    `json:"progress"`
+	Download   string     `json:"download,omitempty"`
+}
+
+// ExportJobRequest is a schema of the API
+type ExportJobRequest struct {
+	Kind      string     `json:"kind,omitempty"`
+	Format    string     `json:"format,omitempty"`
+	Currency  string     `json:"currency,omitempty"`
+	Precision *int       `json:"precision,omitempty"`
+	From      *time.Time `json:"from,omitempty"`
+	To        *time.Time `json:"to,omitempty"`
+	Window    string     `json:"window,omitempty"`
+}
+
+// FearGreedStats is a schema of the API
+type FearGreedStats struct {
+	Samples        int     `json:"samples"`
+	Mean           float64 `json:"mean"`
+	Min            int     `json:"min"`
+	Max            int     `json:"max"`
+	Last           int     `json:"last"`
+	Classification string  `json:"classification"`
+}
+
+// HealthReport is a schema of the API
+type HealthReport struct {
+	Status    string               `json:"status"`
+	Mode      string               `json:"mode"`
+	Problems  []string             `json:"problems,omitempty"`
+	Database  DatabaseStatus       `json:"database"`
+	Scheduler *SchedulerStatus     `json:"scheduler,omitempty"`
+	LastFetch map[string]time.Time `json:"last_fetch,omitempty"`
+	MaxAge    string               `json:"max_age"`
+	Prices    []PriceAge           `json:"prices"`
+}
+
+// HoldingValue is a schema of the API
+type HoldingValue struct {
+	ID       int       `json:"id"`
+	Asset    string    `json:"asset"`
+	Quantity float64   `json:"quantity"`
+	Cost     float64   `json:"cost"`
+	Currency string    `json:"currency"`
+	Acquired time.Time `json:"acquired"`
+	Tenant   string    `json:"tenant,omitempty"`
+	Price    float64   `json:"price"`
+	PricedAt time.Time `json:"priced_at"`
+	Value    float64   `json:"value"`
+	Gain     *float64  `json:"gain,omitempty"`
+	GainPct  *float64  `json:"gain_pct,omitempty"`
+}
+
+// IndicatorPoint is a schema of the API
+type IndicatorPoint struct {
+	Start  time.Time          `json:"start"`
+	Values map[string]float64 `json:"values"`
+}
+
+// LatestPrice is a schema of the API
+type LatestPrice struct {
+	ID        int       `json:"id"`
+	Currency  string    `json:"currency"`
+	Source    string    `json:"source"`
+	Degraded  bool      `json:"degraded,omitempty"`
+	FXRate    float64   `json:"fx_rate,omitempty"`
+	Latency   float64   `json:"latency,omitempty"`
+	Volume24h float64   `json:"volume_24h,omitempty"`
+	MarketCap float64   `json:"market_cap,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Price     float64   `json:"price"`
+	Change24h *float64  `json:"change_24h,omitempty"`
+	Change7d  *float64  `json:"change_7d,omitempty"`
+	Change30d *float64  `json:"change_30d,omitempty"`
+}
+
+// PortfolioSnapshot is a schema of the API
+type PortfolioSnapshot struct {
+	Currency  string    `json:"currency"`
+	Value     float64   `json:"value"`
+	Cost      float64   `json:"cost"`
+	Gain      float64   `json:"gain"`
+	Timestamp time.Time `json:"timestamp"`
+	Tenant    string    `json:"tenant,omitempty"`
+}
+
+// PortfolioValuation is a schema of the API
+type PortfolioValuation struct {
+	Currency string         `json:"currency"`
+	Holdings []HoldingValue `json:"holdings"`
+	Value    float64        `json:"value"`
+	Cost     float64        `json:"cost"`
+	Gain     float64        `json:"gain"`
+	GainPct  float64        `json:"gain_pct"`
+	ValuedAt time.Time      `json:"valued_at"`
+}
+
+// PriceAge is a schema of the API
+type PriceAge struct {
+	Currency  string    `json:"currency"`
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	Age       string    `json:"age,omitempty"`
+	Latency   float64   `json:"latency,omitempty"`
+	Stale     bool      `json:"stale"`
+}
+
+// PriceAnomaly is a schema of the API
+type PriceAnomaly struct {
+	ID         int        `json:"id"`
+	Currency   string     `json:"currency"`
+	Price      float64    `json:"price"`
+	Source     string     `json:"source"`
+	Baseline   float64    `json:"baseline"`
+	Deviation  float64    `json:"deviation"`
+	Action     string     `json:"action"`
+	DetectedAt time.Time  `json:"detected_at"`
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+}
+
+// PriceAt is a schema of the API
+type PriceAt struct {
+	Currency string       `json:"currency"`
+	At       time.Time    `json:"at"`
+	Price    float64      `json:"price"`
+	Method   string       `json:"method"`
+	Before   *PriceRecord `json:"before,omitempty"`
+	After    *PriceRecord `json:"after,omitempty"`
+	Offset   float64      `json:"offset"`
+}
+
+// PriceCorrection is a schema of the API
+type PriceCorrection struct {
+	ID        int       `json:"id"`
+	PriceID   int       `json:"price_id"`
+	Action    string    `json:"action"`
+	Currency  string    `json:"currency"`
+	Timestamp time.Time `json:"timestamp"`
+	OldPrice  float64   `json:"old_price"`
+	NewPrice  *float64  `json:"new_price,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PriceCorrectionRequest is a schema of the API
+type PriceCorrectionRequest struct {
+	Price  float64 `json:"price,omitempty"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+// PriceExtremes is a schema of the API
+type PriceExtremes struct {
+	Coin     string    `json:"coin"`
+	Currency string    `json:"currency"`
+	Ath      float64   `json:"ath"`
+	AthAt    time.Time `json:"ath_at"`
+	Atl      float64   `json:"atl"`
+	AtlAt    time.Time `json:"atl_at"`
+}
+
+// PriceLevel is a schema of the API
+type PriceLevel struct {
+	Currency   string    `json:"currency"`
+	Kind       string    `json:"kind"`
+	Price      float64   `json:"price"`
+	Touches    int       `json:"touches"`
+	FirstTouch time.Time `json:"first_touch"`
+	LastTouch  time.Time `json:"last_touch"`
+}
+
+// PriceRecord is a schema of the API
+type PriceRecord struct {
+	ID        int       `json:"id"`
+	Price     float64   `json:"price"`
+	Currency  string    `json:"currency"`
+	Source    string    `json:"source"`
+	Degraded  bool      `json:"degraded,omitempty"`
+	FXRate    float64   `json:"fx_rate,omitempty"`
+	Latency   float64   `json:"latency,omitempty"`
+	Volume24h float64   `json:"volume_24h,omitempty"`
+	MarketCap float64   `json:"market_cap,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// PriceStats is a schema of the API
+type PriceStats struct {
+	Currency   string          `json:"currency"`
+	From       time.Time       `json:"from"`
+	To         time.Time       `json:"to"`
+	Samples    int             `json:"samples"`
+	Min        float64         `json:"min"`
+	Max        float64         `json:"max"`
+	Mean       float64         `json:"mean"`
+	Median     float64         `json:"median"`
+	Stddev     float64         `json:"stddev"`
+	First      float64         `json:"first"`
+	Last       float64         `json:"last"`
+	ChangePct  float64         `json:"change_pct"`
+	Summarized bool            `json:"summarized,omitempty"`
+	FearGreed  *FearGreedStats `json:"fear_greed,omitempty"`
+	AllTime    *PriceExtremes  `json:"all_time,omitempty"`
+}
+
+// PriceTarget is a schema of the API
+type PriceTarget struct {
+	ID         int        `json:"id"`
+	Currency   string     `json:"currency"`
+	Price      float64    `json:"price"`
+	Direction  string     `json:"direction"`
+	Note       string     `json:"note,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	FiredPrice float64    `json:"fired_price,omitempty"`
+}
+
+// PriceTargetRequest is a schema of the API
+type PriceTargetRequest struct {
+	Price     float64 `json:"price"`
+	Currency  string  `json:"currency,omitempty"`
+	Direction string  `json:"direction,omitempty"`
+	Note      string  `json:"note,omitempty"`
+}
+
+// ProviderCapabilities is a schema of the API
+type ProviderCapabilities struct {
+	Provider          string   `json:"provider"`
+	Configured        int      `json:"configured"`
+	Assets            []string `json:"assets"`
+	Currencies        []string `json:"currencies"`
+	MissingCurrencies []string `json:"missing_currencies"`
+	Live              string   `json:"live"`
+	History           string   `json:"history"`
+	HistoryFrom       string   `json:"history_from"`
+	Backfill          bool     `json:"backfill"`
+	Attribution       string   `json:"attribution,omitempty"`
+	Probed            bool     `json:"probed"`
+	ProbeError        string   `json:"probe_error,omitempty"`
+}
+
+// PublicHistory is a schema of the API
+type PublicHistory struct {
+	Currency   string        `json:"currency"`
+	Resolution string        `json:"resolution"`
+	Points     []PublicPoint `json:"points"`
+}
+
+// PublicPoint is a schema of the API
+type PublicPoint struct {
+	Time  time.Time `json:"time"`
+	Price float64   `json:"price"`
+}
+
+// PublicPrice is a schema of the API
+type PublicPrice struct {
+	Currency  string    `json:"currency"`
+	Price     float64   `json:"price"`
+	Timestamp time.Time `json:"timestamp"`
+	Change24h *float64  `json:"change_24h,omitempty"`
+	Change7d  *float64  `json:"change_7d,omitempty"`
+	Change30d *float64  `json:"change_30d,omitempty"`
+}
+
+// SchedulerStatus is a schema of the API
+type SchedulerStatus struct {
+	State       string               `json:"state"`
+	Paused      bool                 `json:"paused"`
+	Interval    string               `json:"interval"`
+	NextRun     time.Time            `json:"next_run"`
+	LastError   string               `json:"last_error,omitempty"`
+	LastErrorAt time.Time            `json:"last_error_at,omitempty"`
+	HeldBack    map[string]time.Time `json:"held_back,omitempty"`
+	Standby     *StandbyStatus       `json:"standby,omitempty"`
+	PromotedAt  time.Time            `json:"promoted_at,omitempty"`
+}
+
+// Spread is a schema of the API
+type Spread struct {
+	Currency     string             `json:"currency"`
+	Timestamp    time.Time          `json:"timestamp"`
+	Prices       map[string]float64 `json:"prices"`
+	LowExchange  string             `json:"low_exchange"`
+	HighExchange string             `json:"high_exchange"`
+	Spread       float64            `json:"spread"`
+	SpreadPct    float64            `json:"spread_pct"`
+}
+
+// SpreadReport is a schema of the API
+type SpreadReport struct {
+	Currency      string   `json:"currency"`
+	Window        string   `json:"window"`
+	Current       *Spread  `json:"current,omitempty"`
+	Samples       int      `json:"samples"`
+	MeanSpreadPct float64  `json:"mean_spread_pct"`
+	MaxSpreadPct  float64  `json:"max_spread_pct"`
+	Widest        *Spread  `json:"widest,omitempty"`
+	History       []Spread `json:"history"`
+}
+
+// StandbyStatus is a schema of the API
+type StandbyStatus struct {
+	Primary    string    `json:"primary,omitempty"`
+	LastBeat   time.Time `json:"last_beat,omitempty"`
+	TakeoverAt time.Time `json:"takeover_at"`
+}
+
+// LatestPriceParams are the query parameters of LatestPrice; zero values are left out
+type LatestPriceParams struct {
+	Currency  string // Fiat currency code; the first of CURRENCIES when omitted
+	Precision *int   // Decimal places of the prices; full precision when omitted
+}
+
+// LatestPrice calls GET /prices/latest
+// Newest record of a currency with its change over 24 hours, 7 days, and 30 days
+func (c *Client) LatestPrice(ctx context.Context, params LatestPriceParams) (LatestPrice, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	if params.Precision != nil {
+		query.Set("precision", strconv.Itoa(*params.Precision))
+	}
+	var out LatestPrice
+	err := c.do(ctx, http.MethodGet, "/prices/latest", query, nil, &out)
+	return out, err
+}
+
+// PriceAtParams are the query parameters of PriceAt; zero values are left out
+type PriceAtParams struct {
+	T         string // Time of the price (RFC 3339, e.g. 2023-06-01T12:00Z, or Unix seconds)
+	Currency  string // Fiat currency code; the first of CURRENCIES when omitted
+	Mode      string // interpolate (default) or nearest
+	MaxGap    string // Farthest a sample used may be from t, e.g. 6h; 24h when omitted
+	Precision *int   // Decimal places of the prices; full precision when omitted
+}
+
+// PriceAt calls GET /prices/at
+// Price at a point in time, interpolated between the samples around it or from the nearest one; 404 when none is within max_gap
+func (c *Client) PriceAt(ctx context.Context, params PriceAtParams) (PriceAt, error) {
+	query := url.Values{}
+	if params.T != "" {
+		query.Set("t", params.T)
+	}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	if params.Mode != "" {
+		query.Set("mode", params.Mode)
+	}
+	if params.MaxGap != "" {
+		query.Set("max_gap", params.MaxGap)
+	}
+	if params.Precision != nil {
+		query.Set("precision", strconv.Itoa(*params.Precision))
+	}
+	var out PriceAt
+	err := c.do(ctx, http.MethodGet, "/prices/at", query, nil, &out)
+	return out, err
+}
+
+// ListPricesParams are the query parameters of ListPrices; zero values are left out
+type ListPricesParams struct {
+	Currency  string    // Fiat currency code; the first of CURRENCIES when omitted
+	Window    string    // Range instead of from and to, e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31
+	From      time.Time // Start of the range (RFC 3339)
+	To        time.Time // End of the range, exclusive (RFC 3339)
+	Limit     *int      // Most records returned, up to 10000
+	Precision *int      // Decimal places of the prices; full precision when omitted
+	Before    string    // Only records listed before this record ID or RFC 3339 time
+	After     string    // Only records listed after this record ID or RFC 3339 time
+	Order     string    // asc (oldest first, the default) or desc (newest first)
+}
+
+// ListPrices calls GET /prices
+// Records in [from, to), oldest first unless order=desc; from defaults to 24 hours ago. A full page links to the next in a Link header
+func (c *Client) ListPrices(ctx context.Context, params ListPricesParams) ([]PriceRecord, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	if params.Window != "" {
+		query.Set("window", params.Window)
+	}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339Nano))
+	}
+	if !params.To.IsZero() {
+		query.Set("to", params.To.Format(time.RFC3339Nano))
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.Itoa(*params.Limit))
+	}
+	if params.Precision != nil {
+		query.Set("precision", strconv.Itoa(*params.Precision))
+	}
+	if params.Before != "" {
+		query.Set("before", params.Before)
+	}
+	if params.After != "" {
+		query.Set("after", params.After)
+	}
+	if params.Order != "" {
+		query.Set("order", params.Order)
+	}
+	var out []PriceRecord
+	err := c.do(ctx, http.MethodGet, "/prices", query, nil, &out)
+	return out, err
+}
+
+// FetchParams are the query parameters of Fetch; zero values are left out
+type FetchParams struct {
+	Precision *int // Decimal places of the prices; full precision when omitted
+}
+
+// Fetch calls POST /fetch
+// Fetch and store the current prices now; returns the newest record of every currency
+func (c *Client) Fetch(ctx context.Context, params FetchParams) ([]PriceRecord, error) {
+	query := url.Values{}
+	if params.Precision != nil {
+		query.Set("precision", strconv.Itoa(*params.Precision))
+	}
+	var out []PriceRecord
+	err := c.do(ctx, http.MethodPost, "/fetch", query, nil, &out)
+	return out, err
+}
+
+// DeletePrice calls DELETE /prices/{id}
+// Delete a glitched record, keeping it in the audit trail; the body's reason is optional
+func (c *Client) DeletePrice(ctx context.Context, id int, body PriceCorrectionRequest) (PriceCorrection, error) {
+	query := url.Values{}
+	var out PriceCorrection
+	err := c.do(ctx, http.MethodDelete, "/prices/"+strconv.Itoa(id), query, body, &out)
+	return out, err
+}
+
+// AmendPrice calls PATCH /prices/{id}
+// Give a record the price it should have had
+func (c *Client) AmendPrice(ctx context.Context, id int, body PriceCorrectionRequest) (PriceCorrection, error) {
+	query := url.Values{}
+	var out PriceCorrection
+	err := c.do(ctx, http.MethodPatch, "/prices/"+strconv.Itoa(id), query, body, &out)
+	return out, err
+}
+
+// RestorePrice calls POST /prices/{id}/restore
+// Put a deleted record back; 409 when a record of its currency and minute is stored
+func (c *Client) RestorePrice(ctx context.Context, id int, body PriceCorrectionRequest) (PriceCorrection, error) {
+	query := url.Values{}
+	var out PriceCorrection
+	err := c.do(ctx, http.MethodPost, "/prices/"+strconv.Itoa(id)+"/restore", query, body, &out)
+	return out, err
+}
+
+// ListPriceCorrectionsParams are the query parameters of ListPriceCorrections; zero values are left out
+type ListPriceCorrectionsParams struct {
+	PriceID *int // Only the corrections of this record
+	Limit   *int // Most records returned, up to 10000
+}
+
+// ListPriceCorrections calls GET /corrections
+// Audit trail of deleted, amended, and restored records, newest first
+func (c *Client) ListPriceCorrections(ctx context.Context, params ListPriceCorrectionsParams) ([]PriceCorrection, error) {
+	query := url.Values{}
+	if params.PriceID != nil {
+		query.Set("price_id", strconv.Itoa(*params.PriceID))
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.Itoa(*params.Limit))
+	}
+	var out []PriceCorrection
+	err := c.do(ctx, http.MethodGet, "/corrections", query, nil, &out)
+	return out, err
+}
+
+// ListCandlesParams are the query parameters of ListCandles; zero values are left out
+type ListCandlesParams struct {
+	Currency   string    // Fiat currency code; the first of CURRENCIES when omitted
+	Resolution string    // Candle resolution, 1h or 1d
+	Window     string    // Range instead of from and to, e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31
+	From       time.Time // Start of the range (RFC 3339)
+	To         time.Time // End of the range, exclusive (RFC 3339)
+	Limit      *int      // Most records returned, up to 10000
+	Precision  *int      // Decimal places of the prices; full precision when omitted
+}
+
+// ListCandles calls GET /candles
+// OHLC candles starting in [from, to), oldest first; from defaults to the newest 48 candles
+func (c *Client) ListCandles(ctx context.Context, params ListCandlesParams) ([]Candle, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	if params.Resolution != "" {
+		query.Set("resolution", params.Resolution)
+	}
+	if params.Window != "" {
+		query.Set("window", params.Window)
+	}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339Nano))
+	}
+	if !params.To.IsZero() {
+		query.Set("to", params.To.Format(time.RFC3339Nano))
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.Itoa(*params.Limit))
+	}
+	if params.Precision != nil {
+		query.Set("precision", strconv.Itoa(*params.Precision))
+	}
+	var out []Candle
+	err := c.do(ctx, http.MethodGet, "/candles", query, nil, &out)
+	return out, err
+}
+
+// ListIndicatorsParams are the query parameters of ListIndicators; zero values are left out
+type ListIndicatorsParams struct {
+	Currency   string    // Fiat currency code; the first of CURRENCIES when omitted
+	Resolution string    // Candle resolution, 1h or 1d
+	Window     string    // Range instead of from and to, e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31
+	From       time.Time // Start of the range (RFC 3339)
+	To         time.Time // End of the range, exclusive (RFC 3339)
+	Limit      *int      // Most records returned, up to 10000
+}
+
+// ListIndicators calls GET /indicators
+// Indicator values per candle starting in [from, to), oldest first
+func (c *Client) ListIndicators(ctx context.Context, params ListIndicatorsParams) ([]IndicatorPoint, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	if params.Resolution != "" {
+		query.Set("resolution", params.Resolution)
+	}
+	if params.Window != "" {
+		query.Set("window", params.Window)
+	}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339Nano))
+	}
+	if !params.To.IsZero() {
+		query.Set("to", params.To.Format(time.RFC3339Nano))
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.Itoa(*params.Limit))
+	}
+	var out []IndicatorPoint
+	err := c.do(ctx, http.MethodGet, "/indicators", query, nil, &out)
+	return out, err
+}
+
+// ListPatternsParams are the query parameters of ListPatterns; zero values are left out
+type ListPatternsParams struct {
+	Currency   string    // Fiat currency code; the first of CURRENCIES when omitted
+	Resolution string    // Candle resolution, 1h or 1d
+	From       time.Time // Start of the range (RFC 3339)
+	Limit      *int      // Most records returned, up to 10000
+}
+
+// ListPatterns calls GET /patterns
+// Candlestick patterns detected since from (default 30 days ago), oldest first
+func (c *Client) ListPatterns(ctx context.Context, params ListPatternsParams) ([]CandlePattern, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	if params.Resolution != "" {
+		query.Set("resolution", params.Resolution)
+	}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339Nano))
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.Itoa(*params.Limit))
+	}
+	var out []CandlePattern
+	err := c.do(ctx, http.MethodGet, "/patterns", query, nil, &out)
+	return out, err
+}
+
+// ListLevelsParams are the query parameters of ListLevels; zero values are left out
+type ListLevelsParams struct {
+	Currency string // Fiat currency code; the first of CURRENCIES when omitted
+}
+
+// ListLevels calls GET /levels
+// Support and resistance levels, ordered by price
+func (c *Client) ListLevels(ctx context.Context, params ListLevelsParams) ([]PriceLevel, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	var out []PriceLevel
+	err := c.do(ctx, http.MethodGet, "/levels", query, nil, &out)
+	return out, err
+}
+
+// GetStatsParams are the query parameters of GetStats; zero values are left out
+type GetStatsParams struct {
+	Currency string    // Fiat currency code; the first of CURRENCIES when omitted
+	Window   string    // Range instead of from and to, e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31
+	From     time.Time // Start of the range (RFC 3339)
+	To       time.Time // End of the range, exclusive (RFC 3339)
+}
+
+// GetStats calls GET /stats
+// Statistics over a window, or over from and to; the 24 hours before to (default now) when neither is given
+func (c *Client) GetStats(ctx context.Context, params GetStatsParams) (PriceStats, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	if params.Window != "" {
+		query.Set("window", params.Window)
+	}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339Nano))
+	}
+	if !params.To.IsZero() {
+		query.Set("to", params.To.Format(time.RFC3339Nano))
+	}
+	var out PriceStats
+	err := c.do(ctx, http.MethodGet, "/stats", query, nil, &out)
+	return out, err
+}
+
+// GetSpreadParams are the query parameters of GetSpread; zero values are left out
+type GetSpreadParams struct {
+	Currency string // Fiat currency code; the first of CURRENCIES when omitted
+	Window   string // Window ending now, e.g. 24h or 7d
+}
+
+// GetSpread calls GET /spread
+// Newest price on each exchange of EXCHANGES and the spread between them
+func (c *Client) GetSpread(ctx context.Context, params GetSpreadParams) (SpreadReport, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	if params.Window != "" {
+		query.Set("window", params.Window)
+	}
+	var out SpreadReport
+	err := c.do(ctx, http.MethodGet, "/spread", query, nil, &out)
+	return out, err
+}
+
+// ListAnomaliesParams are the query parameters of ListAnomalies; zero values are left out
+type ListAnomaliesParams struct {
+	Limit *int // Most records returned, up to 10000
+}
+
+// ListAnomalies calls GET /anomalies
+// Prices the anomaly filter caught, newest first
+func (c *Client) ListAnomalies(ctx context.Context, params ListAnomaliesParams) ([]PriceAnomaly, error) {
+	query := url.Values{}
+	if params.Limit != nil {
+		query.Set("limit", strconv.Itoa(*params.Limit))
+	}
+	var out []PriceAnomaly
+	err := c.do(ctx, http.MethodGet, "/anomalies", query, nil, &out)
+	return out, err
+}
+
+// ListProviders calls GET /providers
+// Assets, currencies, and history of every built-in provider
+func (c *Client) ListProviders(ctx context.Context) ([]ProviderCapabilities, error) {
+	query := url.Values{}
+	var out []ProviderCapabilities
+	err := c.do(ctx, http.MethodGet, "/providers", query, nil, &out)
+	return out, err
+}
+
+// GetPortfolioParams are the query parameters of GetPortfolio; zero values are left out
+type GetPortfolioParams struct {
+	Currency string // Fiat currency code; the first of CURRENCIES when omitted
+}
+
+// GetPortfolio calls GET /portfolio
+// Every holding valued at the latest price; currency defaults to PORTFOLIO_CURRENCY
+func (c *Client) GetPortfolio(ctx context.Context, params GetPortfolioParams) (PortfolioValuation, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	var out PortfolioValuation
+	err := c.do(ctx, http.MethodGet, "/portfolio", query, nil, &out)
+	return out, err
+}
+
+// ListPortfolioHistoryParams are the query parameters of ListPortfolioHistory; zero values are left out
+type ListPortfolioHistoryParams struct {
+	Currency string    // Fiat currency code; the first of CURRENCIES when omitted
+	Window   string    // Range instead of from and to, e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31
+	From     time.Time // Start of the range (RFC 3339)
+	To       time.Time // End of the range, exclusive (RFC 3339)
+	Limit    *int      // Most records returned, up to 10000
+}
+
+// ListPortfolioHistory calls GET /portfolio/history
+// Portfolio snapshots in [from, to), oldest first; from defaults to 30 days ago
+func (c *Client) ListPortfolioHistory(ctx context.Context, params ListPortfolioHistoryParams) ([]PortfolioSnapshot, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	if params.Window != "" {
+		query.Set("window", params.Window)
+	}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339Nano))
+	}
+	if !params.To.IsZero() {
+		query.Set("to", params.To.Format(time.RFC3339Nano))
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.Itoa(*params.Limit))
+	}
+	var out []PortfolioSnapshot
+	err := c.do(ctx, http.MethodGet, "/portfolio/history", query, nil, &out)
+	return out, err
+}
+
+// ListAlertStats calls GET /alerts/stats
+// Statistics of every alert rule, noisiest first
+func (c *Client) ListAlertStats(ctx context.Context) ([]AlertRuleStats, error) {
+	query := url.Values{}
+	var out []AlertRuleStats
+	err := c.do(ctx, http.MethodGet, "/alerts/stats", query, nil, &out)
+	return out, err
+}
+
+// ListPriceTargetsParams are the query parameters of ListPriceTargets; zero values are left out
+type ListPriceTargetsParams struct {
+	Status string // Only targets in this state, pending or fired
+}
+
+// ListPriceTargets calls GET /targets
+// Price targets, oldest first
+func (c *Client) ListPriceTargets(ctx context.Context, params ListPriceTargetsParams) ([]PriceTarget, error) {
+	query := url.Values{}
+	if params.Status != "" {
+		query.Set("status", params.Status)
+	}
+	var out []PriceTarget
+	err := c.do(ctx, http.MethodGet, "/targets", query, nil, &out)
+	return out, err
+}
+
+// CreatePriceTarget calls POST /targets
+// Set a price target that notifies once when the price crosses it
+func (c *Client) CreatePriceTarget(ctx context.Context, body PriceTargetRequest) (PriceTarget, error) {
+	query := url.Values{}
+	var out PriceTarget
+	err := c.do(ctx, http.MethodPost, "/targets", query, body, &out)
+	return out, err
+}
+
+// RearmPriceTarget calls POST /targets/{id}/rearm
+// Make a fired price target pending again
+func (c *Client) RearmPriceTarget(ctx context.Context, id int) error {
+	query := url.Values{}
+	return c.do(ctx, http.MethodPost, "/targets/"+strconv.Itoa(id)+"/rearm", query, nil, nil)
+}
+
+// DeletePriceTarget calls DELETE /targets/{id}
+// Remove a price target
+func (c *Client) DeletePriceTarget(ctx context.Context, id int) error {
+	query := url.Values{}
+	return c.do(ctx, http.MethodDelete, "/targets/"+strconv.Itoa(id), query, nil, nil)
+}
+
+// ListAnnotationsParams are the query parameters of ListAnnotations; zero values are left out
+type ListAnnotationsParams struct {
+	Window string    // Range instead of from and to, e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31
+	From   time.Time // Start of the range (RFC 3339)
+	To     time.Time // End of the range, exclusive (RFC 3339)
+	Tag    string    // Only annotations with this tag
+}
+
+// ListAnnotations calls GET /annotations
+// Annotations in [from, to), oldest first; both ends are open when omitted
+func (c *Client) ListAnnotations(ctx context.Context, params ListAnnotationsParams) ([]Annotation, error) {
+	query := url.Values{}
+	if params.Window != "" {
+		query.Set("window", params.Window)
+	}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339Nano))
+	}
+	if !params.To.IsZero() {
+		query.Set("to", params.To.Format(time.RFC3339Nano))
+	}
+	if params.Tag != "" {
+		query.Set("tag", params.Tag)
+	}
+	var out []Annotation
+	err := c.do(ctx, http.MethodGet, "/annotations", query, nil, &out)
+	return out, err
+}
+
+// CreateAnnotation calls POST /annotations
+// Label a point in time, now when the body has no time
+func (c *Client) CreateAnnotation(ctx context.Context, body AnnotationRequest) (Annotation, error) {
+	query := url.Values{}
+	var out Annotation
+	err := c.do(ctx, http.MethodPost, "/annotations", query, body, &out)
+	return out, err
+}
+
+// DeleteAnnotation calls DELETE /annotations/{id}
+// Remove an annotation
+func (c *Client) DeleteAnnotation(ctx context.Context, id int) error {
+	query := url.Values{}
+	return c.do(ctx, http.MethodDelete, "/annotations/"+strconv.Itoa(id), query, nil, nil)
+}
+
+// ListBaskets calls GET /baskets
+// Every basket of BASKETS with its newest value and change over 24 hours
+func (c *Client) ListBaskets(ctx context.Context) ([]BasketSummary, error) {
+	query := url.Values{}
+	var out []BasketSummary
+	err := c.do(ctx, http.MethodGet, "/baskets", query, nil, &out)
+	return out, err
+}
+
+// ListBasketValuesParams are the query parameters of ListBasketValues; zero values are left out
+type ListBasketValuesParams struct {
+	Basket string    // Basket name
+	Window string    // Range instead of from and to, e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31
+	From   time.Time // Start of the range (RFC 3339)
+	To     time.Time // End of the range, exclusive (RFC 3339)
+}
+
+// ListBasketValues calls GET /baskets/history
+// Values of a basket in [from, to), oldest first; from defaults to 24 hours before to
+func (c *Client) ListBasketValues(ctx context.Context, params ListBasketValuesParams) ([]BasketValue, error) {
+	query := url.Values{}
+	if params.Basket != "" {
+		query.Set("basket", params.Basket)
+	}
+	if params.Window != "" {
+		query.Set("window", params.Window)
+	}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339Nano))
+	}
+	if !params.To.IsZero() {
+		query.Set("to", params.To.Format(time.RFC3339Nano))
+	}
+	var out []BasketValue
+	err := c.do(ctx, http.MethodGet, "/baskets/history", query, nil, &out)
+	return out, err
+}
+
+// ListCollectors calls GET /collectors
+// Newest value of every collector metric recorded so far
+func (c *Client) ListCollectors(ctx context.Context) ([]CollectorSummary, error) {
+	query := url.Values{}
+	var out []CollectorSummary
+	err := c.do(ctx, http.MethodGet, "/collectors", query, nil, &out)
+	return out, err
+}
+
+// ListCollectorSamplesParams are the query parameters of ListCollectorSamples; zero values are left out
+type ListCollectorSamplesParams struct {
+	Metric string    // Metric name, e.g. hashrate
+	Window string    // Range instead of from and to, e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31
+	From   time.Time // Start of the range (RFC 3339)
+	To     time.Time // End of the range, exclusive (RFC 3339)
+	Limit  *int      // Most records returned, up to 10000
+}
+
+// ListCollectorSamples calls GET /collectors/history
+// Values of a metric in [from, to), oldest first; from defaults to 24 hours ago
+func (c *Client) ListCollectorSamples(ctx context.Context, params ListCollectorSamplesParams) ([]CollectorSample, error) {
+	query := url.Values{}
+	if params.Metric != "" {
+		query.Set("metric", params.Metric)
+	}
+	if params.Window != "" {
+		query.Set("window", params.Window)
+	}
+	if !params.From.IsZero() {
+		query.Set("from", params.From.Format(time.RFC3339Nano))
+	}
+	if !params.To.IsZero() {
+		query.Set("to", params.To.Format(time.RFC3339Nano))
+	}
+	if params.Limit != nil {
+		query.Set("limit", strconv.Itoa(*params.Limit))
+	}
+	var out []CollectorSample
+	err := c.do(ctx, http.MethodGet, "/collectors/history", query, nil, &out)
+	return out, err
+}
+
+// CreateExportJob calls POST /exports
+// Queue an export or backfill job
+func (c *Client) CreateExportJob(ctx context.Context, body ExportJobRequest) (ExportJob, error) {
+	query := url.Values{}
+	var out ExportJob
+	err := c.do(ctx, http.MethodPost, "/exports", query, body, &out)
+	return out, err
+}
+
+// ListExportJobsParams are the query parameters of ListExportJobs; zero values are left out
+type ListExportJobsParams struct {
+	Limit *int // Most records returned, up to 10000
+}
+
+// ListExportJobs calls GET /exports
+// The newest export jobs
+func (c *Client) ListExportJobs(ctx context.Context, params ListExportJobsParams) ([]ExportJob, error) {
+	query := url.Values{}
+	if params.Limit != nil {
+		query.Set("limit", strconv.Itoa(*params.Limit))
+	}
+	var out []ExportJob
+	err := c.do(ctx, http.MethodGet, "/exports", query, nil, &out)
+	return out, err
+}
+
+// GetExportJob calls GET /exports/{id}
+// An export job's status and progress
+func (c *Client) GetExportJob(ctx context.Context, id int) (ExportJob, error) {
+	query := url.Values{}
+	var out ExportJob
+	err := c.do(ctx, http.MethodGet, "/exports/"+strconv.Itoa(id), query, nil, &out)
+	return out, err
+}
+
+// DeleteExportJob calls DELETE /exports/{id}
+// Cancel an export job and delete it with its file
+func (c *Client) DeleteExportJob(ctx context.Context, id int) error {
+	query := url.Values{}
+	return c.do(ctx, http.MethodDelete, "/exports/"+strconv.Itoa(id), query, nil, nil)
+}
+
+// PublicLatestPriceParams are the query parameters of PublicLatestPrice; zero values are left out
+type PublicLatestPriceParams struct {
+	Currency string // Fiat currency code; the first of CURRENCIES when omitted
+}
+
+// PublicLatestPrice calls GET /public/latest
+// Latest price of a currency with its change over 24 hours, 7 days, and 30 days; served without a key when PUBLIC_API is on
+func (c *Client) PublicLatestPrice(ctx context.Context, params PublicLatestPriceParams) (PublicPrice, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	var out PublicPrice
+	err := c.do(ctx, http.MethodGet, "/public/latest", query, nil, &out)
+	return out, err
+}
+
+// PublicPriceHistoryParams are the query parameters of PublicPriceHistory; zero values are left out
+type PublicPriceHistoryParams struct {
+	Currency string // Fiat currency code; the first of CURRENCIES when omitted
+	Range    string // Window ending now, e.g. 24h or 30d; 7d when omitted, at most 365d
+}
+
+// PublicPriceHistory calls GET /public/history
+// Candle closes over a range ending now, hourly up to 30 days; served without a key when PUBLIC_API is on
+func (c *Client) PublicPriceHistory(ctx context.Context, params PublicPriceHistoryParams) (PublicHistory, error) {
+	query := url.Values{}
+	if params.Currency != "" {
+		query.Set("currency", params.Currency)
+	}
+	if params.Range != "" {
+		query.Set("range", params.Range)
+	}
+	var out PublicHistory
+	err := c.do(ctx, http.MethodGet, "/public/history", query, nil, &out)
+	return out, err
+}
+
+// Healthz calls GET /healthz
+// Liveness probe; 503 when a fetching process is wedged
+func (c *Client) Healthz(ctx context.Context) (HealthReport, error) {
+	query := url.Values{}
+	var out HealthReport
+	err := c.do(ctx, http.MethodGet, "/healthz", query, nil, &out)
+	return out, err
+}
+
+// Readyz calls GET /readyz
+// Readiness probe; 503 while the database is unreachable
+func (c *Client) Readyz(ctx context.Context) (HealthReport, error) {
+	query := url.Values{}
+	var out HealthReport
+	err := c.do(ctx, http.MethodGet, "/readyz", query, nil, &out)
+	return out, err
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"crypto/rand"     // Package for generating keys
+	"crypto/sha256"   // Package for hashing keys
+	"encoding/base64" // Package for encoding generated keys
+	"encoding/hex"    // Package for stored key hashes
+	"fmt"             // Package for formatted I/O operations
+	"log/slog"        // Package for structured logging
+	"math"            // Package for Retry-After rounding
+	"net/http"        // Package for the authentication middleware
+	"os"              // Package for environment variables
+	"strconv"         // Package for parsing IDs and limits
+	"strings"         // Package for string manipulation
+	"sync"            // Package for guarding the per-key buckets
+	"time"            // Package for rate limiting and timestamps
+)
+
+// API authentication modes (API_AUTH)
+const (
+	apiAuthOff    = "off"    // Every request is allowed
+	apiAuthWrites = "writes" // Requests that change something need a key (default)
+	apiAuthAll    = "all"    // Every request needs a key, except the exempt paths
+)
+
+// apiKeyPrefix starts every generated key, so leaked keys are easy to recognize
+const apiKeyPrefix = "btk_"
+
+// apiKeyTouchInterval is how often a key's last_used_at is written at most
+const apiKeyTouchInterval = time.Minute
+
+// APIKey is a credential for the HTTP and gRPC APIs
+// Keys are random and long, so a plain SHA-256 is enough to store them safely
+type APIKey struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`     // First characters of the key
+	Hash      string     `json:"-"`          // Hex SHA-256 of the key
+	RateLimit int        `json:"rate_limit"` // Requests per minute; 0 = API_KEY_RATE_LIMIT
+	CreatedAt time.Time  `json:"created_at"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Tenant    string     `json:"tenant"` // Tenant whose data requests with the key see
+}
+
+// APIAuthConfig holds which requests need a key and the default per-key rate limit
+type APIAuthConfig struct {
+	Mode      string // apiAuthOff, apiAuthWrites, or apiAuthAll
+	RateLimit int    // Requests per minute of keys without their own limit; 0 = unlimited
+}
+
+// apiAuthConfig is the active configuration, loaded at startup
+var apiAuthConfig = APIAuthConfig{Mode: apiAuthWrites, RateLimit: 300}
+
+// loadAPIAuthConfig reads API_AUTH and API_KEY_RATE_LIMIT
+func loadAPIAuthConfig() (APIAuthConfig, error) {
+	c := APIAuthConfig{Mode: apiAuthWrites, RateLimit: 300}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("API_AUTH"))); v != "" {
+		if v != apiAuthOff && v != apiAuthWrites && v != apiAuthAll {
+			return c, fmt.Errorf("invalid API_AUTH %q (expected off, writes, or all)", v)
+		}
+		c.Mode = v
+	}
+	if v := strings.TrimSpace(os.Getenv("API_KEY_RATE_LIMIT")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return c, fmt.Errorf("invalid API_KEY_RATE_LIMIT %q (expected requests per minute)", v)
+		}
+		c.RateLimit = n
+	}
+	return c, nil
+}
+
+// hashAPIKey returns the stored form of a key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKey returns a new random key
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// apiAuthExempt reports whether a path is served without a key in every mode:
+// the probes, the OpenAPI document, the dashboard page itself (its data requests still
+// need a key), share links and embedded charts, which check a share token themselves,
+// the public endpoints, which are rate limited per client address instead, the passkey
+// sign-in, and the chat webhooks, which carry their platform's signature instead
+func apiAuthExempt(path string) bool {
+	return path == "/" || path == "/healthz" || path == "/readyz" || path == "/openapi.json" ||
+		strings.HasPrefix(path, "/share/") || strings.HasPrefix(path, "/embed/") || strings.HasPrefix(path, "/public/") ||
+		strings.HasPrefix(path, "/passkeys/") || strings.HasPrefix(path, "/actions/")
+}
+
+// isTenantRead reports whether a path reads a tenant's portfolio or alerts, or the
+// price targets, which API_AUTH=writes keeps private like writes: without a key they
+// would show the default tenant's holdings to anyone who can reach the API
+func isTenantRead(path string) bool {
+	return path == "/portfolio" || path == "/portfolio/history" || path == "/alerts/stats" ||
+		path == "/targets" || strings.HasPrefix(path, "/targets/")
+}
+
+// apiAuthRequired reports whether a request needs a key (or a passkey sign-in) under
+// the active mode; private requests are writes and tenant reads. With passkeys set up,
+// private requests need one even when API_AUTH is off.
+func apiAuthRequired(r *http.Request, private bool) bool {
+	switch apiAuthConfig.Mode {
+	case apiAuthAll:
+		return !apiAuthExempt(r.URL.Path)
+	case apiAuthWrites:
+		return private && !apiAuthExempt(r.URL.Path)
+	default:
+		return private && passkeyConfig.enabled() && !apiAuthExempt(r.URL.Path)
+	}
+}
+
+// writesAuthenticated reports whether requests that change something need a key or a
+// passkey sign-in; fetching on request is only offered then, since it spends the
+// providers' budget
+func writesAuthenticated() bool {
+	return apiAuthConfig.Mode != apiAuthOff || passkeyConfig.enabled()
+}
+
+// isWriteRequest reports whether an HTTP request may change something
+// Grafana's datasource posts its queries, which only read.
+func isWriteRequest(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, grafanaPathPrefix+"/") {
+		return false
+	}
+	return r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+}
+
+// requestAPIKey returns the key a request presents: an Authorization bearer token, an
+// X-API-Key header, or an api_key query parameter for clients that can't set headers
+// (browsers' EventSource)
+func requestAPIKey(r *http.Request) string {
+	if v := r.Header.Get("Authorization"); len(v) > 7 && strings.EqualFold(v[:7], "Bearer ") {
+		return strings.TrimSpace(v[7:])
+	}
+	if v := r.Header.Get("X-API-Key"); v != "" {
+		return strings.TrimSpace(v)
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// apiAuthError is why a request was refused
+type apiAuthError struct {
+	status     int           // http.StatusUnauthorized, http.StatusTooManyRequests, or http.StatusInternalServerError
+	message    string        // Returned to the client
+	retryAfter time.Duration // When status is http.StatusTooManyRequests
+}
+
+// Error returns the message
+func (e *apiAuthError) Error() string { return e.message }
+
+// keyBucket is the token bucket of one key
+type keyBucket struct {
+	tokens  float64
+	updated time.Time
+	touched time.Time // When last_used_at was last written
+}
+
+// keyLimiter holds a token bucket per key ID
+// A key may burst its whole per-minute limit, then continues at the limit's rate
+var keyLimiter = struct {
+	sync.Mutex
+	buckets map[int]*keyBucket
+}{buckets: map[int]*keyBucket{}}
+
+// takeKeyToken spends one of a key's requests; when none is left it returns how long
+// until the next one. It also reports whether last_used_at is due to be written.
+func takeKeyToken(key APIKey, now time.Time) (wait time.Duration, touch bool) {
+	keyLimiter.Lock()
+	defer keyLimiter.Unlock()
+
+	b, ok := keyLimiter.buckets[key.ID]
+	limit := key.RateLimit
+	if limit == 0 {
+		limit = apiAuthConfig.RateLimit
+	}
+	if !ok {
+		b = &keyBucket{tokens: float64(limit), updated: now}
+		keyLimiter.buckets[key.ID] = b
+	}
+	if touch = now.Sub(b.touched) >= apiKeyTouchInterval; touch {
+		b.touched = now
+	}
+	if limit == 0 {
+		return 0, touch
+	}
+
+	perSecond := float64(limit) / 60
+	b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.updated).Seconds()*perSecond)
+	b.updated = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / perSecond * float64(time.Second)), touch
+	}
+	b.tokens--
+	return 0, touch
+}
+
+// authenticateAPIKey checks the key a request presents and spends one of its requests
+func authenticateAPIKey(repo *Repository, r *http.Request) (APIKey, error) {
+	presented := requestAPIKey(r)
+	if presented == "" {
+		incCounter("tracker_api_auth_failures_total", map[string]string{"reason": "missing"}, 1)
+		return APIKey{}, &apiAuthError{status: http.StatusUnauthorized, message: "API key required"}
+	}
+	key, ok, err := repo.APIKeyByHash(hashAPIKey(presented))
+	if err != nil {
+		slog.Error("Failed to look up API key", "error", err)
+		return APIKey{}, &apiAuthError{status: http.StatusInternalServerError, message: "failed to check API key"}
+	}
+	if !ok || key.RevokedAt != nil {
+		reason := "invalid"
+		if ok {
+			reason = "revoked"
+		}
+		incCounter("tracker_api_auth_failures_total", map[string]string{"reason": reason}, 1)
+		return APIKey{}, &apiAuthError{status: http.StatusUnauthorized, message: "invalid API key"}
+	}
+
+	wait, touch := takeKeyToken(key, time.Now())
+	if touch {
+		if err := repo.TouchAPIKey(key.ID); err != nil {
+			slog.Warn("Failed to record API key use", "key", key.ID, "error", err)
+		}
+	}
+	if wait > 0 {
+		incCounter("tracker_api_rate_limited_total", map[string]string{"key": strconv.Itoa(key.ID)}, 1)
+		return key, &apiAuthError{status: http.StatusTooManyRequests, message: "rate limit exceeded", retryAfter: wait}
+	}
+	return key, nil
+}
+
+// requireAPIKey wraps the API with key authentication and per-key rate limits
+// Which requests need a key depends on API_AUTH; a browser signed in with a passkey
+// needs none. A request that presents a key is checked even where none is needed, and
+// works in the key's tenant and under its name in the audit trail of corrections.
+func requireAPIKey(repo *Repository, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented := requestAPIKey(r) != "" && !apiAuthExempt(r.URL.Path)
+		if !presented && !apiAuthRequired(r, isWriteRequest(r) || isTenantRead(r.URL.Path)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := passkeySessionUser(repo, r); ok && !presented {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, err := authenticateAPIKey(repo, r)
+		if err != nil {
+			ae := err.(*apiAuthError)
+			switch ae.status {
+			case http.StatusUnauthorized:
+				w.Header().Set("WWW-Authenticate", `Bearer realm="bitcoin-tracker"`)
+				if passkeyConfig.enabled() && requestAPIKey(r) == "" {
+					ae.message = "sign in with a passkey or send an API key"
+				}
+			case http.StatusTooManyRequests:
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(ae.retryAfter.Seconds()))))
+			}
+			writeAPIError(w, ae.status, "%s", ae.message)
+			return
+		}
+		ctx := withActor(withTenant(r.Context(), key.Tenant), "apikey:"+key.Name)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// runAPIKeyCommand handles the apikey subcommands:
+//
+//	apikey create [--rate N] [--tenant name] <name>
+//	apikey list
+//	apikey revoke <id>
+func runAPIKeyCommand(repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: apikey create|list|revoke")
+	}
+
+	switch args[0] {
+	case "create":
+		// Options come before the name, e.g. "apikey create --rate 600 grafana"
+		fs := newFlagSet("apikey create")
+		rate := fs.Int("rate", 0, "Requests per minute (default: API_KEY_RATE_LIMIT)")
+		tenantFlag := fs.String("tenant", cliTenant, "Tenant whose alerts and portfolio requests with the key see (default: TENANT)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if fs.NArg() != 1 || strings.TrimSpace(fs.Arg(0)) == "" {
+			return validationErrorf("usage: apikey create [--rate N] [--tenant name] <name>")
+		}
+		if *rate < 0 {
+			return validationErrorf("invalid --rate %d", *rate)
+		}
+		tenant, err := parseTenant(*tenantFlag)
+		if err != nil {
+			return err
+		}
+
+		secret, err := generateAPIKey()
+		if err != nil {
+			return err
+		}
+		key := APIKey{Name: strings.TrimSpace(fs.Arg(0)), Prefix: secret[:len(apiKeyPrefix)+6], Hash: hashAPIKey(secret), RateLimit: *rate, Tenant: tenant}
+		id, err := repo.SaveAPIKey(key)
+		if err != nil {
+			return err
+		}
+		slog.Info("Created API key", "id", id, "name", key.Name, "prefix", key.Prefix, "tenant", key.Tenant)
+		fmt.Println(secret)
+		fmt.Fprintln(os.Stderr, "Store the key now; it can't be shown again.")
+		if apiAuthConfig.Mode == apiAuthOff && key.Tenant == defaultTenant {
+			slog.Warn("API_AUTH=off, so the API doesn't ask for keys")
+		}
+
+	case "list":
+		keys, err := repo.APIKeys()
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			slog.Info("No API keys stored")
+			return nil
+		}
+
+		fmt.Printf("\n%-5s %-20s %-12s %-16s %-10s %-20s %-20s %-10s\n", "ID", "Name", "Prefix", "Tenant", "Rate/min", "Created", "Last used", "Status")
+		fmt.Println("----------------------------------------------------------------------------------------------------------------------")
+		for _, k := range keys {
+			rate := "default"
+			if k.RateLimit > 0 {
+				rate = strconv.Itoa(k.RateLimit)
+			}
+			lastUsed, status := "never", "active"
+			if k.LastUsed != nil {
+				lastUsed = formatDisplayTime(*k.LastUsed)
+			}
+			if k.RevokedAt != nil {
+				status = "revoked"
+			}
+			fmt.Printf("%-5d %-20s %-12s %-16s %-10s %-20s %-20s %-10s\n", k.ID, k.Name, k.Prefix, k.Tenant, rate,
+				formatDisplayTime(k.CreatedAt), lastUsed, status)
+		}
+		fmt.Println()
+
+	case "revoke":
+		if len(args) < 2 {
+			return validationErrorf("usage: apikey revoke <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid API key id %q", args[1])
+		}
+		if err := repo.RevokeAPIKey(id); err != nil {
+			return err
+		}
+		slog.Info("Revoked API key", "id", id)
+
+	default:
+		return validationErrorf("unknown apikey command: %s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest" // Package for building requests
+	"testing"           // Package for the tests
+)
+
+func TestAPIAuthRequired(t *testing.T) {
+	saved := apiAuthConfig
+	t.Cleanup(func() { apiAuthConfig = saved })
+
+	tests := []struct {
+		mode, method, path string
+		want               bool
+	}{
+		{apiAuthWrites, "GET", "/prices/latest", false},
+		{apiAuthWrites, "POST", "/fetch", true},
+		{apiAuthWrites, "GET", "/portfolio", true},
+		{apiAuthWrites, "GET", "/portfolio/history", true},
+		{apiAuthWrites, "GET", "/alerts/stats", true},
+		{apiAuthWrites, "GET", "/targets", true},
+		{apiAuthWrites, "GET", "/healthz", false},
+		{apiAuthOff, "GET", "/portfolio", false},
+		{apiAuthOff, "POST", "/fetch", false},
+		{apiAuthAll, "GET", "/prices/latest", true},
+		{apiAuthAll, "GET", "/share/abc", false},
+	}
+	for _, tt := range tests {
+		apiAuthConfig.Mode = tt.mode
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := apiAuthRequired(r, isWriteRequest(r) || isTenantRead(r.URL.Path)); got != tt.want {
+			t.Errorf("API_AUTH=%s %s %s: needs a key = %v, want %v", tt.mode, tt.method, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,734 @@
+package main
+
+import (
+	"bufio"           // Package for buffered archive I/O
+	"compress/gzip"   // Package for compressing archive files
+	"context"         // Package for restoring archived months
+	"encoding/binary" // Package for varint encoding
+	"errors"          // Package for error inspection
+	"fmt"             // Package for formatted I/O operations
+	"io"              // Package for archive readers and writers
+	"log/slog"        // Package for structured logging
+	"math"            // Package for scaling prices to integers
+	"os"              // Package for archive files and environment variables
+	"path/filepath"   // Package for archive file names
+	"slices"          // Package for sorting and merging records
+	"strconv"         // Package for parsing ARCHIVE_AFTER
+	"strings"         // Package for string manipulation
+	"sync"            // Package for guarding the decoded archive cache
+	"time"            // Package for archive months
+)
+
+// archiveMagic starts every archive file, followed by a format version byte
+const archiveMagic = "BTCA"
+
+// archiveVersion is the format version written by this build
+const archiveVersion = 1
+
+// archiveMonthLayout is the month in archive file names, e.g. prices-2024-03.btca.gz
+const archiveMonthLayout = "2006-01"
+
+// ArchiveConfig controls where old prices are archived
+type ArchiveConfig struct {
+	Dir   string // Directory holding one archive file per month
+	After int    // Whole months a price must be older than for `archive create` to move it
+}
+
+// archiveConfig is the active configuration, loaded at startup
+var archiveConfig = ArchiveConfig{Dir: "archive", After: 12}
+
+// loadArchiveConfig reads ARCHIVE_DIR and ARCHIVE_AFTER (a number of months)
+func loadArchiveConfig() (ArchiveConfig, error) {
+	c := ArchiveConfig{Dir: "archive", After: 12}
+	if v := os.Getenv("ARCHIVE_DIR"); v != "" {
+		c.Dir = v
+	}
+	if v := os.Getenv("ARCHIVE_AFTER"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c, fmt.Errorf("invalid ARCHIVE_AFTER %q (expected a number of months)", v)
+		}
+		c.After = n
+	}
+	return c, nil
+}
+
+// monthStart returns the first instant of t's UTC month
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// archivePath returns the file holding a month's prices
+func archivePath(dir string, month time.Time) string {
+	return filepath.Join(dir, "prices-"+month.Format(archiveMonthLayout)+".btca.gz")
+}
+
+// archivedMonths returns the start of every month with an archive file in dir, oldest first
+// A missing directory simply holds no archives
+func archivedMonths(dir string) ([]time.Time, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archive directory: %w", err)
+	}
+
+	var months []time.Time
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name(), "prices-")
+		if name, ok2 := strings.CutSuffix(name, ".btca.gz"); ok && ok2 && !e.IsDir() {
+			if month, err := time.Parse(archiveMonthLayout, name); err == nil {
+				months = append(months, month)
+			}
+		}
+	}
+	slices.SortFunc(months, time.Time.Compare)
+	return months, nil
+}
+
+// comparePriceRecords orders records by timestamp, then ID, like PriceRange
+func comparePriceRecords(a, b PriceRecord) int {
+	if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+		return c
+	}
+	return a.ID - b.ID
+}
+
+// mergePriceRecords merges two record lists into timestamp and ID order, dropping
+// records present in both (a month being archived is briefly in the file and the database)
+func mergePriceRecords(a, b []PriceRecord) []PriceRecord {
+	merged := append(slices.Clone(a), b...)
+	slices.SortFunc(merged, comparePriceRecords)
+	return slices.CompactFunc(merged, func(x, y PriceRecord) bool { return x.ID == y.ID && x.Timestamp.Equal(y.Timestamp) })
+}
+
+// archiveWriter writes the varint-encoded fields of an archive, keeping the first error
+type archiveWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+// uvarint writes an unsigned varint
+func (a *archiveWriter) uvarint(v uint64) {
+	if a.err == nil {
+		_, a.err = a.w.Write(a.buf[:binary.PutUvarint(a.buf[:], v)])
+	}
+}
+
+// varint writes a zigzag-encoded signed varint
+func (a *archiveWriter) varint(v int64) {
+	if a.err == nil {
+		_, a.err = a.w.Write(a.buf[:binary.PutVarint(a.buf[:], v)])
+	}
+}
+
+// str writes a length-prefixed string
+func (a *archiveWriter) str(s string) {
+	a.uvarint(uint64(len(s)))
+	if a.err == nil {
+		_, a.err = a.w.WriteString(s)
+	}
+}
+
+// encodeArchive writes records in the archive format, before compression:
+//
+//	"BTCA", version byte, uvarint scale, uvarint record count, uvarint group count
+//	per currency and source: string currency, string source, uvarint record count,
+//	then per record the signed varint deltas of ID, Unix microseconds, and price in
+//	units of 10^-scale from the previous record of the group
+//
+// Strings are a uvarint length followed by the bytes. Consecutive samples of one
+// source differ little, so the deltas mostly fit in one to three bytes before gzip.
+func encodeArchive(w io.Writer, records []PriceRecord, scale int) error {
+	sorted := slices.Clone(records)
+	slices.SortFunc(sorted, func(a, b PriceRecord) int {
+		if c := strings.Compare(a.Currency, b.Currency); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Source, b.Source); c != 0 {
+			return c
+		}
+		return comparePriceRecords(a, b)
+	})
+
+	// Split into runs of one currency and source
+	var groups [][]PriceRecord
+	for i := 0; i < len(sorted); {
+		j := i + 1
+		for j < len(sorted) && sorted[j].Currency == sorted[i].Currency && sorted[j].Source == sorted[i].Source {
+			j++
+		}
+		groups = append(groups, sorted[i:j])
+		i = j
+	}
+
+	unit := math.Pow10(scale)
+	aw := &archiveWriter{w: bufio.NewWriter(w)}
+	aw.w.WriteString(archiveMagic)
+	aw.w.WriteByte(archiveVersion)
+	aw.uvarint(uint64(scale))
+	aw.uvarint(uint64(len(sorted)))
+	aw.uvarint(uint64(len(groups)))
+	for _, group := range groups {
+		aw.str(group[0].Currency)
+		aw.str(group[0].Source)
+		aw.uvarint(uint64(len(group)))
+		var id, micros, units int64
+		for _, r := range group {
+			scaled := math.Round(r.Price * unit)
+			if math.Abs(scaled) > 1<<62 {
+				return fmt.Errorf("price %v of record %d doesn't fit in the archive at %d decimal places", r.Price, r.ID, scale)
+			}
+			ts := r.Timestamp.UnixMicro()
+			aw.varint(int64(r.ID) - id)
+			aw.varint(ts - micros)
+			aw.varint(int64(scaled) - units)
+			id, micros, units = int64(r.ID), ts, int64(scaled)
+		}
+	}
+	if aw.err != nil {
+		return aw.err
+	}
+	return aw.w.Flush()
+}
+
+// readArchiveHeader reads the scale and record count at the start of an archive
+func readArchiveHeader(br *bufio.Reader) (scale, count int, err error) {
+	magic := make([]byte, len(archiveMagic)+1)
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic[:len(archiveMagic)]) != archiveMagic {
+		return 0, 0, fmt.Errorf("not a price archive")
+	}
+	if magic[len(archiveMagic)] != archiveVersion {
+		return 0, 0, fmt.Errorf("unsupported archive version %d", magic[len(archiveMagic)])
+	}
+	s, err := binary.ReadUvarint(br)
+	if err != nil || s > maxPriceScale {
+		return 0, 0, fmt.Errorf("corrupt archive header")
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, 0, fmt.Errorf("corrupt archive header")
+	}
+	return int(s), int(n), nil
+}
+
+// readArchiveString reads a length-prefixed string
+func readArchiveString(br *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil || n > 255 {
+		return "", fmt.Errorf("corrupt archive string")
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(br, b)
+	return string(b), err
+}
+
+// decodeArchive reads records written by encodeArchive, in timestamp and ID order
+func decodeArchive(r io.Reader) ([]PriceRecord, error) {
+	br := bufio.NewReader(r)
+	scale, count, err := readArchiveHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt archive header")
+	}
+
+	unit := math.Pow10(scale)
+	records := make([]PriceRecord, 0, count)
+	for g := uint64(0); g < groups; g++ {
+		currency, err := readArchiveString(br)
+		if err != nil {
+			return nil, err
+		}
+		source, err := readArchiveString(br)
+		if err != nil {
+			return nil, err
+		}
+		n, err := binary.ReadUvarint(br)
+		if err != nil || len(records)+int(n) > count {
+			return nil, fmt.Errorf("corrupt archive group %s/%s", currency, source)
+		}
+		var id, micros, units int64
+		for i := uint64(0); i < n; i++ {
+			var deltas [3]int64
+			for k := range deltas {
+				if deltas[k], err = binary.ReadVarint(br); err != nil {
+					return nil, fmt.Errorf("truncated archive: %w", err)
+				}
+			}
+			id, micros, units = id+deltas[0], micros+deltas[1], units+deltas[2]
+			records = append(records, PriceRecord{
+				ID:        int(id),
+				Price:     float64(units) / unit,
+				Currency:  currency,
+				Source:    source,
+				Timestamp: time.UnixMicro(micros).UTC(),
+			})
+		}
+	}
+	if len(records) != count {
+		return nil, fmt.Errorf("corrupt archive: %d of %d records", len(records), count)
+	}
+	slices.SortFunc(records, comparePriceRecords)
+	return records, nil
+}
+
+// readArchiveFile decompresses and decodes an archive file
+func readArchiveFile(path string) ([]PriceRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	records, err := decodeArchive(gz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	// Reading to the end checks gzip's CRC
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return records, nil
+}
+
+// writeArchiveFile writes records to path, replacing it only once the new file has been
+// synced and read back identical to records
+func writeArchiveFile(path string, records []PriceRecord, scale int) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(tmp) // A no-op once renamed
+
+	gz, _ := gzip.NewWriterLevel(f, gzip.BestCompression)
+	err = encodeArchive(gz, records, scale)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	decoded, err := readArchiveFile(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to verify archive: %w", err)
+	}
+	want := slices.Clone(records)
+	slices.SortFunc(want, comparePriceRecords)
+	if !slices.EqualFunc(decoded, want, func(a, b PriceRecord) bool {
+		return a.ID == b.ID && a.Timestamp.Equal(b.Timestamp) && a.Currency == b.Currency && a.Source == b.Source &&
+			a.Price == b.Price
+	}) {
+		return fmt.Errorf("failed to verify archive: records read back differ from the database")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	forgetArchive(path)
+	return nil
+}
+
+// archiveCacheSize is how many decoded months the query layer keeps in memory
+const archiveCacheSize = 12
+
+// cachedArchive is a decoded archive file and the file version it was read from
+type cachedArchive struct {
+	modTime time.Time
+	size    int64
+	records []PriceRecord
+}
+
+// archiveCache holds recently read months, so paging through a range doesn't decode the
+// same file once per page
+var archiveCache = struct {
+	sync.Mutex
+	files map[string]cachedArchive
+}{files: map[string]cachedArchive{}}
+
+// loadArchive returns the records of an archive file, from the cache while it is unchanged
+// The returned slice is shared and must not be modified
+func loadArchive(path string) ([]PriceRecord, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	archiveCache.Lock()
+	c, ok := archiveCache.files[path]
+	archiveCache.Unlock()
+	if ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.records, nil
+	}
+
+	records, err := readArchiveFile(path)
+	if err != nil {
+		return nil, err
+	}
+	archiveCache.Lock()
+	defer archiveCache.Unlock()
+	if len(archiveCache.files) >= archiveCacheSize {
+		for p := range archiveCache.files {
+			delete(archiveCache.files, p)
+			break
+		}
+	}
+	archiveCache.files[path] = cachedArchive{modTime: info.ModTime(), size: info.Size(), records: records}
+	return records, nil
+}
+
+// forgetArchive drops a rewritten or removed file from the cache
+func forgetArchive(path string) {
+	archiveCache.Lock()
+	delete(archiveCache.files, path)
+	archiveCache.Unlock()
+}
+
+// archivedStore serves historical queries from the archive files as well as the database
+// Only reads of raw prices over a range consult the archive (PriceRange, and PriceStats
+// through it); everything else, including retention and dedupe, sees only the database.
+type archivedStore struct {
+	Store
+}
+
+// databaseStore returns the backend without the archive layer
+func databaseStore(repo *Repository) Store {
+	if a, ok := repo.Store.(*archivedStore); ok {
+		return a.Store
+	}
+	return repo.Store
+}
+
+// archivedMonthsIn returns the archived months overlapping [from, to), oldest first
+// A zero to leaves the range open-ended
+func archivedMonthsIn(from, to time.Time) ([]time.Time, error) {
+	months, err := archivedMonths(archiveConfig.Dir)
+	return slices.DeleteFunc(months, func(month time.Time) bool {
+		return !month.AddDate(0, 1, 0).After(from) || (!to.IsZero() && !month.Before(to))
+	}), err
+}
+
+// archivedPrices returns up to limit archived records in [from, to), oldest first
+// False when no archived month overlaps the range
+func archivedPrices(currency string, from, to time.Time, limit int) ([]PriceRecord, bool, error) {
+	months, err := archivedMonthsIn(from, to)
+	if err != nil || len(months) == 0 {
+		return nil, false, err
+	}
+	currency = strings.ToLower(currency)
+
+	var prices []PriceRecord
+	for _, month := range months {
+		records, err := loadArchive(archivePath(archiveConfig.Dir, month))
+		if err != nil {
+			return nil, true, err
+		}
+		for _, r := range records {
+			if (currency == "" || r.Currency == currency) && !r.Timestamp.Before(from) && (to.IsZero() || r.Timestamp.Before(to)) {
+				prices = append(prices, r)
+			}
+		}
+		// Later months only hold later records
+		if len(prices) >= limit {
+			return prices[:limit], true, nil
+		}
+	}
+	return prices, true, nil
+}
+
+// PriceRange implements Store, merging archived months into the range
+func (s *archivedStore) PriceRange(currency string, from, to time.Time, limit int) ([]PriceRecord, error) {
+	archived, ok, err := archivedPrices(currency, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := s.Store.PriceRange(currency, from, to, limit)
+	if err != nil || !ok {
+		return stored, err
+	}
+	merged := mergePriceRecords(archived, stored)
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged, nil
+}
+
+// PriceStats implements Store
+// Ranges reaching into archived months are aggregated here rather than in SQL
+func (s *archivedStore) PriceStats(ctx context.Context, currency string, from, to time.Time) (PriceStats, error) {
+	months, err := archivedMonthsIn(from, to)
+	if err != nil {
+		return PriceStats{}, err
+	}
+	if len(months) == 0 {
+		return s.Store.PriceStats(ctx, currency, from, to)
+	}
+
+	var prices []float64
+	err = forEachPriceIn(s, currency, from, to, func(r PriceRecord) error {
+		prices = append(prices, r.Price)
+		return ctx.Err()
+	})
+	if err != nil {
+		return PriceStats{}, err
+	}
+	return summarizePrices(prices), nil
+}
+
+// HistoricalPriceExtremes implements Store, looking through the archived months too
+func (s *archivedStore) HistoricalPriceExtremes(ctx context.Context, currency string) (PriceExtremes, bool, error) {
+	e, ok, err := s.Store.HistoricalPriceExtremes(ctx, currency)
+	if err != nil {
+		return e, ok, err
+	}
+	months, err := archivedMonthsIn(time.Time{}, time.Time{})
+	if err != nil || len(months) == 0 {
+		return e, ok, err
+	}
+	from, to := months[0], months[len(months)-1].AddDate(0, 1, 0)
+	err = forEachPriceIn(s, currency, from, to, func(r PriceRecord) error {
+		if !ok || r.Price > e.High {
+			e.High, e.HighAt = r.Price, r.Timestamp
+		}
+		if !ok || r.Price < e.Low {
+			e.Low, e.LowAt = r.Price, r.Timestamp
+		}
+		ok = true
+		return ctx.Err()
+	})
+	return e, ok, err
+}
+
+// summarizePrices computes the figures PriceStats aggregates in SQL from prices in time order
+func summarizePrices(prices []float64) PriceStats {
+	stats := PriceStats{Samples: len(prices)}
+	if len(prices) == 0 {
+		return stats
+	}
+	stats.First, stats.Last = prices[0], prices[len(prices)-1]
+
+	sorted := slices.Clone(prices)
+	slices.Sort(sorted)
+	stats.Min, stats.Max = sorted[0], sorted[len(sorted)-1]
+	if mid := len(sorted) / 2; len(sorted)%2 == 1 {
+		stats.Median = sorted[mid]
+	} else {
+		stats.Median = (sorted[mid-1] + sorted[mid]) / 2
+	}
+
+	sum := 0.0
+	for _, p := range prices {
+		sum += p
+	}
+	stats.Mean = sum / float64(len(prices))
+	if len(prices) > 1 {
+		squares := 0.0
+		for _, p := range prices {
+			squares += (p - stats.Mean) * (p - stats.Mean)
+		}
+		stats.StdDev = math.Sqrt(squares / float64(len(prices)-1))
+	}
+	return stats
+}
+
+// ArchivedMonth is what archiving one month did, or would do in a dry run
+type ArchivedMonth struct {
+	Month  time.Time
+	Moved  int   // Rows moved out of the database
+	Stored int   // Records in the archive file afterwards
+	Bytes  int64 // Size of the archive file
+}
+
+// archivePrices moves every price recorded before cutoff (the start of a month) into
+// one archive file per month. A month is deleted from the database only after its file
+// has been written and read back; rows added to an archived month later, e.g. by a
+// backfill, are merged into the existing file on the next run.
+func archivePrices(repo *Repository, cutoff time.Time, dryRun bool) ([]ArchivedMonth, error) {
+	db := databaseStore(repo)
+	oldest, err := db.PriceRange("", time.Time{}, cutoff, 1)
+	if err != nil || len(oldest) == 0 {
+		return nil, err
+	}
+	if !dryRun {
+		if err := os.MkdirAll(archiveConfig.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	}
+
+	var done []ArchivedMonth
+	for month := monthStart(oldest[0].Timestamp); month.Before(cutoff); month = month.AddDate(0, 1, 0) {
+		next := month.AddDate(0, 1, 0)
+		var records []PriceRecord
+		maxID := 0
+		err := forEachPriceIn(db, "", month, next, func(r PriceRecord) error {
+			records = append(records, r)
+			maxID = max(maxID, r.ID)
+			return nil
+		})
+		if err != nil {
+			return done, err
+		}
+		if len(records) == 0 {
+			continue
+		}
+		result := ArchivedMonth{Month: month, Moved: len(records)}
+		if dryRun {
+			done = append(done, result)
+			continue
+		}
+
+		path := archivePath(archiveConfig.Dir, month)
+		if _, err := os.Stat(path); err == nil {
+			existing, err := readArchiveFile(path)
+			if err != nil {
+				return done, err
+			}
+			records = mergePriceRecords(existing, records)
+		}
+		if err := writeArchiveFile(path, records, widestPriceScale()); err != nil {
+			return done, fmt.Errorf("failed to archive %s: %w", month.Format(archiveMonthLayout), err)
+		}
+		if result.Moved, err = db.DeletePrices(month, next, maxID); err != nil {
+			return done, err
+		}
+		result.Stored = len(records)
+		if info, err := os.Stat(path); err == nil {
+			result.Bytes = info.Size()
+		}
+		slog.Info("Archived prices", "month", month.Format(archiveMonthLayout), "moved", result.Moved,
+			"records", result.Stored, "bytes", result.Bytes, "file", path)
+		done = append(done, result)
+	}
+	return done, nil
+}
+
+// restoreArchive moves an archived month back into the database and removes its file
+// Restored rows get new IDs; any already stored for the same currency and minute are skipped
+func restoreArchive(repo *Repository, month time.Time) (int, error) {
+	path := archivePath(archiveConfig.Dir, month)
+	records, err := readArchiveFile(path)
+	if err != nil {
+		return 0, err
+	}
+	inserted, err := databaseStore(repo).SaveHistoricalPrices(context.Background(), records)
+	if err != nil {
+		return 0, err
+	}
+	forgetArchive(path)
+	if err := os.Remove(path); err != nil {
+		return inserted, fmt.Errorf("failed to remove restored archive: %w", err)
+	}
+	return inserted, nil
+}
+
+// listArchives prints every archive file with its record count and size
+func listArchives() error {
+	months, err := archivedMonths(archiveConfig.Dir)
+	if err != nil {
+		return err
+	}
+	if len(months) == 0 {
+		fmt.Printf("No archived prices in %s\n", archiveConfig.Dir)
+		return nil
+	}
+
+	fmt.Printf("\nArchived Prices (%s)\n", archiveConfig.Dir)
+	fmt.Println("------------------------------------------------------------")
+	fmt.Printf("%-8s %10s %12s %14s\n", "Month", "Records", "Size", "Bytes/Record")
+	for _, month := range months {
+		path := archivePath(archiveConfig.Dir, month)
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		count := 0
+		gz, err := gzip.NewReader(f)
+		if err == nil {
+			_, count, err = readArchiveHeader(bufio.NewReader(gz))
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		perRecord := 0.0
+		if count > 0 {
+			perRecord = float64(info.Size()) / float64(count)
+		}
+		fmt.Printf("%-8s %10d %12d %14.2f\n", month.Format(archiveMonthLayout), count, info.Size(), perRecord)
+	}
+	fmt.Println()
+	return nil
+}
+
+// runArchiveCommand handles "archive [list]", "archive create [--months N] [--dry-run]",
+// and "archive restore YYYY-MM"
+func runArchiveCommand(repo *Repository, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return listArchives()
+	}
+
+	switch args[0] {
+	case "create":
+		fs := newFlagSet("archive create")
+		months := fs.Int("months", archiveConfig.After, "Archive whole months older than this many months")
+		dryRun := fs.Bool("dry-run", false, "Only report what would be archived")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if *months < 1 {
+			return fmt.Errorf("--months must be at least 1")
+		}
+
+		cutoff := monthStart(time.Now()).AddDate(0, -*months, 0)
+		done, err := archivePrices(repo, cutoff, *dryRun)
+		if *dryRun {
+			fmt.Printf("\nArchive before %s (dry run, nothing changed)\n", cutoff.Format("2006-01-02"))
+		} else {
+			fmt.Printf("\nArchive before %s into %s\n", cutoff.Format("2006-01-02"), archiveConfig.Dir)
+		}
+		fmt.Println("------------------------------------------------------------")
+		fmt.Printf("%-8s %10s %10s %12s\n", "Month", "Moved", "Records", "Size")
+		for _, m := range done {
+			fmt.Printf("%-8s %10d %10d %12d\n", m.Month.Format(archiveMonthLayout), m.Moved, m.Stored, m.Bytes)
+		}
+		if len(done) == 0 {
+			fmt.Println("Nothing to archive")
+		}
+		fmt.Println()
+		return err
+	case "restore":
+		if len(args) != 2 {
+			return validationErrorf("usage: archive restore YYYY-MM")
+		}
+		month, err := time.Parse(archiveMonthLayout, args[1])
+		if err != nil {
+			return fmt.Errorf("invalid month %q (expected YYYY-MM)", args[1])
+		}
+		inserted, err := restoreArchive(repo, month)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Restored %d prices from %s\n", inserted, args[1])
+		return nil
+	default:
+		return validationErrorf("unknown archive command %q (expected list, create, or restore)", args[0])
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"      // Package for formatted errors
+	"net/http" // Package for the attribution header
+	"os"       // Package for environment variables
+	"slices"   // Package for sorting and deduplicating providers
+	"strconv"  // Package for parsing ATTRIBUTION
+	"strings"  // Package for splitting source lists
+)
+
+// Some providers' terms require crediting them wherever their data is shown; CoinGecko's
+// free API does. Every stored price records the provider that supplied it in its
+// source, and API responses, exports, reports, and charts credit those providers.
+
+// attributionHeader names the providers behind an API response
+const attributionHeader = "X-Data-Attribution"
+
+// Attribution is how a provider asks to be credited
+type Attribution struct {
+	Provider string `json:"provider"` // Source name, as in PRICE_SOURCES
+	Name     string `json:"name"`     // Display name, e.g. "CoinGecko"
+	Text     string `json:"text"`     // Credit line, e.g. "Data provided by CoinGecko"
+	URL      string `json:"url"`      // Page the credit links to
+}
+
+// String formats the credit line with its link
+func (a Attribution) String() string {
+	return a.Text + " (" + a.URL + ")"
+}
+
+// providerAttributions holds the credit each provider's terms ask for
+var providerAttributions = map[string]Attribution{
+	"coingecko": {Provider: "coingecko", Name: "CoinGecko", Text: "Data provided by CoinGecko", URL: "https://www.coingecko.com"},
+	"coinbase":  {Provider: "coinbase", Name: "Coinbase", Text: "Prices from Coinbase", URL: "https://www.coinbase.com"},
+	"binance":   {Provider: "binance", Name: "Binance", Text: "Prices from Binance", URL: "https://www.binance.com"},
+	"kraken":    {Provider: "kraken", Name: "Kraken", Text: "Prices from Kraken", URL: "https://www.kraken.com"},
+	// Not a price provider: the Fear & Greed index of FEAR_GREED
+	fearGreedSource: {Provider: fearGreedSource, Name: "Alternative.me", Text: "Fear & Greed Index by Alternative.me", URL: "https://alternative.me/crypto/fear-and-greed-index/"},
+}
+
+// attributionEnabled adds credit lines to exports, reports, and charts; the API header
+// is always sent. Configured via ATTRIBUTION (default true).
+var attributionEnabled = true
+
+// loadAttributionConfig reads ATTRIBUTION
+func loadAttributionConfig() (bool, error) {
+	v := os.Getenv("ATTRIBUTION")
+	if v == "" {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return true, fmt.Errorf("invalid ATTRIBUTION %q", v)
+	}
+	return b, nil
+}
+
+// attributionsFor returns the credit owed for data from sources, ordered by provider.
+// Sources may be lists like "coingecko,kraken"; downsampled averages (e.g. "avg-1h")
+// and data without a source are credited to the configured PRICE_SOURCES.
+func attributionsFor(sources []string) []Attribution {
+	var providers []string
+	add := func(name string) {
+		if !slices.Contains(providers, name) {
+			providers = append(providers, name)
+		}
+	}
+	configured := len(sources) == 0
+	for _, source := range sources {
+		for _, name := range strings.Split(source, ",") {
+			if name == "" || strings.HasPrefix(name, "avg-") {
+				configured = true
+				continue
+			}
+			add(name)
+		}
+	}
+	if configured {
+		for _, source := range priceSources {
+			add(source.Name())
+		}
+	}
+	slices.Sort(providers)
+
+	var list []Attribution
+	for _, name := range providers {
+		if a, ok := providerAttributions[name]; ok {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// recordSources returns the sources of records, each once
+func recordSources(records []PriceRecord) []string {
+	var sources []string
+	for _, r := range records {
+		if !slices.Contains(sources, r.Source) {
+			sources = append(sources, r.Source)
+		}
+	}
+	return sources
+}
+
+// attributionText joins the credit lines of list, e.g. "Data provided by CoinGecko
+// (https://www.coingecko.com)"; empty when nothing is owed
+func attributionText(list []Attribution) string {
+	lines := make([]string, len(list))
+	for i, a := range list {
+		lines[i] = a.String()
+	}
+	return strings.Join(lines, "; ")
+}
+
+// attributionCredit returns a short credit for charts, e.g. "Data: CoinGecko"; empty
+// when nothing is owed or ATTRIBUTION is off
+func attributionCredit(list []Attribution) string {
+	if !attributionEnabled || len(list) == 0 {
+		return ""
+	}
+	names := make([]string, len(list))
+	for i, a := range list {
+		names[i] = a.Name
+	}
+	return "Data: " + strings.Join(names, ", ")
+}
+
+// setAttribution sets the attribution header of a response carrying data from sources
+func setAttribution(w http.ResponseWriter, sources []string) {
+	if text := attributionText(attributionsFor(sources)); text != "" {
+		w.Header().Set(attributionHeader, text)
+	} else {
+		w.Header().Del(attributionHeader)
+	}
+}
+
+// withAttribution credits the configured PRICE_SOURCES on every response; handlers
+// that know which providers supplied their data narrow it down with setAttribution
+func withAttribution(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setAttribution(w, nil)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bufio"         // Package for reading the shared credentials file
+	"bytes"         // Package for request bodies
+	"crypto/hmac"   // Package for SigV4 signing
+	"crypto/sha256" // Package for SigV4 hashing
+	"encoding/hex"  // Package for hex-encoding signatures
+	"encoding/json" // Package for EventBridge requests and credential responses
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for reading responses
+	"net/http"      // Package for AWS API calls
+	"net/url"       // Package for SNS form encoding and presigned URLs
+	"os"            // Package for environment variables and files
+	"path/filepath" // Package for locating ~/.aws/credentials
+	"sort"          // Package for canonical header ordering
+	"strconv"       // Package for presigned URL lifetimes
+	"strings"       // Package for string manipulation
+	"sync"          // Package for caching credentials
+	"time"          // Package for signing dates and credential expiry
+)
+
+// awsCredentials are the keys used to sign requests
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time // Zero for static credentials
+}
+
+// awsCredentialCache holds credentials resolved from the chain until shortly before they expire
+var awsCredentialCache struct {
+	mu    sync.Mutex
+	creds *awsCredentials
+}
+
+// resolveAWSCredentials walks the standard credential chain:
+// environment variables, the shared credentials file, ECS container credentials,
+// and finally the EC2 instance metadata service (IMDSv2)
+func resolveAWSCredentials() (*awsCredentials, error) {
+	awsCredentialCache.mu.Lock()
+	defer awsCredentialCache.mu.Unlock()
+
+	if c := awsCredentialCache.creds; c != nil && (c.Expires.IsZero() || time.Until(c.Expires) > 5*time.Minute) {
+		return c, nil
+	}
+
+	providers := []func() (*awsCredentials, error){
+		awsEnvCredentials,
+		awsSharedFileCredentials,
+		awsContainerCredentials,
+		awsInstanceCredentials,
+	}
+
+	var errs []string
+	for _, provider := range providers {
+		creds, err := provider()
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		awsCredentialCache.creds = creds
+		return creds, nil
+	}
+	return nil, fmt.Errorf("no AWS credentials found: %s", strings.Join(errs, "; "))
+}
+
+// awsEnvCredentials reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN
+func awsEnvCredentials() (*awsCredentials, error) {
+	id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id == "" || secret == "" {
+		return nil, fmt.Errorf("env: AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY not set")
+	}
+	return &awsCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+}
+
+// awsSharedFileCredentials reads the AWS_PROFILE section of ~/.aws/credentials
+// (or AWS_SHARED_CREDENTIALS_FILE)
+func awsSharedFileCredentials() (*awsCredentials, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("shared file: %w", err)
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("shared file: %w", err)
+	}
+	defer file.Close()
+
+	// The file is INI formatted: [profile] sections with key = value lines
+	creds := &awsCredentials{}
+	inProfile := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+			continue
+		}
+		if !inProfile {
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, "=")
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("shared file: %w", err)
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("shared file: profile %q has no keys", profile)
+	}
+	return creds, nil
+}
+
+// awsTemporaryCredentials is the JSON returned by the ECS and EC2 credential endpoints
+type awsTemporaryCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// metadataClient talks to link-local credential endpoints, which answer quickly or not at all
+var metadataClient = &http.Client{Timeout: 2 * time.Second}
+
+// awsContainerCredentials fetches task role credentials on ECS/Fargate
+func awsContainerCredentials() (*awsCredentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+		endpoint = "http://169.254.170.2" + rel
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("container: not running on ECS")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("container: %w", err)
+	}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return fetchTemporaryCredentials(req, "container")
+}
+
+// awsInstanceCredentials fetches instance profile credentials from EC2 IMDSv2
+func awsInstanceCredentials() (*awsCredentials, error) {
+	const imds = "http://169.254.169.254"
+
+	// IMDSv2 requires a session token obtained with a PUT
+	tokenReq, _ := http.NewRequest(http.MethodPut, imds+"/latest/api/token", nil)
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	resp, err := metadataClient.Do(tokenReq)
+	if err != nil {
+		return nil, fmt.Errorf("instance: metadata service unavailable")
+	}
+	token, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	roleReq, _ := http.NewRequest(http.MethodGet, imds+"/latest/meta-data/iam/security-credentials/", nil)
+	roleReq.Header.Set("X-aws-ec2-metadata-token", string(token))
+	resp, err = metadataClient.Do(roleReq)
+	if err != nil {
+		return nil, fmt.Errorf("instance: %w", err)
+	}
+	role, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(role) == 0 {
+		return nil, fmt.Errorf("instance: no IAM role attached")
+	}
+
+	credReq, _ := http.NewRequest(http.MethodGet,
+		imds+"/latest/meta-data/iam/security-credentials/"+strings.TrimSpace(string(role)), nil)
+	credReq.Header.Set("X-aws-ec2-metadata-token", string(token))
+	return fetchTemporaryCredentials(credReq, "instance")
+}
+
+// fetchTemporaryCredentials performs a credential endpoint request and decodes the result
+func fetchTemporaryCredentials(req *http.Request, provider string) (*awsCredentials, error) {
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: credentials endpoint returned status %d", provider, resp.StatusCode)
+	}
+
+	var tmp awsTemporaryCredentials
+	if err := json.NewDecoder(resp.Body).Decode(&tmp); err != nil {
+		return nil, fmt.Errorf("%s: failed to parse credentials: %w", provider, err)
+	}
+	return &awsCredentials{
+		AccessKeyID:     tmp.AccessKeyID,
+		SecretAccessKey: tmp.SecretAccessKey,
+		SessionToken:    tmp.Token,
+		Expires:         tmp.Expiration,
+	}, nil
+}
+
+// awsRegion returns the region from an ARN if possible, else from AWS_REGION/AWS_DEFAULT_REGION
+func awsRegion(arn string) string {
+	// ARN format: arn:partition:service:region:account:resource
+	if parts := strings.Split(arn, ":"); len(parts) > 3 && parts[0] == "arn" && parts[3] != "" {
+		return parts[3]
+	}
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		return r
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// hmacSHA256 returns HMAC-SHA256(key, data)
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signAWSRequest adds Signature Version 4 headers to req, signed at now
+// Only the headers present at call time (plus host and x-amz-*) are signed
+func signAWSRequest(req *http.Request, body []byte, service, region string, creds *awsCredentials, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Canonical headers: lowercase names, sorted, with trimmed values
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signature := hex.EncodeToString(hmacSHA256(awsSigningKey(creds, date, region, service), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// awsSigningKey derives the SigV4 signing key for a date, region, and service
+func awsSigningKey(creds *awsCredentials, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// presignAWSURL returns u with SigV4 query parameters that let whoever holds the URL
+// make a method request until expires after now, like "aws s3 presign". Only the host
+// is signed and the payload isn't, so the URL works from any client.
+func presignAWSURL(method string, u *url.URL, service, region string, creds *awsCredentials, now time.Time, expires time.Duration) string {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if creds.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	// SigV4 wants spaces as %20, where url.Values writes +
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	signature := hex.EncodeToString(hmacSHA256(awsSigningKey(creds, date, region, service), stringToSign))
+
+	return u.Scheme + "://" + u.Host + u.EscapedPath() + "?" + canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+// doAWSRequest signs and sends a POST to an AWS service endpoint, returning the response body
+func doAWSRequest(service, region string, body []byte, headers map[string]string) ([]byte, error) {
+	if region == "" {
+		return nil, fmt.Errorf("AWS region not configured (set AWS_REGION)")
+	}
+
+	creds, err := resolveAWSCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", service, err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	signAWSRequest(req, body, service, region, creds, time.Now())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", service, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d: %s", service, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// snsSink publishes events to an SNS topic
+// FIFO topics get the event subject as message group, preserving per-asset ordering
+type snsSink struct {
+	topicARN string
+}
+
+// Name identifies the sink in logs
+func (s snsSink) Name() string { return "sns " + s.topicARN }
+
+// Publish implements EventSink
+func (s snsSink) Publish(e Event) error {
+	message, _, _, err := encodeEvent(e)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	form.Set("Action", "Publish")
+	form.Set("Version", "2010-03-31")
+	form.Set("TopicArn", s.topicARN)
+	form.Set("Message", string(message))
+
+	// Attributes let subscribers filter on event type without parsing the body
+	form.Set("MessageAttributes.entry.1.Name", "event_type")
+	form.Set("MessageAttributes.entry.1.Value.DataType", "String")
+	form.Set("MessageAttributes.entry.1.Value.StringValue", e.Type)
+	form.Set("MessageAttributes.entry.2.Name", "subject")
+	form.Set("MessageAttributes.entry.2.Value.DataType", "String")
+	form.Set("MessageAttributes.entry.2.Value.StringValue", e.Subject)
+
+	if strings.HasSuffix(s.topicARN, ".fifo") {
+		form.Set("MessageGroupId", e.Subject)
+		form.Set("MessageDeduplicationId", e.ID)
+	}
+
+	body := []byte(form.Encode())
+	_, err = doAWSRequest("sns", awsRegion(s.topicARN), body, map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded; charset=utf-8",
+	})
+	return err
+}
+
+// eventBridgeSink puts events on an EventBridge bus
+type eventBridgeSink struct {
+	bus    string // Bus name or ARN
+	source string // EventBridge "Source" field used for rule matching
+}
+
+// Name identifies the sink in logs
+func (s eventBridgeSink) Name() string { return "eventbridge " + s.bus }
+
+// Publish implements EventSink
+func (s eventBridgeSink) Publish(e Event) error {
+	detail, _, _, err := encodeEvent(e)
+	if err != nil {
+		return err
+	}
+
+	request := map[string]interface{}{
+		"Entries": []map[string]interface{}{{
+			"EventBusName": s.bus,
+			"Source":       s.source,
+			"DetailType":   e.Type,
+			"Detail":       string(detail),
+			"Time":         e.Time.Unix(),
+		}},
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode PutEvents request: %w", err)
+	}
+
+	respBody, err := doAWSRequest("events", awsRegion(s.bus), body, map[string]string{
+		"Content-Type": "application/x-amz-json-1.1",
+		"X-Amz-Target": "AWSEvents.PutEvents",
+	})
+	if err != nil {
+		return err
+	}
+
+	// PutEvents reports per-entry failures in a 200 response
+	var result struct {
+		FailedEntryCount int `json:"FailedEntryCount"`
+		Entries          []struct {
+			ErrorCode    string `json:"ErrorCode"`
+			ErrorMessage string `json:"ErrorMessage"`
+		} `json:"Entries"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("failed to parse PutEvents response: %w", err)
+	}
+	if result.FailedEntryCount > 0 && len(result.Entries) > 0 {
+		return fmt.Errorf("eventbridge rejected event: %s: %s", result.Entries[0].ErrorCode, result.Entries[0].ErrorMessage)
+	}
+	return nil
+}
+
+// loadAWSSinks returns the SNS and EventBridge sinks configured via
+// AWS_SNS_TOPIC_ARN, AWS_EVENTBRIDGE_BUS, and AWS_EVENTBRIDGE_SOURCE
+func loadAWSSinks() []EventSink {
+	var sinks []EventSink
+	if arn := os.Getenv("AWS_SNS_TOPIC_ARN"); arn != "" {
+		sinks = append(sinks, snsSink{topicARN: arn})
+	}
+	if bus := os.Getenv("AWS_EVENTBRIDGE_BUS"); bus != "" {
+		source := os.Getenv("AWS_EVENTBRIDGE_SOURCE")
+		if source == "" {
+			source = "bitcoin-tracker"
+		}
+		sinks = append(sinks, eventBridgeSink{bus: bus, source: source})
+	}
+	return sinks
+}
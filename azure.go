@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"           // Package for request bodies
+	"crypto/hmac"     // Package for SAS token signing
+	"crypto/sha256"   // Package for SAS token signing
+	"encoding/base64" // Package for SAS keys and signatures
+	"encoding/json"   // Package for broker properties
+	"fmt"             // Package for formatted I/O operations
+	"io"              // Package for reading error responses
+	"net/http"        // Package for the Service Bus REST API
+	"net/url"         // Package for SAS token encoding
+	"os"              // Package for environment variables
+	"strconv"         // Package for SAS expiry timestamps
+	"strings"         // Package for connection string parsing
+	"time"            // Package for SAS token expiry
+)
+
+// azureConnection is a parsed Event Hubs / Service Bus connection string
+// e.g. "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=...;EntityPath=ticks"
+type azureConnection struct {
+	Namespace string // Host name, e.g. ns.servicebus.windows.net
+	KeyName   string // Shared access policy name
+	Key       string // Shared access policy key
+	Entity    string // Event hub, queue, or topic name
+}
+
+// parseAzureConnectionString parses a connection string copied from the Azure portal
+func parseAzureConnectionString(s string) (azureConnection, error) {
+	var c azureConnection
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "endpoint":
+			u, err := url.Parse(value)
+			if err != nil {
+				return c, fmt.Errorf("invalid Endpoint %q", value)
+			}
+			c.Namespace = u.Host
+		case "sharedaccesskeyname":
+			c.KeyName = value
+		case "sharedaccesskey":
+			c.Key = value
+		case "entitypath":
+			c.Entity = value
+		}
+	}
+
+	if c.Namespace == "" || c.KeyName == "" || c.Key == "" {
+		return c, fmt.Errorf("connection string needs Endpoint, SharedAccessKeyName, and SharedAccessKey")
+	}
+	return c, nil
+}
+
+// sasToken creates a shared access signature for a resource URI, valid for one hour
+func (c azureConnection) sasToken(resource string) string {
+	encoded := url.QueryEscape(strings.ToLower(resource))
+	expiry := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(c.Key))
+	mac.Write([]byte(encoded + "\n" + expiry))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s",
+		encoded, url.QueryEscape(signature), expiry, url.QueryEscape(c.KeyName))
+}
+
+// azureSink sends events to an Event Hub or a Service Bus queue/topic
+// Both services accept messages over the same REST endpoint; they differ in
+// how messages are routed, which is set through the BrokerProperties header.
+type azureSink struct {
+	service string // "eventhubs" or "servicebus"
+	conn    azureConnection
+}
+
+// Name identifies the sink in logs
+func (s azureSink) Name() string { return s.service + " " + s.conn.Namespace + "/" + s.conn.Entity }
+
+// Publish implements EventSink
+func (s azureSink) Publish(e Event) error {
+	body, contentType, attrs, err := encodeEvent(e)
+	if err != nil {
+		return err
+	}
+
+	resource := "https://" + s.conn.Namespace + "/" + s.conn.Entity
+	req, err := http.NewRequest(http.MethodPost, resource+"/messages?timeout=60", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", s.service, err)
+	}
+	req.Header.Set("Authorization", s.conn.sasToken(resource))
+	req.Header.Set("Content-Type", contentType)
+
+	// Event Hubs hashes the partition key, so each asset lands on one partition and
+	// stays ordered. Service Bus uses the event ID for duplicate detection and the
+	// type as label so subscriptions can filter on it.
+	broker := map[string]string{}
+	if s.service == "eventhubs" {
+		broker["PartitionKey"], _, _ = strings.Cut(e.Subject, "/")
+	} else {
+		broker["MessageId"] = e.ID
+		broker["Label"] = e.Type
+		broker["ContentType"] = contentType
+	}
+	brokerJSON, _ := json.Marshal(broker)
+	req.Header.Set("BrokerProperties", string(brokerJSON))
+
+	// Other request headers become custom message properties. They are assigned
+	// directly so the names keep their case, and string values must be quoted.
+	req.Header["event_type"] = []string{strconv.Quote(e.Type)}
+	req.Header["subject"] = []string{strconv.Quote(e.Subject)}
+	for k, v := range attrs {
+		req.Header["ce-"+k] = []string{strconv.Quote(v)}
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", s.service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s returned status %d: %s", s.service, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// loadAzureSinks returns the Event Hubs and Service Bus sinks configured via
+// AZURE_EVENTHUB_CONNECTION_STRING / AZURE_EVENTHUB_NAME and
+// AZURE_SERVICEBUS_CONNECTION_STRING / AZURE_SERVICEBUS_ENTITY
+func loadAzureSinks() ([]EventSink, error) {
+	configs := []struct {
+		service   string
+		connEnv   string
+		entityEnv string
+	}{
+		{"eventhubs", "AZURE_EVENTHUB_CONNECTION_STRING", "AZURE_EVENTHUB_NAME"},
+		{"servicebus", "AZURE_SERVICEBUS_CONNECTION_STRING", "AZURE_SERVICEBUS_ENTITY"},
+	}
+
+	var sinks []EventSink
+	for _, cfg := range configs {
+		v := os.Getenv(cfg.connEnv)
+		if v == "" {
+			continue
+		}
+
+		conn, err := parseAzureConnectionString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", cfg.connEnv, err)
+		}
+		// Namespace-level connection strings have no EntityPath
+		if entity := os.Getenv(cfg.entityEnv); entity != "" {
+			conn.Entity = entity
+		}
+		if conn.Entity == "" {
+			return nil, fmt.Errorf("%s has no EntityPath; set %s", cfg.connEnv, cfg.entityEnv)
+		}
+		sinks = append(sinks, azureSink{service: cfg.service, conn: conn})
+	}
+	return sinks, nil
+}
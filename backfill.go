@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"  // Package for cancelling a running backfill
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"strings"  // Package for string manipulation
+	"time"     // Package for range boundaries and pacing
+)
+
+// backfillChunk is the span requested per CoinGecko call
+// market_chart/range returns hourly points for spans of up to 90 days and only daily
+// points beyond that, so longer ranges are split into 90-day requests
+const backfillChunk = 90 * 24 * time.Hour
+
+// backfillDelay is the pause between CoinGecko calls, keeping a long backfill
+// under the public API's per-minute rate limit
+const backfillDelay = 6 * time.Second
+
+// backfillSource is the source name stored with backfilled records
+const backfillSource = "coingecko"
+
+// fetchCoinGeckoHistory returns the prices CoinGecko has for asset in [from, to], oldest first
+func fetchCoinGeckoHistory(ctx context.Context, repo *Repository, asset, currency string, from, to time.Time) ([]PriceRecord, error) {
+	coin, err := marketSymbol(ctx, repo, backfillSource, asset, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Response format: {"prices": [[1609459200000, 29022.67], ...], "market_caps": [...], ...}
+	url := fmt.Sprintf("%s/coins/%s/market_chart/range?vs_currency=%s&from=%d&to=%d",
+		coinGeckoAPI.BaseURL(), coin.Symbol, currency, from.Unix(), to.Unix())
+
+	var data struct {
+		Prices [][2]float64 `json:"prices"` // [unix milliseconds, price]
+	}
+	if err := getJSON(captureRawResponses(ctx), repo, backfillSource, asset, url, &data); err != nil {
+		return nil, err
+	}
+
+	records := make([]PriceRecord, 0, len(data.Prices))
+	for _, point := range data.Prices {
+		if point[1] <= 0 {
+			continue // CoinGecko occasionally reports gaps as zero
+		}
+		records = append(records, PriceRecord{
+			Price:     point[1],
+			Currency:  currency,
+			Source:    backfillSource,
+			Timestamp: time.UnixMilli(int64(point[0])).UTC(),
+		})
+	}
+	return records, nil
+}
+
+// parseTimeFlag parses a --from/--to value: "now", a date, or an RFC 3339 timestamp
+func parseTimeFlag(name, v string) (time.Time, error) {
+	if strings.EqualFold(v, "now") {
+		return time.Now(), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, displayLocation); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, validationErrorf("invalid --%s %q (expected now, YYYY-MM-DD, or RFC 3339)", name, v)
+}
+
+// sleepContext waits for d, returning early with ctx's error if it is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backfillCurrency imports CoinGecko history for one currency and returns the number of new rows
+// Records are written by a priceWriter in batches of WRITE_BATCH_SIZE, and whatever was
+// fetched is written before it returns, also when the backfill stops early. progress, when
+// not nil, is told how far the import has got after each chunk.
+func backfillCurrency(ctx context.Context, repo *Repository, currency string, from, to time.Time, progress func(through time.Time)) (inserted int, err error) {
+	writer := newPriceWriter(ctx, repo, "backfill", writeBatchConfig.Size, writeBatchConfig.Interval, nil)
+	defer func() {
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+		inserted = writer.Inserted()
+	}()
+
+	for start := from; start.Before(to); start = start.Add(backfillChunk) {
+		end := start.Add(backfillChunk)
+		if end.After(to) {
+			end = to
+		}
+
+		// Pace requests; the first one goes out immediately
+		if !start.Equal(from) {
+			if err := sleepContext(ctx, backfillDelay); err != nil {
+				return 0, err
+			}
+		}
+
+		var records []PriceRecord
+		err := withRetry(ctx, "Backfill fetch", func() error {
+			if err := checkBudget(repo, "bitcoin"); err != nil {
+				return err
+			}
+			var err error
+			records, err = fetchCoinGeckoHistory(ctx, repo, "bitcoin", currency, start, end)
+			return err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch %s history for %s to %s: %w",
+				strings.ToUpper(currency), start.Format("2006-01-02"), end.Format("2006-01-02"), err)
+		}
+
+		if err := writer.Add(records...); err != nil {
+			return 0, err
+		}
+
+		slog.Info("Backfilled price history", "coin", "bitcoin", "currency", currency,
+			"from", start.Format("2006-01-02"), "to", end.Format("2006-01-02"), "points", len(records))
+		if progress != nil {
+			progress(end)
+		}
+	}
+	return 0, nil // The deferred Close fills in the count
+}
+
+// runBackfillCommand handles "backfill --from 2021-01-01 [--to now]"
+// Prices for every configured currency are imported from CoinGecko, then candles,
+// volatility regimes, and price levels are rebuilt so the imported history shows up everywhere
+func runBackfillCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("backfill")
+	fromFlag := fs.String("from", "", "Start of the range: YYYY-MM-DD or RFC 3339 (required)")
+	toFlag := fs.String("to", "now", "End of the range: now, YYYY-MM-DD, or RFC 3339")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if *fromFlag == "" {
+		return validationErrorf("usage: backfill --from YYYY-MM-DD [--to now|YYYY-MM-DD]")
+	}
+
+	from, err := parseTimeFlag("from", *fromFlag)
+	if err != nil {
+		return err
+	}
+	to, err := parseTimeFlag("to", *toFlag)
+	if err != nil {
+		return err
+	}
+	if now := time.Now(); to.After(now) {
+		to = now
+	}
+	if !from.Before(to) {
+		return fmt.Errorf("--from must be before --to")
+	}
+
+	_, err = backfillCurrencies(ctx, repo, currencies, from, to, nil)
+	return err
+}
+
+// backfillCurrencies imports CoinGecko history for each of list in turn, rebuilding each
+// one's derived data after it, and returns the number of new rows. progress, when not
+// nil, is told how far the import of each currency has got.
+func backfillCurrencies(ctx context.Context, repo *Repository, list []string, from, to time.Time, progress func(currency string, through time.Time)) (int, error) {
+	total := 0
+	for i, currency := range list {
+		if i > 0 {
+			if err := sleepContext(ctx, backfillDelay); err != nil {
+				return total, err
+			}
+		}
+		var report func(time.Time)
+		if progress != nil {
+			report = func(through time.Time) { progress(currency, through) }
+		}
+		n, err := backfillCurrency(ctx, repo, currency, from, to, report)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("backfill of %s stopped after %d new rows: %w", strings.ToUpper(currency), n, err)
+		}
+		slog.Info("Backfill complete", "coin", "bitcoin", "currency", currency, "new", n)
+
+		if err := rebuildDerivedData(repo, currency, from); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// rebuildDerivedData rebuilds the candles of currency from from on, its volatility
+// regimes and price levels, and its all-time high and low, after prices were imported
+func rebuildDerivedData(repo *Repository, currency string, from time.Time) error {
+	for _, resolution := range candleResolutions {
+		if _, err := updateCandles(repo, currency, resolution, from); err != nil {
+			return fmt.Errorf("failed to rebuild %s candles for %s: %w", resolution, strings.ToUpper(currency), err)
+		}
+	}
+	if err := updateVolatilityRegimes(repo, currency); err != nil {
+		return fmt.Errorf("failed to update volatility regimes for %s: %w", strings.ToUpper(currency), err)
+	}
+	if _, err := updatePriceLevels(repo, currency); err != nil {
+		return fmt.Errorf("failed to update price levels for %s: %w", strings.ToUpper(currency), err)
+	}
+	if err := seedPriceExtremes(context.Background(), repo, currency); err != nil {
+		return fmt.Errorf("failed to update the all-time high and low for %s: %w", strings.ToUpper(currency), err)
+	}
+	if _, err := refreshDailySummaries(context.Background(), repo, currency, from); err != nil {
+		return fmt.Errorf("failed to rebuild daily summaries for %s: %w", strings.ToUpper(currency), err)
+	}
+	return nil
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"         // Package for buffered backup I/O
+	"compress/gzip" // Package for compressing backup files
+	"context"       // Package for cancelling a restore
+	"encoding/json" // Package for the JSON Lines rows
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for backup readers and writers
+	"log/slog"      // Package for structured logging
+	"os"            // Package for backup files
+	"slices"        // Package for checking table names
+	"strings"       // Package for string manipulation
+	"time"          // Package for backup timestamps
+)
+
+// A backup is a gzip-compressed JSON Lines file: a header line, then one line per row
+// naming its table. Rows are the tracker's own records rather than SQL, so a backup
+// taken from PostgreSQL restores into SQLite and the other way around.
+
+// backupFormat identifies backup files in their header
+const backupFormat = "bitcoin-tracker-backup"
+
+// backupVersion is the format version written by this build
+const backupVersion = 1
+
+// backupPageSize is how many rows backup reads, and restore writes, at a time
+const backupPageSize = 1000
+
+// Tables a backup can hold, in the order they are written and restored
+const (
+	backupPrices  = "prices"  // bitcoin_prices
+	backupCandles = "candles" // bitcoin_candles
+	backupAlerts  = "alerts"  // alert_rules
+)
+
+// backupTables lists every table a backup can hold
+var backupTables = []string{backupPrices, backupCandles, backupAlerts}
+
+// backupHeader is the first line of a backup
+type backupHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Tables    []string  `json:"tables"`
+}
+
+// backupRow is every further line of a backup
+type backupRow struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// parseBackupTables validates the comma-separated --tables flag
+func parseBackupTables(v string) ([]string, error) {
+	var tables []string
+	for _, t := range strings.Split(v, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if !slices.Contains(backupTables, t) {
+			return nil, validationErrorf("unknown table %q (expected %s)", t, strings.Join(backupTables, ", "))
+		}
+		if !slices.Contains(tables, t) {
+			tables = append(tables, t)
+		}
+	}
+	if len(tables) == 0 {
+		return nil, validationErrorf("--tables must name at least one of %s", strings.Join(backupTables, ", "))
+	}
+	return tables, nil
+}
+
+// backupWriter writes the rows of a backup
+type backupWriter struct {
+	enc   *json.Encoder
+	count map[string]int // Rows written per table
+}
+
+// write adds one row of table
+func (w *backupWriter) write(table string, row interface{}) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s row: %w", table, err)
+	}
+	if err := w.enc.Encode(backupRow{Table: table, Row: data}); err != nil {
+		return err
+	}
+	w.count[table]++
+	return nil
+}
+
+// writeBackup writes the tables to w and returns the rows written per table
+// Prices are read in ID order, so rows stored while the backup runs don't shift pages.
+func writeBackup(ctx context.Context, repo *Repository, w io.Writer, tables []string) (map[string]int, error) {
+	bw := &backupWriter{enc: json.NewEncoder(w), count: make(map[string]int)}
+	header := backupHeader{Format: backupFormat, Version: backupVersion, CreatedAt: time.Now().UTC(), Tables: tables}
+	if err := bw.enc.Encode(header); err != nil {
+		return bw.count, err
+	}
+
+	for _, table := range tables {
+		if err := ctx.Err(); err != nil {
+			return bw.count, err
+		}
+		switch table {
+		case backupPrices:
+			for afterID := 0; ; {
+				page, err := repo.PricesAfter("", afterID, backupPageSize)
+				if err != nil {
+					return bw.count, err
+				}
+				for _, r := range page {
+					if err := bw.write(table, r); err != nil {
+						return bw.count, err
+					}
+					afterID = r.ID
+				}
+				if len(page) < backupPageSize {
+					break
+				}
+				if err := ctx.Err(); err != nil {
+					return bw.count, err
+				}
+			}
+
+		case backupCandles:
+			list, err := repo.CandleCurrencies()
+			if err != nil {
+				return bw.count, err
+			}
+			for _, currency := range list {
+				for _, resolution := range candleResolutions {
+					// Buckets are at least an hour apart, so the next page starts a second after the last
+					for from := (time.Time{}); ; {
+						page, err := repo.Candles(ctx, currency, resolution, from, time.Time{}, backupPageSize)
+						if err != nil {
+							return bw.count, err
+						}
+						for _, c := range page {
+							if err := bw.write(table, c); err != nil {
+								return bw.count, err
+							}
+							from = c.Start.Add(time.Second)
+						}
+						if len(page) < backupPageSize {
+							break
+						}
+					}
+				}
+			}
+
+		case backupAlerts:
+			rules, err := repo.AlertRules(allTenants)
+			if err != nil {
+				return bw.count, err
+			}
+			for _, rule := range rules {
+				if err := bw.write(table, rule); err != nil {
+					return bw.count, err
+				}
+			}
+		}
+		slog.Info("Backed up table", "table", table, "rows", bw.count[table])
+	}
+	return bw.count, nil
+}
+
+// alertRuleKey identifies a rule by what it watches and how it notifies, so restoring
+// a backup twice doesn't add the same rule twice
+func alertRuleKey(r AlertRule) string {
+	return fmt.Sprintf("%s|%g|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s", r.Kind, r.Threshold, r.Window, strings.ToLower(r.Currency), r.Regime,
+		strings.Join(r.Channels, ","), r.Cooldown, r.Pattern, r.Indicator, r.Portfolio, r.Basket, tenantOrDefault(r.Tenant))
+}
+
+// restoreResult counts the rows of one table read from a backup and stored in the database
+type restoreResult struct {
+	Table  string
+	Read   int
+	Stored int // New prices and rules, and every candle, as candles replace stored ones
+}
+
+// restorer writes the rows of a backup to the database in batches
+type restorer struct {
+	ctx        context.Context
+	repo       *Repository
+	prices     []PriceRecord
+	candles    []Candle
+	rules      map[string]bool // Keys of the stored rules
+	results    map[string]*restoreResult
+	currencies map[string]bool // Currencies prices were restored for
+}
+
+// flush writes the buffered prices and candles
+func (r *restorer) flush() error {
+	if len(r.prices) > 0 {
+		n, err := r.repo.SaveHistoricalPrices(r.ctx, r.prices)
+		if err != nil {
+			return err
+		}
+		r.results[backupPrices].Stored += n
+		r.prices = r.prices[:0]
+	}
+	if len(r.candles) > 0 {
+		if err := r.repo.SaveCandles(r.candles); err != nil {
+			return err
+		}
+		r.results[backupCandles].Stored += len(r.candles)
+		r.candles = r.candles[:0]
+	}
+	return nil
+}
+
+// add restores one row of a backup
+func (r *restorer) add(row backupRow) error {
+	res := r.results[row.Table]
+	res.Read++
+	switch row.Table {
+	case backupPrices:
+		var p PriceRecord
+		if err := json.Unmarshal(row.Row, &p); err != nil {
+			return fmt.Errorf("invalid price row: %w", err)
+		}
+		r.prices = append(r.prices, p)
+		r.currencies[p.Currency] = true
+
+	case backupCandles:
+		var c Candle
+		if err := json.Unmarshal(row.Row, &c); err != nil {
+			return fmt.Errorf("invalid candle row: %w", err)
+		}
+		r.candles = append(r.candles, c)
+
+	case backupAlerts:
+		var rule AlertRule
+		if err := json.Unmarshal(row.Row, &rule); err != nil {
+			return fmt.Errorf("invalid alert rule row: %w", err)
+		}
+		if r.rules[alertRuleKey(rule)] {
+			return nil
+		}
+		id, err := r.repo.SaveAlertRule(rule)
+		if err != nil {
+			return err
+		}
+		// A rule's state isn't part of SaveAlertRule, so it is restored after it
+		if rule.Disabled {
+			if err := r.repo.SetAlertDisabled(id, true); err != nil {
+				return err
+			}
+		}
+		if rule.SnoozedUntil != nil && rule.SnoozedUntil.After(time.Now()) {
+			if err := r.repo.SnoozeAlertRule(id, rule.SnoozedUntil); err != nil {
+				return err
+			}
+		}
+		if rule.Triggered {
+			if err := r.repo.SetAlertTriggered(id, true, false); err != nil {
+				return err
+			}
+		}
+		r.rules[alertRuleKey(rule)] = true
+		res.Stored++
+	}
+
+	if len(r.prices) >= backupPageSize || len(r.candles) >= backupPageSize {
+		return r.flush()
+	}
+	return nil
+}
+
+// restoreBackup adds the rows of the tables of a backup read from rd to the database
+// Prices are skipped when one in the same currency and minute is already stored, candles
+// replace the stored ones, and alert rules already stored are skipped, so restoring the
+// same backup again adds nothing. Volatility regimes and price levels of the currencies
+// with restored prices are rebuilt afterwards.
+func restoreBackup(ctx context.Context, repo *Repository, rd io.Reader, tables []string) ([]restoreResult, error) {
+	dec := json.NewDecoder(rd)
+	var header backupHeader
+	if err := dec.Decode(&header); err != nil || header.Format != backupFormat {
+		return nil, validationErrorf("not a bitcoin-tracker backup")
+	}
+	if header.Version > backupVersion {
+		return nil, validationErrorf("backup format version %d is newer than this build supports (%d)", header.Version, backupVersion)
+	}
+
+	r := &restorer{
+		ctx:        ctx,
+		repo:       repo,
+		rules:      make(map[string]bool),
+		results:    make(map[string]*restoreResult),
+		currencies: make(map[string]bool),
+	}
+	for _, table := range tables {
+		r.results[table] = &restoreResult{Table: table}
+	}
+	if r.results[backupAlerts] != nil {
+		stored, err := repo.AlertRules(allTenants)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range stored {
+			r.rules[alertRuleKey(rule)] = true
+		}
+	}
+
+	collect := func() []restoreResult {
+		results := make([]restoreResult, 0, len(tables))
+		for _, table := range backupTables {
+			if res, ok := r.results[table]; ok {
+				results = append(results, *res)
+			}
+		}
+		return results
+	}
+
+	for line := 2; ; line++ {
+		var row backupRow
+		err := dec.Decode(&row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return collect(), fmt.Errorf("invalid backup line %d: %w", line, err)
+		}
+		if !slices.Contains(backupTables, row.Table) {
+			return collect(), fmt.Errorf("invalid backup line %d: unknown table %q", line, row.Table)
+		}
+		if r.results[row.Table] == nil {
+			continue // Not asked for
+		}
+		if err := r.add(row); err != nil {
+			return collect(), fmt.Errorf("failed to restore backup line %d: %w", line, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return collect(), err
+		}
+	}
+	if err := r.flush(); err != nil {
+		return collect(), err
+	}
+
+	for currency := range r.currencies {
+		if err := updateVolatilityRegimes(repo, currency); err != nil {
+			return collect(), fmt.Errorf("failed to update volatility regimes for %s: %w", strings.ToUpper(currency), err)
+		}
+		if _, err := updatePriceLevels(repo, currency); err != nil {
+			return collect(), fmt.Errorf("failed to update price levels for %s: %w", strings.ToUpper(currency), err)
+		}
+	}
+	return collect(), nil
+}
+
+// runBackupCommand handles "backup [--output file] [--tables prices,candles,alerts]"
+func runBackupCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("backup")
+	output := fs.String("output", "", "File to write, - for stdout (default: bitcoin-tracker-YYYYMMDD-HHMMSS.jsonl.gz)")
+	tablesFlag := fs.String("tables", strings.Join(backupTables, ","), "Comma-separated tables to back up: prices, candles, alerts")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	tables, err := parseBackupTables(*tablesFlag)
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if path == "" {
+		path = "bitcoin-tracker-" + time.Now().Format("20060102-150405") + ".jsonl.gz"
+	}
+	out := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	bw := bufio.NewWriter(out)
+	zw := gzip.NewWriter(bw)
+	count, err := writeBackup(ctx, repo, zw, tables)
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if out != os.Stdout {
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+		parts := make([]string, 0, len(tables))
+		for _, table := range tables {
+			parts = append(parts, fmt.Sprintf("%d %s", count[table], table))
+		}
+		fmt.Printf("Backed up %s to %s\n", strings.Join(parts, ", "), path)
+	}
+	return nil
+}
+
+// runRestoreCommand handles "restore <file|-> [--tables prices,candles,alerts]"
+func runRestoreCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("restore")
+	tablesFlag := fs.String("tables", strings.Join(backupTables, ","), "Comma-separated tables to restore: prices, candles, alerts")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if fs.NArg() != 1 {
+		return validationErrorf("usage: restore <file|-> [--tables prices,candles,alerts]")
+	}
+	tables, err := parseBackupTables(*tablesFlag)
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	zr, err := gzip.NewReader(bufio.NewReader(in))
+	if err != nil {
+		return validationErrorf("not a bitcoin-tracker backup: %v", err)
+	}
+	defer zr.Close()
+
+	results, err := restoreBackup(ctx, repo, zr, tables)
+	if results == nil {
+		return err
+	}
+	fmt.Printf("\n%-10s %10s %10s\n", "Table", "In backup", "Stored")
+	fmt.Println("--------------------------------")
+	for _, res := range results {
+		fmt.Printf("%-10s %10d %10d\n", res.Table, res.Read, res.Stored)
+	}
+	fmt.Println()
+	return err
+}
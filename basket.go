@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"  // Package for fetching within the fetch deadline
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"net/http" // Package for the basket endpoints
+	"os"       // Package for environment variables
+	"regexp"   // Package for validating basket names
+	"slices"   // Package for checking basket names
+	"strconv"  // Package for parsing basket definitions
+	"strings"  // Package for parsing BASKETS
+	"time"     // Package for timestamps and change windows
+)
+
+// Basket kinds
+const (
+	BasketTop   = "top"   // The largest coins by market cap, optionally within a CoinGecko category
+	BasketFixed = "fixed" // Fixed quantities of listed coins
+)
+
+// maxBasketTop is the most constituents a top basket may have; CoinGecko returns at most
+// that many coins per request
+const maxBasketTop = 250
+
+// basketNamePattern is what basket names may look like; they appear in URLs and commands
+var basketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Basket is a group of coins whose combined value is recorded as its own series
+// A top basket is worth the combined market cap of the Top largest coins (of Category,
+// when set), re-ranked on every fetch; a fixed basket is worth Units of each coin.
+type Basket struct {
+	Name     string
+	Kind     string             // BasketTop or BasketFixed
+	Top      int                // Constituents of a top basket
+	Category string             // CoinGecko category ID of a top basket; empty for every coin
+	Units    map[string]float64 // CoinGecko coin ID -> quantity held, for fixed baskets
+}
+
+// String returns the basket's definition as written in BASKETS
+func (b Basket) String() string {
+	if b.Kind == BasketTop {
+		if b.Category != "" {
+			return fmt.Sprintf("top:%d:%s", b.Top, b.Category)
+		}
+		return fmt.Sprintf("top:%d", b.Top)
+	}
+	coins := make([]string, 0, len(b.Units))
+	for coin := range b.Units {
+		coins = append(coins, coin)
+	}
+	slices.Sort(coins)
+	for i, coin := range coins {
+		coins[i] = coin + ":" + strconv.FormatFloat(b.Units[coin], 'f', -1, 64)
+	}
+	return strings.Join(coins, "+")
+}
+
+// BasketConfig lists the baskets valued on every fetch, or on schedules of their own
+type BasketConfig struct {
+	Baskets   []Basket
+	Currency  string              // Fiat currency every basket is valued in
+	Schedules map[string]Schedule // BASKET_SCHEDULES; baskets valued by jobs of their own
+}
+
+// basketConfig is the active configuration, loaded at startup
+var basketConfig BasketConfig
+
+// basket returns the configured basket with a name
+func (c BasketConfig) basket(name string) (Basket, bool) {
+	for _, b := range c.Baskets {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return Basket{}, false
+}
+
+// names returns the names of the configured baskets
+func (c BasketConfig) names() []string {
+	names := make([]string, len(c.Baskets))
+	for i, b := range c.Baskets {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// perFetch returns the baskets without a schedule of their own, valued on every fetch
+func (c BasketConfig) perFetch() []Basket {
+	var baskets []Basket
+	for _, b := range c.Baskets {
+		if c.Schedules[b.Name] == nil {
+			baskets = append(baskets, b)
+		}
+	}
+	return baskets
+}
+
+// lookup returns the configured basket with a name, or a validation error listing them
+func (c BasketConfig) lookup(name string) (Basket, error) {
+	b, ok := c.basket(strings.ToLower(name))
+	if ok {
+		return b, nil
+	}
+	if len(c.Baskets) == 0 {
+		return b, validationErrorf("unknown basket %q: no baskets are configured; set BASKETS, e.g. BASKETS=top10=top:10", name)
+	}
+	return b, validationErrorf("unknown basket %q (configured: %s)", name, strings.Join(c.names(), ", "))
+}
+
+// loadBasketConfig reads BASKETS, comma-separated name=definition pairs, and
+// BASKET_CURRENCY, which defaults to the first of CURRENCIES. A definition is
+// "top:10" (the ten largest coins), "top:5:layer-1" (the five largest of a CoinGecko
+// category), or "bitcoin:0.5+ethereum:4" (fixed quantities of coins). BASKET_SCHEDULES
+// gives baskets schedules of their own, e.g. "smallcaps=1h".
+func loadBasketConfig() (BasketConfig, error) {
+	c := BasketConfig{Currency: currencies[0]}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("BASKET_CURRENCY"))); v != "" {
+		c.Currency = v
+	}
+
+	for _, entry := range strings.Split(os.Getenv("BASKETS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, definition, ok := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || !basketNamePattern.MatchString(name) {
+			return c, fmt.Errorf("invalid BASKETS entry %q (expected name=definition with a name of lowercase letters, digits, - and _)", entry)
+		}
+		if _, dup := c.basket(name); dup {
+			return c, fmt.Errorf("basket %q is defined twice in BASKETS", name)
+		}
+		b, err := parseBasket(name, strings.ToLower(strings.TrimSpace(definition)))
+		if err != nil {
+			return c, fmt.Errorf("invalid BASKETS entry %q: %w", entry, err)
+		}
+		c.Baskets = append(c.Baskets, b)
+	}
+
+	schedules, err := parseScheduleList("BASKET_SCHEDULES")
+	if err != nil {
+		return c, err
+	}
+	for name := range schedules {
+		if _, ok := c.basket(name); !ok {
+			return c, fmt.Errorf("BASKET_SCHEDULES names basket %q, which is not in BASKETS", name)
+		}
+	}
+	c.Schedules = schedules
+	return c, nil
+}
+
+// parseBasket parses a basket definition, "top:N[:category]" or "coin:units+coin:units"
+func parseBasket(name, definition string) (Basket, error) {
+	b := Basket{Name: name}
+	if rest, ok := strings.CutPrefix(definition, BasketTop+":"); ok {
+		count, category, _ := strings.Cut(rest, ":")
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 || n > maxBasketTop {
+			return b, fmt.Errorf("invalid number of coins %q (expected 1-%d)", count, maxBasketTop)
+		}
+		b.Kind, b.Top, b.Category = BasketTop, n, category
+		return b, nil
+	}
+
+	b.Kind, b.Units = BasketFixed, make(map[string]float64)
+	for _, part := range strings.Split(definition, "+") {
+		coin, units, ok := strings.Cut(strings.TrimSpace(part), ":")
+		quantity, err := strconv.ParseFloat(units, 64)
+		if !ok || coin == "" || err != nil || quantity <= 0 {
+			return b, fmt.Errorf("invalid constituent %q (expected a CoinGecko coin ID and a quantity, e.g. ethereum:4)", part)
+		}
+		if _, dup := b.Units[coin]; dup {
+			return b, fmt.Errorf("coin %q is listed twice", coin)
+		}
+		b.Units[coin] = quantity
+	}
+	return b, nil
+}
+
+// BasketValue is the combined value of a basket's constituents at one time
+type BasketValue struct {
+	Basket    string    `json:"basket"`
+	Currency  string    `json:"currency"`
+	Value     float64   `json:"value"`
+	Members   []string  `json:"members,omitempty"` // CoinGecko IDs of the constituents, largest first for top baskets
+	Timestamp time.Time `json:"timestamp"`         // Shared by every basket valued in the same tick
+}
+
+// fetchBasketValue values a basket from CoinGecko in currency
+func fetchBasketValue(ctx context.Context, repo *Repository, b Basket, currency string) (float64, []string, error) {
+	if *demoFlag {
+		value, err := mockBasketValue(ctx, repo, b, currency)
+		return value, nil, err
+	}
+
+	if b.Kind == BasketTop {
+		// Response format: [{"id": "bitcoin", "market_cap": 850000000000, ...}, ...]
+		url := fmt.Sprintf("%s/coins/markets?vs_currency=%s&order=market_cap_desc&per_page=%d&page=1",
+			coinGeckoAPI.BaseURL(), currency, b.Top)
+		if b.Category != "" {
+			url += "&category=" + b.Category
+		}
+		var coins []struct {
+			ID        string  `json:"id"`
+			MarketCap float64 `json:"market_cap"`
+		}
+		if err := getJSON(ctx, repo, "coingecko", "basket", url, &coins); err != nil {
+			return 0, nil, err
+		}
+		if len(coins) == 0 {
+			return 0, nil, fmt.Errorf("no coins returned; is %q a CoinGecko category ID?", b.Category)
+		}
+		var total float64
+		members := make([]string, len(coins))
+		for i, coin := range coins {
+			total += coin.MarketCap
+			members[i] = coin.ID
+		}
+		return total, members, nil
+	}
+
+	members := make([]string, 0, len(b.Units))
+	for coin := range b.Units {
+		members = append(members, coin)
+	}
+	slices.Sort(members)
+	prices, err := fetchCoinPrices(ctx, repo, "basket", members, currency, "")
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := prices.err(); err != nil {
+		// A basket missing a constituent would look like a crash, so it isn't valued
+		return 0, nil, err
+	}
+	var total float64
+	for _, coin := range members {
+		total += b.Units[coin] * prices.Prices[coin]
+	}
+	return total, members, nil
+}
+
+// recordBasketValues values the baskets of BASKETS without a schedule of their own,
+// as part of every fetch
+func recordBasketValues(ctx context.Context, repo *Repository) {
+	valueBaskets(ctx, repo, basketConfig.perFetch())
+}
+
+// runScheduledBasket values one basket of BASKET_SCHEDULES on its own job's timer,
+// within the fetch deadline
+func runScheduledBasket(ctx context.Context, repo *Repository, name string) {
+	b, ok := basketConfig.basket(name)
+	if !ok || basketConfig.Schedules[name] == nil {
+		return // Dropped from the configuration since the job was scheduled
+	}
+	ctx, cancel := withFetchDeadline(ctx)
+	defer cancel()
+	valueBaskets(ctx, repo, []Basket{b})
+}
+
+// valueBaskets values baskets and stores the values under one timestamp, then checks
+// the basket alert rules against them. A basket that fails is logged and skipped;
+// nothing here fails the fetch itself.
+func valueBaskets(ctx context.Context, repo *Repository, baskets []Basket) {
+	if len(baskets) == 0 {
+		return
+	}
+	if err := checkBudget(repo, "basket"); err != nil {
+		slog.Warn("Skipping basket values", "error", err)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var values []BasketValue
+	for _, b := range baskets {
+		var value float64
+		var members []string
+		err := runRecovered("basket "+b.Name, func() error {
+			var err error
+			value, members, err = fetchBasketValue(ctx, repo, b, basketConfig.Currency)
+			return err
+		})
+		if err != nil {
+			slog.Warn("Basket valuation failed", "basket", b.Name, "error", err)
+			incCounter("tracker_basket_failures_total", map[string]string{"basket": b.Name}, 1)
+			continue
+		}
+		values = append(values, BasketValue{Basket: b.Name, Currency: basketConfig.Currency, Value: roundPrice(value), Members: members, Timestamp: now})
+	}
+	if len(values) == 0 {
+		return
+	}
+	if err := repo.SaveBasketValues(ctx, values); err != nil {
+		slog.Error("Failed to save basket values", "error", err)
+		return
+	}
+
+	for _, v := range values {
+		slog.Info("Saved basket value", "basket", v.Basket, "value", v.Value, "currency", v.Currency, "members", len(v.Members))
+		setGauge("tracker_basket_value", map[string]string{"basket": v.Basket, "currency": v.Currency}, v.Value)
+	}
+	evaluateBasketAlerts(ctx, repo, values)
+}
+
+// BasketSummary is a basket's definition with its newest value and 24h change
+type BasketSummary struct {
+	Name       string       `json:"name"`
+	Definition string       `json:"definition"`
+	Currency   string       `json:"currency"`
+	Latest     *BasketValue `json:"latest"`               // Nil before the basket has been valued
+	Change24h  *float64     `json:"change_24h,omitempty"` // Percent change from the newest value at least 24h old
+}
+
+// basketSummaries summarizes every configured basket
+func basketSummaries(ctx context.Context, repo *Repository) ([]BasketSummary, error) {
+	latest, err := repo.LatestBasketValues(ctx, basketConfig.Currency)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]BasketSummary, 0, len(basketConfig.Baskets))
+	for _, b := range basketConfig.Baskets {
+		s := BasketSummary{Name: b.Name, Definition: b.String(), Currency: basketConfig.Currency}
+		for i := range latest {
+			if latest[i].Basket == b.Name {
+				s.Latest = &latest[i]
+			}
+		}
+		if s.Latest != nil {
+			past, ok, err := repo.BasketValueBefore(ctx, b.Name, basketConfig.Currency, 24*time.Hour)
+			if err != nil {
+				return nil, err
+			}
+			if ok && past > 0 {
+				change := percentChange(past, s.Latest.Value)
+				s.Change24h = &change
+			}
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+// handleBaskets serves GET /baskets, every basket with its newest value, and
+// GET /baskets/history?basket=top10&from=...&to=..., the values of one basket in a
+// range (from defaults to 24 hours before to, and to to now)
+func (s *apiServer) handleBaskets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if r.URL.Path == "/baskets" {
+		summaries, err := basketSummaries(r.Context(), s.repo)
+		if err != nil {
+			slog.Error("API failed to query baskets", "path", r.URL.Path, "error", err)
+			writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query baskets")
+			return
+		}
+		writeJSON(w, http.StatusOK, summaries)
+		return
+	}
+	if r.URL.Path != "/baskets/history" {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	b, err := basketConfig.lookup(r.URL.Query().Get("basket"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "%v", err)
+		return
+	}
+	from, to, err := requestWindow(r, "24h")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	to = windowEnd(to, time.Now())
+	if err := checkAnalyticsRange(from, to, ""); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	values, err := s.repo.BasketValues(r.Context(), b.Name, basketConfig.Currency, from, to, maxRangeLimit)
+	if err != nil {
+		slog.Error("API failed to query basket values", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query basket values")
+		return
+	}
+	if values == nil {
+		values = []BasketValue{}
+	}
+	writeJSON(w, http.StatusOK, values)
+}
+
+// runBasketsCommand handles "baskets" and "baskets history <name> [--from] [--to]"
+func runBasketsCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) > 0 && args[0] == "history" {
+		return runBasketHistoryCommand(ctx, repo, args[1:])
+	}
+	if len(args) > 0 {
+		return validationErrorf("usage: baskets | baskets history <name> [--from] [--to]")
+	}
+	if len(basketConfig.Baskets) == 0 {
+		return validationErrorf("no baskets are configured; set BASKETS, e.g. BASKETS=top10=top:10,majors=bitcoin:0.5+ethereum:4")
+	}
+
+	summaries, err := basketSummaries(ctx, repo)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n%-12s %-34s %-22s %-9s %-8s %-19s\n", "Basket", "Definition", "Value ("+strings.ToUpper(basketConfig.Currency)+")", "24h", "Members", "Valued at")
+	fmt.Println("--------------------------------------------------------------------------------------------------------------")
+	for _, s := range summaries {
+		value, change, members, at := "-", "-", "-", "never"
+		if s.Latest != nil {
+			value, at = formatPrice(s.Latest.Value), s.Latest.Timestamp.In(displayLocation).Format("2006-01-02 15:04:05")
+			if len(s.Latest.Members) > 0 {
+				members = strconv.Itoa(len(s.Latest.Members))
+			}
+		}
+		if s.Change24h != nil {
+			change = fmt.Sprintf("%+.2f%%", *s.Change24h)
+		}
+		fmt.Printf("%-12s %-34s %-22s %-9s %-8s %-19s\n", s.Name, s.Definition, value, change, members, at)
+	}
+	fmt.Println()
+	return nil
+}
+
+// runBasketHistoryCommand handles "baskets history <name> [--from] [--to]"
+func runBasketHistoryCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return validationErrorf("usage: baskets history <name> [--from] [--to]")
+	}
+	b, err := basketConfig.lookup(args[0])
+	if err != nil {
+		return err
+	}
+	fs := newFlagSet("baskets history")
+	fromFlag := fs.String("from", "", "Start of the range: YYYY-MM-DD or RFC 3339 (default: 24 hours before --to)")
+	toFlag := fs.String("to", "now", "End of the range: now, YYYY-MM-DD, or RFC 3339")
+	if err := fs.Parse(args[1:]); err != nil {
+		return withKind(KindValidation, err)
+	}
+	to, err := parseTimeFlag("to", *toFlag)
+	if err != nil {
+		return err
+	}
+	from := to.Add(-24 * time.Hour)
+	if *fromFlag != "" {
+		if from, err = parseTimeFlag("from", *fromFlag); err != nil {
+			return err
+		}
+	}
+
+	values, err := repo.BasketValues(ctx, b.Name, basketConfig.Currency, from, to, maxRangeLimit)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		slog.Info("No basket values in the range", "basket", b.Name, "from", from.Format(time.RFC3339), "to", to.Format(time.RFC3339))
+		return nil
+	}
+	fmt.Printf("\n%s (%s) in %s\n", b.Name, b.String(), strings.ToUpper(basketConfig.Currency))
+	fmt.Printf("%-19s %-22s %s\n", "Timestamp", "Value", "Members")
+	fmt.Println("--------------------------------------------------------------------------")
+	for _, v := range values {
+		fmt.Printf("%-19s %-22s %s\n", v.Timestamp.In(displayLocation).Format("2006-01-02 15:04:05"), formatPrice(v.Value), strings.Join(v.Members, ","))
+	}
+	fmt.Printf("\n%d values, %+.2f%% over the range\n\n", len(values), percentChange(values[0].Value, values[len(values)-1].Value))
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"  // Package for flushing within the drain period
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"strconv"  // Package for parsing WRITE_BATCH_SIZE
+	"sync"     // Package for guarding the buffer
+	"time"     // Package for the flush interval
+)
+
+// writeBatchMaxPending bounds the rows a writer keeps while the database fails, in batches
+// Beyond it the oldest rows are dropped rather than growing without limit.
+const writeBatchMaxPending = 10
+
+// WriteBatchConfig controls the buffered writer used by backfill and stream --batch
+type WriteBatchConfig struct {
+	Size     int           // Rows buffered before they are written
+	Interval time.Duration // Longest a row waits in the buffer
+}
+
+// writeBatchConfig is the active configuration, loaded at startup
+var writeBatchConfig = WriteBatchConfig{Size: 1000, Interval: 30 * time.Second}
+
+// loadWriteBatchConfig reads WRITE_BATCH_SIZE and WRITE_BATCH_INTERVAL (Go duration)
+func loadWriteBatchConfig() (WriteBatchConfig, error) {
+	c := WriteBatchConfig{Size: 1000, Interval: 30 * time.Second}
+	if v := os.Getenv("WRITE_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c, fmt.Errorf("invalid WRITE_BATCH_SIZE %q (expected a positive number of rows)", v)
+		}
+		c.Size = n
+	}
+	if v := os.Getenv("WRITE_BATCH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid WRITE_BATCH_INTERVAL %q", v)
+		}
+		c.Interval = d
+	}
+	return c, nil
+}
+
+// priceWriter buffers prices that carry their own timestamps and writes them with
+// SaveHistoricalPrices, which uses multi-row INSERTs or COPY, once size rows are
+// buffered or the oldest has waited interval. A failed write keeps the rows for the
+// next one. Close writes whatever is left, within the drain period when the writer's
+// context was cancelled by a shutdown.
+type priceWriter struct {
+	repo     *Repository   // Where the rows are written
+	name     string        // Names the writer in logs and metrics, e.g. "backfill"
+	size     int           // Rows buffered before a write
+	interval time.Duration // Longest a row waits in the buffer
+	// onFlush runs after each successful write with the rows written and how many of
+	// them were new; it runs with the writer locked, so writes stay in order
+	onFlush func(ctx context.Context, records []PriceRecord, inserted int)
+
+	work   context.Context    // Outlives the caller's context by the drain period
+	cancel context.CancelFunc // Releases work once the writer is closed
+
+	mu       sync.Mutex
+	pending  []PriceRecord
+	inserted int         // New rows written so far
+	timer    *time.Timer // Set while rows wait for the interval
+	closed   bool
+}
+
+// newPriceWriter returns a writer into repo whose writes run under ctx plus the drain
+// period
+func newPriceWriter(ctx context.Context, repo *Repository, name string, size int, interval time.Duration,
+	onFlush func(ctx context.Context, records []PriceRecord, inserted int)) *priceWriter {
+	work, cancel := drainContext(ctx)
+	return &priceWriter{repo: repo, name: name, size: size, interval: interval, onFlush: onFlush, work: work, cancel: cancel}
+}
+
+// Add buffers records and writes the buffer once it holds size rows
+// The error is that of the write; the records stay buffered either way.
+func (w *priceWriter) Add(records ...PriceRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return fmt.Errorf("%s writer is closed", w.name)
+	}
+
+	w.pending = append(w.pending, records...)
+	if dropped := len(w.pending) - writeBatchMaxPending*w.size; dropped > 0 {
+		slog.Error("Dropped buffered prices the database could not take", "writer", w.name, "rows", dropped)
+		incCounter("tracker_write_batch_dropped_total", map[string]string{"writer": w.name}, float64(dropped))
+		w.pending = append(w.pending[:0], w.pending[dropped:]...)
+	}
+	var err error
+	if len(w.pending) >= w.size {
+		err = w.flushLocked()
+	}
+	w.scheduleLocked()
+	return err
+}
+
+// Flush writes everything buffered now
+func (w *priceWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushLocked()
+}
+
+// Inserted returns how many new rows the writer has written so far
+func (w *priceWriter) Inserted() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.inserted
+}
+
+// Close writes everything still buffered and stops the writer
+// Rows that can't be written are reported in the error and lost.
+func (w *priceWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.cancel()
+
+	err := w.flushLocked()
+	if err != nil {
+		slog.Error("Buffered prices were not written", "writer", w.name, "rows", len(w.pending), "error", err)
+		err = fmt.Errorf("%d buffered prices were not written: %w", len(w.pending), err)
+		w.pending = nil
+	}
+	return err
+}
+
+// flushOnTimer writes the buffer once its oldest row has waited interval
+func (w *priceWriter) flushOnTimer() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timer = nil
+	if w.closed {
+		return
+	}
+	if err := w.flushLocked(); err != nil {
+		slog.Error("Failed to write buffered prices, retrying", "writer", w.name, "rows", len(w.pending), "error", err)
+	}
+	w.scheduleLocked()
+}
+
+// scheduleLocked starts the interval timer for rows left in the buffer; w.mu must be held
+func (w *priceWriter) scheduleLocked() {
+	if w.timer == nil && len(w.pending) > 0 {
+		w.timer = time.AfterFunc(w.interval, w.flushOnTimer)
+	}
+}
+
+// flushLocked writes the buffer; w.mu must be held
+func (w *priceWriter) flushLocked() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	stampLatency(w.pending, start)
+	inserted, err := w.repo.SaveHistoricalPrices(w.work, w.pending)
+	if err != nil {
+		incCounter("tracker_write_batches_total", map[string]string{"writer": w.name, "result": "error"}, 1)
+		return fmt.Errorf("failed to write %d buffered prices: %w", len(w.pending), err)
+	}
+	incCounter("tracker_write_batches_total", map[string]string{"writer": w.name, "result": "ok"}, 1)
+	incCounter("tracker_write_batch_rows_total", map[string]string{"writer": w.name}, float64(len(w.pending)))
+	slog.Debug("Wrote buffered prices", "writer", w.name, "rows", len(w.pending), "new", inserted,
+		"duration", time.Since(start).Round(time.Millisecond))
+
+	records := w.pending
+	w.pending = nil
+	w.inserted += inserted
+	if w.onFlush != nil {
+		w.onFlush(w.work, records, inserted)
+	}
+	return nil
+}
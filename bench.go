@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"       // Package for cancelling a run
+	"encoding/json" // Package for the JSON report
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"math/rand"     // Package for synthetic price moves
+	"net/url"       // Package for pointing a connection at the scratch schema
+	"os"            // Package for the scratch SQLite file and standard output
+	"path/filepath" // Package for the scratch SQLite path
+	"slices"        // Package for sorting latencies
+	"strings"       // Package for parsing --backends
+	"time"          // Package for timing operations
+)
+
+// Backends the bench command can measure
+const (
+	benchSQLite    = "sqlite"
+	benchPostgres  = "postgres"
+	benchTimescale = "timescale"
+)
+
+// benchOptions are the flags of the bench command
+type benchOptions struct {
+	Samples    int
+	Batch      int
+	Step       time.Duration
+	Currencies []string
+	Queries    int
+}
+
+// benchResult is the timing of one operation against one backend
+type benchResult struct {
+	Backend    string  `json:"backend"`
+	Operation  string  `json:"operation"`
+	Runs       int     `json:"runs"`
+	Rows       int     `json:"rows"`                    // Rows written, or returned by the last run
+	P50        float64 `json:"p50_ms"`                  // Median run, in milliseconds
+	P95        float64 `json:"p95_ms"`                  // 95th percentile run, in milliseconds
+	Max        float64 `json:"max_ms"`                  // Slowest run, in milliseconds
+	Throughput float64 `json:"rows_per_sec,omitempty"`  // Rows written per second, for inserts
+	Total      float64 `json:"total_seconds,omitempty"` // Time of every run together
+}
+
+// runBenchCommand handles `bench [--backends sqlite,postgres,timescale] [flags]`
+// Every backend is measured in a scratch database that is removed afterwards: a
+// temporary SQLite file, or a schema of its own in --database-url.
+func runBenchCommand(ctx context.Context, args []string) error {
+	fs := newFlagSet("bench")
+	backendsFlag := fs.String("backends", benchSQLite, "Backends to measure: sqlite, postgres, timescale")
+	dbURL := fs.String("database-url", "", "PostgreSQL database the postgres and timescale backends create a scratch schema in")
+	samples := fs.Int("samples", 1000000, "Synthetic prices to insert into each backend")
+	batch := fs.Int("batch", 10000, "Prices per insert transaction")
+	step := fs.Duration("step", time.Minute, "Time between the samples of a currency")
+	currencyFlag := fs.String("currencies", "", "Currencies the samples are spread over (default: CURRENCIES)")
+	queries := fs.Int("queries", 100, "Runs of each query")
+	asJSON := fs.Bool("json", false, "Print the results as JSON")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+
+	opts := benchOptions{Samples: *samples, Batch: *batch, Step: *step, Currencies: currencies, Queries: *queries}
+	if *currencyFlag != "" {
+		opts.Currencies = nil
+		for _, c := range strings.Split(*currencyFlag, ",") {
+			if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+				opts.Currencies = append(opts.Currencies, c)
+			}
+		}
+	}
+	switch {
+	case opts.Samples < 1 || opts.Batch < 1 || opts.Queries < 1:
+		return validationErrorf("--samples, --batch, and --queries must be positive")
+	case opts.Step < time.Minute:
+		return validationErrorf("--step must be at least 1m; prices are stored one per currency and minute")
+	case len(opts.Currencies) == 0:
+		return validationErrorf("--currencies must name at least one currency")
+	}
+
+	var backends []string
+	for _, b := range strings.Split(*backendsFlag, ",") {
+		switch b = strings.ToLower(strings.TrimSpace(b)); b {
+		case benchSQLite:
+		case benchPostgres, benchTimescale:
+			if *dbURL == "" {
+				return validationErrorf("the %s backend needs --database-url, a database the bench may create a scratch schema in", b)
+			}
+		default:
+			return validationErrorf("unknown backend %q (expected sqlite, postgres, or timescale)", b)
+		}
+		backends = append(backends, b)
+	}
+
+	var results []benchResult
+	for _, backend := range backends {
+		slog.Info("Benchmarking backend", "backend", backend, "samples", opts.Samples, "batch", opts.Batch)
+		r, err := benchBackend(ctx, backend, *dbURL, opts)
+		results = append(results, r...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", backend, err)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	printBenchReport(results, opts)
+	return nil
+}
+
+// benchBackend opens a scratch store of backend, fills it, and times the writes and
+// queries against it; the scratch database is removed however the run ends
+func benchBackend(ctx context.Context, backend, dbURL string, opts benchOptions) ([]benchResult, error) {
+	s, cleanup, err := openBenchStore(backend, dbURL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		s.Close()
+		if err := cleanup(); err != nil {
+			slog.Warn("Failed to remove the scratch database", "backend", backend, "error", err)
+		}
+	}()
+
+	insert, first, err := benchInsert(ctx, s, opts)
+	insert.Backend = backend
+	if err != nil {
+		return nil, err
+	}
+	results := []benchResult{insert}
+	for _, r := range benchQueries(ctx, s, opts, first) {
+		r.Backend = backend
+		results = append(results, r)
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+	}
+	return results, nil
+}
+
+// openBenchStore opens and migrates a scratch store, returning it with the function
+// that removes it
+func openBenchStore(backend, dbURL string) (Store, func() error, error) {
+	if backend == benchSQLite {
+		dir, err := os.MkdirTemp("", "bitcoin-tracker-bench-")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create a scratch directory: %w", err)
+		}
+		cleanup := func() error { return os.RemoveAll(dir) }
+		s, err := openSQLiteStore(filepath.Join(dir, "bench.db"))
+		if err == nil {
+			err = s.Init()
+		}
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		return s, cleanup, nil
+	}
+
+	// The scratch schema comes first on the search path; the extensions stay reachable in public
+	schema := fmt.Sprintf("bench_%d", time.Now().UnixNano())
+	admin, err := openPostgresStore(context.Background(), dbURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := admin.db.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		admin.Close()
+		return nil, nil, fmt.Errorf("failed to create scratch schema: %w", err)
+	}
+	cleanup := func() error {
+		defer admin.Close()
+		_, err := admin.db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		return err
+	}
+
+	s, err := openPostgresStore(context.Background(), withSearchPath(dbURL, schema+",public"))
+	if err == nil {
+		if err = s.sqlStore.Init(); err == nil && backend == benchTimescale {
+			err = s.setupTimescale(timescaleOn)
+		}
+		if err != nil {
+			s.Close()
+		}
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return s, cleanup, nil
+}
+
+// withSearchPath sets the search_path of the sessions a PostgreSQL connection string opens
+func withSearchPath(dbURL, path string) string {
+	u, err := url.Parse(dbURL)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return dbURL + " search_path=" + path // Later keys override earlier ones
+	}
+	q := u.Query()
+	q.Set("search_path", path)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// benchInsert writes opts.Samples synthetic prices ending now in batches, as a backfill
+// does, and returns their timing and the time of the oldest sample
+func benchInsert(ctx context.Context, s Store, opts benchOptions) (benchResult, time.Time, error) {
+	result := benchResult{Operation: "insert"}
+	steps := (opts.Samples + len(opts.Currencies) - 1) / len(opts.Currencies)
+	end := time.Now().UTC().Truncate(opts.Step)
+	first := end.Add(-time.Duration(steps-1) * opts.Step)
+
+	walk := demoWalk{rng: rand.New(rand.NewSource(demoSeed)), vol: demoDailyVol}
+	price := demoStartPrice
+	batch := make([]PriceRecord, 0, opts.Batch)
+	var durations []time.Duration
+	flush := func() error {
+		start := time.Now()
+		n, err := s.SaveHistoricalPrices(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("failed to insert synthetic prices: %w", err)
+		}
+		durations = append(durations, time.Since(start))
+		result.Rows += n
+		batch = batch[:0]
+		return nil
+	}
+
+	written := 0
+	for t := first; written < opts.Samples; t = t.Add(opts.Step) {
+		price *= walk.step(opts.Step)
+		for _, currency := range opts.Currencies {
+			if written == opts.Samples {
+				break
+			}
+			batch = append(batch, PriceRecord{Price: roundPriceIn(currency, price*demoRate(currency)), Currency: currency, Source: "bench", Timestamp: t})
+			written++
+			if len(batch) == opts.Batch {
+				if err := flush(); err != nil {
+					return result, first, err
+				}
+				slog.Debug("Inserted synthetic prices", "rows", result.Rows, "of", opts.Samples)
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return result, first, err
+		}
+	}
+	summarizeBenchRuns(&result, durations)
+	if result.Total > 0 {
+		result.Throughput = float64(result.Rows) / result.Total
+	}
+	return result, first, nil
+}
+
+// benchQueries times the reads dashboards, the API, and the jobs make most, then the
+// retention work, over the prices benchInsert wrote from first
+func benchQueries(ctx context.Context, s Store, opts benchOptions, first time.Time) []benchResult {
+	currency := opts.Currencies[0]
+	now := time.Now()
+	queries := []struct {
+		name string
+		run  func() (int, error)
+	}{
+		{"latest price", func() (int, error) {
+			p, err := s.LatestPrices(ctx, 1, currency)
+			return len(p), err
+		}},
+		{"latest per currency", func() (int, error) {
+			p, err := s.LatestPerCurrency(ctx)
+			return len(p), err
+		}},
+		{"range 24h", func() (int, error) {
+			p, err := s.PriceRange(currency, now.Add(-24*time.Hour), time.Time{}, maxRangeLimit)
+			return len(p), err
+		}},
+		{"page of 50", func() (int, error) {
+			p, _, err := s.SearchPrices(PriceFilter{Currency: currency, Limit: 50})
+			return len(p), err
+		}},
+		{"stats 30d", func() (int, error) {
+			st, err := s.PriceStats(ctx, currency, now.Add(-30*24*time.Hour), now)
+			return st.Samples, err
+		}},
+		{"stats all", func() (int, error) {
+			st, err := s.PriceStats(ctx, currency, first, now)
+			return st.Samples, err
+		}},
+		{"price at a time", func() (int, error) {
+			p, err := s.PricesAround(ctx, currency, first.Add(now.Sub(first)/2))
+			return len(p), err
+		}},
+	}
+
+	var results []benchResult
+	for _, q := range queries {
+		result := benchResult{Operation: q.name}
+		var durations []time.Duration
+		for i := 0; i < opts.Queries && ctx.Err() == nil; i++ {
+			start := time.Now()
+			n, err := q.run()
+			if err != nil {
+				slog.Warn("Benchmark query failed", "operation", q.name, "error", err)
+				break
+			}
+			durations = append(durations, time.Since(start))
+			result.Rows = n
+		}
+		summarizeBenchRuns(&result, durations)
+		results = append(results, result)
+	}
+
+	// Retention runs once: the older half is rolled up to hourly averages, then the
+	// oldest quarter is purged
+	span := now.Sub(first)
+	retention := []struct {
+		name string
+		run  func() (int, error)
+	}{
+		{"downsample hourly", func() (int, error) {
+			n, _, err := s.DownsamplePrices(CandleHourly, time.Time{}, first.Add(span/2), false)
+			return n, err
+		}},
+		{"purge", func() (int, error) {
+			return s.PurgePrices(first.Add(span/4), false)
+		}},
+	}
+	for _, r := range retention {
+		if ctx.Err() != nil {
+			break
+		}
+		result := benchResult{Operation: r.name}
+		start := time.Now()
+		n, err := r.run()
+		if err != nil {
+			slog.Warn("Benchmark retention failed", "operation", r.name, "error", err)
+			continue
+		}
+		result.Rows = n
+		summarizeBenchRuns(&result, []time.Duration{time.Since(start)})
+		results = append(results, result)
+	}
+	return results
+}
+
+// summarizeBenchRuns fills in the run count, percentiles, and total of durations
+func summarizeBenchRuns(r *benchResult, durations []time.Duration) {
+	r.Runs = len(durations)
+	if len(durations) == 0 {
+		return
+	}
+	slices.Sort(durations)
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	r.P50 = ms(durations[len(durations)/2])
+	r.P95 = ms(durations[min(len(durations)-1, len(durations)*95/100)])
+	r.Max = ms(durations[len(durations)-1])
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	r.Total = total.Seconds()
+}
+
+// printBenchReport prints the results as a table per backend
+func printBenchReport(results []benchResult, opts benchOptions) {
+	fmt.Printf("%d samples in %s over %s, %d per insert, %d runs per query\n",
+		opts.Samples, strings.Join(opts.Currencies, ","), opts.Step, opts.Batch, opts.Queries)
+	backend := ""
+	for _, r := range results {
+		if r.Backend != backend {
+			backend = r.Backend
+			fmt.Printf("\n%s\n", backend)
+			fmt.Printf("%-20s %6s %9s %10s %10s %10s %14s\n", "Operation", "Runs", "Rows", "p50", "p95", "Max", "Throughput")
+			fmt.Println(strings.Repeat("-", 85))
+		}
+		throughput := "-"
+		if r.Throughput > 0 {
+			throughput = fmt.Sprintf("%.0f rows/s", r.Throughput)
+		}
+		fmt.Printf("%-20s %6d %9d %8.2fms %8.2fms %8.2fms %14s\n", r.Operation, r.Runs, r.Rows, r.P50, r.P95, r.Max, throughput)
+	}
+}
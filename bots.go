@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"          // Package for multipart bodies
+	"context"        // Package for bot queries
+	"crypto/ed25519" // Package for verifying Discord requests
+	"encoding/hex"   // Package for decoding Discord keys and signatures
+	"encoding/json"  // Package for bot payloads
+	"fmt"            // Package for formatted I/O operations
+	"io"             // Package for reading request bodies
+	"log/slog"       // Package for structured logging
+	"mime/multipart" // Package for uploading chart images
+	"net/http"       // Package for the bot endpoints
+	"net/textproto"  // Package for multipart part headers
+	"slices"         // Package for checking configured currencies
+	"strings"        // Package for string manipulation
+	"time"           // Package for chart windows
+)
+
+// Default windows for chat commands without one
+const (
+	botChartWindow = "30d"
+	botStatsWindow = "24h"
+)
+
+// botMaxWindow is the longest window a chat command may ask for
+const botMaxWindow = 5 * 365 * 24 * time.Hour
+
+// botHelp is the reply to /help and to unknown commands
+const botHelp = "Commands:\n/chart [window] [currency] - price chart, e.g. /chart 90d eur\n/stats [window] [currency] - price statistics, e.g. /stats 30d"
+
+// botCommand is a parsed chat command such as "/chart 90d eur"
+type botCommand struct {
+	Name     string        // "chart", "stats", or "help"
+	Window   time.Duration // Window ending now
+	Label    string        // The window as typed, e.g. "90d"
+	Currency string        // Fiat currency, defaulting to the first configured one
+}
+
+// botReply is the answer to a chat command
+type botReply struct {
+	Text    string // Message text, or the caption of Chart
+	Chart   []byte // PNG chart for /chart
+	Private bool   // Help and errors, which only the asker needs to see where supported
+}
+
+// parseBotCommand parses "/chart [window] [currency]" or "/stats [window] [currency]"
+// The arguments may come in either order. Telegram's "/chart@BotName" form is accepted.
+func parseBotCommand(text string) (botCommand, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return botCommand{}, fmt.Errorf("not a command")
+	}
+	name, _, _ := strings.Cut(strings.ToLower(strings.TrimPrefix(fields[0], "/")), "@")
+
+	cmd := botCommand{Name: name, Currency: currencies[0]}
+	switch name {
+	case "chart":
+		cmd.Label = botChartWindow
+	case "stats":
+		cmd.Label = botStatsWindow
+	default:
+		cmd.Name = "help"
+		return cmd, nil
+	}
+
+	for _, arg := range fields[1:] {
+		arg = strings.ToLower(arg)
+		if slices.Contains(currencies, arg) {
+			cmd.Currency = arg
+			continue
+		}
+		if _, err := parseStatsWindow(arg); err != nil {
+			return cmd, fmt.Errorf("%q is neither a window (e.g. 24h, 90d) nor a configured currency (%s)", arg, strings.Join(currencies, ", "))
+		}
+		cmd.Label = arg
+	}
+
+	window, _ := parseStatsWindow(cmd.Label)
+	if window > botMaxWindow {
+		return cmd, fmt.Errorf("window %s is longer than five years", cmd.Label)
+	}
+	cmd.Window = window
+	return cmd, nil
+}
+
+// runBotCommand answers a parsed chat command
+func runBotCommand(repo *Repository, cmd botCommand) (botReply, error) {
+	now := time.Now()
+	switch cmd.Name {
+	case "stats":
+		stats, err := computePriceStats(context.Background(), repo, cmd.Currency, now.Add(-cmd.Window), now)
+		if err != nil {
+			return botReply{}, err
+		}
+		if stats.Samples == 0 {
+			return botReply{Text: renderMessage("", "bot.nodata", map[string]interface{}{"Currency": cmd.Currency, "Window": cmd.Label})}, nil
+		}
+		return botReply{Text: renderMessage("", "bot.stats", map[string]interface{}{
+			"Currency": cmd.Currency,
+			"Window":   cmd.Label,
+			"Samples":  stats.Samples,
+			"Min":      stats.Min,
+			"Max":      stats.Max,
+			"Mean":     stats.Mean,
+			"Median":   stats.Median,
+			"Change":   stats.ChangePct,
+		})}, nil
+
+	case "chart":
+		points, err := chartPoints(repo, cmd.Currency, cmd.Window)
+		if err != nil {
+			return botReply{}, err
+		}
+		if len(points) < 2 {
+			return botReply{Text: renderMessage("", "bot.nodata", map[string]interface{}{"Currency": cmd.Currency, "Window": cmd.Label})}, nil
+		}
+		change := percentChange(points[0].Price, points[len(points)-1].Price)
+		title := fmt.Sprintf("BTC/%s %s %+.2f%%", strings.ToUpper(cmd.Currency), cmd.Label, change)
+		chart, err := renderPriceChart(title, points)
+		if err != nil {
+			return botReply{}, err
+		}
+		return botReply{Text: title, Chart: chart}, nil
+	}
+	return botReply{Text: botHelp, Private: true}, nil
+}
+
+// chartPoints loads the prices to plot for a window ending now: raw samples for up
+// to two days, hourly candle closes for up to two weeks, and daily closes beyond
+func chartPoints(repo *Repository, currency string, window time.Duration) ([]chartPoint, error) {
+	return loadChartPoints(context.Background(), repo, currency, chartResolution(window), time.Now().Add(-window), time.Time{})
+}
+
+// answerBotText parses and runs a chat command, turning errors into a reply
+func answerBotText(repo *Repository, channel, user, text string) botReply {
+	cmd, err := parseBotCommand(text)
+	if err != nil {
+		return botReply{Text: err.Error(), Private: true}
+	}
+	slog.Info("Chat command received", "channel", channel, "user", user, "command", cmd.Name, "window", cmd.Label, "currency", cmd.Currency)
+
+	reply, err := runBotCommand(repo, cmd)
+	if err != nil {
+		slog.Error("Chat command failed", "channel", channel, "command", cmd.Name, "error", err)
+		return botReply{Text: "Sorry, the " + cmd.Name + " command failed", Private: true}
+	}
+	incCounter("tracker_bot_commands_total", map[string]string{"channel": channel, "command": cmd.Name}, 1)
+	return reply
+}
+
+// multipartChart builds a multipart/form-data body with fields plus the chart as a PNG file
+// It returns the body and its Content-Type
+func multipartChart(fields map[string]string, fileField string, chart []byte) (*bytes.Buffer, string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := mw.WriteField(name, value); err != nil {
+			return nil, "", err
+		}
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="chart.png"`, fileField))
+	header.Set("Content-Type", "image/png")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(chart); err != nil {
+		return nil, "", err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return &body, mw.FormDataContentType(), nil
+}
+
+// sendTelegramPhoto uploads a chart to a chat with the bot's sendPhoto method
+func sendTelegramPhoto(token, chatID string, reply botReply) error {
+	body, contentType, err := multipartChart(map[string]string{"chat_id": chatID, "caption": reply.Text}, "photo", reply.Chart)
+	if err != nil {
+		return fmt.Errorf("failed to encode telegram photo: %w", err)
+	}
+
+	resp, err := httpClient.Post("https://api.telegram.org/bot"+token+"/sendPhoto", contentType, body)
+	if err != nil {
+		// The URL contains the token, so don't let it leak into logs via the error
+		return fmt.Errorf("failed to reach telegram API")
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if !result.OK {
+		return fmt.Errorf("telegram returned status %d: %s", resp.StatusCode, result.Description)
+	}
+	return nil
+}
+
+// answerTelegramCommand replies to a command sent to the bot
+// Text replies are returned as a sendMessage call in the webhook response; charts
+// need a file upload, which only the API itself accepts.
+func answerTelegramCommand(repo *Repository, w http.ResponseWriter, chatID, user, text string) {
+	reply := answerBotText(repo, "telegram", user, text)
+	if reply.Chart == nil {
+		writeJSON(w, http.StatusOK, map[string]string{"method": "sendMessage", "chat_id": chatID, "text": reply.Text})
+		return
+	}
+
+	if err := sendTelegramPhoto(chatBots.telegramToken, chatID, reply); err != nil {
+		slog.Error("Failed to send chart", "channel", "telegram", "error", err)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Discord interaction and response types
+const (
+	discordPing           = 1  // Sent when the interactions endpoint is configured
+	discordCommand        = 2  // A slash command was used
+	discordPong           = 1  // Answer to a ping
+	discordMessageReply   = 4  // Reply with a message
+	discordEphemeralReply = 64 // Message flag: only the user who asked sees the reply
+)
+
+// handleDiscordInteraction serves POST /actions/discord, the Discord application's
+// interactions endpoint. Requests are signed with the application's Ed25519 key.
+// The /chart and /stats slash commands take optional "window" and "currency" options.
+func (s *apiServer) handleDiscordInteraction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	publicKey := chatBots.discordKey
+	if publicKey == nil {
+		writeAPIError(w, http.StatusNotFound, "discord commands are not configured")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	sig, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	timestamp := r.Header.Get("X-Signature-Timestamp")
+	if err != nil || len(sig) != ed25519.SignatureSize || !ed25519.Verify(publicKey, []byte(timestamp+string(body)), sig) {
+		writeAPIError(w, http.StatusUnauthorized, "invalid request signature")
+		return
+	}
+
+	// Interaction format: {"type": 2, "data": {"name": "chart", "options": [{"name": "window", "value": "90d"}]}, "member": {"user": {...}}}
+	var interaction struct {
+		Type int `json:"type"`
+		Data struct {
+			Name    string `json:"name"`
+			Options []struct {
+				Name  string      `json:"name"`
+				Value interface{} `json:"value"`
+			} `json:"options"`
+		} `json:"data"`
+		Member struct {
+			User struct {
+				Username string `json:"username"`
+			} `json:"user"`
+		} `json:"member"`
+		User struct {
+			Username string `json:"username"` // Set instead of member in direct messages
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid interaction")
+		return
+	}
+
+	switch interaction.Type {
+	case discordPing:
+		writeJSON(w, http.StatusOK, map[string]int{"type": discordPong})
+		return
+	case discordCommand:
+	default:
+		writeAPIError(w, http.StatusBadRequest, "unsupported interaction type %d", interaction.Type)
+		return
+	}
+
+	// Rebuild the command line so Discord and Telegram share one parser
+	text := "/" + interaction.Data.Name
+	for _, opt := range interaction.Data.Options {
+		text += " " + fmt.Sprint(opt.Value)
+	}
+	user := interaction.Member.User.Username
+	if user == "" {
+		user = interaction.User.Username
+	}
+	reply := answerBotText(s.repo, "discord", user, text)
+
+	if reply.Chart == nil {
+		data := map[string]interface{}{"content": reply.Text}
+		if reply.Private {
+			data["flags"] = discordEphemeralReply
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"type": discordMessageReply, "data": data})
+		return
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type": discordMessageReply,
+		"data": map[string]interface{}{
+			"content":     reply.Text,
+			"attachments": []map[string]interface{}{{"id": 0, "filename": "chart.png"}},
+		},
+	})
+	respBody, contentType, err := multipartChart(map[string]string{"payload_json": string(payload)}, "files[0]", reply.Chart)
+	if err != nil {
+		slog.Error("Failed to encode chart", "channel", "discord", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to encode chart")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBody.Bytes())
+}
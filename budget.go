@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"   // Package for the budget sentinel error
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"sort"     // Package for stable scope ordering
+	"strconv"  // Package for parsing numeric settings
+	"strings"  // Package for parsing per-asset limit lists
+	"time"     // Package for window and interval calculations
+)
+
+// BudgetConfig describes the provider plan limits we must stay within
+// A limit of 0 means "unlimited" for that scope
+type BudgetConfig struct {
+	Limit       int            // Maximum provider calls across all assets per window
+	Window      time.Duration  // Length of the rolling window (e.g. 30 days)
+	AssetLimits map[string]int // Optional per-asset limits within the same window
+	StretchAt   float64        // Fraction of a limit after which intervals are stretched
+}
+
+// BudgetUsage reports how much of a limit has been consumed in the current window
+type BudgetUsage struct {
+	Scope     string // "global" or the asset name
+	Used      int    // Calls made inside the rolling window
+	Limit     int    // Configured limit (0 = unlimited)
+	Remaining int    // Calls left before the limit is reached
+}
+
+// errBudgetExhausted is returned when a limit leaves no calls in the current window
+var errBudgetExhausted = errors.New("fetch budget exhausted")
+
+// budgetConfig holds the active budget settings, loaded once at startup
+var budgetConfig BudgetConfig
+
+// loadBudgetConfig reads the fetch budget settings from environment variables
+// Defaults match the CoinGecko free plan: 10,000 calls per 30 days
+func loadBudgetConfig() (BudgetConfig, error) {
+	cfg := BudgetConfig{
+		Limit:       10000,
+		Window:      30 * 24 * time.Hour,
+		AssetLimits: make(map[string]int),
+		StretchAt:   0.8,
+	}
+
+	if v := os.Getenv("BUDGET_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("invalid BUDGET_LIMIT %q", v)
+		}
+		cfg.Limit = n
+	}
+
+	if v := os.Getenv("BUDGET_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid BUDGET_WINDOW %q", v)
+		}
+		cfg.Window = d
+	}
+
+	if v := os.Getenv("BUDGET_STRETCH_AT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > 1 {
+			return cfg, fmt.Errorf("invalid BUDGET_STRETCH_AT %q (must be in (0,1])", v)
+		}
+		cfg.StretchAt = f
+	}
+
+	// Per-asset limits use the form "bitcoin=5000,ethereum=2000"
+	if v := os.Getenv("BUDGET_ASSET_LIMITS"); v != "" {
+		for _, pair := range strings.Split(v, ",") {
+			asset, limit, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			n, err := strconv.Atoi(limit)
+			if !ok || err != nil || n < 0 || asset == "" {
+				return cfg, fmt.Errorf("invalid BUDGET_ASSET_LIMITS entry %q", pair)
+			}
+			cfg.AssetLimits[asset] = n
+		}
+	}
+
+	return cfg, nil
+}
+
+// recordAPICall stores one provider call and prunes calls that left the window
+func recordAPICall(repo *Repository, provider, asset string) error {
+	// Relay mode has no database, so its calls are only counted in the metrics
+	if repo != nil {
+		if err := repo.RecordAPICall(provider, asset, budgetConfig.Window); err != nil {
+			return err
+		}
+	}
+
+	incCounter("tracker_provider_calls_total", map[string]string{"provider": provider, "asset": asset}, 1)
+	return nil
+}
+
+// getBudgetUsage returns global usage followed by usage for each asset with a limit
+// Assets that were called but have no limit are included too, for visibility
+func getBudgetUsage(repo *Repository) ([]BudgetUsage, error) {
+	perAsset, err := repo.APICallCounts(budgetConfig.Window)
+	if err != nil {
+		return nil, err
+	}
+
+	assets := make([]string, 0, len(perAsset))
+	total := 0
+	for asset, count := range perAsset {
+		assets = append(assets, asset)
+		total += count
+	}
+
+	// Make sure limited assets show up even if they were never called
+	for asset := range budgetConfig.AssetLimits {
+		if _, ok := perAsset[asset]; !ok {
+			assets = append(assets, asset)
+		}
+	}
+
+	sort.Strings(assets)
+
+	usage := []BudgetUsage{newBudgetUsage("global", total, budgetConfig.Limit)}
+	for _, asset := range assets {
+		usage = append(usage, newBudgetUsage(asset, perAsset[asset], budgetConfig.AssetLimits[asset]))
+	}
+
+	// Keep the remaining-budget gauges current for anyone scraping /metrics
+	for _, u := range usage {
+		if u.Limit > 0 {
+			setGauge("tracker_budget_remaining", map[string]string{"scope": u.Scope}, float64(u.Remaining))
+		}
+		setGauge("tracker_budget_used", map[string]string{"scope": u.Scope}, float64(u.Used))
+	}
+
+	return usage, nil
+}
+
+// newBudgetUsage builds a BudgetUsage, clamping Remaining at zero
+func newBudgetUsage(scope string, used, limit int) BudgetUsage {
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return BudgetUsage{Scope: scope, Used: used, Limit: limit, Remaining: remaining}
+}
+
+// checkBudget returns an error if calling the provider for asset would exceed a limit
+func checkBudget(repo *Repository, asset string) error {
+	usage, err := getBudgetUsage(repo)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range usage {
+		if u.Limit == 0 || (u.Scope != "global" && u.Scope != asset) {
+			continue
+		}
+		if u.Remaining == 0 {
+			return fmt.Errorf("%w for %s (%d/%d calls in %s)",
+				errBudgetExhausted, u.Scope, u.Used, u.Limit, budgetConfig.Window)
+		}
+	}
+	return nil
+}
+
+// nextFetchDelay returns how long the scheduler should wait before the next fetch
+// Below the stretch threshold this is just the base interval. Above it, the remaining
+// calls are spread evenly across a full window so we never run into the hard cap.
+func nextFetchDelay(repo *Repository, base time.Duration) time.Duration {
+	usage, err := getBudgetUsage(repo)
+	if err != nil {
+		slog.Warn("Could not read fetch budget, using base interval", "error", err)
+		return base
+	}
+
+	delay := base
+	for _, u := range usage {
+		if u.Limit == 0 || float64(u.Used) < budgetConfig.StretchAt*float64(u.Limit) {
+			continue
+		}
+
+		// With nothing left, wait a whole window so the oldest calls age out
+		stretched := budgetConfig.Window
+		if u.Remaining > 0 {
+			stretched = budgetConfig.Window / time.Duration(u.Remaining)
+		}
+
+		if stretched > delay {
+			slog.Info("Fetch budget running low, stretching interval",
+				"scope", u.Scope, "used", u.Used, "limit", u.Limit, "interval", stretched.Round(time.Second))
+			delay = stretched
+		}
+	}
+
+	setGauge("tracker_fetch_interval_seconds", nil, delay.Seconds())
+	return delay
+}
+
+// displayBudget prints the current budget usage for each scope
+func displayBudget(repo *Repository) {
+	usage, err := getBudgetUsage(repo)
+	if err != nil {
+		slog.Error("Failed to fetch budget usage", "error", err)
+		return
+	}
+
+	fmt.Printf("\nFetch budget (rolling window: %s)\n", budgetConfig.Window)
+	fmt.Printf("%-12s %-8s %-8s %-10s\n", "Scope", "Used", "Limit", "Remaining")
+	fmt.Println("----------------------------------------")
+	for _, u := range usage {
+		limit, remaining := "-", "-"
+		if u.Limit > 0 {
+			limit = strconv.Itoa(u.Limit)
+			remaining = strconv.Itoa(u.Remaining)
+		}
+		fmt.Printf("%-12s %-8d %-8s %-10s\n", u.Scope, u.Used, limit, remaining)
+	}
+	fmt.Println()
+}
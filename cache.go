@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bufio"         // Package for reading Redis replies
+	"context"       // Package for bounding cache round trips
+	"crypto/tls"    // Package for rediss:// connections
+	"encoding/json" // Package for encoding cached results
+	"errors"        // Package for Redis error replies
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for reading bulk replies
+	"log/slog"      // Package for structured logging
+	"net"           // Package for Redis connections
+	"net/url"       // Package for parsing REDIS_URL
+	"os"            // Package for environment variables
+	"strconv"       // Package for RESP lengths and cache keys
+	"strings"       // Package for string manipulation
+	"sync"          // Package for guarding the in-memory cache
+	"sync/atomic"   // Package for the degraded-cache flag
+	"time"          // Package for expiry
+)
+
+// Cache settings that are not configurable
+const (
+	cacheMaxEntries = 1024                     // In-memory entries kept before expired ones are swept
+	redisTimeout    = time.Second              // Longest a cache round trip may take before the database is used instead
+	redisKeyPrefix  = "bitcoin-tracker:cache:" // Namespace of the tracker's keys in a shared Redis
+	redisMaxIdle    = 4                        // Idle Redis connections kept for reuse
+)
+
+// CacheConfig controls the read cache in front of the database
+type CacheConfig struct {
+	TTL      time.Duration // How long a query result is served from the cache; 0 turns caching off
+	Window   time.Duration // Range queries starting at most this long ago are cached
+	RedisURL string        // Redis server shared by every process, instead of memory in each
+}
+
+// cacheConfig is the active configuration, loaded at startup
+var cacheConfig = CacheConfig{TTL: 10 * time.Second, Window: 48 * time.Hour}
+
+// loadCacheConfig reads CACHE_TTL, CACHE_WINDOW (Go durations), and REDIS_URL
+func loadCacheConfig() (CacheConfig, error) {
+	c := CacheConfig{TTL: 10 * time.Second, Window: 48 * time.Hour, RedisURL: os.Getenv("REDIS_URL")}
+	if v := os.Getenv("CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return c, fmt.Errorf("invalid CACHE_TTL %q", v)
+		}
+		c.TTL = d
+	}
+	if v := os.Getenv("CACHE_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid CACHE_WINDOW %q", v)
+		}
+		c.Window = d
+	}
+	if c.RedisURL != "" {
+		if _, err := newRedisClient(c.RedisURL); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// cacheBackend stores encoded query results
+// Entries belong to a generation; invalidating starts a new one, so every entry
+// stored before it is left to expire unread. A result computed while the generation
+// changed is stored under the old one and so is never served.
+type cacheBackend interface {
+	// generation returns the current generation
+	generation(ctx context.Context) (int64, error)
+	// get returns the value stored for key in gen; false when there is none
+	get(ctx context.Context, gen int64, key string) ([]byte, bool, error)
+	// set stores a value for key in gen for ttl
+	set(ctx context.Context, gen int64, key string, value []byte, ttl time.Duration) error
+	// invalidate starts a new generation
+	invalidate(ctx context.Context) error
+}
+
+// memoryEntry is one cached value of memoryCache
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// memoryCache keeps entries in this process
+type memoryCache struct {
+	mu      sync.Mutex
+	gen     int64
+	entries map[string]memoryEntry
+}
+
+// newMemoryCache returns an empty in-memory cache
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: make(map[string]memoryEntry)}
+}
+
+// generation implements cacheBackend
+func (m *memoryCache) generation(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gen, nil
+}
+
+// get implements cacheBackend
+func (m *memoryCache) get(ctx context.Context, gen int64, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok || gen != m.gen {
+		return nil, false, nil
+	}
+	if time.Now().After(e.expires) {
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// set implements cacheBackend
+func (m *memoryCache) set(ctx context.Context, gen int64, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if gen != m.gen {
+		return nil // Computed before an invalidation
+	}
+	now := time.Now()
+	if len(m.entries) >= cacheMaxEntries {
+		for k, e := range m.entries {
+			if now.After(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+		if len(m.entries) >= cacheMaxEntries {
+			m.entries = make(map[string]memoryEntry)
+		}
+	}
+	m.entries[key] = memoryEntry{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+// invalidate implements cacheBackend
+func (m *memoryCache) invalidate(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gen++
+	m.entries = make(map[string]memoryEntry)
+	return nil
+}
+
+// redisCache keeps entries in Redis, shared by every process using the same server
+// The generation is a counter key, so an insert by the scheduler invalidates the
+// entries an API server in another process would serve.
+type redisCache struct {
+	client *redisClient
+}
+
+// generation implements cacheBackend
+func (r *redisCache) generation(ctx context.Context) (int64, error) {
+	reply, err := r.client.do(ctx, "GET", redisKeyPrefix+"gen")
+	if err != nil || reply == nil {
+		return 0, err
+	}
+	gen, err := strconv.ParseInt(string(reply.([]byte)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache generation %q in Redis", reply)
+	}
+	return gen, nil
+}
+
+// entryKey returns the Redis key of an entry
+func (r *redisCache) entryKey(gen int64, key string) string {
+	return redisKeyPrefix + strconv.FormatInt(gen, 10) + ":" + key
+}
+
+// get implements cacheBackend
+func (r *redisCache) get(ctx context.Context, gen int64, key string) ([]byte, bool, error) {
+	reply, err := r.client.do(ctx, "GET", r.entryKey(gen, key))
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	return reply.([]byte), true, nil
+}
+
+// set implements cacheBackend
+func (r *redisCache) set(ctx context.Context, gen int64, key string, value []byte, ttl time.Duration) error {
+	_, err := r.client.do(ctx, "SET", r.entryKey(gen, key), string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// invalidate implements cacheBackend
+func (r *redisCache) invalidate(ctx context.Context) error {
+	_, err := r.client.do(ctx, "INCR", redisKeyPrefix+"gen")
+	return err
+}
+
+// redisClient is a minimal client of the Redis protocol (RESP), enough for the
+// cache's GET, SET, and INCR, with a small pool of connections
+type redisClient struct {
+	addr     string
+	tls      *tls.Config // Set for rediss:// URLs
+	username string
+	password string
+	db       int
+	idle     chan *redisConn
+}
+
+// redisConn is one connection to Redis
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// newRedisClient parses a redis://[user:password@]host[:port][/db] or rediss:// URL
+// Nothing is dialed until the first command.
+func newRedisClient(raw string) (*redisClient, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, errors.New("invalid REDIS_URL (expected redis://[user:password@]host:port/db)") // The URL may hold a password
+	}
+	c := &redisClient{addr: u.Host, idle: make(chan *redisConn, redisMaxIdle)}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.Scheme == "rediss" {
+		c.tls = &tls.Config{ServerName: u.Hostname()}
+	}
+	if u.User != nil {
+		c.password, _ = u.User.Password()
+		if c.password == "" {
+			c.password = u.User.Username() // redis://secret@host is a password alone
+		} else {
+			c.username = u.User.Username()
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil || c.db < 0 {
+			return nil, fmt.Errorf("invalid database %q in REDIS_URL", db)
+		}
+	}
+	return c, nil
+}
+
+// dial opens a connection, authenticating and selecting the database
+func (c *redisClient) dial(ctx context.Context) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if c.tls != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: c.tls}).DialContext(ctx, "tcp", c.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	rc := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+	var setup [][]string
+	if c.password != "" && c.username != "" {
+		setup = append(setup, []string{"AUTH", c.username, c.password})
+	} else if c.password != "" {
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, args := range setup {
+		if _, err := rc.roundTrip(ctx, args); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to set up Redis connection (%s): %w", args[0], err)
+		}
+	}
+	return rc, nil
+}
+
+// do runs one command and returns its reply: nil, []byte, or int64
+// Error replies are returned as errors and leave the connection usable.
+func (c *redisClient) do(ctx context.Context, args ...string) (interface{}, error) {
+	var conn *redisConn
+	select {
+	case conn = <-c.idle:
+	default:
+		var err error
+		if conn, err = c.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := conn.roundTrip(ctx, args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close() // The stream may be out of step
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// redisError is an error reply from the server
+type redisError string
+
+// Error implements error
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// roundTrip writes a command as an array of bulk strings and reads the reply
+func (rc *redisConn) roundTrip(ctx context.Context, args []string) (interface{}, error) {
+	deadline := time.Now().Add(redisTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	rc.SetDeadline(deadline)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := rc.Write([]byte(b.String())); err != nil {
+		return nil, fmt.Errorf("failed to send Redis command: %w", err)
+	}
+	return rc.readReply()
+}
+
+// readReply reads one simple string, error, integer, or bulk string reply
+func (rc *redisConn) readReply() (interface{}, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Redis reply: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty Redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis integer reply %q", line)
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis bulk length %q", line)
+		}
+		if size < 0 {
+			return nil, nil // Missing key
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, fmt.Errorf("failed to read Redis reply: %w", err)
+		}
+		return buf[:size], nil
+	default:
+		return nil, fmt.Errorf("unsupported Redis reply %q", line)
+	}
+}
+
+// newCacheBackend returns the Redis cache when REDIS_URL is set, else an in-memory one
+func newCacheBackend(c CacheConfig) (cacheBackend, error) {
+	if c.RedisURL == "" {
+		return newMemoryCache(), nil
+	}
+	client, err := newRedisClient(c.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisCache{client: client}, nil
+}
+
+// cachedStore serves the reads dashboards and API clients poll (the latest prices and
+// ranges reaching up to now) from a short-lived cache. Every write to the prices
+// drops the cache, and the live price feed does too when it sees prices saved by
+// another process, so results are at most CACHE_TTL stale only across processes
+// that share no Redis and run no feed.
+type cachedStore struct {
+	Store
+	cache    cacheBackend
+	degraded atomic.Bool // A cache error was logged; cleared when the cache works again
+}
+
+// cachedPrices returns the cached result of a query, or runs load and caches its result
+// A failing cache is bypassed, so reads only depend on the database.
+func (s *cachedStore) cachedPrices(ctx context.Context, query, key string, load func() ([]PriceRecord, error)) ([]PriceRecord, error) {
+	gen, err := s.cache.generation(ctx)
+	if err != nil {
+		s.cacheFailed(query, err)
+		return load()
+	}
+	data, ok, err := s.cache.get(ctx, gen, key)
+	if err != nil {
+		s.cacheFailed(query, err)
+		return load()
+	}
+	if ok {
+		var prices []PriceRecord
+		if err := json.Unmarshal(data, &prices); err == nil {
+			s.cacheWorked(query, "hit")
+			return prices, nil
+		}
+	}
+
+	prices, err := load()
+	if err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(prices)
+	if err != nil {
+		return prices, nil
+	}
+	if err := s.cache.set(ctx, gen, key, data, cacheConfig.TTL); err != nil {
+		s.cacheFailed(query, err)
+		return prices, nil
+	}
+	s.cacheWorked(query, "miss")
+	return prices, nil
+}
+
+// cacheWorked counts a lookup and notes that the cache is healthy again
+func (s *cachedStore) cacheWorked(query, result string) {
+	incCounter("tracker_cache_requests_total", map[string]string{"query": query, "result": result}, 1)
+	if s.degraded.CompareAndSwap(true, false) {
+		slog.Info("Price cache recovered")
+	}
+}
+
+// cacheFailed counts a failed lookup, logging only the first of a run of failures
+func (s *cachedStore) cacheFailed(query string, err error) {
+	incCounter("tracker_cache_requests_total", map[string]string{"query": query, "result": "error"}, 1)
+	if s.degraded.CompareAndSwap(false, true) {
+		slog.Warn("Price cache failed; reading from the database", "error", err)
+	}
+}
+
+// invalidate drops every cached result
+func (s *cachedStore) invalidate() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := s.cache.invalidate(ctx); err != nil {
+		// Entries already cached expire within CACHE_TTL
+		s.cacheFailed("invalidate", err)
+	}
+}
+
+// invalidatePriceCache drops the cached prices after prices were saved elsewhere
+func invalidatePriceCache(repo *Repository) {
+	if c, ok := databaseStore(repo).(*cachedStore); ok {
+		c.invalidate()
+	}
+}
+
+// LatestPrices implements Store
+func (s *cachedStore) LatestPrices(ctx context.Context, limit int, currency string) ([]PriceRecord, error) {
+	key := "latest:" + strconv.Itoa(limit) + ":" + currency
+	return s.cachedPrices(ctx, "latest", key, func() ([]PriceRecord, error) {
+		return s.Store.LatestPrices(ctx, limit, currency)
+	})
+}
+
+// LatestPerCurrency implements Store
+func (s *cachedStore) LatestPerCurrency(ctx context.Context) ([]PriceRecord, error) {
+	return s.cachedPrices(ctx, "latest", "latest:each", func() ([]PriceRecord, error) {
+		return s.Store.LatestPerCurrency(ctx)
+	})
+}
+
+// PriceRange implements Store
+// Open-ended ranges starting within CACHE_WINDOW are cached. Clients ask for "the last
+// 24 hours" with a start that moves on every request, so the range is read from the
+// start of that minute and trimmed, letting requests within the minute share it.
+func (s *cachedStore) PriceRange(currency string, from, to time.Time, limit int) ([]PriceRecord, error) {
+	if !to.IsZero() || time.Since(from) > cacheConfig.Window {
+		return s.Store.PriceRange(currency, from, to, limit)
+	}
+
+	start := from.Truncate(time.Minute)
+	key := "range:" + currency + ":" + strconv.FormatInt(start.Unix(), 10) + ":" + strconv.Itoa(limit)
+	prices, err := s.cachedPrices(context.Background(), "range", key, func() ([]PriceRecord, error) {
+		return s.Store.PriceRange(currency, start, time.Time{}, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	full := len(prices) == limit
+	i := 0
+	for i < len(prices) && prices[i].Timestamp.Before(from) {
+		i++
+	}
+	if full && i > 0 {
+		// The limit cut the range short, and trimming would shorten it further
+		return s.Store.PriceRange(currency, from, to, limit)
+	}
+	return prices[i:], nil
+}
+
+// SavePrices implements Store, dropping the cache
+func (s *cachedStore) SavePrices(ctx context.Context, records []PriceRecord) error {
+	defer s.invalidate()
+	return s.Store.SavePrices(ctx, records)
+}
+
+// SaveHistoricalPrices implements Store, dropping the cache when anything was inserted
+func (s *cachedStore) SaveHistoricalPrices(ctx context.Context, records []PriceRecord) (int, error) {
+	n, err := s.Store.SaveHistoricalPrices(ctx, records)
+	if n > 0 {
+		s.invalidate()
+	}
+	return n, err
+}
+
+// DownsamplePrices implements Store, dropping the cache when rows were replaced
+func (s *cachedStore) DownsamplePrices(resolution string, from, before time.Time, dryRun bool) (int, int, error) {
+	replaced, averages, err := s.Store.DownsamplePrices(resolution, from, before, dryRun)
+	if replaced > 0 && !dryRun {
+		s.invalidate()
+	}
+	return replaced, averages, err
+}
+
+// PurgePrices implements Store, dropping the cache when rows were deleted
+func (s *cachedStore) PurgePrices(before time.Time, dryRun bool) (int, error) {
+	n, err := s.Store.PurgePrices(before, dryRun)
+	if n > 0 && !dryRun {
+		s.invalidate()
+	}
+	return n, err
+}
+
+// DeletePrices implements Store, dropping the cache when rows were deleted
+func (s *cachedStore) DeletePrices(from, to time.Time, maxID int) (int, error) {
+	n, err := s.Store.DeletePrices(from, to, maxID)
+	if n > 0 {
+		s.invalidate()
+	}
+	return n, err
+}
+
+// CorrectPrice implements Store, dropping the cache when a price was corrected
+func (s *cachedStore) CorrectPrice(ctx context.Context, c PriceCorrection) (PriceCorrection, error) {
+	c, err := s.Store.CorrectPrice(ctx, c)
+	if err == nil {
+		s.invalidate()
+	}
+	return c, err
+}
+
+// DedupePrices implements Store, dropping the cache when rows were deleted
+func (s *cachedStore) DedupePrices(window time.Duration, dryRun bool) (int, error) {
+	n, err := s.Store.DedupePrices(window, dryRun)
+	if n > 0 && !dryRun {
+		s.invalidate()
+	}
+	return n, err
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"  // Package for candle queries
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for the price range of displayed candles
+	"strconv"  // Package for parsing the candle count
+	"strings"  // Package for string manipulation
+	"time"     // Package for bucket boundaries
+)
+
+// Candle resolutions, stored in bitcoin_candles.resolution
+const (
+	CandleHourly = "1h"
+	CandleDaily  = "1d"
+)
+
+// candleResolutions lists every resolution rolled up after each fetch
+var candleResolutions = []string{CandleHourly, CandleDaily}
+
+// defaultCandleCount is how many candles display and the API return by default
+const defaultCandleCount = 48
+
+// Candle is the open/high/low/close summary of the prices in one time bucket
+type Candle struct {
+	Currency   string    `json:"currency"`   // Fiat currency the prices are quoted in
+	Resolution string    `json:"resolution"` // 1h or 1d
+	Start      time.Time `json:"start"`      // Start of the bucket (UTC)
+	Open       float64   `json:"open"`       // First price in the bucket
+	High       float64   `json:"high"`       // Highest price in the bucket
+	Low        float64   `json:"low"`        // Lowest price in the bucket
+	Close      float64   `json:"close"`      // Last price in the bucket
+	Samples    int       `json:"samples"`    // Number of raw prices rolled up
+}
+
+// parseCandleResolution validates a resolution name
+func parseCandleResolution(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case CandleHourly, "hourly":
+		return CandleHourly, nil
+	case CandleDaily, "daily":
+		return CandleDaily, nil
+	default:
+		return "", fmt.Errorf("invalid candle resolution %q (expected 1h or 1d)", s)
+	}
+}
+
+// candleDuration returns the width of one candle
+func candleDuration(resolution string) time.Duration {
+	if resolution == CandleDaily {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// candleStart returns the start of the bucket containing t
+// Buckets are aligned to UTC so daily candles run from midnight to midnight UTC
+func candleStart(t time.Time, resolution string) time.Time {
+	t = t.UTC()
+	if resolution == CandleDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// rollupCandles rolls raw prices into candles for one currency and resolution
+// Buckets from from onwards are rebuilt. A zero from resumes at the newest stored
+// candle, since that candle may have been partial when it was last computed.
+// It returns the candles saved.
+func rollupCandles(repo *Repository, currency, resolution string, from time.Time) ([]Candle, error) {
+	if from.IsZero() {
+		if start, ok, err := repo.LatestCandleStart(currency, resolution); err != nil {
+			return nil, err
+		} else if ok {
+			from = start
+		}
+	} else {
+		from = candleStart(from, resolution)
+	}
+
+	var candles []Candle
+	var current *Candle
+	err := forEachPrice(repo, currency, from, time.Time{}, func(r PriceRecord) error {
+		start := candleStart(r.Timestamp, resolution)
+		if current == nil || !start.Equal(current.Start) {
+			candles = append(candles, Candle{
+				Currency:   currency,
+				Resolution: resolution,
+				Start:      start,
+				Open:       r.Price,
+				High:       r.Price,
+				Low:        r.Price,
+			})
+			current = &candles[len(candles)-1]
+		}
+		if r.Price > current.High {
+			current.High = r.Price
+		}
+		if r.Price < current.Low {
+			current.Low = r.Price
+		}
+		current.Close = r.Price
+		current.Samples++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) == 0 {
+		return nil, nil
+	}
+	if err := repo.SaveCandles(candles); err != nil {
+		return nil, err
+	}
+	return candles, nil
+}
+
+// updateCandles rolls up prices from from (zero = new prices only), looks for
+// patterns on the rebuilt candles, and recomputes their indicators
+func updateCandles(repo *Repository, currency, resolution string, from time.Time) (int, error) {
+	candles, err := rollupCandles(repo, currency, resolution, from)
+	if err != nil || len(candles) == 0 {
+		return 0, err
+	}
+	if err := refreshPatterns(repo, currency, resolution, candles[0].Start); err != nil {
+		return len(candles), fmt.Errorf("failed to detect patterns: %w", err)
+	}
+	if _, err := updateIndicators(repo, currency, resolution, candles[0].Start); err != nil {
+		return len(candles), fmt.Errorf("failed to compute indicators: %w", err)
+	}
+	return len(candles), nil
+}
+
+// refreshCandles rolls up new prices, detects patterns, and computes indicators for every configured
+// currency and resolution until ctx is done. Failures are logged rather than returned so they
+// never fail a fetch
+func refreshCandles(ctx context.Context, repo *Repository) {
+	for _, currency := range currencies {
+		for _, resolution := range candleResolutions {
+			if ctx.Err() != nil {
+				return
+			}
+			if _, err := updateCandles(repo, currency, resolution, time.Time{}); err != nil {
+				slog.Error("Failed to roll up candles", "currency", currency, "resolution", resolution, "error", err)
+			}
+		}
+	}
+}
+
+// recentCandles returns the newest count candles, oldest first, daily ones aligned to
+// midnight in the display zone
+func recentCandles(repo *Repository, currency, resolution string, count int) ([]Candle, error) {
+	from := candleStart(time.Now(), resolution).Add(-time.Duration(count-1) * candleDuration(resolution))
+	if resolution == CandleDaily {
+		from = localMidnight(time.Now(), displayLocation).AddDate(0, 0, -(count - 1))
+	}
+	return candlesIn(context.Background(), repo, currency, resolution, from, time.Time{}, count, displayLocation)
+}
+
+// displayCandles prints the most recent candles for a currency
+func displayCandles(repo *Repository, currency, resolution string, count int) {
+	candles, err := recentCandles(repo, currency, resolution, count)
+	if err != nil {
+		slog.Error("Failed to fetch candles", "error", err)
+		return
+	}
+	if len(candles) == 0 {
+		slog.Info("No candles found; run \"candles rollup\" to build them from stored prices")
+		return
+	}
+
+	layout := "2006-01-02 15:04"
+	if resolution == CandleDaily {
+		layout = "2006-01-02"
+	}
+
+	fmt.Printf("\n%s candles (%s)\n", resolution, strings.ToUpper(currency))
+	fmt.Printf("%-17s %-12s %-12s %-12s %-12s %-7s\n", "Start", "Open", "High", "Low", "Close", "Samples")
+	fmt.Println("------------------------------------------------------------------------------")
+	for _, c := range candles {
+		fmt.Printf("%-17s %-12.2f %-12.2f %-12.2f %-12.2f %-7d\n",
+			c.Start.In(displayLocation).Format(layout), c.Open, c.High, c.Low, c.Close, c.Samples)
+	}
+
+	// Mark the support/resistance levels the shown candles traded through
+	levels, err := repo.PriceLevels(currency)
+	if err != nil {
+		slog.Warn("Failed to fetch price levels", "error", err)
+	}
+	low, high := candles[0].Low, candles[0].High
+	for _, c := range candles {
+		low, high = math.Min(low, c.Low), math.Max(high, c.High)
+	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		if l := levels[i]; l.Price >= low && l.Price <= high {
+			fmt.Printf("%-17s %-12.2f (%d touches)\n", l.Kind, l.Price, l.Touches)
+		}
+	}
+	fmt.Println()
+}
+
+// runCandlesCommand handles "candles rollup" and "candles [1h|1d] [currency] [count]"
+func runCandlesCommand(repo *Repository, args []string) error {
+	if len(args) > 0 && args[0] == "rollup" {
+		for _, currency := range currencies {
+			for _, resolution := range candleResolutions {
+				n, err := updateCandles(repo, currency, resolution, time.Time{})
+				if err != nil {
+					return fmt.Errorf("failed to roll up %s candles for %s: %w", resolution, strings.ToUpper(currency), err)
+				}
+				slog.Info("Saved candles", "currency", currency, "resolution", resolution, "count", n)
+			}
+			if _, err := updatePriceLevels(repo, currency); err != nil {
+				return fmt.Errorf("failed to update price levels for %s: %w", strings.ToUpper(currency), err)
+			}
+		}
+		return nil
+	}
+
+	resolution, currency, count := CandleHourly, currencies[0], defaultCandleCount
+	if len(args) > 0 {
+		r, err := parseCandleResolution(args[0])
+		if err != nil {
+			return err
+		}
+		resolution = r
+	}
+	if len(args) > 1 {
+		currency = strings.ToLower(args[1])
+	}
+	if len(args) > 2 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid candle count %q", args[2])
+		}
+		count = n
+	}
+
+	displayCandles(repo, currency, resolution, count)
+	return nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"  // Package for probe requests
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"net/http" // Package for the HTTP API
+	"slices"   // Package for sorting and searching lists
+	"strings"  // Package for string manipulation
+	"sync"     // Package for guarding the capability cache
+	"time"     // Package for history dates and caching
+)
+
+// capabilityCacheTTL is how long GET /providers reuses probed capabilities
+// Provider listings rarely change, and every probe counts against the fetch budget
+const capabilityCacheTTL = time.Hour
+
+// ProviderCapabilities describes what a price provider offers, so the right one can be
+// picked for live fetching (PRICE_SOURCES) and for backfill
+type ProviderCapabilities struct {
+	Provider    string   `json:"provider"`
+	Configured  int      `json:"configured"`            // Position in PRICE_SOURCES (1 = primary), 0 when unused
+	Assets      []string `json:"assets"`                // Tracked assets the provider quotes
+	Currencies  []string `json:"currencies"`            // Quote currencies available for Bitcoin
+	Missing     []string `json:"missing_currencies"`    // Configured CURRENCIES the provider can't quote
+	Live        string   `json:"live"`                  // What a live fetch returns
+	History     string   `json:"history"`               // Granularity of the provider's historical data
+	HistoryFrom string   `json:"history_from"`          // How far back historical data goes
+	Backfill    bool     `json:"backfill"`              // Whether the backfill command imports from it
+	Attribution string   `json:"attribution,omitempty"` // Credit the provider's terms ask for
+	Probed      bool     `json:"probed"`                // Assets and currencies come from the provider's listings
+	ProbeError  string   `json:"probe_error,omitempty"` // Why probing failed; the rest is built-in metadata
+}
+
+// finishCapabilities fills in the probed fields from quotes (tracked asset -> currencies)
+func finishCapabilities(c ProviderCapabilities, quotes map[string][]string, err error) ProviderCapabilities {
+	c.Assets, c.Currencies, c.Missing = []string{}, []string{}, []string{}
+	if err != nil {
+		c.ProbeError = err.Error()
+		return c
+	}
+
+	c.Probed = true
+	for asset, list := range quotes {
+		if len(list) > 0 {
+			c.Assets = append(c.Assets, asset)
+		}
+	}
+	slices.Sort(c.Assets)
+	c.Currencies = slices.Clone(quotes["bitcoin"])
+	slices.Sort(c.Currencies)
+	c.Currencies = slices.Compact(c.Currencies)
+	for _, currency := range currencies {
+		if !slices.Contains(c.Currencies, currency) {
+			c.Missing = append(c.Missing, currency)
+		}
+	}
+	return c
+}
+
+// Capabilities implements PriceSource
+// simple/price accepts any asset ID, so every tracked asset gets the same currencies
+func (s coinGeckoSource) Capabilities(ctx context.Context, repo *Repository) ProviderCapabilities {
+	c := ProviderCapabilities{
+		Provider:    s.Name(),
+		Live:        "spot price, every currency in one request",
+		History:     "5m for the last day, hourly up to 90 days, daily beyond",
+		HistoryFrom: "365 days on the public API (2013 with a paid plan)",
+		Backfill:    true,
+	}
+
+	// Response format: ["btc", "eth", "usd", "eur", ...]
+	var list []string
+	err := getJSON(ctx, repo, s.Name(), "bitcoin", coinGeckoAPI.BaseURL()+"/simple/supported_vs_currencies", &list)
+	quotes := make(map[string][]string)
+	for asset := range tickerSymbol {
+		quotes[asset] = list
+	}
+	return finishCapabilities(c, quotes, err)
+}
+
+// Capabilities implements PriceSource
+// Spot prices exist for every fiat currency Coinbase lists
+func (s coinbaseSource) Capabilities(ctx context.Context, repo *Repository) ProviderCapabilities {
+	c := ProviderCapabilities{
+		Provider:    s.Name(),
+		Live:        "spot price, one request per currency",
+		History:     "1m to 1d candles (Exchange API)",
+		HistoryFrom: "2015 for BTC-USD",
+	}
+
+	// Response format: {"data": [{"id": "USD", "name": "US Dollar", ...}, ...]}
+	var data struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	err := getJSON(ctx, repo, s.Name(), "bitcoin", "https://api.coinbase.com/v2/currencies", &data)
+	var list []string
+	for _, currency := range data.Data {
+		list = append(list, strings.ToLower(currency.ID))
+	}
+	quotes := make(map[string][]string)
+	for asset := range tickerSymbol {
+		quotes[asset] = list
+	}
+	return finishCapabilities(c, quotes, err)
+}
+
+// Capabilities implements PriceSource
+// Markets come from the ticker list; the first daily kline shows how far history goes
+func (s binanceSource) Capabilities(ctx context.Context, repo *Repository) ProviderCapabilities {
+	c := ProviderCapabilities{
+		Provider:    s.Name(),
+		Live:        "last trade, one request per currency (usd via USDT)",
+		History:     "1s to 1M klines",
+		HistoryFrom: "2017 for BTC/USDT",
+	}
+	quotes, err := probeMarkets(ctx, repo, binanceMarkets)
+	if err != nil {
+		return finishCapabilities(c, nil, err)
+	}
+
+	// Response format: [[1502928000000, "4261.48", ...]] (open time in milliseconds first)
+	var klines [][]interface{}
+	url := "https://api.binance.com/api/v3/klines?symbol=" + tickerSymbol["bitcoin"] + "USDT&interval=1d&startTime=0&limit=1"
+	if err := getJSON(ctx, repo, s.Name(), "bitcoin", url, &klines); err == nil && len(klines) == 1 && len(klines[0]) > 0 {
+		if ms, ok := klines[0][0].(float64); ok {
+			c.HistoryFrom = time.UnixMilli(int64(ms)).UTC().Format("2006-01-02") + " for BTC/USDT"
+		}
+	}
+	return finishCapabilities(c, quotes, nil)
+}
+
+// Capabilities implements PriceSource
+// Markets come from the asset pair list
+func (s krakenSource) Capabilities(ctx context.Context, repo *Repository) ProviderCapabilities {
+	c := ProviderCapabilities{
+		Provider:    s.Name(),
+		Live:        "last trade, one request per currency",
+		History:     "1m to 15d OHLC",
+		HistoryFrom: "the newest 720 candles per interval (e.g. about 2 years of daily candles)",
+	}
+	quotes, err := probeMarkets(ctx, repo, krakenMarkets)
+	return finishCapabilities(c, quotes, err)
+}
+
+// probeMarkets returns the quote currencies of every tracked asset from a market listing
+func probeMarkets(ctx context.Context, repo *Repository, listing func(ctx context.Context, repo *Repository, ticker string) (map[string]string, error)) (map[string][]string, error) {
+	quotes := make(map[string][]string)
+	for asset, ticker := range tickerSymbol {
+		markets, err := listing(ctx, repo, ticker)
+		if err != nil {
+			return nil, err
+		}
+		for currency := range markets {
+			quotes[asset] = append(quotes[asset], currency)
+		}
+	}
+	return quotes, nil
+}
+
+// probeProviders returns the capabilities of every built-in provider, configured ones
+// first in PRICE_SOURCES order. Providers are probed concurrently.
+func probeProviders(repo *Repository) []ProviderCapabilities {
+	list := make([]ProviderCapabilities, 0, len(availableSources))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, source := range availableSources {
+		wg.Add(1)
+		go func(source PriceSource) {
+			defer wg.Done()
+			c := source.Capabilities(context.Background(), repo)
+			if a, ok := providerAttributions[source.Name()]; ok {
+				c.Attribution = a.String()
+			}
+			for i, configured := range priceSources {
+				if configured.Name() == source.Name() {
+					c.Configured = i + 1
+				}
+			}
+			if c.ProbeError != "" {
+				slog.Warn("Provider probe failed", "source", source.Name(), "error", c.ProbeError)
+			}
+			mu.Lock()
+			list = append(list, c)
+			mu.Unlock()
+		}(source)
+	}
+	wg.Wait()
+
+	slices.SortFunc(list, func(a, b ProviderCapabilities) int {
+		// Unused providers (0) sort after configured ones
+		ai, bi := a.Configured, b.Configured
+		if ai == 0 {
+			ai = len(availableSources) + 1
+		}
+		if bi == 0 {
+			bi = len(availableSources) + 1
+		}
+		if ai != bi {
+			return ai - bi
+		}
+		return strings.Compare(a.Provider, b.Provider)
+	})
+	return list
+}
+
+// capabilityCache holds the last probe for GET /providers
+var capabilityCache struct {
+	sync.Mutex
+	list    []ProviderCapabilities
+	fetched time.Time
+}
+
+// cachedProviderCapabilities returns probed capabilities no older than capabilityCacheTTL
+func cachedProviderCapabilities(repo *Repository) []ProviderCapabilities {
+	capabilityCache.Lock()
+	defer capabilityCache.Unlock()
+	if capabilityCache.list == nil || time.Since(capabilityCache.fetched) > capabilityCacheTTL {
+		capabilityCache.list = probeProviders(repo)
+		capabilityCache.fetched = time.Now()
+	}
+	return capabilityCache.list
+}
+
+// handleProviders serves GET /providers
+// It lists every built-in provider's assets, currencies, and historical data
+func (s *apiServer) handleProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, cachedProviderCapabilities(s.repo))
+}
+
+// displayProviders prints what each built-in provider offers
+func displayProviders(repo *Repository) {
+	fmt.Println("\nPrice Providers")
+	fmt.Println("------------------------------------------------------------")
+	for _, c := range probeProviders(repo) {
+		role := "not configured"
+		switch {
+		case c.Configured == 1:
+			role = "primary"
+		case c.Configured > 1:
+			role = fmt.Sprintf("fallback %d", c.Configured-1)
+		}
+		fmt.Printf("%s (%s)\n", c.Provider, role)
+
+		if c.Probed {
+			shown := c.Currencies
+			more := ""
+			if len(shown) > 15 {
+				more = fmt.Sprintf(", and %d more", len(shown)-15)
+				shown = shown[:15]
+			}
+			fmt.Printf("  %-12s %s\n", "Assets:", strings.Join(c.Assets, ", "))
+			fmt.Printf("  %-12s %s%s\n", "Currencies:", strings.Join(shown, ", "), more)
+			if len(c.Missing) > 0 {
+				fmt.Printf("  %-12s %s\n", "Missing:", strings.Join(c.Missing, ", "))
+			}
+		} else {
+			fmt.Printf("  %-12s %s\n", "Probe:", "failed, "+c.ProbeError)
+		}
+		backfill := "no"
+		if c.Backfill {
+			backfill = "yes"
+		}
+		fmt.Printf("  %-12s %s\n", "Live:", c.Live)
+		fmt.Printf("  %-12s %s\n", "History:", c.History)
+		fmt.Printf("  %-12s %s\n", "Since:", c.HistoryFrom)
+		fmt.Printf("  %-12s %s\n", "Backfill:", backfill)
+		if c.Attribution != "" {
+			fmt.Printf("  %-12s %s\n", "Credit:", c.Attribution)
+		}
+		fmt.Println()
+	}
+}
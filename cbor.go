@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/binary" // Package for CBOR argument lengths
+	"errors"          // Package for decoding errors
+	"fmt"             // Package for formatted I/O operations
+)
+
+// CBOR major types used by WebAuthn attestation objects and COSE keys
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborSimple   = 7
+)
+
+// cborMaxDepth bounds nesting, so a hostile message can't exhaust the stack
+const cborMaxDepth = 16
+
+// errCBORTruncated reports a message that ends inside an item
+var errCBORTruncated = errors.New("truncated CBOR data")
+
+// decodeCBOR decodes the first item of data and returns it with the bytes after it
+// Items decode to int64, []byte, string, bool, nil, []interface{}, or
+// map[interface{}]interface{} with int64 or string keys. Only definite lengths are
+// supported, which is all that authenticators produce (CTAP2 canonical CBOR).
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+// cborArgument reads the argument of an item's initial byte: a value or a length
+func cborArgument(data []byte) (major byte, arg uint64, rest []byte, err error) {
+	if len(data) == 0 {
+		return 0, 0, nil, errCBORTruncated
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+	switch {
+	case info < 24:
+		return major, uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return major, uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return major, uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return major, uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return major, binary.BigEndian.Uint64(data), data[8:], nil
+	case info > 27:
+		return 0, 0, nil, fmt.Errorf("unsupported CBOR additional information %d", info)
+	}
+	return 0, 0, nil, errCBORTruncated
+}
+
+// decodeCBORItem decodes one item nested depth levels deep
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("CBOR data nested too deeply")
+	}
+	major, arg, data, err := cborArgument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case cborUnsigned, cborNegative:
+		if arg > 1<<63-1 {
+			return nil, nil, errors.New("CBOR integer out of range")
+		}
+		if major == cborNegative {
+			return -1 - int64(arg), data, nil
+		}
+		return int64(arg), data, nil
+	case cborBytes, cborText:
+		if uint64(len(data)) < arg {
+			return nil, nil, errCBORTruncated
+		}
+		if major == cborText {
+			return string(data[:arg]), data[arg:], nil
+		}
+		return data[:arg], data[arg:], nil
+	case cborArray:
+		if arg > uint64(len(data)) { // Every item takes at least a byte
+			return nil, nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			if item, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case cborMap:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, errCBORTruncated
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			if key, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.New("unsupported CBOR map key type")
+			}
+			if value, data, err = decodeCBORItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, data, nil
+	case cborSimple:
+		switch arg {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		}
+		return nil, nil, fmt.Errorf("unsupported CBOR simple value %d", arg)
+	}
+	return nil, nil, fmt.Errorf("unsupported CBOR major type %d", major)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context" // Package for database call contexts
+	"fmt"     // Package for formatting percentages
+	"math"    // Package for rounding percentages
+	"time"    // Package for the change windows
+)
+
+// PriceChanges is how much a price moved over the standard windows, as a percentage of
+// the newest price at least that long before it. A window the history doesn't reach
+// back across is nil.
+type PriceChanges struct {
+	Change24h *float64 `json:"change_24h,omitempty"` // Percent change over the previous 24 hours
+	Change7d  *float64 `json:"change_7d,omitempty"`  // Percent change over the previous 7 days
+	Change30d *float64 `json:"change_30d,omitempty"` // Percent change over the previous 30 days
+}
+
+// priceChanges computes the changes of a record over every window, from the prices
+// stored before its own timestamp, so older records show how they moved at the time
+func priceChanges(ctx context.Context, repo *Repository, r PriceRecord) (PriceChanges, error) {
+	var c PriceChanges
+	var err error
+	if c.Change24h, err = changeOver(ctx, repo, r, 24*time.Hour); err != nil {
+		return c, err
+	}
+	if c.Change7d, err = changeOver(ctx, repo, r, 7*24*time.Hour); err != nil {
+		return c, err
+	}
+	c.Change30d, err = changeOver(ctx, repo, r, 30*24*time.Hour)
+	return c, err
+}
+
+// changeOver returns the percent change of a record from the newest price at least
+// window before it, to two decimal places; nil when there is none
+func changeOver(ctx context.Context, repo *Repository, r PriceRecord, window time.Duration) (*float64, error) {
+	past, ok, err := repo.PriceAsOf(ctx, r.Currency, r.Timestamp.Add(-window))
+	if err != nil || !ok || past <= 0 {
+		return nil, err
+	}
+	change := math.Round(percentChange(past, r.Price)*100) / 100
+	return &change, nil
+}
+
+// formatChange formats a change for tables, e.g. "+2.31%"; "-" when it is unknown
+func formatChange(change *float64) string {
+	if change == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%+.2f%%", *change)
+}
+
+// latestPrice is the body of GET /prices/latest: the newest record and its changes
+type latestPrice struct {
+	precisePriceRecord
+	PriceChanges
+}
@@ -0,0 +1,747 @@
+package main
+
+import (
+	"bytes"         // Package for the encoded image
+	"context"       // Package for chart queries
+	"fmt"           // Package for formatted I/O operations
+	"html"          // Package for escaping SVG text
+	"image"         // Package for the chart canvas
+	"image/color"   // Package for chart colors
+	"image/draw"    // Package for filling the background
+	"image/png"     // Package for encoding the chart
+	"log/slog"      // Package for structured logging
+	"math"          // Package for axis scaling
+	"net/http"      // Package for the chart endpoint
+	"os"            // Package for writing the image
+	"path/filepath" // Package for the format of --output
+	"slices"        // Package for checking currencies
+	"strconv"       // Package for the Content-Length header
+	"strings"       // Package for string manipulation
+	"time"          // Package for the time axis
+)
+
+// Chart dimensions and colors
+const (
+	chartWidth     = 800
+	chartHeight    = 400
+	chartMarginL   = 120 // Room for the price labels
+	chartMarginR   = 20
+	chartMarginT   = 40 // Room for the title
+	chartMarginB   = 40 // Room for the date labels
+	chartTextScale = 2  // Each font pixel is drawn as a 2x2 block
+	chartGridLines = 5
+	chartLabelRows = 3  // Annotation labels are staggered over this many rows so neighbors don't overlap
+	chartLabelMax  = 24 // Longer annotation texts are cut short on PNG charts
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartGrid       = color.RGBA{0xe5, 0xe7, 0xeb, 0xff}
+	chartText       = color.RGBA{0x37, 0x41, 0x51, 0xff}
+	chartLine       = color.RGBA{0xf5, 0x9e, 0x0b, 0xff}
+	chartCredit     = color.RGBA{0x9c, 0xa3, 0xaf, 0xff} // Provider credit, kept quieter than the title
+	chartUp         = color.RGBA{0x16, 0xa3, 0x4a, 0xff} // Candles that closed at or above their open
+	chartDown       = color.RGBA{0xdc, 0x26, 0x26, 0xff} // Candles that closed below their open
+	chartMarker     = color.RGBA{0x7c, 0x3a, 0xed, 0xff} // Annotation markers and their labels
+)
+
+// chartPoint is one sample on a price chart
+type chartPoint struct {
+	Time  time.Time
+	Price float64
+}
+
+// chartFont is a 5x7 bitmap font covering what chart labels need; each row is
+// five bits, most significant first. Lowercase letters are drawn as uppercase.
+var chartFont = map[rune][7]byte{
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	'A': {0x0E, 0x11, 0x11, 0x11, 0x1F, 0x11, 0x11},
+	'B': {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C': {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D': {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G': {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H': {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I': {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M': {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P': {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q': {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R': {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S': {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T': {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X': {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04},
+	'Z': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	',': {0x00, 0x00, 0x00, 0x00, 0x0C, 0x04, 0x08},
+	'-': {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'+': {0x00, 0x04, 0x04, 0x1F, 0x04, 0x04, 0x00},
+	'%': {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	':': {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+	'/': {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'(': {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')': {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	' ': {},
+}
+
+// chartTextWidth returns the width of s in pixels
+func chartTextWidth(s string) int {
+	return len([]rune(s)) * 6 * chartTextScale
+}
+
+// drawChartText draws s with its top-left corner at (x, y); unknown characters are left blank
+func drawChartText(img *image.RGBA, x, y int, s string, c color.Color) {
+	for _, r := range strings.ToUpper(s) {
+		glyph := chartFont[r]
+		for row, bits := range glyph {
+			for col := 0; col < 5; col++ {
+				if bits&(0x10>>col) == 0 {
+					continue
+				}
+				for dy := 0; dy < chartTextScale; dy++ {
+					for dx := 0; dx < chartTextScale; dx++ {
+						img.Set(x+col*chartTextScale+dx, y+row*chartTextScale+dy, c)
+					}
+				}
+			}
+		}
+		x += 6 * chartTextScale
+	}
+}
+
+// drawChartLine draws a two-pixel-wide line from (x0, y0) to (x1, y1)
+func drawChartLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	steps := max(abs(x1-x0), abs(y1-y0), 1)
+	for i := 0; i <= steps; i++ {
+		x := x0 + (x1-x0)*i/steps
+		y := y0 + (y1-y0)*i/steps
+		img.Set(x, y, c)
+		img.Set(x+1, y, c)
+		img.Set(x, y+1, c)
+	}
+}
+
+// abs returns the absolute value of an int
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// chartFormats maps each chart image format to its content type
+var chartFormats = map[string]string{
+	"png": "image/png",
+	"svg": "image/svg+xml",
+}
+
+// chartRaw is the resolution of line charts drawn through every stored price
+const chartRaw = "raw"
+
+// chartSpec is what a chart shows: a line through Points, or Candles when there are any
+type chartSpec struct {
+	Title   string
+	Points  []chartPoint // Ordered oldest first
+	Candles []Candle     // Ordered oldest first, all of one resolution
+	Credit  string       // Providers credited in the top right corner, e.g. "Data: CoinGecko"
+
+	Annotations []Annotation // Marked where they fall within the plotted range
+}
+
+// empty reports whether there is too little data to draw
+func (s chartSpec) empty() bool {
+	return len(s.Candles) == 0 && len(s.Points) < 2
+}
+
+// chartLayout maps prices and times onto the plot area
+type chartLayout struct {
+	lo, hi     float64   // Prices at the bottom and top of the plot area
+	start, end time.Time // Times at the left and right of the plot area
+}
+
+// newChartLayout fits the plot area to what spec shows
+func newChartLayout(spec chartSpec) (chartLayout, error) {
+	var l chartLayout
+	switch {
+	case len(spec.Candles) > 0:
+		first, last := spec.Candles[0], spec.Candles[len(spec.Candles)-1]
+		l.start, l.end = first.Start, last.Start.Add(candleDuration(last.Resolution))
+		l.lo, l.hi = first.Low, first.High
+		for _, c := range spec.Candles {
+			l.lo, l.hi = math.Min(l.lo, c.Low), math.Max(l.hi, c.High)
+		}
+	case len(spec.Points) >= 2:
+		l.start, l.end = spec.Points[0].Time, spec.Points[len(spec.Points)-1].Time
+		l.lo, l.hi = spec.Points[0].Price, spec.Points[0].Price
+		for _, p := range spec.Points {
+			l.lo, l.hi = math.Min(l.lo, p.Price), math.Max(l.hi, p.Price)
+		}
+	default:
+		return l, fmt.Errorf("at least two prices are needed for a chart")
+	}
+
+	if l.hi == l.lo {
+		l.lo, l.hi = l.lo-1, l.hi+1
+	}
+	// Pad the range so the line doesn't touch the frame
+	pad := (l.hi - l.lo) * 0.05
+	l.lo, l.hi = l.lo-pad, l.hi+pad
+	if !l.end.After(l.start) {
+		l.end = l.start.Add(time.Second)
+	}
+	return l, nil
+}
+
+// x returns the horizontal position of t
+func (l chartLayout) x(t time.Time) float64 {
+	plotW := float64(chartWidth - chartMarginL - chartMarginR)
+	return chartMarginL + plotW*float64(t.Sub(l.start))/float64(l.end.Sub(l.start))
+}
+
+// y returns the vertical position of a price
+func (l chartLayout) y(v float64) float64 {
+	plotH := float64(chartHeight - chartMarginT - chartMarginB)
+	return chartMarginT + plotH*(l.hi-v)/(l.hi-l.lo)
+}
+
+// gridLines returns the prices of the horizontal gridlines, bottom first, and their labels
+func (l chartLayout) gridLines() ([]float64, []string) {
+	prices := make([]float64, chartGridLines+1)
+	labels := make([]string, chartGridLines+1)
+	for i := range prices {
+		v := l.lo + (l.hi-l.lo)*float64(i)/chartGridLines
+		prices[i], labels[i] = v, formatPrice(v)
+		if l.hi-l.lo > 10 {
+			// Cents are noise at Bitcoin prices and would not fit the margin
+			labels[i] = strings.TrimSuffix(formatPrice(math.Round(v)), ".00")
+		}
+	}
+	return prices, labels
+}
+
+// dateLabels returns the labels of both ends of the time axis, with the time of day
+// for ranges of up to two days
+func (l chartLayout) dateLabels() (string, string) {
+	layout := "2006-01-02"
+	if l.end.Sub(l.start) <= 48*time.Hour {
+		layout = "01-02 15:04"
+	}
+	return l.start.UTC().Format(layout), l.end.UTC().Format(layout)
+}
+
+// markers returns the annotations of spec within the plotted range, each with the row
+// of its label
+func (l chartLayout) markers(spec chartSpec) ([]Annotation, []int) {
+	var shown []Annotation
+	var rows []int
+	for _, a := range spec.Annotations {
+		if a.Time.Before(l.start) || a.Time.After(l.end) {
+			continue
+		}
+		rows = append(rows, len(shown)%chartLabelRows)
+		shown = append(shown, a)
+	}
+	return shown, rows
+}
+
+// candle returns the horizontal center and half the body width of a candle, and its color
+func (l chartLayout) candle(c Candle) (float64, float64, color.RGBA) {
+	d := candleDuration(c.Resolution)
+	center := l.x(c.Start.Add(d / 2))
+	half := math.Max((l.x(l.start.Add(d))-l.x(l.start))*0.3, 0.5) // Bodies fill 60% of their slot
+	if c.Close < c.Open {
+		return center, half, chartDown
+	}
+	return center, half, chartUp
+}
+
+// renderChart draws spec and returns it encoded as format, png or svg
+func renderChart(spec chartSpec, format string) ([]byte, error) {
+	l, err := newChartLayout(spec)
+	if err != nil {
+		return nil, err
+	}
+	if format == "svg" {
+		return renderChartSVG(spec, l), nil
+	}
+	return renderChartPNG(spec, l)
+}
+
+// renderPriceChart draws points as a PNG line chart; the points must be ordered oldest first
+func renderPriceChart(title string, points []chartPoint) ([]byte, error) {
+	return renderChart(chartSpec{Title: title, Points: points, Credit: attributionCredit(attributionsFor(nil))}, "png")
+}
+
+// renderChartPNG draws spec with price gridlines and start/end dates as a PNG
+func renderChartPNG(spec chartSpec, l chartLayout) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	// Horizontal gridlines with price labels
+	prices, labels := l.gridLines()
+	for i, v := range prices {
+		y := int(l.y(v))
+		for x := chartMarginL; x < chartWidth-chartMarginR; x++ {
+			img.Set(x, y, chartGrid)
+		}
+		drawChartText(img, chartMarginL-8-chartTextWidth(labels[i]), y-7*chartTextScale/2, labels[i], chartText)
+	}
+
+	// Title and the dates at both ends of the time axis
+	drawChartText(img, chartMarginL, 12, spec.Title, chartText)
+	drawChartText(img, chartWidth-chartMarginR-chartTextWidth(spec.Credit), 12, spec.Credit, chartCredit)
+	first, last := l.dateLabels()
+	drawChartText(img, chartMarginL, chartHeight-chartMarginB+12, first, chartText)
+	drawChartText(img, chartWidth-chartMarginR-chartTextWidth(last), chartHeight-chartMarginB+12, last, chartText)
+
+	for _, c := range spec.Candles {
+		center, half, col := l.candle(c)
+		x := int(center)
+		for y := int(l.y(c.High)); y <= int(l.y(c.Low)); y++ {
+			img.Set(x, y, col)
+		}
+		top, bottom := int(l.y(math.Max(c.Open, c.Close))), int(l.y(math.Min(c.Open, c.Close)))
+		body := image.Rect(int(center-half), top, int(center+half)+1, bottom+1)
+		draw.Draw(img, body, &image.Uniform{col}, image.Point{}, draw.Src)
+	}
+	for i := 1; i < len(spec.Points) && len(spec.Candles) == 0; i++ {
+		a, b := spec.Points[i-1], spec.Points[i]
+		drawChartLine(img, int(l.x(a.Time)), int(l.y(a.Price)), int(l.x(b.Time)), int(l.y(b.Price)), chartLine)
+	}
+
+	// Annotations as dashed vertical lines, labelled at the top of the plot area
+	markers, rows := l.markers(spec)
+	for i, a := range markers {
+		x := int(l.x(a.Time))
+		for y := chartMarginT; y < chartHeight-chartMarginB; y++ {
+			if (y/4)%2 == 0 {
+				img.Set(x, y, chartMarker)
+			}
+		}
+		label := a.Text
+		if r := []rune(label); len(r) > chartLabelMax {
+			label = string(r[:chartLabelMax-2]) + ".."
+		}
+		lx := x + 4
+		if lx+chartTextWidth(label) > chartWidth-chartMarginR {
+			lx = x - 4 - chartTextWidth(label)
+		}
+		drawChartText(img, lx, chartMarginT+4+rows[i]*9*chartTextScale, label, chartMarker)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// svgColor formats a color as an SVG hex color
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// renderChartSVG draws the same chart as renderChartPNG as an SVG document, whose text
+// stays sharp at any size and uses the viewer's sans-serif font
+func renderChartSVG(spec chartSpec, l chartLayout) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="14">`+"\n",
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", svgColor(chartBackground))
+
+	// Horizontal gridlines with price labels
+	prices, labels := l.gridLines()
+	for i, v := range prices {
+		y := l.y(v)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="%s"/>`+"\n",
+			chartMarginL, y, chartWidth-chartMarginR, y, svgColor(chartGrid))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle" fill="%s">%s</text>`+"\n",
+			chartMarginL-8, y, svgColor(chartText), html.EscapeString(labels[i]))
+	}
+
+	// Title and the dates at both ends of the time axis
+	fmt.Fprintf(&b, `<text x="%d" y="26" font-size="16" font-weight="bold" fill="%s">%s</text>`+"\n",
+		chartMarginL, svgColor(chartText), html.EscapeString(spec.Title))
+	if spec.Credit != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="26" text-anchor="end" font-size="12" fill="%s">%s</text>`+"\n",
+			chartWidth-chartMarginR, svgColor(chartCredit), html.EscapeString(spec.Credit))
+	}
+	first, last := l.dateLabels()
+	fmt.Fprintf(&b, `<text x="%d" y="%d" fill="%s">%s</text>`+"\n",
+		chartMarginL, chartHeight-chartMarginB+24, svgColor(chartText), first)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="%s">%s</text>`+"\n",
+		chartWidth-chartMarginR, chartHeight-chartMarginB+24, svgColor(chartText), last)
+
+	for _, c := range spec.Candles {
+		center, half, col := l.candle(c)
+		top, bottom := l.y(math.Max(c.Open, c.Close)), l.y(math.Min(c.Open, c.Close))
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n",
+			center, l.y(c.High), center, l.y(c.Low), svgColor(col))
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n",
+			center-half, top, 2*half, math.Max(bottom-top, 1), svgColor(col))
+	}
+	if len(spec.Candles) == 0 {
+		points := make([]string, len(spec.Points))
+		for i, p := range spec.Points {
+			points[i] = fmt.Sprintf("%.1f,%.1f", l.x(p.Time), l.y(p.Price))
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2" stroke-linejoin="round"/>`+"\n",
+			strings.Join(points, " "), svgColor(chartLine))
+	}
+
+	markers, rows := l.markers(spec)
+	for i, a := range markers {
+		x := l.x(a.Time)
+		anchor, dx := "start", 4.0
+		if x > chartWidth/2 {
+			anchor, dx = "end", -4
+		}
+		fmt.Fprintf(&b, `<g><title>%s %s</title>`+"\n", a.Time.UTC().Format(time.RFC3339), html.EscapeString(a.Text))
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="%s" stroke-dasharray="4 4"/>`+"\n",
+			x, chartMarginT, x, chartHeight-chartMarginB, svgColor(chartMarker))
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="%s" font-size="12" fill="%s">%s</text></g>`+"\n",
+			x+dx, chartMarginT+14+rows[i]*16, anchor, svgColor(chartMarker), html.EscapeString(a.Text))
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+// chartResolution picks what a chart of a range plots: every price for up to two days,
+// hourly candles for up to two weeks, and daily candles beyond
+func chartResolution(span time.Duration) string {
+	switch {
+	case span <= 48*time.Hour:
+		return chartRaw
+	case span <= 14*24*time.Hour:
+		return CandleHourly
+	default:
+		return CandleDaily
+	}
+}
+
+// loadChartPoints loads the prices of a line chart: the stored prices themselves at the
+// raw resolution, or candle closes. A zero to leaves the range open.
+func loadChartPoints(ctx context.Context, repo *Repository, currency, resolution string, from, to time.Time) ([]chartPoint, error) {
+	var points []chartPoint
+	if resolution == chartRaw {
+		prices, err := repo.PriceRange(currency, from, to, maxRangeLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range prices {
+			points = append(points, chartPoint{Time: p.Timestamp, Price: p.Price})
+		}
+		return points, nil
+	}
+
+	candles, err := repo.Candles(ctx, currency, resolution, from, to, maxRangeLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range candles {
+		points = append(points, chartPoint{Time: c.Start, Price: c.Close})
+	}
+	return points, nil
+}
+
+// loadBasketChartPoints loads the values of a basket's line chart: every stored value
+// at the raw resolution, or the last value of each UTC hour or day
+func loadBasketChartPoints(ctx context.Context, repo *Repository, basket, currency, resolution string, from, to time.Time) ([]chartPoint, error) {
+	values, err := repo.BasketValues(ctx, basket, currency, from, to, maxRangeLimit)
+	if err != nil {
+		return nil, err
+	}
+	var points []chartPoint
+	for _, v := range values {
+		at := v.Timestamp
+		if resolution != chartRaw {
+			at = candleStart(at, resolution)
+			if n := len(points); n > 0 && points[n-1].Time.Equal(at) {
+				points[n-1].Price = v.Value
+				continue
+			}
+		}
+		points = append(points, chartPoint{Time: at, Price: v.Value})
+	}
+	return points, nil
+}
+
+// chartRequest is a chart asked for by the chart command or GET /chart
+type chartRequest struct {
+	Currency   string
+	Basket     string // Basket of BASKETS charted instead of Bitcoin; empty for Bitcoin
+	Type       string // line or candles
+	Resolution string // raw (line charts only), 1h, or 1d; empty picks one by the range
+	From, To   time.Time
+	Title      string // Empty for the pair and its change over the range
+	Format     string // png or svg
+
+	Annotations bool // Mark the annotations in the range
+}
+
+// validate checks the request and fills in the defaults of its type, resolution, and format
+func (c *chartRequest) validate() error {
+	if c.Basket != "" {
+		// Baskets are only stored as values in BASKET_CURRENCY, so they get line charts
+		b, err := basketConfig.lookup(c.Basket)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(c.Type, "candles") {
+			return validationErrorf("baskets have line charts only")
+		}
+		c.Basket, c.Currency = b.Name, basketConfig.Currency
+	} else if !slices.Contains(currencies, c.Currency) {
+		return validationErrorf("currency %q is not in CURRENCIES (%s)", c.Currency, strings.Join(currencies, ","))
+	}
+	c.Type = strings.ToLower(c.Type)
+	if c.Type == "" {
+		c.Type = "line"
+	}
+	if c.Type != "line" && c.Type != "candles" {
+		return validationErrorf("invalid chart type %q (expected line or candles)", c.Type)
+	}
+	c.Format = strings.ToLower(c.Format)
+	if c.Format == "" {
+		c.Format = "png"
+	}
+	if _, ok := chartFormats[c.Format]; !ok {
+		return validationErrorf("invalid chart format %q (expected png or svg)", c.Format)
+	}
+	if !c.To.After(c.From) {
+		return validationErrorf("to must be after from")
+	}
+
+	switch res := strings.ToLower(c.Resolution); res {
+	case "":
+		c.Resolution = chartResolution(c.To.Sub(c.From))
+		if c.Type == "candles" && c.Resolution == chartRaw {
+			c.Resolution = CandleHourly
+		}
+	case chartRaw:
+		if c.Type == "candles" {
+			return validationErrorf("candle charts need resolution 1h or 1d")
+		}
+		c.Resolution = chartRaw
+	default:
+		parsed, err := parseCandleResolution(res)
+		if err != nil {
+			return withKind(KindValidation, err)
+		}
+		c.Resolution = parsed
+	}
+	return nil
+}
+
+// subject names what the chart shows in messages, e.g. "USD prices"
+func (c chartRequest) subject() string {
+	if c.Basket != "" {
+		return c.Basket + " basket values"
+	}
+	return strings.ToUpper(c.Currency) + " prices"
+}
+
+// load reads the data of the chart
+func (c chartRequest) load(ctx context.Context, repo *Repository) (chartSpec, error) {
+	spec := chartSpec{Title: c.Title, Credit: attributionCredit(attributionsFor(nil))}
+	var first, last float64
+	if c.Basket != "" {
+		points, err := loadBasketChartPoints(ctx, repo, c.Basket, c.Currency, c.Resolution, c.From, c.To)
+		if err != nil {
+			return spec, err
+		}
+		if len(points) > 0 {
+			first, last = points[0].Price, points[len(points)-1].Price
+		}
+		spec.Points = points
+	} else if c.Type == "candles" {
+		candles, err := repo.Candles(ctx, c.Currency, c.Resolution, c.From, c.To, maxRangeLimit)
+		if err != nil {
+			return spec, err
+		}
+		if len(candles) > 0 {
+			first, last = candles[0].Open, candles[len(candles)-1].Close
+		}
+		spec.Candles = candles
+	} else {
+		points, err := loadChartPoints(ctx, repo, c.Currency, c.Resolution, c.From, c.To)
+		if err != nil {
+			return spec, err
+		}
+		if len(points) > 0 {
+			first, last = points[0].Price, points[len(points)-1].Price
+		}
+		spec.Points = points
+	}
+
+	if c.Annotations {
+		annotations, err := repo.Annotations(ctx, c.From, c.To)
+		if err != nil {
+			return spec, err
+		}
+		spec.Annotations = annotations
+	}
+
+	if spec.Title == "" {
+		spec.Title = "BTC/" + strings.ToUpper(c.Currency)
+		if c.Basket != "" {
+			spec.Title = strings.ToUpper(c.Basket) + "/" + strings.ToUpper(c.Currency)
+		}
+		if first > 0 {
+			spec.Title += fmt.Sprintf(" %+.2f%%", percentChange(first, last))
+		}
+	}
+	return spec, nil
+}
+
+// runChartCommand handles "chart [currency] [flags]"
+// It writes a PNG or SVG image of a line or candle chart of stored prices, for reports
+// and chat messages.
+func runChartCommand(ctx context.Context, repo *Repository, args []string) error {
+	req := chartRequest{Currency: currencies[0]}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		req.Currency, args = strings.ToLower(args[0]), args[1:]
+	}
+	fs := newFlagSet("chart")
+	window := fs.String("window", "", windowUsage+" (default: 24h)")
+	fromFlag := fs.String("from", "", "Start of the range: YYYY-MM-DD or RFC 3339 (default: 24 hours before --to)")
+	toFlag := fs.String("to", "now", "End of the range: now, YYYY-MM-DD, or RFC 3339")
+	fs.StringVar(&req.Basket, "basket", "", "Chart the value of a basket of BASKETS instead of Bitcoin")
+	fs.StringVar(&req.Type, "type", "line", "Chart type: line or candles")
+	fs.StringVar(&req.Resolution, "resolution", "", "What is plotted: raw prices (line charts only), 1h, or 1d candles (default: by the length of the range)")
+	fs.StringVar(&req.Title, "title", "", "Title above the chart (default: the pair and its change over the range)")
+	fs.StringVar(&req.Format, "format", "", "Image format: png or svg (default: the extension of --output, or png)")
+	fs.BoolVar(&req.Annotations, "annotations", true, "Mark the annotations in the range")
+	output := fs.String("output", "", "File to write (default: stdout)")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+
+	from, to, err := resolveWindow(*window, *fromFlag, *toFlag, "24h")
+	if err != nil {
+		return err
+	}
+	req.From, req.To = from, windowEnd(to, time.Now())
+	if req.Format == "" {
+		req.Format = strings.TrimPrefix(filepath.Ext(*output), ".")
+	}
+	if err := req.validate(); err != nil {
+		return err
+	}
+	if *output == "" {
+		if _, _, ok := terminalSize(os.Stdout); ok {
+			return validationErrorf("refusing to write an image to a terminal; use --output or redirect stdout")
+		}
+	}
+
+	spec, err := req.load(ctx, repo)
+	if err != nil {
+		return err
+	}
+	if spec.empty() {
+		return fmt.Errorf("no %s to chart between %s and %s", req.subject(),
+			req.From.Format(time.RFC3339), req.To.Format(time.RFC3339))
+	}
+	img, err := renderChart(spec, req.Format)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(img)
+		return err
+	}
+	if err := os.WriteFile(*output, img, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+	slog.Info("Chart written", "output", *output, "type", req.Type, "resolution", req.Resolution, "bytes", len(img))
+	return nil
+}
+
+// handleChart serves GET /chart?currency=usd&window=7d&type=candles&resolution=1d&format=svg,
+// or GET /chart?basket=top10&... for a basket's value. It returns the chart image the chart command writes, for embedding by URL;
+// from=/to= may replace window, from defaults to 24 hours before to, and to to now. annotations=false leaves out the annotation markers.
+func (s *apiServer) handleChart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	req := chartRequest{
+		Currency:   requestCurrency(r),
+		Basket:     q.Get("basket"),
+		Type:       q.Get("type"),
+		Resolution: q.Get("resolution"),
+		Title:      q.Get("title"),
+		Format:     q.Get("format"),
+	}
+
+	var err error
+	req.Annotations = true
+	if v := q.Get("annotations"); v != "" {
+		if req.Annotations, err = strconv.ParseBool(v); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid annotations %q (expected true or false)", v)
+			return
+		}
+	}
+	from, to, err := requestWindow(r, "24h")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	req.From, req.To = from, windowEnd(to, time.Now())
+	if err := req.validate(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	resolution := req.Resolution
+	if resolution == chartRaw {
+		resolution = ""
+	}
+	if err := checkAnalyticsRange(req.From, req.To, resolution); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	ctx, cancel := withAnalyticsTimeout(r.Context())
+	defer cancel()
+	spec, err := req.load(ctx, s.repo)
+	if err != nil {
+		writeAnalyticsError(w, r, "chart", err)
+		return
+	}
+	if spec.empty() {
+		writeAPIError(w, http.StatusNotFound, "no %s to chart in this range", req.subject())
+		return
+	}
+	img, err := renderChart(spec, req.Format)
+	if err != nil {
+		slog.Error("API failed to render chart", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to render chart")
+		return
+	}
+	w.Header().Set("Content-Type", chartFormats[req.Format])
+	w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(img)
+	}
+}
@@ -0,0 +1,799 @@
+package main
+
+import (
+	"context" // Package for passing cancellation to commands
+	"errors"  // Package for recognizing --help
+	"flag"    // Package for command line flags
+	"fmt"     // Package for formatted I/O operations
+	"io"      // Package for writing help and completion scripts
+	"os"      // Package for standard output
+	"sort"    // Package for ordering completion words
+	"strings" // Package for string manipulation
+	"time"    // Package for the stream's record function
+)
+
+// commandSetup is what has to be prepared before a command runs
+type commandSetup int
+
+const (
+	setupNone     commandSetup = iota // Nothing; the command loads what it needs itself
+	setupConfig                       // The configuration, but no database
+	setupStore                        // The database, without applying migrations
+	setupDatabase                     // The migrated database and the metrics server
+)
+
+// Command is one subcommand of the CLI
+type Command struct {
+	Name        string
+	Args        string       // Argument synopsis for help output, e.g. "[currency] [flags]"
+	Summary     string       // One line shown in the command list
+	Setup       commandSetup // What main prepares before Run
+	Subcommands []string     // Words accepted as the first argument, for help and completion
+	// Flags marks commands that parse their arguments with newFlagSet before doing
+	// anything else; their flags are listed by running them with --help
+	Flags bool
+	// BufferStartup marks commands that record prices on a schedule; while they wait
+	// for the database at startup, prices are fetched and kept until it is reachable
+	BufferStartup bool
+	// ReadReplica marks commands that only show prices; their queries go to the read
+	// replica of DATABASE_REPLICA_URL when one is configured
+	ReadReplica bool
+	// Run runs the command; repo is the database main opened for it, nil for commands
+	// set up without one
+	Run func(ctx context.Context, stop context.CancelFunc, repo *Repository, args []string) error
+}
+
+// commands lists every subcommand in the order help shows them
+// It is filled in by init, because the help and completion commands refer to it
+var commands []*Command
+
+// init registers the subcommands
+func init() {
+	commands = []*Command{
+		{
+			Name: "scheduler", Args: "[flags]", Summary: "Fetch prices on a schedule (the default without a command)",
+			Setup: setupDatabase, Flags: true, BufferStartup: true,
+			Run: func(ctx context.Context, stop context.CancelFunc, repo *Repository, args []string) error {
+				fs := newFlagSet("scheduler")
+				interval := fs.String("interval", *intervalFlag, "Base fetch interval as a Go duration, e.g. 5m or 1h (overrides FETCH_INTERVAL)")
+				pidFile := fs.String("pid-file", os.Getenv("PID_FILE"), "File to write the process ID to while running (default: PID_FILE)")
+				standby := fs.Bool("standby", false, "Wait as a warm standby and take over when the primary goes silent (overrides STANDBY)")
+				if err := fs.Parse(args); err != nil {
+					return withKind(KindValidation, err)
+				}
+				// The flags stay in effect when a reload re-reads the configuration
+				*intervalFlag = *interval
+				d, err := loadFetchInterval()
+				if err != nil {
+					return err
+				}
+				fetchInterval = d
+				standbyFlag = *standby
+				if standbyConfig, err = loadStandbyConfig(); err != nil {
+					return err
+				}
+				if *pidFile != "" {
+					removePIDFile, err := writePIDFile(*pidFile)
+					if err != nil {
+						return err
+					}
+					defer removePIDFile()
+				}
+				runWithDrain(ctx, stop, func(ctx context.Context) { runScheduler(ctx, repo) })
+				return nil
+			},
+		},
+		{
+			Name: "fetch", Summary: "Fetch and store the current prices once", Setup: setupDatabase,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, _ []string) error {
+				if err := fetchAndSavePrice(ctx, repo); err != nil {
+					return err
+				}
+				// Make the first attempt at the webhook payloads the new prices queued; a
+				// running scheduler retries the ones that fail
+				if writeMode == "" {
+					webhookDeliveries.deliverDue(ctx, repo)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "display", Args: "[currency] [flags]", Summary: "Show the latest prices, optionally filtered and paged",
+			Setup: setupDatabase, ReadReplica: true, Flags: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runDisplayCommand(repo, args)
+			},
+		},
+		{
+			Name: "tui", Args: "[currency] [--poll 5s]", Summary: "Watch prices live in a terminal dashboard",
+			Setup: setupDatabase, ReadReplica: true, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runTUICommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "chart", Args: "[currency] [flags]", Summary: "Render a price or candle chart of a range as PNG or SVG",
+			Setup: setupDatabase, ReadReplica: true, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runChartCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "serve", Summary: "Serve the read-only price API on API_ADDR", Setup: setupDatabase, ReadReplica: true,
+			Run: func(ctx context.Context, stop context.CancelFunc, repo *Repository, _ []string) error {
+				runWithDrain(ctx, stop, func(ctx context.Context) { runAPIServer(ctx, repo) })
+				return nil
+			},
+		},
+		{
+			Name: "apikey", Args: "create|list|revoke ...", Summary: "Manage the keys of the HTTP and gRPC APIs",
+			Setup: setupDatabase, Subcommands: []string{"create", "list", "revoke"},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runAPIKeyCommand(repo, args)
+			},
+		},
+		{
+			Name: "webhooks", Args: "add|list|remove|deliveries|retry ...", Summary: "Manage outgoing price webhooks and review their deliveries",
+			Setup: setupDatabase, Subcommands: []string{"add", "list", "remove", "deliveries", "retry"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runWebhookCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "outbox", Args: "list|retry|purge ...", Summary: "Review the events waiting for their sinks, and retry or drop them",
+			Setup: setupDatabase, Subcommands: []string{"list", "retry", "purge"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runOutboxCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "passkey", Args: "invite|list|delete ...", Summary: "Invite dashboard users to register passkeys, and manage them",
+			Setup: setupDatabase, Subcommands: []string{"invite", "list", "delete"},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runPasskeyCommand(repo, args)
+			},
+		},
+		{
+			Name: "share", Args: "[flags]", Summary: "Create an expiring public link to a chart or statistics",
+			Setup: setupConfig, Flags: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runShareCommand(args)
+			},
+		},
+		{
+			Name: "stream", Args: "[flags]", Summary: "Record real-time prices from an exchange WebSocket feed",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, stop context.CancelFunc, repo *Repository, args []string) error {
+				opts, err := parseStreamOptions(repo, args, true)
+				if err != nil {
+					return err
+				}
+				if opts.sample < uniquePriceResolution {
+					// Only one price per currency and minute can be stored
+					return fmt.Errorf("sample interval %s is below the minimum of %s for stored prices", opts.sample, uniquePriceResolution)
+				}
+				if writeMode == "" {
+					stopWebhooks := webhookDeliveries.start(repo)
+					defer stopWebhooks()
+					stopOutbox := eventOutbox.start(repo)
+					defer stopOutbox()
+				}
+				if opts.batch == 0 {
+					record := func(ctx context.Context, prices map[string]float64, quoted map[string]time.Time, source string) error {
+						return recordPrices(ctx, repo, prices, quoted, source)
+					}
+					runWithDrain(ctx, stop, func(ctx context.Context) { runStream(ctx, opts.feed, opts.sample, record) })
+					return nil
+				}
+				record, writer := batchedRecorder(ctx, repo, opts.batch)
+				runWithDrain(ctx, stop, func(ctx context.Context) {
+					runStream(ctx, opts.feed, opts.sample, record)
+					writer.Close() // Logs any rows it couldn't write
+				})
+				return nil
+			},
+		},
+		{
+			Name: "relay", Args: "[stream [flags]]", Summary: "Forward prices to the event sinks without a database",
+			Setup: setupConfig, Subcommands: []string{"stream"},
+			Run: func(ctx context.Context, stop context.CancelFunc, repo *Repository, args []string) error {
+				startMetricsServer(repo)
+				return runRelayCommand(ctx, stop, args)
+			},
+		},
+		{
+			Name: "backfill", Args: "--from YYYY-MM-DD [flags]", Summary: "Import historical prices and rebuild everything derived from them",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runBackfillCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "import", Args: "[flags] <file.csv|->", Summary: "Merge prices from a CSV export of an exchange or another tracker",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runImportCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "gaps", Args: "[--fill] [flags]", Summary: "List gaps in the recent price history, or backfill them",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runGapsCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "export", Args: "[flags]", Summary: "Dump prices as CSV or JSON",
+			Setup: setupDatabase, ReadReplica: true, Flags: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runExportCommand(repo, args)
+			},
+		},
+		{
+			Name: "stats", Args: "[currency] [flags]", Summary: "Show min/max/mean/median/stddev and change over a window",
+			Setup: setupDatabase, ReadReplica: true, Flags: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runStatsCommand(repo, args)
+			},
+		},
+		{
+			Name: "price-at", Args: "<time> [currency] [flags]", Summary: "Show the price at a point in time, from the samples around it",
+			Setup: setupDatabase, ReadReplica: true, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runPriceAtCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "convert", Args: "<amount> <from> <to> [flags]", Summary: "Convert an amount between btc, sats, and currencies at a stored or fetched price",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runConvertCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "summary", Args: "[--send] [--units sats,oz]", Summary: "Show the daily summary report, or post it to Slack/Discord",
+			Setup: setupDatabase, Flags: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runSummaryCommand(repo, args)
+			},
+		},
+		{
+			Name: "report", Args: "[--to date] [--output file] [--send]", Summary: "Write the weekly HTML (and PDF) report, or email it",
+			Setup: setupDatabase, Flags: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runReportCommand(repo, args)
+			},
+		},
+		{
+			Name: "query", Args: "[flags] <statement|->", Summary: "Run a read-only SQL statement",
+			Setup: setupDatabase, ReadReplica: true, Flags: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runQueryCommand(repo, args)
+			},
+		},
+		{
+			Name: "reference", Args: "add|list|delete ...", Summary: "Manage named reference prices",
+			Setup: setupDatabase, Subcommands: []string{"add", "list", "delete"},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runReferenceCommand(repo, args)
+			},
+		},
+		{
+			Name: "portfolio", Args: "[value|add|list|delete|sell|sales|snapshot|history] ...", Summary: "Manage and value holdings",
+			Setup: setupDatabase, Subcommands: []string{"value", "add", "list", "delete", "sell", "sales", "snapshot", "history"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runPortfolioCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "simulate-dca", Args: "--from <date> [flags]", Summary: "Replay stored prices to simulate buying a fixed amount on a schedule",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runSimulateDCACommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "trades", Args: "[add|import|list|delete] ...", Summary: "Manage the buys and sells reported by tax --source trades",
+			Setup: setupDatabase, Subcommands: []string{"add", "import", "list", "delete"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runTradesCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "tax", Args: "[flags]", Summary: "Write a capital gains report of a year's sales (Form 8949, Anlage SO, CSV)",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runTaxCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "alerts", Args: "add|list|stats|delete|snooze|unsnooze|disable|enable ...", Summary: "Manage alert rules",
+			Setup: setupDatabase, Subcommands: []string{"add", "list", "stats", "delete", "snooze", "unsnooze", "disable", "enable"},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runAlertCommand(repo, args)
+			},
+		},
+		{
+			Name: "targets", Args: "add|list|rearm|remove ...", Summary: "Manage one-shot price targets",
+			Setup: setupDatabase, Subcommands: []string{"add", "list", "rearm", "remove"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runTargetCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "annotations", Args: "add|list|remove ...", Summary: "Label points in time for charts, Grafana, and exports",
+			Setup: setupDatabase, Subcommands: []string{"add", "list", "remove"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runAnnotationCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "candles", Args: "[rollup | [1h|1d] [currency] [count]]", Summary: "Show or rebuild OHLC candles",
+			Setup: setupDatabase, Subcommands: []string{"rollup", CandleHourly, CandleDaily},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runCandlesCommand(repo, args)
+			},
+		},
+		{
+			Name: "daily", Args: "[refresh [--from date] | [currency] [days]]", Summary: "Show or rebuild the daily price summaries",
+			Setup: setupDatabase, Subcommands: []string{"refresh"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runDailyCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "indicators", Args: "[rebuild | [1h|1d] [currency] [count]]", Summary: "Show or recompute technical indicators",
+			Setup: setupDatabase, Subcommands: []string{"rebuild", CandleHourly, CandleDaily},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runIndicatorsCommand(repo, args)
+			},
+		},
+		{
+			Name: "patterns", Args: "[1h|1d] [currency]", Summary: "Show detected candlestick patterns",
+			Setup: setupDatabase, ReadReplica: true, Subcommands: []string{CandleHourly, CandleDaily},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				resolution, currency := "", currencies[0]
+				if len(args) > 0 {
+					r, err := parseCandleResolution(args[0])
+					if err != nil {
+						return err
+					}
+					resolution = r
+				}
+				if len(args) > 1 {
+					currency = strings.ToLower(args[1])
+				}
+				displayPatterns(repo, currency, resolution)
+				return nil
+			},
+		},
+		{
+			Name: "levels", Args: "[currency]", Summary: "Show support/resistance levels",
+			Setup: setupDatabase, ReadReplica: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				currency := currencies[0]
+				if len(args) > 0 {
+					currency = strings.ToLower(args[0])
+				}
+				displayPriceLevels(repo, currency)
+				return nil
+			},
+		},
+		{
+			Name: "regimes", Args: "[currency]", Summary: "Show weekly volatility regimes",
+			Setup: setupDatabase,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				currency := currencies[0]
+				if len(args) > 0 {
+					currency = args[0]
+				}
+				displayVolatilityRegimes(repo, currency)
+				return nil
+			},
+		},
+		{
+			Name: "retention", Args: "[flags]", Summary: "Downsample and purge old prices per the retention policy",
+			Setup: setupDatabase, Flags: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runRetentionCommand(repo, args)
+			},
+		},
+		{
+			Name: "archive", Args: "[list | create [flags] | restore YYYY-MM]", Summary: "Move old months of prices into compressed files",
+			Setup: setupDatabase, Subcommands: []string{"list", "create", "restore"},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runArchiveCommand(repo, args)
+			},
+		},
+		{
+			Name: "backup", Args: "[flags]", Summary: "Dump prices, candles, and alert rules to a compressed portable file",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runBackupCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "restore", Args: "<file|-> [flags]", Summary: "Load a backup into the database, e.g. one taken from the other backend",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runRestoreCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "anomalies", Args: "list|release ...", Summary: "Review prices the anomaly filter caught, and store quarantined ones",
+			Setup: setupDatabase, Subcommands: []string{"list", "release"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runAnomaliesCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "corrections", Args: "delete|amend|restore|list ...", Summary: "Delete, amend, or restore stored prices, with an audit trail",
+			Setup: setupDatabase, Subcommands: []string{"delete", "amend", "restore", "list"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runCorrectionsCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "spread", Args: "[currency] [flags]", Summary: "Compare exchange prices: the current spread and its history",
+			Setup: setupDatabase, Flags: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runSpreadCommand(repo, args)
+			},
+		},
+		{
+			Name: "baskets", Args: "[history <name> [flags]]", Summary: "Show the baskets of BASKETS with their newest value, or one basket's history",
+			Setup: setupDatabase, Subcommands: []string{"history"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runBasketsCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "fx", Args: "[--fetch]", Summary: "Show the exchange rates converted currencies are priced at",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runFXCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "fear-greed", Args: "[--fetch] [--days 30]", Summary: "Show the collected Crypto Fear & Greed index, or collect it",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runFearGreedCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "collectors", Args: "[--fetch]", Summary: "Show the newest values of the configured collectors, or run them",
+			Setup: setupDatabase, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runCollectorsCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "dedupe", Args: "[flags]", Summary: "Delete near-duplicate prices",
+			// Without migrations, as the unique index's migration fails until it has run
+			Setup: setupStore, Flags: true,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runDedupeCommand(repo, args)
+			},
+		},
+		{
+			Name: "providers", Summary: "Show each provider's assets, currencies, and historical data", Setup: setupDatabase,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, _ []string) error {
+				displayProviders(repo)
+				return nil
+			},
+		},
+		{
+			Name: "symbols", Summary: "Show each provider's identifier for the configured currencies", Setup: setupDatabase,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, _ []string) error {
+				displaySymbols(repo)
+				return nil
+			},
+		},
+		{
+			Name: "raw-responses", Args: "list|show ...", Summary: "List the stored provider responses of price fetches, or print one",
+			Setup: setupDatabase, Subcommands: []string{"list", "show"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runRawResponsesCommand(ctx, repo, args)
+			},
+		},
+		{
+			Name: "budget", Summary: "Show the remaining provider call budget", Setup: setupDatabase,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, _ []string) error {
+				displayBudget(repo)
+				return nil
+			},
+		},
+		{
+			Name: "status", Summary: "Show the running daemon's status", Setup: setupConfig,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, _ []string) error {
+				return displayStatus()
+			},
+		},
+		{
+			Name: "jobs", Args: "[presets]", Summary: "Show the scheduler's jobs, their schedules, and when they run next",
+			Setup: setupConfig, Subcommands: []string{"presets"},
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				if len(args) > 0 {
+					if args[0] != "presets" {
+						return validationErrorf("unknown jobs command %q (expected presets)", args[0])
+					}
+					displaySchedulePresets()
+					return nil
+				}
+				return runJobsCommand(ctx, repo)
+			},
+		},
+		controlCommand("trigger", "Ask the running daemon to fetch now"),
+		controlCommand("pause", "Pause the running daemon's scheduled fetches"),
+		controlCommand("resume", "Resume the running daemon's scheduled fetches"),
+		controlCommand("reload", "Ask the running daemon to reload its configuration"),
+		{
+			Name: "templates", Args: "[locale]", Summary: "Preview the message templates of a locale", Setup: setupConfig,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				locale := ""
+				if len(args) > 0 {
+					locale = args[0]
+				}
+				previewMessages(locale)
+				return nil
+			},
+		},
+		{
+			Name: "config", Args: "validate", Summary: "Check the configuration file and environment",
+			Setup: setupNone, Subcommands: []string{"validate"},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runConfigCommand(args)
+			},
+		},
+		{
+			Name: "bench", Args: "[--backends sqlite,postgres,timescale] [flags]", Summary: "Measure insert throughput and query latency against scratch databases",
+			Setup: setupConfig, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runBenchCommand(ctx, args)
+			},
+		},
+		{
+			Name: "migrate", Args: "up [version] | down [steps] | status", Summary: "Apply, roll back, or list schema migrations",
+			Setup: setupStore, Subcommands: []string{"up", "down", "status"},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runMigrateCommand(repo, args)
+			},
+		},
+		{
+			Name: "openapi", Args: "[--client] [flags]", Summary: "Print the API's OpenAPI document, or generate the Go client from it",
+			Setup: setupNone, Flags: true,
+			Run: func(ctx context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				return runOpenAPICommand(ctx, args)
+			},
+		},
+		{
+			Name: "completion", Args: "bash|zsh|fish", Summary: "Print a shell completion script",
+			Setup: setupNone, Subcommands: []string{"bash", "zsh", "fish"},
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				if len(args) != 1 {
+					return validationErrorf("usage: completion bash|zsh|fish")
+				}
+				return writeCompletion(os.Stdout, args[0])
+			},
+		},
+		{
+			Name: "help", Args: "[command]", Summary: "Show help for a command",
+			Setup: setupNone,
+			Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, args []string) error {
+				if len(args) == 0 {
+					printUsage(os.Stdout)
+					return nil
+				}
+				cmd := findCommand(args[0])
+				if cmd == nil {
+					return validationErrorf("unknown command %q", args[0])
+				}
+				return printCommandHelp(cmd)
+			},
+		},
+	}
+	for _, cmd := range commands {
+		if cmd.Name != "help" && cmd.Name != "completion" {
+			commandNames = append(commandNames, cmd.Name)
+		}
+	}
+}
+
+// commandNames lists the commands for completion, without help and completion themselves
+var commandNames []string
+
+// controlCommand builds a command that sends an action to the running daemon
+func controlCommand(action, summary string) *Command {
+	return &Command{
+		Name: action, Summary: summary, Setup: setupConfig,
+		Run: func(_ context.Context, _ context.CancelFunc, repo *Repository, _ []string) error {
+			return sendControlAction(action)
+		},
+	}
+}
+
+// findCommand looks up a command by name
+func findCommand(name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// isHelpFlag reports whether an argument asks for help
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// describeFlags, when set, receives a command's flag set instead of printing its help
+// It is how completion learns the flags of a command without running it
+var describeFlags func(fs *flag.FlagSet)
+
+// newFlagSet creates the flag set of a command (or of a subcommand such as "alerts add")
+// Its help lists the command's synopsis before the flags
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		if describeFlags != nil {
+			describeFlags(fs)
+			return
+		}
+		w := fs.Output()
+		if cmd := findCommand(name); cmd != nil {
+			printCommandHeader(w, cmd)
+		} else {
+			fmt.Fprintf(w, "Usage: bitcoin-tracker %s [flags] ...\n", name)
+		}
+		fmt.Fprintln(w, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// printUsage writes the global synopsis and the command list
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: bitcoin-tracker [global flags] [command] [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintln(w, "\nGlobal flags:")
+	flag.CommandLine.SetOutput(w)
+	flag.PrintDefaults()
+	fmt.Fprintln(w, "\nRun \"bitcoin-tracker help <command>\" or \"bitcoin-tracker <command> --help\" for details.")
+}
+
+// printCommandHeader writes a command's synopsis, summary, and subcommands
+func printCommandHeader(w io.Writer, cmd *Command) {
+	fmt.Fprintf(w, "Usage: bitcoin-tracker %s %s\n\n%s\n", cmd.Name, cmd.Args, cmd.Summary)
+	if len(cmd.Subcommands) > 0 {
+		fmt.Fprintf(w, "\nSubcommands: %s\n", strings.Join(cmd.Subcommands, ", "))
+	}
+}
+
+// printCommandHelp writes the help of a command, including its flags
+// Commands with flags print it themselves when given --help, before any setup
+func printCommandHelp(cmd *Command) error {
+	if !cmd.Flags {
+		printCommandHeader(os.Stdout, cmd)
+		return nil
+	}
+	err := cmd.Run(context.Background(), func() {}, nil, []string{"--help"})
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+// commandFlags lists the flag names of a command, with their usage
+func commandFlags(cmd *Command) map[string]string {
+	names := make(map[string]string)
+	if !cmd.Flags {
+		return names
+	}
+	describeFlags = func(fs *flag.FlagSet) {
+		fs.VisitAll(func(f *flag.Flag) { names[f.Name] = f.Usage })
+	}
+	defer func() { describeFlags = nil }()
+	_ = cmd.Run(context.Background(), func() {}, nil, []string{"--help"})
+	return names
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// globalFlagNames lists the flags accepted before the command
+func globalFlagNames() []string {
+	var names []string
+	flag.VisitAll(func(f *flag.Flag) { names = append(names, "--"+f.Name) })
+	return names
+}
+
+// fishQuote quotes a string for fish, which expands variables inside double quotes
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// writeCompletion prints a completion script for bash, zsh, or fish
+// Commands, their subcommands, and their flags are completed; zsh reuses the bash
+// script through bashcompinit
+func writeCompletion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash", "zsh":
+		if shell == "zsh" {
+			fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+		}
+		fmt.Fprintln(w, "_bitcoin_tracker() {")
+		fmt.Fprintln(w, `    local cur="${COMP_WORDS[COMP_CWORD]}" cmd="" pos=0 i`)
+		fmt.Fprintln(w, `    for ((i = 1; i < COMP_CWORD; i++)); do`)
+		fmt.Fprintln(w, `        case "${COMP_WORDS[i]}" in`)
+		var valued []string
+		flag.VisitAll(func(f *flag.Flag) { valued = append(valued, "-"+f.Name, "--"+f.Name) })
+		fmt.Fprintf(w, "            %s) [[ -z \"$cmd\" ]] && ((i++)) ;;\n", strings.Join(valued, "|"))
+		fmt.Fprintln(w, `            -*) ;;`)
+		fmt.Fprintln(w, `            *) if [[ -z "$cmd" ]]; then cmd="${COMP_WORDS[i]}"; pos=$i; fi ;;`)
+		fmt.Fprintln(w, `        esac`)
+		fmt.Fprintln(w, `    done`)
+		fmt.Fprintln(w, `    local words`)
+		fmt.Fprintln(w, `    case "$cmd" in`)
+		fmt.Fprintf(w, "        \"\") words=%q ;;\n", strings.Join(append(append(commandNames, "completion", "help"), globalFlagNames()...), " "))
+		for _, cmd := range commands {
+			var words []string
+			for _, name := range sortedKeys(commandFlags(cmd)) {
+				words = append(words, "--"+name)
+			}
+			subcommands := strings.Join(cmd.Subcommands, " ")
+			if cmd.Name == "help" {
+				subcommands = strings.Join(commandNames, " ")
+			}
+			if subcommands == "" && len(words) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "        %s)\n", cmd.Name)
+			if subcommands != "" {
+				fmt.Fprintf(w, "            if ((COMP_CWORD == pos + 1)); then words=%q; else words=%q; fi ;;\n", strings.TrimSpace(subcommands+" "+strings.Join(words, " ")), strings.Join(words, " "))
+			} else {
+				fmt.Fprintf(w, "            words=%q ;;\n", strings.Join(words, " "))
+			}
+		}
+		fmt.Fprintln(w, `    esac`)
+		fmt.Fprintln(w, `    COMPREPLY=($(compgen -W "$words" -- "$cur"))`)
+		fmt.Fprintln(w, "}")
+		fmt.Fprintln(w, "complete -F _bitcoin_tracker bitcoin-tracker")
+	case "fish":
+		fmt.Fprintln(w, "complete -c bitcoin-tracker -f")
+		flag.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(w, "complete -c bitcoin-tracker -n __fish_use_subcommand -l %s -r -d %s\n", f.Name, fishQuote(f.Usage))
+		})
+		for _, cmd := range commands {
+			fmt.Fprintf(w, "complete -c bitcoin-tracker -n __fish_use_subcommand -a %s -d %s\n", cmd.Name, fishQuote(cmd.Summary))
+		}
+		for _, cmd := range commands {
+			condition := "__fish_seen_subcommand_from " + cmd.Name
+			subcommands := cmd.Subcommands
+			if cmd.Name == "help" {
+				subcommands = commandNames
+			}
+			if len(subcommands) > 0 {
+				fmt.Fprintf(w, "complete -c bitcoin-tracker -n %s -a %s\n", fishQuote(condition), fishQuote(strings.Join(subcommands, " ")))
+			}
+			flags := commandFlags(cmd)
+			for _, name := range sortedKeys(flags) {
+				fmt.Fprintf(w, "complete -c bitcoin-tracker -n %s -l %s -d %s\n", fishQuote(condition), name, fishQuote(flags[name]))
+			}
+		}
+	default:
+		return fmt.Errorf("unknown shell %q (expected bash, zsh, or fish)", shell)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+// Package client is a Go client for the Bitcoin Price Tracker HTTP API
+// (served by `bitcoin-tracker serve`, or by the scheduler when API_ADDR is set).
+// It wraps the generated apiclient, whose methods it inherits, with shorthands for
+// the common reads, paging through long ranges, and price streaming.
+//
+//	c := client.New("http://tracker:8080")
+//	p, err := c.Latest(ctx, "usd")
+package client
+
+import (
+	"bufio"         // Package for reading event streams
+	"context"       // Package for request cancellation
+	"encoding/json" // Package for decoding stream events
+	"errors"        // Package for sentinel errors
+	"fmt"           // Package for formatted errors
+	"net/http"      // Package for the stream request
+	"net/url"       // Package for the stream's query string
+	"strconv"       // Package for event IDs
+	"strings"       // Package for parsing event lines
+	"time"          // Package for range boundaries and polling
+
+	"bitcoin-tracker/apiclient" // Generated client the requests go through
+)
+
+// Price is one stored price sample; the percent changes are only set by Latest, and
+// nil when the tracker's history doesn't reach back that far
+type Price = apiclient.LatestPrice
+
+// Candle is the open/high/low/close summary of the prices in one time bucket
+type Candle = apiclient.Candle
+
+// Stats summarizes the prices recorded in [From, To); the figures are zero when Samples is 0
+type Stats = apiclient.PriceStats
+
+// ErrNotFound is returned by Latest when the tracker has no prices for the currency
+// The error also unwraps to the *apiclient.Error with the tracker's problem details.
+var ErrNotFound = errors.New("no prices found")
+
+// pageSize is the number of records requested per page; the tracker's maximum
+const pageSize = 10000
+
+// Client talks to one tracker instance
+// Its methods are safe for concurrent use.
+type Client struct {
+	*apiclient.Client               // BaseURL, HTTPClient, and APIKey, and a method per operation
+	PollInterval      time.Duration // How often StreamPrices polls trackers without a price stream
+}
+
+// New creates a client for the tracker at baseURL
+func New(baseURL string) *Client {
+	return &Client{Client: apiclient.New(baseURL), PollInterval: 30 * time.Second}
+}
+
+// notFound turns a 404 into ErrNotFound
+func notFound(err error) error {
+	var apiErr *apiclient.Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
+
+// priceOf returns a listed record as a Price, without changes
+func priceOf(r apiclient.PriceRecord) Price {
+	return Price{
+		ID: r.ID, Price: r.Price, Currency: r.Currency, Source: r.Source, Degraded: r.Degraded, FXRate: r.FXRate,
+		Latency: r.Latency, Volume24h: r.Volume24h, MarketCap: r.MarketCap, Timestamp: r.Timestamp,
+	}
+}
+
+// Fetch asks the tracker to fetch and store the current prices now, and returns the
+// newest price of every configured currency. The tracker only allows it with an API key.
+func (c *Client) Fetch(ctx context.Context) ([]Price, error) {
+	records, err := c.Client.Fetch(ctx, apiclient.FetchParams{})
+	prices := make([]Price, len(records))
+	for i, r := range records {
+		prices[i] = priceOf(r)
+	}
+	return prices, err
+}
+
+// Latest returns the newest price for currency ("" = the tracker's first configured currency)
+func (c *Client) Latest(ctx context.Context, currency string) (Price, error) {
+	p, err := c.LatestPrice(ctx, apiclient.LatestPriceParams{Currency: currency})
+	return p, notFound(err)
+}
+
+// Range returns every price recorded in [from, to), oldest first
+// A zero to leaves the range open-ended. Large ranges are fetched page by page, each
+// continuing after the last record of the one before.
+func (c *Client) Range(ctx context.Context, currency string, from, to time.Time) ([]Price, error) {
+	var all []Price
+	limit := pageSize
+	after := 0
+	for {
+		params := apiclient.ListPricesParams{Currency: currency, From: from, To: to, Limit: &limit}
+		if after > 0 {
+			params.After = strconv.Itoa(after)
+		}
+		page, err := c.ListPrices(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		// A tracker that doesn't know the cursor answers with the same page again
+		if len(page) > 0 && page[len(page)-1].ID == after {
+			return all, nil
+		}
+		for _, r := range page {
+			all = append(all, priceOf(r))
+		}
+		if len(page) < pageSize {
+			return all, nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+// Candles returns the resolution ("1h" or "1d") candles starting in [from, to), oldest first
+// A zero to leaves the range open-ended.
+func (c *Client) Candles(ctx context.Context, currency, resolution string, from, to time.Time) ([]Candle, error) {
+	limit := pageSize
+	return c.ListCandles(ctx, apiclient.ListCandlesParams{Currency: currency, Resolution: resolution, From: from, To: to, Limit: &limit})
+}
+
+// Stats returns price statistics for [from, to), computed by the tracker's database
+func (c *Client) Stats(ctx context.Context, currency string, from, to time.Time) (Stats, error) {
+	return c.GetStats(ctx, apiclient.GetStatsParams{Currency: currency, From: from, To: to})
+}
+
+// StreamPrices calls fn with the newest price for currency and then with every
+// new sample as the tracker records it, until ctx is cancelled or fn or a
+// request returns an error. Samples are pushed over Server-Sent Events
+// (GET /prices/stream); when the tracker ends the stream, e.g. on restart, it is
+// resumed after the tracker's retry delay without missing samples. Trackers
+// without the endpoint are polled every PollInterval instead.
+func (c *Client) StreamPrices(ctx context.Context, currency string, fn func(Price) error) error {
+	lastID := 0
+	for {
+		retry, err := c.streamEvents(ctx, currency, &lastID, fn)
+		if errors.Is(err, errStreamUnsupported) && lastID == 0 {
+			return c.pollPrices(ctx, currency, fn)
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+// errStreamUnsupported means the tracker predates GET /prices/stream
+var errStreamUnsupported = errors.New("tracker does not support price streams")
+
+// streamEvents reads one Server-Sent Events connection, calling fn for each price
+// lastID is the newest price delivered so far and is sent as Last-Event-ID so a
+// resumed stream starts where the previous one stopped. It returns the reconnect
+// delay requested by the tracker and a nil error when the stream simply ended.
+func (c *Client) streamEvents(ctx context.Context, currency string, lastID *int, fn func(Price) error) (time.Duration, error) {
+	retry := c.PollInterval
+	query := url.Values{}
+	if currency != "" {
+		query.Set("currency", currency)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/prices/stream?"+query.Encode(), nil)
+	if err != nil {
+		return retry, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	if *lastID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.Itoa(*lastID))
+	}
+
+	// The stream stays open indefinitely, so the client's overall timeout can't apply
+	streamClient := &http.Client{Transport: c.HTTPClient.Transport}
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return retry, fmt.Errorf("request to /prices/stream failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return retry, errStreamUnsupported
+	case resp.StatusCode != http.StatusOK:
+		return retry, fmt.Errorf("/prices/stream returned status %d", resp.StatusCode)
+	}
+
+	// Events are "field: value" lines ending with a blank line; lines starting
+	// with ":" are keep-alive comments
+	var event, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data != "" && (event == "" || event == "price") {
+				var p Price
+				if err := json.Unmarshal([]byte(data), &p); err != nil {
+					return retry, fmt.Errorf("failed to decode price event: %w", err)
+				}
+				if err := fn(p); err != nil {
+					return retry, err
+				}
+				*lastID = p.ID
+			}
+			event, data = "", ""
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			if data != "" {
+				data += "\n"
+			}
+			data += value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return retry, ctx.Err()
+	}
+	// A read error just means the connection dropped; the caller reconnects
+	return retry, nil
+}
+
+// pollPrices is StreamPrices for trackers without GET /prices/stream
+// The tracker is polled for new samples every PollInterval.
+func (c *Client) pollPrices(ctx context.Context, currency string, fn func(Price) error) error {
+	lastID := 0
+	since := time.Now()
+
+	latest, err := c.Latest(ctx, currency)
+	switch {
+	case err == nil:
+		if err := fn(latest); err != nil {
+			return err
+		}
+		lastID, since = latest.ID, latest.Timestamp
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+
+	ticker := time.NewTicker(c.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		prices, err := c.Range(ctx, currency, since, time.Time{})
+		if ctx.Err() != nil {
+			return ctx.Err() // Cancelled mid-request
+		}
+		if err != nil {
+			return err
+		}
+		for _, p := range prices {
+			if p.ID <= lastID {
+				continue
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+			lastID, since = p.ID, p.Timestamp
+		}
+	}
+}
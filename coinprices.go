@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"  // Package for the requests' deadline
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"slices"   // Package for ordering the failed coins
+	"strings"  // Package for string manipulation
+)
+
+// Baskets and the stablecoins collector price many coins with one CoinGecko request.
+// A response can leave some of them out, e.g. a coin that was just delisted or whose
+// quote is briefly missing, so fetchCoinPrices keeps the prices it got, asks for each
+// missing coin on its own, and reports the coins that still have none as a partial
+// failure rather than failing the whole request.
+
+// coinPrices is the outcome of a multi-coin price request
+type coinPrices struct {
+	Prices map[string]float64 // By CoinGecko ID
+	Failed map[string]error   // Coins without a price even after their own request
+}
+
+// partial reports whether some but not all coins were priced
+func (p coinPrices) partial() bool {
+	return len(p.Failed) > 0 && len(p.Prices) > 0
+}
+
+// failedCoins returns the coins without a price, sorted
+func (p coinPrices) failedCoins() []string {
+	coins := make([]string, 0, len(p.Failed))
+	for coin := range p.Failed {
+		coins = append(coins, coin)
+	}
+	slices.Sort(coins)
+	return coins
+}
+
+// err returns nil when every coin was priced, and otherwise names each failed coin
+// with its error
+func (p coinPrices) err() error {
+	if len(p.Failed) == 0 {
+		return nil
+	}
+	var parts []string
+	for _, coin := range p.failedCoins() {
+		parts = append(parts, coin+": "+p.Failed[coin].Error())
+	}
+	if len(p.Prices) == 0 {
+		return fmt.Errorf("no coin priced: %s", strings.Join(parts, "; "))
+	}
+	return fmt.Errorf("priced %d of %d coins: %s", len(p.Prices), len(p.Prices)+len(p.Failed), strings.Join(parts, "; "))
+}
+
+// fetchCoinPrices asks CoinGecko's simple/price for the currency prices of coins in one
+// request, then for each coin the response left out in a request of its own. params are
+// appended to every request, e.g. "&precision=6". purpose labels the requests and the
+// metrics, e.g. "basket". Only a failed first request is returned as an error; missing
+// coins are in the result's Failed, and counted in tracker_coin_fetches_total and
+// tracker_coin_fetch_failures_total.
+func fetchCoinPrices(ctx context.Context, repo *Repository, purpose string, coins []string, currency, params string) (coinPrices, error) {
+	result := coinPrices{Prices: make(map[string]float64, len(coins)), Failed: make(map[string]error)}
+	missing, err := requestCoinPrices(ctx, repo, purpose, coins, currency, params, result.Prices)
+	if err != nil {
+		incCounter("tracker_coin_fetches_total", map[string]string{"purpose": purpose, "result": "error"}, 1)
+		return result, err
+	}
+
+	for _, coin := range missing {
+		if len(coins) == 1 {
+			// Asking again would repeat the same request
+			result.Failed[coin] = fmt.Errorf("no %s price returned; is it a CoinGecko coin ID?", currency)
+			continue
+		}
+		if ctx.Err() != nil {
+			result.Failed[coin] = ctx.Err()
+			continue
+		}
+		// The coin may have been dropped from a crowded response; alone it either
+		// comes back or shows that CoinGecko has no price for it
+		still, err := requestCoinPrices(ctx, repo, purpose, []string{coin}, currency, params, result.Prices)
+		switch {
+		case err != nil:
+			result.Failed[coin] = err
+		case len(still) > 0:
+			result.Failed[coin] = fmt.Errorf("no %s price returned; is it a CoinGecko coin ID?", currency)
+		default:
+			slog.Info("Fetched a coin left out of a multi-coin response on its own", "purpose", purpose, "coin", coin)
+		}
+	}
+
+	outcome := "ok"
+	switch {
+	case len(result.Prices) == 0:
+		outcome = "error"
+	case len(result.Failed) > 0:
+		outcome = "partial"
+	}
+	incCounter("tracker_coin_fetches_total", map[string]string{"purpose": purpose, "result": outcome}, 1)
+	for _, coin := range result.failedCoins() {
+		incCounter("tracker_coin_fetch_failures_total", map[string]string{"purpose": purpose, "coin": coin}, 1)
+	}
+	if result.partial() {
+		slog.Warn("Multi-coin fetch was partial", "purpose", purpose, "priced", len(result.Prices),
+			"failed", strings.Join(result.failedCoins(), ","), "error", result.err())
+	}
+	return result, nil
+}
+
+// requestCoinPrices makes one simple/price request for coins, adds the positive prices
+// it returns to prices, and returns the coins it left out, in their order
+func requestCoinPrices(ctx context.Context, repo *Repository, purpose string, coins []string, currency, params string, prices map[string]float64) ([]string, error) {
+	// Response format: {"bitcoin": {"usd": 43250.75}, "ethereum": {"usd": 2301.1}}
+	url := coinGeckoAPI.BaseURL() + "/simple/price?ids=" + strings.Join(coins, ",") + "&vs_currencies=" + currency + params
+	var data map[string]map[string]float64
+	if err := getJSON(ctx, repo, "coingecko", purpose, url, &data); err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, coin := range coins {
+		price := data[coin][currency]
+		if price <= 0 {
+			missing = append(missing, coin)
+			continue
+		}
+		prices[coin] = price
+	}
+	return missing, nil
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"       // Package for collecting within a deadline
+	"encoding/json" // Package for JSON exports
+	"errors"        // Package for joining collector errors
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for export writers
+	"log/slog"      // Package for structured logging
+	"math"          // Package for scaling values to SI prefixes
+	"net/http"      // Package for the collector endpoints
+	"os"            // Package for environment variables
+	"slices"        // Package for checking collector names
+	"sort"          // Package for ordering metric names
+	"strconv"       // Package for formatting values
+	"strings"       // Package for string manipulation
+	"time"          // Package for timestamps and intervals
+)
+
+// Besides prices, the tracker can record other series on a schedule through collectors.
+// Each collector of COLLECTORS measures a few named metrics on every run of the
+// scheduler's collectors job, and the values go into the collector_samples table. Metric
+// names are unique across collectors, so display, export, and the API look series up
+// by metric alone.
+
+// Collector is implemented by every secondary data collector
+// Collect returns the current value of each of its metrics it could fetch, by metric
+// name; when it fails for some of them, it returns the others along with the error.
+type Collector interface {
+	Name() string
+	Source() string // Provider the values are fetched from, as stored with them
+	Metrics() []CollectorMetric
+	Collect(ctx context.Context, repo *Repository) (map[string]float64, error)
+}
+
+// CollectorMetric describes one series a collector records
+type CollectorMetric struct {
+	Name  string `json:"name"`
+	Unit  string `json:"unit"` // e.g. "H/s"; empty for plain numbers
+	About string `json:"about"`
+	Count bool   `json:"-"` // Shown with thousands separators rather than an SI prefix
+}
+
+// availableCollectors lists every built-in collector by its config name
+var availableCollectors = map[string]Collector{
+	"onchain":     onchainCollector{},
+	"stablecoins": stablecoinCollector{},
+}
+
+// CollectorSample is a value a collector recorded
+type CollectorSample struct {
+	ID        int       `json:"id"`
+	Collector string    `json:"collector"`
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// CollectorConfig lists the collectors the scheduler runs and how often
+type CollectorConfig struct {
+	Collectors []Collector         // COLLECTORS; empty runs none
+	Interval   time.Duration       // Time between runs, COLLECTOR_INTERVAL
+	Schedules  map[string]Schedule // COLLECTOR_SCHEDULES; collectors run by jobs of their own
+}
+
+// collectorConfig is the active configuration, loaded at startup
+var collectorConfig = CollectorConfig{Interval: 10 * time.Minute}
+
+// collectorNames returns the names of the built-in collectors in order
+func collectorNames() []string {
+	names := make([]string, 0, len(availableCollectors))
+	for name := range availableCollectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scheduled returns the configured collectors with a schedule of their own, or those
+// without one, which the collectors job runs
+func (c CollectorConfig) scheduled(own bool) []Collector {
+	var collectors []Collector
+	for _, collector := range c.Collectors {
+		if (c.Schedules[collector.Name()] != nil) == own {
+			collectors = append(collectors, collector)
+		}
+	}
+	return collectors
+}
+
+// loadCollectorConfig reads COLLECTORS (e.g. "onchain"), COLLECTOR_INTERVAL, and
+// COLLECTOR_SCHEDULES, name=schedule pairs moving collectors to jobs of their own
+func loadCollectorConfig() (CollectorConfig, error) {
+	c := CollectorConfig{Interval: 10 * time.Minute}
+	var names []string
+	for _, name := range strings.Split(os.Getenv("COLLECTORS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || slices.Contains(names, name) {
+			continue
+		}
+		collector, ok := availableCollectors[name]
+		if !ok {
+			return c, fmt.Errorf("unknown collector %q in COLLECTORS (expected %s)", name, strings.Join(collectorNames(), ", "))
+		}
+		names = append(names, name)
+		c.Collectors = append(c.Collectors, collector)
+	}
+	if v := os.Getenv("COLLECTOR_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return c, fmt.Errorf("invalid COLLECTOR_INTERVAL %q (expected a duration of at least 1m, e.g. 10m)", v)
+		}
+		c.Interval = d
+	}
+	schedules, err := parseScheduleList("COLLECTOR_SCHEDULES")
+	if err != nil {
+		return c, err
+	}
+	for name := range schedules {
+		if !slices.Contains(names, name) {
+			return c, fmt.Errorf("COLLECTOR_SCHEDULES names collector %q, which is not in COLLECTORS", name)
+		}
+	}
+	c.Schedules = schedules
+	return c, nil
+}
+
+// lookupCollectorMetric finds the collector recording a metric, configured or not, so
+// the history of a collector that was turned off stays browsable
+func lookupCollectorMetric(name string) (CollectorMetric, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	var known []string
+	for _, collectorName := range collectorNames() {
+		for _, m := range availableCollectors[collectorName].Metrics() {
+			if m.Name == name {
+				return m, nil
+			}
+			known = append(known, m.Name)
+		}
+	}
+	return CollectorMetric{}, validationErrorf("unknown metric %q (expected %s)", name, strings.Join(known, ", "))
+}
+
+// runCollectors runs collectors once and stores the values they return. A failing
+// collector doesn't keep the others from running; the errors of all of them are
+// returned together.
+func runCollectors(ctx context.Context, repo *Repository, collectors []Collector) (int, error) {
+	var errs []error
+	stored := 0
+	for _, collector := range collectors {
+		n, err := runCollector(ctx, repo, collector)
+		stored += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("collector %s: %w", collector.Name(), err))
+		}
+	}
+	return stored, errors.Join(errs...)
+}
+
+// runCollector runs one collector, stores the values it returned, and counts the outcome
+func runCollector(ctx context.Context, repo *Repository, collector Collector) (int, error) {
+	values, err := collector.Collect(ctx, repo)
+	now := time.Now().UTC()
+	var samples []CollectorSample
+	for _, m := range collector.Metrics() {
+		v, ok := values[m.Name]
+		if !ok {
+			continue
+		}
+		samples = append(samples, CollectorSample{
+			Collector: collector.Name(), Metric: m.Name, Value: v, Source: collector.Source(), Timestamp: now,
+		})
+		setGauge("tracker_collector_value", map[string]string{"collector": collector.Name(), "metric": m.Name}, v)
+	}
+	if len(samples) > 0 {
+		if serr := repo.SaveCollectorSamples(ctx, samples); serr != nil {
+			err = errors.Join(err, serr)
+			samples = nil
+		}
+	}
+
+	result := "ok"
+	switch {
+	case err != nil && len(samples) > 0:
+		result = "partial"
+	case err != nil:
+		result = "error"
+	}
+	incCounter("tracker_collector_runs_total", map[string]string{"collector": collector.Name(), "result": result}, 1)
+	return len(samples), err
+}
+
+// runScheduledCollectors runs the collectors without a schedule of their own on the
+// scheduler's timer. Failures are logged; the next run is still scheduled.
+func runScheduledCollectors(ctx context.Context, repo *Repository) {
+	collectors := collectorConfig.scheduled(false)
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	n, err := runCollectors(ctx, repo, collectors)
+	if err != nil {
+		slog.Error("Collectors failed", "stored", n, "error", err)
+		return
+	}
+	slog.Info("Collected metrics", "collectors", len(collectors), "values", n)
+}
+
+// runScheduledCollector runs one collector of COLLECTOR_SCHEDULES on its own job's timer
+func runScheduledCollector(ctx context.Context, repo *Repository, name string) {
+	collector, ok := availableCollectors[name]
+	if !ok || collectorConfig.Schedules[name] == nil {
+		return // Dropped from the configuration since the job was scheduled
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	n, err := runCollector(ctx, repo, collector)
+	if err != nil {
+		slog.Error("Collector failed", "collector", name, "stored", n, "error", err)
+		return
+	}
+	slog.Info("Collected metrics", "collector", name, "values", n)
+}
+
+// formatMetricValue formats a value for tables with an SI prefix, e.g. "612.35 EH/s"
+// or "83.15 T"; values below 10,000 are shown as they are, and counts in full, e.g.
+// "45,123 tx"
+func formatMetricValue(m CollectorMetric, v float64) string {
+	prefixes := []string{"", "k", "M", "G", "T", "P", "E", "Z"}
+	text, unit := strconv.FormatFloat(v, 'f', -1, 64), m.Unit
+	switch {
+	case m.Count:
+		text = formatPriceAt(v, 0)
+	case math.Abs(v) >= 1e4:
+		i := min(int(math.Log10(math.Abs(v))/3), len(prefixes)-1)
+		text, unit = fmt.Sprintf("%.2f", v/math.Pow(1000, float64(i))), prefixes[i]+m.Unit
+	}
+	return strings.TrimSpace(text + " " + unit)
+}
+
+// collectorPageSize is how many samples forEachCollectorSample reads per query
+const collectorPageSize = 5000
+
+// forEachCollectorSample calls fn for every value of a metric collected in [from, to),
+// oldest first, reading them page by page as forEachPrice does
+func forEachCollectorSample(ctx context.Context, repo *Repository, metric string, from, to time.Time, fn func(CollectorSample) error) error {
+	seen := make(map[int]bool) // IDs at the page boundary, which the next page repeats
+	for {
+		page, err := repo.CollectorSamples(ctx, metric, from, to, collectorPageSize)
+		if err != nil {
+			return err
+		}
+
+		added := 0
+		for _, v := range page {
+			if seen[v.ID] {
+				continue
+			}
+			added++
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		if len(page) < collectorPageSize || added == 0 {
+			return nil
+		}
+
+		from = page[len(page)-1].Timestamp
+		seen = make(map[int]bool)
+		for _, v := range page {
+			if v.Timestamp.Equal(from) {
+				seen[v.ID] = true
+			}
+		}
+	}
+}
+
+// exportCollectorSamples writes a metric's values collected in [from, to) as CSV or
+// JSON, like the price exports, and returns how many it wrote
+func exportCollectorSamples(repo *Repository, w io.Writer, format, metric string, from, to time.Time) (int, error) {
+	ctx := context.Background()
+	count := 0
+	switch format {
+	case "csv":
+		if _, err := io.WriteString(w, "id,timestamp,collector,metric,value,source\n"); err != nil {
+			return 0, err
+		}
+		err := forEachCollectorSample(ctx, repo, metric, from, to, func(v CollectorSample) error {
+			count++
+			_, err := fmt.Fprintf(w, "%d,%s,%s,%s,%s,%s\n", v.ID, v.Timestamp.UTC().Format(time.RFC3339),
+				v.Collector, v.Metric, strconv.FormatFloat(v.Value, 'f', -1, 64), v.Source)
+			return err
+		})
+		return count, err
+	case "json":
+		if _, err := io.WriteString(w, "["); err != nil {
+			return 0, err
+		}
+		err := forEachCollectorSample(ctx, repo, metric, from, to, func(v CollectorSample) error {
+			sep := ",\n"
+			if count == 0 {
+				sep = "\n"
+			}
+			count++
+			v.Timestamp = v.Timestamp.UTC()
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, sep+string(data))
+			return err
+		})
+		if err != nil {
+			return count, err
+		}
+		_, err = io.WriteString(w, "\n]\n")
+		return count, err
+	}
+	return 0, fmt.Errorf("unsupported collector export format %q", format)
+}
+
+// displayCollectorSamples shows one page of a metric's values, newest first
+func displayCollectorSamples(repo *Repository, metric string, offset, limit int) error {
+	m, err := lookupCollectorMetric(metric)
+	if err != nil {
+		return err
+	}
+	samples, total, err := repo.SearchCollectorSamples(context.Background(), m.Name, offset, limit)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		if total > 0 {
+			slog.Info("No records on this page", "matching", total)
+		} else {
+			slog.Info("No values recorded for metric", "metric", m.Name)
+		}
+		return nil
+	}
+
+	fmt.Printf("\n%s (%s)\n", m.Name, m.About)
+	fmt.Printf("%-7s %-22s %-16s %-20s\n", "ID", "Value", "Source", "Timestamp")
+	fmt.Println("------------------------------------------------------------------")
+	for _, v := range samples {
+		fmt.Printf("%-7d %-22s %-16s %-20s\n", v.ID, formatMetricValue(m, v.Value), v.Source,
+			formatDisplayTime(v.Timestamp))
+	}
+	fmt.Printf("Showing %d-%d of %d records (page %d of %d)\n\n",
+		offset+1, offset+len(samples), total, offset/limit+1, (total+limit-1)/limit)
+	return nil
+}
+
+// collectorSummary is a metric with its newest value, as listed by GET /collectors
+type collectorSummary struct {
+	CollectorSample
+	Unit string `json:"unit"`
+}
+
+// collectorSummaries returns the newest value of every metric recorded so far
+func collectorSummaries(ctx context.Context, repo *Repository) ([]collectorSummary, error) {
+	latest, err := repo.LatestCollectorSamples(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]collectorSummary, 0, len(latest))
+	for _, v := range latest {
+		s := collectorSummary{CollectorSample: v}
+		if m, err := lookupCollectorMetric(v.Metric); err == nil {
+			s.Unit = m.Unit
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+// handleCollectors serves GET /collectors, every metric with its newest value, and
+// GET /collectors/history?metric=hashrate&from=...&to=...&limit=..., the values of one
+// metric in a range (from defaults to 24 hours ago and to to now), oldest first
+func (s *apiServer) handleCollectors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if r.URL.Path == "/collectors" {
+		summaries, err := collectorSummaries(r.Context(), s.repo)
+		if err != nil {
+			slog.Error("API failed to query collectors", "path", r.URL.Path, "error", err)
+			writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query collectors")
+			return
+		}
+		writeJSON(w, http.StatusOK, summaries)
+		return
+	}
+	if r.URL.Path != "/collectors/history" {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	m, err := lookupCollectorMetric(r.URL.Query().Get("metric"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "%v", err)
+		return
+	}
+	from, to, err := requestWindow(r, "24h")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	limit := defaultRangeLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxRangeLimit {
+			writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and %d", maxRangeLimit)
+			return
+		}
+	}
+
+	samples, err := s.repo.CollectorSamples(r.Context(), m.Name, from, to, limit)
+	if err != nil {
+		slog.Error("API failed to query collector samples", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query collector samples")
+		return
+	}
+	if samples == nil {
+		samples = []CollectorSample{} // Encode an empty range as [] rather than null
+	}
+	writeJSON(w, http.StatusOK, samples)
+}
+
+// runCollectorsCommand handles "collectors [--fetch]"
+// It lists every metric of the configured collectors with its newest value; --fetch
+// runs the collectors first
+func runCollectorsCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("collectors")
+	fetch := fs.Bool("fetch", false, "Run the configured collectors first")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if len(collectorConfig.Collectors) == 0 {
+		return validationErrorf("no collector is configured; set COLLECTORS, e.g. onchain")
+	}
+
+	if *fetch {
+		n, err := runCollectors(ctx, repo, collectorConfig.Collectors)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Stored %d values\n", n)
+	}
+	latest, err := repo.LatestCollectorSamples(ctx)
+	if err != nil {
+		return err
+	}
+	byMetric := make(map[string]CollectorSample, len(latest))
+	for _, v := range latest {
+		byMetric[v.Metric] = v
+	}
+
+	fmt.Printf("\n%-10s %-15s %-22s %-16s %-20s\n", "Collector", "Metric", "Value", "Source", "Collected")
+	fmt.Println("--------------------------------------------------------------------------------------")
+	for _, collector := range collectorConfig.Collectors {
+		for _, m := range collector.Metrics() {
+			v, ok := byMetric[m.Name]
+			if !ok {
+				fmt.Printf("%-10s %-15s %-22s\n", collector.Name(), m.Name, "-")
+				continue
+			}
+			fmt.Printf("%-10s %-15s %-22s %-16s %-20s\n", collector.Name(), m.Name, formatMetricValue(m, v.Value), v.Source,
+				formatDisplayTime(v.Timestamp))
+		}
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,614 @@
+package main
+
+import (
+	"flag"          // Package for the --config flag
+	"fmt"           // Package for formatted I/O operations
+	"os"            // Package for reading the file and setting environment variables
+	"path/filepath" // Package for detecting the file format
+	"sort"          // Package for ordering map settings
+	"strconv"       // Package for unquoting string values
+	"strings"       // Package for parsing lines
+)
+
+// configFlag holds the --config flag value
+var configFlag = flag.String("config", "", "YAML or TOML configuration file; environment variables override its values")
+
+// configSettings maps configuration file keys to the environment variables they fill in
+// The file is a second way of writing the environment: every setting keeps its env
+// var name, default, and validation, so the rest of the code only reads the environment.
+var configSettings = map[string]string{
+	"database.driver":          "DB_DRIVER",
+	"database.url":             "DATABASE_URL",
+	"database.replica_url":     "DATABASE_REPLICA_URL",
+	"database.clickhouse_url":  "CLICKHOUSE_URL",
+	"tracing.otlp_endpoint":    "OTEL_EXPORTER_OTLP_ENDPOINT",
+	"tracing.otlp_headers":     "OTEL_EXPORTER_OTLP_HEADERS",
+	"tracing.service_name":     "OTEL_SERVICE_NAME",
+	"tracing.sample_ratio":     "OTEL_TRACES_SAMPLER_ARG",
+	"database.sqlite_path":     "SQLITE_PATH",
+	"database.legacy_timezone": "LEGACY_TIMEZONE",
+	"database.timeout":         "DB_TIMEOUT",
+	"database.startup_timeout": "DB_STARTUP_TIMEOUT",
+	"database.startup_buffer":  "DB_STARTUP_BUFFER",
+	"database.spool_file":      "SPOOL_FILE",
+	"database.spool_max_size":  "SPOOL_MAX_SIZE",
+	"database.timescale":       "TIMESCALE",
+	"database.read_only":       "READ_ONLY",
+
+	"log.level":  "LOG_LEVEL",
+	"log.format": "LOG_FORMAT",
+
+	"config.watch": "CONFIG_WATCH",
+
+	"http.connect_timeout": "HTTP_CONNECT_TIMEOUT",
+	"http.proxy":           "HTTP_PROXY",
+	"http.https_proxy":     "HTTPS_PROXY",
+	"http.no_proxy":        "NO_PROXY",
+	"http.ca_bundle":       "HTTP_CA_BUNDLE",
+	"http.tls_min_version": "HTTP_TLS_MIN_VERSION",
+
+	"interval":           "FETCH_INTERVAL",
+	"currencies":         "CURRENCIES",
+	"price_scale":        "PRICE_SCALE",
+	"price_scales":       "PRICE_SCALES",
+	"locale":             "LOCALE",
+	"templates_dir":      "TEMPLATES_DIR",
+	"shutdown_timeout":   "SHUTDOWN_TIMEOUT",
+	"control_socket":     "CONTROL_SOCKET",
+	"pid_file":           "PID_FILE",
+	"tenant":             "TENANT",
+	"display.timezone":   "DISPLAY_TIMEZONE",
+	"http_timeout":       "HTTP_TIMEOUT",
+	"metrics.addr":       "METRICS_ADDR",
+	"api.addr":           "API_ADDR",
+	"api.auth":           "API_AUTH",
+	"api.key_rate_limit": "API_KEY_RATE_LIMIT",
+	"grpc.addr":          "GRPC_ADDR",
+	"grpc.tls_cert":      "GRPC_TLS_CERT",
+	"grpc.tls_key":       "GRPC_TLS_KEY",
+	"health_max_age":     "HEALTH_MAX_AGE",
+
+	"providers.sources":             "PRICE_SOURCES",
+	"providers.aggregation":         "PRICE_AGGREGATION",
+	"providers.weights":             "PRICE_SOURCE_WEIGHTS",
+	"providers.quorum":              "PRICE_QUORUM",
+	"providers.attribution":         "ATTRIBUTION",
+	"providers.market_data":         "MARKET_DATA",
+	"providers.fear_greed":          "FEAR_GREED",
+	"providers.fear_greed_history":  "FEAR_GREED_HISTORY",
+	"fx.currencies":                 "FX_CURRENCIES",
+	"fx.base":                       "FX_BASE",
+	"fx.provider":                   "FX_PROVIDER",
+	"fx.api_key":                    "FX_API_KEY",
+	"fx.refresh":                    "FX_REFRESH",
+	"fx.max_age":                    "FX_MAX_AGE",
+	"units.derived":                 "DERIVED_UNITS",
+	"units.gold_provider":           "GOLD_PROVIDER",
+	"units.gold_api_key":            "GOLD_API_KEY",
+	"units.gold_refresh":            "GOLD_REFRESH",
+	"providers.symbols":             "PROVIDER_SYMBOLS",
+	"providers.deadline":            "FETCH_DEADLINE",
+	"providers.rate_limits":         "RATE_LIMITS",
+	"providers.cache_ttl":           "PROVIDER_CACHE_TTL",
+	"providers.user_agent":          "PROVIDER_USER_AGENT",
+	"providers.headers":             "PROVIDER_HEADERS",
+	"providers.skip_unchanged":      "SKIP_UNCHANGED_PRICES",
+	"providers.raw_responses":       "RAW_RESPONSES",
+	"providers.raw_retention":       "RAW_RESPONSE_RETENTION",
+	"providers.coingecko.api_key":   "COINGECKO_API_KEY",
+	"providers.coingecko.plan":      "COINGECKO_API_PLAN",
+	"providers.retry.max_attempts":  "RETRY_MAX_ATTEMPTS",
+	"providers.retry.base_delay":    "RETRY_BASE_DELAY",
+	"providers.retry.max_delay":     "RETRY_MAX_DELAY",
+	"providers.retry.jitter":        "RETRY_JITTER",
+	"providers.budget.limit":        "BUDGET_LIMIT",
+	"providers.budget.window":       "BUDGET_WINDOW",
+	"providers.budget.asset_limits": "BUDGET_ASSET_LIMITS",
+	"providers.budget.stretch_at":   "BUDGET_STRETCH_AT",
+	"providers.exchanges":           "EXCHANGES",
+	"providers.spread_alert":        "SPREAD_ALERT",
+	"providers.baskets":             "BASKETS",
+	"providers.basket_currency":     "BASKET_CURRENCY",
+	"providers.basket_schedules":    "BASKET_SCHEDULES",
+	"providers.mock.mode":           "MOCK_MODE",
+	"providers.mock.seed":           "MOCK_SEED",
+	"providers.mock.volatility":     "MOCK_VOLATILITY",
+	"providers.mock.start_price":    "MOCK_START_PRICE",
+	"providers.mock.fail_rate":      "MOCK_FAIL_RATE",
+
+	"collectors.enabled":               "COLLECTORS",
+	"collectors.interval":              "COLLECTOR_INTERVAL",
+	"collectors.schedules":             "COLLECTOR_SCHEDULES",
+	"collectors.onchain.provider":      "ONCHAIN_PROVIDER",
+	"collectors.onchain.mempool_url":   "ONCHAIN_MEMPOOL_URL",
+	"collectors.stablecoins.coins":     "STABLECOINS",
+	"collectors.stablecoins.threshold": "PEG_THRESHOLD",
+	"collectors.stablecoins.samples":   "PEG_SAMPLES",
+
+	"stream.feed":            "STREAM_FEED",
+	"stream.sample_interval": "STREAM_SAMPLE_INTERVAL",
+	"stream.batch_interval":  "STREAM_BATCH_INTERVAL",
+
+	"write_batch.size":     "WRITE_BATCH_SIZE",
+	"write_batch.interval": "WRITE_BATCH_INTERVAL",
+
+	"anomaly.max_deviation": "ANOMALY_MAX_DEVIATION",
+	"anomaly.window":        "ANOMALY_WINDOW",
+	"anomaly.action":        "ANOMALY_ACTION",
+
+	"schedule.fetch":           "SCHEDULE_FETCH",
+	"schedule.candles":         "SCHEDULE_CANDLES",
+	"schedule.retention":       "SCHEDULE_RETENTION",
+	"schedule.portfolio":       "SCHEDULE_PORTFOLIO",
+	"schedule.summary":         "SCHEDULE_SUMMARY",
+	"schedule.fear_greed":      "SCHEDULE_FEAR_GREED",
+	"schedule.collectors":      "SCHEDULE_COLLECTORS",
+	"schedule.daily_summaries": "SCHEDULE_DAILY_SUMMARIES",
+	"schedule.report":          "SCHEDULE_REPORT",
+	"schedule.jitter":          "SCHEDULE_JITTER",
+
+	"crash_backoff.base": "CRASH_BACKOFF",
+	"crash_backoff.max":  "CRASH_BACKOFF_MAX",
+
+	"gap_fill.threshold": "GAP_FILL_THRESHOLD",
+	"gap_fill.lookback":  "GAP_FILL_LOOKBACK",
+
+	"standby.enabled":           "STANDBY",
+	"standby.instance":          "INSTANCE_NAME",
+	"standby.heartbeat":         "HEARTBEAT_INTERVAL",
+	"standby.missed_heartbeats": "STANDBY_MISSED_HEARTBEATS",
+	"standby.leader_election":   "LEADER_ELECTION",
+
+	"analytics.max_range":               "ANALYTICS_MAX_RANGE",
+	"analytics.max_points":              "ANALYTICS_MAX_POINTS",
+	"analytics.timeout":                 "ANALYTICS_TIMEOUT",
+	"analytics.daily_summary_min_range": "DAILY_SUMMARY_MIN_RANGE",
+
+	"feed.window":     "FEED_WINDOW",
+	"feed.milestones": "FEED_MILESTONES",
+
+	"retention.raw":      "RETENTION_RAW",
+	"retention.hourly":   "RETENTION_HOURLY",
+	"retention.purge":    "RETENTION_PURGE",
+	"retention.interval": "RETENTION_INTERVAL",
+	"retention.dry_run":  "RETENTION_DRY_RUN",
+
+	"archive.dir":   "ARCHIVE_DIR",
+	"archive.after": "ARCHIVE_AFTER",
+
+	"passkeys.rp_id":       "PASSKEY_RP_ID",
+	"passkeys.origins":     "PASSKEY_ORIGINS",
+	"passkeys.session_ttl": "PASSKEY_SESSION_TTL",
+
+	"share.secret":   "SHARE_SECRET",
+	"share.base_url": "SHARE_BASE_URL",
+	"share.max_ttl":  "SHARE_MAX_TTL",
+
+	"embed.origins": "EMBED_ORIGINS",
+
+	"public.mode":            "PUBLIC_API",
+	"public.cors_origins":    "PUBLIC_CORS_ORIGINS",
+	"public.rate_limit":      "PUBLIC_RATE_LIMIT",
+	"public.cache_max_age":   "PUBLIC_CACHE_MAX_AGE",
+	"public.trusted_proxies": "PUBLIC_TRUSTED_PROXIES",
+
+	"exports.dir": "EXPORT_DIR",
+	"exports.ttl": "EXPORT_TTL",
+
+	"cache.ttl":       "CACHE_TTL",
+	"cache.window":    "CACHE_WINDOW",
+	"cache.redis_url": "REDIS_URL",
+
+	"query.max_rows": "QUERY_MAX_ROWS",
+	"query.timeout":  "QUERY_TIMEOUT",
+	"query.role":     "QUERY_ROLE",
+
+	"portfolio.currency":          "PORTFOLIO_CURRENCY",
+	"portfolio.snapshot_interval": "PORTFOLIO_SNAPSHOT_INTERVAL",
+
+	"indicators.sma":         "INDICATOR_SMA",
+	"indicators.ema":         "INDICATOR_EMA",
+	"indicators.rsi":         "INDICATOR_RSI",
+	"indicators.bollinger":   "INDICATOR_BOLLINGER",
+	"indicators.bollinger_k": "INDICATOR_BOLLINGER_K",
+
+	"volatility.low_percentile":  "VOL_LOW_PERCENTILE",
+	"volatility.high_percentile": "VOL_HIGH_PERCENTILE",
+
+	"alerts.cooldown":                "ALERT_COOLDOWN",
+	"alerts.quiet_hours":             "QUIET_HOURS",
+	"alerts.quiet_hours_timezone":    "QUIET_HOURS_TIMEZONE",
+	"alerts.digest":                  "ALERT_DIGEST",
+	"alerts.ath":                     "ATH_ALERTS",
+	"alerts.stale_intervals":         "STALE_ALERT_INTERVALS",
+	"alerts.webhook_urls":            "ALERT_WEBHOOK_URLS",
+	"alerts.email.to":                "ALERT_EMAIL_TO",
+	"alerts.email.smtp_host":         "SMTP_HOST",
+	"alerts.email.smtp_port":         "SMTP_PORT",
+	"alerts.email.username":          "SMTP_USERNAME",
+	"alerts.email.password":          "SMTP_PASSWORD",
+	"alerts.email.from":              "SMTP_FROM",
+	"alerts.telegram.bot_token":      "TELEGRAM_BOT_TOKEN",
+	"alerts.telegram.chat_id":        "TELEGRAM_CHAT_ID",
+	"alerts.telegram.webhook_secret": "TELEGRAM_WEBHOOK_SECRET",
+	"alerts.slack.webhook_url":       "SLACK_WEBHOOK_URL",
+	"alerts.slack.signing_secret":    "SLACK_SIGNING_SECRET",
+	"alerts.discord.public_key":      "DISCORD_PUBLIC_KEY",
+	"alerts.desktop":                 "DESKTOP_NOTIFICATIONS",
+
+	"summary.time":                "SUMMARY_TIME",
+	"summary.timezone":            "SUMMARY_TIMEZONE",
+	"summary.slack_webhook_url":   "SUMMARY_SLACK_WEBHOOK_URL",
+	"summary.discord_webhook_url": "SUMMARY_DISCORD_WEBHOOK_URL",
+
+	"report.dir":           "REPORT_DIR",
+	"report.template":      "REPORT_TEMPLATE",
+	"report.pdf_command":   "REPORT_PDF_COMMAND",
+	"report.email_to":      "REPORT_EMAIL_TO",
+	"report.upload_url":    "REPORT_UPLOAD_URL",
+	"report.upload_access": "REPORT_UPLOAD_ACCESS",
+	"report.public_url":    "REPORT_PUBLIC_URL",
+	"report.link_expiry":   "REPORT_LINK_EXPIRY",
+
+	"events.webhook_urls":                "EVENT_WEBHOOK_URLS",
+	"events.format":                      "EVENT_FORMAT",
+	"events.source":                      "EVENT_SOURCE",
+	"events.aws.sns_topic_arn":           "AWS_SNS_TOPIC_ARN",
+	"events.aws.eventbridge_bus":         "AWS_EVENTBRIDGE_BUS",
+	"events.aws.eventbridge_source":      "AWS_EVENTBRIDGE_SOURCE",
+	"events.aws.region":                  "AWS_REGION",
+	"events.pubsub.topic":                "PUBSUB_TOPIC",
+	"events.pubsub.attributes":           "PUBSUB_ATTRIBUTES",
+	"events.pubsub.endpoint":             "PUBSUB_ENDPOINT",
+	"events.azure.eventhub_connection":   "AZURE_EVENTHUB_CONNECTION_STRING",
+	"events.azure.eventhub_name":         "AZURE_EVENTHUB_NAME",
+	"events.azure.servicebus_connection": "AZURE_SERVICEBUS_CONNECTION_STRING",
+	"events.azure.servicebus_entity":     "AZURE_SERVICEBUS_ENTITY",
+	"events.mqtt.url":                    "MQTT_URL",
+	"events.mqtt.topic":                  "MQTT_TOPIC",
+	"events.mqtt.qos":                    "MQTT_QOS",
+	"events.mqtt.retain":                 "MQTT_RETAIN",
+	"events.mqtt.client_id":              "MQTT_CLIENT_ID",
+	"events.mqtt.price_topic":            "MQTT_PRICE_TOPIC",
+	"events.mqtt.price_format":           "MQTT_PRICE_FORMAT",
+	"events.mqtt.price_precision":        "MQTT_PRICE_PRECISION",
+	"events.mqtt.discovery_prefix":       "MQTT_DISCOVERY_PREFIX",
+	"events.redis.channel":               "REDIS_CHANNEL",
+	"events.redis.latest_key":            "REDIS_LATEST_KEY",
+	"events.redis.latest_ttl":            "REDIS_LATEST_TTL",
+	"events.nats.url":                    "NATS_URL",
+	"events.nats.subject":                "NATS_SUBJECT",
+	"events.outbox":                      "EVENT_OUTBOX",
+	"events.retry_delay":                 "EVENT_RETRY_DELAY",
+	"events.kafka.rest_url":              "KAFKA_REST_URL",
+	"events.kafka.topic":                 "KAFKA_TOPIC",
+	"events.kafka.cluster_id":            "KAFKA_CLUSTER_ID",
+	"events.file.path":                   "PRICE_FILE",
+	"events.file.format":                 "PRICE_FILE_FORMAT",
+
+	"hooks.commands": "PRICE_HOOKS",
+	"hooks.timeout":  "PRICE_HOOK_TIMEOUT",
+
+	"webhooks.max_attempts": "WEBHOOK_MAX_ATTEMPTS",
+	"webhooks.retry_delay":  "WEBHOOK_RETRY_DELAY",
+	"webhooks.delivery_ttl": "WEBHOOK_DELIVERY_TTL",
+}
+
+// configMapSettings are settings whose env var holds "key=value" pairs
+// In the file they may be written as a nested table instead of a string
+var configMapSettings = map[string]bool{
+	"price_scales":                  true,
+	"providers.budget.asset_limits": true,
+	"providers.symbols":             true,
+	"providers.cache_ttl":           true,
+	"providers.headers":             true,
+	"providers.baskets":             true,
+	"providers.basket_schedules":    true,
+	"collectors.schedules":          true,
+	"events.pubsub.attributes":      true,
+}
+
+// configEntry is one key/value pair read from a configuration file
+// List values are joined with commas, the separator every list env var uses
+type configEntry struct {
+	key   string // Dotted path, e.g. "database.driver"
+	value string
+	line  int
+}
+
+// configFileEnv records the env vars the configuration file set
+// A reload re-reads the file and clears variables whose setting was removed from it
+var configFileEnv = map[string]bool{}
+
+// configOverrides lists the file settings shadowed by the environment on the last load
+var configOverrides []string
+
+// stripConfigComment removes a trailing # comment that is not inside a quoted string
+func stripConfigComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseConfigScalar unquotes a single value; unquoted values are taken as written
+func parseConfigScalar(s string) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return v, nil
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "{"):
+		return "", fmt.Errorf("inline tables are not supported; use a nested section")
+	}
+	return s, nil
+}
+
+// parseConfigValue parses a scalar or a one-line [a, b, c] list
+func parseConfigValue(s string) (string, error) {
+	if !strings.HasPrefix(s, "[") {
+		return parseConfigScalar(s)
+	}
+	if !strings.HasSuffix(s, "]") {
+		return "", fmt.Errorf("unterminated list %s", s)
+	}
+
+	var items []string
+	for _, item := range strings.Split(s[1:len(s)-1], ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue // Allows a trailing comma
+		}
+		v, err := parseConfigScalar(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, v)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// parseYAMLConfig parses the subset of YAML a configuration file needs: nested
+// mappings, scalars, block lists ("- item"), and flow lists ("[a, b]")
+func parseYAMLConfig(data string) ([]configEntry, error) {
+	type parent struct {
+		indent int
+		key    string
+	}
+	var stack []parent
+	var entries []configEntry
+
+	for i, raw := range strings.Split(data, "\n") {
+		lineNo := i + 1
+		line := strings.TrimRight(stripConfigComment(raw), " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text == "---" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", lineNo)
+		}
+		indent := len(line) - len(text)
+
+		// List items may sit at the same indent as their key, so only deeper parents close
+		item := text == "-" || strings.HasPrefix(text, "- ")
+		for len(stack) > 0 && (stack[len(stack)-1].indent > indent || !item && stack[len(stack)-1].indent == indent) {
+			stack = stack[:len(stack)-1]
+		}
+		var path []string
+		for _, p := range stack {
+			path = append(path, p.key)
+		}
+
+		if item {
+			if len(path) == 0 {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNo)
+			}
+			v, err := parseConfigScalar(strings.TrimSpace(text[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			key := strings.Join(path, ".")
+			if n := len(entries); n > 0 && entries[n-1].key == key {
+				entries[n-1].value += "," + v
+			} else {
+				entries = append(entries, configEntry{key: key, value: v, line: lineNo})
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", lineNo)
+		}
+		if value = strings.TrimSpace(value); value == "" {
+			// A nested mapping or block list follows
+			stack = append(stack, parent{indent: indent, key: key})
+			continue
+		}
+		v, err := parseConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		entries = append(entries, configEntry{key: strings.Join(append(path, key), "."), value: v, line: lineNo})
+	}
+	return entries, nil
+}
+
+// parseTOMLConfig parses the subset of TOML a configuration file needs: [tables],
+// dotted keys, strings, numbers, booleans, and arrays (which may span lines)
+func parseTOMLConfig(data string) ([]configEntry, error) {
+	var entries []configEntry
+	table := ""
+	lines := strings.Split(data, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		text := strings.TrimSpace(stripConfigComment(lines[i]))
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if strings.HasPrefix(text, "[[") {
+				return nil, fmt.Errorf("line %d: arrays of tables are not supported", lineNo)
+			}
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: unterminated table header", lineNo)
+			}
+			table = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("line %d: expected \"key = value\"", lineNo)
+		}
+		// Join the lines of a multi-line array until it is closed
+		for strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") && i+1 < len(lines) {
+			i++
+			value += " " + strings.TrimSpace(stripConfigComment(lines[i]))
+		}
+		v, err := parseConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+		entries = append(entries, configEntry{key: key, value: v, line: lineNo})
+	}
+	return entries, nil
+}
+
+// readConfigFile parses a YAML or TOML configuration file into env var values
+// The format is chosen by extension: .yaml, .yml, or .toml
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var entries []configEntry
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		entries, err = parseYAMLConfig(string(data))
+	case ".toml":
+		entries, err = parseTOMLConfig(string(data))
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (expected .yaml, .yml, or .toml)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	env := make(map[string]string)
+	pairs := make(map[string][]string) // Nested entries of map settings, e.g. pubsub attributes
+	seen := make(map[string]int)
+	for _, e := range entries {
+		if line, ok := seen[e.key]; ok {
+			return nil, fmt.Errorf("%s: line %d: %s is already set on line %d", path, e.line, e.key, line)
+		}
+		seen[e.key] = e.line
+
+		if name, ok := configSettings[e.key]; ok {
+			env[name] = e.value
+			continue
+		}
+		parent, child := e.key, ""
+		if i := strings.LastIndex(e.key, "."); i >= 0 {
+			parent, child = e.key[:i], e.key[i+1:]
+		}
+		if !configMapSettings[parent] {
+			return nil, fmt.Errorf("%s: line %d: unknown setting %q", path, e.line, e.key)
+		}
+		pairs[parent] = append(pairs[parent], child+"="+e.value)
+	}
+
+	for key, list := range pairs {
+		name := configSettings[key]
+		if _, ok := env[name]; ok {
+			return nil, fmt.Errorf("%s: %s is set both as a string and as a table", path, key)
+		}
+		sort.Strings(list)
+		env[name] = strings.Join(list, ",")
+	}
+	return env, nil
+}
+
+// applyConfigFile fills in env vars from the --config file
+// Variables already set in the environment take precedence over the file. It runs at
+// startup and on every reload; only variables the file set earlier are replaced.
+func applyConfigFile() error {
+	if *configFlag == "" {
+		return nil
+	}
+	env, err := readConfigFile(*configFlag)
+	if err != nil {
+		return err
+	}
+
+	for name := range configFileEnv {
+		if _, ok := env[name]; !ok {
+			os.Unsetenv(name)
+			delete(configFileEnv, name)
+		}
+	}
+
+	configOverrides = nil
+	for name, value := range env {
+		if _, set := os.LookupEnv(name); set && !configFileEnv[name] {
+			configOverrides = append(configOverrides, name)
+			continue
+		}
+		os.Setenv(name, value)
+		configFileEnv[name] = true
+	}
+	sort.Strings(configOverrides)
+	return nil
+}
+
+// runConfigCommand handles "config validate"
+// It loads the configuration the same way the daemon does and reports the first problem
+func runConfigCommand(args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return validationErrorf("usage: config validate")
+	}
+
+	if err := loadConfig(); err != nil {
+		return withKind(KindConfig, err)
+	}
+	switch driver := strings.ToLower(os.Getenv("DB_DRIVER")); driver {
+	case "", "postgres", "postgresql", "sqlite", "sqlite3":
+	default:
+		return withKind(KindConfig, fmt.Errorf("unknown DB_DRIVER %q (expected postgres or sqlite)", driver))
+	}
+	if _, err := loadTimescaleMode(); err != nil {
+		return withKind(KindConfig, err)
+	}
+
+	if *configFlag == "" {
+		fmt.Println("Configuration is valid (environment only; pass --config to check a file)")
+		return nil
+	}
+	fmt.Printf("Configuration is valid: %s sets %d variables\n", *configFlag, len(configFileEnv)+len(configOverrides))
+	for _, name := range configOverrides {
+		fmt.Printf("  %s is overridden by the environment\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"  // Package for stopping the watcher
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"net/url"  // Package for redacting credentials in URLs
+	"os"       // Package for environment variables and file stats
+	"sort"     // Package for ordering the logged changes
+	"strings"  // Package for string manipulation
+	"time"     // Package for the poll interval
+)
+
+// defaultConfigWatch is how often the --config file is checked for edits
+const defaultConfigWatch = 5 * time.Second
+
+// configWatchInterval is how often the scheduler checks the --config file; zero turns it off
+var configWatchInterval = defaultConfigWatch
+
+// loadConfigWatch reads CONFIG_WATCH, the poll interval of the --config file ("0" or "off" disables)
+func loadConfigWatch() (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv("CONFIG_WATCH"))
+	switch strings.ToLower(v) {
+	case "":
+		return defaultConfigWatch, nil
+	case "0", "off", "false":
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < time.Second {
+		return 0, fmt.Errorf("invalid CONFIG_WATCH %q (expected a duration of at least 1s, or off)", v)
+	}
+	return d, nil
+}
+
+// configFileStamp identifies a version of the config file without reading it
+type configFileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// statConfigFile returns the stamp of path; a missing file has the zero stamp
+func statConfigFile(path string) configFileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return configFileStamp{}
+	}
+	return configFileStamp{info.ModTime(), info.Size()}
+}
+
+// watchConfigFile polls the --config file and signals when it changes, until ctx ends
+// It returns a nil channel, which never fires, without --config or with CONFIG_WATCH=off.
+// The interval is fixed when the scheduler starts.
+func watchConfigFile(ctx context.Context) <-chan struct{} {
+	path, interval := *configFlag, configWatchInterval
+	if path == "" || interval <= 0 {
+		return nil
+	}
+	changes := make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		slog.Info("Watching configuration file", "path", path, "interval", interval)
+		last := statConfigFile(path)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stamp := statConfigFile(path)
+				if stamp == last {
+					continue
+				}
+				last = stamp
+				if stamp == (configFileStamp{}) {
+					slog.Warn("Configuration file is missing; keeping the current configuration", "path", path)
+					continue
+				}
+				select {
+				case changes <- struct{}{}:
+				default: // A reload is already pending and will read the newest file
+				}
+			}
+		}
+	}()
+	return changes
+}
+
+// configSnapshot returns the value of every setting the config file can set
+func configSnapshot() map[string]string {
+	snapshot := make(map[string]string, len(configSettings))
+	for _, name := range configSettings {
+		snapshot[name] = os.Getenv(name)
+	}
+	return snapshot
+}
+
+// logConfigDiff logs each setting whose value differs between two snapshots
+// Secrets are logged as changed without their values.
+func logConfigDiff(before, after map[string]string) {
+	var names []string
+	for name, value := range after {
+		if before[name] != value {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		slog.Info("Configuration reloaded without changes")
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		slog.Info("Configuration changed", "setting", name,
+			"from", configDiffValue(name, before[name]), "to", configDiffValue(name, after[name]))
+	}
+	slog.Info("Configuration reloaded", "changed", len(names))
+}
+
+// configSecrets are the settings whose values the reload log leaves out; URLs elsewhere
+// have their passwords redacted. Webhook URLs carry their token in the path.
+var configSecrets = map[string]bool{
+	"COINGECKO_API_KEY": true, "FX_API_KEY": true, "GOLD_API_KEY": true,
+	"SMTP_PASSWORD": true, "SHARE_SECRET": true, "SLACK_SIGNING_SECRET": true,
+	"TELEGRAM_BOT_TOKEN": true, "TELEGRAM_WEBHOOK_SECRET": true, "OTEL_EXPORTER_OTLP_HEADERS": true,
+	"ALERT_WEBHOOK_URLS": true, "EVENT_WEBHOOK_URLS": true, "SLACK_WEBHOOK_URL": true,
+	"SUMMARY_DISCORD_WEBHOOK_URL": true, "SUMMARY_SLACK_WEBHOOK_URL": true,
+}
+
+// configDiffValue returns how a setting's value appears in the reload log
+func configDiffValue(name, value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	if configSecrets[name] {
+		return "(redacted)"
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return value
+}
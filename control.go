@@ -0,0 +1,591 @@
+package main
+
+import (
+	"context"       // Package for dialer and request contexts
+	"encoding/json" // Package for JSON encoding of status responses
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for reading error responses
+	"log/slog"      // Package for structured logging
+	"net"           // Package for Unix domain sockets
+	"net/http"      // Package for the control API over the socket
+	"os"            // Package for environment variables and file cleanup
+	"path/filepath" // Package for building the default socket path
+	"sort"          // Package for stable output ordering
+	"strings"       // Package for string manipulation
+	"sync"          // Package for guarding shared daemon state
+	"time"          // Package for timestamps
+)
+
+// daemonState holds live information about the running scheduler
+// It is updated by the scheduler and read by the control socket handlers
+type daemonState struct {
+	mu             sync.Mutex
+	startedAt      time.Time
+	schedulerState string               // "starting", "idle", "fetching", "standby"
+	scheduled      bool                 // The scheduler loop runs in this process
+	paused         bool                 // Scheduled fetches are skipped while paused
+	interval       time.Duration        // Current wait between fetches
+	nextRun        time.Time            // When the next fetch is due
+	lastSuccess    map[string]time.Time // Last successful fetch per asset
+	lastError      string               // Most recent fetch error, if any
+	lastErrorAt    time.Time            // When lastError happened
+	panics         map[string]int       // Panics in a row per scheduler job
+	backoffUntil   map[string]time.Time // When each job that panicked may run again
+	jobs           []JobStatus          // The scheduler's jobs and their next runs
+	standby        *StandbyStatus       // The primary's heartbeat while this instance is a standby
+	promotedAt     time.Time            // When this instance took over from a silent primary
+}
+
+// daemon is the process-wide daemon state
+var daemon = &daemonState{
+	startedAt:      time.Now(),
+	schedulerState: "starting",
+	lastSuccess:    make(map[string]time.Time),
+	panics:         make(map[string]int),
+	backoffUntil:   make(map[string]time.Time),
+}
+
+// markScheduled records that this process runs the scheduler loop
+func (d *daemonState) markScheduled() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.scheduled = true
+}
+
+// isScheduled reports whether this process runs the scheduler loop
+func (d *daemonState) isScheduled() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.scheduled
+}
+
+// setJobs records the state of the scheduler's jobs
+func (d *daemonState) setJobs(jobs []JobStatus) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.jobs = jobs
+}
+
+// setSchedulerState records what the scheduler is currently doing
+func (d *daemonState) setSchedulerState(state string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.schedulerState = state
+}
+
+// setNextRun records when the next fetch is due and the wait that led to it
+func (d *daemonState) setNextRun(delay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.interval = delay
+	d.nextRun = time.Now().Add(delay)
+}
+
+// setPaused pauses or resumes scheduled fetches
+func (d *daemonState) setPaused(paused bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paused = paused
+}
+
+// isPaused reports whether scheduled fetches are currently paused
+func (d *daemonState) isPaused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.paused
+}
+
+// setStandby records the primary's heartbeat while this instance waits as a standby;
+// nil when it runs the jobs
+func (d *daemonState) setStandby(status *StandbyStatus) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.standby = status
+	if status != nil {
+		d.promotedAt = time.Time{}
+	}
+}
+
+// isStandby reports whether this instance waits as a standby
+func (d *daemonState) isStandby() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.standby != nil
+}
+
+// standbyStatus returns what this instance knows about the primary while it waits as a
+// standby; nil when it runs the jobs
+func (d *daemonState) standbyStatus() *StandbyStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.standby
+}
+
+// markPromoted records that this instance took over from a silent primary
+func (d *daemonState) markPromoted(at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.standby = nil
+	d.promotedAt = at
+}
+
+// overdue reports whether the scheduler loop missed its next fetch by more than a full
+// interval plus the fetch deadline, which means it is stuck
+func (d *daemonState) overdue(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	interval := max(d.interval, fetchInterval)
+	return d.scheduled && !d.nextRun.IsZero() && now.After(d.nextRun.Add(interval+fetchDeadline))
+}
+
+// recordFetchResult stores the outcome of a fetch for an asset
+func (d *daemonState) recordFetchResult(asset string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		d.lastError = err.Error()
+		d.lastErrorAt = time.Now()
+		return
+	}
+	d.lastSuccess[asset] = time.Now()
+}
+
+// recordJobResult stores whether a cycle of a scheduler job that ended at now panicked
+// and returns its panics in a row and when it may run again; a cycle that didn't panic
+// clears both
+func (d *daemonState) recordJobResult(job string, panicked bool, now time.Time, backoff CrashBackoffConfig) (int, time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !panicked {
+		delete(d.panics, job)
+		delete(d.backoffUntil, job)
+		return 0, time.Time{}
+	}
+	d.panics[job]++
+	d.backoffUntil[job] = now.Add(backoff.delay(d.panics[job]))
+	return d.panics[job], d.backoffUntil[job]
+}
+
+// jobBackoff returns when a job held back after a panic may run again; false when it may run now
+func (d *daemonState) jobBackoff(job string, now time.Time) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	until, ok := d.backoffUntil[job]
+	return until, ok && now.Before(until)
+}
+
+// heldBack returns the jobs currently held back after panics and until when
+// The caller holds d.mu.
+func (d *daemonState) heldBack(now time.Time) map[string]time.Time {
+	jobs := make(map[string]time.Time)
+	for job, until := range d.backoffUntil {
+		if now.Before(until) {
+			jobs[job] = until
+		}
+	}
+	return jobs
+}
+
+// DaemonStatus is the JSON document returned by the control socket's /status endpoint
+type DaemonStatus struct {
+	PID        int                     `json:"pid"`
+	StartedAt  time.Time               `json:"started_at"`
+	Scheduler  SchedulerStatus         `json:"scheduler"`
+	LastFetch  map[string]time.Time    `json:"last_fetch"` // Last successful fetch per asset
+	Database   DatabaseStatus          `json:"database"`
+	Budget     []BudgetUsage           `json:"budget,omitempty"`
+	RateLimits []RateLimitStatus       `json:"rate_limits,omitempty"`
+	Requests   []ProviderRequestStatus `json:"provider_requests,omitempty"`
+	Alerts     AlertStatus             `json:"alerts"`
+}
+
+// SchedulerStatus describes the scheduler loop
+type SchedulerStatus struct {
+	State       string               `json:"state"`
+	Paused      bool                 `json:"paused"`
+	Interval    string               `json:"interval"`
+	NextRun     time.Time            `json:"next_run"`
+	LastError   string               `json:"last_error,omitempty"`
+	LastErrorAt time.Time            `json:"last_error_at,omitempty"`
+	HeldBack    map[string]time.Time `json:"held_back,omitempty"` // Jobs skipped after panics, until when
+	Standby     *StandbyStatus       `json:"standby,omitempty"`   // The primary's heartbeat while this instance is a standby
+	PromotedAt  time.Time            `json:"promoted_at,omitempty"`
+}
+
+// DatabaseStatus describes database connectivity and table sizes
+type DatabaseStatus struct {
+	Connected bool             `json:"connected"`
+	Error     string           `json:"error,omitempty"`
+	Rows      map[string]int64 `json:"rows,omitempty"` // Row count per table
+}
+
+// controlRequest asks the scheduler goroutine to perform an action
+// The scheduler owns fetching and configuration, so actions that touch them are
+// executed there rather than on the HTTP handler goroutine
+type controlRequest struct {
+	action string     // "trigger" or "reload"
+	reply  chan error // Receives the outcome once the action has run
+}
+
+// controlRequests carries actions from the control socket to the scheduler loop
+var controlRequests = make(chan controlRequest)
+
+// statusTables lists the tables whose row counts are reported by status
+var statusTables = []string{"bitcoin_prices", "api_calls", "reference_prices", "volatility_regimes", "alert_rules", "alert_rule_stats", "holdings", "disposals", "portfolio_snapshots", "api_keys", "passkeys"}
+
+// collectStatus gathers a live snapshot of the daemon, database, and budget
+func collectStatus(ctx context.Context, repo *Repository) DaemonStatus {
+	daemon.mu.Lock()
+	status := DaemonStatus{
+		PID:       os.Getpid(),
+		StartedAt: daemon.startedAt,
+		Scheduler: SchedulerStatus{
+			State:       daemon.schedulerState,
+			Paused:      daemon.paused,
+			Interval:    daemon.interval.String(),
+			NextRun:     daemon.nextRun,
+			LastError:   daemon.lastError,
+			LastErrorAt: daemon.lastErrorAt,
+			HeldBack:    daemon.heldBack(time.Now()),
+			Standby:     daemon.standby,
+			PromotedAt:  daemon.promotedAt,
+		},
+		LastFetch: make(map[string]time.Time, len(daemon.lastSuccess)),
+	}
+	for asset, t := range daemon.lastSuccess {
+		status.LastFetch[asset] = t
+	}
+	daemon.mu.Unlock()
+
+	// Check database connectivity live rather than trusting cached state
+	if err := repo.Ping(ctx); err != nil {
+		status.Database.Error = err.Error()
+		return status
+	}
+	status.Database.Connected = true
+
+	status.Database.Rows = make(map[string]int64)
+	for _, table := range statusTables {
+		count, err := repo.CountRows(table)
+		if err != nil {
+			status.Database.Error = err.Error()
+			continue
+		}
+		status.Database.Rows[table] = count
+	}
+
+	if usage, err := getBudgetUsage(repo); err == nil {
+		status.Budget = usage
+	}
+	status.RateLimits = collectRateLimitStatus()
+	status.Requests = collectProviderRequestStatus()
+
+	status.Alerts = collectAlertStatus(repo)
+
+	return status
+}
+
+// controlSocketPath returns the Unix socket path shared by the daemon and CLI
+// Configured via CONTROL_SOCKET; defaults to a file in the system temp dir
+func controlSocketPath() string {
+	if p := os.Getenv("CONTROL_SOCKET"); p != "" {
+		return p
+	}
+	return filepath.Join(os.TempDir(), "bitcoin-tracker.sock")
+}
+
+// startControlServer listens on the control socket and serves the control API
+// It returns a function that closes the listener and removes the socket file
+func startControlServer(repo *Repository) (func(), error) {
+	path := controlSocketPath()
+
+	// A previous run that crashed may have left a stale socket file behind
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+
+	// Only the owning user may talk to the daemon
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set control socket permissions: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(collectStatus(r.Context(), repo))
+	})
+	mux.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		daemon.mu.Lock()
+		jobs := daemon.jobs
+		daemon.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jobs)
+	})
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		daemon.setPaused(true)
+		slog.Info("Scheduler paused via control socket")
+	})
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		daemon.setPaused(false)
+		slog.Info("Scheduler resumed via control socket")
+	})
+	mux.HandleFunc("/trigger", handleSchedulerAction("trigger"))
+	mux.HandleFunc("/reload", handleSchedulerAction("reload"))
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("Control server stopped", "error", err)
+		}
+	}()
+
+	slog.Info("Control socket listening", "path", path)
+	return func() {
+		server.Close()
+		os.Remove(path)
+	}, nil
+}
+
+// handleSchedulerAction returns a handler that hands an action to the scheduler
+// loop and waits for it to finish, reporting any error back to the caller
+func handleSchedulerAction(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := runSchedulerAction(r.Context(), action); err != nil && r.Context().Err() == nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// runSchedulerAction hands an action to the scheduler loop and waits for it to finish
+func runSchedulerAction(ctx context.Context, action string) error {
+	req := controlRequest{action: action, reply: make(chan error, 1)}
+	select {
+	case controlRequests <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-req.reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requestFetch fetches and stores the current prices now
+// When this process runs the scheduler the fetch runs in its loop, so it never
+// overlaps a scheduled one; otherwise (e.g. under `serve`) it runs right here.
+func requestFetch(ctx context.Context, repo *Repository) error {
+	daemon.mu.Lock()
+	scheduled := daemon.scheduled
+	daemon.mu.Unlock()
+
+	if scheduled {
+		return runSchedulerAction(ctx, "trigger")
+	}
+	return fetchAndSavePrice(ctx, repo)
+}
+
+// controlClient returns an HTTP client that dials the daemon's control socket
+// Actions like trigger run a full fetch, so the timeout is generous
+func controlClient() *http.Client {
+	path := controlSocketPath()
+	return &http.Client{
+		Timeout: 2 * time.Minute,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+// fetchDaemonStatus asks the running daemon for its status
+func fetchDaemonStatus() (DaemonStatus, error) {
+	var status DaemonStatus
+
+	// The host part of the URL is ignored; the transport always dials the socket
+	resp, err := controlClient().Get("http://tracker/status")
+	if err != nil {
+		return status, fmt.Errorf("daemon not reachable on %s: %w", controlSocketPath(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("status request failed with status: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("failed to parse status response: %w", err)
+	}
+	return status, nil
+}
+
+// sendControlAction asks the running daemon to perform an action (trigger, pause, resume, reload)
+func sendControlAction(action string) error {
+	resp, err := controlClient().Post("http://tracker/"+action, "text/plain", nil)
+	if err != nil {
+		return fmt.Errorf("daemon not reachable on %s: %w", controlSocketPath(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s failed: %s", action, strings.TrimSpace(string(body)))
+	}
+
+	slog.Info("Daemon accepted action", "action", action)
+	return nil
+}
+
+// displayStatus prints the daemon status on one screen
+func displayStatus() error {
+	status, err := fetchDaemonStatus()
+	if err != nil {
+		return err
+	}
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.In(displayLocation).Format("2006-01-02 15:04:05")
+	}
+
+	fmt.Printf("\nDaemon      pid %d, up since %s\n", status.PID, formatTime(status.StartedAt))
+
+	fmt.Println("\nScheduler")
+	fmt.Printf("  State     %s\n", status.Scheduler.State)
+	if sb := status.Scheduler.Standby; sb != nil {
+		primary := "no primary has beaten yet"
+		if sb.Primary != "" {
+			primary = fmt.Sprintf("primary %s last beat %s", sb.Primary, formatTime(sb.LastBeat))
+		}
+		fmt.Printf("  Standby   yes (%s; takes over at %s)\n", primary, formatTime(sb.TakeoverAt))
+	}
+	if !status.Scheduler.PromotedAt.IsZero() {
+		fmt.Printf("  Promoted  %s (took over from a silent primary)\n", formatTime(status.Scheduler.PromotedAt))
+	}
+	if status.Scheduler.Paused {
+		fmt.Println("  Paused    yes (scheduled fetches are skipped)")
+	}
+	fmt.Printf("  Interval  %s\n", status.Scheduler.Interval)
+	fmt.Printf("  Next run  %s\n", formatTime(status.Scheduler.NextRun))
+	if status.Scheduler.LastError != "" {
+		fmt.Printf("  Last err  %s (%s)\n", status.Scheduler.LastError, formatTime(status.Scheduler.LastErrorAt))
+	}
+	jobs := make([]string, 0, len(status.Scheduler.HeldBack))
+	for job := range status.Scheduler.HeldBack {
+		jobs = append(jobs, job)
+	}
+	sort.Strings(jobs)
+	for _, job := range jobs {
+		fmt.Printf("  Held back %s after a panic, until %s\n", job, formatTime(status.Scheduler.HeldBack[job]))
+	}
+
+	fmt.Println("\nLast successful fetch")
+	assets := make([]string, 0, len(status.LastFetch))
+	for asset := range status.LastFetch {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+	if len(assets) == 0 {
+		fmt.Println("  (none yet)")
+	}
+	for _, asset := range assets {
+		fmt.Printf("  %-10s %s\n", asset, formatTime(status.LastFetch[asset]))
+	}
+
+	fmt.Println("\nDatabase")
+	if status.Database.Connected {
+		fmt.Println("  Connected yes")
+	} else {
+		fmt.Println("  Connected no")
+	}
+	if status.Database.Error != "" {
+		fmt.Printf("  Error     %s\n", status.Database.Error)
+	}
+	tables := make([]string, 0, len(status.Database.Rows))
+	for table := range status.Database.Rows {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Printf("  %-16s %d rows\n", table, status.Database.Rows[table])
+	}
+
+	if len(status.Budget) > 0 {
+		fmt.Println("\nFetch budget")
+		for _, u := range status.Budget {
+			limit := "unlimited"
+			if u.Limit > 0 {
+				limit = fmt.Sprintf("%d remaining of %d", u.Remaining, u.Limit)
+			}
+			fmt.Printf("  %-10s %d used, %s\n", u.Scope, u.Used, limit)
+		}
+	}
+
+	if len(status.RateLimits) > 0 {
+		fmt.Println("\nRate limits")
+		for _, l := range status.RateLimits {
+			remaining := "not reported"
+			if l.Remaining >= 0 {
+				remaining = fmt.Sprintf("%d remaining", l.Remaining)
+			}
+			if !l.PausedUntil.IsZero() {
+				remaining += ", paused until " + l.PausedUntil.In(displayLocation).Format("15:04:05")
+			}
+			fmt.Printf("  %-10s %s, %s, waited %s\n", l.Provider, l.Limit, remaining, l.Waited)
+		}
+	}
+
+	if len(status.Requests) > 0 {
+		fmt.Println("\nProvider requests")
+		for _, p := range status.Requests {
+			health := "ok"
+			if p.LastError != "" && !p.LastErrorAt.Before(p.LastAt) {
+				health = fmt.Sprintf("failing: %s (%s)", p.LastError, formatTime(p.LastErrorAt))
+			}
+			fmt.Printf("  %-17s %d requests, %d failed (%d throttled), mean %s, max %s, %s\n",
+				p.Provider, p.Requests, p.Failures, p.Throttled, p.MeanLatency, p.MaxLatency, health)
+		}
+	}
+
+	fmt.Println("\nAlerts")
+	fmt.Printf("  Rules     %d (%d triggered)\n", status.Alerts.Rules, status.Alerts.Triggered)
+	fmt.Printf("  Evaluated %s\n", formatTime(status.Alerts.LastEvaluation))
+	fmt.Printf("  Fired     %s\n", formatTime(status.Alerts.LastFired))
+	if status.Alerts.LastError != "" {
+		fmt.Printf("  Last err  %s\n", status.Alerts.LastError)
+	}
+	for _, n := range status.Alerts.Notifiers {
+		health := "ok"
+		if n.LastError != "" && n.LastErrorAt.After(n.LastSuccess) {
+			health = fmt.Sprintf("failing: %s (%s)", n.LastError, formatTime(n.LastErrorAt))
+		}
+		fmt.Printf("  %-30s %d sent, %d failed, %s\n", n.Name, n.Sent, n.Failed, health)
+	}
+
+	fmt.Println()
+	return nil
+}
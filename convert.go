@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"       // Package for the store queries and fetches
+	"encoding/json" // Package for the --json output
+	"fmt"           // Package for formatted I/O operations
+	"os"            // Package for the --json output
+	"slices"        // Package for checking converted currencies
+	"strconv"       // Package for parsing amounts
+	"strings"       // Package for string manipulation
+	"time"          // Package for price ages and lookup times
+)
+
+// The convert command converts an amount between Bitcoin units and currencies, e.g.
+// "convert 0.03 btc usd --at 2022-03-15", at a stored price: the one at --at as
+// price-at finds it, or the newest one. When the newest is older than --max-age the
+// price is fetched from the providers instead, and not stored. Two currencies are
+// converted through the Bitcoin price in each.
+
+// coinUnits are the Bitcoin units convert accepts, in bitcoin, with the decimal places
+// amounts in them are shown with
+var coinUnits = map[string]struct {
+	btc       float64
+	precision int
+}{
+	"btc":  {1, 8},
+	"sats": {1e-8, 0},
+}
+
+// coinUnitAliases maps other names of the coin units to the ones above
+var coinUnitAliases = map[string]string{"bitcoin": "btc", "xbt": "btc", "sat": "sats", "satoshi": "sats", "satoshis": "sats"}
+
+// ConversionPrice is a Bitcoin price a conversion used
+type ConversionPrice struct {
+	Currency string    `json:"currency"`
+	Price    float64   `json:"price"`
+	At       time.Time `json:"at"`               // Time the price is of
+	Method   string    `json:"method"`           // exact, interpolated, or nearest at --at; latest or fetched otherwise
+	Source   string    `json:"source,omitempty"` // Provider of a latest or fetched price
+}
+
+// Conversion is an amount converted from one unit or currency to another
+type Conversion struct {
+	Amount float64           `json:"amount"`
+	From   string            `json:"from"`
+	To     string            `json:"to"`
+	Result float64           `json:"result"`
+	Prices []ConversionPrice `json:"prices"` // One per currency side, none between coin units
+}
+
+// parseConversionUnit normalizes a unit: a coin unit of coinUnits, or a currency code
+func parseConversionUnit(v string) (string, error) {
+	unit := strings.ToLower(strings.TrimSpace(v))
+	if alias, ok := coinUnitAliases[unit]; ok {
+		unit = alias
+	}
+	if _, ok := coinUnits[unit]; ok {
+		return unit, nil
+	}
+	if len(unit) < 3 || len(unit) > 5 || strings.Trim(unit, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return "", validationErrorf("unknown unit %q (expected btc, sats, or a currency code such as usd)", v)
+	}
+	return unit, nil
+}
+
+// converter looks up the Bitcoin prices conversions use, once per currency
+type converter struct {
+	repo   *Repository   // Where the prices are looked up and fetched ones recorded
+	at     time.Time     // Time of the prices; zero for current ones
+	maxGap time.Duration // Farthest a sample may be from at
+	maxAge time.Duration // Oldest the newest stored price may be before a fetch
+	prices map[string]ConversionPrice
+}
+
+// price returns the Bitcoin price in currency
+func (c *converter) price(ctx context.Context, currency string) (ConversionPrice, error) {
+	if p, ok := c.prices[currency]; ok {
+		return p, nil
+	}
+	p, err := c.lookup(ctx, currency)
+	if err != nil {
+		return p, err
+	}
+	c.prices[currency] = p
+	return p, nil
+}
+
+// lookup finds the Bitcoin price in currency at c.at, or the current one
+func (c *converter) lookup(ctx context.Context, currency string) (ConversionPrice, error) {
+	if !c.at.IsZero() {
+		result, err := lookupPriceAt(ctx, c.repo, currency, c.at, true, c.maxGap)
+		if err != nil {
+			return ConversionPrice{}, err
+		}
+		return ConversionPrice{Currency: currency, Price: result.Price, At: result.At, Method: result.Method}, nil
+	}
+
+	latest, err := c.repo.LatestPrices(ctx, 1, currency)
+	if err != nil {
+		return ConversionPrice{}, err
+	}
+	if len(latest) > 0 && time.Since(latest[0].Timestamp) <= c.maxAge {
+		r := latest[0]
+		return ConversionPrice{Currency: currency, Price: r.Price, At: r.Timestamp.UTC(), Method: "latest", Source: r.Source}, nil
+	}
+
+	// Converted currencies (FX_CURRENCIES) are priced from FX_BASE, as when they are saved
+	fetched := currency
+	if slices.Contains(fxConfig.Currencies, currency) {
+		fetched = fxConfig.Base
+	}
+	fetchCtx, cancel := withFetchDeadline(ctx)
+	defer cancel()
+	prices, sources, _, err := fetchPricesWithRetry(fetchCtx, c.repo, "bitcoin", []string{fetched}, func() error {
+		return checkBudget(c.repo, "bitcoin")
+	})
+	if len(prices) == 0 {
+		return ConversionPrice{}, fmt.Errorf("failed to fetch the Bitcoin price in %s: %w", strings.ToUpper(fetched), err)
+	}
+	prices, _ = convertFXPrices(fetchCtx, c.repo, prices)
+	price, ok := prices[currency]
+	if !ok {
+		return ConversionPrice{}, fmt.Errorf("failed to convert the Bitcoin price to %s", strings.ToUpper(currency))
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	return ConversionPrice{Currency: currency, Price: roundPriceIn(currency, price), At: now, Method: "fetched", Source: sources[fetched]}, nil
+}
+
+// convert converts amount from one unit or currency to another through its value in
+// bitcoin
+func (c *converter) convert(ctx context.Context, amount float64, from, to string) (Conversion, error) {
+	conversion := Conversion{Amount: amount, From: from, To: to, Prices: []ConversionPrice{}}
+
+	btc := amount
+	if unit, ok := coinUnits[from]; ok {
+		btc = amount * unit.btc
+	} else if from != to {
+		p, err := c.price(ctx, from)
+		if err != nil {
+			return conversion, err
+		}
+		btc = amount / p.Price
+		conversion.Prices = append(conversion.Prices, p)
+	}
+
+	switch unit, ok := coinUnits[to]; {
+	case ok:
+		conversion.Result = roundPrice(btc / unit.btc)
+	case from == to:
+		conversion.Result = amount
+	default:
+		p, err := c.price(ctx, to)
+		if err != nil {
+			return conversion, err
+		}
+		conversion.Result = roundPrice(btc * p.Price)
+		conversion.Prices = append(conversion.Prices, p)
+	}
+	return conversion, nil
+}
+
+// runConvertCommand handles "convert <amount> <from> <to> [--at time] [--max-gap 24h]
+// [--max-age 15m] [--precision N] [--json|--quiet]"
+func runConvertCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("convert")
+	atFlag := fs.String("at", "", "Convert at the stored price of this time, e.g. 2022-03-15 or 2022-03-15T12:00Z (default: now)")
+	maxGapFlag := fs.String("max-gap", "24h", "With --at, farthest a sample used may be from the time, e.g. 6h or 2d")
+	maxAge := fs.Duration("max-age", 15*time.Minute, "Without --at, oldest stored price used before fetching one; 0 always fetches")
+	precisionFlag := fs.String("precision", "", "Decimal places of the result (default: 8 for btc, 0 for sats, 2 for currencies)")
+	asJSON := fs.Bool("json", false, "Print the conversion as JSON")
+	quiet := fs.Bool("quiet", false, "Print only the result, for scripts")
+
+	// The amount and units come before the flags, which flag parsing would stop at
+	var positional []string
+	for len(args) > 0 && len(positional) < 3 && !strings.HasPrefix(args[0], "-") {
+		positional, args = append(positional, args[0]), args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if len(positional) < 3 {
+		return validationErrorf("usage: convert <amount> <from> <to> [flags], e.g. convert 0.03 btc usd --at 2022-03-15")
+	}
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(positional[0], ",", ""), 64)
+	if err != nil || amount < 0 {
+		return validationErrorf("invalid amount %q", positional[0])
+	}
+	from, err := parseConversionUnit(positional[1])
+	if err != nil {
+		return err
+	}
+	to, err := parseConversionUnit(positional[2])
+	if err != nil {
+		return err
+	}
+
+	c := &converter{repo: repo, maxAge: *maxAge, prices: make(map[string]ConversionPrice)}
+	if *atFlag != "" {
+		if c.at, err = parsePriceTime(*atFlag); err != nil {
+			return err
+		}
+	}
+	if c.maxGap, err = parsePriceAtMaxGap(*maxGapFlag); err != nil {
+		return err
+	}
+	precision, err := parsePrecision("--precision", *precisionFlag)
+	if err != nil {
+		return err
+	}
+	if precision == noPrecision {
+		precision = 2
+		if unit, ok := coinUnits[to]; ok {
+			precision = unit.precision
+		}
+	}
+
+	conversion, err := c.convert(ctx, amount, from, to)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *asJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(conversion)
+	case *quiet:
+		fmt.Println(formatDecimal(conversion.Result, precision))
+		return nil
+	}
+
+	fmt.Printf("\n%s %s = %s %s\n", positional[0], strings.ToUpper(from), formatPriceAt(conversion.Result, precision), strings.ToUpper(to))
+	for _, p := range conversion.Prices {
+		line := fmt.Sprintf("  at %s %s/BTC, %s %s", formatPrice(p.Price), strings.ToUpper(p.Currency), p.Method,
+			p.At.Format("2006-01-02 15:04:05 MST"))
+		if p.Source != "" {
+			line += " from " + p.Source
+		}
+		fmt.Println(line)
+	}
+	fmt.Println()
+	return nil
+}
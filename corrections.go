@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"       // Package for the database calls and request actors
+	"encoding/json" // Package for the API bodies
+	"errors"        // Package for the restore conflict error
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for limiting request bodies
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for the correction endpoints
+	"os/user"       // Package for naming the CLI user in the audit trail
+	"strconv"       // Package for parsing prices and IDs
+	"strings"       // Package for string manipulation
+	"time"          // Package for timestamps
+)
+
+// A glitched sample can be taken out of the price history or given the price it should
+// have had. Deleting a price moves it out of bitcoin_prices into the price_corrections
+// audit trail, so every query skips it without knowing about corrections, and a restore
+// puts it back with its ID. Every deletion, amendment, and restore is recorded with who
+// made it and why. The candles, patterns, indicators, daily summaries, volatility
+// regimes, price levels, and all-time high and low are rebuilt from the corrected
+// price's time on; statistics are computed from the prices and follow by themselves.
+// Prices already moved to the archive can't be corrected.
+
+// Actions recorded in the audit trail
+const (
+	correctionDelete  = "delete"  // Moved out of bitcoin_prices
+	correctionAmend   = "amend"   // Given a new price
+	correctionRestore = "restore" // Put back after a deletion
+)
+
+// EventPriceCorrected is emitted when a stored price is deleted, amended, or restored
+const EventPriceCorrected = "price.corrected"
+
+// errPriceStored is why a deleted price can't be restored: its ID is in use again, or
+// another price is stored for its currency and minute
+var errPriceStored = errors.New("it is stored already, or another price is stored for its currency and minute")
+
+// PriceCorrection is an entry of the audit trail of corrected prices
+type PriceCorrection struct {
+	ID        int       `json:"id"`
+	PriceID   int       `json:"price_id"`
+	Action    string    `json:"action"` // delete, amend, or restore
+	Currency  string    `json:"currency"`
+	Timestamp time.Time `json:"timestamp"` // When the corrected price was recorded
+	OldPrice  float64   `json:"old_price"`
+	NewPrice  *float64  `json:"new_price,omitempty"` // Left out for a deletion
+	Reason    string    `json:"reason,omitempty"`
+	Actor     string    `json:"actor"` // e.g. apikey:grafana, passkey:alice, or cli:alice
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// priceCorrectionRequest is the body of PATCH /prices/<id>, and the optional body of
+// DELETE /prices/<id> and POST /prices/<id>/restore
+type priceCorrectionRequest struct {
+	Price  float64 `json:"price,omitempty"` // The amended price; only for PATCH
+	Reason string  `json:"reason,omitempty"`
+}
+
+// actorKey carries who makes an API request in its context
+type actorKey struct{}
+
+// withActor returns ctx carrying the actor recorded for corrections
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// requestActor names who makes an API request: the API key it was authenticated with,
+// or the user signed in with a passkey
+func requestActor(repo *Repository, r *http.Request) string {
+	if a, ok := r.Context().Value(actorKey{}).(string); ok && a != "" {
+		return a
+	}
+	if name, ok := passkeySessionUser(repo, r); ok {
+		return "passkey:" + name
+	}
+	return "api"
+}
+
+// cliActor names the user running a command
+func cliActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+// correctPrice applies a correction and rebuilds what was derived from the price
+// A failed rebuild is logged: the correction stands, and `backfill` or `candles rollup`
+// can finish the job.
+func correctPrice(ctx context.Context, repo *Repository, c PriceCorrection) (PriceCorrection, error) {
+	c.Reason = strings.TrimSpace(c.Reason)
+	if c.Action == correctionAmend && (c.NewPrice == nil || *c.NewPrice <= 0) {
+		return c, validationErrorf("invalid price (expected a price above 0)")
+	}
+	c, err := repo.CorrectPrice(ctx, c)
+	if err != nil || writeMode != "" {
+		return c, err
+	}
+	slog.Info("Corrected price", "id", c.PriceID, "action", c.Action, "currency", c.Currency,
+		"timestamp", c.Timestamp.Format(time.RFC3339), "old_price", c.OldPrice, "actor", c.Actor, "reason", c.Reason)
+	incCounter("tracker_price_corrections_total", map[string]string{"action": c.Action}, 1)
+	publishEvent(repo, newEvent(EventPriceCorrected, "bitcoin/"+c.Currency, c))
+
+	if c.Action != correctionRestore {
+		if err := forgetCorrectedExtremes(ctx, repo, c); err != nil {
+			slog.Error("Failed to update the all-time high and low after a correction", "id", c.PriceID, "error", err)
+		}
+	}
+	if err := rebuildDerivedData(repo, c.Currency, c.Timestamp); err != nil {
+		slog.Error("Failed to rebuild derived data after a correction", "id", c.PriceID, "error", err)
+	}
+	return c, nil
+}
+
+// forgetCorrectedExtremes replaces an all-time high or low the corrected price set with
+// the highest or lowest price stored now, since seeding keeps extremes no price reaches
+func forgetCorrectedExtremes(ctx context.Context, repo *Repository, c PriceCorrection) error {
+	stored, err := repo.PriceExtremes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range stored {
+		if e.Coin != "bitcoin" || e.Currency != c.Currency || (e.High != c.OldPrice && e.Low != c.OldPrice) {
+			continue
+		}
+		seeded, ok, err := repo.HistoricalPriceExtremes(ctx, c.Currency)
+		if err != nil || !ok {
+			return err
+		}
+		if e.High == c.OldPrice {
+			e.High, e.HighAt = seeded.High, seeded.HighAt
+		}
+		if e.Low == c.OldPrice {
+			e.Low, e.LowAt = seeded.Low, seeded.LowAt
+		}
+		return repo.SavePriceExtremes(ctx, e)
+	}
+	return nil
+}
+
+// handlePriceCorrection serves DELETE and PATCH /prices/<id>, and POST
+// /prices/<id>/restore
+func (s *apiServer) handlePriceCorrection(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/prices/"), "/")
+	idText, restore := strings.CutSuffix(rest, "/restore")
+	id, err := strconv.Atoi(idText)
+	if err != nil || id < 1 {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	c := PriceCorrection{PriceID: id}
+	switch {
+	case restore && r.Method == http.MethodPost:
+		c.Action = correctionRestore
+	case !restore && r.Method == http.MethodDelete:
+		c.Action = correctionDelete
+	case !restore && r.Method == http.MethodPatch:
+		c.Action = correctionAmend
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !writesAuthenticated() {
+		writeAPIError(w, http.StatusForbidden, "correcting prices needs API_AUTH=writes or API_AUTH=all, or passkeys (PASSKEY_RP_ID)")
+		return
+	}
+
+	// Only an amendment needs a body
+	var req priceCorrectionRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<12)).Decode(&req); err != nil && (err != io.EOF || c.Action == correctionAmend) {
+		writeAPIError(w, http.StatusBadRequest, "invalid correction: %v", err)
+		return
+	}
+	c.Reason, c.Actor = req.Reason, requestActor(s.repo, r)
+	if c.Action == correctionAmend {
+		if req.Price <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "invalid price %g (expected a price above 0)", req.Price)
+			return
+		}
+		c.NewPrice = &req.Price
+	}
+
+	c, err = correctPrice(r.Context(), s.repo, c)
+	switch {
+	case errors.Is(err, errPriceStored):
+		writeAPIError(w, http.StatusConflict, "%v", err)
+		return
+	case errorKind(err) == KindValidation:
+		writeAPIError(w, http.StatusNotFound, "%v", err)
+		return
+	case err != nil:
+		slog.Error("API failed to correct price", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to correct price")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// handlePriceCorrections serves GET /corrections?price_id=...&limit=..., the newest
+// corrections first
+func (s *apiServer) handlePriceCorrections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	priceID := 0
+	if v := query.Get("price_id"); v != "" {
+		var err error
+		priceID, err = strconv.Atoi(v)
+		if err != nil || priceID < 1 {
+			writeAPIError(w, http.StatusBadRequest, "invalid price_id %q", v)
+			return
+		}
+	}
+	limit := defaultRangeLimit
+	if v := query.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxRangeLimit {
+			writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and %d", maxRangeLimit)
+			return
+		}
+	}
+
+	corrections, err := s.repo.PriceCorrections(r.Context(), priceID, limit)
+	if err != nil {
+		slog.Error("API failed to fetch price corrections", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query price corrections")
+		return
+	}
+	if corrections == nil {
+		corrections = []PriceCorrection{} // Encode no corrections as [] rather than null
+	}
+	writeJSON(w, http.StatusOK, corrections)
+}
+
+// runCorrectionsCommand handles the corrections subcommands:
+//
+//	corrections delete [--reason text] <id>
+//	corrections amend [--reason text] <id> <price>
+//	corrections restore [--reason text] <id>
+//	corrections list [--id N] [--limit N]
+func runCorrectionsCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: corrections delete|amend|restore|list")
+	}
+
+	switch args[0] {
+	case "delete", "amend", "restore":
+		// Options come before the ID, e.g. "corrections delete --reason spike 4821"
+		fs := newFlagSet("corrections " + args[0])
+		reason := fs.String("reason", "", "Why the price is corrected, kept in the audit trail")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		usage := fmt.Sprintf("usage: corrections %s [--reason text] <id>", args[0])
+		want := 1
+		if args[0] == "amend" {
+			usage, want = "usage: corrections amend [--reason text] <id> <price>", 2
+		}
+		if fs.NArg() != want {
+			return validationErrorf("%s", usage)
+		}
+		id, err := strconv.Atoi(fs.Arg(0))
+		if err != nil || id < 1 {
+			return validationErrorf("invalid price id %q", fs.Arg(0))
+		}
+
+		c := PriceCorrection{PriceID: id, Action: args[0], Reason: *reason, Actor: cliActor()}
+		if args[0] == "amend" {
+			price, err := strconv.ParseFloat(strings.ReplaceAll(fs.Arg(1), ",", ""), 64)
+			if err != nil {
+				return validationErrorf("invalid price %q", fs.Arg(1))
+			}
+			c.NewPrice = &price
+		}
+		if _, err := correctPrice(ctx, repo, c); err != nil {
+			return err
+		}
+
+	case "list":
+		fs := newFlagSet("corrections list")
+		id := fs.Int("id", 0, "Only show the corrections of this price")
+		limit := fs.Int("limit", 50, "Number of corrections to show, newest first")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if *limit < 1 {
+			return validationErrorf("invalid --limit %d", *limit)
+		}
+		corrections, err := repo.PriceCorrections(ctx, *id, *limit)
+		if err != nil {
+			return err
+		}
+		displayPriceCorrections(corrections)
+
+	default:
+		return validationErrorf("unknown corrections subcommand %q", args[0])
+	}
+	return nil
+}
+
+// displayPriceCorrections prints the audit trail as a table
+func displayPriceCorrections(corrections []PriceCorrection) {
+	if len(corrections) == 0 {
+		slog.Info("No price corrections recorded")
+		return
+	}
+
+	fmt.Printf("\n%-5s %-20s %-8s %-8s %-20s %-14s %-14s %-16s %s\n", "ID", "Corrected", "Price ID", "Action", "Recorded", "Old price", "New price", "By", "Reason")
+	fmt.Println("------------------------------------------------------------------------------------------------------------------------")
+	for _, c := range corrections {
+		newPrice := "-"
+		if c.NewPrice != nil {
+			newPrice = formatPrice(*c.NewPrice)
+		}
+		fmt.Printf("%-5d %-20s %-8d %-8s %-20s %-14s %-14s %-16s %s\n", c.ID, formatDisplayTime(c.CreatedAt), c.PriceID, c.Action,
+			formatDisplayTime(c.Timestamp), formatPrice(c.OldPrice)+" "+strings.ToUpper(c.Currency), newPrice, c.Actor, c.Reason)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"  // Package for the summary queries
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for combining the extremes of days
+	"os"       // Package for environment variables
+	"slices"   // Package for the median of the daily averages
+	"strconv"  // Package for parsing the day count
+	"strings"  // Package for string manipulation
+	"time"     // Package for day boundaries
+)
+
+// Every UTC day of prices is summarized in daily_summaries: open, high, low, close,
+// average, and sample count. The scheduler's daily_summaries job refreshes them from
+// the newest summarized day on, which may have been partial, every hour by default or
+// on SCHEDULE_DAILY_SUMMARIES, and a backfill rebuilds the days it filled. Statistics
+// over a window of DAILY_SUMMARY_MIN_RANGE or longer, as the dashboard's year-long
+// summary widgets ask for, then read the whole days from the summaries and only the
+// partial days at either end from the raw prices.
+
+// jobDailySummaries is the scheduler job refreshing the daily summaries
+const jobDailySummaries = "daily_summaries"
+
+// dailySummaryDefaultSchedule refreshes the summaries a few minutes past every UTC
+// hour, after the hourly candle has closed
+const dailySummaryDefaultSchedule = "CRON_TZ=UTC 5 * * * *"
+
+// DaySummary summarizes the prices of a currency on one UTC day
+type DaySummary struct {
+	Currency string    `json:"currency"`
+	Day      time.Time `json:"date"` // Midnight UTC
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	Avg      float64   `json:"avg"`
+	Samples  int       `json:"sample_count"`
+}
+
+// dailySummaryMinRange is the shortest statistics window read from the daily
+// summaries, configured via DAILY_SUMMARY_MIN_RANGE; 0 always reads the raw prices
+var dailySummaryMinRange = 90 * 24 * time.Hour
+
+// loadDailySummaryMinRange reads DAILY_SUMMARY_MIN_RANGE (e.g. 90d, or 0)
+func loadDailySummaryMinRange() (time.Duration, error) {
+	v := os.Getenv("DAILY_SUMMARY_MIN_RANGE")
+	switch v {
+	case "":
+		return 90 * 24 * time.Hour, nil
+	case "0":
+		return 0, nil
+	}
+	d, err := parseStatsWindow(v)
+	if err != nil || d < 48*time.Hour {
+		return 0, fmt.Errorf("invalid DAILY_SUMMARY_MIN_RANGE %q (expected a window of at least 2d, e.g. 90d, or 0)", v)
+	}
+	return d, nil
+}
+
+// refreshDailySummaries summarizes the days of currency from from on; a zero from
+// resumes at the newest summarized day. It returns the number of days saved.
+func refreshDailySummaries(ctx context.Context, repo *Repository, currency string, from time.Time) (int, error) {
+	if from.IsZero() {
+		if day, ok, err := repo.LatestDailySummary(ctx, currency); err != nil {
+			return 0, err
+		} else if ok {
+			from = day
+		}
+	} else {
+		from = candleStart(from, CandleDaily)
+	}
+
+	var days []DaySummary
+	var current *DaySummary
+	sum := 0.0
+	err := forEachPrice(repo, currency, from, time.Time{}, func(r PriceRecord) error {
+		day := candleStart(r.Timestamp, CandleDaily)
+		if current == nil || !day.Equal(current.Day) {
+			if current != nil {
+				current.Avg = sum / float64(current.Samples)
+			}
+			days = append(days, DaySummary{Currency: currency, Day: day, Open: r.Price, High: r.Price, Low: r.Price})
+			current, sum = &days[len(days)-1], 0
+		}
+		current.High = math.Max(current.High, r.Price)
+		current.Low = math.Min(current.Low, r.Price)
+		current.Close = r.Price
+		current.Samples++
+		sum += r.Price
+		return ctx.Err()
+	})
+	if err != nil || len(days) == 0 {
+		return 0, err
+	}
+	current.Avg = sum / float64(current.Samples)
+	return len(days), repo.SaveDailySummaries(ctx, days)
+}
+
+// runScheduledDailySummaries refreshes the summaries of every configured currency
+// Failures are logged; the next run retries from the same day.
+func runScheduledDailySummaries(ctx context.Context, repo *Repository) {
+	for _, currency := range currencies {
+		if _, err := refreshDailySummaries(ctx, repo, currency, time.Time{}); err != nil {
+			slog.Error("Failed to refresh daily summaries", "currency", currency, "error", err)
+		}
+	}
+}
+
+// summarizedPriceStats computes the statistics for currency in [from, to) from the
+// daily summaries of its whole days and the raw prices of the partial days at either
+// end. False when no summarized day falls in the range, e.g. before the first refresh.
+// Min, Max, Mean, First, Last, and Samples are exact; Median and StdDev are those of
+// the daily averages.
+func summarizedPriceStats(ctx context.Context, repo *Repository, currency string, from, to time.Time) (PriceStats, bool, error) {
+	var stats PriceStats
+	latest, ok, err := repo.LatestDailySummary(ctx, currency)
+	if err != nil || !ok {
+		return stats, false, err
+	}
+
+	// Whole days only; the newest summarized day may have been partial when refreshed
+	start := candleStart(from, CandleDaily)
+	if start.Before(from) {
+		start = start.Add(24 * time.Hour)
+	}
+	end := candleStart(to, CandleDaily)
+	if latest.Before(end) {
+		end = latest
+	}
+	if !end.After(start) {
+		return stats, false, nil
+	}
+	days, err := repo.DailySummaries(ctx, currency, start, end)
+	if err != nil || len(days) == 0 {
+		return stats, false, err
+	}
+
+	head, err := repo.PriceStats(ctx, currency, from, start)
+	if err != nil {
+		return stats, false, err
+	}
+	tail, err := repo.PriceStats(ctx, currency, end, to)
+	if err != nil {
+		return stats, false, err
+	}
+
+	parts := make([]PriceStats, 0, len(days)+2)
+	if head.Samples > 0 {
+		parts = append(parts, head)
+	}
+	for _, d := range days {
+		parts = append(parts, PriceStats{Samples: d.Samples, Min: d.Low, Max: d.High, Mean: d.Avg, First: d.Open, Last: d.Close})
+	}
+	if tail.Samples > 0 {
+		parts = append(parts, tail)
+	}
+
+	stats = PriceStats{Min: parts[0].Min, Max: parts[0].Max, First: parts[0].First, Last: parts[len(parts)-1].Last, Summarized: true}
+	means := make([]float64, len(parts))
+	sum := 0.0
+	for i, p := range parts {
+		stats.Samples += p.Samples
+		stats.Min, stats.Max = math.Min(stats.Min, p.Min), math.Max(stats.Max, p.Max)
+		sum += p.Mean * float64(p.Samples)
+		means[i] = p.Mean
+	}
+	stats.Mean = sum / float64(stats.Samples)
+	slices.Sort(means)
+	if mid := len(means) / 2; len(means)%2 == 1 {
+		stats.Median = means[mid]
+	} else {
+		stats.Median = (means[mid-1] + means[mid]) / 2
+	}
+	if len(means) > 1 {
+		stats.StdDev = sampleStdDev(means)
+	}
+	return stats, true, nil
+}
+
+// displayDailySummaries prints the newest count summarized days of a currency
+func displayDailySummaries(ctx context.Context, repo *Repository, currency string, count int) error {
+	to := candleStart(time.Now(), CandleDaily).Add(24 * time.Hour)
+	days, err := repo.DailySummaries(ctx, currency, to.AddDate(0, 0, -count), to)
+	if err != nil {
+		return err
+	}
+	if len(days) == 0 {
+		slog.Info("No daily summaries found; run \"daily refresh\" to build them from stored prices")
+		return nil
+	}
+
+	fmt.Printf("\nDaily summaries (%s)\n", strings.ToUpper(currency))
+	fmt.Printf("%-11s %-12s %-12s %-12s %-12s %-12s %-7s\n", "Day", "Open", "High", "Low", "Close", "Average", "Samples")
+	fmt.Println("-------------------------------------------------------------------------------------")
+	for _, d := range days {
+		fmt.Printf("%-11s %-12.2f %-12.2f %-12.2f %-12.2f %-12.2f %-7d\n",
+			d.Day.Format("2006-01-02"), d.Open, d.High, d.Low, d.Close, d.Avg, d.Samples)
+	}
+	fmt.Println()
+	return nil
+}
+
+// runDailyCommand handles "daily refresh [--from YYYY-MM-DD]" and "daily [currency] [days]"
+func runDailyCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) > 0 && args[0] == "refresh" {
+		fs := newFlagSet("daily refresh")
+		fromFlag := fs.String("from", "", "Rebuild the days from this one on: YYYY-MM-DD or RFC 3339 (default: the newest summarized day)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		var from time.Time
+		if *fromFlag != "" {
+			var err error
+			if from, err = parseTimeFlag("from", *fromFlag); err != nil {
+				return err
+			}
+		}
+		for _, currency := range currencies {
+			n, err := refreshDailySummaries(ctx, repo, currency, from)
+			if err != nil {
+				return fmt.Errorf("failed to refresh daily summaries for %s: %w", strings.ToUpper(currency), err)
+			}
+			slog.Info("Saved daily summaries", "currency", currency, "days", n)
+		}
+		return nil
+	}
+
+	currency, count := currencies[0], 30
+	if len(args) > 0 {
+		currency = strings.ToLower(args[0])
+	}
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return validationErrorf("invalid day count %q", args[1])
+		}
+		count = n
+	}
+	return displayDailySummaries(ctx, repo, currency, count)
+}
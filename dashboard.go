@@ -0,0 +1,234 @@
+package main
+
+import (
+	_ "embed"       // Package for embedding the dashboard page
+	"encoding/json" // Package for decoding saved layouts
+	"fmt"           // Package for formatted I/O operations
+	"html/template" // Package for rendering the dashboard page
+	"io"            // Package for limiting request bodies
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for the dashboard endpoint
+	"regexp"        // Package for validating user names
+	"slices"        // Package for checking currencies
+	"time"          // Package for the refresh interval and widget ranges
+)
+
+// dashboardRefresh is how often the dashboard reloads its data
+const dashboardRefresh = time.Minute
+
+// dashboardHTML is the single-page dashboard; it draws its charts from the JSON API
+//
+//go:embed web/dashboard.html
+var dashboardHTML string
+
+// dashboardTemplate fills the currency list and refresh interval into the page
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// handleDashboard serves GET /, a page of widgets arranged by the user's saved layout
+// (see handleDashboardLayout). Every other unknown path is a JSON 404.
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, map[string]interface{}{
+		"Currencies":     currencies,
+		"RefreshSeconds": int(dashboardRefresh.Seconds()),
+		"Passkeys":       passkeyConfig.enabled(),
+		"Shares":         shareConfig.enabled(),
+	})
+	if err != nil {
+		slog.Error("Failed to render dashboard", "error", err)
+	}
+}
+
+// maxDashboardWidgets bounds a layout, keeping each refresh to a reasonable number of requests
+const maxDashboardWidgets = 24
+
+// defaultDashboardUser owns the layout of requests that name no user
+const defaultDashboardUser = "default"
+
+// DashboardWidget is one tile of the dashboard
+type DashboardWidget struct {
+	Type       string `json:"type"`                 // One of dashboardWidgetTypes
+	Currency   string `json:"currency,omitempty"`   // Empty follows the page's currency selector
+	Range      string `json:"range,omitempty"`      // Window shown, e.g. 24h or 90d
+	Resolution string `json:"resolution,omitempty"` // Candle resolution of candles widgets
+	Width      int    `json:"width"`                // Grid columns spanned: 1 (half) or 2 (full)
+}
+
+// DashboardLayout is a user's arrangement of widgets, in display order
+type DashboardLayout struct {
+	User      string            `json:"user"`
+	Widgets   []DashboardWidget `json:"widgets"`
+	Default   bool              `json:"default,omitempty"`    // The user has no saved layout
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"` // When the layout was saved
+}
+
+// dashboardWidgetTypes maps each widget type to the longest range it accepts
+// Price charts plot every sample, so they stop at two days; longer history uses candles
+var dashboardWidgetTypes = map[string]time.Duration{
+	"summary": 365 * 24 * time.Hour, // Latest price with change and low/high over the range
+	"tile":    365 * 24 * time.Hour, // Compact latest price and change for one currency
+	"prices":  48 * time.Hour,       // Line chart of the samples in the range
+	"candles": 5 * 365 * 24 * time.Hour,
+	"alerts":  0, // Alert rule statistics; takes no range
+}
+
+// maxHourlyCandleRange is the longest range of a candles widget with 1h candles
+const maxHourlyCandleRange = 30 * 24 * time.Hour
+
+// defaultDashboardLayout is the page shown to users without a saved layout
+func defaultDashboardLayout(user string) DashboardLayout {
+	return DashboardLayout{User: user, Default: true, Widgets: []DashboardWidget{
+		{Type: "summary", Range: "24h", Width: 2},
+		{Type: "prices", Range: "24h", Width: 2},
+		{Type: "candles", Range: "90d", Resolution: CandleDaily, Width: 2},
+		{Type: "alerts", Width: 2},
+	}}
+}
+
+// validate checks a widget and fills in its defaults
+func (w *DashboardWidget) validate() error {
+	maxRange, ok := dashboardWidgetTypes[w.Type]
+	if !ok {
+		return fmt.Errorf("unknown widget type %q (expected summary, tile, prices, candles, or alerts)", w.Type)
+	}
+	if w.Currency != "" && !slices.Contains(currencies, w.Currency) {
+		return fmt.Errorf("currency %q is not tracked", w.Currency)
+	}
+	if w.Width == 0 {
+		w.Width = 2
+	}
+	if w.Width != 1 && w.Width != 2 {
+		return fmt.Errorf("invalid width %d (expected 1 or 2)", w.Width)
+	}
+
+	if w.Type == "candles" {
+		if w.Resolution == "" {
+			w.Resolution = CandleDaily
+		}
+		res, err := parseCandleResolution(w.Resolution)
+		if err != nil {
+			return err
+		}
+		if w.Resolution = res; res == CandleHourly {
+			maxRange = maxHourlyCandleRange
+		}
+	} else if w.Resolution != "" {
+		return fmt.Errorf("%s widgets take no resolution", w.Type)
+	}
+
+	if maxRange == 0 {
+		if w.Range != "" {
+			return fmt.Errorf("%s widgets take no range", w.Type)
+		}
+		return nil
+	}
+	if w.Range == "" {
+		w.Range = "24h"
+	}
+	d, err := parseStatsWindow(w.Range)
+	if err != nil {
+		return err
+	}
+	if d > maxRange {
+		return fmt.Errorf("range %s is longer than the %dd %s widgets allow", w.Range, int(maxRange.Hours()/24), w.Type)
+	}
+	return nil
+}
+
+// dashboardUserPattern matches the user names layouts can be saved under
+var dashboardUserPattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// dashboardUser returns whose layout a request reads or writes: the user an
+// authenticating reverse proxy put in X-Forwarded-User or X-Remote-User, else the
+// user signed in with a passkey, else the ?user parameter, else the shared default
+// layout. A ?user name identifies a layout; it is not authentication.
+func dashboardUser(repo *Repository, r *http.Request) (string, error) {
+	user := r.Header.Get("X-Forwarded-User")
+	if user == "" {
+		user = r.Header.Get("X-Remote-User")
+	}
+	if user == "" {
+		user, _ = passkeySessionUser(repo, r)
+	}
+	if user == "" {
+		user = r.URL.Query().Get("user")
+	}
+	if user == "" {
+		return defaultDashboardUser, nil
+	}
+	if !dashboardUserPattern.MatchString(user) {
+		return "", fmt.Errorf("invalid user %q (letters, digits, and . _ @ - only, at most 64)", user)
+	}
+	return user, nil
+}
+
+// handleDashboardLayout serves /dashboard/layout for the requesting user:
+// GET returns the saved layout (or the default), PUT saves {"widgets": [...]},
+// and DELETE removes the saved layout so the default applies again
+func (s *apiServer) handleDashboardLayout(w http.ResponseWriter, r *http.Request) {
+	user, err := dashboardUser(s.repo, r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		layout, ok, err := s.repo.DashboardLayout(user)
+		if err != nil {
+			slog.Error("API failed to fetch dashboard layout", "path", r.URL.Path, "user", user, "error", err)
+			writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query dashboard layout")
+			return
+		}
+		if !ok {
+			layout = defaultDashboardLayout(user)
+		}
+		writeJSON(w, http.StatusOK, layout)
+
+	case http.MethodPut:
+		var layout DashboardLayout
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&layout); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid layout: %v", err)
+			return
+		}
+		if len(layout.Widgets) == 0 || len(layout.Widgets) > maxDashboardWidgets {
+			writeAPIError(w, http.StatusBadRequest, "a layout needs 1 to %d widgets", maxDashboardWidgets)
+			return
+		}
+		for i := range layout.Widgets {
+			if err := layout.Widgets[i].validate(); err != nil {
+				writeAPIError(w, http.StatusBadRequest, "widget %d: %v", i+1, err)
+				return
+			}
+		}
+		now := time.Now().UTC()
+		layout.User, layout.Default, layout.UpdatedAt = user, false, &now
+		if err := s.repo.SaveDashboardLayout(layout); err != nil {
+			slog.Error("API failed to save dashboard layout", "path", r.URL.Path, "user", user, "error", err)
+			writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to save dashboard layout")
+			return
+		}
+		slog.Info("Saved dashboard layout", "user", user, "widgets", len(layout.Widgets))
+		writeJSON(w, http.StatusOK, layout)
+
+	case http.MethodDelete:
+		if err := s.repo.DeleteDashboardLayout(user); err != nil {
+			slog.Error("API failed to delete dashboard layout", "path", r.URL.Path, "user", user, "error", err)
+			writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to delete dashboard layout")
+			return
+		}
+		writeJSON(w, http.StatusOK, defaultDashboardLayout(user))
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
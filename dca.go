@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"       // Package for the price lookups
+	"encoding/json" // Package for the --json output
+	"errors"        // Package for skipping purchases without a price
+	"fmt"           // Package for formatted I/O operations
+	"os"            // Package for the --json output
+	"strings"       // Package for string manipulation
+	"time"          // Package for the purchase schedule
+)
+
+// simulate-dca replays the stored prices to show what buying a fixed amount of bitcoin
+// on a schedule would have accumulated, e.g. 100 USD every week since 2020, next to
+// buying the same total at once on the first day.
+
+// dcaIntervals are the named purchase intervals; any other is a duration such as 3d
+var dcaIntervals = map[string]func(from time.Time, n int) time.Time{
+	"daily":    func(from time.Time, n int) time.Time { return from.AddDate(0, 0, n) },
+	"weekly":   func(from time.Time, n int) time.Time { return from.AddDate(0, 0, 7*n) },
+	"biweekly": func(from time.Time, n int) time.Time { return from.AddDate(0, 0, 14*n) },
+	"monthly":  func(from time.Time, n int) time.Time { return from.AddDate(0, n, 0) },
+}
+
+// DCAPurchase is one simulated purchase
+type DCAPurchase struct {
+	At       time.Time `json:"at"`
+	Price    float64   `json:"price"`    // Price at the time, as price-at finds it
+	Quantity float64   `json:"quantity"` // Bitcoin bought after fees
+	Total    float64   `json:"total"`    // Bitcoin held after the purchase
+}
+
+// DCAResult is the outcome of a dollar-cost averaging simulation
+type DCAResult struct {
+	Currency    string        `json:"currency"`
+	Amount      float64       `json:"amount"` // Spent per purchase, fees included
+	Interval    string        `json:"interval"`
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Purchases   []DCAPurchase `json:"purchases"`
+	Skipped     int           `json:"skipped"`  // Scheduled purchases without a stored price near them
+	Invested    float64       `json:"invested"` // Spent on the purchases made
+	Quantity    float64       `json:"quantity"` // Bitcoin accumulated
+	AverageCost float64       `json:"average_cost"`
+	Price       float64       `json:"price"` // Price at To, which the holdings are valued at
+	Value       float64       `json:"value"`
+	Gain        float64       `json:"gain"`
+	GainPct     float64       `json:"gain_pct"`
+	LumpSum     float64       `json:"lump_sum_value"` // Value of Invested spent at once on the first purchase
+}
+
+// simulateDCA buys amount (less feePct percent) at every scheduled time in [from, to)
+// at the stored price of that time, skipping times without a sample within a day, and
+// values the result at the price at to
+func simulateDCA(ctx context.Context, repo *Repository, currency string, amount float64, interval string, from, to time.Time, feePct float64) (DCAResult, error) {
+	result := DCAResult{Currency: currency, Amount: amount, Interval: interval, From: from, To: to}
+	next, ok := dcaIntervals[interval]
+	if !ok {
+		every, err := parseStatsWindow(interval)
+		if err != nil || every < time.Hour {
+			return result, validationErrorf("invalid --interval %q (expected daily, weekly, biweekly, monthly, or a duration of at least 1h)", interval)
+		}
+		next = func(from time.Time, n int) time.Time { return from.Add(time.Duration(n) * every) }
+	}
+
+	for n := 0; ; n++ {
+		at := next(from, n)
+		if !at.Before(to) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		p, err := lookupPriceAt(ctx, repo, currency, at, true, defaultPriceAtMaxGap)
+		if errors.Is(err, errNoPriceAt) {
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		quantity := amount * (1 - feePct/100) / p.Price
+		result.Quantity += quantity
+		result.Invested += amount
+		result.Purchases = append(result.Purchases, DCAPurchase{At: at, Price: p.Price, Quantity: roundQuantity(quantity), Total: roundQuantity(result.Quantity)})
+	}
+	if len(result.Purchases) == 0 {
+		return result, validationErrorf("no %s prices are stored between %s and %s; backfill them first",
+			strings.ToUpper(currency), from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+
+	// At the present this is the newest sample, as none come after it
+	p, err := lookupPriceAt(ctx, repo, currency, to, true, defaultPriceAtMaxGap)
+	if errors.Is(err, errNoPriceAt) {
+		return result, validationErrorf("no %s price is stored within a day of %s to value the holdings at",
+			strings.ToUpper(currency), to.In(displayLocation).Format("2006-01-02 15:04"))
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Price = p.Price
+
+	result.Quantity = roundQuantity(result.Quantity)
+	result.AverageCost = roundPrice(result.Invested / result.Quantity)
+	result.Value = roundPrice(result.Quantity * result.Price)
+	result.Gain = roundPrice(result.Value - result.Invested)
+	result.GainPct = roundPrice(result.Gain / result.Invested * 100)
+	first := result.Purchases[0]
+	result.LumpSum = roundPrice(result.Invested * (1 - feePct/100) / first.Price * result.Price)
+	return result, nil
+}
+
+// runSimulateDCACommand handles "simulate-dca --amount 100 --interval weekly --from 2020-01-01
+// [--to now] [--currency usd] [--fee 0.5] [--purchases] [--json]"
+func runSimulateDCACommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("simulate-dca")
+	amount := fs.Float64("amount", 100, "Amount spent per purchase, fees included")
+	interval := fs.String("interval", "weekly", "Time between purchases: daily, weekly, biweekly, monthly, or a duration such as 3d")
+	fromFlag := fs.String("from", "", "Date of the first purchase, YYYY-MM-DD or RFC 3339 (required)")
+	toFlag := fs.String("to", "now", "End of the simulation, when the holdings are valued")
+	currency := fs.String("currency", currencies[0], "Currency of the purchases")
+	fee := fs.Float64("fee", 0, "Percent of every purchase paid in fees")
+	purchases := fs.Bool("purchases", false, "List every purchase")
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if *fromFlag == "" {
+		return validationErrorf("--from is required, e.g. --from 2020-01-01")
+	}
+	from, err := parseTimeFlag("from", *fromFlag)
+	if err != nil {
+		return err
+	}
+	to, err := parseTimeFlag("to", *toFlag)
+	if err != nil {
+		return err
+	}
+	if !from.Before(to) {
+		return validationErrorf("--from must be before --to")
+	}
+	if *amount <= 0 {
+		return validationErrorf("--amount must be positive")
+	}
+	if *fee < 0 || *fee >= 100 {
+		return validationErrorf("--fee must be a percentage from 0 to below 100")
+	}
+
+	result, err := simulateDCA(ctx, repo, strings.ToLower(*currency), *amount, strings.ToLower(*interval), from, to, *fee)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+
+	cur := strings.ToUpper(result.Currency)
+	fmt.Printf("\nDCA simulation: %s %s %s from %s to %s\n", formatPriceAt(result.Amount, 2), cur, result.Interval,
+		result.From.Format("2006-01-02"), result.To.Format("2006-01-02"))
+	fmt.Println("------------------------------------------------------------------")
+	if *purchases {
+		fmt.Printf("%-17s %14s %14s %14s\n", "Time", "Price", "Bought (BTC)", "Total (BTC)")
+		for _, p := range result.Purchases {
+			fmt.Printf("%-17s %14s %14.8f %14.8f\n", p.At.In(displayLocation).Format("2006-01-02 15:04"), formatPriceAt(p.Price, 2), p.Quantity, p.Total)
+		}
+		fmt.Println("------------------------------------------------------------------")
+	}
+	purchased := fmt.Sprintf("%d", len(result.Purchases))
+	if result.Skipped > 0 {
+		purchased += fmt.Sprintf(" (%d skipped without a stored price)", result.Skipped)
+	}
+	fmt.Printf("%-14s %s\n", "Purchases:", purchased)
+	fmt.Printf("%-14s %s %s\n", "Invested:", formatPriceAt(result.Invested, 2), cur)
+	fmt.Printf("%-14s %.8f BTC\n", "Accumulated:", result.Quantity)
+	fmt.Printf("%-14s %s %s per BTC\n", "Average cost:", formatPriceAt(result.AverageCost, 2), cur)
+	fmt.Printf("%-14s %s %s at %s %s\n", "Value:", formatPriceAt(result.Value, 2), cur, formatPriceAt(result.Price, 2), cur)
+	fmt.Printf("%-14s %+.2f %s (%+.2f%%)\n", "Gain/loss:", result.Gain, cur, result.GainPct)
+	fmt.Printf("%-14s %s %s if invested at once on %s\n", "Lump sum:", formatPriceAt(result.LumpSum, 2), cur,
+		result.Purchases[0].At.Format("2006-01-02"))
+	fmt.Println()
+	return nil
+}
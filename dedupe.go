@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"  // Package for looking up the previous samples
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"time"     // Package for the duplicate window
+)
+
+// unchangedPriceWindow is how long a price identical to the previous sample of its
+// currency is not stored, so a provider that hasn't updated doesn't fill the history with
+// copies; 0 stores every price. Configured via SKIP_UNCHANGED_PRICES (e.g. 15m or 1d)
+var unchangedPriceWindow time.Duration
+
+// loadUnchangedPriceWindow reads SKIP_UNCHANGED_PRICES
+func loadUnchangedPriceWindow() (time.Duration, error) {
+	v := os.Getenv("SKIP_UNCHANGED_PRICES")
+	if v == "" || v == "0" {
+		return 0, nil
+	}
+	d, err := parseStatsWindow(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid SKIP_UNCHANGED_PRICES %q (expected a duration such as 15m or 1d, or 0 to store every price)", v)
+	}
+	return d, nil
+}
+
+// screenUnchangedPrices counts the records whose price is identical to the newest stored
+// one of their currency, and drops them while that sample is younger than
+// SKIP_UNCHANGED_PRICES. Once it is older the price is stored again, so a quiet market
+// or a stalled provider still leaves a sample every so often rather than a gap.
+func screenUnchangedPrices(ctx context.Context, repo *Repository, records []PriceRecord) []PriceRecord {
+	kept := make([]PriceRecord, 0, len(records))
+	for _, r := range records {
+		previous, err := repo.LatestPrices(ctx, 1, r.Currency)
+		if err != nil {
+			slog.Warn("Failed to look up the previous price", "currency", r.Currency, "error", err)
+		}
+		if err != nil || len(previous) == 0 || roundPriceIn(r.Currency, previous[0].Price) != roundPriceIn(r.Currency, r.Price) {
+			kept = append(kept, r)
+			continue
+		}
+
+		incCounter("tracker_unchanged_prices_total", map[string]string{"source": r.Source}, 1)
+		since := previous[0].Timestamp
+		if unchangedPriceWindow > 0 && r.Timestamp.Sub(since) < unchangedPriceWindow {
+			slog.Info("Skipped unchanged price", "coin", "bitcoin", "currency", r.Currency, "price", r.Price, "source", r.Source,
+				"since", since.Format(time.RFC3339))
+			continue
+		}
+		slog.Info("Price unchanged since the previous sample", "coin", "bitcoin", "currency", r.Currency, "price", r.Price,
+			"source", r.Source, "since", since.Format(time.RFC3339))
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// runDedupeCommand handles "dedupe [--window 1m] [--dry-run]"
+// The unique index keeps new prices one per currency and minute, but two samples a few
+// seconds apart on either side of a minute boundary still get through, as do rows stored
+// before the index existed; this removes every price recorded within window of the
+// previous kept one of its currency.
+func runDedupeCommand(repo *Repository, args []string) error {
+	fs := newFlagSet("dedupe")
+	windowFlag := fs.String("window", uniquePriceResolution.String(), "Prices closer together than this are duplicates (Go duration or days)")
+	dryRun := fs.Bool("dry-run", false, "Only count the duplicates")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+
+	window, err := parseStatsWindow(*windowFlag)
+	if err != nil {
+		return fmt.Errorf("invalid window %q", *windowFlag)
+	}
+	if window < time.Second {
+		return fmt.Errorf("window %s is below the minimum of %s", window, time.Second)
+	}
+
+	removed, err := repo.DedupePrices(window, *dryRun)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("%d duplicate prices within %s (dry run, nothing deleted)\n", removed, window)
+		return nil
+	}
+	fmt.Printf("Deleted %d duplicate prices within %s\n", removed, window)
+	return nil
+}
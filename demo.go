@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"   // Package for seeding within the command's lifetime
+	"flag"      // Package for the --demo flag
+	"fmt"       // Package for formatted I/O operations
+	"log/slog"  // Package for structured logging
+	"math"      // Package for the random walk
+	"math/rand" // Package for simulated price moves
+	"os"        // Package for environment variables
+	"time"      // Package for sample times
+)
+
+// demoFlag switches every command to a demo database and the mock provider
+var demoFlag = flag.Bool("demo", false, "use a demo SQLite database seeded with a year of simulated prices, and the mock provider")
+
+// Shape of the simulated prices
+const (
+	demoSeed       = 2009    // Seeds the year of history, so every demo database looks the same
+	demoStartPrice = 42000.0 // USD price a year before seeding
+	demoDailyVol   = 0.03    // Standard deviation of a day's log return
+	demoHistory    = 365 * 24 * time.Hour
+	demoRecent     = 7 * 24 * time.Hour // The newest week is sampled every demoRecentStep, older prices hourly
+	demoRecentStep = 5 * time.Minute
+)
+
+// demoRates converts the simulated USD price into other currencies
+// Currencies missing here are quoted at the USD price.
+var demoRates = map[string]float64{
+	"usd": 1, "eur": 0.92, "gbp": 0.79, "jpy": 150, "chf": 0.88, "cad": 1.37, "aud": 1.52,
+	"cny": 7.2, "inr": 83, "brl": 5, "krw": 1350, "mxn": 17, "sek": 10.5, "nok": 10.7,
+}
+
+// demoRate returns the simulated exchange rate of a currency against USD
+func demoRate(currency string) float64 {
+	if rate, ok := demoRates[currency]; ok {
+		return rate
+	}
+	return 1
+}
+
+// applyDemoMode points the store at DEMO_SQLITE_PATH (default bitcoin-tracker-demo.db)
+// and fetches from the mock provider, overriding the environment and --config so a
+// demo never touches a real database or calls a real API
+func applyDemoMode() {
+	if !*demoFlag {
+		return
+	}
+	path := os.Getenv("DEMO_SQLITE_PATH")
+	if path == "" {
+		path = "bitcoin-tracker-demo.db"
+	}
+	os.Setenv("DB_DRIVER", "sqlite")
+	os.Setenv("SQLITE_PATH", path)
+	os.Unsetenv("CLICKHOUSE_URL")
+	os.Setenv("PRICE_SOURCES", "mock")
+	os.Setenv("PRICE_AGGREGATION", aggregationFailover) // There is only one source to weigh
+	os.Unsetenv("PRICE_SOURCE_WEIGHTS")
+	os.Unsetenv("PRICE_QUORUM")
+	os.Setenv("GAP_FILL_THRESHOLD", "0") // Gaps are filled from CoinGecko
+}
+
+// demoWalk is a random walk of log prices with fat tails: now and then a move is three
+// times the usual size, as on news days
+type demoWalk struct {
+	rng *rand.Rand
+	vol float64 // Standard deviation of a day's log return
+}
+
+// step returns the factor a price moves by over d
+func (w demoWalk) step(d time.Duration) float64 {
+	sigma := w.vol * math.Sqrt(d.Hours()/24)
+	if w.rng.Float64() < 0.02 {
+		sigma *= 3
+	}
+	return math.Exp(sigma*w.rng.NormFloat64() - sigma*sigma/2)
+}
+
+// seedDemoData fills an empty store with a year of simulated prices ending now, hourly
+// and then every five minutes for the newest week, and builds the candles, levels, and
+// volatility regimes from them. A store that already holds prices is left alone.
+func seedDemoData(ctx context.Context, repo *Repository) error {
+	latest, err := repo.LatestPrices(ctx, 1, "")
+	if err != nil {
+		return err
+	}
+	if len(latest) > 0 {
+		return nil
+	}
+
+	now := time.Now().UTC().Truncate(demoRecentStep)
+	start := now.Add(-demoHistory).Truncate(time.Hour)
+	slog.Info("Seeding demo database with a year of simulated prices", "from", start.Format("2006-01-02"), "currencies", currencies)
+
+	walk := demoWalk{rng: rand.New(rand.NewSource(demoSeed)), vol: demoDailyVol}
+	var records []PriceRecord
+	price := demoStartPrice
+	for t, prev := start, start; !t.After(now); {
+		price *= walk.step(t.Sub(prev))
+		for _, currency := range currencies {
+			// Each currency follows the USD price with a little noise of its own
+			quote := price * demoRate(currency) * (1 + 0.0005*walk.rng.NormFloat64())
+			records = append(records, PriceRecord{Price: roundPriceIn(currency, quote), Currency: currency, Source: "mock", Timestamp: t})
+		}
+		prev = t
+		if now.Sub(t) > demoRecent {
+			t = t.Add(time.Hour)
+		} else {
+			t = t.Add(demoRecentStep)
+		}
+	}
+
+	inserted, err := repo.SaveHistoricalPrices(ctx, records)
+	if err != nil {
+		return fmt.Errorf("failed to seed demo prices: %w", err)
+	}
+	for _, currency := range currencies {
+		for _, resolution := range candleResolutions {
+			if _, err := updateCandles(repo, currency, resolution, start); err != nil {
+				return fmt.Errorf("failed to build demo candles: %w", err)
+			}
+		}
+	}
+	refreshVolatilityRegimes(repo)
+	refreshPriceLevels(ctx, repo)
+	slog.Info("Seeded demo database", "prices", inserted, "path", os.Getenv("SQLITE_PATH"))
+	return nil
+}
+
+// demoCoinPrices are the USD prices fixed demo baskets start from; other coins start at 100
+var demoCoinPrices = map[string]float64{"bitcoin": demoStartPrice, "ethereum": 2500, "solana": 100}
+
+// demoTopMarketCap is the USD market cap of the largest coins top demo baskets start from
+const demoTopMarketCap = 1.6e12
+
+// mockBasketValue simulates a basket's value in --demo: a random walk from its newest
+// stored value, or from a plausible starting value
+func mockBasketValue(ctx context.Context, repo *Repository, b Basket, currency string) (float64, error) {
+	mockState.mu.Lock()
+	defer mockState.mu.Unlock()
+
+	key, now := "basket/"+b.Name, time.Now()
+	last, ok := mockState.prices[key]
+	since := now.Sub(mockState.at[key])
+	if !ok {
+		last, since = demoTopMarketCap*float64(b.Top)/10, time.Minute
+		if b.Kind == BasketFixed {
+			last = 0
+			for coin, units := range b.Units {
+				price, ok := demoCoinPrices[coin]
+				if !ok {
+					price = 100
+				}
+				last += units * price
+			}
+		}
+		last *= demoRate(currency)
+		if latest, err := repo.LatestBasketValues(ctx, currency); err == nil {
+			for _, v := range latest {
+				if v.Basket == b.Name {
+					last, since = v.Value, now.Sub(v.Timestamp)
+				}
+			}
+		}
+	}
+	since = min(max(since, time.Second), 24*time.Hour)
+	value := last * mockWalk().step(since)
+	mockState.prices[key], mockState.at[key] = value, now
+	return value, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"strings"  // Package for parsing QUIET_HOURS and building digests
+	"sync"     // Package for guarding the held alerts
+	"time"     // Package for quiet hours and digest intervals
+)
+
+// Alerts go out the moment they fire, unless notifications are held:
+//
+//   - During QUIET_HOURS (e.g. 22:00-07:00 in QUIET_HOURS_TIMEZONE), alerts are held and
+//     sent when the quiet hours end.
+//   - With ALERT_DIGEST (e.g. 30m), the first alert starts an interval, and the alerts
+//     fired within it go out together when it ends.
+//
+// Held alerts are sent per notifier: a notifier with a single held alert gets it as it
+// was, and one with more gets a digest listing them, an alert of kind "digest". The log
+// notifier never holds alerts, and events are published when alerts fire either way.
+// Alerts still held when the process exits are sent then, unless it is during quiet
+// hours; those are dropped and logged.
+
+// AlertDigest is the kind of the alert that carries several held alerts
+const AlertDigest = "digest"
+
+// NotifyScheduleConfig controls when notifications go out
+type NotifyScheduleConfig struct {
+	QuietStart time.Duration  // Start of the quiet hours as time of day; equal to QuietEnd for none
+	QuietEnd   time.Duration  // End of the quiet hours as time of day
+	Location   *time.Location // Time zone of the quiet hours and digest times
+	Digest     time.Duration  // Interval alerts are collected over; 0 sends each at once
+}
+
+// notifySchedule is the active configuration, loaded at startup
+var notifySchedule = NotifyScheduleConfig{Location: time.Local}
+
+// loadNotifySchedule reads QUIET_HOURS (e.g. "22:00-07:00"), QUIET_HOURS_TIMEZONE, and
+// ALERT_DIGEST (Go duration)
+func loadNotifySchedule() (NotifyScheduleConfig, error) {
+	c := NotifyScheduleConfig{Location: time.Local}
+	if v := strings.TrimSpace(os.Getenv("QUIET_HOURS_TIMEZONE")); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid QUIET_HOURS_TIMEZONE %q: %w", v, err)
+		}
+		c.Location = loc
+	}
+	if v := strings.TrimSpace(os.Getenv("QUIET_HOURS")); v != "" {
+		from, to, ok := strings.Cut(v, "-")
+		start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+		end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+		if !ok || err1 != nil || err2 != nil || start.Equal(end) {
+			return c, fmt.Errorf("invalid QUIET_HOURS %q (expected HH:MM-HH:MM, e.g. 22:00-07:00)", v)
+		}
+		c.QuietStart = time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+		c.QuietEnd = time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute
+	}
+	if v := os.Getenv("ALERT_DIGEST"); v != "" && v != "0" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return c, fmt.Errorf("invalid ALERT_DIGEST %q (expected a duration of at least 1m, or 0)", v)
+		}
+		c.Digest = d
+	}
+	return c, nil
+}
+
+// quietUntil returns the end of the quiet hours t is in; false when t isn't in them
+// Quiet hours may span midnight, e.g. 22:00-07:00.
+func (c NotifyScheduleConfig) quietUntil(t time.Time) (time.Time, bool) {
+	if c.QuietStart == c.QuietEnd {
+		return time.Time{}, false
+	}
+	t = t.In(c.Location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, c.Location)
+	now := t.Sub(midnight)
+	switch {
+	case c.QuietStart < c.QuietEnd && now >= c.QuietStart && now < c.QuietEnd:
+		return midnight.Add(c.QuietEnd), true
+	case c.QuietStart > c.QuietEnd && now >= c.QuietStart:
+		return midnight.AddDate(0, 0, 1).Add(c.QuietEnd), true
+	case c.QuietStart > c.QuietEnd && now < c.QuietEnd:
+		return midnight.Add(c.QuietEnd), true
+	}
+	return time.Time{}, false
+}
+
+// heldAlerts are the alerts waiting for the quiet hours or the digest interval to end,
+// by notifier name
+var heldAlerts = struct {
+	sync.Mutex
+	alerts map[string][]Alert
+	timer  *time.Timer // Sends the held alerts; nil while none are held
+}{}
+
+// holdAlert holds an alert for a notifier when notifications are held; false when it
+// should be sent now
+func holdAlert(n Notifier, a Alert) bool {
+	if n.Channel() == "log" {
+		return false
+	}
+	now := time.Now()
+	until, quiet := notifySchedule.quietUntil(now)
+	if !quiet && notifySchedule.Digest == 0 {
+		return false
+	}
+
+	heldAlerts.Lock()
+	defer heldAlerts.Unlock()
+	if heldAlerts.alerts == nil {
+		heldAlerts.alerts = make(map[string][]Alert)
+	}
+	heldAlerts.alerts[n.Name()] = append(heldAlerts.alerts[n.Name()], a)
+	if heldAlerts.timer == nil {
+		if !quiet {
+			until = now.Add(notifySchedule.Digest)
+		}
+		heldAlerts.timer = time.AfterFunc(time.Until(until), func() { releaseHeldAlerts(false) })
+		slog.Info("Holding alert notifications", "until", until.In(notifySchedule.Location).Format("15:04"), "quiet_hours", quiet)
+	}
+	return true
+}
+
+// releaseHeldAlerts sends the held alerts, one digest per notifier. While the quiet
+// hours last they are held until their end instead, or dropped when exiting.
+func releaseHeldAlerts(exiting bool) {
+	heldAlerts.Lock()
+	if until, quiet := notifySchedule.quietUntil(time.Now()); quiet && len(heldAlerts.alerts) > 0 {
+		if exiting {
+			slog.Warn("Dropping alert notifications held for the quiet hours", "notifiers", len(heldAlerts.alerts))
+			heldAlerts.alerts = nil
+			heldAlerts.timer.Stop()
+			heldAlerts.timer = nil
+		} else {
+			// A digest interval ended during the quiet hours
+			heldAlerts.timer = time.AfterFunc(time.Until(until), func() { releaseHeldAlerts(false) })
+		}
+		heldAlerts.Unlock()
+		return
+	}
+	held := heldAlerts.alerts
+	heldAlerts.alerts = nil
+	if heldAlerts.timer != nil {
+		heldAlerts.timer.Stop()
+		heldAlerts.timer = nil
+	}
+	heldAlerts.Unlock()
+
+	for _, n := range notifiers {
+		alerts := held[n.Name()]
+		switch len(alerts) {
+		case 0:
+			continue
+		case 1:
+			deliverAlert(n, alerts[0])
+		default:
+			deliverAlert(n, digestAlert(alerts))
+		}
+	}
+}
+
+// digestAlert combines held alerts into one whose message lists them, oldest first
+func digestAlert(alerts []Alert) Alert {
+	loc := notifySchedule.Location
+	lines := []string{renderMessage("", "alert.digest", map[string]interface{}{
+		"Count": len(alerts),
+		"Since": alerts[0].Time.In(loc).Format("15:04"),
+	})}
+	for _, a := range alerts {
+		first, _, _ := strings.Cut(a.Message, "\n")
+		lines = append(lines, "• "+a.Time.In(loc).Format("15:04")+" "+first)
+	}
+	return Alert{
+		Rule:    AlertRule{Kind: AlertDigest, Currency: alerts[0].Rule.Currency},
+		Price:   alerts[len(alerts)-1].Price,
+		Message: strings.Join(lines, "\n"),
+		Time:    time.Now().UTC(),
+	}
+}
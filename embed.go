@@ -0,0 +1,183 @@
+package main
+
+import (
+	_ "embed"       // Package for embedding the chart page
+	"errors"        // Package for share link errors
+	"fmt"           // Package for formatted I/O operations
+	"html/template" // Package for rendering the chart page
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for the embed endpoint
+	"net/url"       // Package for validating EMBED_ORIGINS
+	"os"            // Package for environment variables
+	"slices"        // Package for checking currencies
+	"strings"       // Package for string manipulation
+	"time"          // Package for chart ranges
+)
+
+// embedDefaultRange is the window of an embedded chart without ?range
+const embedDefaultRange = 30 * 24 * time.Hour
+
+// EmbedConfig controls the embeddable chart
+type EmbedConfig struct {
+	Origins []string // Sites allowed to frame the chart; empty allows any
+}
+
+// embedConfig is the active configuration, loaded at startup
+var embedConfig EmbedConfig
+
+// loadEmbedConfig reads EMBED_ORIGINS, a comma-separated list such as
+// "https://blog.example.com,https://wiki.example.com"
+func loadEmbedConfig() (EmbedConfig, error) {
+	var c EmbedConfig
+	for _, origin := range strings.Split(os.Getenv("EMBED_ORIGINS"), ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return c, fmt.Errorf("invalid EMBED_ORIGINS entry %q (expected e.g. https://blog.example.com)", origin)
+		}
+		c.Origins = append(c.Origins, origin)
+	}
+	return c, nil
+}
+
+// frameAncestors returns the Content-Security-Policy that limits who may frame the chart
+func (c EmbedConfig) frameAncestors() string {
+	if len(c.Origins) == 0 {
+		return "frame-ancestors *"
+	}
+	return "frame-ancestors " + strings.Join(c.Origins, " ")
+}
+
+// embedResolution returns the candles an embedded chart of span is drawn from
+// Hourly candles keep short ranges detailed; longer ones use daily candles, so no
+// chart plots more than a few hundred points however long its range.
+func embedResolution(span time.Duration) string {
+	if span <= maxHourlyCandleRange {
+		return CandleHourly
+	}
+	return CandleDaily
+}
+
+// EmbedChart is the data behind an embedded chart
+type EmbedChart struct {
+	Currency   string    `json:"currency"`
+	Resolution string    `json:"resolution"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Candles    []Candle  `json:"candles"`
+}
+
+// embedHTML is the minimal chart page meant for iframes
+//
+//go:embed web/embed.html
+var embedHTML string
+
+// embedTemplate renders an embedded chart, or why it can't be shown
+var embedTemplate = template.Must(template.New("embed").Parse(embedHTML))
+
+// handleEmbedChart serves GET /embed/chart?range=30d&currency=usd&theme=dark, a chart
+// with no controls for iframes in blogs and wikis. With ?share=<token> it draws the
+// currency and range of that share link instead, which is how charts are embedded when
+// API_AUTH=all: the page needs no API key, but then only with a valid link.
+func (s *apiServer) handleEmbedChart(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/embed/chart" {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Security-Policy", embedConfig.frameAncestors())
+
+	theme := r.URL.Query().Get("theme")
+	if theme == "" {
+		theme = "auto"
+	}
+	if theme != "auto" && theme != "light" && theme != "dark" {
+		renderEmbed(w, http.StatusBadRequest, "auto", EmbedChart{}, fmt.Sprintf("invalid theme %q (expected light, dark, or auto)", theme))
+		return
+	}
+
+	now := time.Now()
+	chart := EmbedChart{Currency: requestCurrency(r), To: now}
+	if token := r.URL.Query().Get("share"); token != "" {
+		// The token is the permission, so keep it out of the embedding site's logs
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		if !shareConfig.enabled() {
+			renderEmbed(w, http.StatusNotFound, theme, EmbedChart{}, "share links are not enabled")
+			return
+		}
+		link, err := parseShareToken(token, now)
+		if err != nil {
+			status := http.StatusNotFound
+			if errors.Is(err, errShareExpired) {
+				status = http.StatusGone
+			}
+			renderEmbed(w, status, theme, EmbedChart{}, err.Error())
+			return
+		}
+		chart.Currency, chart.From, chart.To = link.Currency, time.Unix(link.From, 0).UTC(), time.Unix(link.To, 0).UTC()
+		w.Header().Set("Cache-Control", "private, max-age=300")
+	} else {
+		if apiAuthConfig.Mode == apiAuthAll {
+			if _, ok := passkeySessionUser(s.repo, r); !ok {
+				renderEmbed(w, http.StatusUnauthorized, theme, EmbedChart{}, "embedding needs a share link here; add ?share=<token>")
+				return
+			}
+		}
+		span := embedDefaultRange
+		if v := r.URL.Query().Get("range"); v != "" {
+			d, err := parseStatsWindow(v)
+			if err != nil {
+				renderEmbed(w, http.StatusBadRequest, theme, EmbedChart{}, err.Error())
+				return
+			}
+			span = d
+		}
+		if maxRange := dashboardWidgetTypes["candles"]; span > maxRange {
+			renderEmbed(w, http.StatusBadRequest, theme, EmbedChart{}, fmt.Sprintf("range is longer than the %dd embedded charts allow", int(maxRange.Hours()/24)))
+			return
+		}
+		if !slices.Contains(currencies, chart.Currency) {
+			renderEmbed(w, http.StatusBadRequest, theme, EmbedChart{}, fmt.Sprintf("currency %q is not tracked", chart.Currency))
+			return
+		}
+		chart.From = now.Add(-span)
+		w.Header().Set("Cache-Control", "public, max-age=60")
+	}
+
+	chart.Resolution = embedResolution(chart.To.Sub(chart.From))
+	candles, err := s.repo.Candles(r.Context(), chart.Currency, chart.Resolution, chart.From, chart.To, maxRangeLimit)
+	if err != nil {
+		slog.Error("Failed to load embedded chart", "currency", chart.Currency, "error", err)
+		w.Header().Del("Cache-Control")
+		renderEmbed(w, http.StatusInternalServerError, theme, EmbedChart{}, "failed to load prices")
+		return
+	}
+	if chart.Candles = candles; chart.Candles == nil {
+		chart.Candles = []Candle{}
+	}
+	renderEmbed(w, http.StatusOK, theme, chart, "")
+}
+
+// renderEmbed writes an embedded chart, or message when it can't be shown, crediting
+// the price providers below the chart
+func renderEmbed(w http.ResponseWriter, status int, theme string, chart EmbedChart, message string) {
+	if message != "" {
+		message = strings.ToUpper(message[:1]) + message[1:] // A sentence on the page
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	var credit []Attribution
+	if attributionEnabled {
+		credit = attributionsFor(nil)
+	}
+	err := embedTemplate.Execute(w, map[string]interface{}{"Chart": chart, "Theme": theme, "Error": message, "Attribution": credit})
+	if err != nil {
+		slog.Error("Failed to render embedded chart", "error", err)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"             // Package for the log handler
+	"database/sql"        // Package for database sentinel errors
+	"database/sql/driver" // Package for broken-connection errors
+	"errors"              // Package for inspecting error chains
+	"fmt"                 // Package for formatted I/O operations
+	"log/slog"            // Package for structured logging
+	"net/http"            // Package for problem details
+	"os"                  // Package for exit codes
+	"reflect"             // Package for recognizing database driver errors
+	"strings"             // Package for matching driver packages
+
+	"bitcoin-tracker/tracker" // Provider errors of the fetch pipeline
+)
+
+// ErrorKind says what kind of failure an error is, so logs, API responses, and exit
+// codes let scripts and monitors react to it without parsing messages
+type ErrorKind string
+
+// Error kinds; an error that carries none is unclassified
+const (
+	KindConfig     ErrorKind = "config"     // Invalid settings in the environment or --config
+	KindProvider   ErrorKind = "provider"   // A price provider failed, refused, or returned nonsense
+	KindStorage    ErrorKind = "storage"    // The database couldn't be opened, migrated, read, or written
+	KindValidation ErrorKind = "validation" // Bad input: arguments, flags, query parameters, or request bodies
+	KindAuth       ErrorKind = "auth"       // The caller is not allowed, or has used up its rate limit
+)
+
+// errorKindExitCodes are the exit statuses of the kinds, taken from sysexits.h
+// Unclassified errors exit with status 1.
+var errorKindExitCodes = map[ErrorKind]int{
+	KindValidation: 64, // EX_USAGE
+	KindProvider:   69, // EX_UNAVAILABLE
+	KindStorage:    74, // EX_IOERR
+	KindAuth:       77, // EX_NOPERM
+	KindConfig:     78, // EX_CONFIG
+}
+
+// errorKindTitles are the problem titles of API errors of each kind
+var errorKindTitles = map[ErrorKind]string{
+	KindConfig:     "Configuration error",
+	KindProvider:   "Price provider failure",
+	KindStorage:    "Storage failure",
+	KindValidation: "Invalid request",
+	KindAuth:       "Not authorized",
+}
+
+// kindError is an error tagged with its kind
+type kindError struct {
+	kind ErrorKind
+	err  error
+}
+
+// Error returns the message of the wrapped error
+func (e *kindError) Error() string { return e.err.Error() }
+
+// Unwrap returns the wrapped error
+func (e *kindError) Unwrap() error { return e.err }
+
+// withKind tags err with a kind; a nil err stays nil, and so does one already tagged,
+// since the code closest to a failure knows best what kind it is
+func withKind(kind ErrorKind, err error) error {
+	var tagged *kindError
+	if err == nil || errors.As(err, &tagged) {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// validationErrorf formats an error about bad input
+func validationErrorf(format string, args ...interface{}) error {
+	return withKind(KindValidation, fmt.Errorf(format, args...))
+}
+
+// storageDriverPackages are the packages whose error types come from the database
+var storageDriverPackages = []string{"github.com/lib/pq", "github.com/mattn/go-sqlite3"}
+
+// errorKind returns the kind of err: its tag, or else the kind implied by a provider or
+// database error within it; "" when err is unclassified
+func errorKind(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+	var tagged *kindError
+	if errors.As(err, &tagged) {
+		return tagged.kind
+	}
+
+	var partial *tracker.PartialError
+	var status *tracker.StatusError
+	if errors.As(err, &partial) || errors.As(err, &status) || errors.Is(err, errBudgetExhausted) {
+		return KindProvider
+	}
+	if errors.Is(err, sql.ErrConnDone) || errors.Is(err, sql.ErrTxDone) || errors.Is(err, driver.ErrBadConn) || isDriverError(err) {
+		return KindStorage
+	}
+	return ""
+}
+
+// isDriverError reports whether err's chain holds an error type of a database driver
+// The drivers' types are matched by package, since the SQLite one only exists in cgo builds.
+func isDriverError(err error) bool {
+	if err == nil {
+		return false
+	}
+	t := reflect.TypeOf(err)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for _, pkg := range storageDriverPackages {
+		if strings.HasPrefix(t.PkgPath(), pkg) {
+			return true
+		}
+	}
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return isDriverError(e.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			if isDriverError(inner) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exitCode returns the exit status of a command that failed with err
+func exitCode(err error) int {
+	if code, ok := errorKindExitCodes[errorKind(err)]; ok {
+		return code
+	}
+	return 1
+}
+
+// exitWithError logs err with its kind, then exits with the kind's exit status
+func exitWithError(msg string, err error, args ...interface{}) {
+	slog.Error(msg, append(args, "error", err)...)
+	os.Exit(exitCode(err))
+}
+
+// kindHandler adds error_kind to every log record with a classified "error" attribute
+type kindHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler
+func (h kindHandler) Handle(ctx context.Context, r slog.Record) error {
+	var kind ErrorKind
+	r.Attrs(func(a slog.Attr) bool {
+		if err, ok := a.Value.Any().(error); ok && a.Key == "error" {
+			kind = errorKind(err)
+			return false
+		}
+		return true
+	})
+	if kind != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String("error_kind", string(kind)))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h kindHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return kindHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler
+func (h kindHandler) WithGroup(name string) slog.Handler {
+	return kindHandler{h.Handler.WithGroup(name)}
+}
+
+// statusErrorKind returns the kind of an API error response with no more specific kind
+func statusErrorKind(status int) ErrorKind {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		return KindAuth
+	case status >= 400 && status < 500:
+		return KindValidation
+	case status == http.StatusBadGateway || status == http.StatusGatewayTimeout:
+		return KindProvider
+	}
+	return ""
+}
+
+// problemType returns the RFC 7807 type URI of a kind; unclassified errors use about:blank
+func problemType(kind ErrorKind) string {
+	if kind == "" {
+		return "about:blank"
+	}
+	return "urn:bitcoin-tracker:error:" + string(kind)
+}
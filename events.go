@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"         // Package for request bodies
+	"crypto/rand"   // Package for generating event IDs
+	"encoding/hex"  // Package for encoding event IDs
+	"encoding/json" // Package for JSON encoding
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for webhook delivery
+	"os"            // Package for environment variables
+	"strings"       // Package for string manipulation
+	"time"          // Package for event timestamps
+)
+
+// Event types emitted by the tracker
+const (
+	EventPriceRecorded = "price.recorded" // A new price sample was stored
+)
+
+// Event is something that happened in the tracker and may be published to sinks
+type Event struct {
+	ID      string      `json:"id"`      // Unique event ID
+	Type    string      `json:"type"`    // One of the Event* constants
+	Subject string      `json:"subject"` // What the event is about, e.g. "bitcoin/usd"
+	Time    time.Time   `json:"time"`    // When the event happened
+	Data    interface{} `json:"data"`    // Event payload
+}
+
+// PriceEventData is the payload of a price.recorded event
+type PriceEventData struct {
+	Asset     string    `json:"asset"`
+	Currency  string    `json:"currency"`
+	Price     float64   `json:"price"`
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// newEvent creates an event with a fresh ID and the current time
+func newEvent(eventType, subject string, data interface{}) Event {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return Event{
+		ID:      hex.EncodeToString(id),
+		Type:    eventType,
+		Subject: subject,
+		Time:    time.Now().UTC(),
+		Data:    data,
+	}
+}
+
+// Event envelope formats, selected with EVENT_FORMAT
+const (
+	EventFormatPlain       = "plain"              // The Event JSON as-is
+	EventFormatCloudEvents = "cloudevents"        // CloudEvents 1.0 structured mode
+	EventFormatCloudBinary = "cloudevents-binary" // CloudEvents 1.0 binary mode (attributes in headers)
+)
+
+// CloudEvents constants
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	cloudEventsTypePrefix  = "bitcoin-tracker." // Prefix for CloudEvents "type" attributes
+)
+
+// eventFormat is the envelope used for outbound events
+var eventFormat = EventFormatPlain
+
+// eventSource is the CloudEvents "source" attribute identifying this tracker instance
+// Configured via EVENT_SOURCE
+var eventSource = "/bitcoin-tracker"
+
+// CloudEvent is the CloudEvents 1.0 structured-mode JSON envelope
+type CloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// toCloudEvent wraps an event in a CloudEvents envelope
+func toCloudEvent(e Event) CloudEvent {
+	return CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              e.ID,
+		Source:          eventSource,
+		Type:            cloudEventsTypePrefix + e.Type,
+		Subject:         e.Subject,
+		Time:            e.Time,
+		DataContentType: "application/json",
+		Data:            e.Data,
+	}
+}
+
+// cloudEventAttributes returns the CloudEvents context attributes for binary mode
+// Transports prefix the keys themselves ("ce-" for HTTP, "ce_" for Kafka)
+func cloudEventAttributes(e Event) map[string]string {
+	ce := toCloudEvent(e)
+	return map[string]string{
+		"specversion": ce.SpecVersion,
+		"id":          ce.ID,
+		"source":      ce.Source,
+		"type":        ce.Type,
+		"subject":     ce.Subject,
+		"time":        ce.Time.Format(time.RFC3339Nano),
+	}
+}
+
+// encodeEvent serializes an event in the configured format
+// It returns the body, its content type, and any attributes that belong in
+// transport headers (only set for CloudEvents binary mode)
+func encodeEvent(e Event) ([]byte, string, map[string]string, error) {
+	var (
+		body    []byte
+		err     error
+		headers map[string]string
+	)
+
+	contentType := "application/json"
+	switch eventFormat {
+	case EventFormatCloudEvents:
+		body, err = json.Marshal(toCloudEvent(e))
+		contentType = cloudEventsContentType
+	case EventFormatCloudBinary:
+		body, err = json.Marshal(e.Data)
+		headers = cloudEventAttributes(e)
+	default:
+		body, err = json.Marshal(e)
+	}
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+	return body, contentType, headers, nil
+}
+
+// EventSink receives published events: webhooks, message brokers, cloud services, and files
+type EventSink interface {
+	Name() string
+	Publish(e Event) error
+}
+
+// eventSinks are the sinks every event is published to
+var eventSinks []EventSink
+
+// webhookSink POSTs each event to a URL
+type webhookSink struct {
+	url string
+}
+
+// Name identifies the sink in logs
+func (s webhookSink) Name() string { return "webhook " + s.url }
+
+// Publish implements EventSink
+func (s webhookSink) Publish(e Event) error {
+	body, contentType, attrs, err := encodeEvent(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range attrs {
+		req.Header.Set("ce-"+k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// loadEventConfig reads EVENT_FORMAT, EVENT_SOURCE, and EVENT_WEBHOOK_URLS,
+// plus the AWS, Google Cloud, Azure, MQTT, Redis, NATS, Kafka, and latest-price file sink settings
+func loadEventConfig() error {
+	switch format := strings.ToLower(os.Getenv("EVENT_FORMAT")); format {
+	case "", EventFormatPlain:
+		eventFormat = EventFormatPlain
+	case EventFormatCloudEvents, EventFormatCloudBinary:
+		eventFormat = format
+	default:
+		return fmt.Errorf("invalid EVENT_FORMAT %q", format)
+	}
+
+	if v := os.Getenv("EVENT_SOURCE"); v != "" {
+		eventSource = v
+	}
+
+	var sinks []EventSink
+	for _, url := range strings.Split(os.Getenv("EVENT_WEBHOOK_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			sinks = append(sinks, webhookSink{url: url})
+		}
+	}
+	sinks = append(sinks, loadAWSSinks()...)
+
+	pubsub, err := loadPubSubSink()
+	if err != nil {
+		return err
+	}
+	if pubsub != nil {
+		sinks = append(sinks, pubsub)
+	}
+
+	azure, err := loadAzureSinks()
+	if err != nil {
+		return err
+	}
+	sinks = append(sinks, azure...)
+
+	mqtt, err := loadMQTTSink()
+	if err != nil {
+		return err
+	}
+	if mqtt != nil {
+		sinks = append(sinks, mqtt)
+	}
+
+	redis, err := loadRedisSink()
+	if err != nil {
+		return err
+	}
+	if redis != nil {
+		sinks = append(sinks, redis)
+	}
+
+	nats, err := loadNATSSink()
+	if err != nil {
+		return err
+	}
+	if nats != nil {
+		sinks = append(sinks, nats)
+	}
+
+	kafka, err := loadKafkaSink()
+	if err != nil {
+		return err
+	}
+	if kafka != nil {
+		sinks = append(sinks, kafka)
+	}
+
+	file, err := loadFileSink()
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		sinks = append(sinks, file)
+	}
+
+	eventSinks = sinks
+	return nil
+}
+
+// publishEvent delivers an event to every configured sink
+// Delivery failures are logged so they never fail the fetch that caused the event.
+// With EVENT_OUTBOX the event is stored first and retried until each sink accepts it;
+// when it can't be stored, it is published directly.
+func publishEvent(repo *Repository, e Event) {
+	if eventOutbox.enabled(repo) {
+		err := eventOutbox.queue(repo, e)
+		if err == nil {
+			return
+		}
+		slog.Error("Failed to store event in the outbox, publishing it directly", "type", e.Type, "error", err)
+	}
+	for _, sink := range eventSinks {
+		if err := sink.Publish(e); err != nil {
+			slog.Error("Failed to publish event", "type", e.Type, "sink", sink.Name(), "error", err)
+		}
+	}
+}
+
+// publishPriceEvents emits a price.recorded event for each stored currency
+func publishPriceEvents(repo *Repository, asset string, prices map[string]float64, source string) {
+	now := time.Now().UTC()
+	for _, currency := range currencies {
+		publishEvent(repo, newEvent(EventPriceRecorded, asset+"/"+currency, PriceEventData{
+			Asset:     asset,
+			Currency:  currency,
+			Price:     prices[currency],
+			Source:    source,
+			Timestamp: now,
+		}))
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"         // Package for buffered output
+	"encoding/csv"  // Package for CSV output
+	"encoding/json" // Package for JSON output
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for output writers
+	"log/slog"      // Package for structured logging
+	"os"            // Package for the output file
+	"slices"        // Package for collecting the sources of exported records
+	"strconv"       // Package for formatting CSV fields
+	"strings"       // Package for string manipulation
+	"time"          // Package for range boundaries
+)
+
+// pricePageSize is how many records forEachPrice reads per query
+const pricePageSize = 5000
+
+// forEachPrice calls fn for every record in [from, to), oldest first
+// Records are read page by page, so memory use doesn't grow with the range.
+// An empty currency covers every currency; a zero to leaves the range open-ended.
+func forEachPrice(repo *Repository, currency string, from, to time.Time, fn func(PriceRecord) error) error {
+	return forEachPriceIn(repo, currency, from, to, fn)
+}
+
+// forEachPriceIn is forEachPrice reading from a given backend
+func forEachPriceIn(s Store, currency string, from, to time.Time, fn func(PriceRecord) error) error {
+	seen := make(map[int]bool) // IDs at the page boundary, which the next page repeats
+	for {
+		page, err := s.PriceRange(currency, from, to, pricePageSize)
+		if err != nil {
+			return err
+		}
+
+		added := 0
+		for _, r := range page {
+			if seen[r.ID] {
+				continue
+			}
+			added++
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < pricePageSize || added == 0 {
+			return nil
+		}
+
+		// Continue from the last timestamp; records sharing it are skipped by ID
+		from = page[len(page)-1].Timestamp
+		seen = make(map[int]bool)
+		for _, r := range page {
+			if r.Timestamp.Equal(from) {
+				seen[r.ID] = true
+			}
+		}
+	}
+}
+
+// exportProgress is told the number of records written so far after each one; an error
+// stops the export. It may be nil.
+type exportProgress func(records int) error
+
+// exportCSV writes records as CSV with a header row, prices with precision decimal places.
+// With MARKET_DATA, volume_24h and market_cap columns follow, and an annotation column
+// when the range has annotations. A "#" comment line after the records credits the
+// providers that supplied them, unless ATTRIBUTION is off.
+func exportCSV(repo *Repository, w io.Writer, currency string, precision int, from, to time.Time, progress exportProgress) (int, error) {
+	labels, err := loadAnnotationLabels(repo, from, to)
+	if err != nil {
+		return 0, err
+	}
+	cw := csv.NewWriter(w)
+	header := []string{"id", "timestamp", "currency", "price", "source"}
+	if marketDataEnabled {
+		header = append(header, "volume_24h", "market_cap")
+	}
+	if labels.any() {
+		header = append(header, "annotation")
+	}
+	if err := cw.Write(header); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var sources []string
+	err = forEachPrice(repo, currency, from, to, func(r PriceRecord) error {
+		count++
+		if !slices.Contains(sources, r.Source) {
+			sources = append(sources, r.Source)
+		}
+		row := []string{
+			strconv.Itoa(r.ID),
+			r.Timestamp.UTC().Format(time.RFC3339),
+			r.Currency,
+			formatDecimal(r.Price, precision),
+			r.Source,
+		}
+		if marketDataEnabled {
+			row = append(row, formatDecimal(r.Volume, 0), formatDecimal(r.MarketCap, 0))
+		}
+		if labels.any() {
+			row = append(row, labels.label(r))
+		}
+		if err := cw.Write(row); err != nil || progress == nil {
+			return err
+		}
+		return progress(count)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return count, err
+	}
+	if text := attributionText(attributionsFor(sources)); attributionEnabled && count > 0 && text != "" {
+		_, err = io.WriteString(w, "# "+text+"\n")
+	}
+	return count, err
+}
+
+// exportJSON writes records as a JSON array, one record per line, prices with precision
+// decimal places. The array is written element by element rather than marshalled in one go.
+// Records that annotations fall on carry their texts in "annotation".
+func exportJSON(repo *Repository, w io.Writer, currency string, precision int, from, to time.Time, progress exportProgress) (int, error) {
+	labels, err := loadAnnotationLabels(repo, from, to)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = forEachPrice(repo, currency, from, to, func(r PriceRecord) error {
+		sep := ",\n"
+		if count == 0 {
+			sep = "\n"
+		}
+		count++
+
+		r.Timestamp = r.Timestamp.UTC()
+		data, err := json.Marshal(priceWithPrecision(r, precision))
+		if err != nil {
+			return err
+		}
+		if label := labels.label(r); label != "" {
+			// Records are objects, so the field goes in before the closing brace
+			text, _ := json.Marshal(label)
+			data = append(append(data[:len(data)-1], `,"annotation":`...), append(text, '}')...)
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil || progress == nil {
+			return err
+		}
+		return progress(count)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	_, err = io.WriteString(w, "\n]\n")
+	return count, err
+}
+
+// exportFormats maps each export format to its writer
+var exportFormats = map[string]func(*Repository, io.Writer, string, int, time.Time, time.Time, exportProgress) (int, error){
+	"csv":     exportCSV,
+	"json":    exportJSON,
+	"parquet": exportParquet,
+}
+
+// runExportCommand handles "export [--format csv|json|parquet] [--window ... | --from ... --to ...] [--currency usd]
+// [--precision N] [--metric name] [--output file]"
+// Output goes to stdout unless --output is given; log messages go to stderr
+func runExportCommand(repo *Repository, args []string) error {
+	fs := newFlagSet("export")
+	format := fs.String("format", "csv", "Output format: csv, json, or parquet")
+	window := fs.String("window", "", windowUsage)
+	fromFlag := fs.String("from", "", "Start of the range: YYYY-MM-DD or RFC 3339 (default: first record)")
+	toFlag := fs.String("to", "now", "End of the range: now, YYYY-MM-DD, or RFC 3339")
+	currency := fs.String("currency", "", "Only export this currency (default: all)")
+	precisionFlag := fs.String("precision", "", "Decimal places of every price (default: as stored, without trailing zeros)")
+	output := fs.String("output", "", "File to write (default: stdout)")
+	metric := fs.String("metric", "", "Export the values of a collector metric, e.g. hashrate, instead of prices (csv or json)")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	precision, err := parsePrecision("--precision", *precisionFlag)
+	if err != nil {
+		return err
+	}
+
+	write, ok := exportFormats[strings.ToLower(*format)]
+	if !ok {
+		return validationErrorf("invalid --format %q (expected csv, json, or parquet)", *format)
+	}
+	if *metric != "" {
+		if *currency != "" || *precisionFlag != "" {
+			return validationErrorf("--metric can't be combined with --currency or --precision")
+		}
+		m, err := lookupCollectorMetric(*metric)
+		if err != nil {
+			return err
+		}
+		if f := strings.ToLower(*format); f != "csv" && f != "json" {
+			return validationErrorf("invalid --format %q for --metric (expected csv or json)", *format)
+		}
+		// Collector values are written by their own writer, in the same formats
+		write = func(repo *Repository, w io.Writer, _ string, _ int, from, to time.Time, _ exportProgress) (int, error) {
+			return exportCollectorSamples(repo, w, strings.ToLower(*format), m.Name, from, to)
+		}
+	}
+
+	// An open end includes records stamped during the export
+	from, to, err := resolveWindow(*window, *fromFlag, *toFlag, "")
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	bw := bufio.NewWriter(out)
+	count, err := write(repo, bw, strings.ToLower(*currency), precision, from, to, nil)
+	if err != nil {
+		return fmt.Errorf("export failed after %d records: %w", count, err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if out != os.Stdout {
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("failed to close %s: %w", *output, err)
+		}
+		slog.Info("Export complete", "records", count, "output", *output)
+	} else {
+		slog.Info("Export complete", "records", count)
+	}
+	return nil
+}
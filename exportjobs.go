@@ -0,0 +1,621 @@
+package main
+
+import (
+	"bufio"         // Package for buffered file output
+	"context"       // Package for cancelling running jobs
+	"encoding/json" // Package for request bodies
+	"errors"        // Package for recognizing cancelled jobs
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for limiting request bodies
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for the job endpoints
+	"os"            // Package for environment variables and result files
+	"path/filepath" // Package for result file paths
+	"slices"        // Package for checking currencies
+	"strconv"       // Package for parsing job IDs
+	"strings"       // Package for string manipulation
+	"sync"          // Package for guarding job progress
+	"time"          // Package for ranges, heartbeats, and expiry
+)
+
+// Kinds of export job
+const (
+	exportKindPrices   = "prices"   // Stored prices written to a CSV or JSON file, as the export command does
+	exportKindBackfill = "backfill" // CoinGecko history imported, as the backfill command does
+)
+
+// States of an export job
+const (
+	exportQueued  = "queued"  // Waiting for the worker
+	exportRunning = "running" // Being worked on by a process serving the API
+	exportDone    = "done"    // Finished; a prices job's file can be downloaded
+	exportFailed  = "failed"  // Stopped by an error, given in the job
+)
+
+// Export job settings that are not configurable
+const (
+	exportHeartbeat    = 10 * time.Second // How often a running job's progress is stored
+	exportStaleAfter   = time.Minute      // A running job not updated for this long is claimed again
+	exportPollInterval = 15 * time.Second // How often the queue is checked for jobs queued elsewhere
+)
+
+// ExportJob is an export or backfill run in the background for POST /exports
+type ExportJob struct {
+	ID         int        `json:"id"`
+	Kind       string     `json:"kind"`                // exportKindPrices or exportKindBackfill
+	Format     string     `json:"format,omitempty"`    // csv, json, or parquet for prices jobs
+	Currency   string     `json:"currency,omitempty"`  // Currency covered; empty for every currency
+	Precision  *int       `json:"precision,omitempty"` // Decimal places of prices jobs' prices; nil as stored
+	From       *time.Time `json:"from,omitempty"`      // Start of the range; nil from the first record
+	To         time.Time  `json:"to"`                  // End of the range (exclusive), fixed when the job is created
+	Status     string     `json:"status"`              // One of the export states
+	Done       int64      `json:"done"`                // Work done: records written, or days backfilled
+	Total      int64      `json:"total"`               // Work expected, in the same unit as Done
+	Records    int64      `json:"records"`             // Records written or imported
+	Error      string     `json:"error,omitempty"`     // Why a failed job failed
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// path returns where a prices job's file is written
+func (job ExportJob) path() string {
+	return filepath.Join(exportJobConfig.Dir, fmt.Sprintf("export-%d.%s", job.ID, job.Format))
+}
+
+// progress returns the share of the job's work done, from 0 to 1
+func (job ExportJob) progress() float64 {
+	switch {
+	case job.Status == exportDone:
+		return 1
+	case job.Total <= 0:
+		return 0
+	}
+	return min(float64(job.Done)/float64(job.Total), 1)
+}
+
+// ExportJobConfig controls where export jobs write their files and how long they are kept
+type ExportJobConfig struct {
+	Dir string        // Directory the files of prices jobs are written to
+	TTL time.Duration // How long finished jobs and their files are kept
+}
+
+// exportJobConfig is the active configuration, loaded at startup
+var exportJobConfig = ExportJobConfig{Dir: "exports", TTL: 7 * 24 * time.Hour}
+
+// loadExportJobConfig reads EXPORT_DIR and EXPORT_TTL (e.g. 7d)
+func loadExportJobConfig() (ExportJobConfig, error) {
+	c := ExportJobConfig{Dir: os.Getenv("EXPORT_DIR"), TTL: 7 * 24 * time.Hour}
+	if c.Dir == "" {
+		c.Dir = "exports"
+	}
+	if v := os.Getenv("EXPORT_TTL"); v != "" {
+		d, err := parseStatsWindow(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid EXPORT_TTL %q (expected e.g. 1d or 7d)", v)
+		}
+		c.TTL = d
+	}
+	return c, nil
+}
+
+// exportWorker runs queued export jobs one at a time in a process serving the API
+type exportWorker struct {
+	repo *Repository   // Where the jobs are queued, set by start
+	wake chan struct{} // Signalled when a job is queued
+
+	mu      sync.Mutex
+	running map[int]context.CancelFunc // Cancels the job running here, by ID
+}
+
+// exportJobs is the process-wide worker, started with the API server
+var exportJobs = &exportWorker{wake: make(chan struct{}, 1), running: make(map[int]context.CancelFunc)}
+
+// notify tells the worker a job was queued
+func (w *exportWorker) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default: // Already told
+	}
+}
+
+// cancel stops a job running in this process; false when it isn't running here
+func (w *exportWorker) cancel(id int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cancel, ok := w.running[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// start runs the worker on the jobs of repo in the background and returns a function
+// that stops it. A job still running then is queued again, so the next process to start
+// resumes it.
+func (w *exportWorker) start(repo *Repository) func() {
+	w.repo = repo
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.loop(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// loop claims and runs jobs until ctx is cancelled, and removes the expired ones
+func (w *exportWorker) loop(ctx context.Context) {
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+	for {
+		pruneExportJobs(w.repo, time.Now())
+		for ctx.Err() == nil {
+			job, ok, err := w.repo.ClaimExportJob(time.Now().Add(-exportStaleAfter))
+			if err != nil {
+				slog.Error("Failed to claim export job", "error", err)
+				break
+			}
+			if !ok {
+				break
+			}
+			runRecovered("export job", func() error {
+				w.run(ctx, job)
+				return nil
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// run works on a claimed job, storing its progress every exportHeartbeat and its outcome
+// at the end; deleting the job meanwhile stops it
+func (w *exportWorker) run(ctx context.Context, job ExportJob) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w.mu.Lock()
+	w.running[job.ID] = cancel
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, job.ID)
+		w.mu.Unlock()
+	}()
+
+	slog.Info("Export job started", "id", job.ID, "kind", job.Kind, "currency", job.Currency)
+	job.Done, job.Records, job.Error = 0, 0, ""
+
+	// The job's progress is updated as it runs and stored by the heartbeat
+	var mu sync.Mutex
+	update := func(fn func(*ExportJob)) ExportJob {
+		mu.Lock()
+		defer mu.Unlock()
+		fn(&job)
+		return job
+	}
+	deleted := false
+	save := func() {
+		snapshot := update(func(*ExportJob) {})
+		ok, err := w.repo.UpdateExportJob(snapshot)
+		if err != nil {
+			slog.Warn("Failed to store export job progress", "id", job.ID, "error", err)
+		} else if !ok {
+			update(func(*ExportJob) { deleted = true })
+			cancel()
+		}
+	}
+	save() // Clears the progress of an earlier attempt
+	heartbeat := time.NewTicker(exportHeartbeat)
+	stopped, beating := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(beating)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-stopped:
+				return
+			case <-heartbeat.C:
+				save()
+			}
+		}
+	}()
+
+	var err error
+	switch job.Kind {
+	case exportKindPrices:
+		err = runPricesExportJob(jobCtx, w.repo, update)
+	case exportKindBackfill:
+		err = runBackfillExportJob(jobCtx, w.repo, update)
+	default:
+		err = fmt.Errorf("unknown export job kind %q", job.Kind)
+	}
+	close(stopped)
+	<-beating // No progress is stored after the outcome
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		job.Status, job.Done, job.FinishedAt = exportDone, job.Total, &now
+	case ctx.Err() != nil:
+		job.Status = exportQueued // Interrupted by shutdown; resumed by the next start
+	default:
+		job.Status, job.Error, job.FinishedAt = exportFailed, err.Error(), &now
+	}
+	if job.Status != exportDone {
+		removeExportFiles(job)
+	}
+	if !deleted {
+		ok, err := w.repo.UpdateExportJob(job)
+		if err != nil {
+			slog.Error("Failed to store export job outcome", "id", job.ID, "status", job.Status, "error", err)
+		}
+		deleted = err == nil && !ok
+	}
+	if deleted {
+		removeExportFiles(job)
+		slog.Info("Export job deleted while running", "id", job.ID)
+		return
+	}
+
+	if job.Status == exportQueued {
+		slog.Info("Export job interrupted; it resumes on the next start", "id", job.ID)
+		return
+	}
+	incCounter("tracker_export_jobs_total", map[string]string{"kind": job.Kind, "status": job.Status}, 1)
+	if job.Status == exportDone {
+		slog.Info("Export job done", "id", job.ID, "kind", job.Kind, "records", job.Records)
+	} else {
+		slog.Error("Export job failed", "id", job.ID, "kind", job.Kind, "error", err)
+	}
+}
+
+// runPricesExportJob writes a prices job's records to a temporary file and moves it into
+// place once it is complete, so an unfinished file is never served
+func runPricesExportJob(ctx context.Context, repo *Repository, update func(func(*ExportJob)) ExportJob) error {
+	job := update(func(*ExportJob) {})
+	write, ok := exportFormats[job.Format]
+	if !ok {
+		return fmt.Errorf("unknown export format %q", job.Format)
+	}
+	from := time.Time{}
+	if job.From != nil {
+		from = *job.From
+	}
+
+	total, err := repo.CountPrices(ctx, job.Currency, from, job.To)
+	if err != nil {
+		return err
+	}
+	update(func(j *ExportJob) { j.Total = total })
+
+	if err := os.MkdirAll(exportJobConfig.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", exportJobConfig.Dir, err)
+	}
+	part := job.path() + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", part, err)
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	precision := noPrecision
+	if job.Precision != nil {
+		precision = *job.Precision
+	}
+	count, err := write(repo, bw, job.Currency, precision, from, job.To, func(records int) error {
+		update(func(j *ExportJob) { j.Done, j.Records = int64(records), int64(records) })
+		return ctx.Err()
+	})
+	if err != nil {
+		return fmt.Errorf("export failed after %d records: %w", count, err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", part, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", part, err)
+	}
+	if err := os.Rename(part, job.path()); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", part, err)
+	}
+	return nil
+}
+
+// runBackfillExportJob imports a backfill job's history, counting its progress in days
+// of history per currency
+func runBackfillExportJob(ctx context.Context, repo *Repository, update func(func(*ExportJob)) ExportJob) error {
+	job := update(func(*ExportJob) {})
+	list := currencies
+	if job.Currency != "" {
+		list = []string{job.Currency}
+	}
+	days := int64(job.To.Sub(*job.From).Hours()/24) + 1
+	update(func(j *ExportJob) { j.Total = days * int64(len(list)) })
+
+	n, err := backfillCurrencies(ctx, repo, list, *job.From, job.To, func(currency string, through time.Time) {
+		done := int64(slices.Index(list, currency))*days + int64(through.Sub(*job.From).Hours()/24)
+		update(func(j *ExportJob) { j.Done = done })
+	})
+	update(func(j *ExportJob) { j.Records = int64(n) })
+	return err
+}
+
+// removeExportFiles deletes whatever file a job left behind
+func removeExportFiles(job ExportJob) {
+	if job.Kind != exportKindPrices {
+		return
+	}
+	for _, path := range []string{job.path(), job.path() + ".part"} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to remove export file", "path", path, "error", err)
+		}
+	}
+}
+
+// pruneExportJobs deletes the jobs that finished more than EXPORT_TTL ago, and their files
+func pruneExportJobs(repo *Repository, now time.Time) {
+	jobs, err := repo.ExpiredExportJobs(now.Add(-exportJobConfig.TTL))
+	if err != nil {
+		slog.Error("Failed to query expired export jobs", "error", err)
+		return
+	}
+	for _, job := range jobs {
+		removeExportFiles(job)
+		if err := repo.DeleteExportJob(job.ID); err != nil {
+			slog.Error("Failed to delete expired export job", "id", job.ID, "error", err)
+			continue
+		}
+		slog.Info("Deleted expired export job", "id", job.ID, "finished", job.FinishedAt)
+	}
+}
+
+// exportJobRequest asks for a job from POST /exports
+type exportJobRequest struct {
+	Kind      string     `json:"kind,omitempty"`     // prices (default) or backfill
+	Format    string     `json:"format,omitempty"`   // csv (default) or json, for prices jobs
+	Currency  string     `json:"currency,omitempty"` // Currency covered; empty for every currency
+	Precision *int       `json:"precision"`          // Decimal places of the prices, for prices jobs
+	From      *time.Time `json:"from"`               // Start of the range; required for backfills
+	To        *time.Time `json:"to"`                 // End of the range; now when omitted
+	Window    string     `json:"window,omitempty"`   // The range as a window, e.g. 7d or 2024-03, instead of from and to
+}
+
+// job validates the request and returns the job it asks for
+func (req exportJobRequest) job(now time.Time) (ExportJob, error) {
+	job := ExportJob{
+		Kind:      strings.ToLower(req.Kind),
+		Format:    strings.ToLower(req.Format),
+		Currency:  strings.ToLower(req.Currency),
+		Precision: req.Precision,
+		From:      req.From,
+		To:        now,
+		CreatedAt: now,
+	}
+	if job.Currency != "" && !slices.Contains(currencies, job.Currency) {
+		return job, fmt.Errorf("currency %q is not tracked", req.Currency)
+	}
+	if req.To != nil {
+		job.To = *req.To
+	}
+	if req.Window != "" {
+		if req.From != nil || req.To != nil {
+			return job, fmt.Errorf("use either window or from/to, not both")
+		}
+		from, to, err := parseWindow(req.Window, now)
+		if err != nil {
+			return job, err
+		}
+		job.From, job.To = &from, windowEnd(to, now)
+	}
+
+	switch job.Kind {
+	case "", exportKindPrices:
+		job.Kind = exportKindPrices
+		if job.Format == "" {
+			job.Format = "csv"
+		}
+		if _, ok := exportFormats[job.Format]; !ok {
+			return job, fmt.Errorf("invalid format %q (expected csv, json, or parquet)", req.Format)
+		}
+		if p := job.Precision; p != nil && (*p < 0 || *p > widestPriceScale()) {
+			return job, fmt.Errorf("invalid precision %d (expected 0 to %d decimal places)", *p, widestPriceScale())
+		}
+	case exportKindBackfill:
+		if job.Format != "" || job.Precision != nil {
+			return job, fmt.Errorf("backfill jobs take no format or precision")
+		}
+		if job.From == nil {
+			return job, fmt.Errorf("backfill jobs need from")
+		}
+		if job.To.After(now) {
+			job.To = now
+		}
+	default:
+		return job, fmt.Errorf("unknown kind %q (expected prices or backfill)", req.Kind)
+	}
+
+	if job.From != nil {
+		from := job.From.UTC()
+		job.From = &from
+		if !job.To.After(from) {
+			return job, fmt.Errorf("the range must end after it starts")
+		}
+	}
+	job.To = job.To.UTC()
+	return job, nil
+}
+
+// exportJobView is a job as the API returns it
+type exportJobView struct {
+	ExportJob
+	Progress float64 `json:"progress"`           // Share of the work done, from 0 to 1
+	Download string  `json:"download,omitempty"` // Where the file of a done prices job is served
+}
+
+// newExportJobView returns the view of a job, with links based on the request
+func newExportJobView(r *http.Request, job ExportJob) exportJobView {
+	view := exportJobView{ExportJob: job, Progress: job.progress()}
+	if job.Kind == exportKindPrices && job.Status == exportDone {
+		view.Download = fmt.Sprintf("%s/exports/%d/download", requestBaseURL(r), job.ID)
+	}
+	return view
+}
+
+// handleExports serves the export job endpoints:
+//
+//	POST   /exports                  queue a job
+//	GET    /exports?limit=N          list the newest jobs
+//	GET    /exports/{id}             a job's status and progress
+//	GET    /exports/{id}/download    the file of a done prices job
+//	DELETE /exports/{id}             cancel a job and delete it with its file
+func (s *apiServer) handleExports(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/exports"), "/")
+	if rest == "" {
+		switch r.Method {
+		case http.MethodPost:
+			s.handleCreateExportJob(w, r)
+		case http.MethodGet:
+			s.handleListExportJobs(w, r)
+		default:
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	idText, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(idText)
+	if err != nil || (action != "" && action != "download") {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	job, ok, err := s.repo.ExportJob(id)
+	if err != nil {
+		slog.Error("API failed to fetch export job", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query export job")
+		return
+	}
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "no export job with id %d", id)
+		return
+	}
+
+	switch {
+	case action == "download" && r.Method == http.MethodGet:
+		serveExportFile(w, r, job)
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, newExportJobView(r, job))
+	case action == "" && r.Method == http.MethodDelete:
+		exportJobs.cancel(job.ID)
+		if err := s.repo.DeleteExportJob(job.ID); err != nil {
+			slog.Error("API failed to delete export job", "path", r.URL.Path, "error", err)
+			writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to delete export job")
+			return
+		}
+		removeExportFiles(job)
+		slog.Info("Deleted export job", "id", job.ID, "status", job.Status)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleCreateExportJob serves POST /exports
+func (s *apiServer) handleCreateExportJob(w http.ResponseWriter, r *http.Request) {
+	var req exportJobRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<12)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid export request: %v", err)
+		return
+	}
+	job, err := req.job(time.Now().Truncate(time.Second))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if job.Kind == exportKindBackfill && !writesAuthenticated() {
+		writeAPIError(w, http.StatusForbidden, "backfill jobs need API_AUTH=writes or API_AUTH=all, or passkeys (PASSKEY_RP_ID)")
+		return
+	}
+
+	job.ID, err = s.repo.SaveExportJob(job)
+	if err != nil {
+		slog.Error("API failed to save export job", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to queue export job")
+		return
+	}
+	job.Status, job.UpdatedAt = exportQueued, job.CreatedAt
+	exportJobs.notify()
+
+	slog.Info("Queued export job", "id", job.ID, "kind", job.Kind, "format", job.Format, "currency", job.Currency, "to", job.To)
+	w.Header().Set("Location", fmt.Sprintf("/exports/%d", job.ID))
+	writeJSON(w, http.StatusAccepted, newExportJobView(r, job))
+}
+
+// handleListExportJobs serves GET /exports?limit=N
+func (s *apiServer) handleListExportJobs(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxRangeLimit {
+			writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and %d", maxRangeLimit)
+			return
+		}
+	}
+
+	jobs, err := s.repo.ExportJobs(limit)
+	if err != nil {
+		slog.Error("API failed to fetch export jobs", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query export jobs")
+		return
+	}
+	views := make([]exportJobView, len(jobs)) // Encode no jobs as [] rather than null
+	for i, job := range jobs {
+		views[i] = newExportJobView(r, job)
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// serveExportFile serves the file of a done prices job; ranges let a client resume a
+// broken download
+func serveExportFile(w http.ResponseWriter, r *http.Request, job ExportJob) {
+	if job.Kind != exportKindPrices {
+		writeAPIError(w, http.StatusNotFound, "%s jobs have no file", job.Kind)
+		return
+	}
+	if job.Status != exportDone {
+		writeAPIError(w, http.StatusConflict, "export job %d is %s (%.0f%% done)", job.ID, job.Status, job.progress()*100)
+		return
+	}
+	f, err := os.Open(job.path())
+	if errors.Is(err, os.ErrNotExist) {
+		writeAPIError(w, http.StatusNotFound, "the file of export job %d is not in EXPORT_DIR of this server", job.ID)
+		return
+	}
+	if err != nil {
+		slog.Error("API failed to open export file", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to open export file")
+		return
+	}
+	defer f.Close()
+
+	contentType := "text/csv"
+	switch job.Format {
+	case "json":
+		contentType = "application/json"
+	case "parquet":
+		contentType = "application/vnd.apache.parquet"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="bitcoin-prices-%d.%s"`, job.ID, job.Format))
+	http.ServeContent(w, r, "", *job.FinishedAt, f)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"  // Package for the database calls
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"strconv"  // Package for parsing ATH_ALERTS
+	"strings"  // Package for string manipulation
+	"sync"     // Package for guarding the notification times
+	"time"     // Package for timestamps
+)
+
+// The all-time high and low of every coin and currency are kept in price_extremes.
+// They are seeded from the stored prices, backfilled history included, the first time
+// a currency is fetched and again after a backfill, and then moved by every fetch that
+// passes them. A fetch that sets a new high publishes a price.ath event and, with
+// ATH_ALERTS (on by default), notifies through the alert channels at most once per
+// ALERT_COOLDOWN; a new low publishes a price.atl event. `stats` and GET /stats show
+// both with the distance of the current price from them.
+
+// Event types of new all-time extremes
+const (
+	EventPriceATH = "price.ath" // A price above the all-time high was stored
+	EventPriceATL = "price.atl" // A price below the all-time low was stored
+)
+
+// AlertATH alerts fire when the price sets a new all-time high
+// They come from the price extremes rather than from stored rules.
+const AlertATH = "ath"
+
+// PriceExtremes are the all-time high and low of a coin in a currency
+type PriceExtremes struct {
+	Coin     string    `json:"coin"`
+	Currency string    `json:"currency"`
+	High     float64   `json:"ath"`
+	HighAt   time.Time `json:"ath_at"`
+	Low      float64   `json:"atl"`
+	LowAt    time.Time `json:"atl_at"`
+}
+
+// PriceExtremeEventData is the payload of price.ath and price.atl events
+type PriceExtremeEventData struct {
+	Coin       string    `json:"coin"`
+	Currency   string    `json:"currency"`
+	Price      float64   `json:"price"`
+	Previous   float64   `json:"previous"`    // The extreme the price passed
+	PreviousAt time.Time `json:"previous_at"` // When that extreme was set
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// athAlerts is whether new all-time highs notify, configured via ATH_ALERTS
+var athAlerts = true
+
+// athNotified is when each currency's last new high notified, for the cooldown
+var athNotified = struct {
+	sync.Mutex
+	at map[string]time.Time
+}{at: make(map[string]time.Time)}
+
+// loadATHAlerts reads ATH_ALERTS (true or false)
+func loadATHAlerts() (bool, error) {
+	v := os.Getenv("ATH_ALERTS")
+	if v == "" {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return true, fmt.Errorf("invalid ATH_ALERTS %q", v)
+	}
+	return b, nil
+}
+
+// trackPriceExtremes moves the all-time extremes the new prices pass, announcing each
+// new one; a currency seen for the first time is seeded from the stored prices instead
+func trackPriceExtremes(ctx context.Context, repo *Repository, prices map[string]float64) {
+	stored, err := repo.PriceExtremes(ctx)
+	if err != nil {
+		slog.Error("Failed to load all-time highs and lows", "error", err)
+		return
+	}
+	byCurrency := make(map[string]PriceExtremes, len(stored))
+	for _, e := range stored {
+		if e.Coin == "bitcoin" {
+			byCurrency[e.Currency] = e
+		}
+	}
+
+	now := time.Now().UTC()
+	for currency, price := range prices {
+		e, ok := byCurrency[currency]
+		if !ok {
+			if err := seedPriceExtremes(ctx, repo, currency); err != nil {
+				slog.Error("Failed to seed all-time high and low", "currency", currency, "error", err)
+			}
+			continue
+		}
+
+		prev := e
+		switch {
+		case price > e.High:
+			e.High, e.HighAt = price, now
+		case price < e.Low:
+			e.Low, e.LowAt = price, now
+		default:
+			continue
+		}
+		if err := repo.SavePriceExtremes(ctx, e); err != nil {
+			slog.Error("Failed to store all-time high and low", "currency", currency, "error", err)
+			continue
+		}
+		setExtremeGauges(e)
+		if e.High != prev.High {
+			announceExtreme(repo, EventPriceATH, price, prev.High, prev.HighAt, e, now)
+		} else {
+			announceExtreme(repo, EventPriceATL, price, prev.Low, prev.LowAt, e, now)
+		}
+	}
+}
+
+// announceExtreme publishes a new all-time high or low, and notifies of a high
+func announceExtreme(repo *Repository, eventType string, price, previous float64, previousAt time.Time, e PriceExtremes, now time.Time) {
+	slog.Info("New all-time extreme", "coin", e.Coin, "currency", e.Currency, "event", eventType,
+		"price", price, "previous", previous, "previous_at", previousAt.Format(time.RFC3339))
+	publishEvent(repo, newEvent(eventType, e.Coin+"/"+e.Currency, PriceExtremeEventData{
+		Coin: e.Coin, Currency: e.Currency, Price: price, Previous: previous, PreviousAt: previousAt, Timestamp: now,
+	}))
+	incCounter("tracker_price_extremes_total", map[string]string{"currency": e.Currency, "kind": strings.TrimPrefix(eventType, "price.")}, 1)
+	if eventType != EventPriceATH || !athAlerts {
+		return
+	}
+
+	// A rally sets a new high on fetch after fetch, so they share the cooldown of a rule
+	athNotified.Lock()
+	last, ok := athNotified.at[e.Currency]
+	notify := !ok || now.Sub(last) >= alertCooldown
+	if notify {
+		athNotified.at[e.Currency] = now
+	}
+	athNotified.Unlock()
+	if !notify {
+		slog.Info("New all-time high within the alert cooldown, notification suppressed", "currency", e.Currency, "price", price)
+		return
+	}
+	fireAlert(repo, Alert{
+		Rule:   AlertRule{Kind: AlertATH, Threshold: previous, Currency: e.Currency},
+		Price:  price,
+		Change: percentChange(previous, price),
+		Time:   now,
+	})
+}
+
+// seedPriceExtremes sets the all-time high and low of currency from the stored prices,
+// keeping stored extremes the prices no longer reach, e.g. after retention purged them
+func seedPriceExtremes(ctx context.Context, repo *Repository, currency string) error {
+	seeded, ok, err := repo.HistoricalPriceExtremes(ctx, currency)
+	if err != nil || !ok {
+		return err
+	}
+	seeded.Coin, seeded.Currency = "bitcoin", currency
+
+	stored, err := repo.PriceExtremes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range stored {
+		if e.Coin != seeded.Coin || e.Currency != currency {
+			continue
+		}
+		if e.High >= seeded.High {
+			seeded.High, seeded.HighAt = e.High, e.HighAt
+		}
+		if e.Low <= seeded.Low {
+			seeded.Low, seeded.LowAt = e.Low, e.LowAt
+		}
+	}
+	if err := repo.SavePriceExtremes(ctx, seeded); err != nil {
+		return err
+	}
+	setExtremeGauges(seeded)
+	slog.Info("Seeded all-time high and low from stored prices", "coin", seeded.Coin, "currency", currency,
+		"ath", seeded.High, "ath_at", seeded.HighAt.Format(time.RFC3339), "atl", seeded.Low, "atl_at", seeded.LowAt.Format(time.RFC3339))
+	return nil
+}
+
+// setExtremeGauges exports the all-time high and low of a currency
+func setExtremeGauges(e PriceExtremes) {
+	setGauge("tracker_price_ath", map[string]string{"currency": e.Currency}, e.High)
+	setGauge("tracker_price_atl", map[string]string{"currency": e.Currency}, e.Low)
+}
+
+// currencyExtremes returns the stored all-time high and low of currency; nil when
+// they haven't been seeded yet
+func currencyExtremes(ctx context.Context, repo *Repository, currency string) (*PriceExtremes, error) {
+	stored, err := repo.PriceExtremes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range stored {
+		if e.Coin == "bitcoin" && e.Currency == currency {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+// formatExtreme renders an extreme with its date and the current price's distance from
+// it, e.g. "73,750.00 on 2024-03-14 (-12.40%)"
+func formatExtreme(price float64, at time.Time, current float64) string {
+	text := formatPrice(price) + " on " + at.In(displayLocation).Format("2006-01-02")
+	if current > 0 {
+		text += fmt.Sprintf(" (%+.2f%%)", percentChange(price, current))
+	}
+	return text
+}
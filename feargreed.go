@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"  // Package for fetching readings within a deadline
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for rounding the mean
+	"net/url"  // Package for building the request query
+	"os"       // Package for environment variables
+	"strconv"  // Package for parsing the index values
+	"strings"  // Package for string manipulation
+	"time"     // Package for the days of the readings
+)
+
+// With FEAR_GREED, a scheduler job collects the Crypto Fear & Greed index from
+// alternative.me once a day into the fear_greed table, one reading per UTC day. The
+// index is a market-wide sentiment score from 0 (extreme fear) to 100 (extreme greed);
+// stats and the daily summary show it next to the prices of the same days.
+
+// fearGreedSource is the provider of the index, as named in budgets and attribution
+const fearGreedSource = "alternative.me"
+
+// fearGreedURL is the index endpoint; limit is the number of days returned, newest first
+const fearGreedURL = "https://api.alternative.me/fng/"
+
+// fearGreedDefaultSchedule collects the index shortly after alternative.me publishes
+// the new day's value at midnight UTC
+const fearGreedDefaultSchedule = "CRON_TZ=UTC 10 0 * * *"
+
+// FearGreedReading is the index value of one UTC day
+type FearGreedReading struct {
+	Day            time.Time `json:"day"`            // Midnight UTC of the day
+	Value          int       `json:"value"`          // 0 (extreme fear) to 100 (extreme greed)
+	Classification string    `json:"classification"` // Label of the value, e.g. "Greed"
+}
+
+// FearGreedStats summarizes the index readings of a stats window
+type FearGreedStats struct {
+	Samples        int     `json:"samples"` // Days with a reading
+	Mean           float64 `json:"mean"`
+	Min            int     `json:"min"`
+	Max            int     `json:"max"`
+	Last           int     `json:"last"`           // Newest reading in the window
+	Classification string  `json:"classification"` // Label of the newest reading
+}
+
+// FearGreedConfig controls the index collector
+type FearGreedConfig struct {
+	Enabled bool // FEAR_GREED
+	History int  // Days fetched when none of the recent ones are stored; 0 fetches them all
+}
+
+// fearGreedConfig is the active configuration, loaded at startup
+var fearGreedConfig = FearGreedConfig{History: 30}
+
+// loadFearGreedConfig reads FEAR_GREED (default false) and FEAR_GREED_HISTORY (default 30)
+func loadFearGreedConfig() (FearGreedConfig, error) {
+	c := FearGreedConfig{History: 30}
+	if v := os.Getenv("FEAR_GREED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid FEAR_GREED %q", v)
+		}
+		c.Enabled = b
+	}
+	if v := os.Getenv("FEAR_GREED_HISTORY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return c, fmt.Errorf("invalid FEAR_GREED_HISTORY %q (expected a number of days, or 0 for all of them)", v)
+		}
+		c.History = n
+	}
+	return c, nil
+}
+
+// fearGreedDay returns midnight UTC of the day t falls on
+func fearGreedDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// fetchFearGreed fetches the readings of the newest limit days; 0 fetches every day
+// alternative.me has
+func fetchFearGreed(ctx context.Context, repo *Repository, limit int) ([]FearGreedReading, error) {
+	var result struct {
+		Data []struct {
+			Value          string `json:"value"`
+			Classification string `json:"value_classification"`
+			Timestamp      string `json:"timestamp"` // Unix seconds of the day's midnight UTC
+		} `json:"data"`
+		Metadata struct {
+			Error *string `json:"error"`
+		} `json:"metadata"`
+	}
+	query := url.Values{"limit": {strconv.Itoa(limit)}, "format": {"json"}}
+	if err := getJSON(ctx, repo, fearGreedSource, "fear_greed", fearGreedURL+"?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+	if result.Metadata.Error != nil && *result.Metadata.Error != "" {
+		return nil, withKind(KindProvider, fmt.Errorf("%s error: %s", fearGreedSource, *result.Metadata.Error))
+	}
+
+	readings := make([]FearGreedReading, 0, len(result.Data))
+	for _, d := range result.Data {
+		value, err := strconv.Atoi(d.Value)
+		if err != nil || value < 0 || value > 100 {
+			return nil, withKind(KindProvider, fmt.Errorf("%s returned an invalid index value %q", fearGreedSource, d.Value))
+		}
+		seconds, err := strconv.ParseInt(d.Timestamp, 10, 64)
+		if err != nil {
+			return nil, withKind(KindProvider, fmt.Errorf("%s returned an invalid timestamp %q", fearGreedSource, d.Timestamp))
+		}
+		readings = append(readings, FearGreedReading{
+			Day:            fearGreedDay(time.Unix(seconds, 0)),
+			Value:          value,
+			Classification: d.Classification,
+		})
+	}
+	return readings, nil
+}
+
+// collectFearGreed fetches the days since the newest stored reading, or
+// FEAR_GREED_HISTORY days when none of them are stored, and returns how many readings
+// it stored. The newest stored day is fetched again, in case its value was revised.
+func collectFearGreed(ctx context.Context, repo *Repository) (int, error) {
+	cfg := fearGreedConfig
+	today := fearGreedDay(time.Now())
+	limit := cfg.History
+	if cfg.History > 0 {
+		stored, err := repo.FearGreedRange(ctx, today.AddDate(0, 0, -cfg.History), today.AddDate(0, 0, 1))
+		if err != nil {
+			return 0, err
+		}
+		if len(stored) > 0 {
+			limit = int(today.Sub(stored[len(stored)-1].Day)/(24*time.Hour)) + 1
+		}
+	}
+
+	readings, err := fetchFearGreed(ctx, repo, limit)
+	result := "ok"
+	if err == nil {
+		err = repo.SaveFearGreed(ctx, readings)
+	}
+	if err != nil {
+		result = "error"
+	}
+	incCounter("tracker_fear_greed_fetches_total", map[string]string{"result": result}, 1)
+	if err != nil {
+		return 0, fmt.Errorf("failed to collect the fear and greed index: %w", err)
+	}
+	return len(readings), nil
+}
+
+// runScheduledFearGreed collects the index on the scheduler's timer
+// Failures are logged; the next run fetches the days this one missed
+func runScheduledFearGreed(ctx context.Context, repo *Repository) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	n, err := collectFearGreed(ctx, repo)
+	if err != nil {
+		slog.Error("Failed to collect fear and greed index", "error", err)
+		return
+	}
+	slog.Info("Collected fear and greed index", "readings", n)
+}
+
+// fearGreedStats returns the index readings of the days a stats window touches; nil
+// when FEAR_GREED is off or none are stored
+func fearGreedStats(ctx context.Context, repo *Repository, from, to time.Time) (*FearGreedStats, error) {
+	if !fearGreedConfig.Enabled {
+		return nil, nil
+	}
+	stats, err := repo.FearGreedStats(ctx, fearGreedDay(from), to)
+	if err != nil || stats.Samples == 0 {
+		return nil, err
+	}
+	stats.Mean = math.Round(stats.Mean*10) / 10
+	return &stats, nil
+}
+
+// latestFearGreed returns the reading of the day at falls on, or else of the day
+// before; false when neither is stored
+func latestFearGreed(ctx context.Context, repo *Repository, at time.Time) (FearGreedReading, bool, error) {
+	readings, err := repo.FearGreedRange(ctx, fearGreedDay(at).AddDate(0, 0, -1), at)
+	if err != nil || len(readings) == 0 {
+		return FearGreedReading{}, false, err
+	}
+	return readings[len(readings)-1], true, nil
+}
+
+// formatFearGreed formats a window's readings for the stats table, e.g.
+// "avg 48.5, last 72 (Greed)"; "-" without readings
+func formatFearGreed(stats *FearGreedStats) string {
+	if stats == nil {
+		return "-"
+	}
+	return fmt.Sprintf("avg %.1f, last %d (%s)", stats.Mean, stats.Last, stats.Classification)
+}
+
+// runFearGreedCommand handles "fear-greed [--fetch] [--days 30]"
+// It lists the stored readings of the last days, newest first; --fetch collects first
+func runFearGreedCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("fear-greed")
+	fetch := fs.Bool("fetch", false, "Collect the readings missing since the newest stored one first")
+	days := fs.Int("days", 30, "Number of days to list")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if *days <= 0 {
+		return validationErrorf("--days must be positive")
+	}
+
+	if *fetch {
+		n, err := collectFearGreed(ctx, repo)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Stored %d readings from %s\n", n, fearGreedSource)
+	}
+	today := fearGreedDay(time.Now())
+	readings, err := repo.FearGreedRange(ctx, today.AddDate(0, 0, 1-*days), today.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	if len(readings) == 0 {
+		fmt.Println("No fear and greed readings stored yet; run fear-greed --fetch or set FEAR_GREED")
+		return nil
+	}
+
+	fmt.Printf("\n%-12s %-6s %s\n", "Day", "Value", "Classification")
+	fmt.Println("--------------------------------------------------------------")
+	for i := len(readings) - 1; i >= 0; i-- {
+		r := readings[i]
+		fmt.Printf("%-12s %-6d %-15s %s\n", r.Day.Format("2006-01-02"), r.Value, r.Classification, strings.Repeat("█", r.Value/5))
+	}
+	if attributionEnabled {
+		fmt.Printf("\n%s\n", attributionText(attributionsFor([]string{fearGreedSource})))
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"      // Package for feed queries
+	"encoding/xml" // Package for encoding Atom and RSS documents
+	"fmt"          // Package for formatted I/O operations
+	"math"         // Package for picking milestone steps
+	"net/http"     // Package for the feed endpoint
+	"os"           // Package for environment variables
+	"slices"       // Package for ordering entries
+	"strconv"      // Package for parsing milestone steps
+	"strings"      // Package for string manipulation
+	"time"         // Package for feed windows
+)
+
+// FeedConfig controls the Atom/RSS feed of price milestones and daily summaries
+type FeedConfig struct {
+	Window     time.Duration      // How far back the feed reaches
+	Milestones map[string]float64 // Milestone step per currency, e.g. 5000 for every $5,000; derived from the price when not listed
+}
+
+// feedConfig is the active configuration, loaded at startup
+var feedConfig = FeedConfig{Window: 7 * 24 * time.Hour}
+
+// feedMaxEntries is the most entries a feed document holds, newest first
+const feedMaxEntries = 50
+
+// milestoneQuietPeriod is how long a crossing of a level in one direction isn't
+// reported again, so a price hovering at a round number doesn't flood the feed
+const milestoneQuietPeriod = 24 * time.Hour
+
+// loadFeedConfig reads FEED_WINDOW (e.g. 7d) and FEED_MILESTONES (e.g. "usd=5000,eur=5000")
+func loadFeedConfig() (FeedConfig, error) {
+	c := FeedConfig{Window: 7 * 24 * time.Hour, Milestones: make(map[string]float64)}
+	if v := os.Getenv("FEED_WINDOW"); v != "" {
+		d, err := parseStatsWindow(v)
+		if err != nil || d > 90*24*time.Hour {
+			return c, fmt.Errorf("invalid FEED_WINDOW %q (expected up to 90d, e.g. 7d)", v)
+		}
+		c.Window = d
+	}
+	if v := os.Getenv("FEED_MILESTONES"); v != "" {
+		for _, pair := range strings.Split(v, ",") {
+			currency, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			step, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if !ok || err != nil || step <= 0 {
+				return c, fmt.Errorf("invalid FEED_MILESTONES entry %q (expected currency=step, e.g. usd=5000)", pair)
+			}
+			c.Milestones[strings.ToLower(strings.TrimSpace(currency))] = step
+		}
+	}
+	return c, nil
+}
+
+// milestoneStep returns the spacing of the round numbers reported for currency
+// Without a configured step it is half the price's order of magnitude, e.g. every
+// 5,000 at 65,000 USD or every 500,000 at 9,800,000 JPY.
+func (c FeedConfig) milestoneStep(currency string, price float64) float64 {
+	if step, ok := c.Milestones[currency]; ok {
+		return step
+	}
+	if price <= 0 {
+		return 0
+	}
+	return 5 * math.Pow(10, math.Floor(math.Log10(price))-1)
+}
+
+// FeedEntry is one item of the feed
+type FeedEntry struct {
+	ID        string
+	Title     string
+	Content   string
+	Published time.Time
+}
+
+// PriceMilestone is a round number one hourly close crossed from the previous one
+type PriceMilestone struct {
+	Currency string
+	Level    float64
+	Up       bool
+	Price    float64   // Close that crossed it
+	At       time.Time // Close of the candle; later than now while it is still open
+}
+
+// findMilestones returns the round numbers the hourly closes of currency crossed since
+// from, oldest first. A candle that crosses several reports the furthest one.
+func findMilestones(ctx context.Context, repo *Repository, currency string, from time.Time) ([]PriceMilestone, error) {
+	candles, err := repo.Candles(ctx, currency, CandleHourly, from, time.Time{}, maxRangeLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var milestones []PriceMilestone
+	last := make(map[string]time.Time) // Latest report of each level and direction
+	for i := 1; i < len(candles); i++ {
+		prev, cur := candles[i-1].Close, candles[i].Close
+		step := feedConfig.milestoneStep(currency, prev)
+		if step == 0 {
+			continue
+		}
+		m := PriceMilestone{Currency: currency, Price: cur, At: candles[i].Start.Add(time.Hour)}
+		switch {
+		case math.Floor(cur/step) > math.Floor(prev/step):
+			m.Up, m.Level = true, math.Floor(cur/step)*step
+		case math.Floor(cur/step) < math.Floor(prev/step):
+			m.Level = math.Floor(cur/step)*step + step
+		default:
+			continue
+		}
+
+		key := fmt.Sprintf("%g/%t", m.Level, m.Up)
+		if at, ok := last[key]; ok && m.At.Sub(at) < milestoneQuietPeriod {
+			continue
+		}
+		last[key] = m.At
+		milestones = append(milestones, m)
+	}
+	return milestones, nil
+}
+
+// milestoneEntry turns a milestone into a feed entry
+func milestoneEntry(m PriceMilestone) FeedEntry {
+	key, direction := "feed.milestone_down", "down"
+	if m.Up {
+		key, direction = "feed.milestone_up", "up"
+	}
+	data := map[string]interface{}{"Currency": m.Currency, "Level": m.Level, "Price": m.Price}
+	published := m.At
+	if now := time.Now().UTC(); published.After(now) {
+		published = now
+	}
+	return FeedEntry{
+		ID:        fmt.Sprintf("urn:bitcoin-tracker:milestone:%s:%g:%s:%d", m.Currency, m.Level, direction, m.At.Unix()),
+		Title:     renderMessage(defaultLocale, key, data),
+		Content:   renderMessage(defaultLocale, "price.latest", data),
+		Published: published,
+	}
+}
+
+// summaryTimes returns the times daily summaries were due in (from, now], newest first:
+// SUMMARY_TIME in SUMMARY_TIMEZONE, or midnight there when no summary is scheduled
+func summaryTimes(from, now time.Time) []time.Time {
+	loc := summaryConfig.Location
+	local := now.In(loc)
+	at := time.Date(local.Year(), local.Month(), local.Day(), summaryConfig.Hour, summaryConfig.Minute, 0, 0, loc)
+	var times []time.Time
+	for ; at.After(from); at = at.AddDate(0, 0, -1) {
+		if !at.After(now) {
+			times = append(times, at)
+		}
+	}
+	return times
+}
+
+// summaryEntry builds the daily summary ending at to as a feed entry; ok is false when
+// none of the currencies had prices that day
+func summaryEntry(repo *Repository, currencies []string, to time.Time) (entry FeedEntry, ok bool, err error) {
+	var lines, sources []string
+	for _, currency := range currencies {
+		s, err := buildDailySummary(repo, currency, to)
+		if err != nil {
+			return entry, false, err
+		}
+		key := "summary.daily"
+		if s.Samples == 0 {
+			key = "summary.nodata"
+		} else {
+			ok = true
+		}
+		lines = append(lines, renderMessage(defaultLocale, key, s))
+		sources = append(sources, s.Sources...)
+	}
+	if footer := summaryFooter(sources); footer != "" {
+		lines = append(lines, footer)
+	}
+	date := to.In(summaryConfig.Location).Format("2006-01-02")
+	return FeedEntry{
+		ID:        "urn:bitcoin-tracker:summary:" + date,
+		Title:     renderMessage(defaultLocale, "summary.title", map[string]interface{}{"Date": date}),
+		Content:   strings.Join(lines, "\n"),
+		Published: to,
+	}, ok, nil
+}
+
+// buildFeed returns the milestone and daily summary entries of currencies in the
+// window ending now, newest first
+func buildFeed(ctx context.Context, repo *Repository, currencies []string, now time.Time) ([]FeedEntry, error) {
+	from := now.Add(-feedConfig.Window)
+	var entries []FeedEntry
+	for _, currency := range currencies {
+		milestones, err := findMilestones(ctx, repo, currency, from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find %s milestones: %w", strings.ToUpper(currency), err)
+		}
+		for _, m := range milestones {
+			entries = append(entries, milestoneEntry(m))
+		}
+	}
+	for _, to := range summaryTimes(from, now) {
+		entry, ok, err := summaryEntry(repo, currencies, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build daily summary: %w", err)
+		}
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	slices.SortStableFunc(entries, func(a, b FeedEntry) int { return b.Published.Compare(a.Published) })
+	if len(entries) > feedMaxEntries {
+		entries = entries[:feedMaxEntries]
+	}
+	return entries, nil
+}
+
+// atomFeed is an Atom 1.0 document (RFC 4287)
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomLink is a link of an Atom feed or entry
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// atomAuthor is the author of an Atom feed
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// atomEntry is an entry of an Atom feed
+type atomEntry struct {
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Updated   string   `xml:"updated"`
+	Published string   `xml:"published"`
+	Link      atomLink `xml:"link"`
+	Content   string   `xml:"content"`
+}
+
+// rssFeed is an RSS 2.0 document
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rssChannel is the channel of an RSS document
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssItem is an item of an RSS channel
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+// rssGUID is the identifier of an RSS item; the feed's are URNs, not links
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// feedTitle is the title of the feed
+const feedTitle = "Bitcoin price milestones and daily summaries"
+
+// handleFeed serves GET /feed (Atom) and /feed?format=rss (RSS 2.0), optionally for one ?currency
+func (s *apiServer) handleFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "atom" && format != "rss" {
+		writeAPIError(w, http.StatusBadRequest, "format must be atom or rss")
+		return
+	}
+	list := currencies
+	if r.URL.Query().Get("currency") != "" {
+		list = []string{requestCurrency(r)}
+	}
+
+	ctx, cancel := withAnalyticsTimeout(r.Context())
+	defer cancel()
+	now := time.Now().UTC()
+	entries, err := buildFeed(ctx, s.repo, list, now)
+	if err != nil {
+		writeAnalyticsError(w, r, "feed", err)
+		return
+	}
+
+	base := requestBaseURL(r)
+	self := base + r.URL.RequestURI()
+	updated := now
+	if len(entries) > 0 {
+		updated = entries[0].Published
+	}
+
+	var doc interface{}
+	if format == "rss" {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		feed := rssFeed{Version: "2.0", Channel: rssChannel{
+			Title: feedTitle, Link: base + "/", Description: feedTitle,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+		}}
+		for _, e := range entries {
+			feed.Channel.Items = append(feed.Channel.Items, rssItem{
+				Title: e.Title, Link: base + "/", Description: e.Content,
+				GUID: rssGUID{Value: e.ID}, PubDate: e.Published.Format(time.RFC1123Z),
+			})
+		}
+		doc = feed
+	} else {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		id := "urn:bitcoin-tracker:feed"
+		if len(list) == 1 && len(currencies) > 1 {
+			id += ":" + list[0]
+		}
+		feed := atomFeed{
+			ID: id, Title: feedTitle, Updated: updated.Format(time.RFC3339),
+			Links:  []atomLink{{Href: self, Rel: "self", Type: "application/atom+xml"}, {Href: base + "/"}},
+			Author: atomAuthor{Name: "bitcoin-tracker"},
+		}
+		for _, e := range entries {
+			published := e.Published.UTC().Format(time.RFC3339)
+			feed.Entries = append(feed.Entries, atomEntry{
+				ID: e.ID, Title: e.Title, Updated: published, Published: published,
+				Link: atomLink{Href: base + "/"}, Content: e.Content,
+			})
+		}
+		doc = feed
+	}
+
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(doc)
+}
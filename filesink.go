@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json" // Package for the JSON file format
+	"fmt"           // Package for formatted I/O operations
+	"os"            // Package for environment variables and file operations
+	"path/filepath" // Package for the temporary file location
+	"strconv"       // Package for the plain file format
+	"strings"       // Package for string manipulation
+)
+
+// Latest-price file formats, selected with PRICE_FILE_FORMAT
+const (
+	PriceFileJSON  = "json"  // The price.recorded event data as JSON
+	PriceFilePlain = "plain" // Just the number, e.g. "43250.75"
+)
+
+// priceFileCurrencyPlaceholder in PRICE_FILE is replaced by the currency code
+const priceFileCurrencyPlaceholder = "{currency}"
+
+// fileSink keeps a local file up to date with the latest price
+// Status bars (conky, polybar, tmux) can read the file without talking to the tracker
+type fileSink struct {
+	path   string // May contain {currency} for one file per currency
+	format string // PriceFileJSON or PriceFilePlain
+}
+
+// Name identifies the sink in logs
+func (s fileSink) Name() string { return "file " + s.path }
+
+// Publish implements EventSink
+// Only price.recorded events are written. Without {currency} in the path, only the
+// first configured currency is written, so the file always holds one price.
+func (s fileSink) Publish(e Event) error {
+	data, ok := e.Data.(PriceEventData)
+	if e.Type != EventPriceRecorded || !ok {
+		return nil
+	}
+
+	path := s.path
+	if strings.Contains(path, priceFileCurrencyPlaceholder) {
+		path = strings.ReplaceAll(path, priceFileCurrencyPlaceholder, data.Currency)
+	} else if data.Currency != currencies[0] {
+		return nil
+	}
+
+	var body []byte
+	if s.format == PriceFilePlain {
+		body = []byte(strconv.FormatFloat(data.Price, 'f', -1, 64) + "\n")
+	} else {
+		var err error
+		if body, err = json.Marshal(data); err != nil {
+			return fmt.Errorf("failed to encode price: %w", err)
+		}
+		body = append(body, '\n')
+	}
+	return writeFileAtomic(path, body)
+}
+
+// writeFileAtomic replaces path with data so readers never see a partial file
+// The data is written to a temporary file in the same directory, then renamed over path
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once the file has been renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadFileSink reads PRICE_FILE and PRICE_FILE_FORMAT; it returns nil when PRICE_FILE is unset
+func loadFileSink() (EventSink, error) {
+	path := os.Getenv("PRICE_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	format := strings.ToLower(os.Getenv("PRICE_FILE_FORMAT"))
+	switch format {
+	case "":
+		format = PriceFileJSON
+	case PriceFileJSON, PriceFilePlain:
+	default:
+		return nil, fmt.Errorf("invalid PRICE_FILE_FORMAT %q (expected json or plain)", format)
+	}
+	return fileSink{path: path, format: format}, nil
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"  // Package for fetching rates within the fetch deadline
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"net/url"  // Package for building provider queries
+	"os"       // Package for environment variables
+	"slices"   // Package for checking currencies
+	"strings"  // Package for string manipulation
+	"sync"     // Package for guarding the rate cache
+	"time"     // Package for rate ages
+)
+
+// FXSource is implemented by every exchange rate provider
+// FetchRates returns how many units of each quote currency one unit of base buys,
+// keyed by lowercase currency code.
+type FXSource interface {
+	Name() string
+	FetchRates(ctx context.Context, repo *Repository, base string, quotes []string) (map[string]float64, error)
+}
+
+// availableFXSources lists every built-in exchange rate provider by its config name
+var availableFXSources = map[string]FXSource{
+	"frankfurter":       frankfurterSource{},
+	"exchangerate.host": exchangeRateHostSource{},
+}
+
+// FXConfig controls the currencies whose prices are converted from another one at
+// current exchange rates instead of being fetched from the price providers
+type FXConfig struct {
+	Currencies []string      // Converted currencies; empty disables conversion
+	Base       string        // Fetched currency they are converted from
+	Source     FXSource      // Exchange rate provider
+	APIKey     string        // Access key of providers that need one
+	Refresh    time.Duration // How long fetched rates are used before they are fetched again
+	MaxAge     time.Duration // How long the last rates are still used while the provider fails
+}
+
+// fxConfig is the active configuration, loaded at startup
+var fxConfig = FXConfig{Base: "usd", Source: frankfurterSource{}, Refresh: time.Hour, MaxAge: 24 * time.Hour}
+
+// enabled reports whether any currency is converted
+func (c FXConfig) enabled() bool {
+	return len(c.Currencies) > 0
+}
+
+// loadFXConfig reads FX_CURRENCIES (e.g. "nok"), FX_BASE, FX_PROVIDER, FX_API_KEY,
+// FX_REFRESH, and FX_MAX_AGE. Call it after the currencies have been loaded: converted
+// currencies and the base must all be in CURRENCIES.
+func loadFXConfig() (FXConfig, error) {
+	c := FXConfig{Base: "usd", Source: frankfurterSource{}, APIKey: os.Getenv("FX_API_KEY"), Refresh: time.Hour, MaxAge: 24 * time.Hour}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("FX_BASE"))); v != "" {
+		c.Base = v
+	}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("FX_PROVIDER"))); v != "" {
+		source, ok := availableFXSources[v]
+		if !ok {
+			return c, fmt.Errorf("unknown FX_PROVIDER %q (expected frankfurter or exchangerate.host)", v)
+		}
+		c.Source = source
+	}
+	if v := os.Getenv("FX_REFRESH"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return c, fmt.Errorf("invalid FX_REFRESH %q (expected a duration of at least 1m, e.g. 1h)", v)
+		}
+		c.Refresh = d
+	}
+	if v := os.Getenv("FX_MAX_AGE"); v != "" {
+		d, err := parseStatsWindow(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid FX_MAX_AGE %q (expected e.g. 24h or 3d)", v)
+		}
+		c.MaxAge = d
+	}
+	if c.MaxAge < c.Refresh {
+		return c, fmt.Errorf("FX_MAX_AGE (%s) must not be shorter than FX_REFRESH (%s)", c.MaxAge, c.Refresh)
+	}
+
+	for _, currency := range strings.Split(os.Getenv("FX_CURRENCIES"), ",") {
+		currency = strings.ToLower(strings.TrimSpace(currency))
+		if currency == "" || slices.Contains(c.Currencies, currency) {
+			continue
+		}
+		if !slices.Contains(currencies, currency) {
+			return c, fmt.Errorf("FX_CURRENCIES lists %q, which is not in CURRENCIES", currency)
+		}
+		if currency == c.Base {
+			return c, fmt.Errorf("FX_CURRENCIES can't include FX_BASE (%s)", c.Base)
+		}
+		c.Currencies = append(c.Currencies, currency)
+	}
+	if !c.enabled() {
+		return c, nil
+	}
+	if !slices.Contains(currencies, c.Base) {
+		return c, fmt.Errorf("FX_BASE %q must be in CURRENCIES, since converted prices are computed from it", c.Base)
+	}
+	if _, ok := c.Source.(exchangeRateHostSource); ok && c.APIKey == "" {
+		return c, fmt.Errorf("FX_PROVIDER=exchangerate.host needs FX_API_KEY")
+	}
+	return c, nil
+}
+
+// fetchCurrencies returns the currencies asked of the price providers: every currency
+// of CURRENCIES except the converted ones
+func fetchCurrencies() []string {
+	if !fxConfig.enabled() {
+		return currencies
+	}
+	var list []string
+	for _, currency := range currencies {
+		if !slices.Contains(fxConfig.Currencies, currency) {
+			list = append(list, currency)
+		}
+	}
+	return list
+}
+
+// FXRate is an exchange rate fetched from FX_PROVIDER
+type FXRate struct {
+	Base      string    `json:"base"`
+	Quote     string    `json:"quote"`
+	Rate      float64   `json:"rate"` // Units of Quote per unit of Base
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"` // When the rate was fetched
+}
+
+// fxRetryDelay is how long a failed rate fetch isn't repeated, so a provider outage
+// doesn't cost a request on every price fetch
+const fxRetryDelay = 5 * time.Minute
+
+// fxRates caches the newest rate of each converted currency
+var fxRates = struct {
+	sync.Mutex
+	rates    map[string]FXRate
+	failedAt time.Time // Last failed fetch
+	err      error     // Its error
+}{rates: make(map[string]FXRate)}
+
+// currentFXRates returns the rate of every converted currency, fetching them when the
+// cached ones are older than FX_REFRESH. While the provider fails, rates up to
+// FX_MAX_AGE old are used, from the cache or else the database; a currency without one
+// is missing from the result, and err says why.
+func currentFXRates(ctx context.Context, repo *Repository) (map[string]FXRate, error) {
+	cfg := fxConfig
+	fxRates.Lock()
+	defer fxRates.Unlock()
+
+	now := time.Now().UTC()
+	fresh := true
+	for _, currency := range cfg.Currencies {
+		if r, ok := fxRates.rates[currency]; !ok || r.Base != cfg.Base || now.Sub(r.Timestamp) >= cfg.Refresh {
+			fresh = false
+		}
+	}
+	if fresh {
+		return copyFXRates(cfg.Currencies), nil
+	}
+	if now.Sub(fxRates.failedAt) < fxRetryDelay {
+		return fallbackFXRates(ctx, repo, now, fxRates.err)
+	}
+
+	got, err := cfg.Source.FetchRates(ctx, repo, cfg.Base, cfg.Currencies)
+	var fetched []FXRate
+	for _, currency := range cfg.Currencies {
+		if rate, ok := got[currency]; ok && rate > 0 {
+			r := FXRate{Base: cfg.Base, Quote: currency, Rate: rate, Source: cfg.Source.Name(), Timestamp: now}
+			fxRates.rates[currency] = r
+			fetched = append(fetched, r)
+		}
+	}
+	if len(fetched) > 0 {
+		slog.Info("Fetched exchange rates", "source", cfg.Source.Name(), "base", cfg.Base, "rates", len(fetched))
+		// Relay mode has no database; the rates are only cached there
+		if repo != nil {
+			if serr := repo.SaveFXRates(ctx, fetched); serr != nil {
+				slog.Error("Failed to save exchange rates", "error", serr)
+			}
+		}
+	}
+	if err == nil && len(fetched) == len(cfg.Currencies) {
+		fxRates.failedAt, fxRates.err = time.Time{}, nil
+		return copyFXRates(cfg.Currencies), nil
+	}
+	if err == nil {
+		err = fmt.Errorf("%s returned no rate for some of %s", cfg.Source.Name(), strings.Join(cfg.Currencies, ","))
+	}
+	err = withKind(KindProvider, fmt.Errorf("failed to fetch exchange rates: %w", err))
+	incCounter("tracker_fx_failures_total", map[string]string{"source": cfg.Source.Name()}, 1)
+	fxRates.failedAt, fxRates.err = now, err
+	return fallbackFXRates(ctx, repo, now, err)
+}
+
+// fallbackFXRates returns the rates up to FX_MAX_AGE old while the provider fails, along
+// with its error; the caller holds fxRates
+func fallbackFXRates(ctx context.Context, repo *Repository, now time.Time, err error) (map[string]FXRate, error) {
+	cfg := fxConfig
+	// After a restart the cache is empty, so fall back to the stored rates
+	if repo != nil {
+		stored, serr := repo.LatestFXRates(ctx, cfg.Base)
+		if serr != nil {
+			slog.Error("Failed to read stored exchange rates", "error", serr)
+		}
+		for _, r := range stored {
+			if cached, ok := fxRates.rates[r.Quote]; !ok || cached.Base != cfg.Base || r.Timestamp.After(cached.Timestamp) {
+				fxRates.rates[r.Quote] = r
+			}
+		}
+	}
+	rates := copyFXRates(cfg.Currencies)
+	for currency, r := range rates {
+		if r.Base != cfg.Base || now.Sub(r.Timestamp) > cfg.MaxAge {
+			delete(rates, currency)
+		} else {
+			slog.Warn("Using an earlier exchange rate", "currency", currency, "rate", r.Rate, "age", now.Sub(r.Timestamp).Round(time.Minute))
+		}
+	}
+	return rates, err
+}
+
+// copyFXRates returns the cached rates of currencies; the caller holds fxRates
+func copyFXRates(currencies []string) map[string]FXRate {
+	rates := make(map[string]FXRate, len(currencies))
+	for _, currency := range currencies {
+		if r, ok := fxRates.rates[currency]; ok {
+			rates[currency] = r
+		}
+	}
+	return rates
+}
+
+// convertFXPrices adds the prices of the converted currencies to prices, computed from
+// the FX_BASE price at the current rates, and returns the rate used for each. Prices
+// without the base are returned as they are. A currency that can't be converted is
+// logged and left out; the others are still stored.
+func convertFXPrices(ctx context.Context, repo *Repository, prices map[string]float64) (map[string]float64, map[string]float64) {
+	base, ok := prices[fxConfig.Base]
+	if !fxConfig.enabled() || !ok {
+		return prices, nil
+	}
+
+	rates, err := currentFXRates(ctx, repo)
+	converted := make(map[string]float64, len(prices)+len(rates))
+	for currency, price := range prices {
+		converted[currency] = price
+	}
+	used := make(map[string]float64, len(rates))
+	for _, currency := range fxConfig.Currencies {
+		r, ok := rates[currency]
+		if !ok {
+			slog.Error("Failed to convert price", "coin", "bitcoin", "currency", currency, "base", fxConfig.Base, "error", err)
+			incCounter("tracker_fetch_failures_total", map[string]string{"coin": "bitcoin", "currency": currency}, 1)
+			continue
+		}
+		converted[currency] = base * r.Rate
+		used[currency] = r.Rate
+	}
+	return converted, used
+}
+
+// frankfurterSource fetches European Central Bank reference rates from frankfurter.app
+// The rates are updated once per working day; no key is needed.
+type frankfurterSource struct{}
+
+// Name implements FXSource
+func (frankfurterSource) Name() string { return "frankfurter" }
+
+// FetchRates implements FXSource
+func (frankfurterSource) FetchRates(ctx context.Context, repo *Repository, base string, quotes []string) (map[string]float64, error) {
+	var result struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	query := url.Values{"from": {strings.ToUpper(base)}, "to": {strings.ToUpper(strings.Join(quotes, ","))}}
+	if err := getJSON(ctx, repo, "frankfurter", "fx", "https://api.frankfurter.app/latest?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+	rates := make(map[string]float64, len(result.Rates))
+	for currency, rate := range result.Rates {
+		rates[strings.ToLower(currency)] = rate
+	}
+	return rates, nil
+}
+
+// exchangeRateHostSource fetches live rates from exchangerate.host, which needs FX_API_KEY
+type exchangeRateHostSource struct{}
+
+// Name implements FXSource
+func (exchangeRateHostSource) Name() string { return "exchangerate.host" }
+
+// FetchRates implements FXSource
+// Errors come back with status 200 and success false, so they are checked in the body.
+func (exchangeRateHostSource) FetchRates(ctx context.Context, repo *Repository, base string, quotes []string) (map[string]float64, error) {
+	var result struct {
+		Success bool               `json:"success"`
+		Quotes  map[string]float64 `json:"quotes"` // Keyed by base and quote, e.g. "USDNOK"
+		Error   struct {
+			Code int    `json:"code"`
+			Info string `json:"info"`
+		} `json:"error"`
+	}
+	query := url.Values{
+		"access_key": {fxConfig.APIKey},
+		"source":     {strings.ToUpper(base)},
+		"currencies": {strings.ToUpper(strings.Join(quotes, ","))},
+	}
+	if err := getJSON(ctx, repo, "exchangerate.host", "fx", "https://api.exchangerate.host/live?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+	if !result.Success {
+		return nil, withKind(KindProvider, fmt.Errorf("exchangerate.host error %d: %s", result.Error.Code, result.Error.Info))
+	}
+	rates := make(map[string]float64, len(result.Quotes))
+	for pair, rate := range result.Quotes {
+		quote, ok := strings.CutPrefix(strings.ToUpper(pair), strings.ToUpper(base))
+		if ok {
+			rates[strings.ToLower(quote)] = rate
+		}
+	}
+	return rates, nil
+}
+
+// runFXCommand handles "fx [--fetch]"
+// It lists the stored rates of the converted currencies; --fetch fetches them first
+func runFXCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("fx")
+	fetch := fs.Bool("fetch", false, "Fetch the current rates from FX_PROVIDER first")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if !fxConfig.enabled() {
+		return validationErrorf("no currency is converted; set FX_CURRENCIES, e.g. nok")
+	}
+
+	if *fetch {
+		if _, err := currentFXRates(ctx, repo); err != nil {
+			return err
+		}
+	}
+	rates, err := repo.LatestFXRates(ctx, fxConfig.Base)
+	if err != nil {
+		return err
+	}
+	if len(rates) == 0 {
+		fmt.Println("No exchange rates stored yet; run fx --fetch or wait for the next fetch")
+		return nil
+	}
+
+	fmt.Printf("\n%-6s %-6s %-14s %-18s %-20s\n", "Base", "Quote", "Rate", "Source", "Fetched")
+	fmt.Println("------------------------------------------------------------------")
+	for _, r := range rates {
+		if !slices.Contains(fxConfig.Currencies, r.Quote) {
+			continue
+		}
+		fmt.Printf("%-6s %-6s %-14.6f %-18s %-20s\n", strings.ToUpper(r.Base), strings.ToUpper(r.Quote), r.Rate, r.Source,
+			formatDisplayTime(r.Timestamp))
+	}
+	fmt.Println()
+	return nil
+}
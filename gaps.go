@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"  // Package for cancelling a running gap fill
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"strings"  // Package for string manipulation
+	"time"     // Package for gap spans
+)
+
+// GapFillConfig controls the detection of holes in the price history, e.g. left by
+// downtime, and their backfill from CoinGecko when the scheduler starts
+type GapFillConfig struct {
+	Threshold time.Duration // Longest accepted time without a stored price; 0 disables gap filling
+	Lookback  time.Duration // How far back the scheduler looks for gaps on startup
+}
+
+// gapFillConfig is the active configuration, loaded at startup
+var gapFillConfig = GapFillConfig{Threshold: 2 * time.Hour, Lookback: 7 * 24 * time.Hour}
+
+// loadGapFillConfig reads GAP_FILL_THRESHOLD (e.g. 2h, 0 to disable) and GAP_FILL_LOOKBACK (e.g. 7d)
+// CoinGecko history is hourly, so a threshold under 2h would find filled gaps again.
+func loadGapFillConfig() (GapFillConfig, error) {
+	c := GapFillConfig{Threshold: 2 * time.Hour, Lookback: 7 * 24 * time.Hour}
+	if v := os.Getenv("GAP_FILL_THRESHOLD"); v == "0" {
+		c.Threshold = 0
+	} else if v != "" {
+		d, err := parseStatsWindow(v)
+		if err != nil || d < 2*time.Hour {
+			return c, fmt.Errorf("invalid GAP_FILL_THRESHOLD %q (expected 0 or a duration of at least 2h)", v)
+		}
+		c.Threshold = d
+	}
+	if v := os.Getenv("GAP_FILL_LOOKBACK"); v != "" {
+		d, err := parseStatsWindow(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid GAP_FILL_LOOKBACK %q (expected e.g. 24h or 7d)", v)
+		}
+		c.Lookback = d
+	}
+	return c, nil
+}
+
+// PriceGap is a span without stored prices of a currency
+type PriceGap struct {
+	Currency string
+	From     time.Time // Timestamp of the last price before the gap
+	To       time.Time // Timestamp of the first price after it, or the end of the search
+}
+
+// Duration returns the length of the gap
+func (g PriceGap) Duration() time.Duration {
+	return g.To.Sub(g.From)
+}
+
+// gapSearchStart returns where a gap search looking back lookback from now begins
+// Older prices the retention policy averaged per day are a day apart by design, so the
+// search never reaches back into them.
+func gapSearchStart(now time.Time, lookback time.Duration) time.Time {
+	from := now.Add(-lookback)
+	if retentionPolicy.Hourly > 0 {
+		if daily := now.Add(-retentionPolicy.Hourly); daily.After(from) {
+			from = daily
+		}
+	}
+	return from
+}
+
+// findPriceGaps returns the gaps longer than threshold in every configured currency
+// between from and to, oldest first per currency
+func findPriceGaps(repo *Repository, from, to time.Time, threshold time.Duration) ([]PriceGap, error) {
+	var gaps []PriceGap
+	for _, currency := range currencies {
+		found, err := repo.PriceGaps(currency, from, to, threshold)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find gaps in %s prices: %w", strings.ToUpper(currency), err)
+		}
+		gaps = append(gaps, found...)
+	}
+	return gaps, nil
+}
+
+// fillPriceGaps backfills each gap from CoinGecko, then rebuilds what is derived from the
+// prices of each currency that got new ones; returns the number of prices inserted
+func fillPriceGaps(ctx context.Context, repo *Repository, gaps []PriceGap) (int, error) {
+	total := 0
+	filled := make(map[string]time.Time) // Earliest filled gap per currency
+	for i, gap := range gaps {
+		// Pace requests as backfill does; the first one goes out immediately
+		if i > 0 {
+			if err := sleepContext(ctx, backfillDelay); err != nil {
+				return total, err
+			}
+		}
+		n, err := backfillCurrency(ctx, repo, gap.Currency, gap.From, gap.To, nil)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("failed to fill %s gap from %s to %s: %w", strings.ToUpper(gap.Currency),
+				gap.From.Format(time.RFC3339), gap.To.Format(time.RFC3339), err)
+		}
+		slog.Info("Filled price gap", "coin", "bitcoin", "currency", gap.Currency,
+			"from", gap.From.Format(time.RFC3339), "to", gap.To.Format(time.RFC3339),
+			"duration", gap.Duration().Round(time.Minute), "new", n)
+		incCounter("tracker_gap_fill_prices_total", map[string]string{"currency": gap.Currency}, float64(n))
+		if earliest, ok := filled[gap.Currency]; n > 0 && (!ok || gap.From.Before(earliest)) {
+			filled[gap.Currency] = gap.From
+		}
+	}
+
+	for currency, from := range filled {
+		if err := rebuildDerivedData(repo, currency, from); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// runStartupGapFill looks for gaps in the recent price history and backfills them
+// It runs alongside the scheduler, which keeps fetching meanwhile; failures are only logged.
+func runStartupGapFill(ctx context.Context, repo *Repository) {
+	cfg := gapFillConfig
+	now := time.Now()
+	gaps, err := findPriceGaps(repo, gapSearchStart(now, cfg.Lookback), now, cfg.Threshold)
+	if err != nil {
+		slog.Error("Gap detection failed", "error", err)
+		return
+	}
+	if len(gaps) == 0 {
+		slog.Info("No gaps in price history", "lookback", cfg.Lookback, "threshold", cfg.Threshold)
+		return
+	}
+
+	slog.Info("Found gaps in price history, backfilling", "gaps", len(gaps), "lookback", cfg.Lookback, "threshold", cfg.Threshold)
+	n, err := fillPriceGaps(ctx, repo, gaps)
+	if err != nil {
+		slog.Error("Gap fill stopped", "new", n, "error", err)
+		return
+	}
+	slog.Info("Gap fill complete", "gaps", len(gaps), "new", n, "duration", time.Since(now).Round(time.Second))
+}
+
+// runGapsCommand handles "gaps [--since 7d] [--threshold 2h] [--fill]"
+func runGapsCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("gaps")
+	sinceFlag := fs.String("since", "", "How far back to look, e.g. 7d (default GAP_FILL_LOOKBACK)")
+	thresholdFlag := fs.String("threshold", "", "Shortest time without prices that counts as a gap, e.g. 2h (default GAP_FILL_THRESHOLD)")
+	fill := fs.Bool("fill", false, "Backfill the gaps from CoinGecko")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+
+	lookback, threshold := gapFillConfig.Lookback, gapFillConfig.Threshold
+	if *sinceFlag != "" {
+		d, err := parseStatsWindow(*sinceFlag)
+		if err != nil {
+			return err
+		}
+		lookback = d
+	}
+	if *thresholdFlag != "" {
+		d, err := parseStatsWindow(*thresholdFlag)
+		if err != nil {
+			return err
+		}
+		threshold = d
+	}
+	if threshold <= 0 {
+		return validationErrorf("gap filling is disabled; pass --threshold")
+	}
+
+	now := time.Now()
+	gaps, err := findPriceGaps(repo, gapSearchStart(now, lookback), now, threshold)
+	if err != nil {
+		return err
+	}
+	if len(gaps) == 0 {
+		fmt.Printf("No gaps longer than %s in the last %s\n", threshold, lookback)
+		return nil
+	}
+
+	fmt.Printf("\n%-8s %-20s %-20s %s\n", "Currency", "From", "To", "Duration")
+	fmt.Println("--------------------------------------------------------------")
+	for _, gap := range gaps {
+		fmt.Printf("%-8s %-20s %-20s %s\n", strings.ToUpper(gap.Currency),
+			formatDisplayTime(gap.From), formatDisplayTime(gap.To), gap.Duration().Round(time.Minute))
+	}
+	fmt.Println()
+
+	if !*fill {
+		return nil
+	}
+	n, err := fillPriceGaps(ctx, repo, gaps)
+	if err != nil {
+		return fmt.Errorf("gap fill stopped after %d new rows: %w", n, err)
+	}
+	fmt.Printf("Filled %d gaps with %d prices\n", len(gaps), n)
+	return nil
+}
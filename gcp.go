@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"           // Package for request bodies
+	"crypto"          // Package for the JWT signature hash identifier
+	"crypto/rand"     // Package for RSA signing
+	"crypto/rsa"      // Package for service account keys
+	"crypto/sha256"   // Package for JWT and signed URL signing
+	"crypto/x509"     // Package for parsing private keys
+	"encoding/base64" // Package for JWT segments and message data
+	"encoding/hex"    // Package for signed URL signatures
+	"encoding/json"   // Package for API requests and credential files
+	"encoding/pem"    // Package for decoding private keys
+	"fmt"             // Package for formatted I/O operations
+	"io"              // Package for reading error responses
+	"net/http"        // Package for Google API calls
+	"net/url"         // Package for token request forms and signed URLs
+	"os"              // Package for environment variables and files
+	"path/filepath"   // Package for locating gcloud credentials
+	"strings"         // Package for string manipulation
+	"sync"            // Package for caching access tokens
+	"time"            // Package for token expiry
+)
+
+// gcpScope is the OAuth scopes requested: Pub/Sub for the event sink, and Cloud Storage
+// for report uploads
+const gcpScope = "https://www.googleapis.com/auth/pubsub https://www.googleapis.com/auth/devstorage.read_write"
+
+// gcpToken is an OAuth access token with its expiry
+type gcpToken struct {
+	AccessToken string
+	Expires     time.Time
+}
+
+// gcpTokenCache holds the current access token until shortly before it expires
+var gcpTokenCache struct {
+	mu    sync.Mutex
+	token *gcpToken
+}
+
+// gcpCredentialsFile is the subset of an Application Default Credentials file we use
+// Both service account keys and "gcloud auth application-default login" files are supported
+type gcpCredentialsFile struct {
+	Type         string `json:"type"` // "service_account" or "authorized_user"
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// gcpAccessToken returns a token from Application Default Credentials:
+// GOOGLE_APPLICATION_CREDENTIALS, then the gcloud ADC file, then the GCE/GKE/Cloud Run metadata server
+func gcpAccessToken() (string, error) {
+	gcpTokenCache.mu.Lock()
+	defer gcpTokenCache.mu.Unlock()
+
+	if t := gcpTokenCache.token; t != nil && time.Until(t.Expires) > 5*time.Minute {
+		return t.AccessToken, nil
+	}
+
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			adc := filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(adc); err == nil {
+				path = adc
+			}
+		}
+	}
+
+	var token *gcpToken
+	var err error
+	if path != "" {
+		token, err = gcpTokenFromFile(path)
+	} else {
+		token, err = gcpTokenFromMetadata()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	gcpTokenCache.token = token
+	return token.AccessToken, nil
+}
+
+// gcpTokenFromFile exchanges a credentials file for an access token
+func gcpTokenFromFile(path string) (*gcpToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Google credentials: %w", err)
+	}
+
+	var creds gcpCredentialsFile
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse Google credentials %s: %w", path, err)
+	}
+
+	form := url.Values{}
+	tokenURI := "https://oauth2.googleapis.com/token"
+	switch creds.Type {
+	case "service_account":
+		assertion, err := gcpSignedJWT(creds)
+		if err != nil {
+			return nil, err
+		}
+		if creds.TokenURI != "" {
+			tokenURI = creds.TokenURI
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+	default:
+		return nil, fmt.Errorf("unsupported Google credentials type %q", creds.Type)
+	}
+
+	resp, err := httpClient.PostForm(tokenURI, form)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request Google access token: %w", err)
+	}
+	defer resp.Body.Close()
+	return decodeGCPToken(resp)
+}
+
+// gcpPrivateKey parses the RSA key of a service account
+func gcpPrivateKey(creds gcpCredentialsFile) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("service account private key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service account key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account key is not an RSA key")
+	}
+	return key, nil
+}
+
+// gcpSignedJWT builds the RS256-signed assertion a service account trades for a token
+func gcpSignedJWT(creds gcpCredentialsFile) (string, error) {
+	key, err := gcpPrivateKey(creds)
+	if err != nil {
+		return "", err
+	}
+
+	tokenURI := creds.TokenURI
+	if tokenURI == "" {
+		tokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   creds.ClientEmail,
+		"scope": gcpScope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
+
+// gcpServiceAccountKey reads the service account key file in
+// GOOGLE_APPLICATION_CREDENTIALS, which signing URLs needs: the tokens of other
+// credentials can't sign
+func gcpServiceAccountKey() (gcpCredentialsFile, *rsa.PrivateKey, error) {
+	var creds gcpCredentialsFile
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		return creds, nil, fmt.Errorf("signed Cloud Storage URLs need a service account key in GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return creds, nil, fmt.Errorf("failed to read Google credentials: %w", err)
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return creds, nil, fmt.Errorf("failed to parse Google credentials %s: %w", path, err)
+	}
+	if creds.Type != "service_account" {
+		return creds, nil, fmt.Errorf("signed Cloud Storage URLs need a service account key, not %q credentials", creds.Type)
+	}
+	key, err := gcpPrivateKey(creds)
+	return creds, key, err
+}
+
+// signGCSURL returns a V4 signed URL that lets whoever holds it read object from bucket
+// until expires after now, signed with the key of the service account email
+func signGCSURL(email string, key *rsa.PrivateKey, bucket, object string, now time.Time, expires time.Duration) (string, error) {
+	now = now.UTC()
+	datetime := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/auto/storage/goog4_request"
+	resource := (&url.URL{Path: "/" + bucket + "/" + object}).EscapedPath()
+
+	query := url.Values{}
+	query.Set("X-Goog-Algorithm", "GOOG4-RSA-SHA256")
+	query.Set("X-Goog-Credential", email+"/"+scope)
+	query.Set("X-Goog-Date", datetime)
+	query.Set("X-Goog-Expires", fmt.Sprint(int(expires.Seconds())))
+	query.Set("X-Goog-SignedHeaders", "host")
+	canonicalQuery := query.Encode()
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		resource,
+		canonicalQuery,
+		"host:storage.googleapis.com\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "GOOG4-RSA-SHA256\n" + datetime + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	digest := sha256.Sum256([]byte(stringToSign))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign Cloud Storage URL: %w", err)
+	}
+	return "https://storage.googleapis.com" + resource + "?" + canonicalQuery + "&X-Goog-Signature=" + hex.EncodeToString(signature), nil
+}
+
+// gcpTokenFromMetadata asks the metadata server for the attached service account's token
+func gcpTokenFromMetadata() (*gcpToken, error) {
+	req, _ := http.NewRequest(http.MethodGet,
+		"http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("no Google credentials found (set GOOGLE_APPLICATION_CREDENTIALS): %w", err)
+	}
+	defer resp.Body.Close()
+	return decodeGCPToken(resp)
+}
+
+// decodeGCPToken parses an OAuth token response
+func decodeGCPToken(resp *http.Response) (*gcpToken, error) {
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("token request returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var data struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	return &gcpToken{
+		AccessToken: data.AccessToken,
+		Expires:     time.Now().Add(time.Duration(data.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// pubSubSink publishes events to a Google Cloud Pub/Sub topic
+// Every message carries the asset as ordering key, so subscriptions with message
+// ordering enabled receive each asset's ticks in order.
+type pubSubSink struct {
+	topic      string            // Full topic name: projects/<project>/topics/<topic>
+	endpoint   string            // API base URL; regional endpoints keep ordered messages together
+	attributes map[string]string // Static attributes added to every message
+	emulator   bool              // Talking to the local emulator, which needs no credentials
+}
+
+// Name identifies the sink in logs
+func (s pubSubSink) Name() string { return "pubsub " + s.topic }
+
+// Publish implements EventSink
+func (s pubSubSink) Publish(e Event) error {
+	data, _, headers, err := encodeEvent(e)
+	if err != nil {
+		return err
+	}
+
+	attributes := map[string]string{"event_type": e.Type, "subject": e.Subject}
+	for k, v := range s.attributes {
+		attributes[k] = v
+	}
+	// In CloudEvents binary mode the context attributes travel as ce-* message attributes
+	for k, v := range headers {
+		attributes["ce-"+k] = v
+	}
+
+	// Subjects look like "bitcoin/usd"; ordering is per asset
+	orderingKey, _, _ := strings.Cut(e.Subject, "/")
+
+	body, err := json.Marshal(map[string]interface{}{
+		"messages": []map[string]interface{}{{
+			"data":        base64.StdEncoding.EncodeToString(data),
+			"attributes":  attributes,
+			"orderingKey": orderingKey,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode publish request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint+"/v1/"+s.topic+":publish", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create pubsub request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if !s.emulator {
+		token, err := gcpAccessToken()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("pubsub request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("pubsub returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// loadPubSubSink builds the Pub/Sub sink from PUBSUB_TOPIC, GOOGLE_CLOUD_PROJECT,
+// PUBSUB_ENDPOINT, PUBSUB_ATTRIBUTES, and PUBSUB_EMULATOR_HOST
+// It returns nil when no topic is configured
+func loadPubSubSink() (EventSink, error) {
+	topic := os.Getenv("PUBSUB_TOPIC")
+	if topic == "" {
+		return nil, nil
+	}
+
+	// Accept a bare topic name when the project is configured separately
+	if !strings.HasPrefix(topic, "projects/") {
+		project := os.Getenv("GOOGLE_CLOUD_PROJECT")
+		if project == "" {
+			return nil, fmt.Errorf("PUBSUB_TOPIC %q needs GOOGLE_CLOUD_PROJECT or the form projects/<project>/topics/<topic>", topic)
+		}
+		topic = "projects/" + project + "/topics/" + topic
+	}
+
+	sink := pubSubSink{
+		topic:      topic,
+		endpoint:   "https://pubsub.googleapis.com",
+		attributes: make(map[string]string),
+	}
+	if v := os.Getenv("PUBSUB_ENDPOINT"); v != "" {
+		sink.endpoint = strings.TrimSuffix(v, "/")
+	}
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		sink.endpoint = "http://" + host
+		sink.emulator = true
+	}
+
+	// Static attributes use the form "env=prod,team=markets"
+	if v := os.Getenv("PUBSUB_ATTRIBUTES"); v != "" {
+		for _, pair := range strings.Split(v, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("invalid PUBSUB_ATTRIBUTES entry %q", pair)
+			}
+			sink.attributes[key] = value
+		}
+	}
+	return sink, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto"        // Package for the signature hash identifier
+	"crypto/rand"   // Package for generating a test key
+	"crypto/rsa"    // Package for verifying signatures
+	"crypto/sha256" // Package for hashing the signed strings
+	"encoding/hex"  // Package for decoding the signature
+	"net/url"       // Package for reading the signed URL
+	"strings"       // Package for splitting the signed URL
+	"testing"       // Package for the tests
+	"time"          // Package for the signing time
+)
+
+func TestSignGCSURL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := "example@example-project.iam.gserviceaccount.com"
+	now := time.Date(2019, time.March, 1, 19, 8, 59, 0, time.UTC)
+
+	signed, err := signGCSURL(email, key, "example-bucket", "cat-pics/tabby.jpeg", now, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, signature, ok := strings.Cut(signed, "&X-Goog-Signature=")
+	if !ok {
+		t.Fatalf("signGCSURL = %q, want an X-Goog-Signature parameter", signed)
+	}
+
+	// The URL and canonical request of the V4 signing example in the Cloud Storage docs
+	wantQuery := "X-Goog-Algorithm=GOOG4-RSA-SHA256" +
+		"&X-Goog-Credential=example%40example-project.iam.gserviceaccount.com%2F20190301%2Fauto%2Fstorage%2Fgoog4_request" +
+		"&X-Goog-Date=20190301T190859Z&X-Goog-Expires=900&X-Goog-SignedHeaders=host"
+	if want := "https://storage.googleapis.com/example-bucket/cat-pics/tabby.jpeg?" + wantQuery; unsigned != want {
+		t.Fatalf("signGCSURL = %q, want %q", unsigned, want)
+	}
+	canonicalRequest := "GET\n/example-bucket/cat-pics/tabby.jpeg\n" + wantQuery + "\nhost:storage.googleapis.com\n\nhost\nUNSIGNED-PAYLOAD"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "GOOG4-RSA-SHA256\n20190301T190859Z\n20190301/auto/storage/goog4_request\n" + hex.EncodeToString(requestHash[:])
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		t.Fatalf("signature %q is not hex: %v", signature, err)
+	}
+	digest := sha256.Sum256([]byte(stringToSign))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("signature doesn't verify against the canonical request: %v", err)
+	}
+}
+
+func TestSignGCSURLEscapesObjectNames(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signGCSURL("sa@example.iam.gserviceaccount.com", key, "reports", "weekly/report 2024-03-12.html", time.Now(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := u.EscapedPath(), "/reports/weekly/report%202024-03-12.html"; got != want {
+		t.Errorf("signed URL path = %q, want %q", got, want)
+	}
+}
@@ -5,4 +5,5 @@ go 1.21
 
 require (
     github.com/lib/pq v1.10.9
+    github.com/mattn/go-sqlite3 v1.14.33
 )
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"       // Package for the queries' deadline
+	"encoding/json" // Package for the request and response bodies
+	"fmt"           // Package for formatted I/O operations
+	"net/http"      // Package for the datasource endpoints
+	"slices"        // Package for ordering targets
+	"strings"       // Package for parsing target names
+	"time"          // Package for the query ranges
+)
+
+// Grafana's JSON datasource (the "simple-json" protocol, e.g. the grafana-json-datasource
+// or Infinity's JSON API mode) charts the tracker without SQL. Point its URL at
+// <API_ADDR>/grafana; it calls:
+//
+//	GET  /grafana              connection test
+//	POST /grafana/search       the series a panel can pick: price.<currency>, fear_greed,
+//	                           and collector.<metric> for every metric with samples
+//	POST /grafana/query        the points of the picked series in the dashboard's range
+//	POST /grafana/annotations  anomalies, patterns (patterns.1h for hourly candles), or
+//	                           annotations (annotations.<tag> for one tag)
+//
+// Queries only read, so the POSTs pass API_AUTH=writes and read-only mode like GETs.
+// Prices are stored samples when the range holds no more of them than the panel's
+// maxDataPoints, and hourly or daily candle closes otherwise.
+
+// grafanaPathPrefix is where the datasource endpoints are served
+const grafanaPathPrefix = "/grafana"
+
+// grafanaRange is the time range of a query or annotation request
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// grafanaTarget is one series a panel asks for
+type grafanaTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"` // timeserie (the default) or table
+}
+
+// grafanaQuery is the body of POST /grafana/query
+type grafanaQuery struct {
+	Range         grafanaRange    `json:"range"`
+	MaxDataPoints int             `json:"maxDataPoints"`
+	Targets       []grafanaTarget `json:"targets"`
+}
+
+// grafanaSeries is one time series of a query response; a datapoint is [value, unix ms]
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// grafanaColumn is one column of a table response
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// grafanaTable is a table of a query response
+type grafanaTable struct {
+	Type    string          `json:"type"` // Always "table"
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// grafanaAnnotationRequest is the body of POST /grafana/annotations
+type grafanaAnnotationRequest struct {
+	Range      grafanaRange    `json:"range"`
+	Annotation json.RawMessage `json:"annotation"` // Echoed in every event; its query selects them
+}
+
+// grafanaAnnotation is one event of an annotation response
+type grafanaAnnotation struct {
+	Annotation json.RawMessage `json:"annotation"`
+	Time       int64           `json:"time"` // Unix milliseconds
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+}
+
+// grafanaPoint is one value of a series at a time
+type grafanaPoint struct {
+	at    time.Time
+	value float64
+}
+
+// handleGrafana serves the JSON datasource endpoints under /grafana
+func (s *apiServer) handleGrafana(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, grafanaPathPrefix), "/")
+	if path == "" {
+		// The datasource's "Save & test" only needs a 200
+		if r.Method != http.MethodGet {
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	switch path {
+	case "/search":
+		var body struct {
+			Target string `json:"target"`
+		}
+		// Older versions of the datasource post an empty body
+		json.NewDecoder(r.Body).Decode(&body)
+		targets, err := grafanaTargets(r.Context(), s.repo)
+		if err != nil {
+			writeAnalyticsError(w, r, "series", err)
+			return
+		}
+		matching := []string{}
+		for _, t := range targets {
+			if strings.Contains(t, strings.ToLower(strings.TrimSpace(body.Target))) {
+				matching = append(matching, t)
+			}
+		}
+		writeJSON(w, http.StatusOK, matching)
+
+	case "/query":
+		var q grafanaQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid query: %v", err)
+			return
+		}
+		if !q.Range.To.After(q.Range.From) {
+			writeAPIError(w, http.StatusBadRequest, "range.to must be after range.from")
+			return
+		}
+		if err := checkAnalyticsRange(q.Range.From, q.Range.To, ""); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		if q.MaxDataPoints <= 0 || q.MaxDataPoints > maxRangeLimit {
+			q.MaxDataPoints = defaultRangeLimit
+		}
+
+		ctx, cancel := withAnalyticsTimeout(r.Context())
+		defer cancel()
+		results := make([]interface{}, 0, len(q.Targets))
+		for _, t := range q.Targets {
+			if t.Target == "" {
+				continue // A panel query nothing has been picked for yet
+			}
+			points, err := grafanaSeriesPoints(ctx, s.repo, t.Target, q.Range, q.MaxDataPoints)
+			if err != nil {
+				if errorKind(err) == KindValidation {
+					writeAPIError(w, http.StatusBadRequest, "%v", err)
+				} else {
+					writeAnalyticsError(w, r, t.Target, err)
+				}
+				return
+			}
+			if t.Type == "table" {
+				table := grafanaTable{Type: "table", Columns: []grafanaColumn{{Text: "Time", Type: "time"}, {Text: t.Target, Type: "number"}}, Rows: [][]interface{}{}}
+				for _, p := range points {
+					table.Rows = append(table.Rows, []interface{}{p.at.UnixMilli(), p.value})
+				}
+				results = append(results, table)
+				continue
+			}
+			series := grafanaSeries{Target: t.Target, Datapoints: make([][2]float64, len(points))}
+			for i, p := range points {
+				series.Datapoints[i] = [2]float64{p.value, float64(p.at.UnixMilli())}
+			}
+			results = append(results, series)
+		}
+		writeJSON(w, http.StatusOK, results)
+
+	case "/annotations":
+		var req grafanaAnnotationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid annotation request: %v", err)
+			return
+		}
+		annotations, err := grafanaAnnotations(r.Context(), s.repo, req)
+		if err != nil {
+			if errorKind(err) == KindValidation {
+				writeAPIError(w, http.StatusBadRequest, "%v", err)
+			} else {
+				writeAnalyticsError(w, r, "annotations", err)
+			}
+			return
+		}
+		for i := range annotations {
+			annotations[i].Annotation = req.Annotation
+		}
+		writeJSON(w, http.StatusOK, annotations)
+
+	default:
+		writeAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// grafanaTargets lists the series the datasource offers, in order
+func grafanaTargets(ctx context.Context, repo *Repository) ([]string, error) {
+	targets := make([]string, 0, len(currencies)+1)
+	for _, currency := range currencies {
+		targets = append(targets, "price."+currency)
+	}
+	targets = append(targets, "fear_greed")
+
+	latest, err := repo.LatestCollectorSamples(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var metrics []string
+	for _, s := range latest {
+		metrics = append(metrics, "collector."+s.Metric)
+	}
+	slices.Sort(metrics)
+	return append(targets, metrics...), nil
+}
+
+// grafanaSeriesPoints returns the points of a target in rng, oldest first
+func grafanaSeriesPoints(ctx context.Context, repo *Repository, target string, rng grafanaRange, maxPoints int) ([]grafanaPoint, error) {
+	kind, name, _ := strings.Cut(strings.ToLower(strings.TrimSpace(target)), ".")
+	switch kind {
+	case "price":
+		if name == "" {
+			return nil, validationErrorf("target %q names no currency, e.g. price.usd", target)
+		}
+		return grafanaPricePoints(ctx, repo, name, rng, maxPoints)
+
+	case "fear_greed":
+		readings, err := repo.FearGreedRange(ctx, rng.From, rng.To)
+		if err != nil {
+			return nil, err
+		}
+		points := make([]grafanaPoint, len(readings))
+		for i, reading := range readings {
+			points[i] = grafanaPoint{reading.Day, float64(reading.Value)}
+		}
+		return points, nil
+
+	case "collector":
+		m, err := lookupCollectorMetric(name)
+		if err != nil {
+			return nil, err
+		}
+		samples, err := repo.CollectorSamples(ctx, m.Name, rng.From, rng.To, maxRangeLimit)
+		if err != nil {
+			return nil, err
+		}
+		points := make([]grafanaPoint, len(samples))
+		for i, s := range samples {
+			points[i] = grafanaPoint{s.Timestamp, s.Value}
+		}
+		return points, nil
+	}
+	return nil, validationErrorf("unknown target %q (expected price.<currency>, fear_greed, or collector.<metric>)", target)
+}
+
+// grafanaPricePoints returns the prices of currency in rng: the stored samples when
+// there are likely no more than maxPoints of them, and the closes of the finest
+// candles that fit otherwise
+func grafanaPricePoints(ctx context.Context, repo *Repository, currency string, rng grafanaRange, maxPoints int) ([]grafanaPoint, error) {
+	span := rng.To.Sub(rng.From)
+	if span/fetchInterval <= time.Duration(maxPoints) {
+		prices, err := repo.PriceRange(currency, rng.From, rng.To, maxRangeLimit)
+		if err != nil {
+			return nil, err
+		}
+		points := make([]grafanaPoint, len(prices))
+		for i, p := range prices {
+			points[i] = grafanaPoint{p.Timestamp, p.Price}
+		}
+		return points, nil
+	}
+
+	resolution := CandleHourly
+	if span/candleDuration(CandleHourly) > time.Duration(maxPoints) {
+		resolution = CandleDaily
+	}
+	candles, err := repo.Candles(ctx, currency, resolution, rng.From, rng.To, maxRangeLimit)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]grafanaPoint, len(candles))
+	for i, c := range candles {
+		points[i] = grafanaPoint{c.Start, c.Close}
+	}
+	return points, nil
+}
+
+// grafanaAnnotations returns the events an annotation query asks for in its range:
+// "anomalies", "patterns" (daily candles) or "patterns.1h", or "annotations" or
+// "annotations.<tag>"
+func grafanaAnnotations(ctx context.Context, repo *Repository, req grafanaAnnotationRequest) ([]grafanaAnnotation, error) {
+	var annotation struct {
+		Query string `json:"query"`
+	}
+	if len(req.Annotation) > 0 {
+		if err := json.Unmarshal(req.Annotation, &annotation); err != nil {
+			return nil, validationErrorf("invalid annotation: %v", err)
+		}
+	}
+
+	annotations := []grafanaAnnotation{}
+	kind, resolution, _ := strings.Cut(strings.ToLower(strings.TrimSpace(annotation.Query)), ".")
+	switch kind {
+	case "anomalies":
+		anomalies, err := repo.Anomalies(maxRangeLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range anomalies {
+			if a.DetectedAt.Before(req.Range.From) || !a.DetectedAt.Before(req.Range.To) {
+				continue
+			}
+			annotations = append(annotations, grafanaAnnotation{
+				Time:  a.DetectedAt.UnixMilli(),
+				Title: fmt.Sprintf("Anomalous %s price %s", strings.ToUpper(a.Currency), a.Action),
+				Text: fmt.Sprintf("%s from %s, %+.2f%% off the median of %s", formatPrice(a.Price), a.Source,
+					a.Deviation, formatPrice(a.Baseline)),
+				Tags: []string{"anomaly", a.Currency, a.Action},
+			})
+		}
+
+	case "patterns":
+		if resolution == "" {
+			resolution = CandleDaily
+		}
+		res, err := parseCandleResolution(resolution)
+		if err != nil {
+			return nil, withKind(KindValidation, err)
+		}
+		for _, currency := range currencies {
+			patterns, err := repo.CandlePatterns(currency, res, req.Range.From, maxRangeLimit)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range patterns {
+				if !p.Start.Before(req.Range.To) {
+					continue
+				}
+				annotations = append(annotations, grafanaAnnotation{
+					Time:  p.Start.UnixMilli(),
+					Title: fmt.Sprintf("%s (%s)", p.Pattern, p.Direction),
+					Text:  fmt.Sprintf("%s %s candle closing at %s, confidence %.0f%%", strings.ToUpper(p.Currency), p.Resolution, formatPrice(p.Close), p.Confidence*100),
+					Tags:  []string{"pattern", p.Currency, p.Direction},
+				})
+			}
+		}
+
+	case "annotations":
+		// Here the part after the dot is a tag rather than a resolution
+		stored, err := taggedAnnotations(ctx, repo, req.Range.From, req.Range.To, resolution)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range stored {
+			annotations = append(annotations, grafanaAnnotation{
+				Time:  a.Time.UnixMilli(),
+				Title: a.Text,
+				Tags:  append([]string{"annotation"}, a.Tags...),
+			})
+		}
+
+	default:
+		return nil, validationErrorf("unknown annotation query %q (expected anomalies, patterns, patterns.1h, annotations, or annotations.<tag>)", annotation.Query)
+	}
+	return annotations, nil
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"         // Package for call deadlines and server shutdown
+	"crypto/tls"      // Package for the server certificate
+	"encoding/binary" // Package for gRPC message framing
+	"errors"          // Package for inspecting call errors
+	"fmt"             // Package for formatted I/O operations
+	"io"              // Package for reading request messages
+	"log/slog"        // Package for structured logging
+	"net"             // Package for the server's base context
+	"net/http"        // Package for serving gRPC over HTTP/2
+	"os"              // Package for environment variables
+	"strconv"         // Package for status codes and timeouts
+	"strings"         // Package for string manipulation
+	"sync/atomic"     // Package for swapping the certificate on reload
+	"time"            // Package for range boundaries and timeouts
+)
+
+// grpcServicePath prefixes the path of every method of the service in proto/tracker.proto
+const grpcServicePath = "/bitcointracker.v1.PriceTracker/"
+
+// grpcMaxMessage is the largest request message accepted, in bytes
+const grpcMaxMessage = 1 << 20
+
+// gRPC status codes used by the service
+const (
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcNotFound          = 5
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+// GRPCConfig holds where the gRPC API listens and its TLS certificate
+// gRPC needs HTTP/2, which the standard library only serves over TLS
+type GRPCConfig struct {
+	Addr     string // Listen address; empty disables the gRPC API
+	CertFile string // PEM certificate chain
+	KeyFile  string // PEM private key
+}
+
+// grpcConfig is the active configuration, loaded at startup
+var grpcConfig GRPCConfig
+
+// grpcCertificate is the certificate presented to clients
+// A reload swaps it, so a renewed certificate is picked up without a restart
+var grpcCertificate atomic.Pointer[tls.Certificate]
+
+// loadGRPCConfig reads GRPC_ADDR, GRPC_TLS_CERT, and GRPC_TLS_KEY, and loads the certificate
+func loadGRPCConfig() (GRPCConfig, error) {
+	c := GRPCConfig{
+		Addr:     strings.TrimSpace(os.Getenv("GRPC_ADDR")),
+		CertFile: os.Getenv("GRPC_TLS_CERT"),
+		KeyFile:  os.Getenv("GRPC_TLS_KEY"),
+	}
+	if c.Addr == "" {
+		return c, nil
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return c, fmt.Errorf("GRPC_ADDR is set but GRPC_TLS_CERT or GRPC_TLS_KEY is not")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return c, fmt.Errorf("failed to load gRPC certificate: %w", err)
+	}
+	grpcCertificate.Store(&cert)
+	return c, nil
+}
+
+// grpcError is the status of a failed call
+type grpcError struct {
+	code    int
+	message string
+}
+
+// Error returns the status message
+func (e *grpcError) Error() string { return e.message }
+
+// grpcErrorf returns a call error with a status code
+func grpcErrorf(code int, format string, args ...interface{}) error {
+	return &grpcError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// grpcStatus returns the status code and message reported for a call's error
+func grpcStatus(err error) (int, string) {
+	var ge *grpcError
+	switch {
+	case err == nil:
+		return grpcOK, ""
+	case errors.As(err, &ge):
+		return ge.code, ge.message
+	case errors.Is(err, context.DeadlineExceeded):
+		return grpcDeadlineExceeded, "deadline exceeded"
+	case errors.Is(err, context.Canceled):
+		return grpcCanceled, "call canceled"
+	default:
+		return grpcInternal, err.Error()
+	}
+}
+
+// grpcMethod runs one call: it decodes the request message and passes each response
+// message to send, once for a unary call and once per message for a stream
+type grpcMethod func(ctx context.Context, repo *Repository, req []byte, send func(protoBuffer) error) error
+
+// grpcWriteMethods lists the methods that change something, which API_AUTH=writes
+// protects like the HTTP API's non-GET requests
+var grpcWriteMethods = map[string]bool{"TriggerFetch": true}
+
+// grpcMethods lists the service's methods by name
+var grpcMethods = map[string]grpcMethod{
+	"GetLatest":    grpcGetLatest,
+	"ListPrices":   grpcListPrices,
+	"StreamPrices": grpcStreamPrices,
+	"TriggerFetch": grpcTriggerFetch,
+}
+
+// encodePrice encodes a record as a bitcointracker.v1.Price message
+func encodePrice(p PriceRecord) protoBuffer {
+	var b protoBuffer
+	b.int64Field(1, int64(p.ID))
+	b.doubleField(2, p.Price)
+	b.stringField(3, p.Currency)
+	b.stringField(4, p.Source)
+	b.timestampField(5, p.Timestamp)
+	return b
+}
+
+// encodePriceList encodes records as a message with a repeated Price field 1, the
+// layout of ListPricesResponse and TriggerFetchResponse
+func encodePriceList(prices []PriceRecord) protoBuffer {
+	var b protoBuffer
+	for _, p := range prices {
+		b.bytesField(1, encodePrice(p))
+	}
+	return b
+}
+
+// grpcCurrency normalizes a request's currency, defaulting to the first configured one
+func grpcCurrency(v string) string {
+	if c := strings.ToLower(strings.TrimSpace(v)); c != "" {
+		return c
+	}
+	return currencies[0]
+}
+
+// decodeCurrencyRequest decodes a message whose only field is string currency = 1,
+// the layout of GetLatestRequest and StreamPricesRequest
+func decodeCurrencyRequest(req []byte) (string, error) {
+	fields, err := decodeProto(req)
+	if err != nil {
+		return "", grpcErrorf(grpcInvalidArgument, "invalid request: %v", err)
+	}
+	currency := ""
+	for _, f := range fields {
+		if f.Num == 1 && f.Wire == protoBytes {
+			currency = string(f.Bytes)
+		}
+	}
+	return grpcCurrency(currency), nil
+}
+
+// grpcGetLatest returns the newest stored price of a currency
+func grpcGetLatest(ctx context.Context, repo *Repository, req []byte, send func(protoBuffer) error) error {
+	currency, err := decodeCurrencyRequest(req)
+	if err != nil {
+		return err
+	}
+	prices, err := repo.LatestPrices(ctx, 1, currency)
+	if err != nil {
+		slog.Error("gRPC failed to fetch latest price", "error", err)
+		return grpcErrorf(grpcInternal, "failed to query prices")
+	}
+	if len(prices) == 0 {
+		return grpcErrorf(grpcNotFound, "no prices recorded for %s", currency)
+	}
+	return send(encodePrice(prices[0]))
+}
+
+// grpcListPrices returns the prices of a currency in a time range, oldest first
+// Like GET /prices, from defaults to 24 hours ago and an unset to leaves the range open
+func grpcListPrices(ctx context.Context, repo *Repository, req []byte, send func(protoBuffer) error) error {
+	fields, err := decodeProto(req)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "invalid request: %v", err)
+	}
+	currency := ""
+	from, to := time.Now().Add(-24*time.Hour), time.Time{}
+	limit := int64(defaultRangeLimit)
+	for _, f := range fields {
+		switch {
+		case f.Num == 1 && f.Wire == protoBytes:
+			currency = string(f.Bytes)
+		case f.Num == 2 && f.Wire == protoBytes:
+			from, err = decodeTimestamp(f.Bytes)
+		case f.Num == 3 && f.Wire == protoBytes:
+			to, err = decodeTimestamp(f.Bytes)
+		case f.Num == 4 && f.Wire == protoVarint:
+			limit = int64(int32(f.Int))
+		}
+		if err != nil {
+			return grpcErrorf(grpcInvalidArgument, "invalid timestamp: %v", err)
+		}
+	}
+	if !to.IsZero() && !to.After(from) {
+		return grpcErrorf(grpcInvalidArgument, "to must be after from")
+	}
+	if limit < 1 || limit > maxRangeLimit {
+		return grpcErrorf(grpcInvalidArgument, "limit must be between 1 and %d", maxRangeLimit)
+	}
+
+	prices, err := repo.PriceRange(grpcCurrency(currency), from, to, int(limit))
+	if err != nil {
+		slog.Error("gRPC failed to fetch price range", "error", err)
+		return grpcErrorf(grpcInternal, "failed to query prices")
+	}
+	return send(encodePriceList(prices))
+}
+
+// grpcStreamPrices sends the newest price of a currency, then every new sample as it
+// is stored, until the client cancels or the server shuts down
+func grpcStreamPrices(ctx context.Context, repo *Repository, req []byte, send func(protoBuffer) error) error {
+	currency, err := decodeCurrencyRequest(req)
+	if err != nil {
+		return err
+	}
+
+	// Subscribe before reading the newest price so no sample falls between the two
+	updates := livePrices.subscribe()
+	defer livePrices.unsubscribe(updates)
+	latest, err := repo.LatestPrices(ctx, 1, currency)
+	if err != nil {
+		slog.Error("gRPC failed to start price stream", "error", err)
+		return grpcErrorf(grpcInternal, "failed to query prices")
+	}
+
+	sentID := 0
+	forward := func(p PriceRecord) error {
+		if p.ID <= sentID || p.Currency != currency {
+			return nil
+		}
+		sentID = p.ID
+		return send(encodePrice(p))
+	}
+	for _, p := range latest {
+		if err := forward(p); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ctx.Err()
+			}
+			// The client went away or the server is shutting down; a client
+			// that is still there reconnects on Unavailable
+			return grpcErrorf(grpcUnavailable, "price stream closed")
+		case p, ok := <-updates:
+			if !ok {
+				return grpcErrorf(grpcUnavailable, "price stream closed")
+			}
+			if err := forward(p); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcTriggerFetch fetches and stores the current prices, then returns the newest
+// price of every configured currency
+func grpcTriggerFetch(ctx context.Context, repo *Repository, req []byte, send func(protoBuffer) error) error {
+	if _, err := decodeProto(req); err != nil {
+		return grpcErrorf(grpcInvalidArgument, "invalid request: %v", err)
+	}
+	// Like POST /fetch, fetching on request is only allowed when callers need a key
+	if !writesAuthenticated() {
+		return grpcErrorf(grpcPermissionDenied, "fetching needs API_AUTH=writes or API_AUTH=all, or passkeys (PASSKEY_RP_ID)")
+	}
+	slog.Info("Fetch triggered via gRPC")
+	if err := requestFetch(ctx, repo); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return grpcErrorf(grpcUnavailable, "fetch failed: %v", err)
+	}
+
+	prices, err := latestPerCurrency(ctx, repo)
+	if err != nil {
+		slog.Error("gRPC failed to fetch latest prices", "error", err)
+		return grpcErrorf(grpcInternal, "failed to query prices")
+	}
+	return send(encodePriceList(prices))
+}
+
+// readGRPCMessage reads the single length-prefixed request message of a call
+func readGRPCMessage(body io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "missing request message")
+	}
+	if header[0] != 0 {
+		return nil, grpcErrorf(grpcUnimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > grpcMaxMessage {
+		return nil, grpcErrorf(grpcResourceExhausted, "request message of %d bytes is larger than %d", size, grpcMaxMessage)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "truncated request message")
+	}
+	return msg, nil
+}
+
+// parseGRPCTimeout parses a grpc-timeout header, e.g. 500m or 30S
+func parseGRPCTimeout(v string) (time.Duration, bool) {
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	if len(v) < 2 || len(v) > 9 {
+		return 0, false
+	}
+	unit, ok := units[v[len(v)-1]]
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// grpcMessageEscape percent-encodes a status message, as grpc-message requires
+func grpcMessageEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isGRPCContentType reports whether a request's content type is gRPC with protobuf messages
+func isGRPCContentType(ct string) bool {
+	return ct == "application/grpc" || strings.HasPrefix(ct, "application/grpc+proto") || strings.HasPrefix(ct, "application/grpc;")
+}
+
+// authenticateGRPC checks a call's API key, sent as "authorization: Bearer <key>"
+// or "x-api-key" metadata, when API_AUTH requires one for the method
+func authenticateGRPC(repo *Repository, r *http.Request, method string) error {
+	if !apiAuthRequired(r, grpcWriteMethods[method]) {
+		return nil
+	}
+	_, err := authenticateAPIKey(repo, r)
+	if err == nil {
+		return nil
+	}
+	switch ae := err.(*apiAuthError); ae.status {
+	case http.StatusUnauthorized:
+		return grpcErrorf(grpcUnauthenticated, "%s", ae.message)
+	case http.StatusTooManyRequests:
+		return grpcErrorf(grpcResourceExhausted, "%s; retry in %s", ae.message, ae.retryAfter.Round(time.Second))
+	default:
+		return grpcErrorf(grpcInternal, "%s", ae.message)
+	}
+}
+
+// grpcServer serves the gRPC API from the repository it was started with
+type grpcServer struct {
+	repo *Repository
+}
+
+// handleGRPC serves one gRPC call
+// Responses are length-prefixed messages followed by the grpc-status and grpc-message
+// trailers; each message is flushed, so streamed prices arrive as they are stored.
+func (s *grpcServer) handleGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires POST over HTTP/2", http.StatusBadRequest)
+		return
+	}
+	if !isGRPCContentType(r.Header.Get("Content-Type")) {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, grpcServicePath)
+	method, ok := grpcMethods[name]
+	if !ok || !strings.HasPrefix(r.URL.Path, grpcServicePath) {
+		name = "unknown"
+	}
+
+	ctx := r.Context()
+	if timeout, ok := parseGRPCTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Accept-Encoding", "identity")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	send := func(msg protoBuffer) error {
+		frame := make([]byte, 5, 5+len(msg))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+		if _, err := w.Write(append(frame, msg...)); err != nil {
+			return err
+		}
+		w.(http.Flusher).Flush()
+		return nil
+	}
+
+	var err error
+	var req []byte
+	if name == "unknown" {
+		err = grpcErrorf(grpcUnimplemented, "unknown method %s", r.URL.Path)
+	} else if err = authenticateGRPC(s.repo, r, name); err == nil {
+		if req, err = readGRPCMessage(r.Body); err == nil {
+			err = method(ctx, s.repo, req, send)
+		}
+	}
+
+	// Errors the methods didn't turn into a status are unexpected, unless the
+	// client went away while a response was being written
+	code, message := grpcStatus(err)
+	if code == grpcInternal && ctx.Err() == nil && !errors.As(err, new(*grpcError)) {
+		slog.Error("gRPC call failed", "method", name, "error", err)
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", grpcMessageEscape(message))
+	}
+	incCounter("tracker_grpc_requests_total", map[string]string{"method": name, "code": strconv.Itoa(code)}, 1)
+}
+
+// startGRPCServer serves the gRPC API in the background
+// It shares the store and the live price feed with the HTTP API.
+func startGRPCServer(repo *Repository, cfg GRPCConfig) func() {
+	// Calls run under a context that ends when shutdown starts, which ends open
+	// streams so Shutdown doesn't wait on them
+	baseCtx, cancel := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           withTracing(http.HandlerFunc((&grpcServer{repo: repo}).handleGRPC)),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+		TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return grpcCertificate.Load(), nil
+			},
+		},
+	}
+	server.RegisterOnShutdown(cancel)
+	server.RegisterOnShutdown(livePrices.start(repo))
+
+	go func() {
+		slog.Info("Serving gRPC API", "addr", cfg.Addr)
+		if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			slog.Error("gRPC server stopped", "error", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"  // Package for cancelling probe queries
+	"fmt"      // Package for formatted I/O operations
+	"net/http" // Package for the probe endpoints
+	"os"       // Package for environment variables
+	"time"     // Package for staleness checks
+)
+
+// healthMaxAge is how old the newest price of a currency may get before the
+// scheduler counts as unhealthy; zero derives it from the fetch interval
+// Configured via HEALTH_MAX_AGE
+var healthMaxAge time.Duration
+
+// loadHealthMaxAge reads HEALTH_MAX_AGE (e.g. "15m"); unset means three fetch intervals
+func loadHealthMaxAge() (time.Duration, error) {
+	v := os.Getenv("HEALTH_MAX_AGE")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid HEALTH_MAX_AGE %q", v)
+	}
+	return d, nil
+}
+
+// PriceAge is the newest stored price of one currency
+type PriceAge struct {
+	Currency  string    `json:"currency"`
+	Timestamp time.Time `json:"timestamp,omitempty"` // Zero when no price is stored
+	Age       string    `json:"age,omitempty"`
+	Latency   float64   `json:"latency,omitempty"` // Seconds from quote to write of the price; 0 when unknown
+	Stale     bool      `json:"stale"`
+}
+
+// HealthReport is the body of GET /healthz and GET /readyz
+type HealthReport struct {
+	Status    string               `json:"status"` // "ok", "unhealthy", or "not ready"
+	Mode      string               `json:"mode"`   // "scheduler" or "relay" when this process fetches prices, otherwise "serve"
+	Problems  []string             `json:"problems,omitempty"`
+	Database  DatabaseStatus       `json:"database"`
+	Scheduler *SchedulerStatus     `json:"scheduler,omitempty"`
+	LastFetch map[string]time.Time `json:"last_fetch,omitempty"` // Last successful fetch per asset
+	MaxAge    string               `json:"max_age"`
+	Prices    []PriceAge           `json:"prices"`
+}
+
+// checkHealth gathers database connectivity, scheduler progress, and the age of the
+// newest price of every configured currency (in relay mode, of the last relayed price)
+// Readiness problems (the database is unreachable) make the tracker unable to serve
+// anything; liveness problems (a scheduler loop that stopped running, or prices that
+// stopped arriving) mean the fetch side is wedged even though the process answers
+func checkHealth(ctx context.Context, repo *Repository) (report HealthReport, ready, live bool) {
+	now := time.Now()
+	report = HealthReport{Mode: "serve", Prices: []PriceAge{}}
+
+	daemon.mu.Lock()
+	scheduled, paused, startedAt := daemon.scheduled, daemon.paused, daemon.startedAt
+	standby := daemon.standby != nil
+	lastRelayed := daemon.lastSuccess["bitcoin"]
+	interval, nextRun := max(daemon.interval, fetchInterval), daemon.nextRun
+	if scheduled {
+		report.Mode = "scheduler"
+		report.Scheduler = &SchedulerStatus{
+			State:       daemon.schedulerState,
+			Paused:      paused,
+			Interval:    daemon.interval.String(),
+			NextRun:     nextRun,
+			LastError:   daemon.lastError,
+			LastErrorAt: daemon.lastErrorAt,
+			HeldBack:    daemon.heldBack(now),
+			Standby:     daemon.standby,
+			PromotedAt:  daemon.promotedAt,
+		}
+		report.LastFetch = make(map[string]time.Time, len(daemon.lastSuccess))
+		for asset, t := range daemon.lastSuccess {
+			report.LastFetch[asset] = t
+		}
+	}
+	daemon.mu.Unlock()
+
+	maxAge := healthMaxAge
+	if maxAge == 0 {
+		maxAge = 3 * interval
+	}
+	report.MaxAge = maxAge.String()
+	ready, live = true, true
+
+	if repo == nil {
+		// Relay mode keeps no database; it is healthy while prices keep being relayed
+		report.Mode = "relay"
+		if lastRelayed.IsZero() {
+			lastRelayed = startedAt
+		}
+		if now.Sub(lastRelayed) > maxAge {
+			report.Problems = append(report.Problems, "nothing relayed for more than "+maxAge.String())
+			live = false
+		}
+	} else if err := repo.Ping(ctx); err != nil {
+		report.Database.Error = err.Error()
+		report.Problems = append(report.Problems, "database unreachable: "+err.Error())
+		ready = false
+	} else {
+		report.Database.Connected = true
+		for _, currency := range currencies {
+			p := PriceAge{Currency: currency}
+			latest, err := repo.LatestPrices(ctx, 1, currency)
+			if err != nil {
+				report.Problems = append(report.Problems, fmt.Sprintf("failed to read the newest %s price: %v", currency, err))
+				ready = false
+				continue
+			}
+			if len(latest) > 0 {
+				p.Timestamp, p.Latency = latest[0].Timestamp, latest[0].Latency
+				p.Age = now.Sub(p.Timestamp).Round(time.Second).String()
+			}
+			p.Stale = p.Timestamp.IsZero() || now.Sub(p.Timestamp) > maxAge
+			report.Prices = append(report.Prices, p)
+
+			// Only a process that fetches can fix stale prices, and not while paused or
+			// waiting as a standby
+			if p.Stale && scheduled && !paused && !standby {
+				report.Problems = append(report.Problems, fmt.Sprintf("newest %s price is older than %s", currency, maxAge))
+				live = false
+			}
+		}
+	}
+
+	// A fetch that hasn't started a full interval plus the fetch deadline after it was
+	// due means the scheduler loop is stuck
+	if daemon.overdue(now) {
+		report.Problems = append(report.Problems, "scheduler overdue since "+nextRun.Format(time.RFC3339))
+		live = false
+	}
+
+	switch {
+	case !ready:
+		report.Status = "not ready"
+	case !live:
+		report.Status = "unhealthy"
+	default:
+		report.Status = "ok"
+	}
+	return report, ready, live
+}
+
+// handleHealthz serves GET /healthz, the liveness probe
+// It answers 503 when the scheduler in this process is wedged: its loop is overdue or
+// prices stopped arriving. A lost database connection alone fails only /readyz.
+func (s *apiServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	report, _, live := checkHealth(r.Context(), s.repo)
+	status := http.StatusOK
+	if !live {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// handleReadyz serves GET /readyz, the readiness probe
+// It answers 503 while the database is unreachable, so no traffic is routed to a
+// tracker that can't answer queries
+func (s *apiServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	report, ready, _ := checkHealth(r.Context(), s.repo)
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
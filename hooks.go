@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"         // Package for capturing hook output
+	"context"       // Package for hook timeouts
+	"encoding/json" // Package for the record passed on stdin
+	"fmt"           // Package for formatted errors
+	"log/slog"      // Package for structured logging
+	"os"            // Package for environment variables
+	"os/exec"       // Package for running external hooks
+	"strconv"       // Package for the hook environment
+	"strings"       // Package for parsing PRICE_HOOKS
+	"time"          // Package for hook timeouts
+)
+
+// PriceHook is custom logic run with every newly stored price, e.g. to update a display
+// or publish somewhere the event sinks don't reach. Hooks compiled into the tracker
+// register themselves with registerPriceHook from an init function in their own file;
+// external programs are run by the exec hooks of PRICE_HOOKS.
+type PriceHook interface {
+	Name() string
+	OnPrice(ctx context.Context, repo *Repository, record PriceRecord) error
+}
+
+// builtinPriceHooks are the hooks registered by registerPriceHook
+var builtinPriceHooks []PriceHook
+
+// priceHooks are the hooks run after every fetch: the registered ones, then those of
+// PRICE_HOOKS in order
+var priceHooks []PriceHook
+
+// priceHookTimeout bounds one run of a hook
+// Configured via PRICE_HOOK_TIMEOUT (Go duration)
+var priceHookTimeout = 10 * time.Second
+
+// registerPriceHook adds a hook run with every newly stored price; call it from init
+func registerPriceHook(h PriceHook) {
+	builtinPriceHooks = append(builtinPriceHooks, h)
+}
+
+// loadHookConfig reads PRICE_HOOKS, a comma-separated list of commands with their
+// arguments (e.g. "/usr/local/bin/show-price --large,notify.sh"), and PRICE_HOOK_TIMEOUT
+func loadHookConfig() error {
+	timeout := 10 * time.Second
+	if v := os.Getenv("PRICE_HOOK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid PRICE_HOOK_TIMEOUT %q", v)
+		}
+		timeout = d
+	}
+
+	hooks := append([]PriceHook(nil), builtinPriceHooks...)
+	for _, command := range strings.Split(os.Getenv("PRICE_HOOKS"), ",") {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			continue
+		}
+		path, err := exec.LookPath(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid PRICE_HOOKS command %q: %w", args[0], err)
+		}
+		hooks = append(hooks, execHook{path: path, args: args[1:]})
+	}
+
+	priceHookTimeout = timeout
+	priceHooks = hooks
+	return nil
+}
+
+// runPriceHooks runs every hook with each stored record, in order
+// Each run gets PRICE_HOOK_TIMEOUT. A hook that fails or panics is logged and counted,
+// and never fails the fetch or keeps the other hooks from running.
+func runPriceHooks(ctx context.Context, repo *Repository, records []PriceRecord) {
+	for _, hook := range priceHooks {
+		for _, r := range records {
+			start := time.Now()
+			err := runRecovered("hook", func() error {
+				ctx, cancel := context.WithTimeout(ctx, priceHookTimeout)
+				defer cancel()
+				return hook.OnPrice(ctx, repo, r)
+			})
+			result := "ok"
+			if err != nil {
+				result = "error"
+				slog.Error("Price hook failed", "hook", hook.Name(), "currency", r.Currency, "id", r.ID, "error", err)
+			} else {
+				slog.Debug("Ran price hook", "hook", hook.Name(), "currency", r.Currency, "id", r.ID, "duration", time.Since(start).Round(time.Millisecond))
+			}
+			incCounter("tracker_price_hook_runs_total", map[string]string{"hook": hook.Name(), "result": result}, 1)
+		}
+	}
+}
+
+// hookOutputLimit is how much of a failed exec hook's output its error quotes
+const hookOutputLimit = 512
+
+// execHook runs an external program with each new price
+// The record is written to its stdin as one line of JSON, and the main fields are also
+// passed as TRACKER_* environment variables for shell scripts. The program must exit
+// with status 0 within PRICE_HOOK_TIMEOUT.
+type execHook struct {
+	path string   // Resolved executable
+	args []string // Arguments after the executable
+}
+
+// Name identifies the hook in logs and metrics
+func (h execHook) Name() string { return "exec " + h.path }
+
+// OnPrice implements PriceHook
+func (h execHook) OnPrice(ctx context.Context, repo *Repository, record PriceRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode price: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, h.path, h.args...)
+	cmd.Stdin = bytes.NewReader(append(body, '\n'))
+	cmd.Env = append(os.Environ(),
+		"TRACKER_ASSET=bitcoin",
+		"TRACKER_PRICE_ID="+strconv.Itoa(record.ID),
+		"TRACKER_PRICE="+strconv.FormatFloat(record.Price, 'f', -1, 64),
+		"TRACKER_CURRENCY="+record.Currency,
+		"TRACKER_SOURCE="+record.Source,
+		"TRACKER_TIMESTAMP="+record.Timestamp.UTC().Format(time.RFC3339),
+	)
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("hook timed out after %s", priceHookTimeout)
+		}
+		out := strings.TrimSpace(output.String())
+		if len(out) > hookOutputLimit {
+			out = "..." + out[len(out)-hookOutputLimit:]
+		}
+		if out != "" {
+			return fmt.Errorf("hook failed: %w: %s", err, out)
+		}
+		return fmt.Errorf("hook failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/tls"  // Package for the minimum TLS version and root CAs
+	"crypto/x509" // Package for the CA bundle
+	"fmt"         // Package for formatted errors
+	"net"         // Package for dialing and matching NO_PROXY addresses
+	"net/http"    // Package for the transport
+	"net/url"     // Package for parsing proxy URLs
+	"os"          // Package for environment variables and the CA bundle
+	"strings"     // Package for string manipulation
+	"time"        // Package for connect timeouts
+)
+
+// Outgoing requests (price providers, notifications, webhooks, and event sinks) share
+// httpClient. Its transport is built from the environment at startup and on every
+// reload, so a server that only reaches the internet through a proxy with a private
+// CA can fetch prices.
+
+// HTTPClientConfig controls how outgoing requests connect
+type HTTPClientConfig struct {
+	Timeout        time.Duration // Limit of a whole request, HTTP_TIMEOUT
+	ConnectTimeout time.Duration // Limit of connecting and the TLS handshake
+	HTTPProxy      *url.URL      // Proxy of http:// requests; nil connects directly
+	HTTPSProxy     *url.URL      // Proxy of https:// requests; nil connects directly
+	NoProxy        []string      // Hosts, domains, and CIDRs reached directly
+	CABundle       string        // PEM file of CAs trusted on top of the system's
+	RootCAs        *x509.CertPool
+	TLSMinVersion  uint16
+}
+
+// tlsVersions maps HTTP_TLS_MIN_VERSION values to their versions
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// proxyEnv returns an env var, or its lowercase spelling as curl and Go also accept
+func proxyEnv(name string) (string, string) {
+	if v := os.Getenv(name); v != "" {
+		return name, v
+	}
+	lower := strings.ToLower(name)
+	return lower, os.Getenv(lower)
+}
+
+// parseProxyURL parses a proxy address; one without a scheme, e.g. "proxy:3128", is
+// an HTTP proxy
+func parseProxyURL(name, v string) (*url.URL, error) {
+	if !strings.Contains(v, "://") {
+		v = "http://" + v
+	}
+	u, err := url.Parse(v)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+		return nil, fmt.Errorf("invalid %s %q (expected a URL such as http://proxy.example.com:3128)", name, v)
+	}
+	return u, nil
+}
+
+// loadHTTPClientConfig reads HTTP_TIMEOUT, HTTP_CONNECT_TIMEOUT, HTTP_PROXY, HTTPS_PROXY,
+// NO_PROXY, HTTP_CA_BUNDLE, and HTTP_TLS_MIN_VERSION (1.2 or 1.3)
+func loadHTTPClientConfig() (HTTPClientConfig, error) {
+	c := HTTPClientConfig{ConnectTimeout: 10 * time.Second, TLSMinVersion: tls.VersionTLS12}
+	timeout, err := loadHTTPTimeout()
+	if err != nil {
+		return c, err
+	}
+	c.Timeout = timeout
+
+	if v := os.Getenv("HTTP_CONNECT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid HTTP_CONNECT_TIMEOUT %q", v)
+		}
+		c.ConnectTimeout = d
+	}
+
+	if name, v := proxyEnv("HTTP_PROXY"); v != "" {
+		if c.HTTPProxy, err = parseProxyURL(name, v); err != nil {
+			return c, err
+		}
+	}
+	if name, v := proxyEnv("HTTPS_PROXY"); v != "" {
+		if c.HTTPSProxy, err = parseProxyURL(name, v); err != nil {
+			return c, err
+		}
+	}
+	if _, v := proxyEnv("NO_PROXY"); v != "" {
+		for _, entry := range strings.Split(v, ",") {
+			if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+				c.NoProxy = append(c.NoProxy, entry)
+			}
+		}
+	}
+
+	if c.CABundle = os.Getenv("HTTP_CA_BUNDLE"); c.CABundle != "" {
+		pem, err := os.ReadFile(c.CABundle)
+		if err != nil {
+			return c, fmt.Errorf("failed to read HTTP_CA_BUNDLE: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return c, fmt.Errorf("HTTP_CA_BUNDLE %s contains no PEM certificates", c.CABundle)
+		}
+		c.RootCAs = pool
+	}
+
+	if v := os.Getenv("HTTP_TLS_MIN_VERSION"); v != "" {
+		version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(v), "tls")]
+		if !ok {
+			return c, fmt.Errorf("invalid HTTP_TLS_MIN_VERSION %q (expected 1.2 or 1.3)", v)
+		}
+		c.TLSMinVersion = version
+	}
+	return c, nil
+}
+
+// bypassProxy reports whether host (with an optional port) is reached directly: it is
+// loopback, or NO_PROXY names it, one of its parent domains, or a CIDR holding it.
+// "*" bypasses the proxy for every host.
+func (c HTTPClientConfig) bypassProxy(host string) bool {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name = host
+	}
+	name = strings.ToLower(name)
+	ip := net.ParseIP(name)
+	if name == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+
+	for _, entry := range c.NoProxy {
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			if p != port {
+				continue
+			}
+			entry = h
+		}
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		// ".example.com" matches only subdomains, "example.com" the domain as well
+		if strings.HasPrefix(entry, ".") {
+			if strings.HasSuffix(name, entry) {
+				return true
+			}
+		} else if name == entry || strings.HasSuffix(name, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxy picks the proxy of a request, as http.Transport.Proxy
+func (c HTTPClientConfig) proxy(req *http.Request) (*url.URL, error) {
+	proxy := c.HTTPProxy
+	if req.URL.Scheme == "https" {
+		proxy = c.HTTPSProxy
+	}
+	if proxy == nil || c.bypassProxy(req.URL.Host) {
+		return nil, nil
+	}
+	return proxy, nil
+}
+
+// newHTTPTransport builds the transport of httpClient
+func newHTTPTransport(c HTTPClientConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = c.proxy
+	t.DialContext = (&net.Dialer{Timeout: c.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	t.TLSHandshakeTimeout = c.ConnectTimeout
+	t.TLSClientConfig = &tls.Config{RootCAs: c.RootCAs, MinVersion: c.TLSMinVersion}
+	return t
+}
+
+// applyHTTPClientConfig switches httpClient to c, closing the idle connections of the
+// transport it replaces
+func applyHTTPClientConfig(c HTTPClientConfig) {
+	if old, ok := httpClient.Transport.(*http.Transport); ok {
+		old.CloseIdleConnections()
+	}
+	httpClient.Timeout = c.Timeout
+	httpClient.Transport = newHTTPTransport(c)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"      // Package for cancelling a running import
+	"encoding/csv" // Package for reading the import file
+	"errors"       // Package for the end of the import file
+	"fmt"          // Package for formatted I/O operations
+	"io"           // Package for reading the import file
+	"log/slog"     // Package for structured logging
+	"math"         // Package for rejecting non-finite prices
+	"os"           // Package for the import file
+	"slices"       // Package for matching column names
+	"strconv"      // Package for parsing prices and Unix times
+	"strings"      // Package for string manipulation
+	"time"         // Package for timestamps
+)
+
+// Prices exported by exchanges and other trackers are merged into the price history with
+// `import`. The first row of the CSV file names the columns: a time and a price column
+// are required and found by their usual names, or named with --map, e.g.
+// --map 'time=Date (UTC),price=Close'. Rows without a currency column are in --currency.
+// Every row is validated before anything is written; an invalid row stops the import
+// with its line number, or is skipped with --skip-invalid. A row in the same currency
+// and minute as an earlier row of the file or a stored price is a duplicate and is
+// skipped, so importing a file twice adds nothing the second time. Afterwards, the
+// candles and everything else derived from prices are rebuilt from the earliest
+// imported price on, as after a backfill.
+
+// importSource is the source stored with imported prices that don't name one
+const importSource = "import"
+
+// importColumns are the column names an import file may use, by field, in any case;
+// --map overrides them
+var importColumns = map[string][]string{
+	"time":       {"time", "timestamp", "date", "datetime", "snapped_at", "open time", "date (utc)"},
+	"price":      {"price", "close", "rate", "last", "value"},
+	"currency":   {"currency", "fiat", "quote", "vs_currency"},
+	"source":     {"source", "exchange", "provider"},
+	"volume":     {"volume", "total_volume", "volume_24h"},
+	"market_cap": {"market_cap", "marketcap"},
+}
+
+// importLayouts are the time layouts accepted besides those of price-at, e.g. CoinGecko's
+// "2024-01-01 00:00:00 UTC"; a time without a zone is UTC
+var importLayouts = []string{
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05.000",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"01/02/2006",
+}
+
+// ImportOptions control how an import file is read
+type ImportOptions struct {
+	Columns     map[string]string // Column name by field, from --map
+	Currency    string            // Currency of rows without a currency column
+	Source      string            // Source of rows without a source column
+	TimeFormat  string            // Go layout, unix, or unixms; empty tries the usual formats
+	Delimiter   rune              // Field separator, from --delimiter
+	SkipInvalid bool              // Skip invalid rows instead of stopping
+}
+
+// ImportResult counts what an import did with the rows of its file
+type ImportResult struct {
+	Rows       int // Data rows read, blank ones left out
+	Invalid    int // Rows skipped as invalid
+	Duplicates int // Rows skipped as repeating an earlier row of the file
+	Stored     int // Rows skipped as already stored
+	Imported   int // New rows written
+}
+
+// parseImportMap parses --map, e.g. "time=Date,price=Close (USD)"
+func parseImportMap(v string) (map[string]string, error) {
+	columns := map[string]string{}
+	if strings.TrimSpace(v) == "" {
+		return columns, nil
+	}
+	for _, pair := range strings.Split(v, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if _, known := importColumns[field]; !ok || !known || strings.TrimSpace(column) == "" {
+			return nil, validationErrorf("invalid --map entry %q (expected field=column with field one of time, price, currency, source, volume, market_cap)", pair)
+		}
+		columns[field] = strings.ToLower(strings.TrimSpace(column))
+	}
+	return columns, nil
+}
+
+// parseImportTime parses a time value in layout: a Go layout, unix, unixms, or empty
+// for the usual formats, where 13-digit numbers are Unix milliseconds
+func parseImportTime(v, layout string) (time.Time, error) {
+	switch layout {
+	case "":
+		if len(v) == 13 {
+			if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return time.UnixMilli(ms).UTC(), nil
+			}
+		}
+		for _, l := range importLayouts {
+			if t, err := time.Parse(l, v); err == nil {
+				return t, nil
+			}
+		}
+		return parsePriceTimeIn(v, time.UTC)
+	case "unix", "unixms":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid Unix time %q", v)
+		}
+		if layout == "unixms" {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	default:
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q (expected the layout %s)", v, layout)
+		}
+		return t, nil
+	}
+}
+
+// parseImportNumber parses a price, volume, or market cap, allowing thousands separators
+func parseImportNumber(name, v string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.ReplaceAll(v, ",", ""), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return f, nil
+}
+
+// readImport reads and validates the prices of an import file, in file order
+// The result counts the rows read, invalid, and duplicated within the file.
+func readImport(r io.Reader, opts ImportOptions) ([]PriceRecord, ImportResult, error) {
+	var result ImportResult
+	cr := csv.NewReader(r)
+	cr.Comma = opts.Delimiter
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, result, fmt.Errorf("failed to read the header row: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for field, names := range importColumns {
+			if _, seen := columns[field]; seen {
+				continue
+			}
+			if mapped, ok := opts.Columns[field]; ok {
+				if name == mapped {
+					columns[field] = i
+				}
+			} else if slices.Contains(names, name) {
+				columns[field] = i
+			}
+		}
+	}
+	for field, mapped := range opts.Columns {
+		if _, ok := columns[field]; !ok {
+			return nil, result, fmt.Errorf("no column %q for %s in the header row", mapped, field)
+		}
+	}
+	for _, field := range []string{"time", "price"} {
+		if _, ok := columns[field]; !ok {
+			return nil, result, fmt.Errorf("no %s column (expected one of %s, or name it with --map %s=<column>)",
+				field, strings.Join(importColumns[field], ", "), field)
+		}
+	}
+
+	var records []PriceRecord
+	seen := map[string]bool{} // Currency and minute of every valid row so far
+	now := time.Now()
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, result, fmt.Errorf("failed to read line %d: %w", line, err)
+		}
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		result.Rows++
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		rec, err := importRecord(field, opts, now)
+		if err != nil {
+			if !opts.SkipInvalid {
+				return nil, result, fmt.Errorf("line %d: %w", line, err)
+			}
+			slog.Warn("Skipping invalid import row", "line", line, "error", err)
+			result.Invalid++
+			continue
+		}
+		key := rec.Currency + " " + rec.Timestamp.Format("2006-01-02T15:04")
+		if seen[key] {
+			result.Duplicates++
+			continue
+		}
+		seen[key] = true
+		records = append(records, rec)
+	}
+	return records, result, nil
+}
+
+// importRecord validates one row of an import file, given its fields by name
+func importRecord(field func(string) string, opts ImportOptions, now time.Time) (PriceRecord, error) {
+	rec := PriceRecord{Currency: opts.Currency, Source: opts.Source}
+	ts, err := parseImportTime(field("time"), opts.TimeFormat)
+	if err != nil {
+		return rec, err
+	}
+	if rec.Timestamp = ts.UTC(); rec.Timestamp.After(now.Add(time.Minute)) {
+		return rec, fmt.Errorf("time %s is in the future", rec.Timestamp.Format(time.RFC3339))
+	}
+	if rec.Price, err = parseImportNumber("price", field("price")); err != nil {
+		return rec, err
+	}
+	if rec.Price == 0 {
+		return rec, fmt.Errorf("invalid price %q (expected a price above 0)", field("price"))
+	}
+	if v := field("currency"); v != "" {
+		rec.Currency = strings.ToLower(v)
+	}
+	if !slices.Contains(currencies, rec.Currency) {
+		return rec, fmt.Errorf("currency %q is not tracked (CURRENCIES is %s)", rec.Currency, strings.Join(currencies, ","))
+	}
+	if v := field("source"); v != "" {
+		rec.Source = strings.ToLower(v)
+	}
+	if v := field("volume"); v != "" {
+		if rec.Volume, err = parseImportNumber("volume", v); err != nil {
+			return rec, err
+		}
+	}
+	if v := field("market_cap"); v != "" {
+		if rec.MarketCap, err = parseImportNumber("market cap", v); err != nil {
+			return rec, err
+		}
+	}
+	return rec, nil
+}
+
+// importPrices writes the records, skipping those already stored, and rebuilds the
+// derived data of each currency from its earliest record on
+func importPrices(ctx context.Context, repo *Repository, records []PriceRecord, result *ImportResult) (err error) {
+	writer := newPriceWriter(ctx, repo, "import", writeBatchConfig.Size, writeBatchConfig.Interval, nil)
+	defer func() {
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+		result.Imported = writer.Inserted()
+		if err == nil {
+			result.Stored = len(records) - result.Imported
+		}
+	}()
+
+	earliest := map[string]time.Time{}
+	for _, r := range records {
+		if first, ok := earliest[r.Currency]; !ok || r.Timestamp.Before(first) {
+			earliest[r.Currency] = r.Timestamp
+		}
+		if err := writer.Add(r); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	for _, currency := range currencies {
+		if from, ok := earliest[currency]; ok {
+			if err := rebuildDerivedData(repo, currency, from); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runImportCommand handles "import [flags] <file.csv|->"
+func runImportCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("import")
+	mapFlag := fs.String("map", "", "Columns by field, e.g. time=Date,price=Close (default: found by their usual names)")
+	currency := fs.String("currency", currencies[0], "Currency of rows without a currency column")
+	source := fs.String("source", importSource, "Source stored with rows without a source column")
+	timeFormat := fs.String("time-format", "", "Go layout of the times, or unix or unixms (default: RFC 3339, dates, and Unix times)")
+	delimiter := fs.String("delimiter", ",", "Field separator, e.g. ; or tab")
+	skipInvalid := fs.Bool("skip-invalid", false, "Skip invalid rows instead of stopping at the first")
+	dryRun := fs.Bool("dry-run", false, "Validate the file and report what would be imported without writing")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if fs.NArg() != 1 {
+		return validationErrorf("usage: import [--map time=Date,price=Close] [--currency usd] [flags] <file.csv|->")
+	}
+
+	opts := ImportOptions{
+		Currency:    strings.ToLower(*currency),
+		Source:      *source,
+		TimeFormat:  *timeFormat,
+		SkipInvalid: *skipInvalid,
+	}
+	var err error
+	if opts.Columns, err = parseImportMap(*mapFlag); err != nil {
+		return err
+	}
+	switch d := []rune(*delimiter); {
+	case *delimiter == "tab" || *delimiter == `\t`:
+		opts.Delimiter = '\t'
+	case len(d) == 1 && d[0] != '"' && d[0] != '\n' && d[0] != '\r':
+		opts.Delimiter = d[0]
+	default:
+		return validationErrorf("invalid --delimiter %q (expected a single character or tab)", *delimiter)
+	}
+
+	in := os.Stdin
+	path := fs.Arg(0)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open import file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	records, result, err := readImport(in, opts)
+	if err != nil {
+		return validationErrorf("invalid import file %s: %v", path, err)
+	}
+
+	if *dryRun {
+		slog.Info("Dry run: import file is valid, nothing was written", "file", path, "rows", result.Rows,
+			"valid", len(records), "invalid", result.Invalid, "duplicates", result.Duplicates)
+		return nil
+	}
+	err = importPrices(ctx, repo, records, &result)
+	slog.Info("Imported prices", "file", path, "rows", result.Rows, "imported", result.Imported,
+		"already_stored", result.Stored, "duplicates", result.Duplicates, "invalid", result.Invalid)
+	return err
+}
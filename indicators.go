@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"  // Package for candle queries
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for square roots and NaN
+	"net/http" // Package for the HTTP API
+	"os"       // Package for environment variables
+	"regexp"   // Package for validating indicator names
+	"slices"   // Package for sorting indicator names
+	"strconv"  // Package for parsing windows and counts
+	"strings"  // Package for string manipulation
+	"time"     // Package for candle ranges
+)
+
+// IndicatorConfig lists the windows (in candles) each indicator is computed over
+type IndicatorConfig struct {
+	SMA        []int   // Simple moving averages, e.g. 50 and 200 for golden crosses
+	EMA        []int   // Exponential moving averages
+	RSI        []int   // Relative strength indexes (Wilder's smoothing)
+	Bollinger  []int   // Bollinger bands around the SMA of the same window
+	BollingerK float64 // Band width in standard deviations
+}
+
+// indicatorConfig is the active indicator configuration, loaded at startup
+var indicatorConfig = IndicatorConfig{SMA: []int{50, 200}, EMA: []int{12, 26}, RSI: []int{14}, Bollinger: []int{20}, BollingerK: 2}
+
+// maxIndicatorWindow keeps the warm-up of every indicator within one page of candles
+const maxIndicatorWindow = 1000
+
+// IndicatorValue is one indicator's value at the close of one candle
+type IndicatorValue struct {
+	Currency   string    `json:"currency"`
+	Resolution string    `json:"resolution"`
+	Start      time.Time `json:"start"` // Start of the candle (UTC)
+	Name       string    `json:"name"`  // e.g. sma50, ema12, rsi14, bb20_upper
+	Value      float64   `json:"value"`
+}
+
+// IndicatorPoint is every indicator of one candle, as served by GET /indicators
+type IndicatorPoint struct {
+	Start  time.Time          `json:"start"`
+	Values map[string]float64 `json:"values"`
+}
+
+// parseIndicatorWindows parses a comma-separated window list; "none" disables the indicator
+func parseIndicatorWindows(env string, fallback []int) ([]int, error) {
+	v := strings.TrimSpace(os.Getenv(env))
+	switch v {
+	case "":
+		return fallback, nil
+	case "none":
+		return nil, nil
+	}
+
+	var windows []int
+	for _, part := range strings.Split(v, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 2 || n > maxIndicatorWindow {
+			return nil, fmt.Errorf("invalid %s %q (windows must be between 2 and %d candles)", env, v, maxIndicatorWindow)
+		}
+		if !slices.Contains(windows, n) {
+			windows = append(windows, n)
+		}
+	}
+	return windows, nil
+}
+
+// loadIndicatorConfig reads INDICATOR_SMA, INDICATOR_EMA, INDICATOR_RSI,
+// INDICATOR_BOLLINGER, and INDICATOR_BOLLINGER_K
+func loadIndicatorConfig() (IndicatorConfig, error) {
+	cfg := IndicatorConfig{BollingerK: 2}
+	var err error
+	if cfg.SMA, err = parseIndicatorWindows("INDICATOR_SMA", []int{50, 200}); err != nil {
+		return cfg, err
+	}
+	if cfg.EMA, err = parseIndicatorWindows("INDICATOR_EMA", []int{12, 26}); err != nil {
+		return cfg, err
+	}
+	if cfg.RSI, err = parseIndicatorWindows("INDICATOR_RSI", []int{14}); err != nil {
+		return cfg, err
+	}
+	if cfg.Bollinger, err = parseIndicatorWindows("INDICATOR_BOLLINGER", []int{20}); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("INDICATOR_BOLLINGER_K"); v != "" {
+		k, err := strconv.ParseFloat(v, 64)
+		if err != nil || k <= 0 {
+			return cfg, fmt.Errorf("invalid INDICATOR_BOLLINGER_K %q", v)
+		}
+		cfg.BollingerK = k
+	}
+	return cfg, nil
+}
+
+// names returns the name of every configured indicator series
+func (c IndicatorConfig) names() []string {
+	var names []string
+	for _, n := range c.SMA {
+		names = append(names, fmt.Sprintf("sma%d", n))
+	}
+	for _, n := range c.EMA {
+		names = append(names, fmt.Sprintf("ema%d", n))
+	}
+	for _, n := range c.RSI {
+		names = append(names, fmt.Sprintf("rsi%d", n))
+	}
+	for _, n := range c.Bollinger {
+		names = append(names, fmt.Sprintf("bb%d_upper", n), fmt.Sprintf("bb%d_middle", n), fmt.Sprintf("bb%d_lower", n))
+	}
+	return names
+}
+
+// warmup returns how many candles before the first stored value are needed
+// Averages need one window; EMA and RSI carry every earlier candle with a fading
+// weight, so they get three windows to settle
+func (c IndicatorConfig) warmup() int {
+	n := 0
+	for _, w := range append(slices.Clone(c.SMA), c.Bollinger...) {
+		n = max(n, w)
+	}
+	for _, w := range append(slices.Clone(c.EMA), c.RSI...) {
+		n = max(n, 3*w)
+	}
+	return n
+}
+
+// nanSeries returns a series of n undefined values
+func nanSeries(n int) []float64 {
+	s := make([]float64, n)
+	for i := range s {
+		s[i] = math.NaN()
+	}
+	return s
+}
+
+// sma returns the simple moving average of closes over window; earlier values are NaN
+func sma(closes []float64, window int) []float64 {
+	out := nanSeries(len(closes))
+	sum := 0.0
+	for i, c := range closes {
+		sum += c
+		if i >= window {
+			sum -= closes[i-window]
+		}
+		if i >= window-1 {
+			out[i] = sum / float64(window)
+		}
+	}
+	return out
+}
+
+// ema returns the exponential moving average of closes over window, seeded with
+// the SMA of the first window closes; earlier values are NaN
+func ema(closes []float64, window int) []float64 {
+	out := nanSeries(len(closes))
+	if len(closes) < window {
+		return out
+	}
+	alpha := 2 / float64(window+1)
+	prev := sma(closes[:window], window)[window-1]
+	out[window-1] = prev
+	for i := window; i < len(closes); i++ {
+		prev = alpha*closes[i] + (1-alpha)*prev
+		out[i] = prev
+	}
+	return out
+}
+
+// rsi returns the relative strength index of closes over window using Wilder's
+// smoothing; the first value needs window changes, so window+1 closes
+func rsi(closes []float64, window int) []float64 {
+	out := nanSeries(len(closes))
+	if len(closes) <= window {
+		return out
+	}
+
+	var gain, loss float64
+	for i := 1; i <= window; i++ {
+		if d := closes[i] - closes[i-1]; d > 0 {
+			gain += d
+		} else {
+			loss -= d
+		}
+	}
+	gain, loss = gain/float64(window), loss/float64(window)
+
+	index := func() float64 {
+		if loss == 0 {
+			return 100
+		}
+		return 100 - 100/(1+gain/loss)
+	}
+	out[window] = index()
+	for i := window + 1; i < len(closes); i++ {
+		d := closes[i] - closes[i-1]
+		g, l := max(d, 0), max(-d, 0)
+		gain = (gain*float64(window-1) + g) / float64(window)
+		loss = (loss*float64(window-1) + l) / float64(window)
+		out[i] = index()
+	}
+	return out
+}
+
+// bollinger returns the upper, middle, and lower bands of closes over window:
+// the SMA plus and minus k population standard deviations
+func bollinger(closes []float64, window int, k float64) (upper, middle, lower []float64) {
+	middle = sma(closes, window)
+	upper, lower = nanSeries(len(closes)), nanSeries(len(closes))
+	for i := window - 1; i < len(closes); i++ {
+		variance := 0.0
+		for _, c := range closes[i-window+1 : i+1] {
+			variance += (c - middle[i]) * (c - middle[i])
+		}
+		sd := math.Sqrt(variance / float64(window))
+		upper[i], lower[i] = middle[i]+k*sd, middle[i]-k*sd
+	}
+	return upper, middle, lower
+}
+
+// computeIndicators returns every configured indicator series over closes
+func computeIndicators(closes []float64, cfg IndicatorConfig) map[string][]float64 {
+	series := make(map[string][]float64)
+	for _, n := range cfg.SMA {
+		series[fmt.Sprintf("sma%d", n)] = sma(closes, n)
+	}
+	for _, n := range cfg.EMA {
+		series[fmt.Sprintf("ema%d", n)] = ema(closes, n)
+	}
+	for _, n := range cfg.RSI {
+		series[fmt.Sprintf("rsi%d", n)] = rsi(closes, n)
+	}
+	for _, n := range cfg.Bollinger {
+		upper, middle, lower := bollinger(closes, n, cfg.BollingerK)
+		series[fmt.Sprintf("bb%d_upper", n)] = upper
+		series[fmt.Sprintf("bb%d_middle", n)] = middle
+		series[fmt.Sprintf("bb%d_lower", n)] = lower
+	}
+	return series
+}
+
+// updateIndicators recomputes and stores the indicators of every candle starting at
+// or after from (zero = all candles), reading enough earlier candles to warm them up
+// It returns the number of candles updated
+func updateIndicators(repo *Repository, currency, resolution string, from time.Time) (int, error) {
+	cfg := indicatorConfig
+	if len(cfg.names()) == 0 {
+		return 0, nil
+	}
+
+	start := time.Time{}
+	if !from.IsZero() {
+		start = from.Add(-time.Duration(cfg.warmup()) * candleDuration(resolution))
+	}
+	var candles []Candle
+	for {
+		page, err := repo.Candles(context.Background(), currency, resolution, start, time.Time{}, maxRangeLimit)
+		if err != nil {
+			return 0, err
+		}
+		candles = append(candles, page...)
+		if len(page) < maxRangeLimit {
+			break
+		}
+		start = page[len(page)-1].Start.Add(candleDuration(resolution))
+	}
+
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = c.Close
+	}
+
+	var values []IndicatorValue
+	updated := 0
+	for name, s := range computeIndicators(closes, cfg) {
+		for i, c := range candles {
+			if c.Start.Before(from) || math.IsNaN(s[i]) {
+				continue
+			}
+			values = append(values, IndicatorValue{
+				Currency:   currency,
+				Resolution: resolution,
+				Start:      c.Start,
+				Name:       name,
+				Value:      roundPrice(s[i]),
+			})
+		}
+	}
+	for _, c := range candles {
+		if !c.Start.Before(from) {
+			updated++
+		}
+	}
+
+	if len(values) == 0 {
+		return 0, nil
+	}
+	if err := repo.SaveIndicators(values); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// groupIndicators turns rows ordered by candle into one point per candle
+func groupIndicators(values []IndicatorValue) []IndicatorPoint {
+	points := []IndicatorPoint{}
+	for _, v := range values {
+		if len(points) == 0 || !points[len(points)-1].Start.Equal(v.Start) {
+			points = append(points, IndicatorPoint{Start: v.Start, Values: make(map[string]float64)})
+		}
+		points[len(points)-1].Values[v.Name] = v.Value
+	}
+	return points
+}
+
+// displayIndicators prints the indicators of the newest count candles
+func displayIndicators(repo *Repository, currency, resolution string, count int) error {
+	from := candleStart(time.Now(), resolution).Add(-time.Duration(count-1) * candleDuration(resolution))
+	values, err := repo.Indicators(currency, resolution, from, time.Time{}, count)
+	if err != nil {
+		return err
+	}
+	points := groupIndicators(values)
+	if len(points) == 0 {
+		slog.Info("No indicators computed yet; run \"indicators rebuild\" once candles exist")
+		return nil
+	}
+
+	// Show the configured indicators first, then any left from an earlier configuration
+	names := indicatorConfig.names()
+	var extra []string
+	for _, p := range points {
+		for name := range p.Values {
+			if !slices.Contains(names, name) && !slices.Contains(extra, name) {
+				extra = append(extra, name)
+			}
+		}
+	}
+	slices.Sort(extra)
+	names = append(names, extra...)
+
+	layout := "2006-01-02 15:04"
+	if resolution == CandleDaily {
+		layout = "2006-01-02"
+	}
+
+	fmt.Printf("\n%s indicators (%s)\n", resolution, strings.ToUpper(currency))
+	fmt.Printf("%-17s", "Start")
+	for _, name := range names {
+		fmt.Printf(" %12s", name)
+	}
+	fmt.Println()
+	fmt.Println(strings.Repeat("-", 17+13*len(names)))
+	for _, p := range points {
+		fmt.Printf("%-17s", p.Start.Format(layout))
+		for _, name := range names {
+			if v, ok := p.Values[name]; ok {
+				fmt.Printf(" %12.2f", v)
+			} else {
+				fmt.Printf(" %12s", "-")
+			}
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+	return nil
+}
+
+// runIndicatorsCommand handles "indicators rebuild" and "indicators [1h|1d] [currency] [count]"
+func runIndicatorsCommand(repo *Repository, args []string) error {
+	if len(args) > 0 && args[0] == "rebuild" {
+		for _, currency := range currencies {
+			for _, resolution := range candleResolutions {
+				n, err := updateIndicators(repo, currency, resolution, time.Time{})
+				if err != nil {
+					return fmt.Errorf("failed to compute %s indicators for %s: %w", resolution, strings.ToUpper(currency), err)
+				}
+				slog.Info("Saved indicators", "currency", currency, "resolution", resolution, "candles", n)
+			}
+		}
+		return nil
+	}
+
+	resolution, currency, count := CandleDaily, currencies[0], 30
+	if len(args) > 0 {
+		r, err := parseCandleResolution(args[0])
+		if err != nil {
+			return err
+		}
+		resolution = r
+	}
+	if len(args) > 1 {
+		currency = strings.ToLower(args[1])
+	}
+	if len(args) > 2 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid candle count %q", args[2])
+		}
+		count = n
+	}
+	return displayIndicators(repo, currency, resolution, count)
+}
+
+// handleIndicators serves GET /indicators?currency=usd&resolution=1d&from=...&to=...&limit=...
+// from defaults to the newest 48 candles; one point per candle is returned, oldest first
+func (s *apiServer) handleIndicators(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	resolution := CandleDaily
+	if v := r.URL.Query().Get("resolution"); v != "" {
+		res, err := parseCandleResolution(v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		resolution = res
+	}
+
+	defaultFrom := candleStart(time.Now(), resolution).Add(-(defaultCandleCount - 1) * candleDuration(resolution))
+	from, to, err := requestWindow(r, "")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if from.IsZero() {
+		from = defaultFrom
+		if !to.IsZero() && !to.After(from) {
+			writeAPIError(w, http.StatusBadRequest, "to must be after from")
+			return
+		}
+	}
+
+	limit := defaultRangeLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxRangeLimit {
+			writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and %d", maxRangeLimit)
+			return
+		}
+	}
+
+	values, err := s.repo.Indicators(requestCurrency(r), resolution, from, to, limit)
+	if err != nil {
+		slog.Error("API failed to fetch indicators", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query indicators")
+		return
+	}
+	writeJSON(w, http.StatusOK, groupIndicators(values))
+}
+
+// indicatorNamePattern matches the names of stored indicator series
+var indicatorNamePattern = regexp.MustCompile(`^((sma|ema|rsi)\d+|bb\d+_(upper|middle|lower))$`)
+
+// indicatorAliases are shorthand conditions for indicator alert rules
+var indicatorAliases = map[string]string{
+	"golden": "sma50>sma200", // Golden cross: the 50-candle SMA rises above the 200-candle SMA
+	"death":  "sma50<sma200", // Death cross: the 50-candle SMA falls below the 200-candle SMA
+}
+
+// IndicatorCondition compares two operands, each an indicator, "price", or a number
+// Stored on alert rules as "resolution:left<op>right", e.g. "1d:sma50>sma200"
+type IndicatorCondition struct {
+	Resolution string
+	Left       string
+	Op         string // ">" or "<"
+	Right      string
+}
+
+// String returns the stored form of the condition
+func (c IndicatorCondition) String() string {
+	return c.Resolution + ":" + c.Left + c.Op + c.Right
+}
+
+// parseIndicatorOperand validates one side of a condition
+func parseIndicatorOperand(s string) error {
+	if s == "price" || indicatorNamePattern.MatchString(s) {
+		return nil
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return nil
+	}
+	return fmt.Errorf("invalid operand %q (expected price, a number, or an indicator such as sma50, ema12, rsi14, or bb20_upper)", s)
+}
+
+// parseIndicatorCondition parses "sma50>sma200", "rsi14<30", "price>bb20_upper", or an
+// alias such as "golden"; a "1h:" or "1d:" prefix overrides resolution
+func parseIndicatorCondition(s, resolution string) (IndicatorCondition, error) {
+	s = strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	if prefix, rest, ok := strings.Cut(s, ":"); ok {
+		r, err := parseCandleResolution(prefix)
+		if err != nil {
+			return IndicatorCondition{}, err
+		}
+		resolution, s = r, rest
+	}
+	if alias, ok := indicatorAliases[s]; ok {
+		s = alias
+	}
+
+	c := IndicatorCondition{Resolution: resolution}
+	i := strings.IndexAny(s, "<>")
+	if i <= 0 || i == len(s)-1 {
+		return c, fmt.Errorf("invalid indicator condition %q (expected e.g. sma50>sma200, rsi14<30, golden, or death)", s)
+	}
+	c.Left, c.Op, c.Right = s[:i], s[i:i+1], s[i+1:]
+	for _, operand := range []string{c.Left, c.Right} {
+		if err := parseIndicatorOperand(operand); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// evaluateIndicatorCondition checks a condition against the newest indicators
+// It returns whether the condition holds and the operand values; ok is false while
+// an indicator has not been computed yet (not enough candles)
+func evaluateIndicatorCondition(repo *Repository, c IndicatorCondition, currency string, price float64) (met bool, left, right float64, ok bool, err error) {
+	values, _, err := repo.LatestIndicators(currency, c.Resolution)
+	if err != nil {
+		return false, 0, 0, false, err
+	}
+
+	operand := func(s string) (float64, bool) {
+		if s == "price" {
+			return price, true
+		}
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n, true
+		}
+		v, ok := values[s]
+		return v, ok
+	}
+	left, okLeft := operand(c.Left)
+	right, okRight := operand(c.Right)
+	if !okLeft || !okRight {
+		return false, left, right, false, nil
+	}
+	if c.Op == ">" {
+		return left > right, left, right, true, nil
+	}
+	return left < right, left, right, true, nil
+}
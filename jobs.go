@@ -0,0 +1,868 @@
+package main
+
+import (
+	"context"       // Package for the control socket request
+	"encoding/json" // Package for job status responses
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"math/rand"     // Package for jitter
+	"net/http"      // Package for the control socket request
+	"os"            // Package for environment variables
+	"slices"        // Package for copying the job order
+	"sort"          // Package for ordering preset names
+	"strconv"       // Package for parsing cron fields
+	"strings"       // Package for string manipulation
+	"time"          // Package for schedules
+)
+
+// jobCandles is the scheduler job rolling up candles when it has its own schedule
+const jobCandles = "candles"
+
+// Prefixes of the jobs of baskets and collectors with schedules of their own, followed
+// by the basket or collector name, e.g. "basket:smallcaps"
+const (
+	jobBasketPrefix    = "basket:"
+	jobCollectorPrefix = "collector:"
+)
+
+// Schedule decides when a job runs next
+type Schedule interface {
+	// Next returns the first time after after the job is due
+	Next(after time.Time) time.Time
+	// String describes the schedule for the jobs command
+	String() string
+}
+
+// intervalSchedule runs a job at a fixed interval
+type intervalSchedule time.Duration
+
+// Next implements Schedule
+func (s intervalSchedule) Next(after time.Time) time.Time { return after.Add(time.Duration(s)) }
+
+// String implements Schedule
+func (s intervalSchedule) String() string { return "every " + time.Duration(s).String() }
+
+// cronFields are the parsed fields of a cron expression, one bit per allowed value
+type cronFields struct {
+	minute, hour, dom, month, dow uint64
+}
+
+// cronSchedule runs a job at the times matching a cron expression
+type cronSchedule struct {
+	expr     string
+	fields   cronFields
+	location *time.Location
+}
+
+// cronDescriptors are the shorthands accepted in place of five fields
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronMonthNames and cronDayNames are the names allowed in the month and day-of-week fields
+var (
+	cronMonthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronDayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// parseCronSchedule parses a five-field cron expression ("minute hour day-of-month month
+// day-of-week"), a descriptor such as @daily, or "@every <duration>"; a CRON_TZ=<zone>
+// prefix evaluates it in that time zone instead of local time
+func parseCronSchedule(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	location := time.Local
+	if rest, ok := strings.CutPrefix(expr, "CRON_TZ="); ok {
+		zone, spec, _ := strings.Cut(rest, " ")
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CRON_TZ %q: %w", zone, err)
+		}
+		location, expr = loc, strings.TrimSpace(spec)
+	}
+
+	if every, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil || d < time.Minute {
+			return nil, fmt.Errorf("invalid %q (expected @every and a duration of at least 1m)", expr)
+		}
+		return intervalSchedule(d), nil
+	}
+	spec := expr
+	if d, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		spec = d
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q (expected 5 fields: minute hour day-of-month month day-of-week)", expr)
+	}
+	var f cronFields
+	var err error
+	if f.minute, err = parseCronField(parts[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minute in %q: %w", expr, err)
+	}
+	if f.hour, err = parseCronField(parts[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hour in %q: %w", expr, err)
+	}
+	if f.dom, err = parseCronField(parts[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day of month in %q: %w", expr, err)
+	}
+	if f.month, err = parseCronField(parts[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("invalid month in %q: %w", expr, err)
+	}
+	if f.dow, err = parseCronField(parts[4], 0, 7, cronDayNames); err != nil {
+		return nil, fmt.Errorf("invalid day of week in %q: %w", expr, err)
+	}
+	if f.dow&(1<<7) != 0 {
+		f.dow |= 1 // 7 is Sunday as well as 0
+	}
+	schedule := &cronSchedule{expr: expr, fields: f, location: location}
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return schedule, nil
+}
+
+// schedulePreset is a named schedule for a common setup, accepted wherever a cron
+// expression is
+type schedulePreset struct {
+	exprs []string // Cron expressions whose times together make up the schedule
+	about string   // What the preset is for, listed by `jobs presets`
+}
+
+// schedulePresets are the presets by name
+var schedulePresets = map[string]schedulePreset{
+	"daily-close": {
+		exprs: []string{"CRON_TZ=UTC 0 0 * * *"},
+		about: "Once a day at midnight UTC, when the daily candle closes",
+	},
+	"hourly": {
+		exprs: []string{"CRON_TZ=UTC 0 * * * *"},
+		about: "At the start of every UTC hour, when the hourly candle closes",
+	},
+	"every-minute": {
+		exprs: []string{"* * * * *"},
+		about: "Every minute, the shortest fetch interval",
+	},
+	"market-hours-only": {
+		exprs: []string{
+			"CRON_TZ=America/New_York 30-59/5 9 * * mon-fri",
+			"CRON_TZ=America/New_York */5 10-15 * * mon-fri",
+			"CRON_TZ=America/New_York 0 16 * * mon-fri",
+		},
+		about: "Every 5 minutes from 9:30 to 16:00 New York time on weekdays, while US stock markets trade",
+	},
+}
+
+// presetSchedule runs a job at the times of any of a preset's cron expressions
+type presetSchedule struct {
+	name  string
+	parts []Schedule
+}
+
+// Next implements Schedule
+func (s presetSchedule) Next(after time.Time) time.Time {
+	var earliest time.Time
+	for _, part := range s.parts {
+		if next := part.Next(after); !next.IsZero() && (earliest.IsZero() || next.Before(earliest)) {
+			earliest = next
+		}
+	}
+	return earliest
+}
+
+// String implements Schedule
+func (s presetSchedule) String() string { return s.name }
+
+// parseSchedule parses a preset name such as daily-close, or a cron expression as
+// parseCronSchedule does
+func parseSchedule(v string) (Schedule, error) {
+	name := strings.ToLower(strings.TrimSpace(v))
+	preset, ok := schedulePresets[name]
+	if !ok {
+		if name != "" && !strings.ContainsAny(name, " @=") {
+			return nil, fmt.Errorf("unknown schedule preset %q (expected %s, or a cron expression)", v, strings.Join(presetNames(), ", "))
+		}
+		return parseCronSchedule(v)
+	}
+
+	s := presetSchedule{name: name}
+	for _, expr := range preset.exprs {
+		part, err := parseCronSchedule(expr)
+		if err != nil {
+			return nil, fmt.Errorf("schedule preset %s: %w", name, err)
+		}
+		s.parts = append(s.parts, part)
+	}
+	return s, nil
+}
+
+// parseIntervalSchedule parses a duration of at least 1m, e.g. 1h, or else a preset or
+// cron expression as parseSchedule does
+func parseIntervalSchedule(v string) (Schedule, error) {
+	if d, err := time.ParseDuration(strings.TrimSpace(v)); err == nil {
+		if d < time.Minute {
+			return nil, fmt.Errorf("interval %s is shorter than 1m", d)
+		}
+		return intervalSchedule(d), nil
+	}
+	return parseSchedule(v)
+}
+
+// parseScheduleList parses the comma-separated name=schedule pairs of env, each
+// schedule as parseIntervalSchedule does, e.g. "smallcaps=1h,top10=hourly"; cron
+// expressions in it can't contain commas
+func parseScheduleList(env string) (map[string]Schedule, error) {
+	schedules := make(map[string]Schedule)
+	for _, entry := range strings.Split(os.Getenv(env), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, v, ok := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid %s entry %q (expected name=schedule, e.g. smallcaps=1h)", env, entry)
+		}
+		if _, dup := schedules[name]; dup {
+			return nil, fmt.Errorf("%q is listed twice in %s", name, env)
+		}
+		schedule, err := parseIntervalSchedule(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q: %w", env, entry, err)
+		}
+		schedules[name] = schedule
+	}
+	return schedules, nil
+}
+
+// presetNames returns the names of the schedule presets in order
+func presetNames() []string {
+	names := make([]string, 0, len(schedulePresets))
+	for name := range schedulePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseCronField parses one comma-separated field of values, ranges, and steps (*, 5,
+// 1-5, */15, 10-40/10) into a bit set; names, if any, stand for first, first+1, and so on
+func parseCronField(field string, first, last int, names []string) (uint64, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return first + i, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < first || n > last {
+			return 0, fmt.Errorf("%q is not between %d and %d", s, first, last)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := first, last
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range %q runs backwards", rangePart)
+			}
+		default:
+			var err error
+			if lo, err = value(rangePart); err != nil {
+				return 0, err
+			}
+			if hasStep {
+				hi = last // "5/15" means from 5 on, every 15
+			} else {
+				hi = lo
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// cronAll reports whether a field allows every value from first to last
+func cronAll(bits uint64, first, last int) bool {
+	all := uint64(1)<<uint(last+1) - uint64(1)<<uint(first)
+	return bits&all == all
+}
+
+// matchesDay reports whether t's date matches the day-of-month and day-of-week fields
+// As in cron, when both are restricted a day matching either one is enough.
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	dom := s.fields.dom&(1<<uint(t.Day())) != 0
+	dow := s.fields.dow&(1<<uint(t.Weekday())) != 0
+	if cronAll(s.fields.dom, 1, 31) || cronAll(s.fields.dow, 0, 6) {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next implements Schedule
+// It walks forward from after a month, day, hour, or minute at a time, skipping whatever
+// doesn't match; times are built from dates so DST changes don't shift them.
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	t := after.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0) // An expression like "0 0 30 2 *" never matches
+	for t.Before(limit) {
+		switch {
+		case s.fields.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		case s.fields.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+		case s.fields.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// String implements Schedule
+func (s *cronSchedule) String() string {
+	if s.location != time.Local {
+		return "CRON_TZ=" + s.location.String() + " " + s.expr
+	}
+	return s.expr
+}
+
+// fetchSchedule runs the price fetch at FETCH_INTERVAL, or at the times of a cron
+// expression, and stretches the wait when the fetch budget runs low
+type fetchSchedule struct {
+	repo *Repository // Where the fetch budget is counted
+	cron Schedule    // nil fetches every FETCH_INTERVAL
+}
+
+// Next implements Schedule
+func (s fetchSchedule) Next(after time.Time) time.Time {
+	if s.cron == nil {
+		return after.Add(nextFetchDelay(s.repo, fetchInterval))
+	}
+	// A stretched wait moves the fetch to the first time due after it
+	next := s.cron.Next(after)
+	if next.IsZero() {
+		return next
+	}
+	for until := after.Add(nextFetchDelay(s.repo, next.Sub(after))); next.Before(until); {
+		next = s.cron.Next(next)
+	}
+	return next
+}
+
+// String implements Schedule
+func (s fetchSchedule) String() string {
+	if s.cron == nil {
+		return "every " + fetchInterval.String()
+	}
+	return s.cron.String()
+}
+
+// JobConfig holds the cron schedules overriding the jobs' intervals and times of day
+type JobConfig struct {
+	Fetch      Schedule      // SCHEDULE_FETCH; nil fetches every FETCH_INTERVAL
+	Candles    Schedule      // SCHEDULE_CANDLES; nil rolls candles up after every fetch
+	Retention  Schedule      // SCHEDULE_RETENTION; nil applies the policy every RETENTION_INTERVAL
+	Portfolio  Schedule      // SCHEDULE_PORTFOLIO; nil snapshots every PORTFOLIO_SNAPSHOT_INTERVAL
+	Summary    Schedule      // SCHEDULE_SUMMARY; nil posts at SUMMARY_TIME
+	FearGreed  Schedule      // SCHEDULE_FEAR_GREED; nil collects daily just after midnight UTC
+	Collectors Schedule      // SCHEDULE_COLLECTORS; nil runs the collectors every COLLECTOR_INTERVAL
+	Daily      Schedule      // SCHEDULE_DAILY_SUMMARIES; nil refreshes the daily summaries hourly
+	Report     Schedule      // SCHEDULE_REPORT; nil writes no weekly report
+	Jitter     time.Duration // Up to this much random delay is added to every run
+}
+
+// jobConfig is the active configuration, loaded at startup
+var jobConfig JobConfig
+
+// loadJobConfig reads the SCHEDULE_* cron expressions or presets and SCHEDULE_JITTER
+// It runs after the summary configuration, whose webhooks a summary schedule needs.
+func loadJobConfig() (JobConfig, error) {
+	var c JobConfig
+	for _, s := range []struct {
+		env    string
+		target *Schedule
+	}{
+		{"SCHEDULE_FETCH", &c.Fetch},
+		{"SCHEDULE_CANDLES", &c.Candles},
+		{"SCHEDULE_RETENTION", &c.Retention},
+		{"SCHEDULE_PORTFOLIO", &c.Portfolio},
+		{"SCHEDULE_SUMMARY", &c.Summary},
+		{"SCHEDULE_FEAR_GREED", &c.FearGreed},
+		{"SCHEDULE_COLLECTORS", &c.Collectors},
+		{"SCHEDULE_DAILY_SUMMARIES", &c.Daily},
+		{"SCHEDULE_REPORT", &c.Report},
+	} {
+		v := os.Getenv(s.env)
+		if v == "" {
+			continue
+		}
+		schedule, err := parseSchedule(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid %s: %w", s.env, err)
+		}
+		*s.target = schedule
+	}
+	if c.Summary != nil && summaryConfig.SlackWebhookURL == "" && summaryConfig.DiscordWebhookURL == "" {
+		return c, fmt.Errorf("SCHEDULE_SUMMARY is set but no Slack or Discord webhook is (SUMMARY_SLACK_WEBHOOK_URL, SLACK_WEBHOOK_URL, or SUMMARY_DISCORD_WEBHOOK_URL)")
+	}
+	if v := os.Getenv("SCHEDULE_JITTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return c, fmt.Errorf("invalid SCHEDULE_JITTER %q (expected a duration, e.g. 30s)", v)
+		}
+		c.Jitter = d
+	}
+	return c, nil
+}
+
+// summarySchedule returns the cron schedule of SUMMARY_TIME in SUMMARY_TIMEZONE
+func summarySchedule(c SummaryConfig) Schedule {
+	return &cronSchedule{
+		expr:     fmt.Sprintf("%d %d * * *", c.Minute, c.Hour),
+		fields:   cronFields{minute: 1 << uint(c.Minute), hour: 1 << uint(c.Hour), dom: 1<<32 - 2, month: 1<<13 - 2, dow: 1<<7 - 1},
+		location: c.Location,
+	}
+}
+
+// jobSchedules returns the schedule of each scheduler job, nil for a disabled one; the
+// fetch counts its budget in repo
+func jobSchedules(repo *Repository) map[string]Schedule {
+	c := jobConfig
+	schedules := map[string]Schedule{
+		jobFetch:          fetchSchedule{repo: repo, cron: c.Fetch},
+		jobCandles:        c.Candles,
+		jobRetention:      c.Retention,
+		jobPortfolio:      c.Portfolio,
+		jobSummary:        c.Summary,
+		jobFearGreed:      c.FearGreed,
+		jobCollectors:     c.Collectors,
+		jobDailySummaries: c.Daily,
+		jobReport:         c.Report,
+	}
+	if c.Retention == nil && retentionPolicy.Interval > 0 {
+		schedules[jobRetention] = intervalSchedule(retentionPolicy.Interval)
+	}
+	if !retentionPolicy.enabled() {
+		schedules[jobRetention] = nil // There is nothing to apply
+	}
+	if c.Portfolio == nil && portfolioConfig.SnapshotInterval > 0 {
+		schedules[jobPortfolio] = intervalSchedule(portfolioConfig.SnapshotInterval)
+	}
+	if c.Summary == nil && summaryConfig.enabled() {
+		schedules[jobSummary] = summarySchedule(summaryConfig)
+	}
+	if c.FearGreed == nil {
+		schedules[jobFearGreed], _ = parseCronSchedule(fearGreedDefaultSchedule)
+	}
+	if !fearGreedConfig.Enabled {
+		schedules[jobFearGreed] = nil // FEAR_GREED is off
+	}
+	if c.Collectors == nil {
+		schedules[jobCollectors] = intervalSchedule(collectorConfig.Interval)
+	}
+	if len(collectorConfig.scheduled(false)) == 0 {
+		schedules[jobCollectors] = nil // There is nothing to run
+	}
+	if c.Daily == nil {
+		schedules[jobDailySummaries], _ = parseCronSchedule(dailySummaryDefaultSchedule)
+	}
+	for name, schedule := range basketConfig.Schedules {
+		schedules[jobBasketPrefix+name] = schedule
+	}
+	for name, schedule := range collectorConfig.Schedules {
+		schedules[jobCollectorPrefix+name] = schedule
+	}
+	return schedules
+}
+
+// jobOrder is the order jobs due at the same time run in, and are listed in
+var jobOrder = []string{jobFetch, jobCandles, jobRetention, jobPortfolio, jobSummary, jobFearGreed, jobCollectors, jobDailySummaries, jobReport}
+
+// jobNames returns jobOrder followed by the jobs of the baskets and collectors with
+// schedules of their own, in the order they are configured
+func jobNames() []string {
+	names := slices.Clone(jobOrder)
+	for _, b := range basketConfig.Baskets {
+		if basketConfig.Schedules[b.Name] != nil {
+			names = append(names, jobBasketPrefix+b.Name)
+		}
+	}
+	for _, collector := range collectorConfig.scheduled(true) {
+		names = append(names, jobCollectorPrefix+collector.Name())
+	}
+	return names
+}
+
+// JobStatus describes a scheduler job for the jobs command
+type JobStatus struct {
+	Name      string    `json:"name"`
+	Schedule  string    `json:"schedule"`           // "disabled" when the job doesn't run
+	NextRun   time.Time `json:"next_run,omitempty"` // Including jitter
+	LastRun   time.Time `json:"last_run,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Running   bool      `json:"running,omitempty"` // The last run hasn't finished
+}
+
+// scheduledJob is a job of the scheduler loop
+type scheduledJob struct {
+	name     string
+	schedule Schedule // nil when disabled
+	run      func(ctx context.Context) error
+	next     time.Time
+	lastRun  time.Time
+	lastErr  error
+	running  bool // A run in its own goroutine hasn't finished
+}
+
+// jobResult is the outcome of a run in its own goroutine
+type jobResult struct {
+	job *scheduledJob
+	err error
+}
+
+// jobScheduler runs the scheduler's jobs when they are due; a single timer fires at the
+// earliest next run. The fetch runs on the scheduler goroutine, as triggered fetches do,
+// so fetches never overlap; every other job runs in a goroutine of its own, so a slow
+// one holds up neither the fetch nor the control socket.
+type jobScheduler struct {
+	repo     *Repository // Where the fetch budget is counted
+	jobs     []*scheduledJob
+	runs     map[string]func(ctx context.Context) error        // The fixed jobs of jobOrder
+	series   func(name string) func(ctx context.Context) error // Builds the run of a basket or collector job
+	timer    *time.Timer
+	done     chan jobResult // Receives the outcome of each run in its own goroutine
+	inFlight int            // Runs in their own goroutines that haven't finished
+}
+
+// newJobScheduler schedules the jobs from the configuration, the fetch right away
+// series builds the runs of the basket and collector jobs, which come and go with the
+// configuration; the fetch budget is counted in repo.
+func newJobScheduler(repo *Repository, runs map[string]func(ctx context.Context) error, series func(name string) func(ctx context.Context) error) *jobScheduler {
+	s := &jobScheduler{repo: repo, runs: runs, series: series, timer: time.NewTimer(time.Hour), done: make(chan jobResult)}
+	s.reschedule(time.Now(), true)
+	return s
+}
+
+// syncJobs brings the job list in line with jobNames, keeping the state of jobs that
+// remain and dropping those of baskets and collectors no longer scheduled on their own
+func (s *jobScheduler) syncJobs() {
+	existing := make(map[string]*scheduledJob, len(s.jobs))
+	for _, job := range s.jobs {
+		existing[job.name] = job
+	}
+	names := jobNames()
+	jobs := make([]*scheduledJob, 0, len(names))
+	for _, name := range names {
+		job, ok := existing[name]
+		if !ok {
+			run := s.runs[name]
+			if run == nil {
+				run = s.series(name)
+			}
+			job = &scheduledJob{name: name, run: run}
+		}
+		jobs = append(jobs, job)
+	}
+	s.jobs = jobs
+}
+
+// C returns the channel that receives when a job is due
+func (s *jobScheduler) C() <-chan time.Time { return s.timer.C }
+
+// Done returns the channel that receives when a run in its own goroutine finishes; pass
+// what it receives to finish
+func (s *jobScheduler) Done() <-chan jobResult { return s.done }
+
+// Stop stops the timer
+func (s *jobScheduler) Stop() { s.timer.Stop() }
+
+// jitter returns a random delay of up to SCHEDULE_JITTER
+func jitter() time.Duration {
+	if jobConfig.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jobConfig.Jitter)))
+}
+
+// reschedule applies the current configuration: jobs whose schedule changed are due
+// at its next time after now, and a new fetch schedule is first due right away when
+// fetchNow is set, as on startup
+func (s *jobScheduler) reschedule(now time.Time, fetchNow bool) {
+	s.syncJobs()
+	schedules := jobSchedules(s.repo)
+	for _, job := range s.jobs {
+		schedule := schedules[job.name]
+		changed := describeSchedule(schedule) != describeSchedule(job.schedule) || job.next.IsZero()
+		job.schedule = schedule
+		switch {
+		case schedule == nil:
+			job.next = time.Time{}
+		case !changed:
+		case job.name == jobFetch && fetchNow:
+			job.next = now
+		default:
+			job.next = nextRun(schedule, now)
+		}
+		if schedule != nil && changed {
+			slog.Info("Scheduled job", "job", job.name, "schedule", schedule.String(), "next", job.next.Format(time.RFC3339))
+		}
+	}
+	s.publish()
+	s.resetTimer(now)
+}
+
+// fetchNow makes the fetch due right away, as on startup
+func (s *jobScheduler) fetchNow(now time.Time) {
+	for _, job := range s.jobs {
+		if job.name == jobFetch && job.schedule != nil {
+			job.next = now
+		}
+	}
+	s.publish()
+	s.resetTimer(now)
+}
+
+// nextRun returns when a job on schedule is next due after after, with jitter; zero when
+// its expression never matches
+func nextRun(schedule Schedule, after time.Time) time.Time {
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return next
+	}
+	return next.Add(jitter())
+}
+
+// describeSchedule describes a schedule that may be nil
+func describeSchedule(schedule Schedule) string {
+	if schedule == nil {
+		return "disabled"
+	}
+	return schedule.String()
+}
+
+// runDue starts every job that is due, in jobNames order, under ctx, and schedules its
+// next run. Interval schedules count from the start of a run, so time spent running
+// doesn't push them back. A job whose previous run is still going skips this one. While
+// the scheduler is paused the fetch is skipped, and while the instance is a standby
+// every job is.
+func (s *jobScheduler) runDue(ctx context.Context) {
+	for _, job := range s.jobs {
+		start := time.Now()
+		if job.schedule == nil || job.next.IsZero() || job.next.After(start) {
+			continue
+		}
+
+		switch {
+		case daemon.isStandby():
+		case job.name == jobFetch && daemon.isPaused():
+			slog.Info("Scheduler paused, skipping fetch")
+		case job.running:
+			slog.Warn("Skipping job still running from its last run", "job", job.name, "since", job.lastRun.Format(time.RFC3339))
+		case job.name == jobFetch:
+			job.lastRun, job.lastErr = start, job.run(ctx)
+		default:
+			job.lastRun, job.running = start, true
+			s.inFlight++
+			go func(job *scheduledJob) {
+				s.done <- jobResult{job: job, err: job.run(ctx)}
+			}(job)
+		}
+
+		job.next = nextRun(job.schedule, start)
+		holdBack(job)
+	}
+	s.publish()
+	s.resetTimer(time.Now())
+}
+
+// finish records the outcome of a run in its own goroutine
+func (s *jobScheduler) finish(r jobResult) {
+	s.inFlight--
+	r.job.running, r.job.lastErr = false, r.err
+	holdBack(r.job)
+	s.publish()
+	s.resetTimer(time.Now())
+}
+
+// wait waits for the runs still going in their own goroutines, which end early once the
+// ctx they were started under is cancelled
+func (s *jobScheduler) wait() {
+	if s.inFlight > 0 {
+		slog.Info("Waiting for running jobs", "jobs", s.inFlight)
+	}
+	for s.inFlight > 0 {
+		s.finish(<-s.done)
+	}
+}
+
+// holdBack makes a job held back after a panic wait until it may run again
+func holdBack(job *scheduledJob) {
+	if until, ok := daemon.jobBackoff(job.name, time.Now()); ok && job.schedule != nil && job.next.Before(until) {
+		job.next = until
+	}
+}
+
+// resetTimer sets the timer to the earliest next run
+func (s *jobScheduler) resetTimer(now time.Time) {
+	if !s.timer.Stop() {
+		select {
+		case <-s.timer.C:
+		default:
+		}
+	}
+	var earliest time.Time
+	for _, job := range s.jobs {
+		if !job.next.IsZero() && (earliest.IsZero() || job.next.Before(earliest)) {
+			earliest = job.next
+		}
+	}
+	if earliest.IsZero() {
+		return // Nothing is scheduled; the timer stays stopped
+	}
+	s.timer.Reset(max(earliest.Sub(now), 0))
+}
+
+// publish hands the jobs' state to the daemon state for the jobs and status commands
+func (s *jobScheduler) publish() {
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	var fetchNext time.Time
+	for _, job := range s.jobs {
+		st := JobStatus{Name: job.name, Schedule: describeSchedule(job.schedule), NextRun: job.next, LastRun: job.lastRun, Running: job.running}
+		if job.lastErr != nil {
+			st.LastError = job.lastErr.Error()
+		}
+		if job.name == jobCandles && job.schedule == nil {
+			st.Schedule = "after each fetch"
+		}
+		if job.name == jobFetch {
+			fetchNext = job.next
+		}
+		statuses = append(statuses, st)
+	}
+	daemon.setJobs(statuses)
+	if !fetchNext.IsZero() {
+		daemon.setNextRun(max(time.Until(fetchNext), 0))
+	}
+}
+
+// plannedJobs returns the jobs as a scheduler started now would schedule them
+func plannedJobs(repo *Repository, now time.Time) []JobStatus {
+	schedules := jobSchedules(repo)
+	names := jobNames()
+	statuses := make([]JobStatus, 0, len(names))
+	for _, name := range names {
+		schedule := schedules[name]
+		st := JobStatus{Name: name, Schedule: describeSchedule(schedule)}
+		switch {
+		case name == jobFetch:
+			st.NextRun = now
+		case schedule != nil:
+			st.NextRun = schedule.Next(now)
+		case name == jobCandles:
+			st.Schedule = "after each fetch"
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// fetchDaemonJobs asks the running daemon for its jobs
+func fetchDaemonJobs(ctx context.Context) ([]JobStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://daemon/jobs", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := controlClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("daemon not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status from daemon: %s", resp.Status)
+	}
+
+	var jobs []JobStatus
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode daemon jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// displaySchedulePresets lists the schedule presets and the cron expressions behind them
+func displaySchedulePresets() {
+	fmt.Printf("\n%-18s %s\n", "Preset", "Runs")
+	fmt.Println("------------------------------------------------------------")
+	for _, name := range presetNames() {
+		p := schedulePresets[name]
+		fmt.Printf("%-18s %s\n", name, p.about)
+		for _, expr := range p.exprs {
+			fmt.Printf("%-18s   %s\n", "", expr)
+		}
+	}
+	fmt.Println()
+}
+
+// runJobsCommand handles "jobs", listing the scheduler's jobs and when they run next
+// The running daemon is asked for its actual schedule; without one, the jobs are shown
+// as a scheduler started now would run them.
+func runJobsCommand(ctx context.Context, repo *Repository) error {
+	jobs, err := fetchDaemonJobs(ctx)
+	if err != nil {
+		slog.Debug("Showing configured jobs", "error", err)
+		fmt.Println("\nScheduler not running; next runs if it started now")
+		jobs = plannedJobs(repo, time.Now())
+	}
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.In(displayLocation).Format("2006-01-02 15:04:05")
+	}
+
+	fmt.Printf("\n%-20s %-28s %-20s %-20s %s\n", "Job", "Schedule", "Next run", "Last run", "Last error")
+	fmt.Println("------------------------------------------------------------------------------------------------------------")
+	for _, job := range jobs {
+		lastError := job.LastError
+		if job.Running {
+			lastError = "(running)"
+		}
+		fmt.Printf("%-20s %-28s %-20s %-20s %s\n", job.Name, job.Schedule, formatTime(job.NextRun), formatTime(job.LastRun), lastError)
+	}
+	fmt.Println()
+	return nil
+}
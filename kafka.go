@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"           // Package for request bodies
+	"encoding/base64" // Package for record header values
+	"encoding/json"   // Package for REST Proxy requests
+	"fmt"             // Package for formatted I/O operations
+	"io"              // Package for reading error responses
+	"net/http"        // Package for the REST Proxy API
+	"net/url"         // Package for parsing KAFKA_REST_URL
+	"os"              // Package for environment variables
+	"strings"         // Package for string manipulation
+	"sync"            // Package for caching the cluster ID
+)
+
+// kafkaSink produces events to a Kafka topic through the Confluent REST Proxy v3 API
+// (self-hosted, or the REST endpoint of Confluent Cloud). Records are keyed by subject,
+// e.g. "bitcoin/usd", so each currency's prices stay ordered within one partition.
+type kafkaSink struct {
+	endpoint string // REST Proxy base URL without credentials
+	user     string // Basic auth user (Confluent Cloud API key), if any
+	password string // Basic auth password (API secret)
+	topic    string
+
+	mu        sync.Mutex
+	clusterID string // From KAFKA_CLUSTER_ID, or looked up on first publish
+}
+
+// Name identifies the sink in logs
+func (s *kafkaSink) Name() string { return "kafka " + s.topic }
+
+// Publish implements EventSink
+func (s *kafkaSink) Publish(e Event) error {
+	body, contentType, attrs, err := encodeEvent(e)
+	if err != nil {
+		return err
+	}
+
+	// In CloudEvents binary mode the context attributes travel as ce_* record headers
+	headers := []map[string]string{{"name": "content-type", "value": base64.StdEncoding.EncodeToString([]byte(contentType))}}
+	for k, v := range attrs {
+		headers = append(headers, map[string]string{"name": "ce_" + k, "value": base64.StdEncoding.EncodeToString([]byte(v))})
+	}
+
+	record, err := json.Marshal(map[string]interface{}{
+		"key":     map[string]interface{}{"type": "STRING", "data": e.Subject},
+		"value":   map[string]interface{}{"type": "JSON", "data": json.RawMessage(body)},
+		"headers": headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode kafka record: %w", err)
+	}
+
+	clusterID, err := s.cluster()
+	if err != nil {
+		return err
+	}
+	path := "/v3/clusters/" + url.PathEscape(clusterID) + "/topics/" + url.PathEscape(s.topic) + "/records"
+	resp, err := s.do(http.MethodPost, path, record)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Produce errors come back either as an HTTP error or as an error_code in the body
+	var result struct {
+		ErrorCode int    `json:"error_code"`
+		Message   string `json:"message"`
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(respBody, &result)
+	if resp.StatusCode != http.StatusOK || (result.ErrorCode != 0 && result.ErrorCode != http.StatusOK) {
+		if result.Message == "" {
+			result.Message = strings.TrimSpace(string(respBody))
+		}
+		return fmt.Errorf("kafka REST proxy returned status %d: %s", resp.StatusCode, result.Message)
+	}
+	return nil
+}
+
+// cluster returns the cluster ID, asking the REST Proxy for it the first time
+func (s *kafkaSink) cluster() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clusterID != "" {
+		return s.clusterID, nil
+	}
+
+	resp, err := s.do(http.MethodGet, "/v3/clusters", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to list kafka clusters: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var clusters struct {
+		Data []struct {
+			ClusterID string `json:"cluster_id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&clusters); err != nil {
+		return "", fmt.Errorf("failed to parse kafka cluster list: %w", err)
+	}
+	if len(clusters.Data) != 1 {
+		return "", fmt.Errorf("kafka REST proxy serves %d clusters; set KAFKA_CLUSTER_ID", len(clusters.Data))
+	}
+	s.clusterID = clusters.Data[0].ClusterID
+	return s.clusterID, nil
+}
+
+// do sends a request to the REST Proxy
+func (s *kafkaSink) do(method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.password)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kafka request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// loadKafkaSink builds the Kafka sink from KAFKA_REST_URL, KAFKA_TOPIC, and KAFKA_CLUSTER_ID
+// Credentials may be embedded in the URL: https://<api key>:<api secret>@host
+// It returns nil when no REST Proxy is configured
+func loadKafkaSink() (EventSink, error) {
+	v := os.Getenv("KAFKA_REST_URL")
+	if v == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid KAFKA_REST_URL %q", v)
+	}
+
+	sink := &kafkaSink{topic: "bitcoin-tracker", clusterID: os.Getenv("KAFKA_CLUSTER_ID")}
+	if topic := os.Getenv("KAFKA_TOPIC"); topic != "" {
+		sink.topic = topic
+	}
+	if u.User != nil {
+		sink.user = u.User.Username()
+		sink.password, _ = u.User.Password()
+		u.User = nil
+	}
+	sink.endpoint = strings.TrimSuffix(u.String(), "/")
+	return sink, nil
+}
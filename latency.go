@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync" // Package for guarding the latest latencies
+	"time" // Package for quote and write times
+)
+
+// Every stored price records its latency: the seconds from the provider quoting it to
+// it being written. For CoinGecko and the WebSocket feeds that is the provider's own
+// timestamp; other providers don't send one, so their prices count as quoted when the
+// response arrived. The latency then covers retries, failover, FX conversion, stream
+// sampling, and write batching, which is where a price goes stale inside the tracker.
+
+// AlertLatency rules fire when a price is stored more than threshold seconds after
+// it was quoted
+const AlertLatency = "latency"
+
+// formatLatency formats seconds as a duration, e.g. "1m12.5s" or "850µs"
+func formatLatency(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second))
+	if d < time.Second {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// priceLatencies keeps the latency of the newest stored price of each currency, for
+// latency rules
+var priceLatencies = struct {
+	mu     sync.Mutex
+	latest map[string]float64 // Currency -> seconds
+}{latest: make(map[string]float64)}
+
+// quotedAt returns when the price of currency was quoted: a price converted from FX_BASE
+// (one with an FX rate) takes the time of the base price, and one without a known time
+// counts as quoted at fallback
+func quotedAt(quoted map[string]time.Time, rates map[string]float64, currency string, fallback time.Time) time.Time {
+	if t, ok := quoted[currency]; ok && !t.IsZero() {
+		return t
+	}
+	if t, ok := quoted[fxConfig.Base]; ok && rates[currency] > 0 && !t.IsZero() {
+		return t
+	}
+	return fallback
+}
+
+// stampLatency sets the latency of records about to be written at now from when each
+// was quoted; records without a quote time, such as backfilled ones, are left at zero.
+// A provider clock running ahead of ours shows as a latency of zero rather than below.
+func stampLatency(records []PriceRecord, now time.Time) {
+	for i := range records {
+		if !records[i].QuotedAt.IsZero() {
+			records[i].Latency = max(now.Sub(records[i].QuotedAt).Seconds(), 0)
+		}
+	}
+}
+
+// observeLatency exports the latency of newly stored records as metrics and keeps the
+// newest of each currency for latency rules
+func observeLatency(records []PriceRecord) {
+	priceLatencies.mu.Lock()
+	defer priceLatencies.mu.Unlock()
+	for _, r := range records {
+		if r.QuotedAt.IsZero() {
+			continue
+		}
+		labels := map[string]string{"currency": r.Currency, "source": r.Source}
+		setGauge("tracker_price_latency_seconds", labels, r.Latency)
+		incCounter("tracker_price_latency_seconds_sum", labels, r.Latency)
+		incCounter("tracker_price_latency_seconds_count", labels, 1)
+		priceLatencies.latest[r.Currency] = r.Latency
+	}
+}
+
+// latestLatency returns the latency of the newest price of currency stored by this
+// process; false before one has been
+func latestLatency(currency string) (float64, bool) {
+	priceLatencies.mu.Lock()
+	defer priceLatencies.mu.Unlock()
+	latency, ok := priceLatencies.latest[currency]
+	return latency, ok
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"  // Package for candle queries
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for level distances
+	"sort"     // Package for ordering turning points
+	"strings"  // Package for string manipulation
+	"time"     // Package for the look-back window
+)
+
+// Support/resistance detection settings
+const (
+	levelLookback   = 365 * 24 * time.Hour // Daily candles considered when finding levels
+	levelPivotSpan  = 3                    // Candles on each side a turning point must exceed
+	levelTolerance  = 1.5                  // Percent within which turning points form one level
+	levelMinTouches = 2                    // Turning points needed for a level to count
+)
+
+// Level kinds, relative to the latest close
+const (
+	LevelSupport    = "support"
+	LevelResistance = "resistance"
+)
+
+// PriceLevel is a price the market has turned at repeatedly
+type PriceLevel struct {
+	Currency   string    `json:"currency"`    // Fiat currency the prices are quoted in
+	Kind       string    `json:"kind"`        // support (below the last close) or resistance (above it)
+	Price      float64   `json:"price"`       // Mean price of the clustered turning points
+	Touches    int       `json:"touches"`     // Turning points that make up the level
+	FirstTouch time.Time `json:"first_touch"` // Oldest candle touching the level
+	LastTouch  time.Time `json:"last_touch"`  // Newest candle touching the level
+}
+
+// turningPoint is a local high or low of the daily candles
+type turningPoint struct {
+	price float64
+	at    time.Time
+}
+
+// findTurningPoints returns every candle high (low) that is the highest (lowest)
+// of the levelPivotSpan candles on either side
+func findTurningPoints(candles []Candle) []turningPoint {
+	var points []turningPoint
+	for i := levelPivotSpan; i+levelPivotSpan < len(candles); i++ {
+		isHigh, isLow := true, true
+		for j := i - levelPivotSpan; j <= i+levelPivotSpan; j++ {
+			if j == i {
+				continue
+			}
+			if candles[j].High >= candles[i].High {
+				isHigh = false
+			}
+			if candles[j].Low <= candles[i].Low {
+				isLow = false
+			}
+		}
+		if isHigh {
+			points = append(points, turningPoint{price: candles[i].High, at: candles[i].Start})
+		}
+		if isLow {
+			points = append(points, turningPoint{price: candles[i].Low, at: candles[i].Start})
+		}
+	}
+	return points
+}
+
+// clusterLevels groups turning points lying within levelTolerance percent of each
+// other into levels. Highs and lows are pooled: a price that was resistance on the
+// way up and support on the way down is a stronger level, not two.
+func clusterLevels(currency string, points []turningPoint, lastClose float64) []PriceLevel {
+	sort.Slice(points, func(i, j int) bool { return points[i].price < points[j].price })
+
+	var levels []PriceLevel
+	var sum float64
+	flush := func(l PriceLevel) {
+		if l.Touches < levelMinTouches {
+			return
+		}
+		l.Price = math.Round(sum/float64(l.Touches)*100) / 100
+		l.Kind = LevelResistance
+		if l.Price < lastClose {
+			l.Kind = LevelSupport
+		}
+		levels = append(levels, l)
+	}
+
+	var current PriceLevel
+	for _, p := range points {
+		mean := 0.0
+		if current.Touches > 0 {
+			mean = sum / float64(current.Touches)
+		}
+		if current.Touches == 0 || math.Abs(percentChange(mean, p.price)) > levelTolerance {
+			if current.Touches > 0 {
+				flush(current)
+			}
+			current = PriceLevel{Currency: currency, FirstTouch: p.at, LastTouch: p.at}
+			sum = 0
+		}
+		current.Touches++
+		sum += p.price
+		if p.at.Before(current.FirstTouch) {
+			current.FirstTouch = p.at
+		}
+		if p.at.After(current.LastTouch) {
+			current.LastTouch = p.at
+		}
+	}
+	if current.Touches > 0 {
+		flush(current)
+	}
+	return levels
+}
+
+// updatePriceLevels recomputes and stores the support/resistance levels for a currency
+// Levels come from the daily candles of the last year, so candles must be rolled up first
+func updatePriceLevels(repo *Repository, currency string) ([]PriceLevel, error) {
+	candles, err := repo.Candles(context.Background(), currency, CandleDaily, time.Now().Add(-levelLookback), time.Time{}, maxRangeLimit)
+	if err != nil {
+		return nil, err
+	}
+	if len(candles) < 2*levelPivotSpan+1 {
+		return nil, nil // Not enough history to tell a turning point from noise
+	}
+
+	levels := clusterLevels(currency, findTurningPoints(candles), candles[len(candles)-1].Close)
+	if err := repo.SavePriceLevels(currency, levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+// refreshPriceLevels recomputes levels for every configured currency until ctx is done
+// Failures are logged rather than returned so they never fail a fetch
+func refreshPriceLevels(ctx context.Context, repo *Repository) {
+	for _, currency := range currencies {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := updatePriceLevels(repo, currency); err != nil {
+			slog.Error("Failed to update price levels", "currency", currency, "error", err)
+		}
+	}
+}
+
+// nearestLevel returns the level closest to price and the distance to it in percent
+func nearestLevel(levels []PriceLevel, price float64) (PriceLevel, float64, bool) {
+	var nearest PriceLevel
+	best := math.Inf(1)
+	for _, l := range levels {
+		if d := math.Abs(percentChange(l.Price, price)); d < best {
+			nearest, best = l, d
+		}
+	}
+	return nearest, best, len(levels) > 0
+}
+
+// displayPriceLevels prints the stored levels for a currency, highest first
+func displayPriceLevels(repo *Repository, currency string) {
+	levels, err := repo.PriceLevels(currency)
+	if err != nil {
+		slog.Error("Failed to fetch price levels", "error", err)
+		return
+	}
+	if len(levels) == 0 {
+		slog.Info("No price levels detected yet; they need a few weeks of daily candles")
+		return
+	}
+
+	fmt.Printf("\nSupport and resistance levels (%s)\n", strings.ToUpper(currency))
+	fmt.Printf("%-12s %-11s %-8s %-12s %-12s\n", "Price", "Kind", "Touches", "First", "Last")
+	fmt.Println("------------------------------------------------------------")
+	for i := len(levels) - 1; i >= 0; i-- {
+		l := levels[i]
+		fmt.Printf("%-12.2f %-11s %-8d %-12s %-12s\n",
+			l.Price, l.Kind, l.Touches, l.FirstTouch.In(displayLocation).Format("2006-01-02"), l.LastTouch.In(displayLocation).Format("2006-01-02"))
+	}
+	fmt.Println()
+}
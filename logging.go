@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"      // Package for formatted errors
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables and the log output
+	"strings"  // Package for parsing settings
+)
+
+// logLevel is the minimum level written; a LevelVar so a reload can change it
+var logLevel = new(slog.LevelVar)
+
+// parseLogLevel reads LOG_LEVEL: debug, info, warn, or error
+func parseLogLevel() (slog.Level, error) {
+	switch v := strings.ToLower(os.Getenv("LOG_LEVEL")); v {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("invalid LOG_LEVEL %q (expected debug, info, warn, or error)", v)
+	}
+}
+
+// setupLogging installs the process-wide structured logger on stderr
+// LOG_FORMAT selects text (logfmt) or json output. It is read once at startup, since
+// log shippers expect one format per stream; LOG_LEVEL is re-read on every reload.
+// Output from the standard log package goes through the same handler.
+func setupLogging() error {
+	level, err := parseLogLevel()
+	if err != nil {
+		return err
+	}
+	logLevel.Set(level)
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q (expected text or json)", format)
+	}
+	slog.SetDefault(slog.New(kindHandler{handler}))
+	return nil
+}
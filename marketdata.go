@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"     // Package for formatted errors
+	"os"      // Package for environment variables
+	"slices"  // Package for finding CoinGecko among a record's sources
+	"strconv" // Package for parsing MARKET_DATA
+	"strings" // Package for splitting source lists
+	"sync"    // Package for guarding the captured market data
+
+	"bitcoin-tracker/tracker" // Market data type of the CoinGecko source
+)
+
+// With MARKET_DATA, CoinGecko's simple/price request also asks for the 24h trading
+// volume and the market cap, which cost no extra request. The source hands them over
+// through capturedMarketData, and the fetch stores them on the rows of the prices
+// CoinGecko supplied. Other providers quote a single exchange's book and have no
+// market-wide figures, so prices they supply leave both columns at 0.
+
+// MarketData is the market-wide figures CoinGecko returns alongside a price
+type MarketData = tracker.MarketData
+
+// marketDataEnabled asks CoinGecko for volume and market cap; configured via MARKET_DATA
+var marketDataEnabled = false
+
+// loadMarketDataConfig reads MARKET_DATA (default false)
+func loadMarketDataConfig() (bool, error) {
+	v := os.Getenv("MARKET_DATA")
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid MARKET_DATA %q", v)
+	}
+	return b, nil
+}
+
+// capturedMarketData holds the figures of the current fetch's CoinGecko responses by
+// currency, until it saves its prices
+var capturedMarketData struct {
+	mu   sync.Mutex
+	data map[string]MarketData
+}
+
+// captureMarketData keeps the figures of a CoinGecko response for the prices being saved
+func captureMarketData(data map[string]MarketData) {
+	capturedMarketData.mu.Lock()
+	defer capturedMarketData.mu.Unlock()
+	if capturedMarketData.data == nil {
+		capturedMarketData.data = make(map[string]MarketData)
+	}
+	for currency, d := range data {
+		capturedMarketData.data[currency] = d
+	}
+}
+
+// resetMarketData forgets the figures of the previous fetch, so one that fails over to
+// another provider doesn't store stale ones
+func resetMarketData() {
+	capturedMarketData.mu.Lock()
+	defer capturedMarketData.mu.Unlock()
+	capturedMarketData.data = nil
+}
+
+// attachMarketData sets the volume and market cap of the records CoinGecko priced, alone
+// or weighted with other providers, from the captured figures. A currency converted
+// from FX_BASE gets the base currency's figures at the same rate.
+func attachMarketData(records []PriceRecord) {
+	capturedMarketData.mu.Lock()
+	defer capturedMarketData.mu.Unlock()
+	data := capturedMarketData.data
+	for i := range records {
+		r := &records[i]
+		if len(data) == 0 || !slices.Contains(strings.Split(r.Source, ","), "coingecko") {
+			continue
+		}
+		d, ok := data[r.Currency]
+		if r.FXRate > 0 {
+			base, found := data[fxConfig.Base]
+			d, ok = MarketData{Volume: base.Volume * r.FXRate, MarketCap: base.MarketCap * r.FXRate}, found
+		}
+		if ok {
+			r.Volume, r.MarketCap = d.Volume, d.MarketCap
+		}
+	}
+}
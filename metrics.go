@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"      // Package for formatting metric lines
+	"log/slog" // Package for structured logging
+	"net/http" // Package for serving the metrics endpoint
+	"os"       // Package for environment variables
+	"sort"     // Package for stable metric output ordering
+	"strings"  // Package for building label strings
+	"sync"     // Package for guarding the registry
+)
+
+// metricsRegistry is a tiny in-process store of counters and gauges
+// It renders the Prometheus text exposition format so no client library is needed
+type metricsRegistry struct {
+	mu     sync.Mutex
+	types  map[string]string             // metric name -> "counter" or "gauge"
+	values map[string]map[string]float64 // metric name -> label string -> value
+}
+
+// metrics is the process-wide registry used by all subsystems
+var metrics = &metricsRegistry{
+	types:  make(map[string]string),
+	values: make(map[string]map[string]float64),
+}
+
+// formatLabels renders a label map as {k="v",...} with keys in sorted order
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// set stores a value for a metric/label combination, registering the metric type on first use
+func (m *metricsRegistry) set(kind, name string, labels map[string]string, value float64, add bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.values[name]; !ok {
+		m.types[name] = kind
+		m.values[name] = make(map[string]float64)
+	}
+
+	key := formatLabels(labels)
+	if add {
+		m.values[name][key] += value
+	} else {
+		m.values[name][key] = value
+	}
+}
+
+// setGauge sets a gauge metric to the given value
+func setGauge(name string, labels map[string]string, value float64) {
+	metrics.set("gauge", name, labels, value, false)
+}
+
+// incCounter increases a counter metric by delta
+func incCounter(name string, labels map[string]string, delta float64) {
+	metrics.set("counter", name, labels, delta, true)
+}
+
+// metricsHandler writes all registered metrics in Prometheus text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	names := make([]string, 0, len(metrics.values))
+	for name := range metrics.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, metrics.types[name])
+
+		series := metrics.values[name]
+		keys := make([]string, 0, len(series))
+		for k := range series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s%s %g\n", name, k, series[k])
+		}
+	}
+}
+
+// startMetricsServer serves /metrics on METRICS_ADDR (e.g. ":9090") when it is set
+// The server runs in the background; an empty address disables it
+func startMetricsServer(repo *Repository) {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		return
+	}
+
+	api := &apiServer{repo: repo}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/healthz", api.handleHealthz)
+	mux.HandleFunc("/readyz", api.handleReadyz)
+
+	go func() {
+		slog.Info("Serving metrics", "addr", addr, "path", "/metrics")
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Metrics server stopped", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"embed"    // Package for embedding the migration files
+	"fmt"      // Package for formatted I/O operations
+	"io/fs"    // Package for reading the embedded files
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"sort"     // Package for ordering migrations
+	"strconv"  // Package for parsing versions
+	"strings"  // Package for file name parsing
+	"time"     // Package for applied-at timestamps
+)
+
+// migrationFiles holds the schema migrations, one directory per dialect
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version   int        // Sequence number from the file name
+	Name      string     // Description from the file name
+	AppliedAt *time.Time // When it was applied; nil if pending
+	up        string     // SQL applying the change
+	down      string     // SQL reverting the change
+}
+
+// loadMigrations reads the embedded migrations for a dialect, ordered by version
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := "migrations/" + dialect
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s migrations: %w", dialect, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction := "", ""
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			base, direction = strings.TrimSuffix(file, ".up.sql"), "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			base, direction = strings.TrimSuffix(file, ".down.sql"), "down"
+		default:
+			continue
+		}
+
+		versionText, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionText)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration file name %s", file)
+		}
+
+		body, err := fs.ReadFile(migrationFiles, dir+"/"+file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ensureMigrationsTable creates the table recording applied migrations
+func (s *sqlStore) ensureMigrationsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,             -- Migration sequence number
+		name TEXT NOT NULL,                      -- Migration description
+		applied_at TIMESTAMP DEFAULT ` + s.now() + ` -- When the migration was applied
+	)`
+	if _, err := s.db.Exec(query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// Migrations implements Store
+func (s *sqlStore) Migrations() ([]Migration, error) {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	known := make(map[int]bool)
+	for i := range migrations {
+		known[migrations[i].Version] = true
+		if at, ok := applied[migrations[i].Version]; ok {
+			migrations[i].AppliedAt = &at
+		}
+	}
+
+	// A newer binary may have applied migrations this one doesn't know about
+	for version := range applied {
+		if !known[version] {
+			return nil, fmt.Errorf("database has migration %d applied, which this build does not know; upgrade the tracker", version)
+		}
+	}
+	return migrations, nil
+}
+
+// legacyTimezone returns LEGACY_TIMEZONE, the zone the server clock used when
+// timestamps were stored without one (default UTC); PostgreSQL validates the name
+func legacyTimezone() string {
+	if tz := os.Getenv("LEGACY_TIMEZONE"); tz != "" {
+		return tz
+	}
+	return "UTC"
+}
+
+// runMigration executes one migration's SQL and updates schema_migrations in a single transaction
+func (s *sqlStore) runMigration(m Migration, up bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction has been committed
+
+	body, record := m.up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	args := []interface{}{m.Version, m.Name}
+	if !up {
+		body, record = m.down, `DELETE FROM schema_migrations WHERE version = $1`
+		args = args[:1]
+	}
+
+	// Migrations that reinterpret wall-clock timestamps read the declared legacy zone
+	if s.dialect == "postgres" {
+		if _, err := tx.Exec(`SELECT set_config('tracker.legacy_timezone', $1, true)`, legacyTimezone()); err != nil {
+			return fmt.Errorf("failed to set legacy time zone: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(body); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.rebind(record), args...); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	return tx.Commit()
+}
+
+// MigrateUp implements Store
+func (s *sqlStore) MigrateUp(target int) ([]Migration, error) {
+	migrations, err := s.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if m.AppliedAt != nil || (target > 0 && m.Version > target) {
+			continue
+		}
+		if err := s.runMigration(m, true); err != nil {
+			return done, fmt.Errorf("failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown implements Store
+func (s *sqlStore) MigrateDown(steps int) ([]Migration, error) {
+	migrations, err := s.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if m.AppliedAt == nil {
+			continue
+		}
+		if m.down == "" {
+			return done, fmt.Errorf("migration %d_%s cannot be reverted (no down file)", m.Version, m.Name)
+		}
+		if err := s.runMigration(m, false); err != nil {
+			return done, fmt.Errorf("failed to revert migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		slog.Info("Reverted migration", "version", m.Version, "name", m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Init implements Store by applying every pending migration
+func (s *sqlStore) Init() error {
+	_, err := s.MigrateUp(0)
+	return err
+}
+
+// runMigrateCommand handles "migrate up [version]", "migrate down [steps]", and "migrate status"
+func runMigrateCommand(repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: migrate up [version] | down [steps] | status")
+	}
+
+	// parseCount reads the optional positive number after the subcommand
+	parseCount := func(fallback int) (int, error) {
+		if len(args) < 2 {
+			return fallback, nil
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid number %q", args[1])
+		}
+		return n, nil
+	}
+
+	switch args[0] {
+	case "up":
+		target, err := parseCount(0)
+		if err != nil {
+			return err
+		}
+		applied, err := repo.MigrateUp(target)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+		return nil
+
+	case "down":
+		steps, err := parseCount(1)
+		if err != nil {
+			return err
+		}
+		reverted, err := repo.MigrateDown(steps)
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations to revert")
+		}
+		return nil
+
+	case "status":
+		migrations, err := repo.Migrations()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n%-8s %-36s %-20s\n", "Version", "Name", "Applied")
+		fmt.Println("-----------------------------------------------------------------")
+		for _, m := range migrations {
+			applied := "pending"
+			if m.AppliedAt != nil {
+				applied = formatDisplayTime(*m.AppliedAt)
+			}
+			fmt.Printf("%-8d %-36s %-20s\n", m.Version, m.Name, applied)
+		}
+		fmt.Println()
+		return nil
+
+	default:
+		return validationErrorf("unknown migrate subcommand %q", args[0])
+	}
+}
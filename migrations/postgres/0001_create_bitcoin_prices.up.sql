@@ -0,0 +1,10 @@
+-- IF NOT EXISTS lets installs that predate migrations adopt this version in place
+CREATE TABLE IF NOT EXISTS bitcoin_prices (
+    id SERIAL PRIMARY KEY,              -- Auto-incrementing primary key
+    price DECIMAL(15,2) NOT NULL,       -- Bitcoin price with 2 decimal places
+    timestamp TIMESTAMP DEFAULT NOW()   -- When the price was recorded
+);
+
+-- Create an index on timestamp for faster queries
+CREATE INDEX IF NOT EXISTS idx_bitcoin_prices_timestamp
+ON bitcoin_prices(timestamp);
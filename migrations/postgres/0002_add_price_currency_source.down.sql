@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_bitcoin_prices_currency_timestamp;
+
+ALTER TABLE bitcoin_prices DROP COLUMN IF EXISTS source;
+
+ALTER TABLE bitcoin_prices DROP COLUMN IF EXISTS currency;
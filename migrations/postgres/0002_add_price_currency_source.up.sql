@@ -0,0 +1,11 @@
+-- Older installs only stored USD, so existing rows default to it
+ALTER TABLE bitcoin_prices
+ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'usd';
+
+-- Older installs only used CoinGecko
+ALTER TABLE bitcoin_prices
+ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'coingecko';
+
+-- Create an index for per-currency time range queries
+CREATE INDEX IF NOT EXISTS idx_bitcoin_prices_currency_timestamp
+ON bitcoin_prices(currency, timestamp);
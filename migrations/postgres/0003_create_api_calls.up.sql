@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS api_calls (
+    id SERIAL PRIMARY KEY,              -- Auto-incrementing primary key
+    provider TEXT NOT NULL,             -- Price provider that was called
+    asset TEXT NOT NULL,                -- Asset the call was made for
+    called_at TIMESTAMP DEFAULT NOW()   -- When the call was made
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_calls_called_at
+ON api_calls(called_at);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS reference_prices;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS reference_prices (
+    id SERIAL PRIMARY KEY,                 -- Auto-incrementing primary key
+    name TEXT NOT NULL UNIQUE,             -- User-chosen label
+    price DECIMAL(15,2) NOT NULL,          -- Reference price
+    currency TEXT NOT NULL DEFAULT 'usd',  -- Fiat currency of the price
+    reference_date DATE NOT NULL DEFAULT CURRENT_DATE -- Date the reference applies to
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS volatility_regimes (
+    currency TEXT NOT NULL,               -- Fiat currency the prices are quoted in
+    period_start DATE NOT NULL,           -- Monday of the ISO week
+    stddev DOUBLE PRECISION NOT NULL,     -- Stddev of log returns within the week
+    percentile DOUBLE PRECISION NOT NULL, -- Rank among trailing weeks (0-100)
+    regime TEXT NOT NULL,                 -- low, normal, or high
+    samples INTEGER NOT NULL,             -- Number of returns in the week
+    PRIMARY KEY (currency, period_start)
+);
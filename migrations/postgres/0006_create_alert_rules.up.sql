@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id SERIAL PRIMARY KEY,                     -- Auto-incrementing primary key
+    kind TEXT NOT NULL,                        -- above, below, or change
+    threshold DOUBLE PRECISION NOT NULL,       -- Price for above/below, percent for change
+    window_seconds INTEGER NOT NULL DEFAULT 0, -- Look-back window for change rules
+    currency TEXT NOT NULL DEFAULT 'usd',      -- Fiat currency the rule watches
+    regime TEXT NOT NULL DEFAULT '',           -- Required volatility regime ('' = any)
+    triggered BOOLEAN NOT NULL DEFAULT FALSE,  -- Condition met at the last evaluation
+    last_triggered TIMESTAMP,                  -- When the rule last fired
+    created_at TIMESTAMP DEFAULT NOW()         -- When the rule was added
+);
@@ -0,0 +1,3 @@
+ALTER TABLE alert_rules DROP COLUMN IF EXISTS cooldown_seconds;
+
+ALTER TABLE alert_rules DROP COLUMN IF EXISTS channels;
@@ -0,0 +1,6 @@
+-- Per-rule notifier selection and rate limiting
+ALTER TABLE alert_rules
+ADD COLUMN IF NOT EXISTS channels TEXT NOT NULL DEFAULT '';          -- Comma-separated notifier channels ('' = all)
+
+ALTER TABLE alert_rules
+ADD COLUMN IF NOT EXISTS cooldown_seconds INTEGER NOT NULL DEFAULT 0; -- Minimum seconds between notifications (0 = default)
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS bitcoin_candles (
+    currency TEXT NOT NULL,               -- Fiat currency the prices are quoted in
+    resolution TEXT NOT NULL,             -- Candle width: 1h or 1d
+    bucket_start TIMESTAMP NOT NULL,      -- Start of the candle (UTC)
+    open DOUBLE PRECISION NOT NULL,       -- First price in the bucket
+    high DOUBLE PRECISION NOT NULL,       -- Highest price in the bucket
+    low DOUBLE PRECISION NOT NULL,        -- Lowest price in the bucket
+    close DOUBLE PRECISION NOT NULL,      -- Last price in the bucket
+    samples INTEGER NOT NULL,             -- Number of raw prices rolled up
+    PRIMARY KEY (currency, resolution, bucket_start)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS candle_patterns (
+    currency TEXT NOT NULL,               -- Fiat currency the prices are quoted in
+    resolution TEXT NOT NULL,             -- Candle width: 1h or 1d
+    bucket_start TIMESTAMP NOT NULL,      -- Start of the candle the pattern completes (UTC)
+    pattern TEXT NOT NULL,                -- doji, hammer, bullish_engulfing, or bearish_engulfing
+    direction TEXT NOT NULL,              -- bullish, bearish, or neutral
+    confidence DOUBLE PRECISION NOT NULL, -- Detection confidence (0-1)
+    close DOUBLE PRECISION NOT NULL,      -- Closing price of the candle
+    detected_at TIMESTAMP DEFAULT NOW(),  -- When the pattern was detected
+    PRIMARY KEY (currency, resolution, bucket_start, pattern)
+);
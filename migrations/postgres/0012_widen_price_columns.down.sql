@@ -0,0 +1,3 @@
+-- Rounds every stored price back to cents and rewrites both tables
+ALTER TABLE bitcoin_prices ALTER COLUMN price TYPE DECIMAL(15,2);
+ALTER TABLE reference_prices ALTER COLUMN price TYPE DECIMAL(15,2);
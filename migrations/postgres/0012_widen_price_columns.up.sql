@@ -0,0 +1,9 @@
+-- Store prices as unconstrained NUMERIC so sats-denominated and small alt prices keep
+-- their sub-cent digits; the application rounds to PRICE_SCALE decimal places on write.
+-- Dropping a numeric column's precision limit doesn't rewrite the table (PostgreSQL
+-- 9.2+), so this only needs a brief exclusive lock. The lock timeout makes the
+-- migration fail fast instead of queueing behind long-running queries and blocking
+-- every reader in the meantime; just re-run it.
+SET LOCAL lock_timeout = '5s';
+ALTER TABLE bitcoin_prices ALTER COLUMN price TYPE NUMERIC;
+ALTER TABLE reference_prices ALTER COLUMN price TYPE NUMERIC;
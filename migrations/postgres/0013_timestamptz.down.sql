@@ -0,0 +1,35 @@
+-- Converts back to wall-clock TIMESTAMP columns: server-clock columns in the legacy
+-- zone (tracker.legacy_timezone), candle buckets and level touches in UTC
+SET LOCAL lock_timeout = '5s';
+
+ALTER TABLE bitcoin_prices
+    ALTER COLUMN timestamp TYPE TIMESTAMP
+    USING timestamp AT TIME ZONE current_setting('tracker.legacy_timezone');
+
+ALTER TABLE api_calls
+    ALTER COLUMN called_at TYPE TIMESTAMP
+    USING called_at AT TIME ZONE current_setting('tracker.legacy_timezone');
+
+ALTER TABLE alert_rules
+    ALTER COLUMN last_triggered TYPE TIMESTAMP
+    USING last_triggered AT TIME ZONE current_setting('tracker.legacy_timezone'),
+    ALTER COLUMN created_at TYPE TIMESTAMP
+    USING created_at AT TIME ZONE current_setting('tracker.legacy_timezone');
+
+ALTER TABLE bitcoin_candles
+    ALTER COLUMN bucket_start TYPE TIMESTAMP USING bucket_start AT TIME ZONE 'UTC';
+
+ALTER TABLE candle_patterns
+    ALTER COLUMN bucket_start TYPE TIMESTAMP USING bucket_start AT TIME ZONE 'UTC',
+    ALTER COLUMN detected_at TYPE TIMESTAMP
+    USING detected_at AT TIME ZONE current_setting('tracker.legacy_timezone');
+
+ALTER TABLE price_levels
+    ALTER COLUMN first_touch TYPE TIMESTAMP USING first_touch AT TIME ZONE 'UTC',
+    ALTER COLUMN last_touch TYPE TIMESTAMP USING last_touch AT TIME ZONE 'UTC',
+    ALTER COLUMN computed_at TYPE TIMESTAMP
+    USING computed_at AT TIME ZONE current_setting('tracker.legacy_timezone');
+
+ALTER TABLE schema_migrations
+    ALTER COLUMN applied_at TYPE TIMESTAMP
+    USING applied_at AT TIME ZONE current_setting('tracker.legacy_timezone');
@@ -0,0 +1,40 @@
+-- Store every timestamp as TIMESTAMPTZ so instants are unambiguous across DST changes.
+-- Columns filled by NOW() hold wall-clock times in the server's time zone; they are
+-- read as local times in the declared legacy zone (LEGACY_TIMEZONE, default UTC, which
+-- the migration runner passes in as tracker.legacy_timezone). Columns the tracker always
+-- wrote in UTC (candle buckets and level touches) are converted as UTC.
+-- Each ALTER rewrites its table under an exclusive lock; the lock timeout makes the
+-- migration fail fast rather than queue behind long-running queries.
+SET LOCAL lock_timeout = '5s';
+
+ALTER TABLE bitcoin_prices
+    ALTER COLUMN timestamp TYPE TIMESTAMPTZ
+    USING timestamp AT TIME ZONE current_setting('tracker.legacy_timezone');
+
+ALTER TABLE api_calls
+    ALTER COLUMN called_at TYPE TIMESTAMPTZ
+    USING called_at AT TIME ZONE current_setting('tracker.legacy_timezone');
+
+ALTER TABLE alert_rules
+    ALTER COLUMN last_triggered TYPE TIMESTAMPTZ
+    USING last_triggered AT TIME ZONE current_setting('tracker.legacy_timezone'),
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ
+    USING created_at AT TIME ZONE current_setting('tracker.legacy_timezone');
+
+ALTER TABLE bitcoin_candles
+    ALTER COLUMN bucket_start TYPE TIMESTAMPTZ USING bucket_start AT TIME ZONE 'UTC';
+
+ALTER TABLE candle_patterns
+    ALTER COLUMN bucket_start TYPE TIMESTAMPTZ USING bucket_start AT TIME ZONE 'UTC',
+    ALTER COLUMN detected_at TYPE TIMESTAMPTZ
+    USING detected_at AT TIME ZONE current_setting('tracker.legacy_timezone');
+
+ALTER TABLE price_levels
+    ALTER COLUMN first_touch TYPE TIMESTAMPTZ USING first_touch AT TIME ZONE 'UTC',
+    ALTER COLUMN last_touch TYPE TIMESTAMPTZ USING last_touch AT TIME ZONE 'UTC',
+    ALTER COLUMN computed_at TYPE TIMESTAMPTZ
+    USING computed_at AT TIME ZONE current_setting('tracker.legacy_timezone');
+
+ALTER TABLE schema_migrations
+    ALTER COLUMN applied_at TYPE TIMESTAMPTZ
+    USING applied_at AT TIME ZONE current_setting('tracker.legacy_timezone');
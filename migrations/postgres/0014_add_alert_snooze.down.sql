@@ -0,0 +1,2 @@
+ALTER TABLE alert_rules DROP COLUMN IF EXISTS disabled;
+ALTER TABLE alert_rules DROP COLUMN IF EXISTS snoozed_until;
@@ -0,0 +1,4 @@
+-- Rules can be snoozed or disabled, e.g. from the buttons on a notification
+ALTER TABLE alert_rules
+ADD COLUMN IF NOT EXISTS snoozed_until TIMESTAMPTZ, -- Rule is not evaluated before this time (NULL = not snoozed)
+ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE; -- Rule is not evaluated until re-enabled
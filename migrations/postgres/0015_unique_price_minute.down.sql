@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_bitcoin_prices_coin_currency_minute;
+ALTER TABLE bitcoin_prices DROP COLUMN IF EXISTS coin;
@@ -0,0 +1,23 @@
+-- At most one price per coin, currency, and UTC minute, so overlapping fetches (two
+-- instances, or a manual fetch next to the scheduler) can't store near-duplicates.
+-- Every price stored so far is Bitcoin's.
+ALTER TABLE bitcoin_prices
+ADD COLUMN IF NOT EXISTS coin VARCHAR(32) NOT NULL DEFAULT 'bitcoin';
+
+-- Duplicates already stored are left for dedupe to remove, which reports what it
+-- deletes, rather than deleted here unseen
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM bitcoin_prices
+        GROUP BY coin, currency, date_trunc('minute', timestamp AT TIME ZONE 'UTC')
+        HAVING COUNT(*) > 1
+    ) THEN
+        RAISE EXCEPTION 'bitcoin_prices holds more than one price per coin, currency, and minute; run `bitcoin-tracker dedupe` first, then migrate again';
+    END IF;
+END
+$$;
+
+-- AT TIME ZONE pins the truncation to UTC, which also makes the expression immutable
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bitcoin_prices_coin_currency_minute
+ON bitcoin_prices (coin, currency, date_trunc('minute', timestamp AT TIME ZONE 'UTC'));
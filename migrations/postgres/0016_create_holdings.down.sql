@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS portfolio_snapshots;
+DROP TABLE IF EXISTS holdings;
@@ -0,0 +1,23 @@
+-- Holdings are lots of an asset with what they cost; a portfolio is their sum
+CREATE TABLE IF NOT EXISTS holdings (
+    id SERIAL PRIMARY KEY,                 -- Auto-incrementing primary key
+    asset TEXT NOT NULL,                   -- Asset ID, e.g. bitcoin or ethereum
+    quantity NUMERIC NOT NULL,             -- Units held
+    cost NUMERIC NOT NULL DEFAULT 0,       -- Total paid for the lot (0 = unknown)
+    currency TEXT NOT NULL,                -- Fiat currency of the cost
+    acquired_at TIMESTAMPTZ NOT NULL,      -- When the lot was bought
+    created_at TIMESTAMPTZ DEFAULT NOW()   -- When the holding was registered
+);
+
+-- The portfolio's value over time, recorded by the scheduler
+CREATE TABLE IF NOT EXISTS portfolio_snapshots (
+    id SERIAL PRIMARY KEY,                 -- Auto-incrementing primary key
+    currency TEXT NOT NULL,                -- Fiat currency of the figures
+    value NUMERIC NOT NULL,                -- Value of every holding
+    cost NUMERIC NOT NULL,                 -- Cost of the holdings with a known cost in the currency
+    gain NUMERIC NOT NULL,                 -- Value of those holdings minus their cost
+    recorded_at TIMESTAMPTZ DEFAULT NOW()  -- When the snapshot was taken
+);
+
+CREATE INDEX IF NOT EXISTS idx_portfolio_snapshots_currency_recorded_at
+ON portfolio_snapshots(currency, recorded_at);
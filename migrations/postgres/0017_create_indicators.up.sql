@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS indicators (
+    currency TEXT NOT NULL,               -- Fiat currency the prices are quoted in
+    resolution TEXT NOT NULL,             -- Candle width the indicator is computed on: 1h or 1d
+    bucket_start TIMESTAMPTZ NOT NULL,    -- Start of the candle the value belongs to
+    name TEXT NOT NULL,                   -- Indicator and window, e.g. sma50, rsi14, bb20_upper
+    value DOUBLE PRECISION NOT NULL,      -- Indicator value at the candle's close
+    PRIMARY KEY (currency, resolution, bucket_start, name)
+);
+
+-- Indicator rules fire when a comparison between indicators becomes true, e.g. a
+-- golden cross (sma50 rising above sma200)
+ALTER TABLE alert_rules
+ADD COLUMN IF NOT EXISTS indicator TEXT NOT NULL DEFAULT ''; -- Condition for indicator rules, e.g. 1d:sma50>sma200
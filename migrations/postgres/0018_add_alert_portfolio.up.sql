@@ -0,0 +1,4 @@
+-- Portfolio rules fire when the portfolio's value, or a position's gain, crosses a
+-- threshold, e.g. value>50000 or bitcoin:gain_pct<-10
+ALTER TABLE alert_rules
+ADD COLUMN IF NOT EXISTS portfolio TEXT NOT NULL DEFAULT ''; -- Condition for portfolio rules, e.g. bitcoin:gain_pct<-10
@@ -0,0 +1,16 @@
+-- Disposals are the parts of holdings that were sold, matched first in, first out;
+-- each row keeps the lot's acquisition date and share of its cost for tax reports
+CREATE TABLE IF NOT EXISTS disposals (
+    id SERIAL PRIMARY KEY,                 -- Auto-incrementing primary key
+    holding_id INTEGER NOT NULL,           -- Holding the units came from (may since be removed)
+    asset TEXT NOT NULL,                   -- Asset ID, e.g. bitcoin or ethereum
+    quantity NUMERIC NOT NULL,             -- Units sold from the holding
+    cost NUMERIC NOT NULL DEFAULT 0,       -- Share of the holding's cost (0 = unknown)
+    proceeds NUMERIC NOT NULL,             -- Share of the sale's proceeds
+    currency TEXT NOT NULL,                -- Fiat currency of cost and proceeds
+    acquired_at TIMESTAMPTZ NOT NULL,      -- When the holding was bought
+    disposed_at TIMESTAMPTZ NOT NULL,      -- When the units were sold
+    created_at TIMESTAMPTZ DEFAULT NOW()   -- When the sale was registered
+);
+
+CREATE INDEX IF NOT EXISTS idx_disposals_disposed_at ON disposals(disposed_at);
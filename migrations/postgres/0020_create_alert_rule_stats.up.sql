@@ -0,0 +1,14 @@
+-- Alert rule statistics count how often each rule is checked and how often it fires,
+-- so rules that notify too often (or never) can be found and tuned
+CREATE TABLE IF NOT EXISTS alert_rule_stats (
+    rule_id INTEGER PRIMARY KEY,           -- Rule the counts belong to
+    evaluations BIGINT NOT NULL DEFAULT 0, -- Times the rule was checked against new data
+    triggers BIGINT NOT NULL DEFAULT 0,    -- Times its condition started to hold (or a pattern matched)
+    notifications BIGINT NOT NULL DEFAULT 0, -- Triggers that sent a notification
+    suppressed BIGINT NOT NULL DEFAULT 0,  -- Triggers silenced by the rule's cooldown
+    errors BIGINT NOT NULL DEFAULT 0,      -- Evaluations that failed
+    last_evaluated_at TIMESTAMPTZ,         -- When the rule was last checked
+    last_triggered_at TIMESTAMPTZ,         -- When its condition last started to hold
+    last_notified_at TIMESTAMPTZ,          -- When it last sent a notification
+    since TIMESTAMPTZ DEFAULT NOW()        -- When counting started
+);
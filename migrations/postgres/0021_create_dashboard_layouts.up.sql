@@ -0,0 +1,6 @@
+-- Dashboard layouts store each user's arrangement of dashboard widgets
+CREATE TABLE IF NOT EXISTS dashboard_layouts (
+    user_name TEXT PRIMARY KEY,            -- User the layout belongs to
+    widgets TEXT NOT NULL,                 -- Widgets in display order, as a JSON array
+    updated_at TIMESTAMPTZ DEFAULT NOW()   -- When the layout was last saved
+);
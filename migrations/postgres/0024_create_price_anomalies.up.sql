@@ -0,0 +1,16 @@
+-- Prices that deviated too far from recent history when they were fetched
+-- Quarantined prices were kept out of bitcoin_prices; flagged ones were stored anyway
+CREATE TABLE IF NOT EXISTS price_anomalies (
+    id SERIAL PRIMARY KEY,                 -- Auto-incrementing primary key
+    currency TEXT NOT NULL,                -- Fiat currency the price is quoted in
+    price NUMERIC NOT NULL,                -- The suspicious price
+    source TEXT NOT NULL,                  -- Provider that returned it
+    baseline NUMERIC NOT NULL,             -- Median of the recent prices it was compared with
+    deviation DOUBLE PRECISION NOT NULL,   -- Percent difference from the baseline
+    action TEXT NOT NULL,                  -- quarantined or flagged
+    detected_at TIMESTAMPTZ NOT NULL,      -- When the price was fetched
+    released_at TIMESTAMPTZ                -- When a quarantined price was moved into bitcoin_prices
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_anomalies_detected_at
+ON price_anomalies (detected_at);
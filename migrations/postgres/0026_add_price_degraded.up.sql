@@ -0,0 +1,3 @@
+-- Aggregated prices that met PRICE_QUORUM without every source of PRICE_SOURCES
+ALTER TABLE bitcoin_prices
+ADD COLUMN IF NOT EXISTS degraded BOOLEAN NOT NULL DEFAULT FALSE;
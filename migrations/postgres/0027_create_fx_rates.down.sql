@@ -0,0 +1,3 @@
+ALTER TABLE bitcoin_prices DROP COLUMN IF EXISTS fx_rate;
+
+DROP TABLE IF EXISTS fx_rates;
@@ -0,0 +1,20 @@
+-- Exports and backfills requested through POST /exports, run in the background
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id SERIAL PRIMARY KEY,                 -- Auto-incrementing primary key
+    kind TEXT NOT NULL,                    -- prices or backfill
+    format TEXT NOT NULL,                  -- csv or json for prices jobs; empty for backfills
+    currency TEXT NOT NULL,                -- Currency covered; empty for every currency
+    from_time TIMESTAMPTZ,                 -- Start of the range; NULL from the first record
+    to_time TIMESTAMPTZ NOT NULL,          -- End of the range, exclusive
+    status TEXT NOT NULL,                  -- queued, running, done, or failed
+    done BIGINT NOT NULL DEFAULT 0,        -- Work done: records written, or days backfilled
+    total BIGINT NOT NULL DEFAULT 0,       -- Work expected in the same unit as done
+    records BIGINT NOT NULL DEFAULT 0,     -- Records written or imported
+    error TEXT NOT NULL DEFAULT '',        -- Why a failed job failed
+    created_at TIMESTAMPTZ NOT NULL,       -- When the job was requested
+    updated_at TIMESTAMPTZ NOT NULL,       -- Last progress of a running job
+    finished_at TIMESTAMPTZ                -- When the job was done or failed
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_status
+ON export_jobs (status, created_at);
@@ -0,0 +1,17 @@
+-- Index values of the baskets of BASKETS, computed on every fetch as their own series
+CREATE TABLE IF NOT EXISTS basket_values (
+    id SERIAL PRIMARY KEY,                 -- Auto-incrementing primary key
+    basket TEXT NOT NULL,                  -- Basket name from BASKETS
+    currency TEXT NOT NULL,                -- Fiat currency the value is quoted in
+    value NUMERIC NOT NULL,                -- Combined value of the constituents
+    members TEXT NOT NULL DEFAULT '',      -- Comma-separated CoinGecko IDs of the constituents
+    timestamp TIMESTAMPTZ NOT NULL         -- When the value was computed
+);
+
+-- One value per basket and currency per tick; also serves the history queries
+CREATE UNIQUE INDEX IF NOT EXISTS idx_basket_values_basket_timestamp
+ON basket_values (basket, currency, timestamp);
+
+-- Basket rules watch a basket's value instead of the Bitcoin price
+ALTER TABLE alert_rules
+ADD COLUMN IF NOT EXISTS basket TEXT NOT NULL DEFAULT ''; -- Basket name for basket rules
@@ -0,0 +1 @@
+ALTER TABLE export_jobs DROP COLUMN IF EXISTS price_precision;
@@ -0,0 +1,7 @@
+-- Heartbeat of the scheduler instance running the jobs, watched by warm standbys
+CREATE TABLE IF NOT EXISTS scheduler_heartbeats (
+    role TEXT PRIMARY KEY,                 -- Always 'primary'; one row per role
+    instance TEXT NOT NULL,                -- INSTANCE_NAME of the instance that last beat
+    interval_seconds INTEGER NOT NULL,     -- HEARTBEAT_INTERVAL of that instance
+    beat_at TIMESTAMPTZ NOT NULL DEFAULT NOW() -- When it last beat (database clock)
+);
@@ -0,0 +1 @@
+ALTER TABLE bitcoin_prices DROP COLUMN IF EXISTS market_cap, DROP COLUMN IF EXISTS volume_24h;
@@ -0,0 +1,5 @@
+-- CoinGecko's 24h trading volume and market cap in the price's currency, captured with
+-- MARKET_DATA; 0 when not captured
+ALTER TABLE bitcoin_prices
+ADD COLUMN IF NOT EXISTS volume_24h DOUBLE PRECISION NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS market_cap DOUBLE PRECISION NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- Daily Crypto Fear & Greed index readings, collected with FEAR_GREED
+CREATE TABLE IF NOT EXISTS fear_greed (
+    day TIMESTAMPTZ PRIMARY KEY,           -- Midnight UTC of the day the reading is for
+    value INTEGER NOT NULL,                -- Index value, 0 (extreme fear) to 100 (extreme greed)
+    classification TEXT NOT NULL,          -- Label of the value, e.g. "Extreme Fear"
+    fetched_at TIMESTAMPTZ NOT NULL        -- When the reading was fetched
+);
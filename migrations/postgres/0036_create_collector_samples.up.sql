@@ -0,0 +1,13 @@
+-- Values recorded by the collectors of COLLECTORS, e.g. the on-chain hashrate
+CREATE TABLE IF NOT EXISTS collector_samples (
+    id SERIAL PRIMARY KEY,                 -- Auto-incrementing primary key
+    collector TEXT NOT NULL,               -- Collector that recorded the value, e.g. "onchain"
+    metric TEXT NOT NULL,                  -- What was measured, e.g. "hashrate"
+    value DOUBLE PRECISION NOT NULL,       -- Measured value, in the metric's unit
+    source TEXT NOT NULL,                  -- Provider the value was fetched from
+    timestamp TIMESTAMPTZ NOT NULL         -- When the value was collected
+);
+
+-- Serves the per-metric range and latest-value lookups
+CREATE INDEX IF NOT EXISTS idx_collector_samples_metric_timestamp
+ON collector_samples (metric, timestamp);
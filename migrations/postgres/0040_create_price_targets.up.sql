@@ -0,0 +1,12 @@
+-- One-shot price targets: each notifies once, when the price first crosses it, and
+-- stays fired until re-armed
+CREATE TABLE IF NOT EXISTS price_targets (
+    id SERIAL PRIMARY KEY,                 -- Auto-incrementing primary key
+    currency TEXT NOT NULL,                -- Fiat currency of the target price
+    price NUMERIC NOT NULL,                -- Target price of one bitcoin
+    direction TEXT NOT NULL,               -- above or below: the side the price crosses to
+    note TEXT NOT NULL DEFAULT '',         -- Why the target was set, repeated in the notification
+    created_at TIMESTAMPTZ NOT NULL,       -- When the target was set
+    fired_at TIMESTAMPTZ,                  -- When the price crossed it; NULL while pending
+    fired_price NUMERIC                    -- Price that crossed it
+);
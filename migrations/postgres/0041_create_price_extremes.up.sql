@@ -0,0 +1,11 @@
+-- All-time high and low of every coin and currency, seeded from the stored prices and
+-- moved by every fetch that passes them
+CREATE TABLE IF NOT EXISTS price_extremes (
+    coin TEXT NOT NULL,                    -- Coin the extremes are of, e.g. bitcoin
+    currency TEXT NOT NULL,                -- Fiat currency the prices are quoted in
+    ath NUMERIC NOT NULL,                  -- All-time high
+    ath_at TIMESTAMPTZ NOT NULL,           -- When the all-time high was stored
+    atl NUMERIC NOT NULL,                  -- All-time low
+    atl_at TIMESTAMPTZ NOT NULL,           -- When the all-time low was stored
+    PRIMARY KEY (coin, currency)
+);
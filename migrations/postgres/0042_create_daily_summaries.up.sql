@@ -0,0 +1,13 @@
+-- One row per currency and UTC day summarizing its prices, refreshed by the
+-- scheduler's daily_summaries job so long-range statistics needn't scan raw prices
+CREATE TABLE IF NOT EXISTS daily_summaries (
+    currency TEXT NOT NULL,                -- Fiat currency the prices are quoted in
+    day TIMESTAMPTZ NOT NULL,              -- Midnight UTC of the day summarized
+    open NUMERIC NOT NULL,                 -- First price of the day
+    high NUMERIC NOT NULL,                 -- Highest price of the day
+    low NUMERIC NOT NULL,                  -- Lowest price of the day
+    close NUMERIC NOT NULL,                -- Last price of the day
+    avg NUMERIC NOT NULL,                  -- Mean of the day's prices
+    sample_count INTEGER NOT NULL,         -- Number of prices summarized
+    PRIMARY KEY (currency, day)
+);
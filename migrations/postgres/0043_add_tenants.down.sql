@@ -0,0 +1,5 @@
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenant;
+ALTER TABLE portfolio_snapshots DROP COLUMN IF EXISTS tenant;
+ALTER TABLE disposals DROP COLUMN IF EXISTS tenant;
+ALTER TABLE holdings DROP COLUMN IF EXISTS tenant;
+ALTER TABLE alert_rules DROP COLUMN IF EXISTS tenant;
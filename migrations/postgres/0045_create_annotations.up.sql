@@ -0,0 +1,13 @@
+-- Labels attached to points in time, e.g. "halving" or "I bought here", shown on charts
+-- and Grafana panels and carried into exports
+CREATE TABLE IF NOT EXISTS annotations (
+    id SERIAL PRIMARY KEY,                 -- Auto-incrementing primary key
+    time TIMESTAMPTZ NOT NULL,             -- Point in time the annotation marks
+    text TEXT NOT NULL,                    -- What happened, e.g. "ETF approval"
+    tags TEXT NOT NULL DEFAULT '',         -- Comma-separated tags for filtering, e.g. "halving,event"
+    created_at TIMESTAMPTZ NOT NULL        -- When the annotation was added
+);
+
+-- Serves the range lookups of charts, Grafana, and exports
+CREATE INDEX IF NOT EXISTS idx_annotations_time
+ON annotations (time);
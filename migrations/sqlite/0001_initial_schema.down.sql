@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS alert_rules;
+DROP TABLE IF EXISTS volatility_regimes;
+DROP TABLE IF EXISTS reference_prices;
+DROP TABLE IF EXISTS api_calls;
+DROP TABLE IF EXISTS bitcoin_prices;
@@ -0,0 +1,59 @@
+-- SQLite support arrived with every table in its current shape, so the baseline
+-- is a single migration. IF NOT EXISTS lets databases created before migrations
+-- adopt it in place.
+-- Timestamps are stored as UTC text ("YYYY-MM-DD HH:MM:SS") by CURRENT_TIMESTAMP defaults.
+CREATE TABLE IF NOT EXISTS bitcoin_prices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,   -- Auto-incrementing primary key
+    price REAL NOT NULL,                    -- Bitcoin price
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the price was recorded (UTC)
+    currency TEXT NOT NULL DEFAULT 'usd',   -- Fiat currency of the price
+    source TEXT NOT NULL DEFAULT 'coingecko' -- Provider that supplied the price
+);
+
+CREATE INDEX IF NOT EXISTS idx_bitcoin_prices_timestamp
+ON bitcoin_prices(timestamp);
+
+CREATE INDEX IF NOT EXISTS idx_bitcoin_prices_currency_timestamp
+ON bitcoin_prices(currency, timestamp);
+
+CREATE TABLE IF NOT EXISTS api_calls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,   -- Auto-incrementing primary key
+    provider TEXT NOT NULL,                 -- Price provider that was called
+    asset TEXT NOT NULL,                    -- Asset the call was made for
+    called_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- When the call was made (UTC)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_calls_called_at
+ON api_calls(called_at);
+
+CREATE TABLE IF NOT EXISTS reference_prices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,   -- Auto-incrementing primary key
+    name TEXT NOT NULL UNIQUE,              -- User-chosen label
+    price REAL NOT NULL,                    -- Reference price
+    currency TEXT NOT NULL DEFAULT 'usd',   -- Fiat currency of the price
+    reference_date DATE NOT NULL DEFAULT CURRENT_DATE -- Date the reference applies to
+);
+
+CREATE TABLE IF NOT EXISTS volatility_regimes (
+    currency TEXT NOT NULL,                 -- Fiat currency the prices are quoted in
+    period_start DATE NOT NULL,             -- Monday of the ISO week
+    stddev REAL NOT NULL,                   -- Stddev of log returns within the week
+    percentile REAL NOT NULL,               -- Rank among trailing weeks (0-100)
+    regime TEXT NOT NULL,                   -- low, normal, or high
+    samples INTEGER NOT NULL,               -- Number of returns in the week
+    PRIMARY KEY (currency, period_start)
+);
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,   -- Auto-incrementing primary key
+    kind TEXT NOT NULL,                     -- above, below, or change
+    threshold REAL NOT NULL,                -- Price for above/below, percent for change
+    window_seconds INTEGER NOT NULL DEFAULT 0, -- Look-back window for change rules
+    currency TEXT NOT NULL DEFAULT 'usd',   -- Fiat currency the rule watches
+    regime TEXT NOT NULL DEFAULT '',        -- Required volatility regime ('' = any)
+    channels TEXT NOT NULL DEFAULT '',      -- Comma-separated notifier channels ('' = all)
+    cooldown_seconds INTEGER NOT NULL DEFAULT 0, -- Minimum seconds between notifications (0 = default)
+    triggered BOOLEAN NOT NULL DEFAULT FALSE, -- Condition met at the last evaluation
+    last_triggered TIMESTAMP,               -- When the rule last fired (UTC)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- When the rule was added (UTC)
+);
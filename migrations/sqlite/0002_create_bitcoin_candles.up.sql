@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS bitcoin_candles (
+    currency TEXT NOT NULL,                 -- Fiat currency the prices are quoted in
+    resolution TEXT NOT NULL,               -- Candle width: 1h or 1d
+    bucket_start TIMESTAMP NOT NULL,        -- Start of the candle (UTC)
+    open REAL NOT NULL,                     -- First price in the bucket
+    high REAL NOT NULL,                     -- Highest price in the bucket
+    low REAL NOT NULL,                      -- Lowest price in the bucket
+    close REAL NOT NULL,                    -- Last price in the bucket
+    samples INTEGER NOT NULL,               -- Number of raw prices rolled up
+    PRIMARY KEY (currency, resolution, bucket_start)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS candle_patterns (
+    currency TEXT NOT NULL,                 -- Fiat currency the prices are quoted in
+    resolution TEXT NOT NULL,               -- Candle width: 1h or 1d
+    bucket_start TIMESTAMP NOT NULL,        -- Start of the candle the pattern completes (UTC)
+    pattern TEXT NOT NULL,                  -- doji, hammer, bullish_engulfing, or bearish_engulfing
+    direction TEXT NOT NULL,                -- bullish, bearish, or neutral
+    confidence REAL NOT NULL,               -- Detection confidence (0-1)
+    close REAL NOT NULL,                    -- Closing price of the candle
+    detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the pattern was detected (UTC)
+    PRIMARY KEY (currency, resolution, bucket_start, pattern)
+);
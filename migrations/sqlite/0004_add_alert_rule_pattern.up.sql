@@ -0,0 +1,3 @@
+-- Pattern rules fire when a candlestick pattern with this name is detected
+ALTER TABLE alert_rules
+ADD COLUMN pattern TEXT NOT NULL DEFAULT ''; -- Pattern name for pattern rules ('' = any)
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS price_levels (
+    currency TEXT NOT NULL,                 -- Fiat currency the prices are quoted in
+    price REAL NOT NULL,                    -- Level price (mean of the clustered turning points)
+    kind TEXT NOT NULL,                     -- support (below the last close) or resistance (above it)
+    touches INTEGER NOT NULL,               -- Turning points that make up the level
+    first_touch TIMESTAMP NOT NULL,         -- Start of the oldest daily candle touching the level (UTC)
+    last_touch TIMESTAMP NOT NULL,          -- Start of the newest daily candle touching the level (UTC)
+    computed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the levels were last recomputed (UTC)
+    PRIMARY KEY (currency, price)
+);
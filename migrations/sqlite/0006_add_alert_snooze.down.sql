@@ -0,0 +1,2 @@
+ALTER TABLE alert_rules DROP COLUMN disabled;
+ALTER TABLE alert_rules DROP COLUMN snoozed_until;
@@ -0,0 +1,5 @@
+-- Rules can be snoozed or disabled, e.g. from the buttons on a notification
+ALTER TABLE alert_rules
+ADD COLUMN snoozed_until TIMESTAMP; -- Rule is not evaluated before this time (UTC, NULL = not snoozed)
+ALTER TABLE alert_rules
+ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE; -- Rule is not evaluated until re-enabled
@@ -0,0 +1,25 @@
+-- At most one price per coin, currency, and UTC minute, so overlapping fetches (two
+-- instances, or a manual fetch next to the scheduler) can't store near-duplicates.
+-- Every price stored so far is Bitcoin's.
+ALTER TABLE bitcoin_prices
+ADD COLUMN coin TEXT NOT NULL DEFAULT 'bitcoin';
+
+-- Duplicates already stored are left for dedupe to remove, which reports what it
+-- deletes, rather than deleted here unseen. SQLite has no RAISE outside triggers, so
+-- the check fails the migration through a trigger on a scratch table.
+CREATE TEMP TABLE unique_price_minute_check (duplicates INTEGER);
+CREATE TEMP TRIGGER unique_price_minute_check BEFORE INSERT ON unique_price_minute_check
+WHEN NEW.duplicates > 0
+BEGIN
+    SELECT RAISE(ABORT, 'bitcoin_prices holds more than one price per coin, currency, and minute; run `bitcoin-tracker dedupe` first, then migrate again');
+END;
+INSERT INTO unique_price_minute_check
+SELECT COUNT(*) FROM (
+    SELECT 1 FROM bitcoin_prices
+    GROUP BY coin, currency, strftime('%Y-%m-%d %H:%M', timestamp)
+    HAVING COUNT(*) > 1
+);
+DROP TABLE unique_price_minute_check;
+
+CREATE UNIQUE INDEX idx_bitcoin_prices_coin_currency_minute
+ON bitcoin_prices (coin, currency, strftime('%Y-%m-%d %H:%M', timestamp));
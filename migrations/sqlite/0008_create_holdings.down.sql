@@ -0,0 +1,2 @@
+DROP TABLE portfolio_snapshots;
+DROP TABLE holdings;
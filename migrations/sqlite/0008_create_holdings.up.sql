@@ -0,0 +1,23 @@
+-- Holdings are lots of an asset with what they cost; a portfolio is their sum
+CREATE TABLE holdings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    asset TEXT NOT NULL,                   -- Asset ID, e.g. bitcoin or ethereum
+    quantity REAL NOT NULL,                -- Units held
+    cost REAL NOT NULL DEFAULT 0,          -- Total paid for the lot (0 = unknown)
+    currency TEXT NOT NULL,                -- Fiat currency of the cost
+    acquired_at TIMESTAMP NOT NULL,        -- When the lot was bought (UTC)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- When the holding was registered (UTC)
+);
+
+-- The portfolio's value over time, recorded by the scheduler
+CREATE TABLE portfolio_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    currency TEXT NOT NULL,                -- Fiat currency of the figures
+    value REAL NOT NULL,                   -- Value of every holding
+    cost REAL NOT NULL,                    -- Cost of the holdings with a known cost in the currency
+    gain REAL NOT NULL,                    -- Value of those holdings minus their cost
+    recorded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- When the snapshot was taken (UTC)
+);
+
+CREATE INDEX idx_portfolio_snapshots_currency_recorded_at
+ON portfolio_snapshots(currency, recorded_at);
@@ -0,0 +1,2 @@
+ALTER TABLE alert_rules DROP COLUMN indicator;
+DROP TABLE IF EXISTS indicators;
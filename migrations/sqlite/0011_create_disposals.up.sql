@@ -0,0 +1,16 @@
+-- Disposals are the parts of holdings that were sold, matched first in, first out;
+-- each row keeps the lot's acquisition date and share of its cost for tax reports
+CREATE TABLE disposals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    holding_id INTEGER NOT NULL,           -- Holding the units came from (may since be removed)
+    asset TEXT NOT NULL,                   -- Asset ID, e.g. bitcoin or ethereum
+    quantity REAL NOT NULL,                -- Units sold from the holding
+    cost REAL NOT NULL DEFAULT 0,          -- Share of the holding's cost (0 = unknown)
+    proceeds REAL NOT NULL,                -- Share of the sale's proceeds
+    currency TEXT NOT NULL,                -- Fiat currency of cost and proceeds
+    acquired_at TIMESTAMP NOT NULL,        -- When the holding was bought (UTC)
+    disposed_at TIMESTAMP NOT NULL,        -- When the units were sold (UTC)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- When the sale was registered (UTC)
+);
+
+CREATE INDEX idx_disposals_disposed_at ON disposals(disposed_at);
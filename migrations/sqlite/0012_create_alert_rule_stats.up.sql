@@ -0,0 +1,14 @@
+-- Alert rule statistics count how often each rule is checked and how often it fires,
+-- so rules that notify too often (or never) can be found and tuned
+CREATE TABLE alert_rule_stats (
+    rule_id INTEGER PRIMARY KEY,           -- Rule the counts belong to
+    evaluations INTEGER NOT NULL DEFAULT 0, -- Times the rule was checked against new data
+    triggers INTEGER NOT NULL DEFAULT 0,   -- Times its condition started to hold (or a pattern matched)
+    notifications INTEGER NOT NULL DEFAULT 0, -- Triggers that sent a notification
+    suppressed INTEGER NOT NULL DEFAULT 0, -- Triggers silenced by the rule's cooldown
+    errors INTEGER NOT NULL DEFAULT 0,     -- Evaluations that failed
+    last_evaluated_at TIMESTAMP,           -- When the rule was last checked (UTC)
+    last_triggered_at TIMESTAMP,           -- When its condition last started to hold (UTC)
+    last_notified_at TIMESTAMP,            -- When it last sent a notification (UTC)
+    since TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- When counting started (UTC)
+);
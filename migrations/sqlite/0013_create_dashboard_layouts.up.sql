@@ -0,0 +1,6 @@
+-- Dashboard layouts store each user's arrangement of dashboard widgets
+CREATE TABLE dashboard_layouts (
+    user_name TEXT PRIMARY KEY,            -- User the layout belongs to
+    widgets TEXT NOT NULL,                 -- Widgets in display order, as a JSON array
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- When the layout was last saved (UTC)
+);
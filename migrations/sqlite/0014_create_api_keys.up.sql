@@ -0,0 +1,12 @@
+-- API keys authenticate clients of the HTTP and gRPC APIs
+-- Only a SHA-256 hash of each key is stored; the key itself is shown once, when created
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    name TEXT NOT NULL,                    -- What or who the key is for
+    prefix TEXT NOT NULL,                  -- First characters of the key, to tell keys apart
+    key_hash TEXT NOT NULL UNIQUE,         -- Hex SHA-256 of the key
+    rate_limit INTEGER NOT NULL DEFAULT 0, -- Requests per minute; 0 = API_KEY_RATE_LIMIT
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the key was created (UTC)
+    last_used_at TIMESTAMP,                -- When the key last authenticated a request (UTC, to the minute)
+    revoked_at TIMESTAMP                   -- When the key was revoked (UTC); NULL while active
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS passkey_invites;
+DROP TABLE IF EXISTS passkeys;
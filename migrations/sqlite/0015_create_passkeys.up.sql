@@ -0,0 +1,25 @@
+-- Passkeys (WebAuthn credentials) sign users in to the dashboard
+-- Only the public key is stored; the private key never leaves the user's authenticator
+CREATE TABLE passkeys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    user_name TEXT NOT NULL,               -- User the passkey signs in
+    name TEXT NOT NULL,                    -- What the passkey is on, e.g. "phone"
+    credential_id TEXT NOT NULL UNIQUE,    -- Base64url credential ID chosen by the authenticator
+    public_key TEXT NOT NULL,              -- Base64url COSE public key
+    sign_count INTEGER NOT NULL DEFAULT 0, -- Authenticator signature counter, to detect cloned keys
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the passkey was registered (UTC)
+    last_used_at TIMESTAMP                 -- When the passkey last signed in (UTC)
+);
+
+CREATE INDEX idx_passkeys_user_name ON passkeys(user_name);
+
+-- Invites let a user register a passkey; each is used at most once
+-- Only a SHA-256 hash of the invite code is stored; the code is shown once, when created
+CREATE TABLE passkey_invites (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    user_name TEXT NOT NULL,               -- User the registered passkey will sign in
+    token_hash TEXT NOT NULL UNIQUE,       -- Hex SHA-256 of the invite code
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- When the invite was created (UTC)
+    expires_at TIMESTAMP NOT NULL,         -- When the invite stops working (UTC)
+    used_at TIMESTAMP                      -- When a passkey was registered with it (UTC); NULL while unused
+);
@@ -0,0 +1,16 @@
+-- Prices that deviated too far from recent history when they were fetched
+-- Quarantined prices were kept out of bitcoin_prices; flagged ones were stored anyway
+CREATE TABLE price_anomalies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    currency TEXT NOT NULL,                -- Fiat currency the price is quoted in
+    price REAL NOT NULL,                   -- The suspicious price
+    source TEXT NOT NULL,                  -- Provider that returned it
+    baseline REAL NOT NULL,                -- Median of the recent prices it was compared with
+    deviation REAL NOT NULL,               -- Percent difference from the baseline
+    action TEXT NOT NULL,                  -- quarantined or flagged
+    detected_at TIMESTAMP NOT NULL,        -- When the price was fetched (UTC)
+    released_at TIMESTAMP                  -- When a quarantined price was moved into bitcoin_prices (UTC)
+);
+
+CREATE INDEX idx_price_anomalies_detected_at
+ON price_anomalies (detected_at);
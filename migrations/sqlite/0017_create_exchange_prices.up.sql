@@ -0,0 +1,13 @@
+-- Prices quoted by each exchange of EXCHANGES, fetched side by side to track spreads
+-- Every exchange fetched in the same tick shares its timestamp
+CREATE TABLE exchange_prices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    exchange TEXT NOT NULL,                -- Provider the price was fetched from
+    currency TEXT NOT NULL,                -- Fiat currency the price is quoted in
+    price REAL NOT NULL,                   -- Price of one bitcoin on the exchange
+    timestamp TIMESTAMP NOT NULL           -- When the tick was fetched (UTC)
+);
+
+-- One price per exchange and currency per tick; also serves the spread queries
+CREATE UNIQUE INDEX idx_exchange_prices_currency_timestamp
+ON exchange_prices (currency, timestamp, exchange);
@@ -0,0 +1,3 @@
+-- Aggregated prices that met PRICE_QUORUM without every source of PRICE_SOURCES
+ALTER TABLE bitcoin_prices
+ADD COLUMN degraded BOOLEAN NOT NULL DEFAULT 0; -- 1 when some sources were missing from the aggregate
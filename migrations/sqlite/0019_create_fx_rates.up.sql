@@ -0,0 +1,17 @@
+-- Exchange rates from FX_PROVIDER, used to convert prices into FX_CURRENCIES
+CREATE TABLE fx_rates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    base TEXT NOT NULL,                    -- Currency converted from (FX_BASE)
+    quote TEXT NOT NULL,                   -- Currency converted to
+    rate REAL NOT NULL,                    -- Units of quote per unit of base
+    source TEXT NOT NULL,                  -- Provider the rate was fetched from
+    timestamp TIMESTAMP NOT NULL           -- When the rate was fetched (UTC)
+);
+
+-- Serves the latest-rate lookups
+CREATE INDEX idx_fx_rates_base_quote_timestamp
+ON fx_rates (base, quote, timestamp);
+
+-- Rate a converted price was computed with; 0 when it was fetched in its currency
+ALTER TABLE bitcoin_prices
+ADD COLUMN fx_rate REAL NOT NULL DEFAULT 0;
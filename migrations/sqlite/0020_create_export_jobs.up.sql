@@ -0,0 +1,20 @@
+-- Exports and backfills requested through POST /exports, run in the background
+CREATE TABLE export_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    kind TEXT NOT NULL,                    -- prices or backfill
+    format TEXT NOT NULL,                  -- csv or json for prices jobs; empty for backfills
+    currency TEXT NOT NULL,                -- Currency covered; empty for every currency
+    from_time TIMESTAMP,                   -- Start of the range (UTC); NULL from the first record
+    to_time TIMESTAMP NOT NULL,            -- End of the range (UTC), exclusive
+    status TEXT NOT NULL,                  -- queued, running, done, or failed
+    done INTEGER NOT NULL DEFAULT 0,       -- Work done: records written, or days backfilled
+    total INTEGER NOT NULL DEFAULT 0,      -- Work expected in the same unit as done
+    records INTEGER NOT NULL DEFAULT 0,    -- Records written or imported
+    error TEXT NOT NULL DEFAULT '',        -- Why a failed job failed
+    created_at TIMESTAMP NOT NULL,         -- When the job was requested (UTC)
+    updated_at TIMESTAMP NOT NULL,         -- Last progress of a running job (UTC)
+    finished_at TIMESTAMP                  -- When the job was done or failed (UTC)
+);
+
+CREATE INDEX idx_export_jobs_status
+ON export_jobs (status, created_at);
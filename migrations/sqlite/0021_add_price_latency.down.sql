@@ -0,0 +1 @@
+ALTER TABLE bitcoin_prices DROP COLUMN latency;
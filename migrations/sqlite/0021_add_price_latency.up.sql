@@ -0,0 +1,3 @@
+-- Seconds from the provider quoting a price to it being stored; 0 when unknown
+ALTER TABLE bitcoin_prices
+ADD COLUMN latency REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE alert_rules DROP COLUMN basket;
+DROP TABLE IF EXISTS basket_values;
@@ -0,0 +1,17 @@
+-- Index values of the baskets of BASKETS, computed on every fetch as their own series
+CREATE TABLE basket_values (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    basket TEXT NOT NULL,                  -- Basket name from BASKETS
+    currency TEXT NOT NULL,                -- Fiat currency the value is quoted in
+    value REAL NOT NULL,                   -- Combined value of the constituents
+    members TEXT NOT NULL DEFAULT '',      -- Comma-separated CoinGecko IDs of the constituents
+    timestamp TIMESTAMP NOT NULL           -- When the value was computed (UTC)
+);
+
+-- One value per basket and currency per tick; also serves the history queries
+CREATE UNIQUE INDEX idx_basket_values_basket_timestamp
+ON basket_values (basket, currency, timestamp);
+
+-- Basket rules watch a basket's value instead of the Bitcoin price
+ALTER TABLE alert_rules
+ADD COLUMN basket TEXT NOT NULL DEFAULT ''; -- Basket name for basket rules
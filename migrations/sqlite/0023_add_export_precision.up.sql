@@ -0,0 +1,3 @@
+-- Decimal places of a prices job's prices; NULL keeps them as stored
+ALTER TABLE export_jobs
+ADD COLUMN price_precision INTEGER;
@@ -0,0 +1,7 @@
+-- Heartbeat of the scheduler instance running the jobs, watched by warm standbys
+CREATE TABLE scheduler_heartbeats (
+    role TEXT PRIMARY KEY,                 -- Always 'primary'; one row per role
+    instance TEXT NOT NULL,                -- INSTANCE_NAME of the instance that last beat
+    interval_seconds INTEGER NOT NULL,     -- HEARTBEAT_INTERVAL of that instance
+    beat_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP -- When it last beat (UTC, database clock)
+);
@@ -0,0 +1,31 @@
+-- Outgoing webhooks sent a signed JSON payload with new prices
+CREATE TABLE webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    url TEXT NOT NULL,                     -- Where payloads are POSTed
+    secret TEXT NOT NULL,                  -- HMAC-SHA256 key of the payload signatures
+    currency TEXT NOT NULL DEFAULT '',     -- Currency sent; empty for every currency
+    threshold REAL NOT NULL DEFAULT 0,     -- Percent change since the last payload that sends one; 0 = every sample
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- When the webhook was added (UTC)
+);
+
+-- Every payload queued for a webhook, with the outcome of its attempts
+CREATE TABLE webhooks_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    currency TEXT NOT NULL,                -- Currency of the price sent
+    price REAL NOT NULL,                   -- Price sent, the baseline of the webhook's threshold
+    payload TEXT NOT NULL,                 -- JSON body, signed when sent
+    status TEXT NOT NULL,                  -- pending, delivered, or failed
+    attempts INTEGER NOT NULL DEFAULT 0,   -- Attempts made so far
+    response_status INTEGER NOT NULL DEFAULT 0, -- HTTP status of the last attempt; 0 when none answered
+    error TEXT NOT NULL DEFAULT '',        -- Why the last attempt failed
+    created_at TIMESTAMP NOT NULL,         -- When the payload was queued (UTC)
+    next_attempt_at TIMESTAMP NOT NULL,    -- When a pending payload is tried next (UTC)
+    delivered_at TIMESTAMP                 -- When it was accepted (UTC)
+);
+
+CREATE INDEX idx_webhooks_deliveries_due
+ON webhooks_deliveries (status, next_attempt_at);
+
+CREATE INDEX idx_webhooks_deliveries_webhook
+ON webhooks_deliveries (webhook_id, currency, id);
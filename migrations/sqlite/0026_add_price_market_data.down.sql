@@ -0,0 +1,2 @@
+ALTER TABLE bitcoin_prices DROP COLUMN market_cap;
+ALTER TABLE bitcoin_prices DROP COLUMN volume_24h;
@@ -0,0 +1,6 @@
+-- CoinGecko's 24h trading volume and market cap in the price's currency, captured with
+-- MARKET_DATA; 0 when not captured
+ALTER TABLE bitcoin_prices
+ADD COLUMN volume_24h REAL NOT NULL DEFAULT 0;
+ALTER TABLE bitcoin_prices
+ADD COLUMN market_cap REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- Daily Crypto Fear & Greed index readings, collected with FEAR_GREED
+CREATE TABLE fear_greed (
+    day TIMESTAMP PRIMARY KEY,             -- UTC midnight of the day the reading is for
+    value INTEGER NOT NULL,                -- Index value, 0 (extreme fear) to 100 (extreme greed)
+    classification TEXT NOT NULL,          -- Label of the value, e.g. "Extreme Fear"
+    fetched_at TIMESTAMP NOT NULL          -- When the reading was fetched (UTC)
+);
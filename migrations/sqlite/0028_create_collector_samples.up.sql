@@ -0,0 +1,13 @@
+-- Values recorded by the collectors of COLLECTORS, e.g. the on-chain hashrate
+CREATE TABLE collector_samples (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    collector TEXT NOT NULL,               -- Collector that recorded the value, e.g. "onchain"
+    metric TEXT NOT NULL,                  -- What was measured, e.g. "hashrate"
+    value REAL NOT NULL,                   -- Measured value, in the metric's unit
+    source TEXT NOT NULL,                  -- Provider the value was fetched from
+    timestamp TIMESTAMP NOT NULL           -- When the value was collected (UTC)
+);
+
+-- Serves the per-metric range and latest-value lookups
+CREATE INDEX idx_collector_samples_metric_timestamp
+ON collector_samples (metric, timestamp);
@@ -0,0 +1,16 @@
+-- Trades are buys and sells of an asset, matched first in, first out or last in,
+-- first out by "tax --source trades" for capital gains reports
+CREATE TABLE trades (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    side TEXT NOT NULL,                    -- buy or sell
+    asset TEXT NOT NULL,                   -- Asset ID, e.g. bitcoin or ethereum
+    quantity REAL NOT NULL,                -- Units bought or sold
+    amount REAL NOT NULL DEFAULT 0,        -- Total paid or received (0 = value at the stored price)
+    fee REAL NOT NULL DEFAULT 0,           -- Fee paid, in the trade's currency
+    currency TEXT NOT NULL,                -- Fiat currency of amount and fee
+    traded_at TIMESTAMP NOT NULL,          -- When the trade was made (UTC)
+    note TEXT NOT NULL DEFAULT '',         -- Free text, e.g. the exchange or an order ID
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- When the trade was registered (UTC)
+);
+
+CREATE INDEX idx_trades_traded_at ON trades(traded_at);
@@ -0,0 +1,15 @@
+-- Events waiting to be delivered to a sink; with EVENT_OUTBOX each event is stored
+-- here once per sink before it is sent, and removed once the sink accepted it
+CREATE TABLE event_outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key; sinks get events in this order
+    sink TEXT NOT NULL,                    -- Name of the sink, e.g. "kafka bitcoin-tracker"
+    event_id TEXT NOT NULL,                -- ID of the event
+    event_type TEXT NOT NULL,              -- Type of the event, e.g. price.recorded
+    payload TEXT NOT NULL,                 -- The event as JSON
+    attempts INTEGER NOT NULL DEFAULT 0,   -- Failed attempts so far
+    error TEXT NOT NULL DEFAULT '',        -- Why the last attempt failed
+    created_at TIMESTAMP NOT NULL,         -- When the event was stored (UTC)
+    next_attempt_at TIMESTAMP NOT NULL     -- When the event is tried next (UTC)
+);
+
+CREATE INDEX idx_event_outbox_sink ON event_outbox (sink, id);
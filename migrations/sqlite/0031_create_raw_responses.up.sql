@@ -0,0 +1,14 @@
+-- Provider responses of price fetches as they were received, gzip-compressed; with
+-- RAW_RESPONSES they are kept for RAW_RESPONSE_RETENTION so fields that weren't parsed
+-- at the time can be extracted later
+CREATE TABLE raw_responses (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    provider TEXT NOT NULL,                -- Provider that answered, e.g. coingecko
+    asset TEXT NOT NULL,                   -- Asset the request was for, e.g. bitcoin
+    url TEXT NOT NULL,                     -- Requested URL
+    size INTEGER NOT NULL,                 -- Size of the body before compression, in bytes
+    body BLOB NOT NULL,                    -- Response body, gzip-compressed
+    fetched_at TIMESTAMP NOT NULL          -- When the response was received (UTC)
+);
+
+CREATE INDEX idx_raw_responses_fetched_at ON raw_responses (fetched_at);
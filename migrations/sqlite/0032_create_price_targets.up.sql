@@ -0,0 +1,12 @@
+-- One-shot price targets: each notifies once, when the price first crosses it, and
+-- stays fired until re-armed
+CREATE TABLE price_targets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    currency TEXT NOT NULL,                -- Fiat currency of the target price
+    price REAL NOT NULL,                   -- Target price of one bitcoin
+    direction TEXT NOT NULL,               -- above or below: the side the price crosses to
+    note TEXT NOT NULL DEFAULT '',         -- Why the target was set, repeated in the notification
+    created_at TIMESTAMP NOT NULL,         -- When the target was set (UTC)
+    fired_at TIMESTAMP,                    -- When the price crossed it (UTC); NULL while pending
+    fired_price REAL                       -- Price that crossed it
+);
@@ -0,0 +1,11 @@
+-- All-time high and low of every coin and currency, seeded from the stored prices and
+-- moved by every fetch that passes them
+CREATE TABLE price_extremes (
+    coin TEXT NOT NULL,                    -- Coin the extremes are of, e.g. bitcoin
+    currency TEXT NOT NULL,                -- Fiat currency the prices are quoted in
+    ath REAL NOT NULL,                     -- All-time high
+    ath_at TIMESTAMP NOT NULL,             -- When the all-time high was stored (UTC)
+    atl REAL NOT NULL,                     -- All-time low
+    atl_at TIMESTAMP NOT NULL,             -- When the all-time low was stored (UTC)
+    PRIMARY KEY (coin, currency)
+);
@@ -0,0 +1,13 @@
+-- One row per currency and UTC day summarizing its prices, refreshed by the
+-- scheduler's daily_summaries job so long-range statistics needn't scan raw prices
+CREATE TABLE daily_summaries (
+    currency TEXT NOT NULL,                -- Fiat currency the prices are quoted in
+    day TIMESTAMP NOT NULL,                -- UTC midnight of the day summarized
+    open REAL NOT NULL,                    -- First price of the day
+    high REAL NOT NULL,                    -- Highest price of the day
+    low REAL NOT NULL,                     -- Lowest price of the day
+    close REAL NOT NULL,                   -- Last price of the day
+    avg REAL NOT NULL,                     -- Mean of the day's prices
+    sample_count INTEGER NOT NULL,         -- Number of prices summarized
+    PRIMARY KEY (currency, day)
+);
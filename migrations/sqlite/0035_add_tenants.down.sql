@@ -0,0 +1,5 @@
+ALTER TABLE api_keys DROP COLUMN tenant;
+ALTER TABLE portfolio_snapshots DROP COLUMN tenant;
+ALTER TABLE disposals DROP COLUMN tenant;
+ALTER TABLE holdings DROP COLUMN tenant;
+ALTER TABLE alert_rules DROP COLUMN tenant;
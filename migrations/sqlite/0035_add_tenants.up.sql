@@ -0,0 +1,7 @@
+-- Namespace each user's alert rules, holdings, sales, portfolio snapshots, and API
+-- keys belong to on a shared deployment; existing rows go to the default tenant
+ALTER TABLE alert_rules ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE holdings ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE disposals ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE portfolio_snapshots ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
@@ -0,0 +1,18 @@
+-- Audit trail of deletions, amendments, and restorations of stored prices
+-- A deleted price is moved out of bitcoin_prices; record keeps it for a restore
+CREATE TABLE price_corrections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    price_id INTEGER NOT NULL,             -- ID of the corrected price in bitcoin_prices
+    action TEXT NOT NULL,                  -- delete, amend, or restore
+    currency TEXT NOT NULL,                -- Fiat currency the price is quoted in
+    timestamp TIMESTAMP NOT NULL,          -- When the corrected price was recorded (UTC)
+    old_price REAL NOT NULL,               -- Price before the correction
+    new_price REAL,                        -- Price after an amendment or restore; NULL for a deletion
+    reason TEXT NOT NULL DEFAULT '',       -- Why the price was corrected
+    actor TEXT NOT NULL,                   -- Who corrected it, e.g. apikey:grafana or cli:alice
+    record TEXT NOT NULL,                  -- The price record before the correction, as JSON
+    created_at TIMESTAMP NOT NULL          -- When the correction was made (UTC)
+);
+
+CREATE INDEX idx_price_corrections_price_id
+ON price_corrections (price_id);
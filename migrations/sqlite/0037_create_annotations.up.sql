@@ -0,0 +1,13 @@
+-- Labels attached to points in time, e.g. "halving" or "I bought here", shown on charts
+-- and Grafana panels and carried into exports
+CREATE TABLE annotations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,  -- Auto-incrementing primary key
+    time TIMESTAMP NOT NULL,               -- Point in time the annotation marks (UTC)
+    text TEXT NOT NULL,                    -- What happened, e.g. "ETF approval"
+    tags TEXT NOT NULL DEFAULT '',         -- Comma-separated tags for filtering, e.g. "halving,event"
+    created_at TIMESTAMP NOT NULL          -- When the annotation was added (UTC)
+);
+
+-- Serves the range lookups of charts, Grafana, and exports
+CREATE INDEX idx_annotations_time
+ON annotations (time);
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"   // Package for fetch cancellation
+	"fmt"       // Package for formatted I/O operations
+	"math/rand" // Package for simulated price moves
+	"net/http"  // Package for the status of simulated failures
+	"os"        // Package for environment variables
+	"strconv"   // Package for parsing numeric settings
+	"strings"   // Package for string manipulation
+	"sync"      // Package for guarding the mock provider's state
+	"time"      // Package for fetch times
+
+	"bitcoin-tracker/tracker" // Source interface and provider errors
+)
+
+// How the mock provider moves its price
+const (
+	mockWalkMode  = "walk"  // A random walk from the newest stored price, as far as the clock allows
+	mockStepsMode = "steps" // One step per fetch from MOCK_START_PRICE, ignoring the clock and the store
+	mockFixedMode = "fixed" // Always MOCK_START_PRICE
+)
+
+// MockConfig shapes the prices the mock provider returns
+type MockConfig struct {
+	Mode       string
+	Seed       int64 // Zero seeds walk mode from the clock
+	Volatility float64
+	StartPrice float64 // USD; other currencies follow at demoRates
+	FailRate   float64 // Share of fetches that fail as a 503 would
+}
+
+// mockConfig is the active mock provider configuration
+var mockConfig = MockConfig{Mode: mockWalkMode, Volatility: demoDailyVol, StartPrice: demoStartPrice}
+
+// loadMockConfig reads MOCK_MODE, MOCK_SEED, MOCK_VOLATILITY, MOCK_START_PRICE, and
+// MOCK_FAIL_RATE. Steps mode without a seed uses the demo seed, so it always repeats.
+func loadMockConfig() (MockConfig, error) {
+	c := MockConfig{Mode: mockWalkMode, Volatility: demoDailyVol, StartPrice: demoStartPrice}
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("MOCK_MODE"))); mode {
+	case "", mockWalkMode:
+	case mockStepsMode, mockFixedMode:
+		c.Mode = mode
+	default:
+		return c, fmt.Errorf("invalid MOCK_MODE %q (expected walk, steps, or fixed)", mode)
+	}
+
+	if v := strings.TrimSpace(os.Getenv("MOCK_SEED")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n == 0 {
+			return c, fmt.Errorf("invalid MOCK_SEED %q (expected a non-zero integer)", v)
+		}
+		c.Seed = n
+	} else if c.Mode == mockStepsMode {
+		c.Seed = demoSeed
+	}
+	if v := strings.TrimSpace(os.Getenv("MOCK_VOLATILITY")); v != "" {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if strings.HasSuffix(v, "%") {
+			f /= 100
+		}
+		if err != nil || f < 0 || f > 1 {
+			return c, fmt.Errorf("invalid MOCK_VOLATILITY %q (expected a daily standard deviation such as 0.03 or 3%%)", v)
+		}
+		c.Volatility = f
+	}
+	if v := strings.TrimSpace(os.Getenv("MOCK_START_PRICE")); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return c, fmt.Errorf("invalid MOCK_START_PRICE %q (expected a positive USD price)", v)
+		}
+		c.StartPrice = f
+	}
+	if v := strings.TrimSpace(os.Getenv("MOCK_FAIL_RATE")); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return c, fmt.Errorf("invalid MOCK_FAIL_RATE %q (expected a share between 0 and 1)", v)
+		}
+		c.FailRate = f
+	}
+	return c, nil
+}
+
+// mockSource simulates a provider without network calls or an API key. It backs --demo,
+// and with MOCK_SEED lets CI drive the scheduler, alerts, and candles repeatably.
+type mockSource struct{}
+
+// mockState is the mock provider's price walk, shared by every fetch
+var mockState = struct {
+	mu     sync.Mutex
+	walk   demoWalk
+	prices map[string]float64   // Last price returned per currency
+	at     map[string]time.Time // When it was returned
+}{
+	prices: make(map[string]float64),
+	at:     make(map[string]time.Time),
+}
+
+// mockWalk returns the shared walk, seeding it from mockConfig on first use
+// The caller holds mockState.mu.
+func mockWalk() demoWalk {
+	if mockState.walk.rng == nil {
+		seed := mockConfig.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		mockState.walk = demoWalk{rng: rand.New(rand.NewSource(seed)), vol: mockConfig.Volatility}
+	}
+	return mockState.walk
+}
+
+// Name returns the config name of the source
+func (mockSource) Name() string { return "mock" }
+
+// FetchPrices implements tracker.Source
+// The walk starts from the newest stored price when the fetch has a database.
+func (mockSource) FetchPrices(ctx context.Context, f tracker.Fetcher, asset string, currencies []string) (map[string]float64, error) {
+	var repo *Repository
+	if pf, ok := f.(providerFetcher); ok {
+		repo = pf.repo
+	}
+	if asset != "bitcoin" {
+		return nil, fmt.Errorf("the mock provider only quotes bitcoin")
+	}
+	mockState.mu.Lock()
+	defer mockState.mu.Unlock()
+
+	walk := mockWalk()
+	if mockConfig.FailRate > 0 && walk.rng.Float64() < mockConfig.FailRate {
+		return nil, &tracker.StatusError{StatusCode: http.StatusServiceUnavailable}
+	}
+
+	now := time.Now()
+	prices := make(map[string]float64, len(currencies))
+	for _, currency := range currencies {
+		start := mockConfig.StartPrice * demoRate(currency)
+		last, ok := mockState.prices[currency]
+		var price float64
+		switch mockConfig.Mode {
+		case mockFixedMode:
+			price = start
+		case mockStepsMode:
+			if !ok {
+				last = start
+			}
+			price = last * walk.step(fetchInterval)
+		default:
+			since := now.Sub(mockState.at[currency])
+			if !ok {
+				last, since = start, time.Minute
+				if repo != nil {
+					if latest, err := repo.LatestPrices(ctx, 1, currency); err == nil && len(latest) > 0 {
+						last, since = latest[0].Price, now.Sub(latest[0].Timestamp)
+					}
+				}
+			}
+			since = min(max(since, time.Second), 24*time.Hour)
+			price = last * walk.step(since)
+		}
+		prices[currency] = roundPriceIn(currency, price)
+		mockState.prices[currency], mockState.at[currency] = prices[currency], now
+	}
+	return prices, nil
+}
+
+// Capabilities implements PriceSource
+// Nothing is probed: the mock quotes bitcoin in every configured currency
+func (s mockSource) Capabilities(_ context.Context, _ *Repository) ProviderCapabilities {
+	live := "simulated random walk from the newest stored price"
+	switch mockConfig.Mode {
+	case mockStepsMode:
+		live = fmt.Sprintf("simulated random walk, one step per fetch (seed %d)", mockConfig.Seed)
+	case mockFixedMode:
+		live = fmt.Sprintf("fixed simulated price of %s USD", strconv.FormatFloat(mockConfig.StartPrice, 'f', -1, 64))
+	}
+	c := ProviderCapabilities{
+		Provider:    s.Name(),
+		Live:        live,
+		History:     "a simulated year, seeded by --demo",
+		HistoryFrom: "a year before the demo database was created",
+	}
+	return finishCapabilities(c, map[string][]string{"bitcoin": currencies}, nil)
+}
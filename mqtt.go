@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"         // Package for reading broker packets
+	"crypto/rand"   // Package for generating client IDs
+	"crypto/tls"    // Package for mqtts:// connections
+	"encoding/hex"  // Package for encoding client IDs
+	"encoding/json" // Package for structured CloudEvents
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for reading packet bodies
+	"net"           // Package for broker connections
+	"net/url"       // Package for parsing MQTT_URL
+	"os"            // Package for environment variables
+	"strconv"       // Package for parsing MQTT_QOS
+	"strings"       // Package for string manipulation
+	"sync"          // Package for guarding the connection
+	"time"          // Package for network timeouts
+)
+
+// mqttTimeout bounds connecting and waiting for the broker's acknowledgements
+const mqttTimeout = 10 * time.Second
+
+// MQTT 3.1.1 control packet types (the high nibble of the first byte)
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttPuback     = 0x40
+	mqttDisconnect = 0xE0
+)
+
+// mqttSink publishes events to an MQTT broker
+// It speaks just enough MQTT 3.1.1 to publish: one connection is kept open and
+// re-established when a publish fails. Topics are "<prefix>/<type>/<subject>",
+// e.g. "bitcoin-tracker/price.recorded/bitcoin/usd". With MQTT_PRICE_TOPIC, every
+// price is also published on its own as a bare value for devices that can't unwrap
+// an event envelope, and with MQTT_DISCOVERY_PREFIX announced to Home Assistant.
+type mqttSink struct {
+	broker         *url.URL // mqtt://[user:pass@]host[:1883] or mqtts://...:8883
+	prefix         string   // Topic prefix from MQTT_TOPIC
+	qos            byte     // 0 (at most once) or 1 (at least once)
+	retain         bool     // Retain price.recorded messages so new subscribers get the latest price
+	clientID       string
+	priceTopic     string // Topic of bare prices, may contain {currency}; empty for none
+	priceFormat    string // PriceFilePlain or PriceFileJSON
+	pricePrecision int    // Decimal places of plain prices
+	discovery      string // Home Assistant discovery prefix; empty to not announce sensors
+
+	mu        sync.Mutex
+	conn      net.Conn
+	reader    *bufio.Reader
+	packetID  uint16
+	announced map[string]bool // Subjects whose discovery config was sent on this connection
+}
+
+// Name identifies the sink in logs
+func (s *mqttSink) Name() string { return "mqtt " + s.broker.Host }
+
+// Publish implements EventSink
+func (s *mqttSink) Publish(e Event) error {
+	// MQTT 3.1.1 has no message headers, so binary mode falls back to structured mode
+	payload, _, _, err := encodeEvent(e)
+	if err != nil {
+		return err
+	}
+	if eventFormat == EventFormatCloudBinary {
+		if payload, err = json.Marshal(toCloudEvent(e)); err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+	}
+	topic := s.prefix + "/" + e.Type + "/" + e.Subject
+	retain := s.retain && e.Type == EventPriceRecorded
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.send(topic, payload, retain); err != nil {
+		return err
+	}
+	if data, ok := e.Data.(PriceEventData); ok && e.Type == EventPriceRecorded && s.priceTopic != "" {
+		return s.publishPrice(data)
+	}
+	return nil
+}
+
+// send publishes one message; the caller holds s.mu
+// A connection the broker closed while idle only shows up on the next write,
+// so a failed publish is retried once on a fresh connection.
+func (s *mqttSink) send(topic string, payload []byte, retain bool) error {
+	for attempt := 0; ; attempt++ {
+		err := s.publish(topic, payload, retain)
+		if err == nil {
+			return nil
+		}
+		s.close()
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+// publishPrice publishes a price to MQTT_PRICE_TOPIC, announcing its sensor to Home
+// Assistant first when discovery is on. Without {currency} in the topic, only the
+// first configured currency is published, so the topic always holds one price.
+func (s *mqttSink) publishPrice(data PriceEventData) error {
+	topic := s.priceTopic
+	if strings.Contains(topic, priceFileCurrencyPlaceholder) {
+		topic = strings.ReplaceAll(topic, priceFileCurrencyPlaceholder, data.Currency)
+	} else if data.Currency != currencies[0] {
+		return nil
+	}
+
+	var payload []byte
+	if s.priceFormat == PriceFilePlain {
+		payload = []byte(formatDecimal(data.Price, s.pricePrecision))
+	} else {
+		var err error
+		if payload, err = json.Marshal(data); err != nil {
+			return fmt.Errorf("failed to encode price: %w", err)
+		}
+	}
+
+	if s.discovery != "" {
+		if err := s.announce(topic, data); err != nil {
+			return err
+		}
+	}
+	return s.send(topic, payload, s.retain)
+}
+
+// haSensorConfig is a Home Assistant MQTT discovery config of a price sensor
+type haSensorConfig struct {
+	Name              string         `json:"name"`
+	UniqueID          string         `json:"unique_id"`
+	StateTopic        string         `json:"state_topic"`
+	ValueTemplate     string         `json:"value_template,omitempty"`
+	UnitOfMeasurement string         `json:"unit_of_measurement"`
+	StateClass        string         `json:"state_class"`
+	Icon              string         `json:"icon"`
+	Device            haSensorDevice `json:"device"`
+}
+
+// haSensorDevice groups the tracker's sensors into one device in Home Assistant
+type haSensorDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// announce sends the retained discovery config of a price's sensor once per connection,
+// so Home Assistant creates e.g. sensor.bitcoin_usd_price reading the price topic
+func (s *mqttSink) announce(topic string, data PriceEventData) error {
+	id := "bitcoin_tracker_" + data.Asset + "_" + data.Currency
+	if s.announced[id] {
+		return nil
+	}
+	config := haSensorConfig{
+		Name:              strings.ToUpper(data.Currency) + " price",
+		UniqueID:          id,
+		StateTopic:        topic,
+		UnitOfMeasurement: strings.ToUpper(data.Currency),
+		StateClass:        "measurement",
+		Icon:              "mdi:bitcoin",
+		Device: haSensorDevice{
+			Identifiers:  []string{"bitcoin_tracker_" + data.Asset},
+			Name:         strings.ToUpper(data.Asset[:1]) + data.Asset[1:],
+			Manufacturer: "Bitcoin Price Tracker",
+		},
+	}
+	if s.priceFormat == PriceFileJSON {
+		config.ValueTemplate = "{{ value_json.price }}"
+	}
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode discovery config: %w", err)
+	}
+	if err := s.send(s.discovery+"/sensor/"+id+"/config", payload, true); err != nil {
+		return err
+	}
+	if s.announced == nil {
+		s.announced = make(map[string]bool)
+	}
+	s.announced[id] = true
+	return nil
+}
+
+// publish sends one PUBLISH packet, connecting first if needed, and waits for the PUBACK at QoS 1
+func (s *mqttSink) publish(topic string, payload []byte, retain bool) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	flags := byte(mqttPublish) | s.qos<<1
+	if retain {
+		flags |= 0x01
+	}
+	body := mqttString(topic)
+	if s.qos > 0 {
+		s.packetID++
+		if s.packetID == 0 {
+			s.packetID = 1 // Packet ID 0 is not allowed
+		}
+		body = append(body, byte(s.packetID>>8), byte(s.packetID))
+	}
+	body = append(body, payload...)
+
+	s.conn.SetDeadline(time.Now().Add(mqttTimeout))
+	if _, err := s.conn.Write(mqttPacket(flags, body)); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	if s.qos == 0 {
+		return nil
+	}
+
+	kind, ack, err := s.readPacket()
+	if err != nil {
+		return fmt.Errorf("failed to read PUBACK: %w", err)
+	}
+	if kind != mqttPuback || len(ack) != 2 || uint16(ack[0])<<8|uint16(ack[1]) != s.packetID {
+		return fmt.Errorf("unexpected reply to PUBLISH: packet type 0x%02X", kind)
+	}
+	return nil
+}
+
+// connect opens the connection and performs the CONNECT/CONNACK handshake
+func (s *mqttSink) connect() error {
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	var err error
+	if s.broker.Scheme == "mqtts" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.broker.Host, &tls.Config{ServerName: s.broker.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", s.broker.Host)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+
+	// Clean session, no keep-alive: the connection only exists to publish
+	flags := byte(0x02)
+	payload := mqttString(s.clientID)
+	if user := s.broker.User; user != nil {
+		flags |= 0x80
+		payload = append(payload, mqttString(user.Username())...)
+		if password, ok := user.Password(); ok {
+			flags |= 0x40
+			payload = append(payload, mqttString(password)...)
+		}
+	}
+	body := append(mqttString("MQTT"), 4, flags, 0, 0) // Protocol level 4 is MQTT 3.1.1
+	body = append(body, payload...)
+
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+	if _, err := conn.Write(mqttPacket(mqttConnect, body)); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+
+	kind, ack, err := s.readPacket()
+	if err != nil {
+		s.close()
+		return fmt.Errorf("failed to read CONNACK: %w", err)
+	}
+	if kind != mqttConnack || len(ack) != 2 {
+		s.close()
+		return fmt.Errorf("unexpected reply to CONNECT: packet type 0x%02X", kind)
+	}
+	if code := ack[1]; code != 0 {
+		s.close()
+		return fmt.Errorf("MQTT broker refused the connection: %s", mqttConnackReason(code))
+	}
+	return nil
+}
+
+// close drops the current connection, telling the broker when possible
+func (s *mqttSink) close() {
+	if s.conn == nil {
+		return
+	}
+	s.conn.Write([]byte{mqttDisconnect, 0})
+	s.conn.Close()
+	s.conn, s.reader = nil, nil
+	s.announced = nil // A restarted broker may have lost the retained configs
+}
+
+// readPacket reads one packet and returns its type and body
+func (s *mqttSink) readPacket() (byte, []byte, error) {
+	header, err := s.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// The remaining length is a base-128 varint of up to four bytes
+	length, shift := 0, 0
+	for {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, fmt.Errorf("malformed packet length")
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xF0, body, nil
+}
+
+// mqttPacket prefixes a packet body with its fixed header
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// mqttString encodes a length-prefixed UTF-8 string
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+// mqttConnackReason describes a CONNACK return code
+func mqttConnackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("return code %d", code)
+}
+
+// loadMQTTSink builds the MQTT sink from MQTT_URL, MQTT_TOPIC, MQTT_QOS, MQTT_RETAIN,
+// MQTT_CLIENT_ID, MQTT_PRICE_TOPIC, MQTT_PRICE_FORMAT, MQTT_PRICE_PRECISION, and
+// MQTT_DISCOVERY_PREFIX. It returns nil when no broker is configured
+func loadMQTTSink() (EventSink, error) {
+	v := os.Getenv("MQTT_URL")
+	if v == "" {
+		return nil, nil
+	}
+
+	broker, err := url.Parse(v)
+	if err != nil || broker.Host == "" {
+		return nil, fmt.Errorf("invalid MQTT_URL %q", v)
+	}
+	switch broker.Scheme {
+	case "mqtt", "tcp":
+		if broker.Port() == "" {
+			broker.Host += ":1883"
+		}
+	case "mqtts", "ssl":
+		broker.Scheme = "mqtts"
+		if broker.Port() == "" {
+			broker.Host += ":8883"
+		}
+	default:
+		return nil, fmt.Errorf("invalid MQTT_URL %q: scheme must be mqtt or mqtts", v)
+	}
+
+	sink := &mqttSink{broker: broker, prefix: "bitcoin-tracker", retain: true, priceFormat: PriceFilePlain}
+	if topic := strings.Trim(os.Getenv("MQTT_TOPIC"), "/"); topic != "" {
+		if strings.ContainsAny(topic, "+#") {
+			return nil, fmt.Errorf("invalid MQTT_TOPIC %q: wildcards are not allowed", topic)
+		}
+		sink.prefix = topic
+	}
+	if v := os.Getenv("MQTT_QOS"); v != "" {
+		qos, err := strconv.Atoi(v)
+		if err != nil || qos < 0 || qos > 1 {
+			return nil, fmt.Errorf("invalid MQTT_QOS %q: must be 0 or 1", v)
+		}
+		sink.qos = byte(qos)
+	}
+	if v := os.Getenv("MQTT_RETAIN"); v != "" {
+		retain, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MQTT_RETAIN %q", v)
+		}
+		sink.retain = retain
+	}
+
+	sink.discovery = strings.Trim(os.Getenv("MQTT_DISCOVERY_PREFIX"), "/")
+	sink.priceTopic = strings.Trim(os.Getenv("MQTT_PRICE_TOPIC"), "/")
+	if sink.priceTopic == "" && sink.discovery != "" {
+		sink.priceTopic = sink.prefix + "/price/" + priceFileCurrencyPlaceholder // Discovered sensors need a topic to read
+	}
+	if strings.ContainsAny(sink.priceTopic+sink.discovery, "+#") {
+		return nil, fmt.Errorf("invalid MQTT_PRICE_TOPIC or MQTT_DISCOVERY_PREFIX: wildcards are not allowed")
+	}
+	switch format := strings.ToLower(os.Getenv("MQTT_PRICE_FORMAT")); format {
+	case "":
+	case PriceFileJSON, PriceFilePlain:
+		sink.priceFormat = format
+	default:
+		return nil, fmt.Errorf("invalid MQTT_PRICE_FORMAT %q (expected plain or json)", format)
+	}
+	if sink.pricePrecision, err = parsePrecision("MQTT_PRICE_PRECISION", os.Getenv("MQTT_PRICE_PRECISION")); err != nil {
+		return nil, err
+	}
+
+	sink.clientID = os.Getenv("MQTT_CLIENT_ID")
+	if sink.clientID == "" {
+		// Brokers disconnect an older session when a client ID is reused
+		id := make([]byte, 4)
+		rand.Read(id)
+		sink.clientID = "bitcoin-tracker-" + hex.EncodeToString(id)
+	}
+	return sink, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"         // Package for reading server messages
+	"crypto/tls"    // Package for TLS connections
+	"encoding/json" // Package for INFO/CONNECT and structured CloudEvents
+	"fmt"           // Package for formatted I/O operations
+	"net"           // Package for server connections
+	"net/url"       // Package for parsing NATS_URL
+	"os"            // Package for environment variables
+	"sort"          // Package for ordering message headers
+	"strings"       // Package for string manipulation
+	"sync"          // Package for guarding the connection
+	"time"          // Package for network timeouts
+)
+
+// natsTimeout bounds connecting and waiting for the server to confirm a publish
+const natsTimeout = 10 * time.Second
+
+// natsSink publishes events to a NATS server (core NATS; a JetStream stream that
+// captures the subjects makes them durable). It speaks just enough of the text
+// protocol to publish: one connection is kept open and re-established when a publish
+// fails, and every publish is followed by a PING so a refused one is reported rather
+// than lost. Subjects are "<prefix>.<type>.<subject>", e.g.
+// "bitcoin-tracker.price.recorded.bitcoin.usd".
+type natsSink struct {
+	server *url.URL // nats://[user:pass@|token@]host[:4222] or tls://...
+	prefix string   // Subject prefix from NATS_SUBJECT
+
+	mu         sync.Mutex
+	conn       net.Conn
+	reader     *bufio.Reader
+	headers    bool // The server accepts HPUB, so binary CloudEvents keep their attributes in headers
+	maxPayload int  // Largest message the server accepts
+}
+
+// natsInfo is the part of the server's INFO message the sink uses
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+	Headers     bool `json:"headers"`
+	MaxPayload  int  `json:"max_payload"`
+}
+
+// Name identifies the sink in logs
+func (s *natsSink) Name() string { return "nats " + s.server.Host }
+
+// Publish implements EventSink
+func (s *natsSink) Publish(e Event) error {
+	subject := s.prefix + "." + e.Type + "." + strings.ReplaceAll(e.Subject, "/", ".")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A connection the server closed while idle only shows up on the next write,
+	// so a failed publish is retried once on a fresh connection
+	for attempt := 0; ; attempt++ {
+		err := s.publish(subject, e)
+		if err == nil {
+			return nil
+		}
+		s.close()
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+// publish sends one message and waits for the server to confirm it; the caller holds s.mu
+func (s *natsSink) publish(subject string, e Event) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	payload, contentType, attrs, err := encodeEvent(e)
+	if err != nil {
+		return err
+	}
+	if attrs != nil && !s.headers {
+		// A server without headers gets binary mode as structured mode
+		if payload, err = json.Marshal(toCloudEvent(e)); err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		attrs = nil
+	}
+	if s.maxPayload > 0 && len(payload) > s.maxPayload {
+		return fmt.Errorf("event of %d bytes exceeds the server's max_payload of %d", len(payload), s.maxPayload)
+	}
+
+	var msg []byte
+	if attrs != nil {
+		// In CloudEvents binary mode the context attributes travel as ce-* headers
+		names := make([]string, 0, len(attrs))
+		for k := range attrs {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		header := "NATS/1.0\r\nContent-Type: " + contentType + "\r\n"
+		for _, k := range names {
+			header += "ce-" + k + ": " + attrs[k] + "\r\n"
+		}
+		header += "\r\n"
+		msg = fmt.Appendf(nil, "HPUB %s %d %d\r\n%s", subject, len(header), len(header)+len(payload), header)
+	} else {
+		msg = fmt.Appendf(nil, "PUB %s %d\r\n", subject, len(payload))
+	}
+	msg = append(append(msg, payload...), "\r\nPING\r\n"...)
+
+	s.conn.SetDeadline(time.Now().Add(natsTimeout))
+	if _, err := s.conn.Write(msg); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", subject, err)
+	}
+	if err := s.awaitPong(); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", subject, err)
+	}
+	return nil
+}
+
+// connect opens the connection, upgrading it to TLS when asked to, and authenticates
+func (s *natsSink) connect() error {
+	conn, err := net.DialTimeout("tcp", s.server.Host, natsTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+
+	// The server opens with INFO, before any TLS handshake
+	line, err := s.readLine()
+	if err != nil {
+		s.close()
+		return fmt.Errorf("failed to read INFO: %w", err)
+	}
+	var info natsInfo
+	raw, ok := strings.CutPrefix(line, "INFO ")
+	if !ok || json.Unmarshal([]byte(raw), &info) != nil {
+		s.close()
+		return fmt.Errorf("unexpected greeting from NATS server: %q", line)
+	}
+	if s.server.Scheme == "tls" || info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: s.server.Hostname()})
+		if err := tlsConn.Handshake(); err != nil {
+			s.close()
+			return fmt.Errorf("failed to connect to NATS server: %w", err)
+		}
+		s.conn, s.reader = tlsConn, bufio.NewReader(tlsConn)
+	}
+	s.headers, s.maxPayload = info.Headers, info.MaxPayload
+
+	options := map[string]interface{}{
+		"verbose": false, "pedantic": false, "tls_required": s.server.Scheme == "tls",
+		"name": "bitcoin-tracker", "lang": "go", "version": "1", "protocol": 1, "headers": info.Headers,
+	}
+	if user := s.server.User; user != nil {
+		if password, ok := user.Password(); ok {
+			options["user"], options["pass"] = user.Username(), password
+		} else {
+			options["auth_token"] = user.Username()
+		}
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		s.close()
+		return fmt.Errorf("failed to encode CONNECT: %w", err)
+	}
+	if _, err := s.conn.Write(fmt.Appendf(nil, "CONNECT %s\r\nPING\r\n", connect)); err != nil {
+		s.close()
+		return fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+	if err := s.awaitPong(); err != nil {
+		s.close()
+		return fmt.Errorf("NATS server refused the connection: %w", err)
+	}
+	return nil
+}
+
+// awaitPong reads until the PONG answering the client's PING, answering the server's
+// own PINGs and failing on an -ERR
+func (s *natsSink) awaitPong() error {
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("%s", strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+		// +OK and updated INFO messages need no answer
+	}
+}
+
+// readLine reads one protocol line without its CRLF
+func (s *natsSink) readLine() (string, error) {
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// close drops the current connection
+func (s *natsSink) close() {
+	if s.conn == nil {
+		return
+	}
+	s.conn.Close()
+	s.conn, s.reader = nil, nil
+}
+
+// loadNATSSink builds the NATS sink from NATS_URL and NATS_SUBJECT
+// It returns nil when no server is configured
+func loadNATSSink() (EventSink, error) {
+	v := os.Getenv("NATS_URL")
+	if v == "" {
+		return nil, nil
+	}
+
+	server, err := url.Parse(v)
+	if err != nil || server.Host == "" {
+		return nil, fmt.Errorf("invalid NATS_URL %q", v)
+	}
+	switch server.Scheme {
+	case "nats", "tls":
+	default:
+		return nil, fmt.Errorf("invalid NATS_URL %q: scheme must be nats or tls", v)
+	}
+	if server.Port() == "" {
+		server.Host += ":4222"
+	}
+
+	sink := &natsSink{server: server, prefix: "bitcoin-tracker"}
+	if subject := strings.Trim(os.Getenv("NATS_SUBJECT"), "."); subject != "" {
+		if strings.ContainsAny(subject, "*> \t") || strings.Contains(subject, "..") {
+			return nil, fmt.Errorf("invalid NATS_SUBJECT %q: wildcards, spaces, and empty tokens are not allowed", subject)
+		}
+		sink.prefix = subject
+	}
+	return sink, nil
+}
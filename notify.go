@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"          // Package for request bodies
+	"crypto/ed25519" // Package for the Discord public key
+	"encoding/hex"   // Package for decoding the Discord public key
+	"encoding/json"  // Package for JSON encoding
+	"fmt"            // Package for formatted I/O operations
+	"log/slog"       // Package for structured logging
+	"mime"           // Package for encoding email subjects
+	"net"            // Package for building SMTP addresses
+	"net/http"       // Package for response status codes
+	"net/smtp"       // Package for email delivery
+	"os"             // Package for environment variables
+	"sort"           // Package for stable status ordering
+	"strings"        // Package for string manipulation
+	"sync"           // Package for guarding notifier health
+	"time"           // Package for delivery timestamps
+)
+
+// Notifier delivers triggered alerts to a person or system
+// Implementations should return an error rather than retrying themselves;
+// delivery outcomes are tracked per notifier for the status command.
+// Channel is the kind of notifier ("email", "telegram", ...) that alert rules select by.
+type Notifier interface {
+	Name() string
+	Channel() string
+	Notify(a Alert) error
+}
+
+// notifierChannels lists the channel names alert rules may select
+var notifierChannels = []string{"log", "webhook", "email", "telegram", "slack", "desktop"}
+
+// isNotifierChannel reports whether name is a known notifier channel
+func isNotifierChannel(name string) bool {
+	for _, c := range notifierChannels {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsChannel reports whether a rule should be delivered through a channel
+// Rules without a channel list use every channel, and the log always records alerts
+func (r AlertRule) wantsChannel(channel string) bool {
+	if len(r.Channels) == 0 || channel == "log" {
+		return true
+	}
+	for _, c := range r.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// notifiers are the channels every triggered alert is sent through
+var notifiers = []Notifier{logNotifier{}}
+
+// NotifierStatus reports the health of one notifier
+type NotifierStatus struct {
+	Name        string    `json:"name"`
+	Sent        int       `json:"sent"`                    // Successful deliveries since startup
+	Failed      int       `json:"failed"`                  // Failed deliveries since startup
+	LastSuccess time.Time `json:"last_success,omitempty"`  // Last successful delivery
+	LastError   string    `json:"last_error,omitempty"`    // Most recent delivery error
+	LastErrorAt time.Time `json:"last_error_at,omitempty"` // When LastError happened
+}
+
+// notifierHealth tracks delivery outcomes per notifier name
+var notifierHealth = struct {
+	mu     sync.Mutex
+	byName map[string]*NotifierStatus
+}{byName: make(map[string]*NotifierStatus)}
+
+// recordNotifyResult updates the health of a notifier after a delivery attempt
+func recordNotifyResult(name string, err error) {
+	notifierHealth.mu.Lock()
+	defer notifierHealth.mu.Unlock()
+
+	s, ok := notifierHealth.byName[name]
+	if !ok {
+		s = &NotifierStatus{Name: name}
+		notifierHealth.byName[name] = s
+	}
+	if err != nil {
+		s.Failed++
+		s.LastError = err.Error()
+		s.LastErrorAt = time.Now()
+		return
+	}
+	s.Sent++
+	s.LastSuccess = time.Now()
+}
+
+// notifierStatuses returns the health of every configured notifier, sorted by name
+func notifierStatuses() []NotifierStatus {
+	notifierHealth.mu.Lock()
+	defer notifierHealth.mu.Unlock()
+
+	statuses := make([]NotifierStatus, 0, len(notifiers))
+	for _, n := range notifiers {
+		s := NotifierStatus{Name: n.Name()}
+		if h, ok := notifierHealth.byName[n.Name()]; ok {
+			s = *h
+		}
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// sendNotifications delivers an alert through every notifier the rule selects
+// Notifiers holding alerts for quiet hours or a digest get it later (see digest.go)
+func sendNotifications(a Alert) {
+	for _, n := range notifiers {
+		if !a.Rule.wantsChannel(n.Channel()) || holdAlert(n, a) {
+			continue
+		}
+		deliverAlert(n, a)
+	}
+}
+
+// deliverAlert sends an alert through one notifier
+// Failures are logged and recorded so one broken channel never blocks the others
+func deliverAlert(n Notifier, a Alert) {
+	err := n.Notify(a)
+	if err != nil {
+		slog.Error("Failed to send alert", "rule", a.Rule.ID, "notifier", n.Name(), "error", err)
+	}
+	recordNotifyResult(n.Name(), err)
+}
+
+// logNotifier writes alerts to the application log
+// It is always enabled so triggered alerts are never silently lost
+type logNotifier struct{}
+
+// Name identifies the notifier in logs and status output
+func (logNotifier) Name() string { return "log" }
+
+// Channel is the name rules use to select this notifier
+func (logNotifier) Channel() string { return "log" }
+
+// Notify implements Notifier
+func (logNotifier) Notify(a Alert) error {
+	slog.Warn("Alert triggered", "rule", a.Rule.ID, "kind", a.Rule.Kind, "currency", a.Rule.Currency, "price", a.Price, "message", a.Message)
+	return nil
+}
+
+// AlertPayload is the JSON body POSTed by the webhook notifier
+type AlertPayload struct {
+	RuleID     int            `json:"rule_id"`
+	Condition  string         `json:"condition"`
+	Currency   string         `json:"currency"`
+	Price      float64        `json:"price"`
+	Change     float64        `json:"change,omitempty"`      // Percent change for change and accel rules
+	PrevChange float64        `json:"prev_change,omitempty"` // Percent change over the preceding window for accel rules
+	Pattern    *CandlePattern `json:"pattern,omitempty"`     // Detected pattern for pattern rules
+	Level      *PriceLevel    `json:"level,omitempty"`       // Nearest support/resistance level for level rules
+	Left       float64        `json:"left,omitempty"`        // Left operand of the condition for indicator rules
+	Right      float64        `json:"right,omitempty"`       // Right operand of the condition for indicator rules
+	Metric     float64        `json:"metric,omitempty"`      // Watched value or gain for portfolio rules
+	Latency    float64        `json:"latency,omitempty"`     // Seconds from quote to write of the newest price for latency rules
+	Basket     string         `json:"basket,omitempty"`      // Basket whose value basket rules watch
+	Stablecoin string         `json:"stablecoin,omitempty"`  // Stablecoin of peg alerts, e.g. "usdt"
+	Target     *PriceTarget   `json:"target,omitempty"`      // Crossed price target of target alerts
+	Age        float64        `json:"age,omitempty"`         // Seconds without a stored price for stale alerts
+	Message    string         `json:"message"`
+	Time       time.Time      `json:"time"`
+}
+
+// newAlertPayload converts an alert into its JSON representation
+func newAlertPayload(a Alert) AlertPayload {
+	return AlertPayload{
+		RuleID:     a.Rule.ID,
+		Condition:  a.Rule.Condition(),
+		Currency:   a.Rule.Currency,
+		Price:      a.Price,
+		Change:     a.Change,
+		PrevChange: a.PrevChange,
+		Pattern:    a.Pattern,
+		Level:      a.Level,
+		Left:       a.Left,
+		Right:      a.Right,
+		Metric:     a.Metric,
+		Latency:    a.Latency,
+		Basket:     a.Rule.Basket,
+		Stablecoin: a.Stablecoin,
+		Target:     a.Target,
+		Age:        a.Age.Seconds(),
+		Message:    a.Message,
+		Time:       a.Time,
+	}
+}
+
+// webhookNotifier POSTs each alert as JSON to a URL
+type webhookNotifier struct {
+	url string
+}
+
+// Name identifies the notifier in logs and status output
+func (n webhookNotifier) Name() string { return "webhook " + n.url }
+
+// Channel is the name rules use to select this notifier
+func (webhookNotifier) Channel() string { return "webhook" }
+
+// Notify implements Notifier
+func (n webhookNotifier) Notify(a Alert) error {
+	body, err := json.Marshal(newAlertPayload(a))
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	resp, err := httpClient.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to deliver alert webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("alert webhook returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// emailNotifier sends alerts by SMTP
+// smtp.SendMail upgrades to TLS with STARTTLS whenever the server offers it
+type emailNotifier struct {
+	addr     string   // SMTP server host:port
+	host     string   // SMTP server host, used for authentication
+	username string   // Optional SMTP username
+	password string   // Optional SMTP password
+	from     string   // Sender address
+	to       []string // Recipient addresses
+}
+
+// Name identifies the notifier in logs and status output
+func (n emailNotifier) Name() string { return "email " + strings.Join(n.to, ",") }
+
+// Channel is the name rules use to select this notifier
+func (emailNotifier) Channel() string { return "email" }
+
+// Notify implements Notifier
+func (n emailNotifier) Notify(a Alert) error {
+	// The first line of the message doubles as the subject
+	subject, _, _ := strings.Cut(a.Message, "\n")
+
+	var msg strings.Builder
+	msg.WriteString("From: " + n.from + "\r\n")
+	msg.WriteString("To: " + strings.Join(n.to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + a.Time.Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(a.Message, "\n", "\r\n") + "\r\n")
+
+	if err := n.send([]byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send alert email: %w", err)
+	}
+	return nil
+}
+
+// send delivers a complete message, headers included, to every recipient
+func (n emailNotifier) send(msg []byte) error {
+	var auth smtp.Auth
+	if n.username != "" {
+		auth = smtp.PlainAuth("", n.username, n.password, n.host)
+	}
+	return smtp.SendMail(n.addr, auth, n.from, n.to, msg)
+}
+
+// newEmailNotifier sends to the comma-separated recipients of to through the SMTP_*
+// server; setting names the variable to came from, for errors
+func newEmailNotifier(setting, to string) (emailNotifier, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return emailNotifier{}, fmt.Errorf("%s is set but SMTP_HOST is not", setting)
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USERNAME")
+	}
+	if from == "" {
+		return emailNotifier{}, fmt.Errorf("SMTP_FROM is required with %s", setting)
+	}
+
+	n := emailNotifier{
+		addr:     net.JoinHostPort(host, port),
+		host:     host,
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     from,
+	}
+	for _, addr := range strings.Split(to, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			n.to = append(n.to, addr)
+		}
+	}
+	return n, nil
+}
+
+// telegramNotifier sends alerts to a chat through a Telegram bot
+type telegramNotifier struct {
+	token   string // Bot token from @BotFather
+	chatID  string // Chat, group, or channel ID to post to
+	actions bool   // Attach snooze/disable buttons (TELEGRAM_WEBHOOK_SECRET is set)
+}
+
+// Name identifies the notifier in logs and status output
+// The bot token is a secret, so only the chat ID is shown
+func (n telegramNotifier) Name() string { return "telegram " + n.chatID }
+
+// Channel is the name rules use to select this notifier
+func (telegramNotifier) Channel() string { return "telegram" }
+
+// Notify implements Notifier
+func (n telegramNotifier) Notify(a Alert) error {
+	msg := map[string]interface{}{"chat_id": n.chatID, "text": a.Message}
+	if n.actions && a.Rule.ID != 0 {
+		// Pressed buttons arrive as callback queries; alerts that don't come from a
+		// stored rule, like peg alerts, have nothing to snooze at POST /actions/telegram
+		var row []map[string]string
+		for _, action := range alertActionButtons(a.Rule.ID) {
+			row = append(row, map[string]string{"text": action.label, "callback_data": action.value})
+		}
+		msg["reply_markup"] = map[string]interface{}{"inline_keyboard": [][]map[string]string{row}}
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode telegram message: %w", err)
+	}
+
+	url := "https://api.telegram.org/bot" + n.token + "/sendMessage"
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL contains the token, so don't let it leak into logs via the error
+		return fmt.Errorf("failed to reach telegram API")
+	}
+	defer resp.Body.Close()
+
+	// Response format: {"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if !result.OK {
+		return fmt.Errorf("telegram returned status %d: %s", resp.StatusCode, result.Description)
+	}
+	return nil
+}
+
+// slackNotifier posts alerts to a Slack incoming webhook
+type slackNotifier struct {
+	url     string // Incoming webhook URL
+	actions bool   // Attach snooze/disable buttons (SLACK_SIGNING_SECRET is set)
+}
+
+// Name identifies the notifier in logs and status output
+// The webhook URL is a secret, so it is not shown
+func (slackNotifier) Name() string { return "slack" }
+
+// Channel is the name rules use to select this notifier
+func (slackNotifier) Channel() string { return "slack" }
+
+// slackEscaper escapes the characters Slack treats as markup in message text
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Notify implements Notifier
+func (n slackNotifier) Notify(a Alert) error {
+	text := slackEscaper.Replace(a.Message)
+	blocks := []map[string]interface{}{
+		{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}},
+	}
+	if n.actions && a.Rule.ID != 0 {
+		// Pressed buttons arrive as block_actions interactions at POST /actions/slack
+		var elements []map[string]interface{}
+		for _, action := range alertActionButtons(a.Rule.ID) {
+			elements = append(elements, map[string]interface{}{
+				"type":      "button",
+				"text":      map[string]string{"type": "plain_text", "text": action.label},
+				"action_id": action.id,
+				"value":     action.value,
+			})
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "actions", "elements": elements})
+	}
+
+	// text is the fallback shown in notifications and clients without block support
+	body, err := json.Marshal(map[string]interface{}{"text": text, "blocks": blocks})
+	if err != nil {
+		return fmt.Errorf("failed to encode slack message: %w", err)
+	}
+
+	resp, err := httpClient.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL is a secret, so don't let it leak into logs via the error
+		return fmt.Errorf("failed to reach slack webhook")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack webhook returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// loadNotifiers builds the notifier list from environment variables:
+// ALERT_WEBHOOK_URLS, SMTP_* with ALERT_EMAIL_TO, TELEGRAM_BOT_TOKEN with TELEGRAM_CHAT_ID,
+// SLACK_WEBHOOK_URL, and DESKTOP_NOTIFICATIONS. The log notifier is always first. It also loads the default
+// alert cooldown and the secrets that verify notification button callbacks and chat commands.
+func loadNotifiers() error {
+	bots := chatBotConfig{
+		slackSecret:    os.Getenv("SLACK_SIGNING_SECRET"),
+		telegramSecret: os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+		telegramToken:  os.Getenv("TELEGRAM_BOT_TOKEN"),
+		telegramChatID: os.Getenv("TELEGRAM_CHAT_ID"),
+	}
+	if v := os.Getenv("DISCORD_PUBLIC_KEY"); v != "" {
+		key, err := hex.DecodeString(v)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid DISCORD_PUBLIC_KEY: expected %d hex-encoded bytes", ed25519.PublicKeySize)
+		}
+		bots.discordKey = ed25519.PublicKey(key)
+	}
+
+	list := []Notifier{logNotifier{}}
+	for _, url := range strings.Split(os.Getenv("ALERT_WEBHOOK_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			list = append(list, webhookNotifier{url: url})
+		}
+	}
+
+	if to := os.Getenv("ALERT_EMAIL_TO"); to != "" {
+		n, err := newEmailNotifier("ALERT_EMAIL_TO", to)
+		if err != nil {
+			return err
+		}
+		list = append(list, n)
+	}
+
+	if token := os.Getenv("TELEGRAM_BOT_TOKEN"); token != "" {
+		chatID := os.Getenv("TELEGRAM_CHAT_ID")
+		if chatID == "" {
+			return fmt.Errorf("TELEGRAM_BOT_TOKEN is set but TELEGRAM_CHAT_ID is not")
+		}
+		list = append(list, telegramNotifier{token: token, chatID: chatID, actions: bots.telegramSecret != ""})
+	}
+
+	if url := os.Getenv("SLACK_WEBHOOK_URL"); url != "" {
+		list = append(list, slackNotifier{url: url, actions: bots.slackSecret != ""})
+	}
+
+	desktop, ok, err := loadDesktopNotifier()
+	if err != nil {
+		return err
+	}
+	if ok {
+		list = append(list, desktop)
+	}
+
+	cooldown, err := loadAlertCooldown()
+	if err != nil {
+		return err
+	}
+	alertCooldown = cooldown
+
+	schedule, err := loadNotifySchedule()
+	if err != nil {
+		return err
+	}
+	notifySchedule = schedule
+
+	chatBots = bots
+	notifiers = list
+	return nil
+}
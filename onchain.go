@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context" // Package for fetching within the collector deadline
+	"errors"  // Package for joining request errors
+	"fmt"     // Package for formatted errors
+	"os"      // Package for environment variables
+	"strings" // Package for string manipulation
+)
+
+// The onchain collector records the state of the Bitcoin network: the estimated
+// hashrate, the mining difficulty, and the size of the mempool. It asks mempool.space,
+// or a self-hosted mempool instance, by default and blockchain.info with
+// ONCHAIN_PROVIDER=blockchain.info; blockchain.info doesn't report the mempool's vsize.
+
+// OnchainConfig controls where the onchain collector fetches from
+type OnchainConfig struct {
+	Provider   string // "mempool.space" or "blockchain.info"
+	MempoolURL string // Base URL of the mempool instance asked with mempool.space
+}
+
+// onchainConfig is the active configuration, loaded at startup
+var onchainConfig = OnchainConfig{Provider: "mempool.space", MempoolURL: "https://mempool.space"}
+
+// loadOnchainConfig reads ONCHAIN_PROVIDER and ONCHAIN_MEMPOOL_URL
+func loadOnchainConfig() (OnchainConfig, error) {
+	c := OnchainConfig{Provider: "mempool.space", MempoolURL: "https://mempool.space"}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("ONCHAIN_PROVIDER"))); v != "" {
+		if v != "mempool.space" && v != "blockchain.info" {
+			return c, fmt.Errorf("unknown ONCHAIN_PROVIDER %q (expected mempool.space or blockchain.info)", v)
+		}
+		c.Provider = v
+	}
+	if v := strings.TrimSpace(os.Getenv("ONCHAIN_MEMPOOL_URL")); v != "" {
+		if !strings.HasPrefix(v, "http://") && !strings.HasPrefix(v, "https://") {
+			return c, fmt.Errorf("invalid ONCHAIN_MEMPOOL_URL %q (expected an http:// or https:// URL)", v)
+		}
+		c.MempoolURL = strings.TrimSuffix(v, "/")
+	}
+	return c, nil
+}
+
+// onchainCollector records Bitcoin network metrics
+type onchainCollector struct{}
+
+// Name implements Collector
+func (onchainCollector) Name() string { return "onchain" }
+
+// Source implements Collector
+func (onchainCollector) Source() string { return onchainConfig.Provider }
+
+// Metrics implements Collector
+func (onchainCollector) Metrics() []CollectorMetric {
+	return []CollectorMetric{
+		{Name: "hashrate", Unit: "H/s", About: "Estimated network hashrate"},
+		{Name: "difficulty", About: "Mining difficulty"},
+		{Name: "mempool_size", Unit: "tx", About: "Unconfirmed transactions in the mempool", Count: true},
+		{Name: "mempool_vsize", Unit: "vB", About: "Virtual size of the mempool's transactions"},
+	}
+}
+
+// Collect implements Collector
+func (c onchainCollector) Collect(ctx context.Context, repo *Repository) (map[string]float64, error) {
+	if onchainConfig.Provider == "blockchain.info" {
+		return c.collectBlockchainInfo(ctx, repo)
+	}
+	return c.collectMempool(ctx, repo)
+}
+
+// collectMempool asks a mempool instance for the mining figures and the mempool
+func (c onchainCollector) collectMempool(ctx context.Context, repo *Repository) (map[string]float64, error) {
+	values := make(map[string]float64)
+	var errs []error
+
+	var mining struct {
+		CurrentHashrate   float64 `json:"currentHashrate"`   // H/s
+		CurrentDifficulty float64 `json:"currentDifficulty"` // Difficulty of the current epoch
+	}
+	if err := getJSON(ctx, repo, "mempool.space", c.Name(), onchainConfig.MempoolURL+"/api/v1/mining/hashrate/3d", &mining); err != nil {
+		errs = append(errs, err)
+	} else {
+		values["hashrate"], values["difficulty"] = mining.CurrentHashrate, mining.CurrentDifficulty
+	}
+
+	var mempool struct {
+		Count int     `json:"count"` // Unconfirmed transactions
+		VSize float64 `json:"vsize"` // Their virtual size in vbytes
+	}
+	if err := getJSON(ctx, repo, "mempool.space", c.Name(), onchainConfig.MempoolURL+"/api/mempool", &mempool); err != nil {
+		errs = append(errs, err)
+	} else {
+		values["mempool_size"], values["mempool_vsize"] = float64(mempool.Count), mempool.VSize
+	}
+	return values, errors.Join(errs...)
+}
+
+// collectBlockchainInfo asks blockchain.info for the network stats and the number of
+// unconfirmed transactions
+func (c onchainCollector) collectBlockchainInfo(ctx context.Context, repo *Repository) (map[string]float64, error) {
+	values := make(map[string]float64)
+	var errs []error
+
+	var stats struct {
+		HashRate   float64 `json:"hash_rate"` // GH/s
+		Difficulty float64 `json:"difficulty"`
+	}
+	if err := getJSON(ctx, repo, "blockchain.info", c.Name(), "https://api.blockchain.info/stats", &stats); err != nil {
+		errs = append(errs, err)
+	} else {
+		values["hashrate"], values["difficulty"] = stats.HashRate*1e9, stats.Difficulty
+	}
+
+	// The count comes back as a bare number, which decodes as JSON
+	var unconfirmed int
+	if err := getJSON(ctx, repo, "blockchain.info", c.Name(), "https://blockchain.info/q/unconfirmedcount", &unconfirmed); err != nil {
+		errs = append(errs, err)
+	} else {
+		values["mempool_size"] = float64(unconfirmed)
+	}
+	return values, errors.Join(errs...)
+}
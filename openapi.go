@@ -0,0 +1,734 @@
+package main
+
+import (
+	"context"       // Package for the command's signature
+	"encoding/json" // Package for encoding the document
+	"fmt"           // Package for formatted I/O operations
+	"go/format"     // Package for formatting the generated client
+	"net/http"      // Package for serving the document
+	"os"            // Package for writing the generated client
+	"reflect"       // Package for deriving schemas from the response types
+	"sort"          // Package for ordering schemas and types
+	"strings"       // Package for building names and source
+	"time"          // Package for recognizing timestamps
+	"unicode"       // Package for exporting type names
+)
+
+//go:generate go run . openapi --client --output apiclient/apiclient.go
+
+// The OpenAPI document at GET /openapi.json describes the JSON endpoints of the HTTP
+// API. Its schemas are derived from the Go types the handlers encode, so they can't
+// drift from the responses; `openapi --client` turns the same description into the Go
+// client package in apiclient/. Pages, charts, feeds, and streams are left out.
+
+// apiParam is a parameter of an API operation
+type apiParam struct {
+	name     string
+	in       string // "query" or "path"
+	kind     string // "string", "integer", or "date-time"
+	about    string
+	required bool
+}
+
+// The parameters shared by many operations
+var (
+	currencyParam   = apiParam{name: "currency", in: "query", kind: "string", about: "Fiat currency code; the first of CURRENCIES when omitted"}
+	fromParam       = apiParam{name: "from", in: "query", kind: "date-time", about: "Start of the range (RFC 3339)"}
+	toParam         = apiParam{name: "to", in: "query", kind: "date-time", about: "End of the range, exclusive (RFC 3339)"}
+	limitParam      = apiParam{name: "limit", in: "query", kind: "integer", about: "Most records returned, up to 10000"}
+	precisionParam  = apiParam{name: "precision", in: "query", kind: "integer", about: "Decimal places of the prices; full precision when omitted"}
+	resolutionParam = apiParam{name: "resolution", in: "query", kind: "string", about: "Candle resolution, 1h or 1d"}
+	windowParam     = apiParam{name: "window", in: "query", kind: "string", about: "Range instead of from and to, e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31"}
+	exportIDParam   = apiParam{name: "id", in: "path", kind: "integer", about: "Export job ID", required: true}
+	targetIDParam   = apiParam{name: "id", in: "path", kind: "integer", about: "Price target ID", required: true}
+	annotationParam = apiParam{name: "id", in: "path", kind: "integer", about: "Annotation ID", required: true}
+	priceIDParam    = apiParam{name: "id", in: "path", kind: "integer", about: "Price record ID", required: true}
+)
+
+// apiOperation describes one JSON endpoint of the HTTP API
+type apiOperation struct {
+	method   string
+	path     string // With {name} for path parameters
+	id       string // operationId, and the generated client's method name
+	tag      string
+	summary  string
+	params   []apiParam
+	body     interface{} // Value of the request body's type; nil without a body
+	response interface{} // Value of the response's type; nil without content
+	status   int         // Status of a successful response; 200 when 0
+}
+
+// apiOperations lists the documented operations in the order the document and the
+// client list them
+var apiOperations = []apiOperation{
+	{method: http.MethodGet, path: "/prices/latest", id: "LatestPrice", tag: "prices",
+		summary: "Newest record of a currency with its change over 24 hours, 7 days, and 30 days",
+		params:  []apiParam{currencyParam, precisionParam}, response: latestPrice{}},
+	{method: http.MethodGet, path: "/prices/at", id: "PriceAt", tag: "prices",
+		summary: "Price at a point in time, interpolated between the samples around it or from the nearest one; 404 when none is within max_gap",
+		params: []apiParam{
+			{name: "t", in: "query", kind: "string", about: "Time of the price (RFC 3339, e.g. 2023-06-01T12:00Z, or Unix seconds)", required: true},
+			currencyParam,
+			{name: "mode", in: "query", kind: "string", about: "interpolate (default) or nearest"},
+			{name: "max_gap", in: "query", kind: "string", about: "Farthest a sample used may be from t, e.g. 6h; 24h when omitted"},
+			precisionParam,
+		}, response: PriceAt{}},
+	{method: http.MethodGet, path: "/prices", id: "ListPrices", tag: "prices",
+		summary: "Records in [from, to), oldest first unless order=desc; from defaults to 24 hours ago. A full page links to the next in a Link header",
+		params: []apiParam{currencyParam, windowParam, fromParam, toParam, limitParam, precisionParam,
+			{name: "before", in: "query", kind: "string", about: "Only records listed before this record ID or RFC 3339 time"},
+			{name: "after", in: "query", kind: "string", about: "Only records listed after this record ID or RFC 3339 time"},
+			{name: "order", in: "query", kind: "string", about: "asc (oldest first, the default) or desc (newest first)"},
+		}, response: []PriceRecord{}},
+	{method: http.MethodPost, path: "/fetch", id: "Fetch", tag: "prices",
+		summary: "Fetch and store the current prices now; returns the newest record of every currency",
+		params:  []apiParam{precisionParam}, response: []PriceRecord{}},
+	{method: http.MethodDelete, path: "/prices/{id}", id: "DeletePrice", tag: "prices",
+		summary: "Delete a glitched record, keeping it in the audit trail; the body's reason is optional",
+		params:  []apiParam{priceIDParam}, body: priceCorrectionRequest{}, response: PriceCorrection{}},
+	{method: http.MethodPatch, path: "/prices/{id}", id: "AmendPrice", tag: "prices",
+		summary: "Give a record the price it should have had",
+		params:  []apiParam{priceIDParam}, body: priceCorrectionRequest{}, response: PriceCorrection{}},
+	{method: http.MethodPost, path: "/prices/{id}/restore", id: "RestorePrice", tag: "prices",
+		summary: "Put a deleted record back; 409 when a record of its currency and minute is stored",
+		params:  []apiParam{priceIDParam}, body: priceCorrectionRequest{}, response: PriceCorrection{}},
+	{method: http.MethodGet, path: "/corrections", id: "ListPriceCorrections", tag: "prices",
+		summary: "Audit trail of deleted, amended, and restored records, newest first",
+		params: []apiParam{
+			{name: "price_id", in: "query", kind: "integer", about: "Only the corrections of this record"},
+			limitParam,
+		}, response: []PriceCorrection{}},
+	{method: http.MethodGet, path: "/candles", id: "ListCandles", tag: "analytics",
+		summary: "OHLC candles starting in [from, to), oldest first; from defaults to the newest 48 candles",
+		params:  []apiParam{currencyParam, resolutionParam, windowParam, fromParam, toParam, limitParam, precisionParam}, response: []Candle{}},
+	{method: http.MethodGet, path: "/indicators", id: "ListIndicators", tag: "analytics",
+		summary: "Indicator values per candle starting in [from, to), oldest first",
+		params:  []apiParam{currencyParam, resolutionParam, windowParam, fromParam, toParam, limitParam}, response: []IndicatorPoint{}},
+	{method: http.MethodGet, path: "/patterns", id: "ListPatterns", tag: "analytics",
+		summary: "Candlestick patterns detected since from (default 30 days ago), oldest first",
+		params:  []apiParam{currencyParam, resolutionParam, fromParam, limitParam}, response: []CandlePattern{}},
+	{method: http.MethodGet, path: "/levels", id: "ListLevels", tag: "analytics",
+		summary: "Support and resistance levels, ordered by price",
+		params:  []apiParam{currencyParam}, response: []PriceLevel{}},
+	{method: http.MethodGet, path: "/stats", id: "GetStats", tag: "analytics",
+		summary: "Statistics over a window, or over from and to; the 24 hours before to (default now) when neither is given",
+		params:  []apiParam{currencyParam, windowParam, fromParam, toParam}, response: PriceStats{}},
+	{method: http.MethodGet, path: "/spread", id: "GetSpread", tag: "analytics",
+		summary: "Newest price on each exchange of EXCHANGES and the spread between them",
+		params: []apiParam{currencyParam,
+			{name: "window", in: "query", kind: "string", about: "Window ending now, e.g. 24h or 7d"},
+		}, response: SpreadReport{}},
+	{method: http.MethodGet, path: "/anomalies", id: "ListAnomalies", tag: "analytics",
+		summary: "Prices the anomaly filter caught, newest first",
+		params:  []apiParam{limitParam}, response: []PriceAnomaly{}},
+	{method: http.MethodGet, path: "/providers", id: "ListProviders", tag: "providers",
+		summary: "Assets, currencies, and history of every built-in provider", response: []ProviderCapabilities{}},
+	{method: http.MethodGet, path: "/portfolio", id: "GetPortfolio", tag: "portfolio",
+		summary: "Every holding valued at the latest price; currency defaults to PORTFOLIO_CURRENCY",
+		params:  []apiParam{currencyParam}, response: PortfolioValuation{}},
+	{method: http.MethodGet, path: "/portfolio/history", id: "ListPortfolioHistory", tag: "portfolio",
+		summary: "Portfolio snapshots in [from, to), oldest first; from defaults to 30 days ago",
+		params:  []apiParam{currencyParam, windowParam, fromParam, toParam, limitParam}, response: []PortfolioSnapshot{}},
+	{method: http.MethodGet, path: "/alerts/stats", id: "ListAlertStats", tag: "alerts",
+		summary: "Statistics of every alert rule, noisiest first", response: []AlertRuleStats{}},
+	{method: http.MethodGet, path: "/targets", id: "ListPriceTargets", tag: "alerts",
+		summary: "Price targets, oldest first",
+		params:  []apiParam{{name: "status", in: "query", kind: "string", about: "Only targets in this state, pending or fired"}}, response: []PriceTarget{}},
+	{method: http.MethodPost, path: "/targets", id: "CreatePriceTarget", tag: "alerts",
+		summary: "Set a price target that notifies once when the price crosses it", body: priceTargetRequest{}, response: PriceTarget{}, status: http.StatusCreated},
+	{method: http.MethodPost, path: "/targets/{id}/rearm", id: "RearmPriceTarget", tag: "alerts",
+		summary: "Make a fired price target pending again", params: []apiParam{targetIDParam}, status: http.StatusNoContent},
+	{method: http.MethodDelete, path: "/targets/{id}", id: "DeletePriceTarget", tag: "alerts",
+		summary: "Remove a price target", params: []apiParam{targetIDParam}, status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/annotations", id: "ListAnnotations", tag: "annotations",
+		summary: "Annotations in [from, to), oldest first; both ends are open when omitted",
+		params: []apiParam{windowParam, fromParam, toParam,
+			{name: "tag", in: "query", kind: "string", about: "Only annotations with this tag"},
+		}, response: []Annotation{}},
+	{method: http.MethodPost, path: "/annotations", id: "CreateAnnotation", tag: "annotations",
+		summary: "Label a point in time, now when the body has no time", body: annotationRequest{}, response: Annotation{}, status: http.StatusCreated},
+	{method: http.MethodDelete, path: "/annotations/{id}", id: "DeleteAnnotation", tag: "annotations",
+		summary: "Remove an annotation", params: []apiParam{annotationParam}, status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/baskets", id: "ListBaskets", tag: "baskets",
+		summary: "Every basket of BASKETS with its newest value and change over 24 hours", response: []BasketSummary{}},
+	{method: http.MethodGet, path: "/baskets/history", id: "ListBasketValues", tag: "baskets",
+		summary: "Values of a basket in [from, to), oldest first; from defaults to 24 hours before to",
+		params: []apiParam{
+			{name: "basket", in: "query", kind: "string", about: "Basket name", required: true},
+			windowParam, fromParam, toParam,
+		}, response: []BasketValue{}},
+	{method: http.MethodGet, path: "/collectors", id: "ListCollectors", tag: "collectors",
+		summary: "Newest value of every collector metric recorded so far", response: []collectorSummary{}},
+	{method: http.MethodGet, path: "/collectors/history", id: "ListCollectorSamples", tag: "collectors",
+		summary: "Values of a metric in [from, to), oldest first; from defaults to 24 hours ago",
+		params: []apiParam{
+			{name: "metric", in: "query", kind: "string", about: "Metric name, e.g. hashrate", required: true},
+			windowParam, fromParam, toParam, limitParam,
+		}, response: []CollectorSample{}},
+	{method: http.MethodPost, path: "/exports", id: "CreateExportJob", tag: "exports",
+		summary: "Queue an export or backfill job", body: exportJobRequest{}, response: exportJobView{}, status: http.StatusAccepted},
+	{method: http.MethodGet, path: "/exports", id: "ListExportJobs", tag: "exports",
+		summary: "The newest export jobs", params: []apiParam{limitParam}, response: []exportJobView{}},
+	{method: http.MethodGet, path: "/exports/{id}", id: "GetExportJob", tag: "exports",
+		summary: "An export job's status and progress", params: []apiParam{exportIDParam}, response: exportJobView{}},
+	{method: http.MethodDelete, path: "/exports/{id}", id: "DeleteExportJob", tag: "exports",
+		summary: "Cancel an export job and delete it with its file", params: []apiParam{exportIDParam}, status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/public/latest", id: "PublicLatestPrice", tag: "public",
+		summary: "Latest price of a currency with its change over 24 hours, 7 days, and 30 days; served without a key when PUBLIC_API is on",
+		params:  []apiParam{currencyParam}, response: PublicPrice{}},
+	{method: http.MethodGet, path: "/public/history", id: "PublicPriceHistory", tag: "public",
+		summary: "Candle closes over a range ending now, hourly up to 30 days; served without a key when PUBLIC_API is on",
+		params: []apiParam{currencyParam,
+			{name: "range", in: "query", kind: "string", about: "Window ending now, e.g. 24h or 30d; 7d when omitted, at most 365d"},
+		}, response: PublicHistory{}},
+	{method: http.MethodGet, path: "/healthz", id: "Healthz", tag: "health",
+		summary: "Liveness probe; 503 when a fetching process is wedged", response: HealthReport{}},
+	{method: http.MethodGet, path: "/readyz", id: "Readyz", tag: "health",
+		summary: "Readiness probe; 503 while the database is unreachable", response: HealthReport{}},
+}
+
+// apiSchemaNames renames the types whose Go names don't suit the document
+var apiSchemaNames = map[string]string{
+	"apiError":      "Problem",
+	"exportJobView": "ExportJob",
+}
+
+// apiSchema is a JSON Schema as OpenAPI 3.0 uses it
+type apiSchema struct {
+	Ref                  string                `json:"$ref,omitempty"`
+	AllOf                []*apiSchema          `json:"allOf,omitempty"` // Wraps a nullable $ref
+	Type                 string                `json:"type,omitempty"`
+	Format               string                `json:"format,omitempty"`
+	Nullable             bool                  `json:"nullable,omitempty"`
+	Items                *apiSchema            `json:"items,omitempty"`
+	Properties           map[string]*apiSchema `json:"properties,omitempty"`
+	AdditionalProperties *apiSchema            `json:"additionalProperties,omitempty"`
+	Required             []string              `json:"required,omitempty"`
+
+	order []string // Property names in field order, for the generated types
+}
+
+// apiSchemas collects the named schemas the operations refer to
+type apiSchemas map[string]*apiSchema
+
+// timeType and the other types with a JSON form of their own
+var (
+	timeType         = reflect.TypeOf(time.Time{})
+	fixedDecimalType = reflect.TypeOf(fixedDecimal{})
+	rawMessageType   = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaName returns the schema name of a named Go type
+func schemaName(t reflect.Type) string {
+	if name, ok := apiSchemaNames[t.Name()]; ok {
+		return name
+	}
+	r := []rune(t.Name())
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// schemaFor returns the schema of values of t, adding the structs it refers to
+func (s apiSchemas) schemaFor(t reflect.Type) *apiSchema {
+	switch t {
+	case timeType:
+		return &apiSchema{Type: "string", Format: "date-time"}
+	case fixedDecimalType:
+		return &apiSchema{Type: "number"}
+	case rawMessageType:
+		return &apiSchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem := s.schemaFor(t.Elem())
+		if elem.Ref != "" {
+			return &apiSchema{AllOf: []*apiSchema{elem}, Nullable: true}
+		}
+		elem.Nullable = true
+		return elem
+	case reflect.Bool:
+		return &apiSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &apiSchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &apiSchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &apiSchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &apiSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &apiSchema{Type: "string", Format: "byte"}
+		}
+		return &apiSchema{Type: "array", Items: s.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &apiSchema{Type: "object", AdditionalProperties: s.schemaFor(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := s[name]; !ok {
+			object := &apiSchema{Type: "object", Properties: map[string]*apiSchema{}}
+			s[name] = object // Before the fields, so a type can refer to itself
+			s.addFields(object, t, nil)
+		}
+		return &apiSchema{Ref: "#/components/schemas/" + name}
+	}
+	return &apiSchema{} // Any value
+}
+
+// addFields adds the JSON fields of struct type t to object in field order; as with
+// encoding/json, fields of embedded structs are promoted unless shadowed by a field of
+// an outer struct with the same name
+func (s apiSchemas) addFields(object *apiSchema, t reflect.Type, shadowed map[string]bool) {
+	inner := make(map[string]bool, len(shadowed))
+	for name := range shadowed {
+		inner[name] = true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := jsonFieldName(t.Field(i)); ok {
+			inner[name] = true
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			s.addFields(object, f.Type, inner)
+			continue
+		}
+		name, ok := jsonFieldName(f)
+		if !ok || shadowed[name] {
+			continue
+		}
+		object.Properties[name] = s.schemaFor(f.Type)
+		object.order = append(object.order, name)
+		if !strings.Contains(f.Tag.Get("json"), ",omitempty") && f.Type.Kind() != reflect.Pointer {
+			object.Required = append(object.Required, name)
+		}
+	}
+}
+
+// jsonFieldName returns the name encoding/json gives a struct field; false for fields
+// it leaves out and for embedded structs, whose fields it promotes
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	name, _, _ := strings.Cut(tag, ",")
+	switch {
+	case tag == "-":
+		return "", false
+	case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+		return "", false
+	case !f.IsExported():
+		return "", false
+	case name == "":
+		return f.Name, true
+	}
+	return name, true
+}
+
+// parameterSchema returns the schema of a parameter's values
+func parameterSchema(p apiParam) *apiSchema {
+	switch p.kind {
+	case "integer":
+		return &apiSchema{Type: "integer", Format: "int32"}
+	case "date-time":
+		return &apiSchema{Type: "string", Format: "date-time"}
+	}
+	return &apiSchema{Type: "string"}
+}
+
+// openAPIDocument returns the OpenAPI 3.0 document of the API served at serverURL,
+// and the named schemas in it
+func openAPIDocument(serverURL string) (map[string]interface{}, apiSchemas) {
+	schemas := apiSchemas{}
+	problem := schemas.schemaFor(reflect.TypeOf(apiError{}))
+	paths := map[string]map[string]interface{}{}
+	for _, op := range apiOperations {
+		var params []map[string]interface{}
+		for _, p := range op.params {
+			params = append(params, map[string]interface{}{
+				"name": p.name, "in": p.in, "required": p.required, "description": p.about, "schema": parameterSchema(p),
+			})
+		}
+
+		status := op.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if op.response != nil {
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemas.schemaFor(reflect.TypeOf(op.response))},
+			}
+		}
+		operation := map[string]interface{}{
+			"operationId": op.id,
+			"summary":     op.summary,
+			"tags":        []string{op.tag},
+			"responses": map[string]interface{}{
+				fmt.Sprint(status): success,
+				"default": map[string]interface{}{
+					"description": "RFC 7807 problem details",
+					"content":     map[string]interface{}{"application/problem+json": map[string]interface{}{"schema": problem}},
+				},
+			},
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+		if op.body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.schemaFor(reflect.TypeOf(op.body))},
+				},
+			}
+		}
+		if paths[op.path] == nil {
+			paths[op.path] = map[string]interface{}{}
+		}
+		paths[op.path][strings.ToLower(op.method)] = operation
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Bitcoin Price Tracker API",
+			"description": "Stored Bitcoin prices and the series and reports derived from them",
+			"version":     "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "API key (see `apikey create`)"},
+				"header": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		// Whether a key is needed depends on API_AUTH, so it is optional here
+		"security": []map[string][]string{{"bearer": {}}, {"header": {}}, {}},
+	}
+	if serverURL != "" {
+		doc["servers"] = []map[string]string{{"url": serverURL}}
+	}
+	return doc, schemas
+}
+
+// handleOpenAPI serves GET /openapi.json, the OpenAPI document of the API
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	doc, _ := openAPIDocument(requestBaseURL(r))
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// goInitialisms are the words spelled in capitals in generated names
+var goInitialisms = map[string]bool{
+	"id": true, "url": true, "api": true, "fx": true, "ttl": true, "rsi": true, "sma": true, "ema": true, "ohlc": true,
+}
+
+// goName turns a snake_case JSON name into an exported Go name, e.g. fx_rate -> FXRate
+func goName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if goInitialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		r := []rune(word)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	if b.Len() == 0 || !unicode.IsLetter([]rune(b.String())[0]) {
+		return "X" + b.String()
+	}
+	return b.String()
+}
+
+// goType returns the Go type of values of a schema in the generated client
+func goType(s *apiSchema) string {
+	var t string
+	switch {
+	case len(s.AllOf) == 1:
+		return "*" + goType(s.AllOf[0])
+	case s.Ref != "":
+		t = strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	case s.Type == "string" && s.Format == "date-time":
+		t = "time.Time"
+	case s.Type == "string" && s.Format == "byte":
+		return "[]byte"
+	case s.Type == "string":
+		t = "string"
+	case s.Type == "integer" && s.Format == "int64":
+		t = "int64"
+	case s.Type == "integer":
+		t = "int"
+	case s.Type == "number":
+		t = "float64"
+	case s.Type == "boolean":
+		t = "bool"
+	case s.Type == "array":
+		return "[]" + goType(s.Items)
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		return "map[string]" + goType(s.AdditionalProperties)
+	default:
+		return "json.RawMessage"
+	}
+	if s.Nullable {
+		return "*" + t
+	}
+	return t
+}
+
+// apiClientRuntime is the hand-written part of the generated client: the client type
+// and the request plumbing every operation shares
+const apiClientRuntime = `
+// Client calls the API of one tracker instance
+// Its methods are safe for concurrent use.
+type Client struct {
+	BaseURL    string       // e.g. "http://localhost:8080"
+	HTTPClient *http.Client // Client used for requests
+	APIKey     string       // Sent as a bearer token when set
+}
+
+// New returns a client for the tracker at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTPClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Error is a failed response, with the RFC 7807 problem details the tracker sent
+type Error struct {
+	Status int    ` + "`json:\"status\"`" + `
+	Type   string ` + "`json:\"type\"`" + `
+	Title  string ` + "`json:\"title\"`" + `
+	Detail string ` + "`json:\"detail\"`" + `
+	Kind   string ` + "`json:\"kind,omitempty\"`" + ` // Kind of failure, e.g. "validation" or "storage"
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("tracker returned status %d", e.Status)
+	}
+	return fmt.Sprintf("tracker returned status %d: %s", e.Status, e.Detail)
+}
+
+// do sends a request with body encoded as JSON, unless nil, and decodes the response
+// into out, unless nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{Status: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Detail == "" {
+			apiErr.Detail = strings.TrimSpace(string(data))
+		}
+		apiErr.Status = resp.StatusCode
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
+`
+
+// generateAPIClient returns the formatted source of a Go package named pkg with the
+// types of the document's schemas and a method per operation
+func generateAPIClient(pkg string) ([]byte, error) {
+	_, schemas := openAPIDocument("")
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by \"bitcoin-tracker openapi --client\"; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "// Package %s is a client for the Bitcoin Price Tracker HTTP API, generated from\n", pkg)
+	fmt.Fprintf(&b, "// the OpenAPI document the tracker serves at /openapi.json.\n")
+	fmt.Fprintf(&b, "//\n//\tc := %s.New(\"http://tracker:8080\")\n", pkg)
+	fmt.Fprintf(&b, "//\tprices, err := c.ListPrices(ctx, %s.ListPricesParams{Currency: \"usd\"})\n", pkg)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	b.WriteString("import (\n\t\"bytes\"\n\t\"context\"\n\t\"encoding/json\"\n\t\"fmt\"\n\t\"io\"\n\t\"net/http\"\n\t\"net/url\"\n\t\"strconv\"\n\t\"strings\"\n\t\"time\"\n)\n")
+	b.WriteString(apiClientRuntime)
+
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		if name != "Problem" { // Error stands for it
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := schemas[name]
+		required := map[string]bool{}
+		for _, r := range s.Required {
+			required[r] = true
+		}
+		fmt.Fprintf(&b, "\n// %s is a schema of the API\ntype %s struct {\n", name, name)
+		for _, prop := range s.order {
+			tag := prop
+			if !required[prop] {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "\t%s %s `json:%q`\n", goName(prop), goType(s.Properties[prop]), tag)
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, op := range apiOperations {
+		writeClientOperation(&b, op, schemas)
+	}
+
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to format the generated client: %w", err)
+	}
+	return src, nil
+}
+
+// writeClientOperation writes an operation's parameter type and client method
+func writeClientOperation(b *strings.Builder, op apiOperation, schemas apiSchemas) {
+	var query, path []apiParam
+	for _, p := range op.params {
+		if p.in == "path" {
+			path = append(path, p)
+		} else {
+			query = append(query, p)
+		}
+	}
+
+	args := []string{"ctx context.Context"}
+	for _, p := range path {
+		args = append(args, p.name+" int")
+	}
+	if len(query) > 0 {
+		fmt.Fprintf(b, "\n// %sParams are the query parameters of %s; zero values are left out\ntype %sParams struct {\n", op.id, op.id, op.id)
+		for _, p := range query {
+			t := map[string]string{"string": "string", "integer": "*int", "date-time": "time.Time"}[p.kind]
+			fmt.Fprintf(b, "\t%s %s // %s\n", goName(p.name), t, p.about)
+		}
+		b.WriteString("}\n")
+		args = append(args, "params "+op.id+"Params")
+	}
+	body := "nil"
+	if op.body != nil {
+		args = append(args, "body "+goType(schemas.schemaFor(reflect.TypeOf(op.body))))
+		body = "body"
+	}
+	result := "error"
+	if op.response != nil {
+		result = "(" + goType(schemas.schemaFor(reflect.TypeOf(op.response))) + ", error)"
+	}
+
+	fmt.Fprintf(b, "\n// %s calls %s %s\n// %s\n", op.id, op.method, op.path, op.summary)
+	fmt.Fprintf(b, "func (c *Client) %s(%s) %s {\n", op.id, strings.Join(args, ", "), result)
+	b.WriteString("\tquery := url.Values{}\n")
+	for _, p := range query {
+		field := "params." + goName(p.name)
+		switch p.kind {
+		case "integer":
+			fmt.Fprintf(b, "\tif %s != nil {\n\t\tquery.Set(%q, strconv.Itoa(*%s))\n\t}\n", field, p.name, field)
+		case "date-time":
+			fmt.Fprintf(b, "\tif !%s.IsZero() {\n\t\tquery.Set(%q, %s.Format(time.RFC3339Nano))\n\t}\n", field, p.name, field)
+		default:
+			fmt.Fprintf(b, "\tif %s != \"\" {\n\t\tquery.Set(%q, %s)\n\t}\n", field, p.name, field)
+		}
+	}
+	pathExpr := fmt.Sprintf("%q", op.path)
+	for _, p := range path {
+		pathExpr = strings.Replace(pathExpr, "{"+p.name+"}", "\" + strconv.Itoa("+p.name+") + \"", 1)
+	}
+	pathExpr = strings.TrimSuffix(pathExpr, " + \"\"")
+	method := "http.Method" + goName(strings.ToLower(op.method))
+	if op.response == nil {
+		fmt.Fprintf(b, "\treturn c.do(ctx, %s, %s, query, %s, nil)\n}\n", method, pathExpr, body)
+		return
+	}
+	fmt.Fprintf(b, "\tvar out %s\n", goType(schemas.schemaFor(reflect.TypeOf(op.response))))
+	fmt.Fprintf(b, "\terr := c.do(ctx, %s, %s, query, %s, &out)\n\treturn out, err\n}\n", method, pathExpr, body)
+}
+
+// runOpenAPICommand handles "openapi [--client] [--package apiclient] [--output FILE]"
+// It writes the OpenAPI document, or with --client the generated Go client, to
+// standard output or a file
+func runOpenAPICommand(_ context.Context, args []string) error {
+	fs := newFlagSet("openapi")
+	client := fs.Bool("client", false, "Write the generated Go client instead of the document")
+	pkg := fs.String("package", "apiclient", "Package name of the generated client")
+	server := fs.String("server", "", "Server URL listed in the document, e.g. http://localhost:8080")
+	output := fs.String("output", "", "File to write to (default: standard output)")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if !isGoIdentifier(*pkg) {
+		return validationErrorf("invalid --package %q (expected a Go package name)", *pkg)
+	}
+
+	var data []byte
+	if *client {
+		src, err := generateAPIClient(*pkg)
+		if err != nil {
+			return err
+		}
+		data = src
+	} else {
+		doc, _ := openAPIDocument(*server)
+		encoded, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode the OpenAPI document: %w", err)
+		}
+		data = append(encoded, '\n')
+	}
+
+	if *output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", *output)
+	return nil
+}
+
+// isGoIdentifier reports whether s is a lowercase Go identifier, as package names are
+func isGoIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !(r == '_' || unicode.IsLower(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
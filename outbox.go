@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"       // Package for delivery timeouts and the worker
+	"encoding/json" // Package for storing events
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"os"            // Package for environment variables
+	"strconv"       // Package for parsing EVENT_OUTBOX
+	"sync"          // Package for delivering one sink's events at a time
+	"time"          // Package for retries and timestamps
+)
+
+// With EVENT_OUTBOX, every event is stored once per sink as a row of event_outbox before
+// it is published, and removed once the sink accepted it. An event a sink refused, or
+// that couldn't reach a broker that is down, stays and is retried with a doubling delay
+// until it is delivered; the events after it wait, so each sink still gets them in
+// order. Delivery is at least once: a sink may see an event again when the tracker
+// stopped between publishing it and removing its row.
+
+// Outbox delivery settings that are not configurable
+const (
+	outboxPollInterval = 15 * time.Second // How often the outbox is checked for due retries
+	outboxBatchSize    = 50               // Events of a sink read per query
+	outboxMaxDelay     = time.Hour        // Longest wait between attempts
+)
+
+// OutboxEvent is an event waiting to be delivered to one sink
+type OutboxEvent struct {
+	ID            int
+	Sink          string // Name of the sink, as its Name method returns it
+	EventID       string
+	EventType     string
+	Payload       string // The Event as JSON
+	Attempts      int    // Failed attempts so far
+	Error         string // Why the last attempt failed
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+}
+
+// OutboxConfig controls the event outbox
+type OutboxConfig struct {
+	Enabled    bool
+	RetryDelay time.Duration // Wait after the first failed attempt, doubled for each one after
+}
+
+// outboxConfig is the active configuration, loaded at startup
+var outboxConfig = OutboxConfig{RetryDelay: 10 * time.Second}
+
+// loadOutboxConfig reads EVENT_OUTBOX (true/false) and EVENT_RETRY_DELAY (e.g. 10s)
+func loadOutboxConfig() (OutboxConfig, error) {
+	c := OutboxConfig{RetryDelay: 10 * time.Second}
+	if v := os.Getenv("EVENT_OUTBOX"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid EVENT_OUTBOX %q (expected true or false)", v)
+		}
+		c.Enabled = b
+	}
+	if v := os.Getenv("EVENT_RETRY_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid EVENT_RETRY_DELAY %q", v)
+		}
+		c.RetryDelay = d
+	}
+	return c, nil
+}
+
+// retryDelay returns the wait after an event's attempt-th failed attempt
+func (c OutboxConfig) retryDelay(attempt int) time.Duration {
+	d := c.RetryDelay
+	for i := 1; i < attempt && d < outboxMaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, outboxMaxDelay)
+}
+
+// decodeOutboxEvent restores an event stored in the outbox
+// Price events get their typed data back, as sinks with bare price topics read it.
+func decodeOutboxEvent(payload string) (Event, error) {
+	var stored struct {
+		Event
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(payload), &stored); err != nil {
+		return Event{}, fmt.Errorf("failed to decode outbox event: %w", err)
+	}
+	e := stored.Event
+	e.Data = stored.Data
+	if e.Type == EventPriceRecorded {
+		var data PriceEventData
+		if err := json.Unmarshal(stored.Data, &data); err != nil {
+			return Event{}, fmt.Errorf("failed to decode outbox event: %w", err)
+		}
+		e.Data = data
+	}
+	return e, nil
+}
+
+// outboxWorker delivers the events in the outbox
+// Events are delivered right after they are stored; the worker in the scheduler and
+// stream retries the ones that failed.
+type outboxWorker struct {
+	mu sync.Mutex // Held while delivering, so no event is sent twice by one process
+}
+
+// eventOutbox is the process-wide outbox
+var eventOutbox = &outboxWorker{}
+
+// enabled reports whether events go through the outbox: it needs EVENT_OUTBOX, a
+// database to write to, and a sink
+func (o *outboxWorker) enabled(repo *Repository) bool {
+	return outboxConfig.Enabled && repo != nil && writeMode == "" && len(eventSinks) > 0
+}
+
+// queue stores an event for every sink and delivers what is due
+func (o *outboxWorker) queue(repo *Repository, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	now := time.Now()
+	events := make([]OutboxEvent, 0, len(eventSinks))
+	for _, sink := range eventSinks {
+		events = append(events, OutboxEvent{
+			Sink: sink.Name(), EventID: e.ID, EventType: e.Type, Payload: string(payload),
+			CreatedAt: now, NextAttemptAt: now,
+		})
+	}
+	ctx := context.Background()
+	if err := repo.QueueOutboxEvents(ctx, events); err != nil {
+		return err
+	}
+	o.deliverDue(ctx, repo)
+	return nil
+}
+
+// start runs the retries in the background and returns a function that stops them
+func (o *outboxWorker) start(repo *Repository) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		o.loop(ctx, repo)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// loop delivers due events until ctx is cancelled, starting with the ones a previous
+// run left behind. A standby leaves the outbox to the primary.
+func (o *outboxWorker) loop(ctx context.Context, repo *Repository) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		if o.enabled(repo) && !daemon.isStandby() {
+			runRecovered("outbox", func() error {
+				o.deliverDue(ctx, repo)
+				return nil
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue delivers the due events of every configured sink
+func (o *outboxWorker) deliverDue(ctx context.Context, repo *Repository) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, sink := range eventSinks {
+		if ctx.Err() != nil {
+			return
+		}
+		o.deliverSink(ctx, repo, sink)
+	}
+}
+
+// deliverSink publishes a sink's waiting events oldest first, and stops at the first one
+// that fails or isn't due yet, so the later ones never overtake it
+func (o *outboxWorker) deliverSink(ctx context.Context, repo *Repository, sink EventSink) {
+	for ctx.Err() == nil {
+		events, err := repo.OutboxEvents(ctx, sink.Name(), outboxBatchSize)
+		if err != nil {
+			slog.Error("Failed to query event outbox", "sink", sink.Name(), "error", err)
+			return
+		}
+		for _, oe := range events {
+			now := time.Now()
+			if ctx.Err() != nil || oe.NextAttemptAt.After(now) {
+				return
+			}
+			e, err := decodeOutboxEvent(oe.Payload)
+			if err == nil {
+				err = sink.Publish(e)
+			}
+			if err != nil {
+				oe.Attempts++
+				oe.Error = err.Error()
+				oe.NextAttemptAt = now.Add(outboxConfig.retryDelay(oe.Attempts))
+				slog.Warn("Event delivery will be retried", "type", oe.EventType, "sink", sink.Name(), "attempts", oe.Attempts,
+					"retry_at", oe.NextAttemptAt.Format(time.RFC3339), "error", err)
+				incCounter("tracker_event_deliveries_total", map[string]string{"result": "retry"}, 1)
+				if err := repo.UpdateOutboxEvent(ctx, oe); err != nil {
+					slog.Error("Failed to store outbox event", "id", oe.ID, "error", err)
+				}
+				return
+			}
+			incCounter("tracker_event_deliveries_total", map[string]string{"result": "delivered"}, 1)
+			if err := repo.DeleteOutboxEvent(ctx, oe.ID); err != nil {
+				// Left in place it would be sent again, and hold up the events after it
+				slog.Error("Failed to remove delivered outbox event", "id", oe.ID, "error", err)
+				return
+			}
+		}
+		if len(events) < outboxBatchSize {
+			return
+		}
+	}
+}
+
+// runOutboxCommand handles the outbox subcommands:
+//
+//	outbox list [--sink name] [--limit 50]
+//	outbox retry [--sink name]
+//	outbox purge (--sink name | --all)
+func runOutboxCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: outbox list|retry|purge")
+	}
+
+	fs := newFlagSet("outbox " + args[0])
+	sink := fs.String("sink", "", "Only the events of this sink, as listed (default: every sink)")
+	var limit *int
+	var all *bool
+	switch args[0] {
+	case "list":
+		limit = fs.Int("limit", 50, "Number of events to show, oldest first")
+	case "purge":
+		all = fs.Bool("all", false, "Drop the waiting events of every sink")
+	case "retry":
+	default:
+		return validationErrorf("unknown outbox subcommand %q (expected list, retry, or purge)", args[0])
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return withKind(KindValidation, err)
+	}
+
+	switch args[0] {
+	case "list":
+		if *limit < 1 {
+			return validationErrorf("invalid --limit %d", *limit)
+		}
+		events, err := repo.OutboxEvents(ctx, *sink, *limit)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			slog.Info("No events are waiting in the outbox")
+			return nil
+		}
+
+		fmt.Printf("\n%-6s %-20s %-20s %-8s %-20s %s\n", "ID", "Stored", "Type", "Attempts", "Next attempt", "Sink")
+		fmt.Println("------------------------------------------------------------------------------------------")
+		for _, e := range events {
+			fmt.Printf("%-6d %-20s %-20s %-8d %-20s %s\n", e.ID, e.CreatedAt.In(displayLocation).Format("2006-01-02 15:04:05"), e.EventType,
+				e.Attempts, e.NextAttemptAt.In(displayLocation).Format("2006-01-02 15:04:05"), e.Sink)
+			if e.Error != "" {
+				fmt.Printf("       %s\n", e.Error)
+			}
+		}
+		fmt.Println()
+
+	case "retry":
+		n, err := repo.RetryOutboxEvents(ctx, *sink)
+		if err != nil {
+			return err
+		}
+		slog.Info("Outbox events are due now; a running scheduler delivers them within seconds", "events", n)
+
+	case "purge":
+		if *sink == "" && !*all {
+			return validationErrorf("usage: outbox purge (--sink name | --all)")
+		}
+		n, err := repo.PurgeOutbox(ctx, *sink)
+		if err != nil {
+			return err
+		}
+		slog.Info("Dropped outbox events", "events", n)
+	}
+	return nil
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/binary" // Package for little-endian values and varints
+	"io"              // Package for output writers
+	"math"            // Package for rounding and double bit patterns
+	"slices"          // Package for collecting the sources of exported records
+	"time"            // Package for range boundaries
+)
+
+// Parquet files are written without a library: the format is column chunks of PLAIN
+// encoded values followed by a footer of Thrift compact-protocol structures, of which
+// the export needs only a handful of fields. Every column is REQUIRED, so pages carry
+// no definition or repetition levels, and pages are left uncompressed, which every
+// reader supports.
+
+// parquetMagic starts and ends every Parquet file
+const parquetMagic = "PAR1"
+
+// parquetRowGroupSize is how many records are buffered and written as one row group
+// A row group holds one page per column, so memory use stays bounded however long the
+// export runs.
+const parquetRowGroupSize = 100000
+
+// Parquet physical types, encodings, and other enums used by the export
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0 // FieldRepetitionType
+	parquetPlain    = 0 // Encoding of values
+	parquetRLE      = 3 // Encoding of the (absent) levels
+	parquetDataPage = 0 // PageType
+
+	parquetUTF8            = 0  // ConvertedType of strings
+	parquetTimestampMicros = 10 // ConvertedType of timestamps
+)
+
+// Thrift compact protocol field types
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftBuffer builds a Thrift compact-protocol message
+// Fields must be appended in increasing ID order within each struct, since their
+// headers store the delta from the previous field's ID.
+type thriftBuffer struct {
+	buf  []byte
+	last []int16 // ID of the previous field of each open struct, innermost last
+}
+
+// varint appends v as a base-128 varint
+func (b *thriftBuffer) varint(v uint64) {
+	b.buf = binary.AppendUvarint(b.buf, v)
+}
+
+// zigzag appends v as a zigzag varint, as Thrift encodes signed integers
+func (b *thriftBuffer) zigzag(v int64) {
+	b.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+// field appends the header of a field of the innermost struct
+func (b *thriftBuffer) field(id int16, typ byte) {
+	if len(b.last) == 0 {
+		b.last = append(b.last, 0)
+	}
+	last := &b.last[len(b.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		b.buf = append(b.buf, byte(delta)<<4|typ)
+	} else {
+		b.buf = append(b.buf, typ)
+		b.zigzag(int64(id))
+	}
+	*last = id
+}
+
+// i32 appends an i32 (or enum) field
+func (b *thriftBuffer) i32(id int16, v int32) {
+	b.field(id, thriftI32)
+	b.zigzag(int64(v))
+}
+
+// i64 appends an i64 field
+func (b *thriftBuffer) i64(id int16, v int64) {
+	b.field(id, thriftI64)
+	b.zigzag(v)
+}
+
+// bool appends a bool field, whose value is part of its header
+func (b *thriftBuffer) bool(id int16, v bool) {
+	typ := byte(thriftFalse)
+	if v {
+		typ = thriftTrue
+	}
+	b.field(id, typ)
+}
+
+// string appends a string field
+func (b *thriftBuffer) string(id int16, s string) {
+	b.field(id, thriftBinary)
+	b.varint(uint64(len(s)))
+	b.buf = append(b.buf, s...)
+}
+
+// list appends the header of a list field of n elements of type typ; the elements
+// follow, structs between begin and end without a field header of their own
+func (b *thriftBuffer) list(id int16, typ byte, n int) {
+	b.field(id, thriftList)
+	if n < 15 {
+		b.buf = append(b.buf, byte(n)<<4|typ)
+	} else {
+		b.buf = append(b.buf, 0xf0|typ)
+		b.varint(uint64(n))
+	}
+}
+
+// begin opens a struct field; the struct's fields follow until end
+func (b *thriftBuffer) begin(id int16) {
+	b.field(id, thriftStruct)
+	b.last = append(b.last, 0)
+}
+
+// beginElement opens a struct that is an element of a list
+func (b *thriftBuffer) beginElement() {
+	b.last = append(b.last, 0)
+}
+
+// end closes the innermost struct, or ends the message
+func (b *thriftBuffer) end() {
+	b.buf = append(b.buf, 0)
+	b.last = b.last[:len(b.last)-1]
+}
+
+// parquetColumn is one column of the export and the values buffered for its next chunk
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // ConvertedType; -1 for none
+	logical   func(b *thriftBuffer)
+	values    []byte // PLAIN encoded values of the current row group
+}
+
+// parquetChunk records where a written column chunk is, for the footer
+type parquetChunk struct {
+	offset int64 // Offset of its data page
+	size   int64 // Size of the page header and values
+	rows   int64
+}
+
+// parquetWriter writes records as a Parquet file, one row group at a time
+type parquetWriter struct {
+	w           io.Writer
+	offset      int64 // Bytes written so far
+	columns     []*parquetColumn
+	rows        int64 // Records buffered for the current row group
+	total       int64
+	groups      [][]parquetChunk
+	attribution string // Credit line stored in the footer's key-value metadata
+	precision   int
+	marketData  bool           // volume_24h and market_cap columns follow source
+	annotation  *parquetColumn // The annotation column; nil when the export has none
+}
+
+// newParquetWriter starts a Parquet file of price records with the columns id,
+// timestamp (microseconds, UTC), coin, currency, price, and source, followed by
+// volume_24h and market_cap with MARKET_DATA, and annotation when annotated
+func newParquetWriter(w io.Writer, precision int, annotated bool) (*parquetWriter, error) {
+	str := func(b *thriftBuffer) { b.begin(1); b.end() } // LogicalType STRING
+	pw := &parquetWriter{
+		w: w,
+		columns: []*parquetColumn{
+			{name: "id", typ: parquetInt64, converted: -1},
+			{name: "timestamp", typ: parquetInt64, converted: parquetTimestampMicros, logical: func(b *thriftBuffer) {
+				b.begin(8) // LogicalType TIMESTAMP
+				b.bool(1, true)
+				b.begin(2) // TimeUnit MICROS
+				b.begin(2)
+				b.end()
+				b.end()
+				b.end()
+			}},
+			{name: "coin", typ: parquetByteArray, converted: parquetUTF8, logical: str},
+			{name: "currency", typ: parquetByteArray, converted: parquetUTF8, logical: str},
+			{name: "price", typ: parquetDouble, converted: -1},
+			{name: "source", typ: parquetByteArray, converted: parquetUTF8, logical: str},
+		},
+		precision: precision,
+	}
+	if pw.marketData = marketDataEnabled; pw.marketData {
+		pw.columns = append(pw.columns,
+			&parquetColumn{name: "volume_24h", typ: parquetDouble, converted: -1},
+			&parquetColumn{name: "market_cap", typ: parquetDouble, converted: -1})
+	}
+	if annotated {
+		pw.annotation = &parquetColumn{name: "annotation", typ: parquetByteArray, converted: parquetUTF8, logical: str}
+		pw.columns = append(pw.columns, pw.annotation)
+	}
+	return pw, pw.write([]byte(parquetMagic))
+}
+
+// write writes p and counts it towards the offsets of the chunks
+func (pw *parquetWriter) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.offset += int64(n)
+	return err
+}
+
+// add buffers a record with its annotation label, writing the row group once it is full
+func (pw *parquetWriter) add(r PriceRecord, label string) error {
+	price := r.Price
+	if pw.precision != noPrecision {
+		scale := math.Pow10(pw.precision)
+		price = math.Round(price*scale) / scale
+	}
+	c := pw.columns
+	c[0].values = binary.LittleEndian.AppendUint64(c[0].values, uint64(r.ID))
+	c[1].values = binary.LittleEndian.AppendUint64(c[1].values, uint64(r.Timestamp.UnixMicro()))
+	c[2].values = appendParquetString(c[2].values, "bitcoin")
+	c[3].values = appendParquetString(c[3].values, r.Currency)
+	c[4].values = binary.LittleEndian.AppendUint64(c[4].values, math.Float64bits(price))
+	c[5].values = appendParquetString(c[5].values, r.Source)
+	if pw.marketData {
+		c[6].values = binary.LittleEndian.AppendUint64(c[6].values, math.Float64bits(r.Volume))
+		c[7].values = binary.LittleEndian.AppendUint64(c[7].values, math.Float64bits(r.MarketCap))
+	}
+	if pw.annotation != nil {
+		pw.annotation.values = appendParquetString(pw.annotation.values, label)
+	}
+
+	if pw.rows++; pw.rows >= parquetRowGroupSize {
+		return pw.flush()
+	}
+	return nil
+}
+
+// appendParquetString appends a PLAIN encoded BYTE_ARRAY: its length, then its bytes
+func appendParquetString(b []byte, s string) []byte {
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// flush writes the buffered records as a row group of one data page per column
+func (pw *parquetWriter) flush() error {
+	if pw.rows == 0 {
+		return nil
+	}
+	chunks := make([]parquetChunk, len(pw.columns))
+	for i, c := range pw.columns {
+		var h thriftBuffer
+		h.i32(1, parquetDataPage)
+		h.i32(2, int32(len(c.values)))
+		h.i32(3, int32(len(c.values)))
+		h.begin(5) // DataPageHeader
+		h.i32(1, int32(pw.rows))
+		h.i32(2, parquetPlain)
+		h.i32(3, parquetRLE)
+		h.i32(4, parquetRLE)
+		h.end()
+		h.end()
+
+		chunks[i] = parquetChunk{offset: pw.offset, size: int64(len(h.buf) + len(c.values)), rows: pw.rows}
+		if err := pw.write(h.buf); err != nil {
+			return err
+		}
+		if err := pw.write(c.values); err != nil {
+			return err
+		}
+		c.values = c.values[:0]
+	}
+	pw.groups = append(pw.groups, chunks)
+	pw.total += pw.rows
+	pw.rows = 0
+	return nil
+}
+
+// close writes the last row group and the footer describing the schema and chunks
+func (pw *parquetWriter) close() error {
+	if err := pw.flush(); err != nil {
+		return err
+	}
+
+	var b thriftBuffer
+	b.i32(1, 1) // version
+	b.list(2, thriftStruct, len(pw.columns)+1)
+	b.beginElement() // The root of the schema
+	b.string(4, "schema")
+	b.i32(5, int32(len(pw.columns)))
+	b.end()
+	for _, c := range pw.columns {
+		b.beginElement()
+		b.i32(1, c.typ)
+		b.i32(3, parquetRequired)
+		b.string(4, c.name)
+		if c.converted >= 0 {
+			b.i32(6, c.converted)
+		}
+		if c.logical != nil {
+			b.begin(10)
+			c.logical(&b)
+			b.end()
+		}
+		b.end()
+	}
+	b.i64(3, pw.total)
+
+	b.list(4, thriftStruct, len(pw.groups))
+	for _, chunks := range pw.groups {
+		var size int64
+		b.beginElement()
+		b.list(1, thriftStruct, len(chunks))
+		for i, chunk := range chunks {
+			c := pw.columns[i]
+			size += chunk.size
+			b.beginElement()
+			b.i64(2, chunk.offset)
+			b.begin(3) // ColumnMetaData
+			b.i32(1, c.typ)
+			b.list(2, thriftI32, 1)
+			b.zigzag(parquetPlain)
+			b.list(3, thriftBinary, 1)
+			b.varint(uint64(len(c.name)))
+			b.buf = append(b.buf, c.name...)
+			b.i32(4, 0) // UNCOMPRESSED
+			b.i64(5, chunk.rows)
+			b.i64(6, chunk.size)
+			b.i64(7, chunk.size)
+			b.i64(9, chunk.offset)
+			b.end()
+			b.end()
+		}
+		b.i64(2, size)
+		b.i64(3, chunks[0].rows)
+		b.end()
+	}
+
+	if pw.attribution != "" {
+		b.list(5, thriftStruct, 1)
+		b.beginElement()
+		b.string(1, "attribution")
+		b.string(2, pw.attribution)
+		b.end()
+	}
+	b.string(6, "bitcoin-tracker")
+	b.end()
+
+	if err := pw.write(b.buf); err != nil {
+		return err
+	}
+	if err := pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(b.buf)))); err != nil {
+		return err
+	}
+	return pw.write([]byte(parquetMagic))
+}
+
+// exportParquet writes records as a Parquet file with typed columns, prices rounded to
+// precision decimal places. The footer's key-value metadata credits the providers that
+// supplied them, unless ATTRIBUTION is off. An annotation column follows when the range
+// has annotations.
+func exportParquet(repo *Repository, w io.Writer, currency string, precision int, from, to time.Time, progress exportProgress) (int, error) {
+	labels, err := loadAnnotationLabels(repo, from, to)
+	if err != nil {
+		return 0, err
+	}
+	pw, err := newParquetWriter(w, precision, labels.any())
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var sources []string
+	err = forEachPrice(repo, currency, from, to, func(r PriceRecord) error {
+		count++
+		if !slices.Contains(sources, r.Source) {
+			sources = append(sources, r.Source)
+		}
+		if err := pw.add(r, labels.label(r)); err != nil || progress == nil {
+			return err
+		}
+		return progress(count)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	if text := attributionText(attributionsFor(sources)); attributionEnabled && count > 0 {
+		pw.attribution = text
+	}
+	return count, pw.close()
+}
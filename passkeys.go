@@ -0,0 +1,835 @@
+package main
+
+import (
+	"bytes"           // Package for comparing hashes and IDs
+	"crypto"          // Package for RSA hash identifiers
+	"crypto/ecdsa"    // Package for ES256 signatures
+	"crypto/ed25519"  // Package for EdDSA signatures
+	"crypto/elliptic" // Package for the P-256 curve
+	"crypto/rand"     // Package for challenges, invites, and session tokens
+	"crypto/rsa"      // Package for RS256 signatures
+	"crypto/sha256"   // Package for hashing client data, RP IDs, and tokens
+	"encoding/base64" // Package for WebAuthn's base64url fields
+	"encoding/binary" // Package for the signature counter
+	"encoding/json"   // Package for the WebAuthn request and response bodies
+	"errors"          // Package for verification errors
+	"fmt"             // Package for formatted I/O operations
+	"io"              // Package for limiting request bodies
+	"log/slog"        // Package for structured logging
+	"math/big"        // Package for RSA and EC key components
+	"net/http"        // Package for the passkey endpoints
+	"net/url"         // Package for validating origins
+	"os"              // Package for environment variables
+	"slices"          // Package for checking origins
+	"strconv"         // Package for parsing IDs
+	"strings"         // Package for string manipulation
+	"sync"            // Package for guarding challenges and sessions
+	"time"            // Package for expiry
+)
+
+// Passkey settings that are not configurable
+const (
+	passkeyChallengeTTL   = 5 * time.Minute      // How long a registration or sign-in ceremony may take
+	passkeyMaxChallenges  = 10000                // Ceremonies in progress at once; sign-in is open to anyone
+	passkeyCheckInterval  = time.Minute          // How often a session re-checks that its passkey still exists
+	passkeyInviteTTL      = 24 * time.Hour       // Default lifetime of an invite
+	passkeySessionCookie  = "tracker_session"    // Cookie holding the session token
+	passkeyRPName         = "Bitcoin Tracker"    // Name authenticators show for the tracker
+	passkeyInvitePrefix   = "bti_"               // Starts every invite code
+	passkeyMaxRequestBody = 1 << 16              // Largest WebAuthn request body accepted
+	passkeyUserIDSalt     = "bitcoin-tracker:v1" // Mixed into WebAuthn user handles
+)
+
+// COSE algorithms accepted for passkeys, in order of preference
+const (
+	coseES256 = -7   // ECDSA with P-256 and SHA-256
+	coseEdDSA = -8   // Ed25519
+	coseRS256 = -257 // RSASSA-PKCS1-v1_5 with SHA-256
+)
+
+// Authenticator data flags
+const (
+	authDataUserPresent  = 0x01
+	authDataUserVerified = 0x04
+	authDataAttested     = 0x40 // Attested credential data follows the counter
+)
+
+// Passkey is a WebAuthn credential that signs a user in to the dashboard
+type Passkey struct {
+	ID           int        `json:"id"`
+	User         string     `json:"user"`
+	Name         string     `json:"name"`          // What the passkey is on, e.g. "phone"
+	CredentialID string     `json:"credential_id"` // Base64url credential ID
+	PublicKey    []byte     `json:"-"`             // COSE public key
+	SignCount    uint32     `json:"sign_count"`    // Authenticator signature counter
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsed     *time.Time `json:"last_used,omitempty"`
+}
+
+// PasskeyConfig controls passkey sign-in to the dashboard
+type PasskeyConfig struct {
+	RPID       string        // Relying party ID: the dashboard's host name; empty disables passkeys
+	Origins    []string      // Origins the dashboard is served from, e.g. https://tracker.example.com
+	SessionTTL time.Duration // How long a sign-in lasts
+}
+
+// enabled reports whether passkeys are set up
+func (c PasskeyConfig) enabled() bool {
+	return c.RPID != ""
+}
+
+// passkeyConfig is the active configuration, loaded at startup
+var passkeyConfig = PasskeyConfig{SessionTTL: 12 * time.Hour}
+
+// loadPasskeyConfig reads PASSKEY_RP_ID, PASSKEY_ORIGINS (comma-separated, default
+// https://<PASSKEY_RP_ID>), and PASSKEY_SESSION_TTL (Go duration)
+func loadPasskeyConfig() (PasskeyConfig, error) {
+	c := PasskeyConfig{RPID: strings.ToLower(strings.TrimSpace(os.Getenv("PASSKEY_RP_ID"))), SessionTTL: 12 * time.Hour}
+	if v := os.Getenv("PASSKEY_SESSION_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid PASSKEY_SESSION_TTL %q", v)
+		}
+		c.SessionTTL = d
+	}
+	if !c.enabled() {
+		return c, nil
+	}
+	if strings.ContainsAny(c.RPID, ":/") {
+		return c, fmt.Errorf("invalid PASSKEY_RP_ID %q (expected a host name such as tracker.example.com)", c.RPID)
+	}
+
+	origins := os.Getenv("PASSKEY_ORIGINS")
+	if origins == "" {
+		origins = "https://" + c.RPID
+	}
+	for _, origin := range strings.Split(origins, ",") {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Path != "" {
+			return c, fmt.Errorf("invalid origin %q in PASSKEY_ORIGINS (expected e.g. https://tracker.example.com)", origin)
+		}
+		// Browsers only use an RP ID for pages on that host or its subdomains
+		if host := u.Hostname(); host != c.RPID && !strings.HasSuffix(host, "."+c.RPID) {
+			return c, fmt.Errorf("origin %q is not on PASSKEY_RP_ID %q", origin, c.RPID)
+		}
+		c.Origins = append(c.Origins, origin)
+	}
+	return c, nil
+}
+
+// randomToken returns 32 random bytes in base64url
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the stored or indexed form of a secret token
+func hashToken(token string) string {
+	return hashAPIKey(token)
+}
+
+// passkeyUserID returns the WebAuthn user handle of a user
+// It is stable, so registering again on the same device replaces the old passkey
+func passkeyUserID(user string) []byte {
+	sum := sha256.Sum256([]byte(passkeyUserIDSalt + ":" + user))
+	return sum[:16]
+}
+
+// passkeyChallenge is a registration or sign-in ceremony in progress
+type passkeyChallenge struct {
+	ceremony   string // "webauthn.create" or "webauthn.get", as in the client data
+	user       string // Registering user
+	inviteHash string // Invite being used to register
+	expires    time.Time
+}
+
+// passkeyChallenges holds the challenges handed out and not yet answered
+var passkeyChallenges = struct {
+	sync.Mutex
+	m map[string]passkeyChallenge
+}{m: map[string]passkeyChallenge{}}
+
+// errTooManyCeremonies refuses new ceremonies while too many are unanswered
+var errTooManyCeremonies = errors.New("too many passkey sign-ins in progress; try again shortly")
+
+// newPasskeyChallenge stores a ceremony and returns its random challenge
+func newPasskeyChallenge(c passkeyChallenge) (string, error) {
+	challenge, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	passkeyChallenges.Lock()
+	defer passkeyChallenges.Unlock()
+	now := time.Now()
+	if len(passkeyChallenges.m) >= passkeyMaxChallenges {
+		for k, v := range passkeyChallenges.m {
+			if now.After(v.expires) {
+				delete(passkeyChallenges.m, k)
+			}
+		}
+		if len(passkeyChallenges.m) >= passkeyMaxChallenges {
+			return "", errTooManyCeremonies
+		}
+	}
+	c.expires = now.Add(passkeyChallengeTTL)
+	passkeyChallenges.m[challenge] = c
+	return challenge, nil
+}
+
+// takePasskeyChallenge removes a challenge and returns its ceremony; each challenge
+// answers at most once
+func takePasskeyChallenge(challenge string) (passkeyChallenge, bool) {
+	passkeyChallenges.Lock()
+	defer passkeyChallenges.Unlock()
+	c, ok := passkeyChallenges.m[challenge]
+	delete(passkeyChallenges.m, challenge)
+	return c, ok && time.Now().Before(c.expires)
+}
+
+// passkeySession is a signed-in browser
+type passkeySession struct {
+	user         string
+	credentialID string // Passkey the user signed in with
+	expires      time.Time
+	checked      time.Time // When the passkey was last confirmed to exist
+}
+
+// passkeySessions holds the sessions of this process by hashed token
+// Sessions live in memory, so a restart signs everyone out.
+var passkeySessions = struct {
+	sync.Mutex
+	m map[string]*passkeySession
+}{m: map[string]*passkeySession{}}
+
+// startPasskeySession signs a browser in with a passkey
+func startPasskeySession(w http.ResponseWriter, r *http.Request, key Passkey) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	passkeySessions.Lock()
+	for k, s := range passkeySessions.m {
+		if now.After(s.expires) {
+			delete(passkeySessions.m, k)
+		}
+	}
+	passkeySessions.m[hashToken(token)] = &passkeySession{
+		user: key.User, credentialID: key.CredentialID, expires: now.Add(passkeyConfig.SessionTTL), checked: now,
+	}
+	passkeySessions.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeySessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(passkeyConfig.SessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(r.Header.Get("Origin"), "https://"),
+		SameSite: http.SameSiteStrictMode, // Other sites can't make requests with the session
+	})
+	return nil
+}
+
+// passkeySessionUser returns the user a request is signed in as
+// Sessions of deleted passkeys end within passkeyCheckInterval.
+func passkeySessionUser(repo *Repository, r *http.Request) (string, bool) {
+	if !passkeyConfig.enabled() {
+		return "", false
+	}
+	cookie, err := r.Cookie(passkeySessionCookie)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	hash := hashToken(cookie.Value)
+	now := time.Now()
+
+	passkeySessions.Lock()
+	s, ok := passkeySessions.m[hash]
+	if ok && now.After(s.expires) {
+		delete(passkeySessions.m, hash)
+		ok = false
+	}
+	var session passkeySession
+	check := false
+	if ok {
+		session = *s
+		if check = now.Sub(s.checked) >= passkeyCheckInterval; check {
+			s.checked = now
+		}
+	}
+	passkeySessions.Unlock()
+	if !ok {
+		return "", false
+	}
+
+	if check {
+		_, exists, err := repo.PasskeyByCredentialID(session.credentialID)
+		if err != nil {
+			slog.Warn("Failed to check the passkey of a session", "user", session.user, "error", err)
+		} else if !exists {
+			passkeySessions.Lock()
+			delete(passkeySessions.m, hash)
+			passkeySessions.Unlock()
+			return "", false
+		}
+	}
+	return session.user, true
+}
+
+// endPasskeySession signs a browser out
+func endPasskeySession(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(passkeySessionCookie); err == nil {
+		passkeySessions.Lock()
+		delete(passkeySessions.m, hashToken(cookie.Value))
+		passkeySessions.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: passkeySessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+}
+
+// clientData holds the fields of a ceremony's clientDataJSON that are checked
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData checks that the browser ran the expected ceremony on one of the
+// configured origins and answered a challenge handed out here, and returns the ceremony
+func verifyClientData(raw []byte, ceremony string) (passkeyChallenge, error) {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return passkeyChallenge{}, fmt.Errorf("invalid client data: %w", err)
+	}
+	if cd.Type != ceremony {
+		return passkeyChallenge{}, fmt.Errorf("unexpected ceremony %q", cd.Type)
+	}
+	if !slices.Contains(passkeyConfig.Origins, cd.Origin) || cd.CrossOrigin {
+		return passkeyChallenge{}, fmt.Errorf("origin %q is not in PASSKEY_ORIGINS", cd.Origin)
+	}
+	c, ok := takePasskeyChallenge(cd.Challenge)
+	if !ok || c.ceremony != ceremony {
+		return passkeyChallenge{}, errors.New("unknown or expired challenge")
+	}
+	return c, nil
+}
+
+// authenticatorData is the parsed authenticator data of a ceremony
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte // Only in registrations
+	publicKey    []byte // COSE key; only in registrations
+}
+
+// parseAuthenticatorData parses authenticator data and checks that it is for this
+// relying party and that the user was present and verified (PIN, biometrics)
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	var ad authenticatorData
+	if len(data) < 37 {
+		return ad, errors.New("authenticator data too short")
+	}
+	ad.rpIDHash, ad.flags, ad.signCount = data[:32], data[32], binary.BigEndian.Uint32(data[33:37])
+	rpIDHash := sha256.Sum256([]byte(passkeyConfig.RPID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return ad, errors.New("passkey is for another site")
+	}
+	if ad.flags&authDataUserPresent == 0 || ad.flags&authDataUserVerified == 0 {
+		return ad, errors.New("user was not verified by the authenticator")
+	}
+
+	if ad.flags&authDataAttested != 0 {
+		rest := data[37:]
+		if len(rest) < 18 {
+			return ad, errors.New("attested credential data too short")
+		}
+		size := int(binary.BigEndian.Uint16(rest[16:18])) // After the 16-byte AAGUID
+		rest = rest[18:]
+		if len(rest) < size {
+			return ad, errors.New("credential ID truncated")
+		}
+		ad.credentialID, rest = rest[:size], rest[size:]
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return ad, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		ad.publicKey = rest[:len(rest)-len(after)]
+	}
+	return ad, nil
+}
+
+// coseKeyParams returns the integer-keyed parameters of a COSE key
+func coseKeyParams(raw []byte) (map[int64]interface{}, error) {
+	v, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("COSE key is not a map")
+	}
+	params := make(map[int64]interface{}, len(m))
+	for k, v := range m {
+		if i, ok := k.(int64); ok {
+			params[i] = v
+		}
+	}
+	return params, nil
+}
+
+// coseBytes returns a byte-string parameter of a COSE key
+func coseBytes(params map[int64]interface{}, label int64) []byte {
+	b, _ := params[label].([]byte)
+	return b
+}
+
+// parseCOSEKey decodes a credential public key: ES256 (P-256), EdDSA (Ed25519), or RS256
+func parseCOSEKey(raw []byte) (int64, crypto.PublicKey, error) {
+	params, err := coseKeyParams(raw)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid COSE key: %w", err)
+	}
+	kty, _ := params[1].(int64)
+	alg, _ := params[3].(int64)
+	crv, _ := params[-1].(int64)
+
+	switch {
+	case alg == coseES256 && kty == 2 && crv == 1:
+		x, y := coseBytes(params, -2), coseBytes(params, -3)
+		if len(x) != 32 || len(y) != 32 {
+			return 0, nil, errors.New("invalid P-256 key coordinates")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return 0, nil, errors.New("P-256 key is not on the curve")
+		}
+		return alg, key, nil
+	case alg == coseEdDSA && kty == 1 && crv == 6:
+		x := coseBytes(params, -2)
+		if len(x) != ed25519.PublicKeySize {
+			return 0, nil, errors.New("invalid Ed25519 key")
+		}
+		return alg, ed25519.PublicKey(x), nil
+	case alg == coseRS256 && kty == 3:
+		n, e := coseBytes(params, -1), coseBytes(params, -2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, errors.New("invalid or short RSA key")
+		}
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported passkey algorithm %d (key type %d)", alg, kty)
+}
+
+// verifyPasskeySignature checks an assertion signature over the authenticator data
+// and the hash of the client data
+func verifyPasskeySignature(coseKey, authData, clientDataJSON, signature []byte) error {
+	alg, key, err := parseCOSEKey(coseKey)
+	if err != nil {
+		return err
+	}
+	clientHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientHash[:]...)
+	digest := sha256.Sum256(signed)
+
+	ok := false
+	switch alg {
+	case coseES256:
+		ok = ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], signature)
+	case coseEdDSA:
+		ok = ed25519.Verify(key.(ed25519.PublicKey), signed, signature)
+	case coseRS256:
+		ok = rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	}
+	if !ok {
+		return errors.New("invalid passkey signature")
+	}
+	return nil
+}
+
+// b64 is a byte slice sent as base64url, as WebAuthn's binary fields are
+type b64 []byte
+
+// MarshalJSON implements json.Marshaler
+func (b b64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting padded or unpadded base64url
+func (b *b64) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url: %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// passkeyCredential is a credential returned by navigator.credentials.create or get
+type passkeyCredential struct {
+	RawID    b64 `json:"rawId"`
+	Response struct {
+		ClientDataJSON    b64 `json:"clientDataJSON"`
+		AttestationObject b64 `json:"attestationObject"` // Registration
+		AuthenticatorData b64 `json:"authenticatorData"` // Sign-in
+		Signature         b64 `json:"signature"`         // Sign-in
+	} `json:"response"`
+}
+
+// credentialDescriptor names a passkey in ceremony options
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   b64    `json:"id"`
+}
+
+// decodePasskeyRequest decodes a WebAuthn request body into v
+func decodePasskeyRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, passkeyMaxRequestBody)).Decode(v); err != nil && err != io.EOF {
+		writeAPIError(w, http.StatusBadRequest, "invalid request: %v", err)
+		return false
+	}
+	return true
+}
+
+// handlePasskeys serves the passkey endpoints under /passkeys/:
+//
+//	POST /passkeys/register/begin   {"invite"} -> creation options
+//	POST /passkeys/register/finish  {"invite", "name", "credential"} -> signed in
+//	POST /passkeys/login/begin      -> request options
+//	POST /passkeys/login/finish     {"credential"} -> signed in
+//	POST /passkeys/logout
+//	GET  /passkeys/session          -> {"user"}, empty when signed out
+func (s *apiServer) handlePasskeys(w http.ResponseWriter, r *http.Request) {
+	if !passkeyConfig.enabled() {
+		writeAPIError(w, http.StatusNotFound, "passkeys are not enabled (set PASSKEY_RP_ID)")
+		return
+	}
+
+	switch r.URL.Path {
+	case "/passkeys/register/begin":
+		s.handlePasskeyRegisterBegin(w, r)
+	case "/passkeys/register/finish":
+		s.handlePasskeyRegisterFinish(w, r)
+	case "/passkeys/login/begin":
+		handlePasskeyLoginBegin(w, r)
+	case "/passkeys/login/finish":
+		s.handlePasskeyLoginFinish(w, r)
+	case "/passkeys/logout":
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		endPasskeySession(w, r)
+		writeJSON(w, http.StatusOK, map[string]string{"user": ""})
+	case "/passkeys/session":
+		user, _ := passkeySessionUser(s.repo, r)
+		writeJSON(w, http.StatusOK, map[string]string{"user": user})
+	default:
+		writeAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// handlePasskeyRegisterBegin starts registering a passkey with an invite
+func (s *apiServer) handlePasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Invite string `json:"invite"`
+	}
+	if !decodePasskeyRequest(w, r, &req) {
+		return
+	}
+	inviteHash := hashToken(strings.TrimSpace(req.Invite))
+	user, ok, err := s.repo.PasskeyInvite(inviteHash)
+	if err != nil {
+		slog.Error("Failed to look up passkey invite", "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to check invite")
+		return
+	}
+	if !ok {
+		incCounter("tracker_passkey_failures_total", map[string]string{"ceremony": "register"}, 1)
+		writeAPIError(w, http.StatusForbidden, "invalid, used, or expired invite")
+		return
+	}
+
+	challenge, err := newPasskeyChallenge(passkeyChallenge{ceremony: "webauthn.create", user: user, inviteHash: inviteHash})
+	if err != nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	// The user's other passkeys are excluded so the same authenticator isn't registered twice
+	exclude := []credentialDescriptor{}
+	keys, err := s.repo.Passkeys()
+	if err != nil {
+		slog.Error("Failed to list passkeys", "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to list passkeys")
+		return
+	}
+	for _, k := range keys {
+		if id, err := base64.RawURLEncoding.DecodeString(k.CredentialID); err == nil && k.User == user {
+			exclude = append(exclude, credentialDescriptor{Type: "public-key", ID: id})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"challenge": challenge,
+		"rp":        map[string]string{"id": passkeyConfig.RPID, "name": passkeyRPName},
+		"user":      map[string]interface{}{"id": b64(passkeyUserID(user)), "name": user, "displayName": user},
+		"pubKeyCredParams": []map[string]interface{}{
+			{"type": "public-key", "alg": coseES256},
+			{"type": "public-key", "alg": coseEdDSA},
+			{"type": "public-key", "alg": coseRS256},
+		},
+		"timeout":            passkeyChallengeTTL.Milliseconds(),
+		"attestation":        "none",
+		"excludeCredentials": exclude,
+		"authenticatorSelection": map[string]interface{}{
+			"residentKey": "required", "requireResidentKey": true, "userVerification": "required",
+		},
+	})
+}
+
+// handlePasskeyRegisterFinish verifies a new passkey, stores it, and signs the user in
+// Attestation is not requested ("none"), so any authenticator the user has is accepted.
+func (s *apiServer) handlePasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Invite     string            `json:"invite"`
+		Name       string            `json:"name"`
+		Credential passkeyCredential `json:"credential"`
+	}
+	if !decodePasskeyRequest(w, r, &req) {
+		return
+	}
+	fail := func(err error) {
+		incCounter("tracker_passkey_failures_total", map[string]string{"ceremony": "register"}, 1)
+		writeAPIError(w, http.StatusBadRequest, "passkey registration failed: %v", err)
+	}
+
+	c, err := verifyClientData(req.Credential.Response.ClientDataJSON, "webauthn.create")
+	if err != nil {
+		fail(err)
+		return
+	}
+	inviteHash := hashToken(strings.TrimSpace(req.Invite))
+	if c.inviteHash != inviteHash {
+		fail(errors.New("the challenge belongs to another invite"))
+		return
+	}
+
+	attestation, _, err := decodeCBOR(req.Credential.Response.AttestationObject)
+	if err != nil {
+		fail(fmt.Errorf("invalid attestation object: %w", err))
+		return
+	}
+	fields, _ := attestation.(map[interface{}]interface{})
+	authData, _ := fields["authData"].([]byte)
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if ad.publicKey == nil {
+		fail(errors.New("no credential in the authenticator data"))
+		return
+	}
+	if !bytes.Equal(ad.credentialID, req.Credential.RawID) {
+		fail(errors.New("credential ID mismatch"))
+		return
+	}
+	if _, _, err := parseCOSEKey(ad.publicKey); err != nil {
+		fail(err)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "passkey"
+	}
+	key := Passkey{
+		User: c.user, Name: name, CredentialID: base64.RawURLEncoding.EncodeToString(ad.credentialID),
+		PublicKey: ad.publicKey, SignCount: ad.signCount,
+	}
+	if key.ID, err = s.repo.SavePasskey(key, inviteHash); err != nil {
+		slog.Warn("Failed to save passkey", "user", key.User, "error", err)
+		writeAPIError(w, http.StatusConflict, "%v", err)
+		return
+	}
+	slog.Info("Registered passkey", "id", key.ID, "user", key.User, "name", key.Name)
+	if err := startPasskeySession(w, r, key); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"user": key.User})
+}
+
+// handlePasskeyLoginBegin starts a sign-in
+// No user name is asked for: the browser offers the passkeys it holds for this site.
+func handlePasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	if !decodePasskeyRequest(w, r, &struct{}{}) {
+		return
+	}
+	challenge, err := newPasskeyChallenge(passkeyChallenge{ceremony: "webauthn.get"})
+	if err != nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"challenge":        challenge,
+		"rpId":             passkeyConfig.RPID,
+		"timeout":          passkeyChallengeTTL.Milliseconds(),
+		"userVerification": "required",
+		"allowCredentials": []credentialDescriptor{},
+	})
+}
+
+// handlePasskeyLoginFinish verifies a sign-in and starts a session
+func (s *apiServer) handlePasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Credential passkeyCredential `json:"credential"`
+	}
+	if !decodePasskeyRequest(w, r, &req) {
+		return
+	}
+	fail := func(err error) {
+		incCounter("tracker_passkey_failures_total", map[string]string{"ceremony": "login"}, 1)
+		slog.Warn("Passkey sign-in failed", "error", err)
+		writeAPIError(w, http.StatusUnauthorized, "passkey sign-in failed: %v", err)
+	}
+	resp := req.Credential.Response
+
+	if _, err := verifyClientData(resp.ClientDataJSON, "webauthn.get"); err != nil {
+		fail(err)
+		return
+	}
+	key, ok, err := s.repo.PasskeyByCredentialID(base64.RawURLEncoding.EncodeToString(req.Credential.RawID))
+	if err != nil {
+		slog.Error("Failed to look up passkey", "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to check passkey")
+		return
+	}
+	if !ok {
+		fail(errors.New("unknown passkey"))
+		return
+	}
+	ad, err := parseAuthenticatorData(resp.AuthenticatorData)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if err := verifyPasskeySignature(key.PublicKey, resp.AuthenticatorData, resp.ClientDataJSON, resp.Signature); err != nil {
+		fail(err)
+		return
+	}
+	// Authenticators that count signatures must count up; a repeat means a cloned key
+	if (ad.signCount != 0 || key.SignCount != 0) && ad.signCount <= key.SignCount {
+		fail(fmt.Errorf("signature counter of passkey %d went backwards", key.ID))
+		return
+	}
+
+	if err := s.repo.UsePasskey(key.ID, ad.signCount); err != nil {
+		slog.Warn("Failed to record passkey use", "id", key.ID, "error", err)
+	}
+	if err := startPasskeySession(w, r, key); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	slog.Info("Signed in with passkey", "id", key.ID, "user", key.User)
+	writeJSON(w, http.StatusOK, map[string]string{"user": key.User})
+}
+
+// runPasskeyCommand handles the passkey subcommands:
+//
+//	passkey invite [--expires 24h] <user>
+//	passkey list
+//	passkey delete <id>
+func runPasskeyCommand(repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: passkey invite|list|delete")
+	}
+
+	switch args[0] {
+	case "invite":
+		// Options come before the user, e.g. "passkey invite --expires 1h alice"
+		fs := newFlagSet("passkey invite")
+		expires := fs.Duration("expires", passkeyInviteTTL, "How long the invite can be used")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if fs.NArg() != 1 || !dashboardUserPattern.MatchString(fs.Arg(0)) {
+			return validationErrorf("usage: passkey invite [--expires 24h] <user> (letters, digits, and . _ @ - only)")
+		}
+		if *expires <= 0 {
+			return validationErrorf("invalid --expires %s", *expires)
+		}
+
+		secret, err := randomToken()
+		if err != nil {
+			return err
+		}
+		code := passkeyInvitePrefix + secret
+		user := fs.Arg(0)
+		id, err := repo.SavePasskeyInvite(user, hashToken(code), time.Now().Add(*expires))
+		if err != nil {
+			return err
+		}
+		slog.Info("Created passkey invite", "id", id, "user", user, "expires_in", *expires)
+		if passkeyConfig.enabled() {
+			fmt.Println(passkeyConfig.Origins[0] + "/?invite=" + code)
+		} else {
+			fmt.Println(code)
+			slog.Warn("PASSKEY_RP_ID is not set, so the dashboard doesn't offer passkeys yet")
+		}
+		fmt.Fprintln(os.Stderr, "Send the link to the user; it registers one passkey and can't be shown again.")
+
+	case "list":
+		keys, err := repo.Passkeys()
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			slog.Info("No passkeys registered")
+			return nil
+		}
+
+		fmt.Printf("\n%-5s %-20s %-20s %-20s %-20s\n", "ID", "User", "Name", "Registered", "Last used")
+		fmt.Println("-------------------------------------------------------------------------------------")
+		for _, k := range keys {
+			lastUsed := "never"
+			if k.LastUsed != nil {
+				lastUsed = formatDisplayTime(*k.LastUsed)
+			}
+			fmt.Printf("%-5d %-20s %-20s %-20s %-20s\n", k.ID, k.User, k.Name, formatDisplayTime(k.CreatedAt), lastUsed)
+		}
+		fmt.Println()
+
+	case "delete":
+		if len(args) < 2 {
+			return validationErrorf("usage: passkey delete <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid passkey id %q", args[1])
+		}
+		if err := repo.DeletePasskey(id); err != nil {
+			return err
+		}
+		slog.Info("Deleted passkey; its sessions end within a minute", "id", id)
+
+	default:
+		return validationErrorf("unknown passkey command: %s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"  // Package for candle queries
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for candle body and shadow sizes
+	"strings"  // Package for string manipulation
+	"time"     // Package for candle completion checks
+)
+
+// Candlestick patterns recognised on completed candles
+const (
+	PatternDoji             = "doji"              // Open and close nearly equal: indecision
+	PatternHammer           = "hammer"            // Small body on top of a long lower shadow: possible bottom
+	PatternBullishEngulfing = "bullish_engulfing" // Rising body swallowing the previous falling one
+	PatternBearishEngulfing = "bearish_engulfing" // Falling body swallowing the previous rising one
+)
+
+// candlePatterns lists every pattern name accepted by pattern alert rules
+var candlePatterns = []string{PatternDoji, PatternHammer, PatternBullishEngulfing, PatternBearishEngulfing}
+
+// Event type emitted when a pattern is detected on a just-completed candle
+const EventCandlePattern = "candle.pattern"
+
+// CandlePattern is a pattern detected on one candle
+type CandlePattern struct {
+	Currency   string    `json:"currency"`   // Fiat currency the prices are quoted in
+	Resolution string    `json:"resolution"` // 1h or 1d
+	Start      time.Time `json:"start"`      // Start of the candle the pattern completes
+	Pattern    string    `json:"pattern"`    // One of the Pattern* constants
+	Direction  string    `json:"direction"`  // bullish, bearish, or neutral
+	Confidence float64   `json:"confidence"` // How textbook the shape is (0-1)
+	Close      float64   `json:"close"`      // Closing price of the candle
+}
+
+// isCandlePattern reports whether name is a known pattern
+func isCandlePattern(name string) bool {
+	for _, p := range candlePatterns {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// clamp limits v to [lo, hi]
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// detectPatterns returns the patterns completed by candle c, given the candle before it
+// prev may be nil for the first candle. Confidence grows the more pronounced the
+// defining feature is; shapes that barely qualify score around 0.5.
+func detectPatterns(prev *Candle, c Candle) []CandlePattern {
+	found := func(pattern, direction string, confidence float64) CandlePattern {
+		return CandlePattern{
+			Currency:   c.Currency,
+			Resolution: c.Resolution,
+			Start:      c.Start,
+			Pattern:    pattern,
+			Direction:  direction,
+			Confidence: math.Round(confidence*100) / 100,
+			Close:      c.Close,
+		}
+	}
+
+	// A candle built from a single sample has no shape to speak of
+	rng := c.High - c.Low
+	if c.Samples < 2 || rng <= 0 {
+		return nil
+	}
+
+	var patterns []CandlePattern
+	body := math.Abs(c.Close - c.Open)
+	upper := c.High - math.Max(c.Open, c.Close)
+	lower := math.Min(c.Open, c.Close) - c.Low
+
+	// Doji: the body is at most 10% of the range; a flat body is a perfect doji
+	if body <= 0.1*rng {
+		patterns = append(patterns, found(PatternDoji, "neutral", 1-0.5*body/(0.1*rng)))
+	} else if lower >= 2*body && upper <= 0.5*body {
+		// Hammer: lower shadow at least twice the body and little upper shadow.
+		// It only means something after a decline, so it scores lower without one.
+		confidence := clamp(0.5+0.1*(lower/body-2), 0.5, 1)
+		if prev == nil || prev.Close >= prev.Open {
+			confidence *= 0.7
+		}
+		patterns = append(patterns, found(PatternHammer, "bullish", confidence))
+	}
+
+	// Engulfing: this body opposes the previous one and covers it completely
+	if prev != nil {
+		prevBody := math.Abs(prev.Close - prev.Open)
+		if prevBody > 0 && body > prevBody {
+			confidence := clamp(0.5+0.5*(body/prevBody-1), 0.5, 1)
+			switch {
+			case prev.Close < prev.Open && c.Close > c.Open && c.Open <= prev.Close && c.Close >= prev.Open:
+				patterns = append(patterns, found(PatternBullishEngulfing, "bullish", confidence))
+			case prev.Close > prev.Open && c.Close < c.Open && c.Open >= prev.Close && c.Close <= prev.Open:
+				patterns = append(patterns, found(PatternBearishEngulfing, "bearish", confidence))
+			}
+		}
+	}
+	return patterns
+}
+
+// refreshPatterns runs detection over candles starting at or after from, plus the
+// candle before them for context. Only completed candles are considered. Patterns on
+// candles that completed within the last bucket are new and are published and routed
+// to pattern alert rules; older ones (e.g. from a first rollup over history) are
+// stored silently.
+func refreshPatterns(repo *Repository, currency, resolution string, from time.Time) error {
+	width := candleDuration(resolution)
+	now := time.Now()
+	from = from.Add(-width)
+
+	var prev *Candle
+	for {
+		candles, err := repo.Candles(context.Background(), currency, resolution, from, time.Time{}, maxRangeLimit)
+		if err != nil {
+			return err
+		}
+
+		for i := range candles {
+			c := candles[i]
+			end := c.Start.Add(width)
+			if end.After(now) {
+				return nil // Still in progress
+			}
+
+			// Patterns spanning two candles need them to be adjacent
+			if prev != nil && !prev.Start.Add(width).Equal(c.Start) {
+				prev = nil
+			}
+
+			for _, p := range detectPatterns(prev, c) {
+				isNew, err := repo.SaveCandlePattern(p)
+				if err != nil {
+					return err
+				}
+				if !isNew || now.Sub(end) > width {
+					continue
+				}
+
+				slog.Info("Detected candlestick pattern", "pattern", p.Pattern, "currency", p.Currency,
+					"resolution", p.Resolution, "start", p.Start, "confidence", p.Confidence, "price", p.Close)
+				publishEvent(repo, newEvent(EventCandlePattern, "bitcoin/"+p.Currency, p))
+				incCounter("tracker_candle_patterns_total", map[string]string{"pattern": p.Pattern, "resolution": p.Resolution}, 1)
+				routePatternAlerts(repo, p)
+			}
+			prev = &c
+		}
+
+		if len(candles) < maxRangeLimit {
+			return nil
+		}
+		from = candles[len(candles)-1].Start.Add(width)
+	}
+}
+
+// routePatternAlerts fires every pattern rule matching a newly detected pattern
+// Pattern rules have no lasting condition, so unlike price rules they fire on each
+// matching detection, subject only to their cooldown.
+func routePatternAlerts(repo *Repository, p CandlePattern) {
+	rules, err := repo.AlertRules(allTenants)
+	if err != nil {
+		slog.Error("Failed to load alert rules for pattern", "error", err)
+		alertEngine.setError(err)
+		return
+	}
+
+	now := time.Now()
+	stats := make(alertStatsBatch)
+	defer stats.save(repo)
+	for _, rule := range rules {
+		if rule.Kind != AlertPattern || rule.Currency != p.Currency || rule.paused(now) {
+			continue
+		}
+		stats.evaluated(rule, now, nil)
+		if p.Confidence < rule.Threshold {
+			continue
+		}
+		if rule.Pattern != "" && rule.Pattern != p.Pattern {
+			continue
+		}
+		if rule.Regime != "" && currentVolatilityRegime(repo, rule.Currency) != rule.Regime {
+			continue
+		}
+		if rule.inCooldown(now) {
+			slog.Info("Alert matched within its cooldown, notification suppressed", "rule", rule.ID, "pattern", p.Pattern)
+			stats.triggered(rule, now, false)
+			continue
+		}
+
+		if err := repo.SetAlertTriggered(rule.ID, false, true); err != nil {
+			slog.Error("Failed to store alert state", "rule", rule.ID, "error", err)
+			continue
+		}
+		stats.triggered(rule, now, true)
+		pattern := p
+		fireAlert(repo, Alert{Rule: rule, Price: p.Close, Pattern: &pattern, Time: now.UTC()})
+	}
+}
+
+// displayPatterns prints patterns detected over the last 30 days for a currency
+// An empty resolution shows every resolution
+func displayPatterns(repo *Repository, currency, resolution string) {
+	patterns, err := repo.CandlePatterns(currency, resolution, time.Now().AddDate(0, 0, -30), maxRangeLimit)
+	if err != nil {
+		slog.Error("Failed to fetch candle patterns", "error", err)
+		return
+	}
+	if len(patterns) == 0 {
+		slog.Info("No candlestick patterns detected in the last 30 days")
+		return
+	}
+
+	fmt.Printf("\nCandlestick patterns (%s, last 30 days)\n", strings.ToUpper(currency))
+	fmt.Printf("%-17s %-4s %-18s %-9s %-10s %-12s\n", "Candle", "Res", "Pattern", "Direction", "Confidence", "Close")
+	fmt.Println("----------------------------------------------------------------------------")
+	for _, p := range patterns {
+		fmt.Printf("%-17s %-4s %-18s %-9s %-10.2f %-12.2f\n",
+			p.Start.In(displayLocation).Format("2006-01-02 15:04"), p.Resolution, p.Pattern, p.Direction, p.Confidence, p.Close)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"  // Package for collecting within the collectors job's deadline
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for absolute deviations
+	"os"       // Package for environment variables
+	"slices"   // Package for ordering stablecoins
+	"strconv"  // Package for parsing PEG_THRESHOLD and PEG_SAMPLES
+	"strings"  // Package for parsing STABLECOINS
+	"time"     // Package for alert timestamps
+)
+
+// Stablecoins are meant to trade at one US dollar. The "stablecoins" collector records
+// the USD price of each coin of STABLECOINS on every run, and a coin that stays more
+// than PEG_THRESHOLD percent off $1.00 for PEG_SAMPLES runs in a row fires a peg alert
+// through the notifiers; a second one follows when it is back within the threshold.
+// The streak is read back from the stored samples, so it survives restarts.
+
+// AlertPeg alerts fire when a stablecoin loses or regains its peg
+// They come from the stablecoins collector rather than from stored rules.
+const AlertPeg = "peg"
+
+// knownStablecoins maps the tickers STABLECOINS accepts to their CoinGecko coin IDs
+var knownStablecoins = map[string]string{
+	"usdt":  "tether",
+	"usdc":  "usd-coin",
+	"dai":   "dai",
+	"fdusd": "first-digital-usd",
+	"pyusd": "paypal-usd",
+	"tusd":  "true-usd",
+}
+
+// PegConfig lists the stablecoins the stablecoins collector watches and when they
+// count as off their peg
+type PegConfig struct {
+	Coins        []string // Tickers from STABLECOINS, e.g. "usdt"
+	ThresholdPct float64  // Distance from $1.00 in percent beyond which a sample is off the peg
+	Samples      int      // Consecutive samples off the peg before the alert fires
+}
+
+// pegConfig is the active configuration, loaded at startup
+var pegConfig = PegConfig{Coins: []string{"usdt", "usdc", "dai"}, ThresholdPct: 0.5, Samples: 3}
+
+// off reports whether a price is further from $1.00 than the threshold
+func (c PegConfig) off(price float64) bool {
+	return math.Abs(pegDeviation(price)) > c.ThresholdPct
+}
+
+// pegDeviation is a price's distance from $1.00 in percent, negative below it
+func pegDeviation(price float64) float64 {
+	return math.Round((price-1)*100*10000) / 10000
+}
+
+// stablecoinTickers returns the tickers of knownStablecoins in order
+func stablecoinTickers() []string {
+	tickers := make([]string, 0, len(knownStablecoins))
+	for ticker := range knownStablecoins {
+		tickers = append(tickers, ticker)
+	}
+	slices.Sort(tickers)
+	return tickers
+}
+
+// loadPegConfig reads STABLECOINS (e.g. "usdt,usdc,dai"), PEG_THRESHOLD (percent), and
+// PEG_SAMPLES
+func loadPegConfig() (PegConfig, error) {
+	c := PegConfig{ThresholdPct: 0.5, Samples: 3}
+	v := os.Getenv("STABLECOINS")
+	if v == "" {
+		v = "usdt,usdc,dai"
+	}
+	for _, ticker := range strings.Split(v, ",") {
+		ticker = strings.ToLower(strings.TrimSpace(ticker))
+		if ticker == "" || slices.Contains(c.Coins, ticker) {
+			continue
+		}
+		if _, ok := knownStablecoins[ticker]; !ok {
+			return c, fmt.Errorf("unknown stablecoin %q in STABLECOINS (expected %s)", ticker, strings.Join(stablecoinTickers(), ", "))
+		}
+		c.Coins = append(c.Coins, ticker)
+	}
+	if len(c.Coins) == 0 {
+		return c, fmt.Errorf("STABLECOINS lists no stablecoins")
+	}
+	if v := os.Getenv("PEG_THRESHOLD"); v != "" {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if err != nil || pct <= 0 {
+			return c, fmt.Errorf("invalid PEG_THRESHOLD %q (expected a percentage, e.g. 0.5)", v)
+		}
+		c.ThresholdPct = pct
+	}
+	if v := os.Getenv("PEG_SAMPLES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c, fmt.Errorf("invalid PEG_SAMPLES %q (expected a positive number)", v)
+		}
+		c.Samples = n
+	}
+	return c, nil
+}
+
+// stablecoinCollector records the USD prices of the stablecoins of STABLECOINS
+type stablecoinCollector struct{}
+
+// Name implements Collector
+func (stablecoinCollector) Name() string { return "stablecoins" }
+
+// Source implements Collector
+func (stablecoinCollector) Source() string { return "coingecko" }
+
+// Metrics implements Collector
+// Every known stablecoin has a metric, so the history of one dropped from STABLECOINS
+// stays browsable; only the configured ones are collected.
+func (stablecoinCollector) Metrics() []CollectorMetric {
+	tickers := stablecoinTickers()
+	metrics := make([]CollectorMetric, len(tickers))
+	for i, ticker := range tickers {
+		metrics[i] = CollectorMetric{Name: ticker + "_usd", Unit: "USD", About: strings.ToUpper(ticker) + " price in US dollars"}
+	}
+	return metrics
+}
+
+// Collect implements Collector, and checks every price it got against the peg
+func (stablecoinCollector) Collect(ctx context.Context, repo *Repository) (map[string]float64, error) {
+	ids := make([]string, len(pegConfig.Coins))
+	for i, ticker := range pegConfig.Coins {
+		ids[i] = knownStablecoins[ticker]
+	}
+
+	prices, err := fetchCoinPrices(ctx, repo, "stablecoins", ids, "usd", "&precision=6")
+	if err != nil {
+		return nil, err
+	}
+
+	// The coins that were priced are stored and checked even when others are missing
+	values := make(map[string]float64, len(ids))
+	now := time.Now().UTC()
+	for i, ticker := range pegConfig.Coins {
+		price, ok := prices.Prices[ids[i]]
+		if !ok {
+			continue
+		}
+		values[ticker+"_usd"] = price
+		checkPeg(ctx, repo, ticker, price, now)
+	}
+	return values, prices.err()
+}
+
+// checkPeg compares a new price of a stablecoin with its stored samples, and fires a
+// peg alert when it completes a streak of PEG_SAMPLES samples off the peg, or ends one
+func checkPeg(ctx context.Context, repo *Repository, ticker string, price float64, now time.Time) {
+	deviation := pegDeviation(price)
+	setGauge("tracker_stablecoin_deviation_percent", map[string]string{"coin": ticker}, deviation)
+
+	// The streak before this sample, counted up to the length that fires
+	previous, _, err := repo.SearchCollectorSamples(ctx, ticker+"_usd", 0, pegConfig.Samples)
+	if err != nil {
+		slog.Error("Failed to load stablecoin samples", "coin", ticker, "error", err)
+		return
+	}
+	streak := 0
+	for _, s := range previous {
+		if !pegConfig.off(s.Value) {
+			break
+		}
+		streak++
+	}
+
+	off := pegConfig.off(price)
+	if off {
+		slog.Warn("Stablecoin is off its peg", "coin", ticker, "price", price, "deviation_pct", deviation, "samples", streak+1)
+	}
+	if (off && streak == pegConfig.Samples-1) || (!off && streak >= pegConfig.Samples) {
+		fireAlert(repo, Alert{
+			Rule:       AlertRule{Kind: AlertPeg, Threshold: pegConfig.ThresholdPct, Currency: "usd"},
+			Price:      price,
+			Change:     deviation,
+			Stablecoin: ticker,
+			Time:       now,
+		})
+	}
+}
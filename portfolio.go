@@ -0,0 +1,756 @@
+package main
+
+import (
+	"context"  // Package for the fetch deadline
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"net/http" // Package for the HTTP API
+	"os"       // Package for environment variables
+	"slices"   // Package for sorting asset lists and listing tenants
+	"strconv"  // Package for parsing CLI and query arguments
+	"strings"  // Package for string manipulation
+	"time"     // Package for acquisition dates and snapshots
+)
+
+// defaultPortfolioHistory is how far back GET /portfolio/history and "portfolio history" look
+const defaultPortfolioHistory = 30 * 24 * time.Hour
+
+// Holding is a quantity of an asset bought at a known total cost, e.g. 0.5 BTC for 14,200 USD
+type Holding struct {
+	ID       int       `json:"id"`               // Primary key (auto-increment)
+	Asset    string    `json:"asset"`            // Asset ID, e.g. "bitcoin"
+	Quantity float64   `json:"quantity"`         // Units held
+	Cost     float64   `json:"cost"`             // Total paid for the lot; 0 when unknown
+	Currency string    `json:"currency"`         // Fiat currency of the cost
+	Acquired time.Time `json:"acquired"`         // Date the lot was bought
+	Tenant   string    `json:"tenant,omitempty"` // Tenant the holding belongs to
+}
+
+// Disposal is part of a holding that was sold
+// Sales are matched against holdings first in, first out, so one sale may consume
+// several holdings and leave one of them partly sold. Disposals of trades (see
+// matchTrades) are matched the same way but not stored.
+type Disposal struct {
+	ID        int       `json:"id"`               // Primary key (auto-increment)
+	HoldingID int       `json:"holding_id"`       // Holding the units came from
+	Asset     string    `json:"asset"`            // Asset ID, e.g. "bitcoin"
+	Quantity  float64   `json:"quantity"`         // Units sold
+	Cost      float64   `json:"cost"`             // Share of the holding's cost; 0 when unknown
+	Proceeds  float64   `json:"proceeds"`         // Share of the sale's proceeds
+	Currency  string    `json:"currency"`         // Fiat currency of cost and proceeds
+	Acquired  time.Time `json:"acquired"`         // Date the holding was bought
+	Disposed  time.Time `json:"disposed"`         // Date the units were sold
+	Tenant    string    `json:"tenant,omitempty"` // Tenant of the holding
+}
+
+// HoldingValue is a holding valued at the latest price
+// Gain is nil when the cost is unknown or in another currency than the valuation
+type HoldingValue struct {
+	Holding
+	Price    float64   `json:"price"`              // Latest price of one unit
+	PricedAt time.Time `json:"priced_at"`          // When that price was recorded or fetched
+	Value    float64   `json:"value"`              // Quantity times price
+	Gain     *float64  `json:"gain,omitempty"`     // Value minus cost
+	GainPct  *float64  `json:"gain_pct,omitempty"` // Gain as a percentage of cost
+}
+
+// PortfolioValuation is every holding valued in one currency
+// Cost and Gain only cover holdings whose cost is known in that currency
+type PortfolioValuation struct {
+	Currency string         `json:"currency"`
+	Holdings []HoldingValue `json:"holdings"`
+	Value    float64        `json:"value"`    // Value of every holding
+	Cost     float64        `json:"cost"`     // Cost of the holdings with a known cost
+	Gain     float64        `json:"gain"`     // Value of those holdings minus Cost
+	GainPct  float64        `json:"gain_pct"` // Gain as a percentage of Cost
+	ValuedAt time.Time      `json:"valued_at"`
+}
+
+// PortfolioSnapshot is a stored portfolio valuation
+type PortfolioSnapshot struct {
+	Currency  string    `json:"currency"`
+	Value     float64   `json:"value"`
+	Cost      float64   `json:"cost"`
+	Gain      float64   `json:"gain"`
+	Timestamp time.Time `json:"timestamp"`
+	Tenant    string    `json:"tenant,omitempty"`
+}
+
+// PortfolioConfig controls how the portfolio is valued and snapshotted
+type PortfolioConfig struct {
+	Currency         string        // Valuation currency; defaults to the first of CURRENCIES
+	SnapshotInterval time.Duration // How often the scheduler records a snapshot; 0 disables
+}
+
+// portfolioConfig holds the active portfolio settings, loaded at startup
+var portfolioConfig PortfolioConfig
+
+// loadPortfolioConfig reads PORTFOLIO_CURRENCY and PORTFOLIO_SNAPSHOT_INTERVAL
+func loadPortfolioConfig() (PortfolioConfig, error) {
+	cfg := PortfolioConfig{Currency: currencies[0], SnapshotInterval: time.Hour}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("PORTFOLIO_CURRENCY"))); v != "" {
+		cfg.Currency = v
+	}
+	switch v := os.Getenv("PORTFOLIO_SNAPSHOT_INTERVAL"); v {
+	case "":
+	case "0":
+		cfg.SnapshotInterval = 0
+	default:
+		d, err := parseStatsWindow(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid PORTFOLIO_SNAPSHOT_INTERVAL %q", v)
+		}
+		cfg.SnapshotInterval = d
+	}
+	return cfg, nil
+}
+
+// parseAsset accepts an asset ID ("bitcoin") or its ticker ("BTC")
+func parseAsset(v string) (string, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if _, ok := tickerSymbol[v]; ok {
+		return v, nil
+	}
+	var supported []string
+	for asset, ticker := range tickerSymbol {
+		if strings.ToLower(ticker) == v {
+			return asset, nil
+		}
+		supported = append(supported, asset)
+	}
+	slices.Sort(supported)
+	return "", fmt.Errorf("unknown asset %q (supported: %s)", v, strings.Join(supported, ", "))
+}
+
+// latestAssetPrice returns the newest price of one unit of asset in currency
+// Bitcoin prices the tracker records are read from the database; other assets and
+// currencies the tracker doesn't record are fetched from the price sources
+func latestAssetPrice(ctx context.Context, repo *Repository, asset, currency string) (float64, time.Time, error) {
+	if asset == "bitcoin" && slices.Contains(currencies, currency) {
+		prices, err := repo.LatestPrices(ctx, 1, currency)
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		if len(prices) > 0 {
+			return prices[0].Price, prices[0].Timestamp, nil
+		}
+	}
+
+	if err := checkBudget(repo, asset); err != nil {
+		return 0, time.Time{}, err
+	}
+	ctx, cancel := withFetchDeadline(ctx)
+	defer cancel()
+	prices, _, _, err := fetchFromSources(ctx, repo, asset, []string{currency})
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to fetch %s price: %w", asset, err)
+	}
+	return prices[currency], time.Now(), nil
+}
+
+// valuePortfolio values every holding of a tenant at the latest price in currency
+func valuePortfolio(ctx context.Context, repo *Repository, tenant, currency string) (PortfolioValuation, error) {
+	currency = strings.ToLower(currency)
+	v := PortfolioValuation{Currency: currency, Holdings: []HoldingValue{}, ValuedAt: time.Now()}
+
+	holdings, err := repo.Holdings(tenant)
+	if err != nil {
+		return v, err
+	}
+
+	type quote struct {
+		price float64
+		at    time.Time
+	}
+	quotes := make(map[string]quote)
+	var costedValue float64
+	for _, h := range holdings {
+		q, ok := quotes[h.Asset]
+		if !ok {
+			price, at, err := latestAssetPrice(ctx, repo, h.Asset, currency)
+			if err != nil {
+				return v, err
+			}
+			q = quote{price, at}
+			quotes[h.Asset] = q
+		}
+
+		hv := HoldingValue{Holding: h, Price: q.price, PricedAt: q.at, Value: h.Quantity * q.price}
+		if h.Cost > 0 && h.Currency == currency {
+			gain := hv.Value - h.Cost
+			gainPct := percentChange(h.Cost, hv.Value)
+			hv.Gain, hv.GainPct = &gain, &gainPct
+			v.Cost += h.Cost
+			costedValue += hv.Value
+		}
+		v.Value += hv.Value
+		v.Holdings = append(v.Holdings, hv)
+	}
+	v.Gain = costedValue - v.Cost
+	v.GainPct = percentChange(v.Cost, costedValue)
+	return v, nil
+}
+
+// Portfolio metrics that portfolio alert rules watch
+const (
+	MetricValue   = "value"    // Market value
+	MetricGain    = "gain"     // Value minus cost, over holdings with a known cost
+	MetricGainPct = "gain_pct" // Gain as a percentage of cost
+)
+
+// portfolioMetricAliases map the words accepted in conditions to metrics
+var portfolioMetricAliases = map[string]string{
+	"value": MetricValue, "worth": MetricValue,
+	"gain": MetricGain, "pnl": MetricGain,
+	"gain_pct": MetricGainPct, "gain%": MetricGainPct, "pnl%": MetricGainPct,
+}
+
+// PortfolioCondition is the condition of a portfolio alert rule
+// It is stored as text, e.g. "value>50000", "bitcoin:gain_pct>25", or "#3:gain<-1000"
+type PortfolioCondition struct {
+	Position  string  // "" for the whole portfolio, an asset ID, or "#ID" for one holding
+	Metric    string  // MetricValue, MetricGain, or MetricGainPct
+	Op        string  // ">" or "<"
+	Threshold float64 // In the rule's currency, or percent for MetricGainPct
+}
+
+// String returns the condition in its stored form
+func (c PortfolioCondition) String() string {
+	s := c.Metric + c.Op + strconv.FormatFloat(c.Threshold, 'f', -1, 64)
+	if c.Position != "" {
+		s = c.Position + ":" + s
+	}
+	return s
+}
+
+// Target names what the condition watches, e.g. "portfolio", "bitcoin", or "holding #3"
+func (c PortfolioCondition) Target() string {
+	switch {
+	case c.Position == "":
+		return "portfolio"
+	case strings.HasPrefix(c.Position, "#"):
+		return "holding " + c.Position
+	}
+	return c.Position
+}
+
+// parsePortfolioCondition parses "value>50000", "worth>50k", "btc:pnl%<-10", or
+// "#3:gain>1000"; thresholds accept thousands separators and a k or m suffix
+func parsePortfolioCondition(s string) (PortfolioCondition, error) {
+	s = strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	var c PortfolioCondition
+	if position, rest, ok := strings.Cut(s, ":"); ok {
+		if id, isHolding := strings.CutPrefix(position, "#"); isHolding {
+			if n, err := strconv.Atoi(id); err != nil || n < 1 {
+				return c, fmt.Errorf("invalid holding %q (expected e.g. #3)", position)
+			}
+			c.Position = position
+		} else {
+			asset, err := parseAsset(position)
+			if err != nil {
+				return c, err
+			}
+			c.Position = asset
+		}
+		s = rest
+	}
+
+	i := strings.IndexAny(s, "<>")
+	if i <= 0 || i == len(s)-1 {
+		return c, fmt.Errorf("invalid portfolio condition %q (expected e.g. value>50000, bitcoin:gain_pct>25, or #3:gain<-1000)", s)
+	}
+	metric, ok := portfolioMetricAliases[s[:i]]
+	if !ok {
+		return c, fmt.Errorf("unknown portfolio metric %q (expected value, gain, or gain_pct)", s[:i])
+	}
+	c.Metric, c.Op = metric, s[i:i+1]
+
+	number, multiplier := strings.ReplaceAll(s[i+1:], ",", ""), 1.0
+	if n, ok := strings.CutSuffix(number, "k"); ok {
+		number, multiplier = n, 1e3
+	} else if n, ok := strings.CutSuffix(number, "m"); ok {
+		number, multiplier = n, 1e6
+	}
+	threshold, err := strconv.ParseFloat(strings.TrimSuffix(number, "%"), 64)
+	if err != nil {
+		return c, fmt.Errorf("invalid threshold %q", s[i+1:])
+	}
+	c.Threshold = threshold * multiplier
+	return c, nil
+}
+
+// portfolioMetric returns a metric of the whole valuation or of one position (every lot
+// of an asset, or a single holding). ok is false when the position holds nothing or, for
+// gain metrics, when none of its cost is known in the valuation currency.
+func portfolioMetric(v PortfolioValuation, c PortfolioCondition) (float64, bool, error) {
+	if len(v.Holdings) == 0 {
+		return 0, false, nil
+	}
+	value, cost, costedValue, costed := v.Value, v.Cost, v.Cost+v.Gain, v.Cost > 0
+	if c.Position != "" {
+		value, cost, costedValue, costed = 0, 0, 0, false
+		found := false
+		for _, h := range v.Holdings {
+			if c.Position != h.Asset && c.Position != "#"+strconv.Itoa(h.ID) {
+				continue
+			}
+			found = true
+			value += h.Value
+			if h.Gain != nil {
+				cost += h.Cost
+				costedValue += h.Value
+				costed = true
+			}
+		}
+		if !found {
+			if strings.HasPrefix(c.Position, "#") {
+				return 0, false, fmt.Errorf("no holding %s", c.Position)
+			}
+			return 0, false, nil
+		}
+	}
+
+	switch c.Metric {
+	case MetricValue:
+		return value, true, nil
+	case MetricGain:
+		return costedValue - cost, costed, nil
+	default:
+		return percentChange(cost, costedValue), costed, nil
+	}
+}
+
+// snapshotPortfolio values a tenant's portfolio in the configured currency and stores
+// the result. Nothing is stored while the tenant has no holdings
+func snapshotPortfolio(ctx context.Context, repo *Repository, tenant string) (PortfolioValuation, bool, error) {
+	v, err := valuePortfolio(ctx, repo, tenant, portfolioConfig.Currency)
+	if err != nil || len(v.Holdings) == 0 {
+		return v, false, err
+	}
+	snap := PortfolioSnapshot{Currency: v.Currency, Value: v.Value, Cost: v.Cost, Gain: v.Gain, Tenant: tenant}
+	if err := repo.SavePortfolioSnapshot(snap); err != nil {
+		return v, false, err
+	}
+	return v, true, nil
+}
+
+// runScheduledPortfolioSnapshot records a snapshot of every tenant's portfolio from the
+// scheduler. Failures are logged; the next run tries again
+func runScheduledPortfolioSnapshot(ctx context.Context, repo *Repository) {
+	holdings, err := repo.Holdings(allTenants)
+	if err != nil {
+		slog.Error("Portfolio snapshot failed", "error", err)
+		return
+	}
+	var tenants []string
+	for _, h := range holdings {
+		if !slices.Contains(tenants, h.Tenant) {
+			tenants = append(tenants, h.Tenant)
+		}
+	}
+
+	for _, tenant := range tenants {
+		v, saved, err := snapshotPortfolio(ctx, repo, tenant)
+		if err != nil {
+			slog.Error("Portfolio snapshot failed", "tenant", tenant, "error", err)
+			continue
+		}
+		if saved {
+			slog.Info("Recorded portfolio snapshot", "tenant", tenant, "currency", v.Currency, "value", roundPrice(v.Value), "gain", roundPrice(v.Gain))
+		}
+	}
+}
+
+// displayPortfolio prints every holding with its value and gain/loss
+func displayPortfolio(v PortfolioValuation) {
+	cur := strings.ToUpper(v.Currency)
+	fmt.Printf("\nPortfolio (%s)\n", cur)
+	fmt.Println("------------------------------------------------------------------------------------------")
+	fmt.Printf("%-5s %-10s %14s %14s %14s %14s %10s\n", "ID", "Asset", "Quantity", "Price", "Value", "Gain", "Change")
+	for _, hv := range v.Holdings {
+		gain, change := "-", "-"
+		if hv.Gain != nil {
+			gain = fmt.Sprintf("%+.2f", *hv.Gain)
+			change = fmt.Sprintf("%+.2f%%", *hv.GainPct)
+		}
+		fmt.Printf("%-5d %-10s %14.8g %14.2f %14.2f %14s %10s\n",
+			hv.ID, hv.Asset, hv.Quantity, hv.Price, hv.Value, gain, change)
+	}
+	fmt.Println("------------------------------------------------------------------------------------------")
+	fmt.Printf("%-12s %.2f %s\n", "Value:", v.Value, cur)
+	if v.Cost > 0 {
+		fmt.Printf("%-12s %.2f %s\n", "Cost basis:", v.Cost, cur)
+		fmt.Printf("%-12s %+.2f %s (%+.2f%%)\n", "Gain/loss:", v.Gain, cur, v.GainPct)
+	}
+	fmt.Println()
+}
+
+// quantityEpsilon is the remainder below which a holding counts as sold in full,
+// absorbing float rounding from splitting lots
+const quantityEpsilon = 1e-10
+
+// roundQuantity rounds a quantity to 10 decimal places, well below a satoshi, so
+// splitting a lot doesn't leave values like 0.09999999999999998
+func roundQuantity(q float64) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(q, 'f', 10, 64), 64)
+	return rounded
+}
+
+// matchSale matches a sale of quantity units of asset against the holdings bought
+// on or before the sale, oldest first, or newest first with matchLIFO. It returns the
+// disposals and the matched holdings with what remains of them; holdings left with
+// nothing have quantity 0.
+func matchSale(holdings []Holding, asset string, quantity, proceeds float64, currency string, sold time.Time, method string) ([]Disposal, []Holding, error) {
+	lots := make([]Holding, 0, len(holdings))
+	available := 0.0
+	for _, h := range holdings {
+		if h.Asset == asset && !h.Acquired.After(sold) {
+			lots = append(lots, h)
+			available += h.Quantity
+		}
+	}
+	if quantity > available+quantityEpsilon {
+		return nil, nil, fmt.Errorf("only %g %s held on %s", available, tickerSymbol[asset], sold.Format("2006-01-02"))
+	}
+	slices.SortStableFunc(lots, func(a, b Holding) int { return a.Acquired.Compare(b.Acquired) })
+	if method == matchLIFO {
+		slices.Reverse(lots)
+	}
+
+	var disposals []Disposal
+	var remaining []Holding
+	left := quantity
+	for _, h := range lots {
+		if left <= quantityEpsilon {
+			break
+		}
+		// A holding's cost must be in the sale's currency for the gain to mean anything
+		if h.Cost > 0 && h.Currency != currency {
+			return nil, nil, fmt.Errorf("holding #%d cost is in %s but the sale is in %s", h.ID, strings.ToUpper(h.Currency), strings.ToUpper(currency))
+		}
+		take := roundQuantity(min(left, h.Quantity))
+		if h.Quantity-take < quantityEpsilon {
+			take = h.Quantity
+		}
+		share := take / h.Quantity
+		disposals = append(disposals, Disposal{
+			HoldingID: h.ID,
+			Asset:     asset,
+			Quantity:  take,
+			Cost:      h.Cost * share,
+			Proceeds:  proceeds * take / quantity,
+			Currency:  currency,
+			Acquired:  h.Acquired,
+			Disposed:  sold,
+			Tenant:    h.Tenant,
+		})
+		h.Cost -= h.Cost * share
+		h.Quantity = roundQuantity(h.Quantity - take)
+		remaining = append(remaining, h)
+		left = roundQuantity(left - take)
+	}
+
+	if len(disposals) == 0 {
+		return nil, nil, validationErrorf("quantity %g is too small to sell (the smallest is %g)", quantity, quantityEpsilon)
+	}
+
+	// The last lot takes what is left of the proceeds, so the parts add up to the sale
+	for _, d := range disposals[:len(disposals)-1] {
+		proceeds -= d.Proceeds
+	}
+	disposals[len(disposals)-1].Proceeds = proceeds
+	return disposals, remaining, nil
+}
+
+// runPortfolioCommand handles the "portfolio" CLI command
+//
+//	portfolio [value] [currency]
+//	portfolio add <quantity> <asset> [cost] [currency] [YYYY-MM-DD]
+//	portfolio list
+//	portfolio delete <id>
+//	portfolio sell <quantity> <asset> <proceeds> [currency] [YYYY-MM-DD]
+//	portfolio sales [year]
+//	portfolio snapshot
+//	portfolio history [window] [currency]
+func runPortfolioCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) == 0 {
+		args = []string{"value"}
+	}
+
+	switch args[0] {
+	case "value":
+		currency := portfolioConfig.Currency
+		if len(args) > 1 {
+			currency = strings.ToLower(args[1])
+		}
+		v, err := valuePortfolio(ctx, repo, cliTenant, currency)
+		if err != nil {
+			return err
+		}
+		if len(v.Holdings) == 0 {
+			slog.Info("No holdings stored")
+			return nil
+		}
+		displayPortfolio(v)
+
+	case "add":
+		if len(args) < 3 {
+			return validationErrorf("usage: portfolio add <quantity> <asset> [cost] [currency] [YYYY-MM-DD]")
+		}
+
+		quantity, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || quantity <= 0 {
+			return fmt.Errorf("invalid quantity %q", args[1])
+		}
+		asset, err := parseAsset(args[2])
+		if err != nil {
+			return err
+		}
+
+		h := Holding{Asset: asset, Quantity: quantity, Currency: portfolioConfig.Currency, Acquired: time.Now(), Tenant: cliTenant}
+		if len(args) > 3 {
+			// Accept "28,400" as well as "28400"
+			if h.Cost, err = strconv.ParseFloat(strings.ReplaceAll(args[3], ",", ""), 64); err != nil || h.Cost < 0 {
+				return fmt.Errorf("invalid cost %q", args[3])
+			}
+		}
+		if len(args) > 4 {
+			h.Currency = strings.ToLower(args[4])
+		}
+		if len(args) > 5 {
+			if h.Acquired, err = time.Parse("2006-01-02", args[5]); err != nil {
+				return fmt.Errorf("invalid date %q (expected YYYY-MM-DD)", args[5])
+			}
+		}
+
+		id, err := repo.SaveHolding(h)
+		if err != nil {
+			return err
+		}
+		slog.Info("Saved holding", "id", id, "asset", h.Asset, "quantity", h.Quantity, "cost", h.Cost, "currency", h.Currency)
+
+	case "list":
+		holdings, err := repo.Holdings(cliTenant)
+		if err != nil {
+			return err
+		}
+		if len(holdings) == 0 {
+			slog.Info("No holdings stored")
+			return nil
+		}
+
+		fmt.Printf("\n%-5s %-10s %14s %14s %-8s %-12s\n", "ID", "Asset", "Quantity", "Cost", "Currency", "Acquired")
+		fmt.Println("------------------------------------------------------------------")
+		for _, h := range holdings {
+			cost := "-"
+			if h.Cost > 0 {
+				cost = fmt.Sprintf("%.2f", h.Cost)
+			}
+			fmt.Printf("%-5d %-10s %14.8g %14s %-8s %-12s\n",
+				h.ID, h.Asset, h.Quantity, cost, strings.ToUpper(h.Currency), h.Acquired.In(displayLocation).Format("2006-01-02"))
+		}
+		fmt.Println()
+
+	case "delete":
+		if len(args) < 2 {
+			return validationErrorf("usage: portfolio delete <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid holding id %q", args[1])
+		}
+		if err := repo.DeleteHolding(cliTenant, id); err != nil {
+			return err
+		}
+		slog.Info("Deleted holding", "id", id)
+
+	case "sell":
+		if len(args) < 4 {
+			return validationErrorf("usage: portfolio sell <quantity> <asset> <proceeds> [currency] [YYYY-MM-DD]")
+		}
+
+		quantity, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || quantity <= quantityEpsilon {
+			return validationErrorf("invalid quantity %q", args[1])
+		}
+		asset, err := parseAsset(args[2])
+		if err != nil {
+			return err
+		}
+		proceeds, err := strconv.ParseFloat(strings.ReplaceAll(args[3], ",", ""), 64)
+		if err != nil || proceeds < 0 {
+			return fmt.Errorf("invalid proceeds %q", args[3])
+		}
+		currency, sold := portfolioConfig.Currency, time.Now()
+		if len(args) > 4 {
+			currency = strings.ToLower(args[4])
+		}
+		if len(args) > 5 {
+			if sold, err = time.Parse("2006-01-02", args[5]); err != nil {
+				return fmt.Errorf("invalid date %q (expected YYYY-MM-DD)", args[5])
+			}
+		}
+
+		holdings, err := repo.Holdings(cliTenant)
+		if err != nil {
+			return err
+		}
+		disposals, remaining, err := matchSale(holdings, asset, quantity, proceeds, currency, sold, matchFIFO)
+		if err != nil {
+			return err
+		}
+		if err := repo.SellHoldings(disposals, remaining); err != nil {
+			return err
+		}
+		for _, d := range disposals {
+			slog.Info("Sold from holding", "holding", d.HoldingID, "quantity", d.Quantity, "cost", roundPrice(d.Cost),
+				"proceeds", roundPrice(d.Proceeds), "currency", d.Currency, "acquired", d.Acquired.Format("2006-01-02"))
+		}
+
+	case "sales":
+		year := time.Now().Year()
+		if len(args) > 1 {
+			var err error
+			if year, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("invalid year %q", args[1])
+			}
+		}
+		from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		disposals, err := repo.Disposals(cliTenant, from, from.AddDate(1, 0, 0))
+		if err != nil {
+			return err
+		}
+		if len(disposals) == 0 {
+			slog.Info("No sales recorded", "year", year)
+			return nil
+		}
+
+		fmt.Printf("\n%-10s %-12s %-10s %14s %14s %14s %14s %-8s\n", "Sold", "Acquired", "Asset", "Quantity", "Proceeds", "Cost", "Gain", "Currency")
+		fmt.Println("--------------------------------------------------------------------------------------------------------")
+		for _, d := range disposals {
+			cost, gain := "-", "-"
+			if d.Cost > 0 {
+				cost = fmt.Sprintf("%.2f", d.Cost)
+				gain = fmt.Sprintf("%+.2f", d.Proceeds-d.Cost)
+			}
+			fmt.Printf("%-10s %-12s %-10s %14.8g %14.2f %14s %14s %-8s\n", d.Disposed.In(displayLocation).Format("2006-01-02"),
+				d.Acquired.In(displayLocation).Format("2006-01-02"), d.Asset, d.Quantity, d.Proceeds, cost, gain, strings.ToUpper(d.Currency))
+		}
+		fmt.Println()
+
+	case "snapshot":
+		v, saved, err := snapshotPortfolio(ctx, repo, cliTenant)
+		if err != nil {
+			return err
+		}
+		if !saved {
+			slog.Info("No holdings stored, nothing to snapshot")
+			return nil
+		}
+		displayPortfolio(v)
+		slog.Info("Recorded portfolio snapshot", "currency", v.Currency)
+
+	case "history":
+		window, label, currency := defaultPortfolioHistory, "30d", portfolioConfig.Currency
+		if len(args) > 1 {
+			d, err := parseStatsWindow(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid window %q", args[1])
+			}
+			window, label = d, args[1]
+		}
+		if len(args) > 2 {
+			currency = strings.ToLower(args[2])
+		}
+
+		snaps, err := repo.PortfolioSnapshots(cliTenant, currency, time.Now().Add(-window), time.Time{}, maxRangeLimit)
+		if err != nil {
+			return err
+		}
+		if len(snaps) == 0 {
+			slog.Info("No portfolio snapshots recorded", "currency", currency, "window", label)
+			return nil
+		}
+
+		fmt.Printf("\nPortfolio History (%s, last %s)\n", strings.ToUpper(currency), label)
+		fmt.Println("------------------------------------------------------------------")
+		fmt.Printf("%-20s %14s %14s %14s\n", "Time", "Value", "Cost", "Gain")
+		for _, snap := range snaps {
+			fmt.Printf("%-20s %14.2f %14.2f %+14.2f\n",
+				snap.Timestamp.In(displayLocation).Format("2006-01-02 15:04:05"), snap.Value, snap.Cost, snap.Gain)
+		}
+		fmt.Println()
+
+	default:
+		return validationErrorf("unknown portfolio command: %s", args[0])
+	}
+	return nil
+}
+
+// handlePortfolio serves GET /portfolio?currency=usd
+// currency defaults to PORTFOLIO_CURRENCY; every holding of the request's tenant is valued
+// at the latest price
+func (s *apiServer) handlePortfolio(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	currency := portfolioConfig.Currency
+	if c := strings.TrimSpace(r.URL.Query().Get("currency")); c != "" {
+		currency = c
+	}
+	v, err := valuePortfolio(r.Context(), s.repo, requestTenant(r), currency)
+	if err != nil {
+		slog.Error("API failed to value portfolio", "path", r.URL.Path, "error", err)
+		writeAPIError(w, http.StatusBadGateway, "failed to value portfolio")
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// handlePortfolioHistory serves GET /portfolio/history?currency=usd&from=...&to=...&limit=...
+// from defaults to 30 days ago; the request's tenant's snapshots are returned oldest first
+func (s *apiServer) handlePortfolioHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	from, to, err := requestWindow(r, "")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if from.IsZero() {
+		from = time.Now().Add(-defaultPortfolioHistory)
+		if !to.IsZero() && !to.After(from) {
+			writeAPIError(w, http.StatusBadRequest, "to must be after from")
+			return
+		}
+	}
+
+	limit := defaultRangeLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxRangeLimit {
+			writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and %d", maxRangeLimit)
+			return
+		}
+	}
+
+	currency := portfolioConfig.Currency
+	if c := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("currency"))); c != "" {
+		currency = c
+	}
+	snaps, err := s.repo.PortfolioSnapshots(requestTenant(r), currency, from, to, limit)
+	if err != nil {
+		slog.Error("API failed to fetch portfolio snapshots", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query portfolio snapshots")
+		return
+	}
+	if snaps == nil {
+		snaps = []PortfolioSnapshot{} // Encode an empty range as [] rather than null
+	}
+	writeJSON(w, http.StatusOK, snaps)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings" // Package for the CSV input
+	"testing" // Package for the tests
+	"time"    // Package for acquisition and sale dates
+)
+
+func TestMatchSale(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.January, d, 0, 0, 0, 0, time.UTC) }
+	holdings := []Holding{
+		{ID: 1, Asset: "bitcoin", Quantity: 0.5, Cost: 10000, Currency: "usd", Acquired: day(1)},
+		{ID: 2, Asset: "bitcoin", Quantity: 0.5, Cost: 20000, Currency: "usd", Acquired: day(2)},
+		{ID: 3, Asset: "bitcoin", Quantity: 1, Cost: 50000, Currency: "usd", Acquired: day(20)}, // Bought after the sale
+	}
+
+	tests := []struct {
+		name     string
+		quantity float64
+		method   string
+		lots     []int     // Holding IDs of the disposals, in order
+		costs    []float64 // Their cost basis
+	}{
+		{"one lot", 0.25, matchFIFO, []int{1}, []float64{5000}},
+		{"across lots, oldest first", 0.75, matchFIFO, []int{1, 2}, []float64{10000, 10000}},
+		{"newest first", 0.75, matchLIFO, []int{2, 1}, []float64{20000, 5000}},
+	}
+	for _, tt := range tests {
+		disposals, _, err := matchSale(holdings, "bitcoin", tt.quantity, 30000, "usd", day(10), tt.method)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(disposals) != len(tt.lots) {
+			t.Errorf("%s: got %d disposals, want %d", tt.name, len(disposals), len(tt.lots))
+			continue
+		}
+		proceeds := 0.0
+		for i, d := range disposals {
+			if d.HoldingID != tt.lots[i] || d.Cost != tt.costs[i] {
+				t.Errorf("%s: disposal %d is holding #%d costing %g, want #%d costing %g", tt.name, i, d.HoldingID, d.Cost, tt.lots[i], tt.costs[i])
+			}
+			proceeds += d.Proceeds
+		}
+		if proceeds != 30000 {
+			t.Errorf("%s: proceeds add up to %g, want 30000", tt.name, proceeds)
+		}
+	}
+}
+
+func TestMatchSaleInvalid(t *testing.T) {
+	sold := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	holdings := []Holding{{ID: 1, Asset: "bitcoin", Quantity: 0.5, Currency: "usd", Acquired: sold.AddDate(0, 0, -1)}}
+
+	for _, tt := range []struct {
+		name     string
+		holdings []Holding
+		quantity float64
+	}{
+		{"more than held", holdings, 0.6},
+		{"dust", holdings, 1e-11},         // Used to panic with no lot matched
+		{"dust without lots", nil, 1e-11}, // The same, when nothing is held
+	} {
+		if _, _, err := matchSale(tt.holdings, "bitcoin", tt.quantity, 100, "usd", sold, matchFIFO); err == nil {
+			t.Errorf("%s: matchSale(%g) succeeded, want an error", tt.name, tt.quantity)
+		}
+	}
+}
+
+func TestReadTradesRejectsDust(t *testing.T) {
+	for _, quantity := range []string{"0", "0.00000000001"} {
+		csv := "time,side,quantity\n2024-01-01T00:00:00Z,sell," + quantity + "\n"
+		if _, err := readTrades(strings.NewReader(csv)); err == nil {
+			t.Errorf("readTrades with quantity %s succeeded, want an error", quantity)
+		}
+	}
+	trades, err := readTrades(strings.NewReader("time,side,quantity\n2024-01-01T00:00:00Z,buy,0.0001\n"))
+	if err != nil || len(trades) != 1 || trades[0].Quantity != 0.0001 {
+		t.Errorf("readTrades = %v, %v, want one buy of 0.0001", trades, err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"database/sql/driver" // Package for passing decimals to the database
+	"fmt"                 // Package for formatted I/O operations
+	"math"                // Package for the significant digits of rounded prices
+	"net/http"            // Package for the precision query parameter
+	"os"                  // Package for environment variables
+	"strconv"             // Package for formatting decimals
+	"strings"             // Package for parsing PRICE_SCALES
+)
+
+// Prices are stored with PRICE_SCALE decimal places, or those PRICE_SCALES sets for
+// their currency, but shown with as many as they need, so a feed's decimals vary from
+// price to price and from currency to currency. They are written as priceDecimal, the
+// decimal digits they are stored with, never as a float64.
+// --precision and ?precision= fix the decimal places of every price in display,
+// exports, and the price endpoints instead, for consumers such as spreadsheets that
+// expect a stable number format.
+
+// priceScales overrides priceScale for a currency, e.g. "jpy"; configured via PRICE_SCALES
+var priceScales map[string]int
+
+// loadPriceScales reads PRICE_SCALES, e.g. "jpy=0,krw=0,usd=2"
+func loadPriceScales() (map[string]int, error) {
+	scales := make(map[string]int)
+	for _, entry := range strings.Split(os.Getenv("PRICE_SCALES"), ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		key, v, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if !ok || key == "" || strings.Contains(key, "/") || err != nil || n < 0 || n > maxPriceScale {
+			return nil, fmt.Errorf("invalid PRICE_SCALES entry %q (expected currency=places, 0 to %d places)", entry, maxPriceScale)
+		}
+		scales[key] = n
+	}
+	return scales, nil
+}
+
+// priceScaleFor returns the decimal places prices in currency are stored with
+func priceScaleFor(currency string) int {
+	if n, ok := priceScales[currency]; ok {
+		return n
+	}
+	return priceScale
+}
+
+// widestPriceScale returns the most decimal places any price is stored with
+func widestPriceScale() int {
+	widest := priceScale
+	for _, n := range priceScales {
+		widest = max(widest, n)
+	}
+	return widest
+}
+
+// floatDigits is the number of significant decimal digits a float64 always keeps
+const floatDigits = 15
+
+// priceDecimal is a price as the decimal digits it is stored with, e.g. "104230.10000000"
+// Writes pass it to the database instead of the float64, so NUMERIC columns receive
+// exactly these digits rather than a binary fraction such as 104230.100000000005821.
+type priceDecimal string
+
+// toDecimal rounds a price to places decimal places, or to fewer where a float64
+// couldn't hold them: digits beyond the 15 significant ones it keeps exactly would
+// only be binary noise
+func toDecimal(price float64, places int) priceDecimal {
+	if whole := math.Abs(price); whole >= 1 {
+		places = min(places, max(0, floatDigits-1-int(math.Log10(whole))))
+	}
+	return priceDecimal(strconv.FormatFloat(price, 'f', places, 64))
+}
+
+// storedPrice returns a price as written with PRICE_SCALE decimal places
+func storedPrice(price float64) priceDecimal {
+	return toDecimal(price, priceScale)
+}
+
+// storedPriceIn returns a price in currency as written with its currency's decimal places
+func storedPriceIn(currency string, price float64) priceDecimal {
+	return toDecimal(price, priceScaleFor(currency))
+}
+
+// Value implements driver.Valuer; the database parses the digits into its own type
+func (d priceDecimal) Value() (driver.Value, error) {
+	return string(d), nil
+}
+
+// float returns the decimal as the nearest float64, for records kept in memory
+func (d priceDecimal) float() float64 {
+	f, _ := strconv.ParseFloat(string(d), 64)
+	return f
+}
+
+// roundPriceIn rounds a price in currency to the places it is stored with
+func roundPriceIn(currency string, price float64) float64 {
+	return storedPriceIn(currency, price).float()
+}
+
+// noPrecision keeps each price's own decimal places
+const noPrecision = -1
+
+// parsePrecision validates the decimal places given in a flag or query parameter
+// called name; empty is noPrecision. More places than any price is stored with would
+// only pad zeros.
+func parsePrecision(name, v string) (int, error) {
+	if v == "" {
+		return noPrecision, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > widestPriceScale() {
+		return noPrecision, validationErrorf("invalid %s %q (expected 0 to %d decimal places)", name, v, widestPriceScale())
+	}
+	return n, nil
+}
+
+// requestPrecision reads the precision query parameter
+func requestPrecision(r *http.Request) (int, error) {
+	return parsePrecision("precision", r.URL.Query().Get("precision"))
+}
+
+// formatDecimal formats a price for exports: with precision decimal places, or in the
+// shortest form that reads back exactly with noPrecision
+func formatDecimal(v float64, precision int) string {
+	return strconv.FormatFloat(v, 'f', precision, 64)
+}
+
+// fixedDecimal is a number encoded in JSON with a fixed number of decimal places,
+// trailing zeros included
+type fixedDecimal struct {
+	value  float64
+	places int
+}
+
+// MarshalJSON implements json.Marshaler
+func (d fixedDecimal) MarshalJSON() ([]byte, error) {
+	return []byte(formatDecimal(d.value, d.places)), nil
+}
+
+// precisePriceRecord is a PriceRecord encoded with a fixed number of decimal places;
+// its Price hides the embedded one
+type precisePriceRecord struct {
+	PriceRecord
+	Price fixedDecimal `json:"price"`
+}
+
+// priceWithPrecision returns a record as encoded with precision decimal places; the
+// record itself with noPrecision
+func priceWithPrecision(r PriceRecord, precision int) interface{} {
+	if precision == noPrecision {
+		return r
+	}
+	return precisePriceRecord{PriceRecord: r, Price: fixedDecimal{r.Price, precision}}
+}
+
+// pricesWithPrecision is priceWithPrecision for a list of records
+func pricesWithPrecision(records []PriceRecord, precision int) interface{} {
+	if precision == noPrecision {
+		return records
+	}
+	out := make([]precisePriceRecord, len(records))
+	for i, r := range records {
+		out[i] = precisePriceRecord{PriceRecord: r, Price: fixedDecimal{r.Price, precision}}
+	}
+	return out
+}
+
+// preciseCandle is a Candle encoded with a fixed number of decimal places
+type preciseCandle struct {
+	Candle
+	Open  fixedDecimal `json:"open"`
+	High  fixedDecimal `json:"high"`
+	Low   fixedDecimal `json:"low"`
+	Close fixedDecimal `json:"close"`
+}
+
+// candlesWithPrecision returns candles as encoded with precision decimal places; the
+// candles themselves with noPrecision
+func candlesWithPrecision(candles []Candle, precision int) interface{} {
+	if precision == noPrecision {
+		return candles
+	}
+	out := make([]preciseCandle, len(candles))
+	for i, c := range candles {
+		out[i] = preciseCandle{
+			Candle: c,
+			Open:   fixedDecimal{c.Open, precision},
+			High:   fixedDecimal{c.High, precision},
+			Low:    fixedDecimal{c.Low, precision},
+			Close:  fixedDecimal{c.Close, precision},
+		}
+	}
+	return out
+}
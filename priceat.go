@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"       // Package for the store queries
+	"encoding/json" // Package for the --json output
+	"errors"        // Package for the not-found sentinel
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for the lookup endpoint
+	"os"            // Package for the --json output
+	"strconv"       // Package for Unix timestamps
+	"strings"       // Package for string manipulation
+	"time"          // Package for timestamps and gaps
+)
+
+// The price-at command and GET /prices/at look up the price of a currency at a past
+// moment, e.g. of a transaction for a tax report: the stored sample at that time, the
+// two samples around it interpolated linearly, or the nearest one.
+
+// Price lookup methods, as reported in PriceAt.Method
+const (
+	priceAtExact        = "exact"        // A sample was recorded at the time itself
+	priceAtInterpolated = "interpolated" // Linear between the samples before and after
+	priceAtNearest      = "nearest"      // The closer of the samples around the time
+)
+
+// defaultPriceAtMaxGap is how far from the time the samples used may be by default
+const defaultPriceAtMaxGap = 24 * time.Hour
+
+// errNoPriceAt is returned when no sample is stored close enough to the time
+var errNoPriceAt = errors.New("no price stored close enough to that time")
+
+// priceAtLayouts are the time layouts accepted besides RFC 3339 and Unix seconds
+var priceAtLayouts = []string{
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// PriceAt is the price of a currency at a moment and the samples it was taken from
+type PriceAt struct {
+	Currency string       `json:"currency"`
+	At       time.Time    `json:"at"`
+	Price    float64      `json:"price"`
+	Method   string       `json:"method"`           // exact, interpolated, or nearest
+	Before   *PriceRecord `json:"before,omitempty"` // Newest sample at or before At
+	After    *PriceRecord `json:"after,omitempty"`  // Oldest sample after At
+	Offset   float64      `json:"offset"`           // Seconds between At and the nearest sample used
+}
+
+// parsePriceTime parses a time given to the CLI: RFC 3339, a shorter form such as
+// 2023-06-01T12:00Z or "2023-06-01 12:00" (in the display zone without a zone), or Unix
+// seconds
+func parsePriceTime(v string) (time.Time, error) {
+	return parsePriceTimeIn(v, displayLocation)
+}
+
+// parsePriceTimeIn parses a time like parsePriceTime, reading times without a zone in loc
+func parsePriceTimeIn(v string, loc *time.Location) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	for _, layout := range priceAtLayouts {
+		if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+			return t, nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Time{}, validationErrorf("invalid time %q (expected RFC 3339, e.g. 2023-06-01T12:00Z, or Unix seconds)", v)
+}
+
+// lookupPriceAt returns the price of currency at a moment. With interpolate the price
+// is interpolated between the samples around it; otherwise, or when only one of them is
+// within maxGap, the nearest sample's price is used. errNoPriceAt means neither is.
+func lookupPriceAt(ctx context.Context, repo *Repository, currency string, at time.Time, interpolate bool, maxGap time.Duration) (PriceAt, error) {
+	result := PriceAt{Currency: strings.ToLower(currency), At: at.UTC()}
+	records, err := repo.PricesAround(ctx, currency, at)
+	if err != nil {
+		return result, err
+	}
+	for i := range records {
+		if records[i].Timestamp.After(at) {
+			result.After = &records[i]
+		} else {
+			result.Before = &records[i]
+		}
+	}
+
+	before, after := result.Before, result.After
+	var beforeGap, afterGap time.Duration
+	if before != nil {
+		beforeGap = at.Sub(before.Timestamp)
+	}
+	if after != nil {
+		afterGap = after.Timestamp.Sub(at)
+	}
+	if before != nil && beforeGap > maxGap {
+		before = nil
+	}
+	if after != nil && afterGap > maxGap {
+		after = nil
+	}
+
+	switch {
+	case before != nil && beforeGap == 0:
+		result.Price, result.Method = before.Price, priceAtExact
+	case interpolate && before != nil && after != nil:
+		share := beforeGap.Seconds() / after.Timestamp.Sub(before.Timestamp).Seconds()
+		result.Price = roundPrice(before.Price + (after.Price-before.Price)*share)
+		result.Method = priceAtInterpolated
+		result.Offset = min(beforeGap, afterGap).Seconds()
+	case before != nil && (after == nil || beforeGap <= afterGap):
+		result.Price, result.Method, result.Offset = before.Price, priceAtNearest, beforeGap.Seconds()
+	case after != nil:
+		result.Price, result.Method, result.Offset = after.Price, priceAtNearest, afterGap.Seconds()
+	default:
+		return result, fmt.Errorf("%w: nothing for %s within %s of %s", errNoPriceAt, result.Currency, maxGap, at.UTC().Format(time.RFC3339))
+	}
+	return result, nil
+}
+
+// parsePriceAtMode reports whether a lookup mode interpolates: "interpolate" (the
+// default) or "nearest"
+func parsePriceAtMode(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "", "interpolate":
+		return true, nil
+	case "nearest":
+		return false, nil
+	}
+	return false, validationErrorf("invalid mode %q (expected interpolate or nearest)", v)
+}
+
+// parsePriceAtMaxGap parses the largest distance of a sample from the time, e.g. 6h
+func parsePriceAtMaxGap(v string) (time.Duration, error) {
+	if v == "" {
+		return defaultPriceAtMaxGap, nil
+	}
+	d, err := parseStatsWindow(v)
+	if err != nil || d <= 0 {
+		return 0, validationErrorf("invalid max gap %q (expected a duration, e.g. 6h or 2d)", v)
+	}
+	return d, nil
+}
+
+// preciseOffset formats a sample's distance from the looked-up time, e.g. "-4m30s"
+func preciseOffset(sample, at time.Time) string {
+	d := sample.Sub(at).Round(time.Second)
+	if d > 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
+
+// handlePriceAt serves GET /prices/at?t=2023-06-01T12:00Z&currency=usd&mode=nearest&max_gap=6h&precision=N
+// It answers 404 when no sample is stored within max_gap (default 24h) of t; a t without
+// a zone is read in the tz zone, UTC by default
+func (s *apiServer) handlePriceAt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("t") == "" {
+		writeAPIError(w, http.StatusBadRequest, "t is required, e.g. t=2023-06-01T12:00Z")
+		return
+	}
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	at, err := parsePriceTimeIn(q.Get("t"), loc)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	interpolate, err := parsePriceAtMode(q.Get("mode"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	maxGap, err := parsePriceAtMaxGap(q.Get("max_gap"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	precision, err := requestPrecision(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	result, err := lookupPriceAt(r.Context(), s.repo, requestCurrency(r), at, interpolate, maxGap)
+	if errors.Is(err, errNoPriceAt) {
+		writeAPIError(w, http.StatusNotFound, "%v", err)
+		return
+	}
+	if err != nil {
+		slog.Error("API failed to look up price", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query prices")
+		return
+	}
+	var sources []PriceRecord
+	for _, record := range []*PriceRecord{result.Before, result.After} {
+		if record != nil {
+			sources = append(sources, *record)
+		}
+	}
+	setAttribution(w, recordSources(sources))
+	if precision == noPrecision {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	out := struct {
+		PriceAt
+		Price  fixedDecimal `json:"price"`
+		Before interface{}  `json:"before,omitempty"`
+		After  interface{}  `json:"after,omitempty"`
+	}{PriceAt: result, Price: fixedDecimal{result.Price, precision}}
+	if result.Before != nil {
+		out.Before = priceWithPrecision(*result.Before, precision)
+	}
+	if result.After != nil {
+		out.After = priceWithPrecision(*result.After, precision)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// runPriceAtCommand handles "price-at <time> [currency] [--mode interpolate|nearest]
+// [--max-gap 24h] [--precision N] [--json]"
+func runPriceAtCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("price-at")
+	mode := fs.String("mode", "interpolate", "interpolate between the samples around the time, or nearest to use the closer one")
+	maxGapFlag := fs.String("max-gap", "24h", "Farthest a sample used may be from the time, e.g. 6h or 2d")
+	precisionFlag := fs.String("precision", "", "Decimal places of the price (default: as stored)")
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+
+	// The time and currency come before the flags, which flag parsing would stop at
+	var positional []string
+	for len(args) > 0 && len(positional) < 2 && !strings.HasPrefix(args[0], "-") {
+		positional, args = append(positional, args[0]), args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if len(positional) == 0 {
+		return validationErrorf("usage: price-at <time> [currency] [flags], e.g. price-at 2023-06-01T12:00Z usd")
+	}
+	at, err := parsePriceTime(positional[0])
+	if err != nil {
+		return err
+	}
+	currency := currencies[0]
+	if len(positional) > 1 {
+		currency = strings.ToLower(positional[1])
+	}
+	interpolate, err := parsePriceAtMode(*mode)
+	if err != nil {
+		return err
+	}
+	maxGap, err := parsePriceAtMaxGap(*maxGapFlag)
+	if err != nil {
+		return err
+	}
+	precision, err := parsePrecision("--precision", *precisionFlag)
+	if err != nil {
+		return err
+	}
+
+	result, err := lookupPriceAt(ctx, repo, currency, at, interpolate, maxGap)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+
+	fmt.Printf("\nBitcoin price at %s: %s %s (%s)\n\n", result.At.In(displayLocation).Format("2006-01-02 15:04:05 MST"),
+		formatPriceAt(result.Price, precision), strings.ToUpper(result.Currency), result.Method)
+	for _, side := range []struct {
+		label  string
+		record *PriceRecord
+	}{{"Before", result.Before}, {"After", result.After}} {
+		if side.record == nil {
+			fmt.Printf("  %-7s -\n", side.label)
+			continue
+		}
+		fmt.Printf("  %-7s %-20s %15s  %-10s %s\n", side.label, side.record.Timestamp.In(displayLocation).Format("2006-01-02 15:04:05"),
+			formatPriceAt(side.record.Price, precision), side.record.Source, preciseOffset(side.record.Timestamp, result.At))
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/binary" // Package for fixed-width protobuf fields
+	"errors"          // Package for decoding errors
+	"math"            // Package for double bit patterns
+	"time"            // Package for google.protobuf.Timestamp
+)
+
+// Protobuf wire types used by the gRPC messages
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// errProtoTruncated reports a message that ends inside a field
+var errProtoTruncated = errors.New("truncated protobuf message")
+
+// protoBuffer builds a protobuf message in the proto3 encoding
+// Fields with zero values are left out, as proto3 does; fields should be appended in
+// field-number order, which decoders don't require but every encoder produces
+type protoBuffer []byte
+
+// varint appends v as a base-128 varint
+func (b *protoBuffer) varint(v uint64) {
+	*b = binary.AppendUvarint(*b, v)
+}
+
+// tag appends a field's key
+func (b *protoBuffer) tag(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// int64Field appends an int64 or int32 field
+func (b *protoBuffer) int64Field(field int, v int64) {
+	if v != 0 {
+		b.tag(field, protoVarint)
+		b.varint(uint64(v))
+	}
+}
+
+// doubleField appends a double field
+func (b *protoBuffer) doubleField(field int, v float64) {
+	if v != 0 {
+		b.tag(field, protoFixed64)
+		*b = binary.LittleEndian.AppendUint64(*b, math.Float64bits(v))
+	}
+}
+
+// stringField appends a string field
+func (b *protoBuffer) stringField(field int, s string) {
+	if s != "" {
+		b.bytesField(field, []byte(s))
+	}
+}
+
+// bytesField appends a length-delimited field; embedded messages are written even
+// when empty, since their presence is meaningful
+func (b *protoBuffer) bytesField(field int, v []byte) {
+	b.tag(field, protoBytes)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+// timestampField appends a google.protobuf.Timestamp field
+func (b *protoBuffer) timestampField(field int, t time.Time) {
+	var ts protoBuffer
+	ts.int64Field(1, t.Unix())
+	ts.int64Field(2, int64(t.Nanosecond()))
+	b.bytesField(field, ts)
+}
+
+// protoField is one decoded field of a message
+type protoField struct {
+	Num   int
+	Wire  int
+	Int   uint64 // Value of varint and fixed fields
+	Bytes []byte // Value of length-delimited fields
+}
+
+// decodeProto splits a message into its fields in wire order
+// Unknown fields are returned like any other, so callers simply skip them
+func decodeProto(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errProtoTruncated
+		}
+		data = data[n:]
+		f := protoField{Num: int(key >> 3), Wire: int(key & 7)}
+		if f.Num == 0 {
+			return nil, errors.New("invalid protobuf field number 0")
+		}
+
+		switch f.Wire {
+		case protoVarint:
+			if f.Int, n = binary.Uvarint(data); n <= 0 {
+				return nil, errProtoTruncated
+			}
+			data = data[n:]
+		case protoFixed64:
+			if len(data) < 8 {
+				return nil, errProtoTruncated
+			}
+			f.Int, data = binary.LittleEndian.Uint64(data), data[8:]
+		case protoFixed32:
+			if len(data) < 4 {
+				return nil, errProtoTruncated
+			}
+			f.Int, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case protoBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return nil, errProtoTruncated
+			}
+			f.Bytes, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			return nil, errors.New("unsupported protobuf wire type")
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// decodeTimestamp decodes a google.protobuf.Timestamp message
+func decodeTimestamp(data []byte) (time.Time, error) {
+	fields, err := decodeProto(data)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var seconds, nanos int64
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			seconds = int64(f.Int)
+		case 2:
+			nanos = int64(int32(f.Int))
+		}
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
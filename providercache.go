@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"      // Package for formatted I/O operations
+	"net/http" // Package for conditional request headers
+	"os"       // Package for environment variables
+	"strings"  // Package for parsing PROVIDER_CACHE_TTL
+	"sync"     // Package for guarding the cache
+	"time"     // Package for cache lifetimes
+)
+
+// Providers only update their prices every so often (CoinGecko every 30 to 60 seconds),
+// so asking again sooner returns the same answer and still counts against the rate
+// limit and the fetch budget. getJSON keeps the last response of every URL: within the
+// provider's PROVIDER_CACHE_TTL it is reused without a request, and after that it is
+// revalidated with If-None-Match/If-Modified-Since when the provider sent an ETag or
+// Last-Modified, so an unchanged answer comes back as a bodiless 304.
+
+// defaultProviderCacheTTLs are how long a response is reused before asking again
+// Exchange tickers change with every trade, so only CoinGecko's are reused by default.
+var defaultProviderCacheTTLs = map[string]time.Duration{
+	"coingecko": 30 * time.Second,
+}
+
+// providerCacheTTLs holds the active per-provider lifetimes, loaded at startup
+var providerCacheTTLs = map[string]time.Duration{}
+
+// loadProviderCacheTTLs reads PROVIDER_CACHE_TTL, e.g. "coingecko=1m,kraken=5s";
+// "provider=0" asks the provider every time
+func loadProviderCacheTTLs() (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration, len(defaultProviderCacheTTLs))
+	for provider, ttl := range defaultProviderCacheTTLs {
+		ttls[provider] = ttl
+	}
+
+	v := os.Getenv("PROVIDER_CACHE_TTL")
+	for _, entry := range strings.Split(v, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		provider, ttl, ok := strings.Cut(entry, "=")
+		provider = strings.ToLower(strings.TrimSpace(provider))
+		if _, known := availableSources[provider]; !ok || !known {
+			return nil, fmt.Errorf("invalid PROVIDER_CACHE_TTL entry %q (expected provider=duration)", entry)
+		}
+		d := time.Duration(0)
+		if ttl = strings.TrimSpace(ttl); ttl != "0" {
+			var err error
+			if d, err = time.ParseDuration(ttl); err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid PROVIDER_CACHE_TTL entry %q: bad duration %q", entry, ttl)
+			}
+		}
+		ttls[provider] = d
+	}
+	return ttls, nil
+}
+
+// providerResponse is the last successful response of a provider URL
+type providerResponse struct {
+	body         []byte
+	etag         string // ETag header, sent back as If-None-Match
+	lastModified string // Last-Modified header, sent back as If-Modified-Since
+	fetchedAt    time.Time
+}
+
+// revalidate adds the conditional headers of the response to a new request for it
+func (r *providerResponse) revalidate(req *http.Request) {
+	if r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	if r.lastModified != "" {
+		req.Header.Set("If-Modified-Since", r.lastModified)
+	}
+}
+
+// providerResponses caches responses by URL
+var providerResponses = struct {
+	sync.Mutex
+	byURL map[string]*providerResponse
+}{byURL: map[string]*providerResponse{}}
+
+// cachedProviderResponse returns the cached response of a URL, if any, and whether it
+// is recent enough to be used without asking the provider
+func cachedProviderResponse(provider, url string) (*providerResponse, bool) {
+	providerResponses.Lock()
+	defer providerResponses.Unlock()
+	r, ok := providerResponses.byURL[url]
+	if !ok {
+		return nil, false
+	}
+	copied := *r
+	return &copied, time.Since(r.fetchedAt) < providerCacheTTLs[provider]
+}
+
+// cacheProviderResponse keeps a response for reuse within the provider's lifetime, or
+// for revalidation when it came with an ETag or Last-Modified
+func cacheProviderResponse(provider, url string, body []byte, header http.Header) {
+	r := &providerResponse{body: body, etag: header.Get("ETag"), lastModified: header.Get("Last-Modified"), fetchedAt: time.Now()}
+	providerResponses.Lock()
+	defer providerResponses.Unlock()
+	if providerCacheTTLs[provider] <= 0 && r.etag == "" && r.lastModified == "" {
+		delete(providerResponses.byURL, url)
+		return
+	}
+	providerResponses.byURL[url] = r
+}
+
+// touchProviderResponse restarts the lifetime of a response the provider confirmed
+// unchanged with a 304
+func touchProviderResponse(url string) {
+	providerResponses.Lock()
+	defer providerResponses.Unlock()
+	if r, ok := providerResponses.byURL[url]; ok {
+		r.fetchedAt = time.Now()
+	}
+}
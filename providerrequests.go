@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"net/http" // Package for request headers
+	"os"       // Package for environment variables
+	"slices"   // Package for ordering the status
+	"strconv"  // Package for status code labels
+	"strings"  // Package for parsing PROVIDER_HEADERS
+	"sync"     // Package for guarding the request statistics
+	"time"     // Package for request latencies
+)
+
+// Some providers throttle or block requests carrying Go's default User-Agent
+// ("Go-http-client/1.1"), so getJSON names the tracker instead. PROVIDER_USER_AGENT
+// replaces that name for every provider, and PROVIDER_HEADERS sets headers, including
+// User-Agent, for one provider. Every request that reaches a provider is counted and
+// timed per provider, in metrics and in status, to tell which source is misbehaving
+// before switching PRICE_SOURCES.
+
+// defaultProviderUserAgent is the User-Agent of provider requests unless configured
+const defaultProviderUserAgent = "bitcoin-tracker"
+
+// ProviderHeaderConfig holds the headers sent with provider requests
+type ProviderHeaderConfig struct {
+	UserAgent string                 // Sent to every provider that has no User-Agent of its own
+	Headers   map[string]http.Header // Extra headers by provider
+}
+
+// providerHeaderConfig is the active header configuration, loaded at startup
+var providerHeaderConfig = ProviderHeaderConfig{UserAgent: defaultProviderUserAgent}
+
+// loadProviderHeaderConfig reads PROVIDER_USER_AGENT and PROVIDER_HEADERS, e.g.
+// "coingecko/User-Agent=my-app/1.0 (ops@example.com),kraken/Accept-Language=en". A
+// comma that doesn't start a new provider/Header= entry belongs to the value, so
+// browser-style agents such as "(KHTML, like Gecko)" can be given as they are.
+func loadProviderHeaderConfig() (ProviderHeaderConfig, error) {
+	c := ProviderHeaderConfig{UserAgent: defaultProviderUserAgent, Headers: make(map[string]http.Header)}
+	if v := strings.TrimSpace(os.Getenv("PROVIDER_USER_AGENT")); v != "" {
+		if strings.ContainsAny(v, "\r\n") {
+			return c, fmt.Errorf("invalid PROVIDER_USER_AGENT %q (it can't contain line breaks)", v)
+		}
+		c.UserAgent = v
+	}
+
+	var entries []string
+	for _, part := range strings.Split(os.Getenv("PROVIDER_HEADERS"), ",") {
+		if n := len(entries); n > 0 && !startsProviderHeader(part) {
+			entries[n-1] += "," + part
+			continue
+		}
+		entries = append(entries, part)
+	}
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !startsProviderHeader(entry) {
+			return c, fmt.Errorf("invalid PROVIDER_HEADERS entry %q (expected provider/Header=value)", entry)
+		}
+		value = strings.TrimSpace(value)
+		if strings.ContainsAny(value, "\r\n") {
+			return c, fmt.Errorf("invalid PROVIDER_HEADERS entry %q: values can't contain line breaks", entry)
+		}
+		provider, header, _ := strings.Cut(strings.TrimSpace(name), "/")
+		provider = strings.ToLower(provider)
+		if c.Headers[provider] == nil {
+			c.Headers[provider] = make(http.Header)
+		}
+		c.Headers[provider].Set(header, value)
+	}
+	return c, nil
+}
+
+// startsProviderHeader reports whether s begins a PROVIDER_HEADERS entry: a provider
+// name, a slash, a header name, and "="
+func startsProviderHeader(s string) bool {
+	name, _, ok := strings.Cut(s, "=")
+	if !ok {
+		return false
+	}
+	provider, header, ok := strings.Cut(strings.TrimSpace(name), "/")
+	if !ok || provider == "" || header == "" {
+		return false
+	}
+	for _, c := range strings.ToLower(provider) {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '.' && c != '-' && c != '_' {
+			return false
+		}
+	}
+	for _, c := range header {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// setProviderHeaders adds the User-Agent and the configured headers of provider to req
+func setProviderHeaders(req *http.Request, provider string) {
+	req.Header.Set("User-Agent", providerHeaderConfig.UserAgent)
+	for name, values := range providerHeaderConfig.Headers[provider] {
+		req.Header[name] = values
+	}
+}
+
+// providerRequestStats are the requests this process made to one provider
+type providerRequestStats struct {
+	requests    int
+	failures    int // Transport errors and responses other than 200 and 304
+	throttled   int // 429 responses
+	total       time.Duration
+	slowest     time.Duration
+	lastStatus  string // Status code of the last response, or "error"
+	lastAt      time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// providerRequests keeps the request statistics of every provider called since startup
+var providerRequests = struct {
+	sync.Mutex
+	byProvider map[string]*providerRequestStats
+}{byProvider: map[string]*providerRequestStats{}}
+
+// observeProviderRequest records one request to provider that took elapsed until its
+// response headers arrived, or failed with err, in the metrics and the status
+func observeProviderRequest(provider string, resp *http.Response, err error, elapsed time.Duration) {
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	incCounter("tracker_provider_requests_total", map[string]string{"provider": provider, "code": code}, 1)
+	labels := map[string]string{"provider": provider}
+	setGauge("tracker_provider_request_seconds", labels, elapsed.Seconds())
+	incCounter("tracker_provider_request_seconds_sum", labels, elapsed.Seconds())
+	incCounter("tracker_provider_request_seconds_count", labels, 1)
+	slog.Debug("Provider request", "provider", provider, "status", code, "elapsed", elapsed)
+
+	providerRequests.Lock()
+	defer providerRequests.Unlock()
+	s, ok := providerRequests.byProvider[provider]
+	if !ok {
+		s = &providerRequestStats{}
+		providerRequests.byProvider[provider] = s
+	}
+	now := time.Now()
+	s.requests++
+	s.total += elapsed
+	s.slowest = max(s.slowest, elapsed)
+	s.lastStatus, s.lastAt = code, now
+	switch {
+	case err != nil:
+		s.failures++
+		s.lastError, s.lastErrorAt = err.Error(), now
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotModified:
+	default:
+		s.failures++
+		if resp.StatusCode == http.StatusTooManyRequests {
+			s.throttled++
+		}
+		s.lastError, s.lastErrorAt = resp.Status, now
+	}
+}
+
+// ProviderRequestStatus is the status report of one provider's requests
+type ProviderRequestStatus struct {
+	Provider    string    `json:"provider"`
+	Requests    int       `json:"requests"`
+	Failures    int       `json:"failures"`
+	Throttled   int       `json:"throttled"`
+	MeanLatency string    `json:"mean_latency"`
+	MaxLatency  string    `json:"max_latency"`
+	LastStatus  string    `json:"last_status"` // Status code of the last response, or "error"
+	LastAt      time.Time `json:"last_at"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitempty"`
+}
+
+// collectProviderRequestStatus reports every provider that has been called
+func collectProviderRequestStatus() []ProviderRequestStatus {
+	providerRequests.Lock()
+	defer providerRequests.Unlock()
+
+	var list []ProviderRequestStatus
+	for provider, s := range providerRequests.byProvider {
+		list = append(list, ProviderRequestStatus{
+			Provider:    provider,
+			Requests:    s.requests,
+			Failures:    s.failures,
+			Throttled:   s.throttled,
+			MeanLatency: (s.total / time.Duration(s.requests)).Round(time.Millisecond).String(),
+			MaxLatency:  s.slowest.Round(time.Millisecond).String(),
+			LastStatus:  s.lastStatus,
+			LastAt:      s.lastAt,
+			LastError:   s.lastError,
+			LastErrorAt: s.lastErrorAt,
+		})
+	}
+	slices.SortFunc(list, func(a, b ProviderRequestStatus) int { return strings.Compare(a.Provider, b.Provider) })
+	return list
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto/sha256" // Package for the ETags of public responses
+	"encoding/hex"  // Package for formatting ETags
+	"encoding/json" // Package for encoding public responses
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"math"          // Package for the token buckets
+	"net"           // Package for client addresses and trusted proxies
+	"net/http"      // Package for the public endpoints
+	"net/url"       // Package for validating PUBLIC_CORS_ORIGINS
+	"os"            // Package for environment variables
+	"slices"        // Package for matching origins and currencies
+	"strconv"       // Package for parsing the limits
+	"strings"       // Package for parsing lists
+	"sync"          // Package for guarding the token buckets
+	"time"          // Package for rate limits and cache lifetimes
+)
+
+// Public mode serves a small read-only endpoint set under /public/ that is safe to
+// expose to the internet, e.g. for the latest price on a personal site: it needs no API
+// key, answers cross-origin requests from PUBLIC_CORS_ORIGINS, limits every client
+// address to PUBLIC_RATE_LIMIT requests a minute, and lets browsers and CDNs cache
+// responses for PUBLIC_CACHE_MAX_AGE. With PUBLIC_API=only, serve answers nothing else.
+
+// Values of PUBLIC_API
+const (
+	publicOff  = "off"  // No public endpoints
+	publicOn   = "on"   // Public endpoints next to the rest of the API
+	publicOnly = "only" // Public endpoints, health checks, and nothing else
+)
+
+// publicHistoryMaxRange is the longest range /public/history returns
+const publicHistoryMaxRange = 365 * 24 * time.Hour
+
+// PublicConfig controls the public endpoints
+type PublicConfig struct {
+	Mode           string        // publicOff, publicOn, or publicOnly
+	Origins        []string      // Sites allowed to call the endpoints from a browser; "*" allows any
+	RateLimit      int           // Requests per minute per client address; 0 = unlimited
+	MaxAge         time.Duration // How long responses may be cached
+	TrustedProxies []*net.IPNet  // Proxies whose X-Forwarded-For names the client
+}
+
+// publicConfig is the active configuration, loaded at startup
+var publicConfig = PublicConfig{Mode: publicOff, Origins: []string{"*"}, RateLimit: 60, MaxAge: time.Minute}
+
+// enabled reports whether the public endpoints are served
+func (c PublicConfig) enabled() bool {
+	return c.Mode != publicOff
+}
+
+// loadPublicConfig reads PUBLIC_API, PUBLIC_CORS_ORIGINS, PUBLIC_RATE_LIMIT,
+// PUBLIC_CACHE_MAX_AGE, and PUBLIC_TRUSTED_PROXIES
+func loadPublicConfig() (PublicConfig, error) {
+	c := PublicConfig{Mode: publicOff, Origins: []string{"*"}, RateLimit: 60, MaxAge: time.Minute}
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("PUBLIC_API"))); mode {
+	case "", publicOff, "false":
+	case publicOn, "true":
+		c.Mode = publicOn
+	case publicOnly:
+		c.Mode = publicOnly
+	default:
+		return c, fmt.Errorf("invalid PUBLIC_API %q (expected off, on, or only)", mode)
+	}
+
+	if v := os.Getenv("PUBLIC_CORS_ORIGINS"); v != "" {
+		c.Origins = nil
+		for _, origin := range strings.Split(v, ",") {
+			origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+			if origin == "" {
+				continue
+			}
+			if origin != "*" {
+				u, err := url.Parse(origin)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+					return c, fmt.Errorf("invalid PUBLIC_CORS_ORIGINS entry %q (expected e.g. https://blog.example.com or *)", origin)
+				}
+			}
+			c.Origins = append(c.Origins, origin)
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("PUBLIC_RATE_LIMIT")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return c, fmt.Errorf("invalid PUBLIC_RATE_LIMIT %q (expected requests per minute)", v)
+		}
+		c.RateLimit = n
+	}
+	if v := strings.TrimSpace(os.Getenv("PUBLIC_CACHE_MAX_AGE")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return c, fmt.Errorf("invalid PUBLIC_CACHE_MAX_AGE %q (expected e.g. 60s)", v)
+		}
+		c.MaxAge = d
+	}
+	for _, entry := range strings.Split(os.Getenv("PUBLIC_TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return c, fmt.Errorf("invalid PUBLIC_TRUSTED_PROXIES entry %q (expected an address or CIDR range)", entry)
+		}
+		c.TrustedProxies = append(c.TrustedProxies, network)
+	}
+	return c, nil
+}
+
+// trusted reports whether ip is one of the trusted proxies
+func (c PublicConfig) trusted(ip net.IP) bool {
+	for _, network := range c.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicClientIP returns the address a request is rate limited by: the connection's,
+// or behind trusted proxies the nearest X-Forwarded-For entry they didn't add
+func publicClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !publicConfig.trusted(ip) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		if ip = hop; !publicConfig.trusted(ip) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// publicBucket is the token bucket of one client address
+type publicBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// publicLimiter holds a token bucket per client address
+// A client may burst its whole per-minute limit, then continues at the limit's rate.
+// Buckets idle for a minute are full again and are dropped.
+var publicLimiter = struct {
+	sync.Mutex
+	buckets map[string]*publicBucket
+	swept   time.Time
+}{buckets: map[string]*publicBucket{}}
+
+// takePublicToken spends one of a client's requests; when none is left it returns how
+// long until the next one
+func takePublicToken(client string, now time.Time) time.Duration {
+	limit := publicConfig.RateLimit
+	if limit == 0 {
+		return 0
+	}
+	publicLimiter.Lock()
+	defer publicLimiter.Unlock()
+
+	if now.Sub(publicLimiter.swept) >= time.Minute {
+		for addr, b := range publicLimiter.buckets {
+			if now.Sub(b.updated) >= time.Minute {
+				delete(publicLimiter.buckets, addr)
+			}
+		}
+		publicLimiter.swept = now
+	}
+	b, ok := publicLimiter.buckets[client]
+	if !ok {
+		b = &publicBucket{tokens: float64(limit), updated: now}
+		publicLimiter.buckets[client] = b
+	}
+	perSecond := float64(limit) / 60
+	b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.updated).Seconds()*perSecond)
+	b.updated = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// setPublicCORS answers the origin of a browser request when it is allowed
+func setPublicCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	switch {
+	case slices.Contains(publicConfig.Origins, "*"):
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	case origin != "" && slices.Contains(publicConfig.Origins, origin):
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	default:
+		w.Header().Add("Vary", "Origin")
+		return
+	}
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "If-None-Match")
+		w.Header().Set("Access-Control-Max-Age", "86400")
+	}
+}
+
+// writePublicJSON writes v with an ETag and the cache lifetime, or 304 Not Modified
+// when the client already holds it
+func writePublicJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("Failed to encode public response", "path", r.URL.Path, "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to encode response")
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(publicConfig.MaxAge.Seconds())))
+	if slices.Contains(strings.Split(strings.ReplaceAll(r.Header.Get("If-None-Match"), " ", ""), ","), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(append(body, '\n'))
+	}
+}
+
+// PublicPrice is the latest price of a currency as the public endpoints show it
+type PublicPrice struct {
+	Currency  string    `json:"currency"`
+	Price     float64   `json:"price"`
+	Timestamp time.Time `json:"timestamp"`
+	PriceChanges
+}
+
+// PublicHistory is the price history of a currency as the public endpoints show it
+type PublicHistory struct {
+	Currency   string        `json:"currency"`
+	Resolution string        `json:"resolution"`
+	Points     []PublicPoint `json:"points"`
+}
+
+// PublicPoint is the close of one candle of a PublicHistory
+type PublicPoint struct {
+	Time  time.Time `json:"time"`
+	Price float64   `json:"price"`
+}
+
+// handlePublic serves the public endpoints, after CORS and the per-address rate limit:
+//
+//	GET /public/latest?currency=usd   latest price and its change over 24h, 7d, and 30d
+//	GET /public/history?currency=usd&range=7d   candle closes, hourly up to 30 days
+func (s *apiServer) handlePublic(w http.ResponseWriter, r *http.Request) {
+	if !publicConfig.enabled() {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	setPublicCORS(w, r)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if wait := takePublicToken(publicClientIP(r), time.Now()); wait > 0 {
+		incCounter("tracker_public_rate_limited_total", nil, 1)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeAPIError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+	incCounter("tracker_public_requests_total", map[string]string{"path": r.URL.Path}, 1)
+
+	currency := requestCurrency(r)
+	if !slices.Contains(currencies, currency) {
+		writeAPIError(w, http.StatusBadRequest, "currency %q is not tracked", currency)
+		return
+	}
+	switch r.URL.Path {
+	case "/public/latest":
+		handlePublicLatest(s.repo, w, r, currency)
+	case "/public/history":
+		handlePublicHistory(s.repo, w, r, currency)
+	default:
+		writeAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// handlePublicLatest serves GET /public/latest
+func handlePublicLatest(repo *Repository, w http.ResponseWriter, r *http.Request, currency string) {
+	prices, err := repo.LatestPrices(r.Context(), 1, currency)
+	if err != nil {
+		slog.Error("Public API failed to fetch latest price", "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query prices")
+		return
+	}
+	if len(prices) == 0 {
+		writeAPIError(w, http.StatusNotFound, "no prices recorded for %s", currency)
+		return
+	}
+	changes, err := priceChanges(r.Context(), repo, prices[0])
+	if err != nil {
+		slog.Error("Public API failed to compute price changes", "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query prices")
+		return
+	}
+	setAttribution(w, recordSources(prices))
+	writePublicJSON(w, r, PublicPrice{Currency: currency, Price: prices[0].Price, Timestamp: prices[0].Timestamp.UTC(), PriceChanges: changes})
+}
+
+// handlePublicHistory serves GET /public/history
+func handlePublicHistory(repo *Repository, w http.ResponseWriter, r *http.Request, currency string) {
+	span := 7 * 24 * time.Hour
+	if v := r.URL.Query().Get("range"); v != "" {
+		d, err := parseStatsWindow(v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		span = d
+	}
+	if span > publicHistoryMaxRange {
+		writeAPIError(w, http.StatusBadRequest, "range is longer than the %dd the public history allows", int(publicHistoryMaxRange.Hours()/24))
+		return
+	}
+
+	now := time.Now()
+	history := PublicHistory{Currency: currency, Resolution: embedResolution(span), Points: []PublicPoint{}}
+	candles, err := repo.Candles(r.Context(), currency, history.Resolution, now.Add(-span), now, maxRangeLimit)
+	if err != nil {
+		slog.Error("Public API failed to load price history", "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query prices")
+		return
+	}
+	for _, c := range candles {
+		history.Points = append(history.Points, PublicPoint{Time: c.Start.UTC(), Price: c.Close})
+	}
+	writePublicJSON(w, r, history)
+}
+
+// newPublicHandler serves the public endpoints and health checks only, for PUBLIC_API=only
+func newPublicHandler(repo *Repository) http.Handler {
+	s := &apiServer{repo: repo}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/public/", s.handlePublic)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not found")
+	})
+	return withTracing(withAttribution(mux))
+}
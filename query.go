@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"       // Package for the query timeout
+	"encoding/csv"  // Package for CSV output
+	"encoding/json" // Package for JSON output
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for reading the statement from stdin
+	"os"            // Package for environment variables and output
+	"regexp"        // Package for checking statements
+	"strconv"       // Package for parsing QUERY_MAX_ROWS
+	"strings"       // Package for string manipulation
+	"time"          // Package for timeouts and timestamp output
+	"unicode/utf8"  // Package for truncating wide cells
+)
+
+// QueryConfig holds the safety rails of the query command
+type QueryConfig struct {
+	MaxRows int           // Most rows a query may return; --limit can only lower it
+	Timeout time.Duration // Longest a query may run; --timeout can only lower it
+	Role    string        // PostgreSQL role queries run as (empty = the tracker's own)
+}
+
+// queryConfig is the active configuration, loaded at startup
+var queryConfig = QueryConfig{MaxRows: 1000, Timeout: 30 * time.Second}
+
+// loadQueryConfig reads QUERY_MAX_ROWS, QUERY_TIMEOUT, and QUERY_ROLE
+func loadQueryConfig() (QueryConfig, error) {
+	c := QueryConfig{MaxRows: 1000, Timeout: 30 * time.Second, Role: os.Getenv("QUERY_ROLE")}
+	if v := os.Getenv("QUERY_MAX_ROWS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c, fmt.Errorf("invalid QUERY_MAX_ROWS %q", v)
+		}
+		c.MaxRows = n
+	}
+	if v := os.Getenv("QUERY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid QUERY_TIMEOUT %q", v)
+		}
+		c.Timeout = d
+	}
+	return c, nil
+}
+
+// QueryResult is the outcome of an ad-hoc query
+type QueryResult struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated"` // More rows matched than were returned
+}
+
+// readOnlyStatement matches the statements the query command accepts
+var readOnlyStatement = regexp.MustCompile(`(?is)^\s*(select|with|values|table|explain)\b`)
+
+// forbiddenQueryCalls are functions that change session settings, which could undo
+// the read-only transaction's role or timeout
+var forbiddenQueryCalls = regexp.MustCompile(`(?i)\b(set_config|pg_reload_conf|dblink\w*)\s*\(`)
+
+// checkQueryStatement rejects anything but a single read-only statement, and returns
+// it without a trailing semicolon. The database enforces read-only access regardless;
+// this gives a clear error early and keeps a second statement, such as a COMMIT, from
+// running outside the transaction's settings. Semicolons inside literals and comments
+// don't count, so `SELECT ';'` is one statement.
+func checkQueryStatement(statement string) (string, error) {
+	statements := queryStatements(statement)
+	switch {
+	case len(statements) == 0:
+		return "", validationErrorf("no statement given")
+	case len(statements) > 1:
+		return "", validationErrorf("only a single statement may be run, not %d", len(statements))
+	}
+	statement = statements[0]
+	if !readOnlyStatement.MatchString(statement) {
+		return "", validationErrorf("only SELECT, WITH, VALUES, TABLE, and EXPLAIN statements are allowed")
+	}
+	if m := forbiddenQueryCalls.FindString(statement); m != "" {
+		return "", validationErrorf("%s) is not allowed in queries", strings.TrimSpace(m))
+	}
+	return statement, nil
+}
+
+// queryStatements splits sql at the semicolons outside string literals, quoted
+// identifiers, dollar-quoted strings, and comments, and returns the statements that
+// aren't empty
+func queryStatements(sql string) []string {
+	var statements []string
+	add := func(statement string) {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(sql); {
+		switch {
+		case sql[i] == '\'' || sql[i] == '"' || sql[i] == '`':
+			i = skipQuoted(sql, i)
+		case strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i)
+		case sql[i] == '$':
+			i = skipDollarQuoted(sql, i)
+		case sql[i] == ';':
+			add(sql[start:i])
+			i++
+			start = i
+		default:
+			i++
+		}
+	}
+	add(sql[start:])
+	return statements
+}
+
+// isIdentByte reports whether c can be part of an unquoted identifier
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// skipQuoted returns the index after the quoted string or identifier starting at i; a
+// doubled quote stands for itself, and in E'...' strings a backslash escapes
+func skipQuoted(sql string, i int) int {
+	quote := sql[i]
+	backslashes := quote == '\'' && i > 0 && (sql[i-1] == 'e' || sql[i-1] == 'E') && (i == 1 || !isIdentByte(sql[i-2]))
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case backslashes && sql[j] == '\\':
+			j++
+		case sql[j] != quote:
+		case j+1 < len(sql) && sql[j+1] == quote:
+			j++
+		default:
+			return j + 1
+		}
+	}
+	return len(sql) // Unterminated; the database reports it
+}
+
+// skipBlockComment returns the index after the /* */ comment starting at i, which may
+// nest as in PostgreSQL
+func skipBlockComment(sql string, i int) int {
+	depth := 0
+	for j := i; j+1 < len(sql); j++ {
+		switch sql[j : j+2] {
+		case "/*":
+			depth++
+			j++
+		case "*/":
+			if depth--; depth == 0 {
+				return j + 2
+			}
+			j++
+		}
+	}
+	return len(sql)
+}
+
+// skipDollarQuoted returns the index after the $tag$...$tag$ string starting at i, or
+// i+1 when the $ starts none, as in a $1 parameter
+func skipDollarQuoted(sql string, i int) int {
+	if i > 0 && isIdentByte(sql[i-1]) {
+		return i + 1 // Part of an identifier
+	}
+	j := i + 1
+	for j < len(sql) && isIdentByte(sql[j]) {
+		j++
+	}
+	if j == len(sql) || sql[j] != '$' || (j > i+1 && sql[i+1] >= '0' && sql[i+1] <= '9') {
+		return i + 1
+	}
+	tag := sql[i : j+1]
+	end := strings.Index(sql[j+1:], tag)
+	if end < 0 {
+		return len(sql)
+	}
+	return j + 1 + end + len(tag)
+}
+
+// formatQueryValue renders a value for table and CSV output
+func formatQueryValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// queryCellWidth is the widest a table cell is printed; longer values are cut
+const queryCellWidth = 40
+
+// printQueryTable writes a result as an aligned text table
+func printQueryTable(w io.Writer, result QueryResult) {
+	cells := make([][]string, len(result.Rows))
+	widths := make([]int, len(result.Columns))
+	for i, c := range result.Columns {
+		widths[i] = utf8.RuneCountInString(c)
+	}
+	for r, row := range result.Rows {
+		cells[r] = make([]string, len(row))
+		for i, v := range row {
+			s := strings.ReplaceAll(formatQueryValue(v), "\n", " ")
+			if utf8.RuneCountInString(s) > queryCellWidth {
+				s = string([]rune(s)[:queryCellWidth-1]) + "…"
+			}
+			cells[r][i] = s
+			widths[i] = max(widths[i], utf8.RuneCountInString(s))
+		}
+	}
+
+	line := func(values []string) {
+		for i, v := range values {
+			if i > 0 {
+				fmt.Fprint(w, " | ")
+			}
+			fmt.Fprint(w, v+strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v)))
+		}
+		fmt.Fprintln(w)
+	}
+	line(result.Columns)
+	for i, width := range widths {
+		if i > 0 {
+			fmt.Fprint(w, "-+-")
+		}
+		fmt.Fprint(w, strings.Repeat("-", width))
+	}
+	fmt.Fprintln(w)
+	for _, row := range cells {
+		line(row)
+	}
+}
+
+// writeQueryCSV writes a result as CSV with a header row
+func writeQueryCSV(w io.Writer, result QueryResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(result.Columns); err != nil {
+		return err
+	}
+	for _, row := range result.Rows {
+		record := make([]string, len(row))
+		for i, v := range row {
+			if v != nil {
+				record[i] = formatQueryValue(v)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// runQueryCommand handles `query [--limit N] [--timeout 10s] [--format table|csv|json] "SELECT ..."`
+// A statement of "-" is read from stdin
+func runQueryCommand(repo *Repository, args []string) error {
+	fs := newFlagSet("query")
+	limit := fs.Int("limit", queryConfig.MaxRows, "Most rows to return (at most QUERY_MAX_ROWS)")
+	timeout := fs.Duration("timeout", queryConfig.Timeout, "Longest the query may run (at most QUERY_TIMEOUT)")
+	format := fs.String("format", "table", "Output format: table, csv, or json")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if *limit < 1 || *limit > queryConfig.MaxRows {
+		return validationErrorf("--limit must be between 1 and %d (QUERY_MAX_ROWS)", queryConfig.MaxRows)
+	}
+	if *timeout <= 0 || *timeout > queryConfig.Timeout {
+		return validationErrorf("--timeout must be positive and at most %s (QUERY_TIMEOUT)", queryConfig.Timeout)
+	}
+	if *format != "table" && *format != "csv" && *format != "json" {
+		return validationErrorf("unknown --format %q (expected table, csv, or json)", *format)
+	}
+
+	statement := strings.Join(fs.Args(), " ")
+	if statement == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read statement: %w", err)
+		}
+		statement = string(b)
+	}
+	statement, err := checkQueryStatement(statement)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	start := time.Now()
+	result, err := repo.ReadOnlyQuery(ctx, statement, *limit)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("query exceeded the %s timeout", *timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+
+	switch *format {
+	case "csv":
+		return writeQueryCSV(os.Stdout, result)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	printQueryTable(os.Stdout, result)
+	if result.Truncated {
+		fmt.Printf("(first %d rows; raise --limit up to QUERY_MAX_ROWS to see more)\n", len(result.Rows))
+	} else {
+		fmt.Printf("(%d rows, %s)\n", len(result.Rows), time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"slices"  // Package for comparing statement lists
+	"testing" // Package for the tests
+)
+
+func TestQueryStatements(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []string
+	}{
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"  SELECT 1 ;; ", []string{"SELECT 1"}},
+		{"SELECT 1; SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"SELECT 1; COMMIT; DELETE FROM bitcoin_prices", []string{"SELECT 1", "COMMIT", "DELETE FROM bitcoin_prices"}},
+
+		// Semicolons that don't end a statement
+		{"SELECT ';'", []string{"SELECT ';'"}},
+		{"SELECT 'it''s; fine'", []string{"SELECT 'it''s; fine'"}},
+		{`SELECT E'\'; x'`, []string{`SELECT E'\'; x'`}},
+		{`SELECT 1 AS "a;b"`, []string{`SELECT 1 AS "a;b"`}},
+		{"SELECT 1 -- one; two\n", []string{"SELECT 1 -- one; two"}},
+		{"SELECT /* a /* nested; */ b; */ 1", []string{"SELECT /* a /* nested; */ b; */ 1"}},
+		{"SELECT $$;$$, $x$ ; $x$", []string{"SELECT $$;$$, $x$ ; $x$"}},
+
+		// A $ that starts no dollar-quoted string
+		{"SELECT $1; SELECT 2", []string{"SELECT $1", "SELECT 2"}},
+
+		// A backslash only escapes in E'' strings
+		{`SELECT '\'; SELECT 2`, []string{`SELECT '\'`, "SELECT 2"}},
+	}
+	for _, tt := range tests {
+		if got := queryStatements(tt.sql); !slices.Equal(got, tt.want) {
+			t.Errorf("queryStatements(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestCheckQueryStatement(t *testing.T) {
+	for _, statement := range []string{"SELECT ';' AS semicolon;", "WITH x AS (SELECT 1) SELECT * FROM x"} {
+		if _, err := checkQueryStatement(statement); err != nil {
+			t.Errorf("checkQueryStatement(%q) = %v, want it accepted", statement, err)
+		}
+	}
+	for _, statement := range []string{"", " ; ", "SELECT 1; COMMIT", "DELETE FROM bitcoin_prices", "SELECT set_config('role', 'postgres', false)"} {
+		_, err := checkQueryStatement(statement)
+		if errorKind(err) != KindValidation {
+			t.Errorf("checkQueryStatement(%q) = %v, want a validation error", statement, err)
+		}
+	}
+}
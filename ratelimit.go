@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"  // Package for waiting within the fetch deadline
+	"errors"   // Package for the rate limit sentinel error
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"net/http" // Package for rate limit response headers
+	"os"       // Package for environment variables
+	"slices"   // Package for sorting provider names
+	"strconv"  // Package for parsing limits and headers
+	"strings"  // Package for parsing RATE_LIMITS
+	"sync"     // Package for guarding limiter state
+	"time"     // Package for request spacing
+
+	"bitcoin-tracker/tracker" // Retry-After parsing
+)
+
+// RateLimit is how many requests a provider accepts per period
+type RateLimit struct {
+	Requests int           // 0 = unlimited
+	Per      time.Duration // Period the requests are spread over
+}
+
+// String returns the limit in RATE_LIMITS form, e.g. "30/1m0s"
+func (l RateLimit) String() string {
+	if l.Requests == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// spacing is the minimum gap between two requests
+func (l RateLimit) spacing() time.Duration {
+	if l.Requests == 0 {
+		return 0
+	}
+	return l.Per / time.Duration(l.Requests)
+}
+
+// defaultRateLimits follow each provider's published limits for anonymous use
+// CoinGecko's depend on the API plan; see coinGeckoRateLimit
+var defaultRateLimits = map[string]RateLimit{
+	"coinbase": {Requests: 10, Per: time.Second},
+	"binance":  {Requests: 20, Per: time.Second},
+	"kraken":   {Requests: 1, Per: time.Second},
+}
+
+// rateLimits holds the active per-provider limits, loaded at startup
+var rateLimits = map[string]RateLimit{}
+
+// errRateLimited is returned when a provider's quota won't free up before the fetch deadline
+var errRateLimited = errors.New("provider rate limit exhausted")
+
+// loadRateLimits reads RATE_LIMITS, e.g. "coingecko=30/1m,kraken=1/1s"; "provider=0" disables
+// spacing for a provider. Call it after the CoinGecko plan has been loaded.
+func loadRateLimits() (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit, len(defaultRateLimits)+1)
+	for provider, l := range defaultRateLimits {
+		limits[provider] = l
+	}
+	limits["coingecko"] = coinGeckoRateLimit(coinGeckoAPI.Plan)
+
+	v := os.Getenv("RATE_LIMITS")
+	if v == "" {
+		return limits, nil
+	}
+	for _, entry := range strings.Split(v, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		provider, limit, ok := strings.Cut(entry, "=")
+		provider = strings.ToLower(strings.TrimSpace(provider))
+		if _, known := availableSources[provider]; !ok || !known {
+			return nil, fmt.Errorf("invalid RATE_LIMITS entry %q (expected provider=requests/period)", entry)
+		}
+		if strings.TrimSpace(limit) == "0" {
+			limits[provider] = RateLimit{}
+			continue
+		}
+		count, period, ok := strings.Cut(limit, "/")
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if !ok || err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid RATE_LIMITS entry %q (expected provider=requests/period)", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(period))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid RATE_LIMITS entry %q: bad period %q", entry, period)
+		}
+		limits[provider] = RateLimit{Requests: n, Per: d}
+	}
+	return limits, nil
+}
+
+// providerQuota is what the limiter knows about one provider
+type providerQuota struct {
+	next        time.Time // Earliest time the next request may start
+	remaining   int       // Requests left according to the last response (-1 = unknown)
+	reset       time.Time // When the provider's quota resets (zero = unknown)
+	pausedUntil time.Time // No requests until then (quota exhausted or 429)
+	waited      time.Duration
+}
+
+// rateLimiter spaces requests per provider and pauses providers that ran out of quota
+var rateLimiter = struct {
+	sync.Mutex
+	quotas map[string]*providerQuota
+}{quotas: map[string]*providerQuota{}}
+
+// quota returns the state of a provider; the caller holds rateLimiter
+func quota(provider string) *providerQuota {
+	q, ok := rateLimiter.quotas[provider]
+	if !ok {
+		q = &providerQuota{remaining: -1}
+		rateLimiter.quotas[provider] = q
+	}
+	return q
+}
+
+// waitRateLimit blocks until provider may be called again: requests are spaced by the
+// provider's limit, and a provider whose quota is exhausted is paused until it resets
+// If that is past ctx's deadline it returns errRateLimited right away, so the caller can
+// fail over to another source instead of waiting for a request it can't make in time
+func waitRateLimit(ctx context.Context, provider string) error {
+	rateLimiter.Lock()
+	q := quota(provider)
+	now := time.Now()
+	at := now
+	if q.next.After(at) {
+		at = q.next
+	}
+	paused := q.pausedUntil.After(at)
+	if paused {
+		at = q.pausedUntil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(at) {
+		rateLimiter.Unlock()
+		if paused {
+			return fmt.Errorf("%w: %s paused until %s", errRateLimited, provider, at.Format(time.TimeOnly))
+		}
+		return fmt.Errorf("%w: next %s request not before %s", errRateLimited, provider, at.Format(time.TimeOnly))
+	}
+	// Reserve the slot before sleeping so concurrent callers queue up behind it
+	q.next = at.Add(rateLimits[provider].spacing())
+	wait := at.Sub(now)
+	q.waited += wait
+	rateLimiter.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	if paused {
+		slog.Info("Provider quota exhausted, waiting for it to reset", "provider", provider, "wait", wait.Round(time.Second))
+	} else {
+		slog.Debug("Spacing provider request", "provider", provider, "wait", wait.Round(time.Millisecond))
+	}
+	incCounter("tracker_rate_limit_waits_total", map[string]string{"provider": provider}, 1)
+	return sleepContext(ctx, wait)
+}
+
+// observeRateLimit updates a provider's quota from a response
+// It understands the common X-RateLimit-Remaining/X-RateLimit-Reset headers, and a
+// 429 Too Many Requests pauses the provider for its Retry-After (one period without one)
+func observeRateLimit(provider string, resp *http.Response) {
+	rateLimiter.Lock()
+	defer rateLimiter.Unlock()
+	q := quota(provider)
+	now := time.Now()
+
+	if v := resp.Header.Get("X-RateLimit-Remaining"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			q.remaining = n
+			setGauge("tracker_rate_limit_remaining", map[string]string{"provider": provider}, float64(n))
+		}
+	}
+	if v := resp.Header.Get("X-RateLimit-Reset"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			// Providers send either a Unix time or the seconds left in the window
+			if n > 1e9 {
+				q.reset = time.Unix(n, 0)
+			} else {
+				q.reset = now.Add(time.Duration(n) * time.Second)
+			}
+		}
+	}
+
+	pause := time.Time{}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		wait := tracker.ParseRetryAfter(resp.Header.Get("Retry-After"))
+		if wait == 0 {
+			wait = max(rateLimits[provider].Per, time.Minute)
+		}
+		pause = now.Add(wait)
+	case q.remaining == 0 && q.reset.After(now):
+		pause = q.reset
+	}
+	if pause.After(q.pausedUntil) {
+		q.pausedUntil = pause
+		slog.Warn("Provider rate limit reached, pausing requests", "provider", provider, "until", pause.Format(time.TimeOnly))
+	}
+}
+
+// RateLimitStatus describes a provider's rate limit for the status command
+type RateLimitStatus struct {
+	Provider    string    `json:"provider"`
+	Limit       string    `json:"limit"`
+	Remaining   int       `json:"remaining"` // From the last response's headers; -1 when not reported
+	PausedUntil time.Time `json:"paused_until,omitempty"`
+	Waited      string    `json:"waited"` // Total time requests were held back since startup
+}
+
+// collectRateLimitStatus reports every provider that has been called
+func collectRateLimitStatus() []RateLimitStatus {
+	rateLimiter.Lock()
+	defer rateLimiter.Unlock()
+
+	var list []RateLimitStatus
+	for provider, q := range rateLimiter.quotas {
+		s := RateLimitStatus{
+			Provider:  provider,
+			Limit:     rateLimits[provider].String(),
+			Remaining: q.remaining,
+			Waited:    q.waited.Round(time.Millisecond).String(),
+		}
+		if q.pausedUntil.After(time.Now()) {
+			s.PausedUntil = q.pausedUntil
+		}
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b RateLimitStatus) int { return strings.Compare(a.Provider, b.Provider) })
+	return list
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"         // Package for compressing bodies
+	"compress/gzip" // Package for the stored body format
+	"context"       // Package for marking price fetches
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for decompressing bodies
+	"log/slog"      // Package for structured logging
+	"os"            // Package for environment variables and the show output
+	"strconv"       // Package for parsing RAW_RESPONSES and IDs
+	"strings"       // Package for string manipulation
+	"sync"          // Package for guarding the pruning time
+	"time"          // Package for timestamps and retention
+)
+
+// Prices are parsed out of the providers' responses and the rest is dropped. With
+// RAW_RESPONSES, the response bodies of price fetches (and backfills) are also stored
+// gzip-compressed in raw_responses, as they were received, so fields the tracker didn't
+// parse at the time (volume, market cap, ...) can still be extracted from them later.
+// Responses reused from the provider cache aren't stored again. Stored responses are
+// removed after RAW_RESPONSE_RETENTION.
+
+// rawResponsePruneInterval is how often responses past their retention are removed
+const rawResponsePruneInterval = time.Hour
+
+// RawResponse is a provider response as it was received
+type RawResponse struct {
+	ID        int
+	Provider  string
+	Asset     string
+	URL       string
+	Size      int    // Size of the body before compression
+	Body      []byte // gzip-compressed body; only loaded by RawResponse
+	FetchedAt time.Time
+}
+
+// RawResponseConfig controls storing raw responses
+type RawResponseConfig struct {
+	Enabled   bool
+	Retention time.Duration // How long responses are kept; 0 keeps them forever
+}
+
+// rawResponseConfig is the active configuration, loaded at startup
+var rawResponseConfig = RawResponseConfig{Retention: 30 * 24 * time.Hour}
+
+// loadRawResponseConfig reads RAW_RESPONSES (true/false) and RAW_RESPONSE_RETENTION
+// (e.g. 30d; 0 keeps them forever)
+func loadRawResponseConfig() (RawResponseConfig, error) {
+	c := RawResponseConfig{Retention: 30 * 24 * time.Hour}
+	if v := os.Getenv("RAW_RESPONSES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid RAW_RESPONSES %q (expected true or false)", v)
+		}
+		c.Enabled = b
+	}
+	if v := os.Getenv("RAW_RESPONSE_RETENTION"); v != "" {
+		if v == "0" {
+			c.Retention = 0
+		} else {
+			d, err := parseStatsWindow(v)
+			if err != nil || d <= 0 {
+				return c, fmt.Errorf("invalid RAW_RESPONSE_RETENTION %q (expected a duration, e.g. 30d, or 0)", v)
+			}
+			c.Retention = d
+		}
+	}
+	return c, nil
+}
+
+// rawCaptureKey marks the context of a request whose response is worth keeping
+type rawCaptureKey struct{}
+
+// captureRawResponses marks ctx so getJSON stores the responses requested with it
+func captureRawResponses(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rawCaptureKey{}, true)
+}
+
+// capturesRawResponses reports whether the responses of requests made with ctx are stored
+func capturesRawResponses(ctx context.Context, repo *Repository) bool {
+	return rawResponseConfig.Enabled && repo != nil && ctx.Value(rawCaptureKey{}) != nil
+}
+
+// rawResponsePrune holds when responses past their retention were last removed
+var rawResponsePrune struct {
+	sync.Mutex
+	last time.Time
+}
+
+// keepRawResponse compresses and stores a response body, and removes the responses past
+// their retention once in a while. Failures are logged; they never fail the fetch.
+func keepRawResponse(ctx context.Context, repo *Repository, provider, asset, url string, body []byte) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(body); err != nil || zw.Close() != nil {
+		slog.Warn("Failed to compress raw response", "provider", provider, "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	r := RawResponse{Provider: provider, Asset: asset, URL: url, Size: len(body), Body: compressed.Bytes(), FetchedAt: now}
+	if _, err := repo.SaveRawResponse(ctx, r); err != nil {
+		slog.Warn("Failed to store raw response", "provider", provider, "error", err)
+		return
+	}
+	incCounter("tracker_raw_responses_total", map[string]string{"provider": provider}, 1)
+	incCounter("tracker_raw_response_bytes_total", map[string]string{"provider": provider}, float64(compressed.Len()))
+
+	rawResponsePrune.Lock()
+	defer rawResponsePrune.Unlock()
+	if rawResponseConfig.Retention <= 0 || now.Sub(rawResponsePrune.last) < rawResponsePruneInterval {
+		return
+	}
+	rawResponsePrune.last = now
+	if n, err := repo.PruneRawResponses(ctx, now.Add(-rawResponseConfig.Retention)); err != nil {
+		slog.Warn("Failed to prune raw responses", "error", err)
+	} else if n > 0 {
+		slog.Info("Pruned raw responses", "responses", n, "retention", rawResponseConfig.Retention)
+	}
+}
+
+// decompress returns the body of a stored response as it was received
+func (r RawResponse) decompress() ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(r.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress raw response %d: %w", r.ID, err)
+	}
+	defer zr.Close()
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress raw response %d: %w", r.ID, err)
+	}
+	return body, nil
+}
+
+// runRawResponsesCommand handles the raw-responses subcommands:
+//
+//	raw-responses list [--provider name] [--before time] [--limit 20]
+//	raw-responses show <id>
+func runRawResponsesCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: raw-responses list|show")
+	}
+
+	switch args[0] {
+	case "list":
+		fs := newFlagSet("raw-responses list")
+		provider := fs.String("provider", "", "Only the responses of this provider, e.g. coingecko")
+		beforeFlag := fs.String("before", "", "Only responses received before this time, e.g. 2025-06-01 (default: now)")
+		limit := fs.Int("limit", 20, "Number of responses to show, newest first")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if *limit < 1 {
+			return validationErrorf("invalid --limit %d", *limit)
+		}
+		before := time.Now()
+		if *beforeFlag != "" {
+			t, err := parsePriceTime(*beforeFlag)
+			if err != nil {
+				return err
+			}
+			before = t
+		}
+
+		responses, err := repo.RawResponses(ctx, strings.ToLower(*provider), before, *limit)
+		if err != nil {
+			return err
+		}
+		if len(responses) == 0 {
+			if !rawResponseConfig.Enabled {
+				return fmt.Errorf("no raw responses stored; set RAW_RESPONSES=true to keep them")
+			}
+			slog.Info("No raw responses stored yet")
+			return nil
+		}
+		fmt.Printf("\n%-8s %-20s %-12s %-10s %9s  %s\n", "ID", "Received", "Provider", "Asset", "Size", "URL")
+		fmt.Println("------------------------------------------------------------------------------------------")
+		for _, r := range responses {
+			fmt.Printf("%-8d %-20s %-12s %-10s %9s  %s\n", r.ID, r.FetchedAt.In(displayLocation).Format("2006-01-02 15:04:05"),
+				r.Provider, r.Asset, formatPriceAt(float64(r.Size), 0)+" B", r.URL)
+		}
+		fmt.Println()
+		return nil
+
+	case "show":
+		if len(args) != 2 {
+			return validationErrorf("usage: raw-responses show <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil || id < 1 {
+			return validationErrorf("invalid response ID %q", args[1])
+		}
+		r, ok, err := repo.RawResponse(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return validationErrorf("no raw response with id %d", id)
+		}
+		body, err := r.decompress()
+		if err != nil {
+			return err
+		}
+		// The body goes to stdout as received, ready to pipe into a parser
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+	return validationErrorf("unknown raw-responses subcommand %q (expected list or show)", args[0])
+}
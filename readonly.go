@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"  // Package for the Store method signatures
+	"errors"   // Package for the read-only error
+	"flag"     // Package for the --dry-run and --read-only flags
+	"fmt"      // Package for formatted errors
+	"log/slog" // Package for logging skipped writes
+	"net/http" // Package for refusing API writes
+	"os"       // Package for environment variables
+	"strconv"  // Package for parsing READ_ONLY
+	"strings"  // Package for matching API paths
+	"time"     // Package for the Store method signatures
+)
+
+// Database write modes; the normal mode is the empty string
+const (
+	writeModeDryRun   = "dry-run"   // Writes are logged and skipped, and reported as done
+	writeModeReadOnly = "read-only" // Writes fail with errReadOnly
+)
+
+// dryRunFlag skips every database write and logs it instead, e.g. to try a provider or
+// configuration change against a production database
+var dryRunFlag = flag.Bool("dry-run", false, "fetch as usual but only log what would be written to the database")
+
+// readOnlyFlag refuses every database write, like READ_ONLY=true
+var readOnlyFlag = flag.Bool("read-only", false, "refuse every write to the database (overrides READ_ONLY)")
+
+// writeMode is the active write mode, set when the database is opened
+var writeMode string
+
+// errReadOnly is returned by every write in read-only mode
+var errReadOnly = withKind(KindAuth, errors.New("the database is read-only (--read-only or READ_ONLY)"))
+
+// loadWriteMode reads --dry-run, --read-only, and READ_ONLY
+func loadWriteMode() (string, error) {
+	readOnly := *readOnlyFlag
+	if v := os.Getenv("READ_ONLY"); v != "" && !readOnly {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid READ_ONLY %q", v)
+		}
+		readOnly = b
+	}
+	switch {
+	case readOnly && *dryRunFlag:
+		return "", fmt.Errorf("--dry-run and read-only mode can't be combined")
+	case readOnly:
+		return writeModeReadOnly, nil
+	case *dryRunFlag:
+		return writeModeDryRun, nil
+	}
+	return "", nil
+}
+
+// guardStore wraps s in a guardedStore when --dry-run, --read-only, or READ_ONLY asks
+// for one, and sets writeMode
+func guardStore(s Store) (Store, error) {
+	mode, err := loadWriteMode()
+	if err != nil {
+		return s, withKind(KindConfig, err)
+	}
+	writeMode = mode
+	if mode == "" {
+		return s, nil
+	}
+	slog.Warn("Database writes are disabled", "mode", mode)
+	return &guardedStore{Store: s, mode: mode}, nil
+}
+
+// guardedStore keeps writes away from the database in dry-run and read-only mode
+// Reads go to the embedded backend. Writes that take a dryRun argument run as dry runs,
+// so they still report what they would change. Bookkeeping a read causes, such as
+// counting API key and passkey use, is skipped silently rather than failing the read.
+type guardedStore struct {
+	Store
+	mode string // writeModeDryRun or writeModeReadOnly
+}
+
+// refuse returns what a skipped write of rows rows returns: nil after logging it in
+// dry-run mode, errReadOnly in read-only mode
+func (s *guardedStore) refuse(write string, rows int) error {
+	if s.mode == writeModeReadOnly {
+		return errReadOnly
+	}
+	slog.Info("Dry run: skipped database write", "write", write, "rows", rows)
+	return nil
+}
+
+// Init implements Store
+// The schema is checked rather than migrated: a guarded store must not change it either.
+func (s *guardedStore) Init() error {
+	migrations, err := s.Store.Migrations()
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, m := range migrations {
+		if m.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("the database schema is %d migrations behind; run migrate up without --%s first", pending, s.mode)
+	}
+	return nil
+}
+
+// MigrateUp implements Store
+func (s *guardedStore) MigrateUp(int) ([]Migration, error) {
+	return nil, s.refuse("MigrateUp", 0)
+}
+
+// MigrateDown implements Store
+func (s *guardedStore) MigrateDown(int) ([]Migration, error) {
+	return nil, s.refuse("MigrateDown", 0)
+}
+
+// SavePrices implements Store
+// In dry-run mode every price is logged as it would be stored; the records keep an ID
+// of 0, so nothing downstream of a new price runs.
+func (s *guardedStore) SavePrices(ctx context.Context, records []PriceRecord) error {
+	if s.mode == writeModeReadOnly {
+		return errReadOnly
+	}
+	for _, r := range records {
+		slog.Info("Dry run: would save price", "coin", "bitcoin", "price", roundPriceIn(r.Currency, r.Price), "currency", r.Currency, "source", r.Source,
+			"latency", time.Duration(r.Latency*float64(time.Second)).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// SaveHistoricalPrices implements Store
+func (s *guardedStore) SaveHistoricalPrices(ctx context.Context, records []PriceRecord) (int, error) {
+	return 0, s.refuse("SaveHistoricalPrices", len(records))
+}
+
+// DownsamplePrices implements Store
+func (s *guardedStore) DownsamplePrices(resolution string, from, before time.Time, dryRun bool) (int, int, error) {
+	if !dryRun {
+		if err := s.refuse("DownsamplePrices", 0); err != nil {
+			return 0, 0, err
+		}
+	}
+	return s.Store.DownsamplePrices(resolution, from, before, true)
+}
+
+// PurgePrices implements Store
+func (s *guardedStore) PurgePrices(before time.Time, dryRun bool) (int, error) {
+	if !dryRun {
+		if err := s.refuse("PurgePrices", 0); err != nil {
+			return 0, err
+		}
+	}
+	return s.Store.PurgePrices(before, true)
+}
+
+// DeletePrices implements Store
+func (s *guardedStore) DeletePrices(from, to time.Time, maxID int) (int, error) {
+	return 0, s.refuse("DeletePrices", 0)
+}
+
+// DedupePrices implements Store
+func (s *guardedStore) DedupePrices(window time.Duration, dryRun bool) (int, error) {
+	if !dryRun {
+		if err := s.refuse("DedupePrices", 0); err != nil {
+			return 0, err
+		}
+	}
+	return s.Store.DedupePrices(window, true)
+}
+
+// RecordAPICall implements Store; calls are only counted in the metrics, like in relay mode
+func (s *guardedStore) RecordAPICall(provider, asset string, window time.Duration) error {
+	return nil
+}
+
+// SaveReference implements Store
+func (s *guardedStore) SaveReference(ref ReferencePrice) error {
+	return s.refuse("SaveReference", 1)
+}
+
+// DeleteReference implements Store
+func (s *guardedStore) DeleteReference(name string) error {
+	return s.refuse("DeleteReference", 1)
+}
+
+// SaveHolding implements Store
+func (s *guardedStore) SaveHolding(h Holding) (int, error) {
+	return 0, s.refuse("SaveHolding", 1)
+}
+
+// DeleteHolding implements Store
+func (s *guardedStore) DeleteHolding(tenant string, id int) error {
+	return s.refuse("DeleteHolding", 1)
+}
+
+// SellHoldings implements Store
+func (s *guardedStore) SellHoldings(disposals []Disposal, remaining []Holding) error {
+	return s.refuse("SellHoldings", len(disposals))
+}
+
+// SaveTrades implements Store
+func (s *guardedStore) SaveTrades(ctx context.Context, trades []Trade) error {
+	return s.refuse("SaveTrades", len(trades))
+}
+
+// DeleteTrade implements Store
+func (s *guardedStore) DeleteTrade(ctx context.Context, id int) error {
+	return s.refuse("DeleteTrade", 1)
+}
+
+// SavePortfolioSnapshot implements Store
+func (s *guardedStore) SavePortfolioSnapshot(snap PortfolioSnapshot) error {
+	return s.refuse("SavePortfolioSnapshot", 1)
+}
+
+// SaveVolatilityRegimes implements Store
+func (s *guardedStore) SaveVolatilityRegimes(periods []VolatilityRegime) error {
+	return s.refuse("SaveVolatilityRegimes", len(periods))
+}
+
+// SaveCandles implements Store
+func (s *guardedStore) SaveCandles(candles []Candle) error {
+	return s.refuse("SaveCandles", len(candles))
+}
+
+// SaveCandlePattern implements Store
+func (s *guardedStore) SaveCandlePattern(p CandlePattern) (bool, error) {
+	return false, s.refuse("SaveCandlePattern", 1)
+}
+
+// SaveIndicators implements Store
+func (s *guardedStore) SaveIndicators(values []IndicatorValue) error {
+	return s.refuse("SaveIndicators", len(values))
+}
+
+// SavePriceLevels implements Store
+func (s *guardedStore) SavePriceLevels(currency string, levels []PriceLevel) error {
+	return s.refuse("SavePriceLevels", len(levels))
+}
+
+// SaveAlertRule implements Store
+func (s *guardedStore) SaveAlertRule(rule AlertRule) (int, error) {
+	return 0, s.refuse("SaveAlertRule", 1)
+}
+
+// DeleteAlertRule implements Store
+func (s *guardedStore) DeleteAlertRule(tenant string, id int) error {
+	return s.refuse("DeleteAlertRule", 1)
+}
+
+// SetAlertTriggered implements Store
+func (s *guardedStore) SetAlertTriggered(id int, triggered, notified bool) error {
+	return s.refuse("SetAlertTriggered", 1)
+}
+
+// SnoozeAlertRule implements Store
+func (s *guardedStore) SnoozeAlertRule(id int, until *time.Time) error {
+	return s.refuse("SnoozeAlertRule", 1)
+}
+
+// SetAlertDisabled implements Store
+func (s *guardedStore) SetAlertDisabled(id int, disabled bool) error {
+	return s.refuse("SetAlertDisabled", 1)
+}
+
+// RecordAlertStats implements Store
+func (s *guardedStore) RecordAlertStats(stats []AlertRuleStats) error {
+	return s.refuse("RecordAlertStats", len(stats))
+}
+
+// SaveDashboardLayout implements Store
+func (s *guardedStore) SaveDashboardLayout(layout DashboardLayout) error {
+	return s.refuse("SaveDashboardLayout", 1)
+}
+
+// DeleteDashboardLayout implements Store
+func (s *guardedStore) DeleteDashboardLayout(user string) error {
+	return s.refuse("DeleteDashboardLayout", 1)
+}
+
+// SaveAPIKey implements Store
+func (s *guardedStore) SaveAPIKey(key APIKey) (int, error) {
+	return 0, s.refuse("SaveAPIKey", 1)
+}
+
+// RevokeAPIKey implements Store
+func (s *guardedStore) RevokeAPIKey(id int) error {
+	return s.refuse("RevokeAPIKey", 1)
+}
+
+// TouchAPIKey implements Store; the key's last use is not recorded
+func (s *guardedStore) TouchAPIKey(id int) error {
+	return nil
+}
+
+// SavePasskeyInvite implements Store
+func (s *guardedStore) SavePasskeyInvite(user, hash string, expires time.Time) (int, error) {
+	return 0, s.refuse("SavePasskeyInvite", 1)
+}
+
+// SavePasskey implements Store
+func (s *guardedStore) SavePasskey(key Passkey, inviteHash string) (int, error) {
+	return 0, s.refuse("SavePasskey", 1)
+}
+
+// UsePasskey implements Store; the passkey's last use and signature counter are not recorded
+func (s *guardedStore) UsePasskey(id int, signCount uint32) error {
+	return nil
+}
+
+// DeletePasskey implements Store
+func (s *guardedStore) DeletePasskey(id int) error {
+	return s.refuse("DeletePasskey", 1)
+}
+
+// SaveAnomaly implements Store
+func (s *guardedStore) SaveAnomaly(a PriceAnomaly) (int, error) {
+	return 0, s.refuse("SaveAnomaly", 1)
+}
+
+// ReleaseAnomaly implements Store
+func (s *guardedStore) ReleaseAnomaly(id int) error {
+	return s.refuse("ReleaseAnomaly", 1)
+}
+
+// CorrectPrice implements Store
+func (s *guardedStore) CorrectPrice(ctx context.Context, c PriceCorrection) (PriceCorrection, error) {
+	return c, s.refuse("CorrectPrice", 1)
+}
+
+// SaveExchangePrices implements Store
+func (s *guardedStore) SaveExchangePrices(ctx context.Context, prices []ExchangePrice) error {
+	return s.refuse("SaveExchangePrices", len(prices))
+}
+
+// SaveFXRates implements Store
+func (s *guardedStore) SaveFXRates(ctx context.Context, rates []FXRate) error {
+	return s.refuse("SaveFXRates", len(rates))
+}
+
+// SaveFearGreed implements Store
+func (s *guardedStore) SaveFearGreed(ctx context.Context, readings []FearGreedReading) error {
+	return s.refuse("SaveFearGreed", len(readings))
+}
+
+// SaveCollectorSamples implements Store
+func (s *guardedStore) SaveCollectorSamples(ctx context.Context, samples []CollectorSample) error {
+	return s.refuse("SaveCollectorSamples", len(samples))
+}
+
+// SaveBasketValues implements Store
+func (s *guardedStore) SaveBasketValues(ctx context.Context, values []BasketValue) error {
+	return s.refuse("SaveBasketValues", len(values))
+}
+
+// SaveExportJob implements Store
+func (s *guardedStore) SaveExportJob(job ExportJob) (int, error) {
+	return 0, s.refuse("SaveExportJob", 1)
+}
+
+// ClaimExportJob implements Store; there is never a job to claim
+func (s *guardedStore) ClaimExportJob(stale time.Time) (ExportJob, bool, error) {
+	return ExportJob{}, false, nil
+}
+
+// UpdateExportJob implements Store
+func (s *guardedStore) UpdateExportJob(job ExportJob) (bool, error) {
+	return false, s.refuse("UpdateExportJob", 1)
+}
+
+// DeleteExportJob implements Store
+func (s *guardedStore) DeleteExportJob(id int) error {
+	return s.refuse("DeleteExportJob", 1)
+}
+
+// RecordHeartbeat implements Store; an instance that doesn't write prices never claims
+// to be the primary, so a standby watching the database takes over as usual
+func (s *guardedStore) RecordHeartbeat(ctx context.Context, instance string, interval time.Duration) error {
+	return nil
+}
+
+// AcquireLeaderLease implements Store; like its heartbeat, an instance that doesn't
+// write prices never takes the lease, and runs its jobs without writing
+func (s *guardedStore) AcquireLeaderLease(ctx context.Context, instance string, interval time.Duration, missed int) (bool, error) {
+	return true, nil
+}
+
+// ReleaseLeaderLease implements Store
+func (s *guardedStore) ReleaseLeaderLease(ctx context.Context, instance string) error {
+	return nil
+}
+
+// SaveWebhook implements Store
+func (s *guardedStore) SaveWebhook(ctx context.Context, w Webhook) (int, error) {
+	return 0, s.refuse("SaveWebhook", 1)
+}
+
+// DeleteWebhook implements Store
+func (s *guardedStore) DeleteWebhook(ctx context.Context, id int) error {
+	return s.refuse("DeleteWebhook", 1)
+}
+
+// QueueWebhookDelivery implements Store
+// Nothing is queued, so no webhook is sent a price that wasn't stored.
+func (s *guardedStore) QueueWebhookDelivery(ctx context.Context, d WebhookDelivery) (int, error) {
+	return 0, s.refuse("QueueWebhookDelivery", 1)
+}
+
+// UpdateWebhookDelivery implements Store
+func (s *guardedStore) UpdateWebhookDelivery(ctx context.Context, d WebhookDelivery) error {
+	return s.refuse("UpdateWebhookDelivery", 1)
+}
+
+// RetryWebhookDelivery implements Store
+func (s *guardedStore) RetryWebhookDelivery(ctx context.Context, id int) error {
+	return s.refuse("RetryWebhookDelivery", 1)
+}
+
+// PruneWebhookDeliveries implements Store
+func (s *guardedStore) PruneWebhookDeliveries(ctx context.Context, before time.Time) (int, error) {
+	return 0, nil
+}
+
+// QueueOutboxEvents implements Store
+// Events are published directly instead, as they are without EVENT_OUTBOX.
+func (s *guardedStore) QueueOutboxEvents(ctx context.Context, events []OutboxEvent) error {
+	return s.refuse("QueueOutboxEvents", len(events))
+}
+
+// UpdateOutboxEvent implements Store
+func (s *guardedStore) UpdateOutboxEvent(ctx context.Context, e OutboxEvent) error {
+	return s.refuse("UpdateOutboxEvent", 1)
+}
+
+// DeleteOutboxEvent implements Store
+func (s *guardedStore) DeleteOutboxEvent(ctx context.Context, id int) error {
+	return s.refuse("DeleteOutboxEvent", 1)
+}
+
+// RetryOutboxEvents implements Store
+func (s *guardedStore) RetryOutboxEvents(ctx context.Context, sink string) (int, error) {
+	return 0, s.refuse("RetryOutboxEvents", 1)
+}
+
+// PurgeOutbox implements Store
+func (s *guardedStore) PurgeOutbox(ctx context.Context, sink string) (int, error) {
+	return 0, s.refuse("PurgeOutbox", 1)
+}
+
+// SaveRawResponse implements Store
+func (s *guardedStore) SaveRawResponse(ctx context.Context, r RawResponse) (int, error) {
+	return 0, s.refuse("SaveRawResponse", 1)
+}
+
+// PruneRawResponses implements Store
+func (s *guardedStore) PruneRawResponses(ctx context.Context, before time.Time) (int, error) {
+	return 0, s.refuse("PruneRawResponses", 1)
+}
+
+// SavePriceTarget implements Store
+func (s *guardedStore) SavePriceTarget(ctx context.Context, t PriceTarget) (int, error) {
+	return 0, s.refuse("SavePriceTarget", 1)
+}
+
+// FirePriceTarget implements Store
+// A dry run notifies as if the target had been marked fired.
+func (s *guardedStore) FirePriceTarget(ctx context.Context, id int, price float64, at time.Time) (bool, error) {
+	return true, s.refuse("FirePriceTarget", 1)
+}
+
+// RearmPriceTarget implements Store
+func (s *guardedStore) RearmPriceTarget(ctx context.Context, id int) error {
+	return s.refuse("RearmPriceTarget", 1)
+}
+
+// DeletePriceTarget implements Store
+func (s *guardedStore) DeletePriceTarget(ctx context.Context, id int) error {
+	return s.refuse("DeletePriceTarget", 1)
+}
+
+// SaveAnnotation implements Store
+func (s *guardedStore) SaveAnnotation(ctx context.Context, a Annotation) (int, error) {
+	return 0, s.refuse("SaveAnnotation", 1)
+}
+
+// DeleteAnnotation implements Store
+func (s *guardedStore) DeleteAnnotation(ctx context.Context, id int) error {
+	return s.refuse("DeleteAnnotation", 1)
+}
+
+// SavePriceExtremes implements Store
+func (s *guardedStore) SavePriceExtremes(ctx context.Context, e PriceExtremes) error {
+	return s.refuse("SavePriceExtremes", 1)
+}
+
+// SaveDailySummaries implements Store
+func (s *guardedStore) SaveDailySummaries(ctx context.Context, days []DaySummary) error {
+	return s.refuse("SaveDailySummaries", len(days))
+}
+
+// readOnlyAPIPaths are the API paths that accept writing methods in read-only mode:
+// signing in and out with a passkey only changes the session cookie, and Grafana's
+// datasource posts queries
+var readOnlyAPIPaths = []string{"/passkeys/login/", "/passkeys/logout", grafanaPathPrefix + "/"}
+
+// refuseAPIWrites answers requests with writing methods with 403 in read-only mode,
+// instead of letting them fail at the database
+func refuseAPIWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if writeMode != writeModeReadOnly || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, path := range readOnlyAPIPaths {
+			if strings.HasPrefix(r.URL.Path, path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		writeAPIProblem(w, http.StatusForbidden, KindAuth, "the API is read-only: %s %s would write to the database", r.Method, r.URL.Path)
+	})
+}
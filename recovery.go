@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"        // Package for recognizing recovered panics
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"os"            // Package for environment variables
+	"runtime/debug" // Package for the stack of a panic
+	"time"          // Package for backoff delays
+)
+
+// EventSchedulerPanic is emitted when a scheduler job panics and is held back
+const EventSchedulerPanic = "scheduler.panic"
+
+// Scheduler jobs, as named in logs, metrics, and status
+const (
+	jobFetch      = "fetch"
+	jobRetention  = "retention"
+	jobPortfolio  = "portfolio"
+	jobSummary    = "summary"
+	jobGapFill    = "gap_fill"
+	jobFearGreed  = "fear_greed"
+	jobCollectors = "collectors"
+)
+
+// CrashBackoffConfig controls how long a scheduler job that keeps panicking is held back
+// The first panic holds it back for Base, and each further one in a row doubles that up to Max.
+type CrashBackoffConfig struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// crashBackoffConfig is the active configuration, loaded at startup
+var crashBackoffConfig = CrashBackoffConfig{Base: time.Minute, Max: time.Hour}
+
+// loadCrashBackoffConfig reads CRASH_BACKOFF (e.g. 1m) and CRASH_BACKOFF_MAX (e.g. 1h)
+func loadCrashBackoffConfig() (CrashBackoffConfig, error) {
+	c := CrashBackoffConfig{Base: time.Minute, Max: time.Hour}
+	if v := os.Getenv("CRASH_BACKOFF"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid CRASH_BACKOFF %q (expected a duration, e.g. 1m)", v)
+		}
+		c.Base = d
+	}
+	if v := os.Getenv("CRASH_BACKOFF_MAX"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid CRASH_BACKOFF_MAX %q (expected a duration, e.g. 1h)", v)
+		}
+		c.Max = d
+	}
+	if c.Max < c.Base {
+		return c, fmt.Errorf("CRASH_BACKOFF_MAX (%s) must not be shorter than CRASH_BACKOFF (%s)", c.Max, c.Base)
+	}
+	return c, nil
+}
+
+// delay returns how long a job is held back after its nth panic in a row
+func (c CrashBackoffConfig) delay(panics int) time.Duration {
+	d := c.Base
+	for i := 1; i < panics && d < c.Max; i++ {
+		d *= 2
+	}
+	return min(d, c.Max)
+}
+
+// panicError is a panic recovered from a job
+type panicError struct {
+	job   string
+	value interface{}
+}
+
+// Error describes the job and what it panicked with
+func (e *panicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.job, e.value)
+}
+
+// PanicEventData is the payload of scheduler.panic events
+type PanicEventData struct {
+	Job          string    `json:"job"`
+	Panic        string    `json:"panic"`
+	Panics       int       `json:"panics"` // Panics of the job in a row
+	BackoffUntil time.Time `json:"backoff_until"`
+}
+
+// runRecovered runs fn, turning a panic in it into a *panicError
+// The panic is logged with its stack and counted in tracker_panics_total{job}.
+func runRecovered(job string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Recovered from panic", "job", job, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			incCounter("tracker_panics_total", map[string]string{"job": job}, 1)
+			err = &panicError{job: job, value: r}
+		}
+	}()
+	return fn()
+}
+
+// runJob runs one cycle of a scheduler job with panic recovery and crash-loop backoff
+// A job that panicked is skipped until its backoff has passed, so one poisoned code path
+// can't take down the daemon or keep hammering providers and sinks; a cycle that
+// completes without panicking resets the backoff.
+func runJob(repo *Repository, job string, fn func() error) error {
+	if until, ok := daemon.jobBackoff(job, time.Now()); ok {
+		slog.Warn("Skipping job held back after a panic", "job", job, "until", until.Format(time.RFC3339))
+		return fmt.Errorf("%s is held back after a panic until %s", job, until.Format(time.RFC3339))
+	}
+
+	err := runRecovered(job, fn)
+	var p *panicError
+	panicked := errors.As(err, &p)
+	panics, until := daemon.recordJobResult(job, panicked, time.Now(), crashBackoffConfig)
+	if panicked {
+		slog.Warn("Holding back job after a panic", "job", job, "panics", panics, "until", until.Format(time.RFC3339))
+		event := newEvent(EventSchedulerPanic, "scheduler/"+job, PanicEventData{
+			Job:          job,
+			Panic:        fmt.Sprint(p.value),
+			Panics:       panics,
+			BackoffUntil: until,
+		})
+		// A sink may be what panicked, so publishing is guarded as well
+		runRecovered("publish", func() error {
+			publishEvent(repo, event)
+			return nil
+		})
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"       // Package for bounding each publish
+	"encoding/json" // Package for structured CloudEvents and the latest-price value
+	"errors"        // Package for telling error replies from broken connections
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"os"            // Package for environment variables
+	"strconv"       // Package for the key expiry
+	"strings"       // Package for string manipulation
+	"time"          // Package for REDIS_LATEST_TTL
+)
+
+// redisSink publishes every new price to a Redis pub/sub channel and keeps the latest
+// price of each currency in a key, so consumers can subscribe for updates or read the
+// current price without querying the database. It uses the server of REDIS_URL, which
+// may also hold the read cache.
+type redisSink struct {
+	client    *redisClient
+	channel   string        // Channel of price.recorded events, may contain {currency}
+	latestKey string        // Key of the latest price, may contain {currency}; empty for none
+	latestTTL time.Duration // Expiry of the latest-price key; 0 keeps it until replaced
+}
+
+// Name identifies the sink in logs
+func (s *redisSink) Name() string { return "redis " + s.client.addr }
+
+// Publish implements EventSink
+// Only price.recorded events are published; the others have sinks of their own.
+func (s *redisSink) Publish(e Event) error {
+	data, ok := e.Data.(PriceEventData)
+	if !ok || e.Type != EventPriceRecorded {
+		return nil
+	}
+
+	// Pub/sub messages have no headers, so binary mode falls back to structured mode
+	payload, _, _, err := encodeEvent(e)
+	if err != nil {
+		return err
+	}
+	if eventFormat == EventFormatCloudBinary {
+		if payload, err = json.Marshal(toCloudEvent(e)); err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+	}
+	commands := [][]string{{"PUBLISH", strings.ReplaceAll(s.channel, priceFileCurrencyPlaceholder, data.Currency), string(payload)}}
+
+	if s.latestKey != "" {
+		value, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode price: %w", err)
+		}
+		set := []string{"SET", strings.ReplaceAll(s.latestKey, priceFileCurrencyPlaceholder, data.Currency), string(value)}
+		if s.latestTTL > 0 {
+			set = append(set, "PX", strconv.FormatInt(s.latestTTL.Milliseconds(), 10))
+		}
+		commands = append(commands, set)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*redisTimeout)
+	defer cancel()
+	for _, args := range commands {
+		// An idle connection the server has since closed only fails on its next use,
+		// so a command that fails on the connection itself is tried once more
+		_, err := s.client.do(ctx, args...)
+		var replyErr redisError
+		if err != nil && !errors.As(err, &replyErr) {
+			_, err = s.client.do(ctx, args...)
+		}
+		if err != nil {
+			return fmt.Errorf("redis %s failed: %w", args[0], err)
+		}
+	}
+	return nil
+}
+
+// loadRedisSink builds the Redis sink from REDIS_CHANNEL, REDIS_LATEST_KEY, and
+// REDIS_LATEST_TTL on the server of REDIS_URL. It returns nil when REDIS_CHANNEL is unset
+func loadRedisSink() (EventSink, error) {
+	channel := os.Getenv("REDIS_CHANNEL")
+	if channel == "" {
+		return nil, nil
+	}
+	if os.Getenv("REDIS_URL") == "" {
+		return nil, fmt.Errorf("REDIS_CHANNEL needs REDIS_URL")
+	}
+	client, err := newRedisClient(os.Getenv("REDIS_URL"))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(channel, priceFileCurrencyPlaceholder) && len(currencies) > 1 {
+		slog.Info("Publishing every currency's prices to one Redis channel", "channel", channel)
+	}
+
+	sink := &redisSink{client: client, channel: channel, latestKey: "bitcoin-tracker:latest:" + priceFileCurrencyPlaceholder}
+	switch key := os.Getenv("REDIS_LATEST_KEY"); {
+	case key == "":
+	case strings.EqualFold(key, "none"):
+		sink.latestKey = ""
+	case !strings.Contains(key, priceFileCurrencyPlaceholder) && len(currencies) > 1:
+		return nil, fmt.Errorf("invalid REDIS_LATEST_KEY %q: it needs {currency} with more than one of CURRENCIES", key)
+	default:
+		sink.latestKey = key
+	}
+	if v := os.Getenv("REDIS_LATEST_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 || (d > 0 && d < time.Millisecond) {
+			return nil, fmt.Errorf("invalid REDIS_LATEST_TTL %q (expected a duration such as 10m, or 0 for none)", v)
+		}
+		sink.latestTTL = d
+	}
+	return sink, nil
+}
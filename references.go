@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"strconv"  // Package for parsing CLI arguments
+	"strings"  // Package for string manipulation
+	"time"     // Package for reference dates
+)
+
+// ReferencePrice is a named price point to compare current prices against
+// e.g. "bought" at 28,400 USD on 2023-03-12
+type ReferencePrice struct {
+	ID       int       `json:"id"`       // Primary key (auto-increment)
+	Name     string    `json:"name"`     // Unique label chosen by the user
+	Price    float64   `json:"price"`    // Reference price
+	Currency string    `json:"currency"` // Fiat currency of the reference price
+	Date     time.Time `json:"date"`     // Date the reference applies to
+}
+
+// percentChange returns the change from "from" to "to" as a percentage of "from"
+func percentChange(from, to float64) float64 {
+	if from == 0 {
+		return 0
+	}
+	return (to - from) / from * 100
+}
+
+// displayReferenceComparison prints how the latest price in each currency compares
+// against every stored reference price in that currency, with precision decimal places
+func displayReferenceComparison(repo *Repository, latest map[string]float64, precision int) {
+	refs, err := repo.References("")
+	if err != nil {
+		slog.Error("Failed to fetch reference prices", "error", err)
+		return
+	}
+
+	var lines []string
+	for _, ref := range refs {
+		current, ok := latest[ref.Currency]
+		if !ok {
+			continue
+		}
+		places := 2
+		if precision != noPrecision {
+			places = precision
+		}
+		lines = append(lines, fmt.Sprintf("%-16s %-14.*f %-8s %-12s %+.2f%%",
+			ref.Name,
+			places, ref.Price,
+			strings.ToUpper(ref.Currency),
+			ref.Date.Format("2006-01-02"),
+			percentChange(ref.Price, current)))
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Printf("%-16s %-14s %-8s %-12s %s\n", "Reference", "Price", "Currency", "Date", "Change")
+	fmt.Println("------------------------------------------------------------")
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
+
+// runReferenceCommand handles the "reference" CLI command
+//
+//	reference add <name> <price> [currency] [YYYY-MM-DD]
+//	reference list [currency]
+//	reference delete <name>
+func runReferenceCommand(repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: reference add|list|delete")
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 3 {
+			return validationErrorf("usage: reference add <name> <price> [currency] [YYYY-MM-DD]")
+		}
+
+		// Accept "28,400" as well as "28400"
+		price, err := strconv.ParseFloat(strings.ReplaceAll(args[2], ",", ""), 64)
+		if err != nil || price <= 0 {
+			return fmt.Errorf("invalid price %q", args[2])
+		}
+
+		ref := ReferencePrice{Name: args[1], Price: price, Currency: "usd", Date: time.Now()}
+		if len(args) > 3 {
+			ref.Currency = args[3]
+		}
+		if len(args) > 4 {
+			if ref.Date, err = time.Parse("2006-01-02", args[4]); err != nil {
+				return fmt.Errorf("invalid date %q (expected YYYY-MM-DD)", args[4])
+			}
+		}
+
+		if err := repo.SaveReference(ref); err != nil {
+			return err
+		}
+		slog.Info("Saved reference", "name", ref.Name, "price", ref.Price, "currency", ref.Currency)
+
+	case "list":
+		currency := ""
+		if len(args) > 1 {
+			currency = args[1]
+		}
+		refs, err := repo.References(currency)
+		if err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			slog.Info("No reference prices stored")
+			return nil
+		}
+
+		fmt.Printf("\n%-16s %-14s %-8s %-12s\n", "Name", "Price", "Currency", "Date")
+		fmt.Println("--------------------------------------------------")
+		for _, ref := range refs {
+			fmt.Printf("%-16s %-14.2f %-8s %-12s\n",
+				ref.Name, ref.Price, strings.ToUpper(ref.Currency), ref.Date.Format("2006-01-02"))
+		}
+		fmt.Println()
+
+	case "delete":
+		if len(args) < 2 {
+			return validationErrorf("usage: reference delete <name>")
+		}
+		if err := repo.DeleteReference(args[1]); err != nil {
+			return err
+		}
+		slog.Info("Deleted reference", "name", args[1])
+
+	default:
+		return validationErrorf("unknown reference command: %s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"  // Package for shutdown handling
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"time"     // Package for the fetch schedule
+)
+
+// runRelayCommand handles "relay" and "relay stream [--feed binance|coinbase] [--sample 30s]"
+// Relay mode turns the tracker into a fan-out layer without a database: prices are
+// fetched from PRICE_SOURCES every FETCH_INTERVAL (or sampled from an exchange
+// WebSocket feed), normalized, and published to the configured event sinks only.
+func runRelayCommand(ctx context.Context, stop context.CancelFunc, args []string) error {
+	if len(eventSinks) == 0 {
+		return fmt.Errorf("relay mode needs at least one event sink (EVENT_WEBHOOK_URLS, MQTT_URL, REDIS_CHANNEL, NATS_URL, KAFKA_REST_URL, PRICE_FILE, or a cloud sink)")
+	}
+	for _, sink := range eventSinks {
+		slog.Info("Relaying prices to sink", "sink", sink.Name())
+	}
+
+	if len(args) > 0 && args[0] == "stream" {
+		opts, err := parseStreamOptions(nil, args[1:], false)
+		if err != nil {
+			return err
+		}
+		runWithDrain(ctx, stop, func(ctx context.Context) { runStream(ctx, opts.feed, opts.sample, relayPrices) })
+		return nil
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unknown relay argument %q (expected stream)", args[0])
+	}
+
+	runWithDrain(ctx, stop, runRelay)
+	return nil
+}
+
+// runRelay fetches prices every FETCH_INTERVAL until ctx is cancelled
+// The fetch budget is not enforced: its call log lives in the database
+func runRelay(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	slog.Info("Starting Bitcoin price relay", "interval", fetchInterval)
+	work, cancelWork := drainContext(ctx)
+	defer cancelWork()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Relay stopping")
+			return
+		case <-timer.C:
+			if err := fetchAndRelayPrice(work); err != nil {
+				slog.Error("Fetch failed", "coin", "bitcoin", "error", err)
+			}
+			timer.Reset(fetchInterval)
+		}
+	}
+}
+
+// fetchAndRelayPrice fetches the current Bitcoin price and publishes it without saving it
+func fetchAndRelayPrice(ctx context.Context) error {
+	ctx, cancel := withFetchDeadline(ctx)
+	defer cancel()
+	fetched := fetchCurrencies()
+	prices, sources, quoted, err := fetchPricesWithRetry(ctx, nil, "bitcoin", fetched, nil)
+	if len(prices) == 0 {
+		err = fmt.Errorf("failed to fetch Bitcoin price: %w", err)
+		daemon.recordFetchResult("bitcoin", err)
+		return err
+	}
+
+	// Relay what was fetched even when some currencies failed
+	for source, group := range pricesBySource(prices, sources) {
+		if rerr := relayPrices(ctx, group, quoted, source); rerr != nil {
+			return rerr
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("fetched %d of %d Bitcoin prices: %w", len(prices), len(fetched), err)
+		daemon.recordFetchResult("bitcoin", err)
+		return err
+	}
+	return nil
+}
+
+// relayPrices is recordPrices for relay mode: prices are rounded like stored ones
+// and published as price.recorded events, with nothing written to a database, so
+// there is no write latency to record
+func relayPrices(ctx context.Context, prices map[string]float64, _ map[string]time.Time, source string) error {
+	prices, _ = convertFXPrices(ctx, nil, prices)
+	rounded := make(map[string]float64, len(prices))
+	for currency, price := range prices {
+		rounded[currency] = roundPriceIn(currency, price)
+	}
+
+	publishPriceEvents(nil, "bitcoin", rounded, source)
+	incCounter("tracker_relayed_prices_total", map[string]string{"source": source}, float64(len(prices)))
+	slog.Info("Relayed Bitcoin price", "coin", "bitcoin", "currencies", len(prices), "source", source)
+	daemon.recordFetchResult("bitcoin", nil)
+	return nil
+}
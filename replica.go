@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"  // Package for the Store method signatures and primary reads
+	"errors"   // Package for classifying replica errors
+	"fmt"      // Package for formatted errors
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"strings"  // Package for matching DB_DRIVER
+	"sync"     // Package for guarding the replica's state
+	"time"     // Package for the Store method signatures and retry delays
+
+	"github.com/lib/pq" // PostgreSQL driver, for the class of a replica's errors
+)
+
+// A PostgreSQL read replica (DATABASE_REPLICA_URL) takes the query traffic of the
+// commands that only show prices: display, tui, chart, serve, export, stats, price-at,
+// query, patterns, and levels. Their price, candle, and statistics queries go to the
+// replica, everything else, writes above all, to the primary. When the replica can't be
+// reached or fails a query for want of a connection, queries go to the primary for
+// replicaRetryAfter before the replica is tried again. The scheduler and the commands
+// that write read from the primary only, so nothing they derive from prices they just
+// stored lags behind the replica. With CLICKHOUSE_URL, the replica's raw price reads go
+// to ClickHouse as the primary's do.
+
+// replicaRetryAfter is how long queries skip a replica that was unavailable
+const replicaRetryAfter = 30 * time.Second
+
+// replicaDialTimeout bounds connecting to the replica, so a host that drops packets
+// fails the dial rather than hanging it
+const replicaDialTimeout = 5 * time.Second
+
+// replicaURL is the read replica's connection string; empty means no replica.
+// Configured via DATABASE_REPLICA_URL
+var replicaURL string
+
+// loadReplicaURL reads DATABASE_REPLICA_URL, which needs the PostgreSQL backend
+func loadReplicaURL() (string, error) {
+	url := os.Getenv("DATABASE_REPLICA_URL")
+	if url == "" {
+		return "", nil
+	}
+	if driver := strings.ToLower(os.Getenv("DB_DRIVER")); driver != "" && driver != "postgres" && driver != "postgresql" {
+		return "", fmt.Errorf("DATABASE_REPLICA_URL needs DB_DRIVER=postgres, not %q", driver)
+	}
+	return url, nil
+}
+
+// primaryReadsKey marks a context whose reads skip the replica
+type primaryReadsKey struct{}
+
+// readPrimary returns a context whose reads go to the primary, for reading back what
+// was just written before the replica has caught up
+func readPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsKey{}, true)
+}
+
+// replicatedStore sends the query reads of the embedded primary store to a read replica
+// Reads not overridden here, and every write, go to the primary.
+type replicatedStore struct {
+	Store
+	url string
+
+	mu         sync.Mutex
+	replica    Store     // nil until the replica has been reached
+	connecting bool      // A dial to the replica is under way
+	closed     bool      // Close was called; a dial that finishes after it is closed again
+	downUntil  time.Time // Queries skip the replica until then after it was unavailable
+}
+
+// withReplica puts the replica at url in front of primary's query reads
+// The replica is connected to now; one that can't be reached within replicaDialTimeout
+// only logs a warning, and the command starts out on the primary.
+func withReplica(primary Store, url string) Store {
+	s := &replicatedStore{Store: primary, url: url, connecting: true}
+	s.connect()
+	return s
+}
+
+// Close implements Store, closing the replica and the primary
+func (s *replicatedStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.replica != nil {
+		s.replica.Close()
+	}
+	return s.Store.Close()
+}
+
+// reader returns the replica, or nil when ctx asks for the primary or the replica is
+// being skipped. When the replica isn't connected yet, a dial is started in the
+// background and the primary answers until it succeeds, so no query waits on it.
+func (s *replicatedStore) reader(ctx context.Context) Store {
+	if ctx.Value(primaryReadsKey{}) != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Now().Before(s.downUntil) {
+		return nil
+	}
+	if s.replica == nil {
+		if !s.connecting && !s.closed {
+			s.connecting = true
+			go s.connect()
+		}
+		return nil
+	}
+	setGauge("tracker_replica_up", nil, 1)
+	return s.replica
+}
+
+// connect dials the replica within replicaDialTimeout, outside s.mu so queries carry on
+// on the primary meanwhile; s.connecting must have been set
+func (s *replicatedStore) connect() {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaDialTimeout)
+	defer cancel()
+	replica, err := openPostgresStore(ctx, s.url)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connecting = false
+	switch {
+	case err != nil:
+		s.skip("connect", err)
+	case s.closed:
+		replica.Close()
+	default:
+		slog.Info("Connected to the read replica")
+		s.replica = replica
+		if clickhouseConfig.Endpoint != "" {
+			s.replica = withClickHouse(replica, clickhouseConfig)
+		}
+		setGauge("tracker_replica_up", nil, 1)
+	}
+}
+
+// served reports whether the replica answered a query with err, which then needs no
+// retry on the primary; when it was unavailable instead, it is skipped for a while
+func (s *replicatedStore) served(query string, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || !replicaUnavailable(err) {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skip(query, err)
+	return false
+}
+
+// skip sends queries to the primary for replicaRetryAfter; s.mu must be held
+func (s *replicatedStore) skip(query string, err error) {
+	s.downUntil = time.Now().Add(replicaRetryAfter)
+	slog.Warn("Read replica unavailable, querying the primary", "query", query, "retry_in", replicaRetryAfter, "error", err)
+	incCounter("tracker_replica_fallbacks_total", map[string]string{"query": query}, 1)
+	setGauge("tracker_replica_up", nil, 0)
+}
+
+// replicaUnavailable reports whether err says the replica couldn't answer, rather than
+// that the query itself failed. PostgreSQL reports the first kind in the classes of
+// connection errors, insufficient resources, operator intervention (e.g. a replica
+// still starting), system errors, and transaction rollbacks, which include queries
+// cancelled by a conflict with recovery. Errors that don't come from PostgreSQL, like
+// a refused connection or a timeout, count too.
+func replicaUnavailable(err error) bool {
+	var chErr *clickhouseError
+	if errors.As(err, &chErr) {
+		return false // The prices in ClickHouse are the same whichever database asks
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return true
+	}
+	switch pqErr.Code.Class() {
+	case "08", "40", "53", "57", "58":
+		return true
+	}
+	return false
+}
+
+// LatestPrices implements Store
+func (s *replicatedStore) LatestPrices(ctx context.Context, limit int, currency string) ([]PriceRecord, error) {
+	if replica := s.reader(ctx); replica != nil {
+		prices, err := replica.LatestPrices(ctx, limit, currency)
+		if s.served("latest_prices", err) {
+			return prices, err
+		}
+	}
+	return s.Store.LatestPrices(ctx, limit, currency)
+}
+
+// LatestPerCurrency implements Store
+func (s *replicatedStore) LatestPerCurrency(ctx context.Context) ([]PriceRecord, error) {
+	if replica := s.reader(ctx); replica != nil {
+		prices, err := replica.LatestPerCurrency(ctx)
+		if s.served("latest_per_currency", err) {
+			return prices, err
+		}
+	}
+	return s.Store.LatestPerCurrency(ctx)
+}
+
+// SearchPrices implements Store
+func (s *replicatedStore) SearchPrices(filter PriceFilter) ([]PriceRecord, int, error) {
+	if replica := s.reader(context.Background()); replica != nil {
+		prices, total, err := replica.SearchPrices(filter)
+		if s.served("search_prices", err) {
+			return prices, total, err
+		}
+	}
+	return s.Store.SearchPrices(filter)
+}
+
+// PriceRange implements Store
+func (s *replicatedStore) PriceRange(currency string, from, to time.Time, limit int) ([]PriceRecord, error) {
+	if replica := s.reader(context.Background()); replica != nil {
+		prices, err := replica.PriceRange(currency, from, to, limit)
+		if s.served("price_range", err) {
+			return prices, err
+		}
+	}
+	return s.Store.PriceRange(currency, from, to, limit)
+}
+
+// PriceAsOf implements Store
+func (s *replicatedStore) PriceAsOf(ctx context.Context, currency string, at time.Time) (float64, bool, error) {
+	if replica := s.reader(ctx); replica != nil {
+		price, ok, err := replica.PriceAsOf(ctx, currency, at)
+		if s.served("price_as_of", err) {
+			return price, ok, err
+		}
+	}
+	return s.Store.PriceAsOf(ctx, currency, at)
+}
+
+// PricesAround implements Store
+func (s *replicatedStore) PricesAround(ctx context.Context, currency string, at time.Time) ([]PriceRecord, error) {
+	if replica := s.reader(ctx); replica != nil {
+		prices, err := replica.PricesAround(ctx, currency, at)
+		if s.served("prices_around", err) {
+			return prices, err
+		}
+	}
+	return s.Store.PricesAround(ctx, currency, at)
+}
+
+// CountPrices implements Store
+func (s *replicatedStore) CountPrices(ctx context.Context, currency string, from, to time.Time) (int64, error) {
+	if replica := s.reader(ctx); replica != nil {
+		n, err := replica.CountPrices(ctx, currency, from, to)
+		if s.served("count_prices", err) {
+			return n, err
+		}
+	}
+	return s.Store.CountPrices(ctx, currency, from, to)
+}
+
+// PriceStats implements Store
+func (s *replicatedStore) PriceStats(ctx context.Context, currency string, from, to time.Time) (PriceStats, error) {
+	if replica := s.reader(ctx); replica != nil {
+		stats, err := replica.PriceStats(ctx, currency, from, to)
+		if s.served("price_stats", err) {
+			return stats, err
+		}
+	}
+	return s.Store.PriceStats(ctx, currency, from, to)
+}
+
+// DailySummaries implements Store
+func (s *replicatedStore) DailySummaries(ctx context.Context, currency string, from, to time.Time) ([]DaySummary, error) {
+	if replica := s.reader(ctx); replica != nil {
+		days, err := replica.DailySummaries(ctx, currency, from, to)
+		if s.served("daily_summaries", err) {
+			return days, err
+		}
+	}
+	return s.Store.DailySummaries(ctx, currency, from, to)
+}
+
+// Candles implements Store
+func (s *replicatedStore) Candles(ctx context.Context, currency, resolution string, from, to time.Time, limit int) ([]Candle, error) {
+	if replica := s.reader(ctx); replica != nil {
+		candles, err := replica.Candles(ctx, currency, resolution, from, to, limit)
+		if s.served("candles", err) {
+			return candles, err
+		}
+	}
+	return s.Store.Candles(ctx, currency, resolution, from, to, limit)
+}
+
+// CandlePatterns implements Store
+func (s *replicatedStore) CandlePatterns(currency, resolution string, from time.Time, limit int) ([]CandlePattern, error) {
+	if replica := s.reader(context.Background()); replica != nil {
+		patterns, err := replica.CandlePatterns(currency, resolution, from, limit)
+		if s.served("candle_patterns", err) {
+			return patterns, err
+		}
+	}
+	return s.Store.CandlePatterns(currency, resolution, from, limit)
+}
+
+// Indicators implements Store
+func (s *replicatedStore) Indicators(currency, resolution string, from, to time.Time, limit int) ([]IndicatorValue, error) {
+	if replica := s.reader(context.Background()); replica != nil {
+		values, err := replica.Indicators(currency, resolution, from, to, limit)
+		if s.served("indicators", err) {
+			return values, err
+		}
+	}
+	return s.Store.Indicators(currency, resolution, from, to, limit)
+}
+
+// PriceLevels implements Store
+func (s *replicatedStore) PriceLevels(currency string) ([]PriceLevel, error) {
+	if replica := s.reader(context.Background()); replica != nil {
+		levels, err := replica.PriceLevels(currency)
+		if s.served("price_levels", err) {
+			return levels, err
+		}
+	}
+	return s.Store.PriceLevels(currency)
+}
+
+// ReadOnlyQuery implements Store
+func (s *replicatedStore) ReadOnlyQuery(ctx context.Context, statement string, maxRows int) (QueryResult, error) {
+	if replica := s.reader(ctx); replica != nil {
+		result, err := replica.ReadOnlyQuery(ctx, statement, maxRows)
+		if s.served("query", err) {
+			return result, err
+		}
+	}
+	return s.Store.ReadOnlyQuery(ctx, statement, maxRows)
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"                // Package for rendering reports and emails
+	"context"              // Package for report queries and the PDF command
+	_ "embed"              // Package for embedding the built-in report template
+	"encoding/base64"      // Package for chart data URLs and email attachments
+	"fmt"                  // Package for formatted I/O operations
+	"html/template"        // Package for report templates
+	"log/slog"             // Package for structured logging
+	"mime"                 // Package for encoding email subjects and file names
+	"mime/multipart"       // Package for report emails with a PDF attached
+	"mime/quotedprintable" // Package for the HTML part of report emails
+	"net/textproto"        // Package for email part headers
+	"os"                   // Package for environment variables and report files
+	"os/exec"              // Package for running REPORT_PDF_COMMAND
+	"path/filepath"        // Package for report file paths
+	"slices"               // Package for building the PDF command line
+	"strings"              // Package for string manipulation
+	"time"                 // Package for the report period
+)
+
+// jobReport is the scheduler job writing the weekly report
+const jobReport = "report"
+
+// reportPeriod is the span a report covers, ending when it is generated
+const reportPeriod = 7 * 24 * time.Hour
+
+// reportPDFTimeout bounds one run of REPORT_PDF_COMMAND
+const reportPDFTimeout = 2 * time.Minute
+
+// reportHTML is the built-in report template
+//
+//go:embed web/report.html
+var reportHTML string
+
+// reportFuncs are available to report templates: those of the message templates, and
+// date, which renders a time as a day in DISPLAY_TIMEZONE
+func reportFuncs() template.FuncMap {
+	funcs := template.FuncMap{
+		"date": func(t time.Time) string { return t.In(displayLocation).Format("2006-01-02") },
+	}
+	for name, fn := range templateFuncs {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// defaultReportTemplate renders reports unless REPORT_TEMPLATE replaces it
+var defaultReportTemplate = template.Must(template.New("report").Funcs(reportFuncs()).Parse(reportHTML))
+
+// ReportConfig controls where weekly reports go and how they look
+type ReportConfig struct {
+	Dir        string             // Directory reports are written to
+	Template   *template.Template // Built-in, or parsed from REPORT_TEMPLATE
+	PDFCommand []string           // Converts the HTML file to a PDF; empty writes no PDF
+	Email      *emailNotifier     // Recipients of REPORT_EMAIL_TO; nil sends no email
+	Upload     *ReportUpload      // Bucket of REPORT_UPLOAD_URL; nil publishes nothing
+}
+
+// reportConfig is the active configuration, loaded at startup
+var reportConfig = ReportConfig{Dir: "reports", Template: defaultReportTemplate}
+
+// loadReportConfig reads REPORT_DIR, REPORT_TEMPLATE, REPORT_PDF_COMMAND (e.g.
+// "wkhtmltopdf --quiet", run with the HTML and PDF paths appended), REPORT_EMAIL_TO,
+// and the REPORT_UPLOAD_URL settings
+func loadReportConfig() (ReportConfig, error) {
+	c := ReportConfig{Dir: os.Getenv("REPORT_DIR"), Template: defaultReportTemplate}
+	if c.Dir == "" {
+		c.Dir = "reports"
+	}
+	if path := os.Getenv("REPORT_TEMPLATE"); path != "" {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return c, fmt.Errorf("invalid REPORT_TEMPLATE: %w", err)
+		}
+		tmpl, err := template.New("report").Funcs(reportFuncs()).Parse(string(text))
+		if err != nil {
+			return c, fmt.Errorf("invalid REPORT_TEMPLATE %s: %w", path, err)
+		}
+		c.Template = tmpl
+	}
+	if command := strings.Fields(os.Getenv("REPORT_PDF_COMMAND")); len(command) > 0 {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			return c, fmt.Errorf("invalid REPORT_PDF_COMMAND %q: %w", command[0], err)
+		}
+		c.PDFCommand = append([]string{path}, command[1:]...)
+	}
+	if to := os.Getenv("REPORT_EMAIL_TO"); to != "" {
+		n, err := newEmailNotifier("REPORT_EMAIL_TO", to)
+		if err != nil {
+			return c, err
+		}
+		c.Email = &n
+	}
+	upload, err := loadReportUpload()
+	if err != nil {
+		return c, err
+	}
+	c.Upload = upload
+	return c, nil
+}
+
+// WeeklyReport is what a report template is executed with
+type WeeklyReport struct {
+	Title       string
+	From, To    time.Time
+	GeneratedAt time.Time
+	Currencies  []ReportCurrency // One per currency of CURRENCIES
+	Portfolio   *ReportPortfolio // nil without holdings
+	Credit      string           // Providers credited, e.g. "Data: CoinGecko"
+	URL         string           // Link to the published report, set in the emailed copy
+}
+
+// ReportCurrency is one currency's week in a report
+type ReportCurrency struct {
+	Currency    string
+	Stats       PriceStats   // The week's statistics, with the all-time high and low
+	Chart       template.URL // SVG line chart of the week as a data URL; empty with too few prices
+	ATHDistance float64      // Percent the close is from the all-time high
+	Units       string       // The close in DERIVED_UNITS, e.g. "1 USD = 1,538.46 sats"
+}
+
+// ReportPortfolio is the portfolio's week in a report
+type ReportPortfolio struct {
+	Valuation PortfolioValuation
+	Start     *PortfolioSnapshot // Oldest snapshot of the week; nil without one
+	Change    float64            // Value change since Start
+	ChangePct float64
+}
+
+// buildWeeklyReport gathers the report of the week before to
+func buildWeeklyReport(ctx context.Context, repo *Repository, to time.Time) (WeeklyReport, error) {
+	from := to.Add(-reportPeriod)
+	r := WeeklyReport{From: from, To: to, GeneratedAt: time.Now(), Credit: attributionCredit(attributionsFor(nil))}
+	r.Title = renderMessage(defaultLocale, "report.title", map[string]string{
+		"From": from.In(displayLocation).Format("2006-01-02"),
+		"To":   to.In(displayLocation).Format("2006-01-02"),
+	})
+
+	for _, currency := range currencies {
+		stats, err := computePriceStats(ctx, repo, currency, from, to)
+		if err != nil {
+			return r, err
+		}
+		c := ReportCurrency{Currency: currency, Stats: stats}
+		if stats.Samples > 0 {
+			if stats.AllTime != nil && stats.AllTime.High > 0 {
+				c.ATHDistance = percentChange(stats.AllTime.High, stats.Last)
+			}
+			if c.Chart, err = reportChart(ctx, repo, currency, from, to); err != nil {
+				return r, err
+			}
+			d, err := deriveUnits(ctx, repo, currency, stats.Last, unitsConfig.Units)
+			if err != nil {
+				slog.Warn("Failed to get the gold price for the report", "currency", currency, "error", err)
+			}
+			c.Units = formatDerivedUnits(d)
+		}
+		r.Currencies = append(r.Currencies, c)
+	}
+
+	portfolio, err := reportPortfolio(ctx, repo, from, to)
+	if err != nil {
+		slog.Warn("Failed to value the portfolio for the report", "error", err)
+	}
+	r.Portfolio = portfolio
+	return r, nil
+}
+
+// reportChart draws a currency's prices between from and to as an SVG data URL
+func reportChart(ctx context.Context, repo *Repository, currency string, from, to time.Time) (template.URL, error) {
+	req := chartRequest{Currency: currency, From: from, To: to, Format: "svg", Annotations: true}
+	if err := req.validate(); err != nil {
+		return "", err
+	}
+	spec, err := req.load(ctx, repo)
+	if err != nil || spec.empty() {
+		return "", err
+	}
+	svg, err := renderChart(spec, req.Format)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(svg)), nil
+}
+
+// reportPortfolio values the portfolio and compares it with its first snapshot of the
+// week; nil without holdings
+func reportPortfolio(ctx context.Context, repo *Repository, from, to time.Time) (*ReportPortfolio, error) {
+	v, err := valuePortfolio(ctx, repo, cliTenant, portfolioConfig.Currency)
+	if err != nil || len(v.Holdings) == 0 {
+		return nil, err
+	}
+	p := &ReportPortfolio{Valuation: v}
+	snaps, err := repo.PortfolioSnapshots(cliTenant, v.Currency, from, to, 1)
+	if err != nil {
+		return p, err
+	}
+	if len(snaps) > 0 && snaps[0].Value > 0 {
+		p.Start = &snaps[0]
+		p.Change, p.ChangePct = v.Value-snaps[0].Value, percentChange(snaps[0].Value, v.Value)
+	}
+	return p, nil
+}
+
+// renderReport executes the report template
+func renderReport(r WeeklyReport) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := reportConfig.Template.Execute(&buf, r); err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// saveReport writes the HTML report to path, and with REPORT_PDF_COMMAND a PDF next to
+// it, which it returns; the PDF is nil without a command
+func saveReport(ctx context.Context, path string, html []byte) ([]byte, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create report directory: %w", err)
+	}
+	if err := os.WriteFile(path, html, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write report: %w", err)
+	}
+	if len(reportConfig.PDFCommand) == 0 {
+		return nil, nil
+	}
+
+	pdfPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".pdf"
+	ctx, cancel := context.WithTimeout(ctx, reportPDFTimeout)
+	defer cancel()
+	args := append(slices.Clone(reportConfig.PDFCommand[1:]), path, pdfPath)
+	if output, err := exec.CommandContext(ctx, reportConfig.PDFCommand[0], args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("REPORT_PDF_COMMAND failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	pdf, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF report: %w", err)
+	}
+	return pdf, nil
+}
+
+// emailReport sends the HTML report as the body of an email, with the PDF attached
+// when there is one
+func emailReport(n emailNotifier, r WeeklyReport, html, pdf []byte, pdfName string) error {
+	var parts bytes.Buffer
+	w := multipart.NewWriter(&parts)
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write(html); err != nil {
+		return err
+	}
+	if err := qp.Close(); err != nil {
+		return err
+	}
+	if pdf != nil {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/pdf"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": pdfName})},
+		})
+		if err != nil {
+			return err
+		}
+		// Lines of encoded data are kept to 76 characters, as MIME asks
+		encoded := base64.StdEncoding.EncodeToString(pdf)
+		for len(encoded) > 0 {
+			n := min(len(encoded), 76)
+			fmt.Fprintf(part, "%s\r\n", encoded[:n])
+			encoded = encoded[n:]
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + n.from + "\r\n")
+	msg.WriteString("To: " + strings.Join(n.to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", r.Title) + "\r\n")
+	msg.WriteString("Date: " + r.GeneratedAt.Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: multipart/mixed; boundary=" + w.Boundary() + "\r\n")
+	msg.WriteString("\r\n")
+	msg.Write(parts.Bytes())
+	if err := n.send(msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send report email: %w", err)
+	}
+	return nil
+}
+
+// generateReport builds the report of the week before to, writes it to path (in
+// REPORT_DIR when empty), publishes it to REPORT_UPLOAD_URL, and emails it to
+// REPORT_EMAIL_TO when send is set; it returns the path written and the link to the
+// published report. The outcome is counted in tracker_reports_total.
+func generateReport(ctx context.Context, repo *Repository, to time.Time, path string, send bool) (string, string, error) {
+	var link string
+	if path == "" {
+		path = filepath.Join(reportConfig.Dir, "report-"+to.In(displayLocation).Format("2006-01-02")+".html")
+	}
+	err := func() error {
+		r, err := buildWeeklyReport(ctx, repo, to)
+		if err != nil {
+			return err
+		}
+		html, err := renderReport(r)
+		if err != nil {
+			return err
+		}
+		pdf, err := saveReport(ctx, path, html)
+		if err != nil {
+			return err
+		}
+		if reportConfig.Upload != nil {
+			if link, err = reportConfig.Upload.publish(ctx, html, filepath.Base(path)); err != nil {
+				return err
+			}
+		}
+		if !send {
+			return nil
+		}
+		if reportConfig.Email == nil {
+			return fmt.Errorf("no report recipients configured (REPORT_EMAIL_TO)")
+		}
+		if link != "" {
+			// Only the emailed copy links to the published one
+			r.URL = link
+			if html, err = renderReport(r); err != nil {
+				return err
+			}
+		}
+		pdfName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".pdf"
+		return emailReport(*reportConfig.Email, r, html, pdf, pdfName)
+	}()
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	incCounter("tracker_reports_total", map[string]string{"result": result}, 1)
+	return path, link, err
+}
+
+// runScheduledReport writes the weekly report on the scheduler's timer, and publishes
+// and emails it when REPORT_UPLOAD_URL and REPORT_EMAIL_TO are set. Failures are
+// logged; the next report is still scheduled
+func runScheduledReport(ctx context.Context, repo *Repository) {
+	path, link, err := generateReport(ctx, repo, time.Now(), "", reportConfig.Email != nil)
+	if err != nil {
+		slog.Error("Failed to generate weekly report", "error", err)
+		return
+	}
+	slog.Info("Generated weekly report", "path", path, "published", link != "", "emailed", reportConfig.Email != nil)
+}
+
+// runReportCommand handles "report [--to date] [--output file] [--send]"
+// It writes the report of the week before --to, and emails it with --send
+func runReportCommand(repo *Repository, args []string) error {
+	fs := newFlagSet("report")
+	toFlag := fs.String("to", "now", "End of the week reported on: now, YYYY-MM-DD, or RFC 3339")
+	output := fs.String("output", "", "File the HTML report is written to (default: REPORT_DIR/report-<date>.html)")
+	send := fs.Bool("send", false, "Also email the report to REPORT_EMAIL_TO")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	to, err := parseTimeFlag("to", *toFlag)
+	if err != nil {
+		return err
+	}
+	if *send && reportConfig.Email == nil {
+		return withKind(KindValidation, fmt.Errorf("no report recipients configured (REPORT_EMAIL_TO)"))
+	}
+
+	path, link, err := generateReport(context.Background(), repo, to, *output, *send)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote weekly report to %s\n", path)
+	if len(reportConfig.PDFCommand) > 0 {
+		fmt.Printf("Wrote PDF report to %s\n", strings.TrimSuffix(path, filepath.Ext(path))+".pdf")
+	}
+	if link != "" {
+		fmt.Printf("Published the report to %s: %s\n", reportConfig.Upload, link)
+	}
+	if *send {
+		fmt.Printf("Emailed the report to %d recipient(s)\n", len(reportConfig.Email.to))
+	}
+	return nil
+}
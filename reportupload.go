@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"    // Package for upload request bodies
+	"context"  // Package for cancelling uploads on shutdown
+	"fmt"      // Package for formatted I/O operations
+	"io"       // Package for reading error responses
+	"net/http" // Package for S3 and Cloud Storage requests
+	"net/url"  // Package for object URLs
+	"os"       // Package for environment variables
+	"strings"  // Package for string manipulation
+	"time"     // Package for signed link lifetimes
+)
+
+// Weekly reports can be published to an S3 or Cloud Storage bucket as well as written
+// to REPORT_DIR, and the report email then links to the published copy. The link is
+// signed for REPORT_LINK_EXPIRY unless the report is public.
+
+// Report link access modes, selected with REPORT_UPLOAD_ACCESS
+const (
+	ReportLinkSigned     = "signed"      // Private objects linked by a signed URL (default)
+	ReportLinkPublicRead = "public-read" // Objects uploaded with a public-read ACL
+	ReportLinkPublic     = "public"      // Objects in a bucket that is already public, e.g. a static website
+)
+
+// maxReportLinkExpiry is the longest S3 and Cloud Storage accept for a signed URL
+const maxReportLinkExpiry = 7 * 24 * time.Hour
+
+// ReportUpload is the bucket reports are published to
+type ReportUpload struct {
+	Provider  string        // "s3" or "gs"
+	Bucket    string        // Bucket name
+	Prefix    string        // Prepended to report file names, empty or ending in /
+	Region    string        // Region of an S3 bucket
+	Access    string        // One of the ReportLink* modes
+	PublicURL string        // Base of public links instead of the bucket's endpoint, e.g. a CDN
+	Expiry    time.Duration // Lifetime of signed links
+}
+
+// loadReportUpload reads REPORT_UPLOAD_URL (s3://bucket/prefix or gs://bucket/prefix),
+// REPORT_UPLOAD_ACCESS, REPORT_PUBLIC_URL, and REPORT_LINK_EXPIRY; it returns nil
+// when REPORT_UPLOAD_URL is unset
+func loadReportUpload() (*ReportUpload, error) {
+	v := strings.TrimSpace(os.Getenv("REPORT_UPLOAD_URL"))
+	if v == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "s3" && u.Scheme != "gs") || u.Host == "" {
+		return nil, fmt.Errorf("invalid REPORT_UPLOAD_URL %q (expected s3://bucket/prefix or gs://bucket/prefix)", v)
+	}
+	c := &ReportUpload{
+		Provider:  u.Scheme,
+		Bucket:    u.Host,
+		Prefix:    strings.Trim(u.Path, "/"),
+		Access:    strings.ToLower(strings.TrimSpace(os.Getenv("REPORT_UPLOAD_ACCESS"))),
+		PublicURL: strings.TrimSuffix(os.Getenv("REPORT_PUBLIC_URL"), "/"),
+		Expiry:    maxReportLinkExpiry,
+	}
+	if c.Prefix != "" {
+		c.Prefix += "/"
+	}
+	if c.Provider == "s3" {
+		if c.Region = awsRegion(""); c.Region == "" {
+			return nil, fmt.Errorf("REPORT_UPLOAD_URL %s needs AWS_REGION, the region of the bucket", v)
+		}
+	}
+
+	switch c.Access {
+	case "":
+		c.Access = ReportLinkSigned
+	case ReportLinkSigned, ReportLinkPublicRead, ReportLinkPublic:
+	default:
+		return nil, fmt.Errorf("invalid REPORT_UPLOAD_ACCESS %q (expected signed, public-read, or public)", c.Access)
+	}
+	if c.PublicURL != "" && c.Access == ReportLinkSigned {
+		return nil, fmt.Errorf("REPORT_PUBLIC_URL needs REPORT_UPLOAD_ACCESS=public-read or public, as signed links go to the bucket")
+	}
+	if v := os.Getenv("REPORT_LINK_EXPIRY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second || d > maxReportLinkExpiry {
+			return nil, fmt.Errorf("invalid REPORT_LINK_EXPIRY %q (expected a duration from 1s to 168h)", v)
+		}
+		c.Expiry = d
+	}
+	return c, nil
+}
+
+// String names the upload location in logs, e.g. "s3://reports/weekly/"
+func (c *ReportUpload) String() string {
+	return c.Provider + "://" + c.Bucket + "/" + c.Prefix
+}
+
+// publish uploads the HTML report as name under the prefix and returns the link to it
+func (c *ReportUpload) publish(ctx context.Context, html []byte, name string) (string, error) {
+	key := c.Prefix + name
+	if c.Provider == "s3" {
+		return c.publishS3(ctx, html, key)
+	}
+	return c.publishGCS(ctx, html, key)
+}
+
+// publicLink returns the link to a public object, under REPORT_PUBLIC_URL when set
+func (c *ReportUpload) publicLink(endpoint, key string) string {
+	if c.PublicURL != "" {
+		endpoint = c.PublicURL
+	}
+	return endpoint + (&url.URL{Path: "/" + key}).EscapedPath()
+}
+
+// publishS3 puts the report into an S3 bucket with a signed PutObject request
+func (c *ReportUpload) publishS3(ctx context.Context, html []byte, key string) (string, error) {
+	creds, err := resolveAWSCredentials()
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", c.Bucket, c.Region)
+	object, err := url.Parse(endpoint + (&url.URL{Path: "/" + key}).EscapedPath())
+	if err != nil {
+		return "", fmt.Errorf("invalid S3 object URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, object.String(), bytes.NewReader(html))
+	if err != nil {
+		return "", fmt.Errorf("failed to create S3 request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/html; charset=utf-8")
+	if c.Access == ReportLinkPublicRead {
+		req.Header.Set("X-Amz-Acl", "public-read")
+	}
+	signAWSRequest(req, html, "s3", c.Region, creds, time.Now())
+	if err := sendReportUpload(req, "S3"); err != nil {
+		return "", err
+	}
+
+	if c.Access == ReportLinkSigned {
+		return presignAWSURL(http.MethodGet, object, "s3", c.Region, creds, time.Now(), c.Expiry), nil
+	}
+	return c.publicLink(endpoint, key), nil
+}
+
+// publishGCS uploads the report to a Cloud Storage bucket with the JSON API
+func (c *ReportUpload) publishGCS(ctx context.Context, html []byte, key string) (string, error) {
+	token, err := gcpAccessToken()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{"uploadType": {"media"}, "name": {key}}
+	if c.Access == ReportLinkPublicRead {
+		query.Set("predefinedAcl", "publicRead")
+	}
+	endpoint := "https://storage.googleapis.com/upload/storage/v1/b/" + url.PathEscape(c.Bucket) + "/o?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(html))
+	if err != nil {
+		return "", fmt.Errorf("failed to create Cloud Storage request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/html; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if err := sendReportUpload(req, "Cloud Storage"); err != nil {
+		return "", err
+	}
+
+	if c.Access == ReportLinkSigned {
+		creds, signer, err := gcpServiceAccountKey()
+		if err != nil {
+			return "", err
+		}
+		return signGCSURL(creds.ClientEmail, signer, c.Bucket, key, time.Now(), c.Expiry)
+	}
+	return c.publicLink("https://storage.googleapis.com/"+c.Bucket, key), nil
+}
+
+// sendReportUpload sends an upload request and fails unless it is answered with 200
+func sendReportUpload(req *http.Request, service string) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload the report to %s: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s returned status %d for the report upload: %s", service, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+// Repository is the storage a command is handed when it starts, and passes on to the
+// fetcher, the API server, the scheduler, and every helper that reads or writes: none
+// of them reach for a package-level store. It embeds the primary store, which takes
+// every write, so it is a Store itself: code given a Repository around a fake Store
+// runs without a database. A Repository is not changed after it is built, so it may be
+// shared between goroutines.
+type Repository struct {
+	Store
+}
+
+// newRepository returns a Repository whose reads and writes go to primary
+func newRepository(primary Store) *Repository {
+	return &Repository{Store: primary}
+}
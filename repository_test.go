@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context" // Package for the fake store's contexts
+	"errors"  // Package for matching the budget error
+	"testing" // Package for the tests
+	"time"    // Package for budget windows
+)
+
+// fakeStore is a Store that answers the few calls a test needs; any other call
+// panics on the nil embedded Store
+type fakeStore struct {
+	Store
+	latest   []PriceRecord
+	apiCalls map[string]int
+}
+
+// LatestPerCurrency implements Store
+func (s *fakeStore) LatestPerCurrency(context.Context) ([]PriceRecord, error) {
+	return s.latest, nil
+}
+
+// APICallCounts implements Store
+func (s *fakeStore) APICallCounts(time.Duration) (map[string]int, error) {
+	return s.apiCalls, nil
+}
+
+func TestLatestPerCurrency(t *testing.T) {
+	saved := currencies
+	currencies = []string{"usd", "eur", "gbp"}
+	t.Cleanup(func() { currencies = saved })
+
+	repo := newRepository(&fakeStore{latest: []PriceRecord{
+		{Currency: "gbp", Price: 50000},
+		{Currency: "usd", Price: 64000},
+		{Currency: "jpy", Price: 9500000}, // No longer configured
+	}})
+	prices, err := latestPerCurrency(context.Background(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range prices {
+		got = append(got, r.Currency)
+	}
+	if len(got) != 2 || got[0] != "usd" || got[1] != "gbp" {
+		t.Errorf("latestPerCurrency returned %v, want [usd gbp] in configured order", got)
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	saved := budgetConfig
+	budgetConfig = BudgetConfig{Limit: 100, Window: 24 * time.Hour, AssetLimits: map[string]int{"ethereum": 10}}
+	t.Cleanup(func() { budgetConfig = saved })
+
+	tests := []struct {
+		name      string
+		calls     map[string]int
+		asset     string
+		exhausted bool
+	}{
+		{"within every limit", map[string]int{"bitcoin": 40, "ethereum": 5}, "bitcoin", false},
+		{"global limit reached", map[string]int{"bitcoin": 95, "ethereum": 5}, "bitcoin", true},
+		{"another asset's limit reached", map[string]int{"bitcoin": 40, "ethereum": 10}, "bitcoin", false},
+		{"own limit reached", map[string]int{"bitcoin": 40, "ethereum": 10}, "ethereum", true},
+		{"no calls yet", map[string]int{}, "ethereum", false},
+	}
+	for _, tt := range tests {
+		err := checkBudget(newRepository(&fakeStore{apiCalls: tt.calls}), tt.asset)
+		if got := errors.Is(err, errBudgetExhausted); got != tt.exhausted {
+			t.Errorf("%s: checkBudget(%q) = %v, want exhausted %v", tt.name, tt.asset, err, tt.exhausted)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"  // Package for cancelling a scheduled run
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"strconv"  // Package for parsing RETENTION_DRY_RUN
+	"time"     // Package for retention cutoffs
+)
+
+// RetentionPolicy controls how long prices are kept at each resolution
+// A zero duration disables that step.
+type RetentionPolicy struct {
+	Raw      time.Duration // Raw samples older than this are averaged per hour
+	Hourly   time.Duration // Prices older than this are averaged per day
+	Purge    time.Duration // Prices older than this are deleted
+	Interval time.Duration // How often the scheduler applies the policy
+	DryRun   bool          // The scheduler only logs what it would change
+}
+
+// retentionPolicy is the active policy, loaded at startup
+var retentionPolicy RetentionPolicy
+
+// enabled reports whether any retention step is configured
+func (p RetentionPolicy) enabled() bool {
+	return p.Raw > 0 || p.Hourly > 0 || p.Purge > 0
+}
+
+// loadRetentionPolicy reads RETENTION_RAW, RETENTION_HOURLY, RETENTION_PURGE,
+// RETENTION_INTERVAL, and RETENTION_DRY_RUN; ages accept a "d" suffix, e.g. 90d
+func loadRetentionPolicy() (RetentionPolicy, error) {
+	p := RetentionPolicy{Interval: 24 * time.Hour}
+
+	for _, setting := range []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"RETENTION_RAW", &p.Raw},
+		{"RETENTION_HOURLY", &p.Hourly},
+		{"RETENTION_PURGE", &p.Purge},
+		{"RETENTION_INTERVAL", &p.Interval},
+	} {
+		if v := os.Getenv(setting.env); v != "" {
+			d, err := parseStatsWindow(v)
+			if err != nil {
+				return p, fmt.Errorf("invalid %s %q", setting.env, v)
+			}
+			*setting.dst = d
+		}
+	}
+	if v := os.Getenv("RETENTION_DRY_RUN"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid RETENTION_DRY_RUN %q", v)
+		}
+		p.DryRun = dryRun
+	}
+
+	// Each step must act on older data than the one before it
+	if p.Raw > 0 && p.Hourly > 0 && p.Hourly < p.Raw {
+		return p, fmt.Errorf("RETENTION_HOURLY (%s) must not be shorter than RETENTION_RAW (%s)", p.Hourly, p.Raw)
+	}
+	if p.Purge > 0 && p.Purge < max(p.Raw, p.Hourly) {
+		return p, fmt.Errorf("RETENTION_PURGE (%s) must not be shorter than RETENTION_RAW or RETENTION_HOURLY", p.Purge)
+	}
+	return p, nil
+}
+
+// downsampledSource returns the source stored on the averages of a resolution
+func downsampledSource(resolution string) string {
+	return "avg-" + resolution
+}
+
+// downsampledSourcesFrom returns the sources of averages at resolution or coarser
+func downsampledSourcesFrom(resolution string) []string {
+	if resolution == CandleDaily {
+		return []string{downsampledSource(CandleDaily)}
+	}
+	return []string{downsampledSource(CandleHourly), downsampledSource(CandleDaily)}
+}
+
+// RetentionStep is what one retention step changed, or would change in a dry run
+type RetentionStep struct {
+	Action  string    // "purge", "downsample 1d", or "downsample 1h"
+	Before  time.Time // Prices recorded before this were affected
+	Removed int       // Rows deleted
+	Added   int       // Averages written in their place
+}
+
+// applyRetention runs the configured steps, oldest data first: purging, then daily
+// averages, then hourly averages. Each step only looks at data newer than the previous
+// step's cutoff, so a dry run reports what a real run would do. Downsampling cutoffs
+// are aligned to whole hours and days so a bucket is never split between raw samples
+// and its average. Once ctx is done the remaining steps are skipped.
+func applyRetention(ctx context.Context, repo *Repository, p RetentionPolicy, now time.Time, dryRun bool) ([]RetentionStep, error) {
+	var steps []RetentionStep
+	var from time.Time
+
+	if p.Purge > 0 {
+		from = now.Add(-p.Purge).UTC()
+		removed, err := repo.PurgePrices(from, dryRun)
+		if err != nil {
+			return steps, err
+		}
+		steps = append(steps, RetentionStep{Action: "purge", Before: from, Removed: removed})
+	}
+
+	for _, tier := range []struct {
+		resolution string
+		age        time.Duration
+	}{
+		{CandleDaily, p.Hourly},
+		{CandleHourly, p.Raw},
+	} {
+		if tier.age <= 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return steps, err
+		}
+		before := candleStart(now.Add(-tier.age), tier.resolution)
+		removed, added, err := repo.DownsamplePrices(tier.resolution, from, before, dryRun)
+		if err != nil {
+			return steps, err
+		}
+		steps = append(steps, RetentionStep{Action: "downsample " + tier.resolution, Before: before, Removed: removed, Added: added})
+		from = before
+	}
+	return steps, nil
+}
+
+// runScheduledRetention applies the retention policy from the scheduler
+// Failures are logged; the next run tries again
+func runScheduledRetention(ctx context.Context, repo *Repository) {
+	p := retentionPolicy
+	start := time.Now()
+	steps, err := applyRetention(ctx, repo, p, start, p.DryRun)
+	for _, step := range steps {
+		slog.Info("Retention step finished", "action", step.Action, "before", step.Before.Format(time.RFC3339),
+			"removed", step.Removed, "added", step.Added, "dry_run", p.DryRun)
+		if !p.DryRun {
+			incCounter("tracker_retention_rows_removed_total", map[string]string{"action": step.Action}, float64(step.Removed))
+		}
+	}
+	if err != nil {
+		slog.Error("Retention failed", "error", err)
+		return
+	}
+	slog.Info("Retention finished", "dry_run", p.DryRun, "duration", time.Since(start).Round(time.Millisecond))
+}
+
+// runRetentionCommand handles "retention [--dry-run]", applying the policy once
+func runRetentionCommand(repo *Repository, args []string) error {
+	fs := newFlagSet("retention")
+	dryRun := fs.Bool("dry-run", false, "Only report what would be changed")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+
+	p := retentionPolicy
+	if !p.enabled() {
+		return fmt.Errorf("no retention policy configured (set RETENTION_RAW, RETENTION_HOURLY, or RETENTION_PURGE)")
+	}
+
+	steps, err := applyRetention(context.Background(), repo, p, time.Now(), *dryRun)
+	if *dryRun {
+		fmt.Println("\nRetention (dry run, nothing changed)")
+	} else {
+		fmt.Println("\nRetention")
+	}
+	fmt.Println("------------------------------------------------------------")
+	fmt.Printf("%-15s %-21s %10s %10s\n", "Step", "Before", "Removed", "Added")
+	for _, step := range steps {
+		fmt.Printf("%-15s %-21s %10d %10d\n", step.Action, step.Before.Format("2006-01-02 15:04 UTC"), step.Removed, step.Added)
+	}
+	fmt.Println()
+	return err
+}
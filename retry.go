@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"  // Package for the fetch deadline
+	"errors"   // Package for inspecting wrapped errors
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"strconv"  // Package for parsing numeric settings
+	"time"     // Package for delays
+
+	"bitcoin-tracker/tracker" // Retry policy shared with the fetch pipeline
+)
+
+// RetryPolicy controls how failed fetches are retried within one cycle
+type RetryPolicy = tracker.RetryPolicy
+
+// retryPolicy is the active retry policy, loaded at startup
+var retryPolicy = tracker.DefaultRetryPolicy()
+
+// loadRetryPolicy reads RETRY_MAX_ATTEMPTS, RETRY_BASE_DELAY, RETRY_MAX_DELAY, and RETRY_JITTER
+func loadRetryPolicy() (RetryPolicy, error) {
+	p := tracker.DefaultRetryPolicy()
+
+	if v := os.Getenv("RETRY_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("invalid RETRY_MAX_ATTEMPTS %q", v)
+		}
+		p.MaxAttempts = n
+	}
+	if v := os.Getenv("RETRY_BASE_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return p, fmt.Errorf("invalid RETRY_BASE_DELAY %q", v)
+		}
+		p.BaseDelay = d
+	}
+	if v := os.Getenv("RETRY_MAX_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return p, fmt.Errorf("invalid RETRY_MAX_DELAY %q", v)
+		}
+		p.MaxDelay = d
+	}
+	if v := os.Getenv("RETRY_JITTER"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return p, fmt.Errorf("invalid RETRY_JITTER %q (must be in [0,1])", v)
+		}
+		p.Jitter = f
+	}
+	return p, nil
+}
+
+// retryPolicyFor returns the active policy for an operation: an exhausted fetch
+// budget, or a provider quota that outlasts the deadline, is not retried, and retries
+// are logged and counted
+func retryPolicyFor(op string) RetryPolicy {
+	p := retryPolicy
+	p.Permanent = func(err error) bool {
+		return errors.Is(err, errBudgetExhausted) || errors.Is(err, errRateLimited)
+	}
+	p.OnRetry = func(attempt int, delay time.Duration, err error) {
+		slog.Warn("Operation failed, retrying", "op", op, "attempt", attempt,
+			"max_attempts", p.MaxAttempts, "delay", delay.Round(time.Millisecond), "error", err)
+		incCounter("tracker_fetch_retries_total", nil, 1)
+	}
+	p.OnGiveUp = func(attempt int, delay time.Duration, reason error) {
+		if errors.Is(reason, tracker.ErrRetryAfterTooLong) {
+			slog.Warn("Provider asked to retry later than allowed, giving up until next cycle",
+				"op", op, "attempt", attempt, "retry_after", delay.Round(time.Second))
+			return
+		}
+		slog.Warn("Retry would pass the fetch deadline, giving up until next cycle",
+			"op", op, "attempt", attempt, "delay", delay.Round(time.Millisecond))
+	}
+	return p
+}
+
+// withRetry runs fn until it succeeds, fails permanently, or runs out of attempts
+// (see tracker.RetryPolicy.Do)
+func withRetry(ctx context.Context, op string, fn func() error) error {
+	return retryPolicyFor(op).Do(ctx, fn)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"  // Package for stopping the watchdog
+	"errors"   // Package for checking file errors
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"net"      // Package for the systemd notification socket
+	"os"       // Package for the PID file and environment variables
+	"strconv"  // Package for parsing PIDs and WATCHDOG_USEC
+	"strings"  // Package for string manipulation
+	"syscall"  // Package for probing whether a PID is alive
+	"time"     // Package for the watchdog interval
+)
+
+// writePIDFile records this process's PID in path, refusing to start when the file
+// names another tracker that is still running. The returned function removes the
+// file again, unless another process has replaced it in the meantime.
+func writePIDFile(path string) (func(), error) {
+	pid := os.Getpid()
+	if b, err := os.ReadFile(path); err == nil {
+		if other, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil && other != pid && processAlive(other) {
+			return nil, fmt.Errorf("already running as PID %d (remove %s if that is wrong)", other, path)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read PID file: %w", err)
+	}
+
+	// Write through a temporary file so a reader never sees a partial PID
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(pid)+"\n"), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write PID file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to write PID file: %w", err)
+	}
+	slog.Info("Wrote PID file", "path", path, "pid", pid)
+
+	return func() {
+		if b, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(b)) == strconv.Itoa(pid) {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+// processAlive reports whether a process with the given PID exists
+// EPERM means it exists but belongs to another user
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// sdNotify sends a state update such as "READY=1" to the service manager
+// It does nothing unless the process was started by systemd with Type=notify,
+// which sets NOTIFY_SOCKET
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// A leading @ names a socket in the abstract namespace
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to NOTIFY_SOCKET: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify service manager: %w", err)
+	}
+	return nil
+}
+
+// notifyServiceManager sends a state update and logs a failure instead of returning it;
+// supervision is best effort and never stops the scheduler
+func notifyServiceManager(state string) {
+	if err := sdNotify(state); err != nil {
+		slog.Warn("Service manager notification failed", "state", strings.ReplaceAll(state, "\n", " "), "error", err)
+	}
+}
+
+// watchdogInterval returns the watchdog timeout systemd expects pings within, or zero
+// when WatchdogSec is not set for this process
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// runWatchdog pings the systemd watchdog at half its timeout until ctx is cancelled
+// Pings stop while the scheduler loop is overdue, the same condition that fails
+// /healthz, so systemd restarts a tracker whose loop is stuck rather than one that
+// merely can't reach its price providers
+func runWatchdog(ctx context.Context, timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+
+	slog.Info("Systemd watchdog enabled", "timeout", timeout)
+	stalled := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if daemon.overdue(time.Now()) {
+				if !stalled {
+					slog.Error("Scheduler is overdue, withholding watchdog pings")
+					stalled = true
+				}
+				continue
+			}
+			stalled = false
+			notifyServiceManager("WATCHDOG=1")
+		}
+	}
+}
+
+// reloadConfig re-reads the configuration for SIGHUP, the control socket's reload, and
+// edits to the --config file, telling the service manager while it does and logging
+// which settings changed
+func reloadConfig(trigger string) error {
+	slog.Info("Reloading configuration", "trigger", trigger)
+	notifyServiceManager("RELOADING=1")
+	before := configSnapshot()
+	err := loadConfig()
+	if err != nil {
+		slog.Error("Configuration reload failed", "error", err)
+	} else {
+		logConfigDiff(before, configSnapshot())
+	}
+	notifyServiceManager("READY=1\nSTATUS=" + schedulerStatusLine())
+	return err
+}
+
+// schedulerStatusLine is the one-line status shown by `systemctl status`
+func schedulerStatusLine() string {
+	if jobConfig.Fetch != nil {
+		return fmt.Sprintf("Fetching %s on schedule %s", strings.Join(currencies, ", "), jobConfig.Fetch)
+	}
+	return fmt.Sprintf("Fetching %s every %s", strings.Join(currencies, ", "), fetchInterval)
+}
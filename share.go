@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"         // Package for cancelling share page queries
+	"crypto/hmac"     // Package for signing share links
+	"crypto/sha256"   // Package for the HMAC hash
+	_ "embed"         // Package for embedding the share page
+	"encoding/base64" // Package for URL-safe tokens
+	"encoding/json"   // Package for token payloads and request bodies
+	"errors"          // Package for token errors
+	"fmt"             // Package for formatted I/O operations
+	"html/template"   // Package for rendering the share page
+	"io"              // Package for limiting request bodies
+	"log/slog"        // Package for structured logging
+	"net/http"        // Package for the share endpoints
+	"net/url"         // Package for validating SHARE_BASE_URL
+	"os"              // Package for environment variables
+	"slices"          // Package for checking currencies
+	"strings"         // Package for string manipulation
+	"time"            // Package for ranges and expiry
+)
+
+// Share link settings that are not configurable
+const (
+	shareDefaultTTL  = 7 * 24 * time.Hour          // Lifetime of a link created without --expires
+	shareMinSecret   = 32                          // Shortest SHARE_SECRET accepted, in bytes
+	shareTokenDomain = "bitcoin-tracker:share:v1:" // Mixed into every signature
+)
+
+// shareKinds maps each kind of shared view to the longest range it accepts
+// Price charts plot every sample like the dashboard's, so they stop at two days.
+var shareKinds = map[string]time.Duration{
+	"prices":  dashboardWidgetTypes["prices"],
+	"candles": dashboardWidgetTypes["candles"], // Hourly candles stop at maxHourlyCandleRange
+	"stats":   dashboardWidgetTypes["candles"],
+}
+
+// ShareConfig controls public share links
+type ShareConfig struct {
+	Secret  string        // Key links are signed with; empty disables sharing
+	BaseURL string        // Public address of the API that links point to
+	MaxTTL  time.Duration // Longest lifetime a link may be given
+}
+
+// enabled reports whether share links can be created and opened
+func (c ShareConfig) enabled() bool {
+	return c.Secret != ""
+}
+
+// shareConfig is the active configuration, loaded at startup
+var shareConfig ShareConfig
+
+// loadShareConfig reads SHARE_SECRET, SHARE_BASE_URL, and SHARE_MAX_TTL (e.g. 30d)
+func loadShareConfig() (ShareConfig, error) {
+	c := ShareConfig{
+		Secret:  os.Getenv("SHARE_SECRET"),
+		BaseURL: strings.TrimRight(os.Getenv("SHARE_BASE_URL"), "/"),
+		MaxTTL:  30 * 24 * time.Hour,
+	}
+	if c.Secret != "" && len(c.Secret) < shareMinSecret {
+		return c, fmt.Errorf("SHARE_SECRET must be at least %d characters, e.g. from `openssl rand -base64 32`", shareMinSecret)
+	}
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c, fmt.Errorf("invalid SHARE_BASE_URL %q (expected e.g. https://tracker.example.com)", c.BaseURL)
+		}
+	}
+	if v := os.Getenv("SHARE_MAX_TTL"); v != "" {
+		d, err := parseStatsWindow(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid SHARE_MAX_TTL %q", v)
+		}
+		c.MaxTTL = d
+	}
+	return c, nil
+}
+
+// ShareLink is what a share token grants: one view of one currency over a fixed range
+// The short JSON names keep tokens, and so URLs, short.
+type ShareLink struct {
+	Kind       string `json:"k"`           // One of shareKinds
+	Currency   string `json:"c"`           // Currency shown
+	Resolution string `json:"r,omitempty"` // Candle resolution of candles links
+	From       int64  `json:"f"`           // Start of the range, Unix seconds
+	To         int64  `json:"t"`           // End of the range (exclusive), Unix seconds
+	Expires    int64  `json:"e"`           // When the link stops working, Unix seconds
+}
+
+// Errors of opening a share link
+var (
+	errShareInvalid = errors.New("this share link is not valid")
+	errShareExpired = errors.New("this share link has expired")
+)
+
+// signShare returns the signature of a token's payload
+func signShare(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(shareConfig.Secret))
+	mac.Write([]byte(shareTokenDomain + payload))
+	return mac.Sum(nil)
+}
+
+// token encodes and signs the link as "<payload>.<signature>", both base64url
+func (l ShareLink) token() (string, error) {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode share link: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signShare(payload)), nil
+}
+
+// parseShareToken verifies a token's signature and expiry and returns its link
+func parseShareToken(token string, now time.Time) (ShareLink, error) {
+	var link ShareLink
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return link, errShareInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, signShare(payload)) {
+		return link, errShareInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(data, &link) != nil {
+		return link, errShareInvalid
+	}
+	if now.Unix() >= link.Expires {
+		return link, errShareExpired
+	}
+	return link, nil
+}
+
+// shareRequest asks for a link, from POST /share or the share command
+// The range is either Range ending now or From/To.
+type shareRequest struct {
+	Kind       string     `json:"kind"`
+	Currency   string     `json:"currency"`
+	Resolution string     `json:"resolution"`
+	Range      string     `json:"range"`   // Window ending now, e.g. 24h or 90d
+	From       *time.Time `json:"from"`    // Start of a custom range
+	To         *time.Time `json:"to"`      // End of a custom range; now when omitted
+	Expires    string     `json:"expires"` // Lifetime of the link, e.g. 7d; at most SHARE_MAX_TTL
+}
+
+// link validates the request and returns the link it asks for
+func (req shareRequest) link(now time.Time) (ShareLink, error) {
+	link := ShareLink{Kind: req.Kind, Currency: strings.ToLower(req.Currency)}
+	if link.Kind == "" {
+		link.Kind = "prices"
+	}
+	maxRange, ok := shareKinds[link.Kind]
+	if !ok {
+		return link, fmt.Errorf("unknown kind %q (expected prices, candles, or stats)", req.Kind)
+	}
+	if link.Currency == "" {
+		link.Currency = currencies[0]
+	}
+	if !slices.Contains(currencies, link.Currency) {
+		return link, fmt.Errorf("currency %q is not tracked", req.Currency)
+	}
+	if link.Kind == "candles" {
+		if req.Resolution == "" {
+			req.Resolution = CandleDaily
+		}
+		res, err := parseCandleResolution(req.Resolution)
+		if err != nil {
+			return link, err
+		}
+		if link.Resolution = res; res == CandleHourly {
+			maxRange = maxHourlyCandleRange
+		}
+	} else if req.Resolution != "" {
+		return link, fmt.Errorf("%s links take no resolution", link.Kind)
+	}
+
+	// A snapshot never reaches past now, so the view doesn't change as prices arrive
+	from, to := time.Time{}, now
+	switch {
+	case req.From != nil && req.Range != "":
+		return link, fmt.Errorf("use either range or from/to, not both")
+	case req.From != nil:
+		from = *req.From
+		if req.To != nil && req.To.Before(now) {
+			to = *req.To
+		}
+	default:
+		if req.Range == "" {
+			req.Range = "24h"
+		}
+		d, err := parseStatsWindow(req.Range)
+		if err != nil {
+			return link, err
+		}
+		from = now.Add(-d)
+	}
+	if !to.After(from) {
+		return link, fmt.Errorf("the range must end after it starts, and start before now")
+	}
+	if to.Sub(from) > maxRange {
+		return link, fmt.Errorf("range is longer than the %dd %s links allow", int(maxRange.Hours()/24), link.Kind)
+	}
+
+	ttl := shareDefaultTTL
+	if req.Expires != "" {
+		d, err := parseStatsWindow(req.Expires)
+		if err != nil {
+			return link, fmt.Errorf("invalid expires %q (expected e.g. 1h or 7d)", req.Expires)
+		}
+		ttl = d
+	}
+	if ttl > shareConfig.MaxTTL {
+		return link, fmt.Errorf("links may last at most %s (SHARE_MAX_TTL)", formatShareTTL(shareConfig.MaxTTL))
+	}
+
+	link.From, link.To, link.Expires = from.Unix(), to.Unix(), now.Add(ttl).Unix()
+	return link, nil
+}
+
+// formatShareTTL formats a lifetime in days when it is a whole number of them
+func formatShareTTL(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// shareURL returns the address of a token under base
+func shareURL(base, token string) string {
+	return base + "/share/" + token
+}
+
+// requestBaseURL returns the address a request reached the API at, for links it hands out
+// SHARE_BASE_URL takes precedence, since a proxy in front may change the host.
+func requestBaseURL(r *http.Request) string {
+	if shareConfig.BaseURL != "" {
+		return shareConfig.BaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// ShareView is the data behind a share page, also served as JSON with ?format=json
+type ShareView struct {
+	Kind       string        `json:"kind"`
+	Currency   string        `json:"currency"`
+	Resolution string        `json:"resolution,omitempty"`
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Expires    time.Time     `json:"expires"`
+	Stats      PriceStats    `json:"stats"`
+	Prices     []PriceRecord `json:"prices,omitempty"`
+	Candles    []Candle      `json:"candles,omitempty"`
+}
+
+// loadShareView reads what a link shows from the store
+func loadShareView(ctx context.Context, repo *Repository, link ShareLink) (ShareView, error) {
+	view := ShareView{
+		Kind: link.Kind, Currency: link.Currency, Resolution: link.Resolution,
+		From: time.Unix(link.From, 0).UTC(), To: time.Unix(link.To, 0).UTC(), Expires: time.Unix(link.Expires, 0).UTC(),
+	}
+	var err error
+	if view.Stats, err = computePriceStats(ctx, repo, link.Currency, view.From, view.To); err != nil {
+		return view, err
+	}
+	switch link.Kind {
+	case "prices":
+		view.Prices, err = repo.PriceRange(link.Currency, view.From, view.To, maxRangeLimit)
+	case "candles":
+		view.Candles, err = repo.Candles(ctx, link.Currency, link.Resolution, view.From, view.To, maxRangeLimit)
+	}
+	return view, err
+}
+
+// shareHTML is the read-only page a share link opens
+//
+//go:embed web/share.html
+var shareHTML string
+
+// shareTemplate renders a shared view, or why it can't be shown
+var shareTemplate = template.Must(template.New("share").Parse(shareHTML))
+
+// handleShares serves POST /share, which creates a link from a shareRequest and
+// returns its URL, and GET /share/<token>, the page the link opens. Opening a link
+// needs no API key: the signature is the permission. Without SHARE_SECRET both are 404.
+func (s *apiServer) handleShares(w http.ResponseWriter, r *http.Request) {
+	if !shareConfig.enabled() {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.URL.Path == "/share" {
+		handleCreateShare(w, r)
+		return
+	}
+	handleOpenShare(s.repo, w, r, strings.TrimPrefix(r.URL.Path, "/share/"))
+}
+
+// handleCreateShare serves POST /share
+func handleCreateShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req shareRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<12)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid share request: %v", err)
+		return
+	}
+	link, err := req.link(time.Now())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	token, err := link.token()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "failed to create share link")
+		return
+	}
+
+	slog.Info("Created share link", "kind", link.Kind, "currency", link.Currency,
+		"from", time.Unix(link.From, 0).UTC(), "to", time.Unix(link.To, 0).UTC(), "expires", time.Unix(link.Expires, 0).UTC())
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"url":     shareURL(requestBaseURL(r), token),
+		"expires": time.Unix(link.Expires, 0).UTC(),
+	})
+}
+
+// handleOpenShare serves GET /share/<token> as a page, or as JSON with ?format=json
+func handleOpenShare(repo *Repository, w http.ResponseWriter, r *http.Request, token string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	// The token is the permission, so keep it out of other sites' logs and search indexes
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	asJSON := r.URL.Query().Get("format") == "json"
+
+	link, err := parseShareToken(token, time.Now())
+	if err != nil {
+		status, result, kind := http.StatusNotFound, "invalid", "unknown"
+		if errors.Is(err, errShareExpired) {
+			status, result, kind = http.StatusGone, "expired", link.Kind
+		}
+		incCounter("tracker_share_views_total", map[string]string{"kind": kind, "result": result}, 1)
+		renderShare(w, status, asJSON, ShareView{}, err.Error())
+		return
+	}
+
+	view, err := loadShareView(r.Context(), repo, link)
+	if err != nil {
+		slog.Error("Failed to load shared view", "kind", link.Kind, "currency", link.Currency, "error", err)
+		incCounter("tracker_share_views_total", map[string]string{"kind": link.Kind, "result": "error"}, 1)
+		renderShare(w, http.StatusInternalServerError, asJSON, ShareView{}, "failed to load the shared prices")
+		return
+	}
+	incCounter("tracker_share_views_total", map[string]string{"kind": link.Kind, "result": "ok"}, 1)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	renderShare(w, http.StatusOK, asJSON, view, "")
+}
+
+// renderShare writes a shared view, or message when it can't be shown
+func renderShare(w http.ResponseWriter, status int, asJSON bool, view ShareView, message string) {
+	if asJSON {
+		if message != "" {
+			writeAPIError(w, status, "%s", message)
+		} else {
+			writeJSON(w, status, view)
+		}
+		return
+	}
+	if message != "" {
+		message = strings.ToUpper(message[:1]) + message[1:] // A sentence on the page
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	err := shareTemplate.Execute(w, map[string]interface{}{"View": view, "Error": message})
+	if err != nil {
+		slog.Error("Failed to render share page", "error", err)
+	}
+}
+
+// runShareCommand handles "share [--kind prices|candles|stats] [--currency usd]
+// [--resolution 1d] [--range 24h | --from ... --to ...] [--expires 7d]" and prints the link
+func runShareCommand(args []string) error {
+	if !shareConfig.enabled() {
+		return fmt.Errorf("share links need SHARE_SECRET")
+	}
+
+	fs := newFlagSet("share")
+	kind := fs.String("kind", "prices", "What to share: prices (a chart of every sample), candles, or stats")
+	currency := fs.String("currency", currencies[0], "Currency to share")
+	resolution := fs.String("resolution", "", "Candle resolution of --kind candles: 1h or 1d (default 1d)")
+	rangeFlag := fs.String("range", "", "Window ending now, e.g. 24h or 90d (default 24h)")
+	fromFlag := fs.String("from", "", "Start of a custom range: YYYY-MM-DD or RFC 3339")
+	toFlag := fs.String("to", "now", "End of a custom range: now, YYYY-MM-DD, or RFC 3339")
+	expires := fs.String("expires", formatShareTTL(shareDefaultTTL), "How long the link works, e.g. 1h or 7d")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+
+	req := shareRequest{Kind: *kind, Currency: *currency, Resolution: *resolution, Range: *rangeFlag, Expires: *expires}
+	if *fromFlag != "" {
+		from, err := parseTimeFlag("from", *fromFlag)
+		if err != nil {
+			return err
+		}
+		to, err := parseTimeFlag("to", *toFlag)
+		if err != nil {
+			return err
+		}
+		req.From, req.To = &from, &to
+	}
+	link, err := req.link(time.Now())
+	if err != nil {
+		return err
+	}
+	token, err := link.token()
+	if err != nil {
+		return err
+	}
+
+	base := shareConfig.BaseURL
+	if base == "" {
+		base = "http://localhost" + defaultAPIAddr
+		slog.Warn("SHARE_BASE_URL is not set, so the link points at localhost")
+	}
+	fmt.Println(shareURL(base, token))
+	fmt.Fprintf(os.Stderr, "Anyone with the link can see this view until %s.\n", time.Unix(link.Expires, 0).In(displayLocation).Format("2006-01-02 15:04"))
+	return nil
+}
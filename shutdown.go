@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"  // Package for cancellation
+	"fmt"      // Package for formatted errors
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"time"     // Package for the drain timeout
+)
+
+// shutdownTimeout is how long in-flight work may run after a shutdown signal
+// Configured via SHUTDOWN_TIMEOUT (Go duration)
+var shutdownTimeout = 30 * time.Second
+
+// loadShutdownTimeout reads SHUTDOWN_TIMEOUT, falling back to 30 seconds
+func loadShutdownTimeout() (time.Duration, error) {
+	v := os.Getenv("SHUTDOWN_TIMEOUT")
+	if v == "" {
+		return 30 * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q", v)
+	}
+	return d, nil
+}
+
+// runWithDrain runs fn until it returns. Once ctx is cancelled by a shutdown signal,
+// fn gets shutdownTimeout to finish in-flight work (e.g. a fetch and its DB write)
+// before we give up waiting. stop restores default signal handling so a second
+// Ctrl-C terminates immediately.
+func runWithDrain(ctx context.Context, stop context.CancelFunc, fn func(context.Context)) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(ctx)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	stop()
+	slog.Info("Shutdown signal received, waiting for in-flight work", "timeout", shutdownTimeout)
+
+	select {
+	case <-done:
+		slog.Info("Shutdown complete")
+	case <-time.After(shutdownTimeout):
+		slog.Warn("Drain period expired, exiting with work still in flight")
+	}
+}
+
+// drainContext returns the context for work started under ctx, such as a fetch and its
+// database write. It stays alive for shutdownTimeout after ctx is cancelled, so the work
+// can finish during the drain period, and is cancelled once that expires rather than
+// having the process exit in the middle of it.
+func drainContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	work, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(shutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-work.Done():
+		case <-timer.C:
+			slog.Warn("Drain period expired, cancelling in-flight work")
+			cancel()
+		}
+	})
+	return work, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"       // Package for fetch deadlines
+	"encoding/json" // Package for JSON parsing
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for reading response bodies
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for HTTP client operations
+	"os"            // Package for environment variables
+	"slices"        // Package for sorting source names
+	"strings"       // Package for string manipulation
+	"time"          // Package for HTTP timeouts
+
+	"bitcoin-tracker/tracker" // Fetch pipeline and built-in providers, shared with library users
+)
+
+// The providers, failover, retries, and price validation live in the tracker package,
+// which Go programs can also run in-process. The daemon plugs its own request path into
+// it through providerFetcher: responses are cached, rate limited, counted against the
+// fetch budget, kept with RAW_RESPONSES, and markets are named by PROVIDER_SYMBOLS and
+// the providers' listings.
+
+// PriceSource is implemented by every price provider
+// Capabilities probes the provider's listings (see capabilities.go); when that fails
+// the built-in metadata is still returned, with ProbeError set.
+type PriceSource interface {
+	tracker.Source
+	Capabilities(ctx context.Context, repo *Repository) ProviderCapabilities
+}
+
+// providerFetcher makes the providers' requests through getJSON and names markets with
+// marketSymbol
+type providerFetcher struct {
+	repo *Repository // Nil without a database
+}
+
+// GetJSON implements tracker.Fetcher
+// The sources only request prices, so the responses are kept with RAW_RESPONSES.
+func (f providerFetcher) GetJSON(ctx context.Context, req tracker.Request, out any) error {
+	return fetchProviderJSON(captureRawResponses(ctx), f.repo, req, out)
+}
+
+// Symbol implements tracker.Fetcher
+func (f providerFetcher) Symbol(ctx context.Context, provider, asset, currency string) (string, error) {
+	m, err := marketSymbol(ctx, f.repo, provider, asset, currency)
+	return m.Symbol, err
+}
+
+// httpClient is shared by all price sources
+// Its timeout bounds a single request; see HTTP_TIMEOUT. Its transport, with the
+// proxy and TLS settings, is set by applyHTTPClientConfig.
+var httpClient = &http.Client{
+	Timeout: 30 * time.Second, // Increased timeout for reliability
+}
+
+// fetchDeadline bounds a whole fetch cycle: every retry and failover across
+// PRICE_SOURCES. Configured via FETCH_DEADLINE and never longer than the fetch
+// interval, so a failing provider chain can't push back the next scheduled fetch.
+var fetchDeadline = 2 * time.Minute
+
+// loadHTTPTimeout reads HTTP_TIMEOUT, the limit for a single outgoing request
+func loadHTTPTimeout() (time.Duration, error) {
+	v := os.Getenv("HTTP_TIMEOUT")
+	if v == "" {
+		return 30 * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid HTTP_TIMEOUT %q", v)
+	}
+	return d, nil
+}
+
+// loadFetchDeadline reads FETCH_DEADLINE, capped at the fetch interval
+// Call it after the interval has been loaded
+func loadFetchDeadline() (time.Duration, error) {
+	d := 2 * time.Minute
+	if v := os.Getenv("FETCH_DEADLINE"); v != "" {
+		var err error
+		if d, err = time.ParseDuration(v); err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid FETCH_DEADLINE %q", v)
+		}
+	}
+	return min(d, fetchInterval), nil
+}
+
+// withFetchDeadline returns a context that expires after fetchDeadline
+func withFetchDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, fetchDeadline)
+}
+
+// availableSources lists every built-in provider by its config name
+var availableSources = map[string]PriceSource{
+	"coingecko": coinGeckoSource{},
+	"coinbase":  coinbaseSource{tracker.Coinbase()},
+	"binance":   binanceSource{tracker.Binance()},
+	"kraken":    krakenSource{tracker.Kraken()},
+	"mock":      mockSource{}, // Simulated prices for --demo
+}
+
+// priceSources is the ordered failover list used for every fetch
+var priceSources = []PriceSource{coinGeckoSource{}}
+
+// loadPriceSources parses PRICE_SOURCES (e.g. "coingecko,kraken") into an ordered list
+// The first source is the primary; the rest are tried in order when it fails
+func loadPriceSources() ([]PriceSource, error) {
+	v := os.Getenv("PRICE_SOURCES")
+	if v == "" {
+		return []PriceSource{coinGeckoSource{}}, nil
+	}
+
+	var list []PriceSource
+	for _, name := range strings.Split(v, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		source, ok := availableSources[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown price source %q", name)
+		}
+		list = append(list, source)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("PRICE_SOURCES is empty")
+	}
+	return list, nil
+}
+
+// fetchPipeline returns the fetch across PRICE_SOURCES with the retry policy, making
+// its requests with providerFetcher. With PRICE_AGGREGATION=weighted every source is
+// asked in each attempt instead (see aggregate.go).
+func fetchPipeline(repo *Repository) tracker.Pipeline {
+	p := tracker.Pipeline{
+		Sources: make([]tracker.Source, len(priceSources)),
+		Fetcher: providerFetcher{repo: repo},
+		Retry:   retryPolicyFor("Price fetch"),
+		OnSourceError: func(source, asset string, currencies []string, err error) {
+			slog.Warn("Price source failed", "source", source, "coin", asset, "currencies", strings.Join(currencies, ","), "error", err)
+		},
+	}
+	for i, source := range priceSources {
+		p.Sources[i] = source
+	}
+	if aggregationConfig.weighted() {
+		p.Attempt = func(ctx context.Context, asset string, currencies []string) (map[string]float64, map[string]string, map[string]time.Time, error) {
+			return fetchWeighted(ctx, repo, asset, currencies)
+		}
+	}
+	return p
+}
+
+// fetchFromSources makes one attempt at pricing every currency: each configured source
+// in order, or every source with PRICE_AGGREGATION=weighted (see tracker.Pipeline.Failover)
+func fetchFromSources(ctx context.Context, repo *Repository, asset string, currencies []string) (map[string]float64, map[string]string, map[string]time.Time, error) {
+	p := fetchPipeline(repo)
+	if p.Attempt != nil {
+		return p.Attempt(ctx, asset, currencies)
+	}
+	return p.Failover(ctx, asset, currencies)
+}
+
+// pricesBySource splits prices by the source that supplied them
+func pricesBySource(prices map[string]float64, sources map[string]string) map[string]map[string]float64 {
+	groups := make(map[string]map[string]float64)
+	for currency, price := range prices {
+		source := sources[currency]
+		if groups[source] == nil {
+			groups[source] = make(map[string]float64)
+		}
+		groups[source][currency] = price
+	}
+	return groups
+}
+
+// sourceList names the sources that supplied prices, e.g. "coingecko" or "coingecko,kraken"
+func sourceList(sources map[string]string) string {
+	var names []string
+	for _, source := range sources {
+		if !slices.Contains(names, source) {
+			names = append(names, source)
+		}
+	}
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
+
+// fetchPricesWithRetry fetches every currency within ctx, retrying only the
+// currencies that failed. It returns whatever was priced, with the source of each
+// price and when it was quoted; the error is a *tracker.PartialError when some
+// currencies are still missing. checkBudget, when set, runs before every attempt.
+func fetchPricesWithRetry(ctx context.Context, repo *Repository, asset string, currencies []string, checkBudget func() error) (map[string]float64, map[string]string, map[string]time.Time, error) {
+	p := fetchPipeline(repo)
+	p.BeforeAttempt = checkBudget
+	return p.Fetch(ctx, asset, currencies)
+}
+
+// getJSON performs a GET request against a provider and decodes the JSON body into out
+// Every answered request is counted against the fetch budget. Each request is bounded
+// by HTTP_TIMEOUT and by ctx, which carries the deadline of the whole fetch cycle.
+// Requests carry the provider's headers and are counted and timed per provider (see
+// providerrequests.go), and wait for the provider's rate limit (see ratelimit.go). A
+// response from within the provider's PROVIDER_CACHE_TTL is reused, and an older one
+// revalidated (see providercache.go). The bodies of price fetches are kept with
+// RAW_RESPONSES (see rawresponses.go).
+func getJSON(ctx context.Context, repo *Repository, provider, asset, url string, out interface{}) error {
+	return fetchProviderJSON(ctx, repo, tracker.Request{Provider: provider, Asset: asset, URL: url}, out)
+}
+
+// fetchProviderJSON is getJSON for a request that may carry headers of its own, such
+// as the API key a source adds
+func fetchProviderJSON(ctx context.Context, repo *Repository, r tracker.Request, out interface{}) (err error) {
+	provider, asset, url := r.Provider, r.Asset, r.URL
+	ctx, span := startChildSpan(ctx, "fetch "+provider, spanClient)
+	span.set("provider", provider)
+	span.set("coin", asset)
+	span.set("http.request.method", http.MethodGet)
+	defer func() { span.finish(err) }()
+
+	cached, fresh := cachedProviderResponse(provider, url)
+	span.set("cache.hit", fresh)
+	if fresh {
+		incCounter("tracker_provider_cache_total", map[string]string{"provider": provider, "result": "hit"}, 1)
+		return decodeProviderJSON(cached.body, out)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range r.Header {
+		req.Header[name] = values
+	}
+	setProviderHeaders(req, provider)
+	if provider == "coingecko" {
+		coinGeckoAPI.Authorize(req.Header)
+	}
+	if cached != nil {
+		cached.revalidate(req)
+	}
+	injectTraceparent(ctx, req)
+
+	// Space requests and wait out an exhausted quota instead of hammering the provider
+	if err := waitRateLimit(ctx, provider); err != nil {
+		return err
+	}
+
+	// Make the HTTP request
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	observeProviderRequest(provider, resp, err, time.Since(start))
+	if err != nil {
+		return withKind(KindProvider, fmt.Errorf("failed to make HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+	span.set("http.response.status_code", resp.StatusCode)
+	observeRateLimit(provider, resp)
+
+	// Every answered request counts against the provider's plan limit
+	if err := recordAPICall(repo, provider, asset); err != nil {
+		slog.Warn("Failed to record API call", "provider", provider, "coin", asset, "error", err)
+	}
+
+	// The provider confirmed the cached response is still current
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		touchProviderResponse(url)
+		incCounter("tracker_provider_cache_total", map[string]string{"provider": provider, "result": "not_modified"}, 1)
+		return decodeProviderJSON(cached.body, out)
+	}
+
+	// Check HTTP status; keep Retry-After so rate limits can be honored
+	if resp.StatusCode != http.StatusOK {
+		return &tracker.StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: tracker.ParseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return withKind(KindProvider, fmt.Errorf("failed to read response: %w", err))
+	}
+	if err := decodeProviderJSON(body, out); err != nil {
+		return err
+	}
+	if capturesRawResponses(ctx, repo) {
+		keepRawResponse(ctx, repo, provider, asset, url, body)
+	}
+	cacheProviderResponse(provider, url, body, resp.Header)
+	incCounter("tracker_provider_cache_total", map[string]string{"provider": provider, "result": "miss"}, 1)
+	return nil
+}
+
+// decodeProviderJSON parses a provider's JSON response into out
+func decodeProviderJSON(body []byte, out interface{}) error {
+	if err := json.Unmarshal(body, out); err != nil {
+		return withKind(KindProvider, fmt.Errorf("failed to parse JSON response: %w", err))
+	}
+	return nil
+}
+
+// tickerSymbol maps our asset ids to the canonical ticker symbol
+// Each provider's identifier for a market is derived from it in symbols.go
+var tickerSymbol = tracker.Tickers()
+
+// CoinGeckoAPI is the optional CoinGecko API key (COINGECKO_API_KEY) and its plan
+type CoinGeckoAPI = tracker.CoinGeckoAPI
+
+// coinGeckoAPI is the active CoinGecko API configuration, loaded at startup
+var coinGeckoAPI = CoinGeckoAPI{Plan: "public"}
+
+// loadCoinGeckoAPI reads COINGECKO_API_KEY and COINGECKO_API_PLAN
+// A key defaults to the demo plan; Pro keys need COINGECKO_API_PLAN=pro
+func loadCoinGeckoAPI() (CoinGeckoAPI, error) {
+	api := CoinGeckoAPI{Key: os.Getenv("COINGECKO_API_KEY"), Plan: "public"}
+	if api.Key != "" {
+		api.Plan = "demo"
+	}
+	if v := strings.ToLower(os.Getenv("COINGECKO_API_PLAN")); v != "" {
+		if v != "demo" && v != "pro" {
+			return api, fmt.Errorf("invalid COINGECKO_API_PLAN %q (expected demo or pro)", v)
+		}
+		if api.Key == "" {
+			return api, fmt.Errorf("COINGECKO_API_PLAN is set but COINGECKO_API_KEY is empty")
+		}
+		api.Plan = v
+	}
+	return api, nil
+}
+
+// coinGeckoRateLimit returns the default rate limit of a CoinGecko plan
+func coinGeckoRateLimit(plan string) RateLimit {
+	switch plan {
+	case "demo":
+		return RateLimit{Requests: 30, Per: time.Minute}
+	case "pro":
+		return RateLimit{Requests: 500, Per: time.Minute}
+	default:
+		return RateLimit{Requests: 10, Per: time.Minute}
+	}
+}
+
+// coinGeckoSource is the tracker's CoinGecko source with the configured API key, and
+// with MARKET_DATA the volume and market cap handed over for the bitcoin prices
+type coinGeckoSource struct{}
+
+// source returns the tracker source for the current configuration
+func (coinGeckoSource) source() tracker.CoinGeckoSource {
+	s := tracker.CoinGeckoSource{API: coinGeckoAPI}
+	if marketDataEnabled {
+		s.MarketData = func(asset string, data map[string]tracker.MarketData) {
+			if asset == "bitcoin" {
+				captureMarketData(data)
+			}
+		}
+	}
+	return s
+}
+
+// Name returns the config name of the source
+func (s coinGeckoSource) Name() string { return s.source().Name() }
+
+// FetchPrices implements tracker.Source
+func (s coinGeckoSource) FetchPrices(ctx context.Context, f tracker.Fetcher, asset string, currencies []string) (map[string]float64, error) {
+	return s.source().FetchPrices(ctx, f, asset, currencies)
+}
+
+// FetchQuotes implements tracker.QuotingSource
+func (s coinGeckoSource) FetchQuotes(ctx context.Context, f tracker.Fetcher, asset string, currencies []string) (map[string]float64, map[string]time.Time, error) {
+	return s.source().FetchQuotes(ctx, f, asset, currencies)
+}
+
+// coinbaseSource is the tracker's Coinbase source
+type coinbaseSource struct{ tracker.Source }
+
+// binanceSource is the tracker's Binance source
+type binanceSource struct{ tracker.Source }
+
+// krakenSource is the tracker's Kraken source
+type krakenSource struct{ tracker.Source }
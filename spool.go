@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"         // Package for reading the spool line by line
+	"context"       // Package for the replay's database write
+	"encoding/json" // Package for the JSONL format
+	"errors"        // Package for recognizing read-only refusals
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for reading the last byte of the spool
+	"log/slog"      // Package for structured logging
+	"os"            // Package for environment variables and file operations
+	"strconv"       // Package for parsing SPOOL_MAX_SIZE
+	"strings"       // Package for string manipulation
+	"sync"          // Package for serializing spool writes and replays
+	"time"          // Package for queue timestamps
+)
+
+// A fetch whose prices can't be written because the database is down would otherwise
+// lose them. With SPOOL_FILE set, they are appended to that file instead, one JSON line
+// per fetch, and synced to disk. Before the next write, and when the scheduler
+// connects at startup, the spooled prices are saved with the times they were fetched
+// at and the file is removed; prices saved twice because the tracker stopped between
+// the save and the removal are skipped as duplicates. Alerts and events don't fire for
+// spooled prices.
+//
+// The file grows to SPOOL_MAX_SIZE at most; prices that don't fit are dropped and
+// logged. Lines that can't be decoded, such as one cut short by a crash, are moved to
+// SPOOL_FILE.corrupt on replay, and the rest is replayed as usual.
+
+// SpoolConfig controls the disk queue of prices the database couldn't take
+type SpoolConfig struct {
+	Path    string // JSONL file; empty disables the spool
+	MaxSize int64  // Largest size of the file in bytes
+}
+
+// spoolConfig is the active configuration, loaded at startup
+var spoolConfig = SpoolConfig{MaxSize: 10 << 20}
+
+// spoolMu serializes appends to and replays of the spool
+var spoolMu sync.Mutex
+
+// spoolEntry is one line of the spool: the records of one fetch
+type spoolEntry struct {
+	Queued  time.Time     `json:"queued"`
+	Records []PriceRecord `json:"records"`
+}
+
+// byteSizeUnits are the suffixes parseByteSize accepts, largest first
+var byteSizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}, {"b", 1}}
+
+// parseByteSize parses a size in bytes, optionally with a KB, MB, or GB suffix
+func parseByteSize(v string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(v))
+	unit := int64(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	return n * unit, nil
+}
+
+// loadSpoolConfig reads SPOOL_FILE and SPOOL_MAX_SIZE (e.g. 10MB)
+func loadSpoolConfig() (SpoolConfig, error) {
+	c := SpoolConfig{Path: os.Getenv("SPOOL_FILE"), MaxSize: 10 << 20}
+	if v := os.Getenv("SPOOL_MAX_SIZE"); v != "" {
+		n, err := parseByteSize(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid SPOOL_MAX_SIZE %q (expected a size, e.g. 10MB)", v)
+		}
+		c.MaxSize = n
+	}
+	return c, nil
+}
+
+// spoolable reports whether a failed write of prices should go to the spool: it is
+// configured, and the write failed rather than being cancelled or refused
+func spoolable(ctx context.Context, err error) bool {
+	return spoolConfig.Path != "" && ctx.Err() == nil && !errors.Is(err, errReadOnly)
+}
+
+// spoolPrices appends the records of one fetch to the spool and syncs it to disk
+func spoolPrices(records []PriceRecord) error {
+	line, err := json.Marshal(spoolEntry{Queued: time.Now().UTC(), Records: records})
+	if err != nil {
+		return fmt.Errorf("failed to encode spooled prices: %w", err)
+	}
+	line = append(line, '\n')
+
+	spoolMu.Lock()
+	defer spoolMu.Unlock()
+	f, err := os.OpenFile(spoolConfig.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open spool: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open spool: %w", err)
+	}
+	size := info.Size()
+
+	// A line cut short by a crash is ended first, so it doesn't swallow this one
+	if size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, size-1); err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read spool: %w", err)
+		}
+		if last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if size+int64(len(line)) > spoolConfig.MaxSize {
+		incCounter("tracker_spool_dropped_prices_total", nil, float64(len(records)))
+		return fmt.Errorf("spool %s is full (SPOOL_MAX_SIZE %d bytes)", spoolConfig.Path, spoolConfig.MaxSize)
+	}
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to write spool: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool: %w", err)
+	}
+	incCounter("tracker_spooled_prices_total", nil, float64(len(records)))
+	setGauge("tracker_spool_bytes", nil, float64(size+int64(len(line))))
+	return nil
+}
+
+// replaySpool saves the spooled prices and removes the spool; the spool stays as it
+// was when the save fails
+func replaySpool(ctx context.Context, repo *Repository) error {
+	if spoolConfig.Path == "" {
+		return nil
+	}
+	spoolMu.Lock()
+	defer spoolMu.Unlock()
+	f, err := os.Open(spoolConfig.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open spool: %w", err)
+	}
+	entries, corrupt, err := readSpool(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	var records []PriceRecord
+	for _, e := range entries {
+		records = append(records, e.Records...)
+	}
+	saved, err := repo.SaveHistoricalPrices(ctx, records)
+	if err != nil {
+		return fmt.Errorf("failed to replay spooled prices: %w", err)
+	}
+
+	if len(corrupt) > 0 {
+		if err := quarantineSpoolLines(corrupt); err != nil {
+			return err
+		}
+		incCounter("tracker_spool_corrupt_lines_total", nil, float64(len(corrupt)))
+		slog.Warn("Moved unreadable lines out of the spool", "lines", len(corrupt), "file", spoolConfig.Path+".corrupt")
+	}
+	if err := os.Remove(spoolConfig.Path); err != nil {
+		return fmt.Errorf("failed to remove replayed spool: %w", err)
+	}
+	setGauge("tracker_spool_bytes", nil, 0)
+	if len(entries) > 0 {
+		incCounter("tracker_spool_replayed_prices_total", nil, float64(saved))
+		slog.Info("Replayed spooled prices", "coin", "bitcoin", "fetches", len(entries), "prices", saved,
+			"since", entries[0].Queued.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// readSpool decodes the lines of a spool, returning the lines it couldn't decode apart
+func readSpool(r io.Reader) ([]spoolEntry, [][]byte, error) {
+	var entries []spoolEntry
+	var corrupt [][]byte
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 && strings.TrimSpace(string(line)) != "" {
+			var e spoolEntry
+			if json.Unmarshal(line, &e) != nil || len(e.Records) == 0 {
+				corrupt = append(corrupt, line)
+			} else {
+				entries = append(entries, e)
+			}
+		}
+		if err == io.EOF {
+			return entries, corrupt, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read spool: %w", err)
+		}
+	}
+}
+
+// quarantineSpoolLines appends lines that couldn't be decoded to SPOOL_FILE.corrupt
+func quarantineSpoolLines(lines [][]byte) error {
+	f, err := os.OpenFile(spoolConfig.Path+".corrupt", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open spool quarantine: %w", err)
+	}
+	defer f.Close()
+	for _, line := range lines {
+		if line[len(line)-1] != '\n' {
+			line = append(line, '\n')
+		}
+		if _, err := f.Write(line); err != nil {
+			return fmt.Errorf("failed to write spool quarantine: %w", err)
+		}
+	}
+	return nil
+}
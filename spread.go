@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"  // Package for fetching within the fetch deadline
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"math"     // Package for rounding spreads
+	"net/http" // Package for the spread endpoint
+	"os"       // Package for environment variables
+	"slices"   // Package for ordering exchanges
+	"strconv"  // Package for parsing SPREAD_ALERT
+	"strings"  // Package for parsing EXCHANGES
+	"sync"     // Package for fetching every exchange at once
+	"time"     // Package for spread windows
+
+	"bitcoin-tracker/tracker" // Sources and price validation
+)
+
+// EventSpreadWide is emitted when the spread between exchanges reaches SPREAD_ALERT
+const EventSpreadWide = "spread.wide"
+
+// ExchangeConfig lists the exchanges whose prices are compared on every fetch
+type ExchangeConfig struct {
+	Exchanges []PriceSource // Providers fetched side by side; empty disables the comparison
+	AlertPct  float64       // Spread in percent that publishes EventSpreadWide; 0 never does
+}
+
+// exchangeConfig is the active configuration, loaded at startup
+var exchangeConfig ExchangeConfig
+
+// enabled reports whether exchange prices are fetched
+func (c ExchangeConfig) enabled() bool {
+	return len(c.Exchanges) > 0
+}
+
+// loadExchangeConfig reads EXCHANGES, e.g. "coinbase,binance,kraken", and SPREAD_ALERT
+// (percent); a spread needs at least two exchanges
+func loadExchangeConfig() (ExchangeConfig, error) {
+	var c ExchangeConfig
+	for _, name := range strings.Split(os.Getenv("EXCHANGES"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		source, ok := availableSources[name]
+		if !ok {
+			return c, fmt.Errorf("unknown exchange %q in EXCHANGES", name)
+		}
+		if slices.Contains(c.Exchanges, source) {
+			return c, fmt.Errorf("exchange %q is listed twice in EXCHANGES", name)
+		}
+		c.Exchanges = append(c.Exchanges, source)
+	}
+	if len(c.Exchanges) == 1 {
+		return c, fmt.Errorf("EXCHANGES needs at least two exchanges to compare")
+	}
+	if v := os.Getenv("SPREAD_ALERT"); v != "" {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		if err != nil || pct < 0 {
+			return c, fmt.Errorf("invalid SPREAD_ALERT %q (expected a percentage, e.g. 0.5)", v)
+		}
+		c.AlertPct = pct
+	}
+	return c, nil
+}
+
+// ExchangePrice is the price one exchange quoted in one fetch
+type ExchangePrice struct {
+	Exchange  string    `json:"exchange"`
+	Currency  string    `json:"currency"`
+	Price     float64   `json:"price"`
+	Timestamp time.Time `json:"timestamp"` // Shared by every exchange fetched in the same tick
+}
+
+// Spread compares the prices of one currency on every exchange at one time
+type Spread struct {
+	Currency  string             `json:"currency"`
+	Timestamp time.Time          `json:"timestamp"`
+	Prices    map[string]float64 `json:"prices"`        // Price on each exchange
+	Low       string             `json:"low_exchange"`  // Cheapest exchange, where buying is best
+	High      string             `json:"high_exchange"` // Dearest exchange, where selling is best
+	Spread    float64            `json:"spread"`        // High price minus low price
+	SpreadPct float64            `json:"spread_pct"`    // Spread as a percentage of the low price
+}
+
+// newSpread computes the spread of prices quoted at the same time
+// With fewer than two prices the spread is zero.
+func newSpread(currency string, at time.Time, prices map[string]float64) Spread {
+	s := Spread{Currency: currency, Timestamp: at, Prices: prices}
+	for exchange, price := range prices {
+		// Break ties by name so the same prices always name the same exchanges
+		if s.Low == "" || price < prices[s.Low] || (price == prices[s.Low] && exchange < s.Low) {
+			s.Low = exchange
+		}
+		if s.High == "" || price > prices[s.High] || (price == prices[s.High] && exchange < s.High) {
+			s.High = exchange
+		}
+	}
+	if len(prices) < 2 || prices[s.Low] <= 0 {
+		return s
+	}
+	s.Spread = roundPrice(prices[s.High] - prices[s.Low])
+	s.SpreadPct = math.Round(s.Spread/prices[s.Low]*100*10000) / 10000
+	return s
+}
+
+// spreadsOf groups exchange prices, ordered by time, into one spread per tick
+func spreadsOf(currency string, prices []ExchangePrice) []Spread {
+	var spreads []Spread
+	for i := 0; i < len(prices); {
+		at := prices[i].Timestamp
+		tick := make(map[string]float64)
+		for ; i < len(prices) && prices[i].Timestamp.Equal(at); i++ {
+			tick[prices[i].Exchange] = prices[i].Price
+		}
+		spreads = append(spreads, newSpread(currency, at, tick))
+	}
+	return spreads
+}
+
+// recordExchangePrices fetches every tracked currency from each exchange of EXCHANGES
+// at once and stores what each returned under one timestamp. An exchange that fails
+// is logged and left out of this tick's spread; nothing here fails the fetch itself.
+func recordExchangePrices(ctx context.Context, repo *Repository) {
+	if !exchangeConfig.enabled() {
+		return
+	}
+
+	quotes := make([]map[string]float64, len(exchangeConfig.Exchanges))
+	var wg sync.WaitGroup
+	for i, exchange := range exchangeConfig.Exchanges {
+		wg.Add(1)
+		go func(i int, exchange PriceSource) {
+			defer wg.Done()
+			// A panic on a bad response only fails this exchange's fetch
+			err := runRecovered("exchange "+exchange.Name(), func() error {
+				got, err := exchange.FetchPrices(ctx, providerFetcher{repo: repo}, "bitcoin", currencies)
+				quotes[i] = got // Whatever a partial failure still priced
+				return err
+			})
+			if err != nil {
+				slog.Warn("Exchange price fetch failed", "exchange", exchange.Name(), "coin", "bitcoin", "error", err)
+				incCounter("tracker_exchange_fetch_failures_total", map[string]string{"exchange": exchange.Name()}, 1)
+			}
+		}(i, exchange)
+	}
+	wg.Wait()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var records []ExchangePrice
+	for i, exchange := range exchangeConfig.Exchanges {
+		for _, currency := range currencies {
+			if price, ok := quotes[i][currency]; ok && tracker.ValidatePrice(currency, price) == nil {
+				records = append(records, ExchangePrice{Exchange: exchange.Name(), Currency: currency, Price: price, Timestamp: now})
+			}
+		}
+	}
+	if len(records) == 0 {
+		return
+	}
+	if err := repo.SaveExchangePrices(ctx, records); err != nil {
+		slog.Error("Failed to save exchange prices", "error", err)
+		return
+	}
+
+	for _, currency := range currencies {
+		var tick []ExchangePrice
+		for _, r := range records {
+			if r.Currency == currency {
+				tick = append(tick, r)
+			}
+		}
+		if len(tick) < 2 {
+			continue
+		}
+		s := spreadsOf(currency, tick)[0]
+		slog.Info("Exchange spread", "coin", "bitcoin", "currency", currency, "spread", s.Spread, "spread_pct", s.SpreadPct,
+			"low", s.Low, "high", s.High)
+		setGauge("tracker_exchange_spread_percent", map[string]string{"currency": currency}, s.SpreadPct)
+		if exchangeConfig.AlertPct > 0 && s.SpreadPct >= exchangeConfig.AlertPct {
+			publishEvent(repo, newEvent(EventSpreadWide, "bitcoin/"+currency, s))
+		}
+	}
+}
+
+// SpreadReport is the current spread of a currency and its history over a window
+type SpreadReport struct {
+	Currency string   `json:"currency"`
+	Window   string   `json:"window"`
+	Current  *Spread  `json:"current"`         // Newest tick, even when it is older than the window
+	Samples  int      `json:"samples"`         // Ticks in the window with at least two exchanges
+	MeanPct  float64  `json:"mean_spread_pct"` // Mean spread of those ticks
+	MaxPct   float64  `json:"max_spread_pct"`  // Widest spread of those ticks
+	Widest   *Spread  `json:"widest"`          // The tick with the widest spread
+	History  []Spread `json:"history"`         // Every tick in the window, oldest first
+}
+
+// spreadReport builds the spread report of currency for the window ending now
+func spreadReport(repo *Repository, currency, window string) (SpreadReport, error) {
+	d, err := parseStatsWindow(window)
+	if err != nil {
+		return SpreadReport{}, err
+	}
+	report := SpreadReport{Currency: currency, Window: window, History: []Spread{}}
+
+	latest, err := repo.LatestExchangePrices(currency)
+	if err != nil {
+		return report, err
+	}
+	if len(latest) > 0 {
+		current := spreadsOf(currency, latest)[0]
+		report.Current = &current
+	}
+
+	now := time.Now()
+	prices, err := repo.ExchangePrices(currency, now.Add(-d), now, maxRangeLimit)
+	if err != nil {
+		return report, err
+	}
+	var total float64
+	for _, s := range spreadsOf(currency, prices) {
+		report.History = append(report.History, s)
+		if len(s.Prices) < 2 {
+			continue
+		}
+		report.Samples++
+		total += s.SpreadPct
+		if report.Widest == nil || s.SpreadPct > report.Widest.SpreadPct {
+			widest := s
+			report.Widest = &widest
+		}
+	}
+	if report.Samples > 0 {
+		report.MeanPct = math.Round(total/float64(report.Samples)*10000) / 10000
+		report.MaxPct = report.Widest.SpreadPct
+	}
+	return report, nil
+}
+
+// handleSpread serves GET /spread?currency=usd&window=24h
+func (s *apiServer) handleSpread(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "24h"
+	}
+	if _, err := parseStatsWindow(window); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	report, err := spreadReport(s.repo, requestCurrency(r), window)
+	if err != nil {
+		slog.Error("API failed to compute exchange spread", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to compute exchange spread")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// runSpreadCommand handles "spread [currency] [--window 24h]"
+func runSpreadCommand(repo *Repository, args []string) error {
+	currency := currencies[0]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		currency, args = strings.ToLower(args[0]), args[1:]
+	}
+
+	fs := newFlagSet("spread")
+	window := fs.String("window", "24h", "History window ending now, e.g. 24h, 7d, or 30d")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+
+	report, err := spreadReport(repo, currency, *window)
+	if err != nil {
+		return err
+	}
+	if report.Current == nil {
+		if !exchangeConfig.enabled() {
+			return fmt.Errorf("no exchange prices recorded; set EXCHANGES, e.g. EXCHANGES=coinbase,binance,kraken")
+		}
+		slog.Info("No exchange prices recorded yet", "currency", currency)
+		return nil
+	}
+
+	c := report.Current
+	fmt.Printf("\nBTC/%s across exchanges (%s)\n", strings.ToUpper(currency), c.Timestamp.In(displayLocation).Format("2006-01-02 15:04:05"))
+	fmt.Printf("%-12s %-14s %-10s\n", "Exchange", "Price", "vs Low")
+	fmt.Println("--------------------------------------")
+	exchanges := make([]string, 0, len(c.Prices))
+	for exchange := range c.Prices {
+		exchanges = append(exchanges, exchange)
+	}
+	slices.SortFunc(exchanges, func(a, b string) int {
+		if c.Prices[a] != c.Prices[b] {
+			return int(math.Copysign(1, c.Prices[a]-c.Prices[b]))
+		}
+		return strings.Compare(a, b)
+	})
+	for _, exchange := range exchanges {
+		fmt.Printf("%-12s %-14.2f %+9.3f%%\n", exchange, c.Prices[exchange], (c.Prices[exchange]-c.Prices[c.Low])/c.Prices[c.Low]*100)
+	}
+	fmt.Printf("\nSpread: %.2f %s (%.3f%%), buy on %s, sell on %s\n", c.Spread, strings.ToUpper(currency), c.SpreadPct, c.Low, c.High)
+
+	if report.Samples == 0 {
+		fmt.Printf("No spreads recorded in the last %s\n\n", report.Window)
+		return nil
+	}
+	fmt.Printf("Last %s: %d samples, mean %.3f%%, widest %.3f%% at %s (%s to %s)\n\n", report.Window, report.Samples,
+		report.MeanPct, report.MaxPct, report.Widest.Timestamp.In(displayLocation).Format("2006-01-02 15:04"), report.Widest.Low, report.Widest.High)
+	return nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"       // Package for stopping the feed with the server
+	"encoding/json" // Package for event data
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for the stream endpoint
+	"strconv"       // Package for parsing Last-Event-ID
+	"sync"          // Package for guarding subscribers
+	"time"          // Package for polling and keep-alives
+)
+
+// Live price stream settings
+const (
+	priceFeedPoll    = 5 * time.Second  // How often the database is checked for samples saved by other processes
+	priceFeedMaxAge  = 10 * time.Minute // New rows older than this (e.g. from a backfill) are history, not live samples
+	sseKeepAlive     = 15 * time.Second // Idle streams get a comment this often so proxies keep them open
+	sseRetry         = 5 * time.Second  // Reconnect delay suggested to clients
+	sseReplayLimit   = 1000             // Most samples replayed to a client resuming with Last-Event-ID
+	sseClientBacklog = 64               // Samples buffered per client before it is dropped as too slow
+)
+
+// priceFeed fans newly stored samples out to the clients of GET /prices/stream
+// Samples are read back from the database by ID, so prices saved by another process
+// (a scheduler next to `serve`) are streamed as well; saves in this process wake the
+// feed immediately instead of waiting for the next poll.
+type priceFeed struct {
+	mu     sync.Mutex
+	subs   map[chan PriceRecord]struct{}
+	closed bool               // The feed stopped; new subscribers get a closed channel
+	wake   chan struct{}      // Signalled by notifyPriceFeed
+	users  int                // Servers that started the feed and haven't stopped it
+	cancel context.CancelFunc // Stops run once the last user is done
+}
+
+// livePrices is the process-wide feed, run by the API and gRPC servers
+var livePrices = &priceFeed{
+	subs: make(map[chan PriceRecord]struct{}),
+	wake: make(chan struct{}, 1),
+}
+
+// notifyPriceFeed tells the feed that new samples were saved
+func notifyPriceFeed() {
+	select {
+	case livePrices.wake <- struct{}{}:
+	default: // A wake-up is already pending
+	}
+}
+
+// subscribe registers a client; the channel is closed when the feed stops or the client falls behind
+func (f *priceFeed) subscribe() chan PriceRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan PriceRecord, sseClientBacklog)
+	if f.closed {
+		close(ch)
+		return ch
+	}
+	f.subs[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe removes a client that disconnected
+func (f *priceFeed) unsubscribe(ch chan PriceRecord) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.subs[ch]; ok {
+		delete(f.subs, ch)
+		close(ch)
+	}
+}
+
+// broadcast sends a sample to every client
+// A client whose buffer is full is disconnected rather than blocking the others; it
+// resumes from its Last-Event-ID when it reconnects.
+func (f *priceFeed) broadcast(p PriceRecord) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs {
+		select {
+		case ch <- p:
+		default:
+			slog.Warn("Dropping slow price stream client")
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// start runs the feed until the returned function is called
+// The API and gRPC servers each start it, and it keeps running while either needs it
+func (f *priceFeed) start(repo *Repository) func() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.users == 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		f.cancel = cancel
+		go f.run(ctx, repo)
+	}
+	f.users++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.users--; f.users == 0 {
+				f.cancel()
+			}
+		})
+	}
+}
+
+// run polls for new samples until ctx is cancelled, then disconnects every client
+func (f *priceFeed) run(ctx context.Context, repo *Repository) {
+	f.mu.Lock()
+	f.closed = false
+	f.mu.Unlock()
+
+	lastID := 0
+	if latest, err := repo.LatestPrices(ctx, 1, ""); err != nil {
+		slog.Error("Failed to load the newest price for the price stream", "error", err)
+	} else if len(latest) > 0 {
+		lastID = latest[0].ID
+	}
+
+	ticker := time.NewTicker(priceFeedPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			f.mu.Lock()
+			for ch := range f.subs {
+				delete(f.subs, ch)
+				close(ch)
+			}
+			f.closed = true
+			f.mu.Unlock()
+			return
+		case <-ticker.C:
+		case <-f.wake:
+		}
+
+		// Keep reading until caught up, in case more than one page was saved
+		for {
+			prices, err := repo.PricesAfter("", lastID, sseReplayLimit)
+			if err != nil {
+				slog.Error("Failed to poll new prices for the price stream", "error", err)
+				break
+			}
+			if len(prices) > 0 {
+				// Another process may have saved them, bypassing this process's cache
+				invalidatePriceCache(repo)
+			}
+			for _, p := range prices {
+				lastID = p.ID
+				// Backfilled history gets new IDs too, but it is not a new sample
+				if time.Since(p.Timestamp) <= priceFeedMaxAge {
+					f.broadcast(p)
+				}
+			}
+			if len(prices) < sseReplayLimit {
+				break
+			}
+		}
+	}
+}
+
+// writeSSE writes one price as a Server-Sent Event with precision decimal places and
+// flushes it to the client
+func writeSSE(w http.ResponseWriter, p PriceRecord, precision int) error {
+	data, err := json.Marshal(priceWithPrecision(p, precision))
+	if err != nil {
+		return fmt.Errorf("failed to encode price: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: price\ndata: %s\n\n", p.ID, data); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+// handlePriceStream serves GET /prices/stream?currency=usd&precision=N as Server-Sent Events
+// The newest price is sent first, then every new sample as it is stored. Clients
+// reconnecting with a Last-Event-ID header get the samples they missed instead.
+func (s *apiServer) handlePriceStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		writeAPIError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	precision, err := requestPrecision(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	// Subscribe before reading the backlog so no sample falls between the two
+	currency := requestCurrency(r)
+	updates := livePrices.subscribe()
+	defer livePrices.unsubscribe(updates)
+
+	var backlog []PriceRecord
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastID, convErr := strconv.Atoi(v)
+		if convErr != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid Last-Event-ID %q", v)
+			return
+		}
+		backlog, err = s.repo.PricesAfter(currency, lastID, sseReplayLimit)
+	} else {
+		backlog, err = s.repo.LatestPrices(r.Context(), 1, currency)
+	}
+	if err != nil {
+		slog.Error("API failed to start price stream", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query prices")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+	w.(http.Flusher).Flush()
+
+	sentID := 0
+	send := func(p PriceRecord) error {
+		if p.ID <= sentID || p.Currency != currency {
+			return nil
+		}
+		sentID = p.ID
+		return writeSSE(w, p, precision)
+	}
+	for _, p := range backlog {
+		if err := send(p); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case p, ok := <-updates:
+			if !ok {
+				return // Server shutting down, or the client fell behind
+			}
+			if err := send(p); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"  // Package for the price queries
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"strconv"  // Package for parsing STALE_ALERT_INTERVALS
+	"time"     // Package for price ages
+)
+
+// The scheduler watches its own output: when no price of a currency has been stored for
+// more than STALE_ALERT_INTERVALS fetch intervals, a stale alert goes out through the
+// notifiers, and a second one follows when prices arrive again. The check runs apart
+// from the job loop, so it also notices a loop that is stuck rather than failing. It is
+// skipped while the scheduler is paused or waiting as a standby.
+
+// AlertStale alerts fire when prices stop being stored, and when they are stored again
+// They come from the scheduler's staleness check rather than from stored rules.
+const AlertStale = "stale"
+
+// staleAlertIntervals is how many fetch intervals may pass without a stored price before
+// the stale alert fires; 0 disables it. Configured via STALE_ALERT_INTERVALS
+var staleAlertIntervals = 3
+
+// staleCheckEvery is how often the scheduler checks for stale prices
+const staleCheckEvery = time.Minute
+
+// loadStaleAlertIntervals reads STALE_ALERT_INTERVALS (e.g. 3; 0 disables stale alerts)
+func loadStaleAlertIntervals() (int, error) {
+	v := os.Getenv("STALE_ALERT_INTERVALS")
+	if v == "" {
+		return 3, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 3, fmt.Errorf("invalid STALE_ALERT_INTERVALS %q (expected a number of fetch intervals, 0 to disable)", v)
+	}
+	return n, nil
+}
+
+// staleWatch remembers since when each stale currency has had no new price, so each
+// outage alerts once
+type staleWatch struct {
+	repo  *Repository
+	since map[string]time.Time
+}
+
+// runStaleWatch checks the prices stored in repo every staleCheckEvery until ctx is
+// cancelled
+func runStaleWatch(ctx context.Context, repo *Repository) {
+	ticker := time.NewTicker(staleCheckEvery)
+	defer ticker.Stop()
+
+	w := &staleWatch{repo: repo, since: make(map[string]time.Time)}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(ctx, time.Now())
+		}
+	}
+}
+
+// check compares the newest price of every configured currency with the stale limit,
+// firing a stale alert when one crosses it and a recovery alert when one comes back
+func (w *staleWatch) check(ctx context.Context, now time.Time) {
+	if staleAlertIntervals == 0 || daemon.isPaused() || daemon.isStandby() {
+		return
+	}
+	daemon.mu.Lock()
+	interval, startedAt := max(daemon.interval, fetchInterval), daemon.startedAt
+	daemon.mu.Unlock()
+	limit := time.Duration(staleAlertIntervals) * interval
+
+	ctx, cancel := withDBTimeout(ctx)
+	defer cancel()
+	for _, currency := range currencies {
+		latest, err := w.repo.LatestPrices(ctx, 1, currency)
+		if err != nil {
+			slog.Error("Failed to read the newest price for the staleness check", "currency", currency, "error", err)
+			continue
+		}
+
+		// Without any stored price, the scheduler gets the limit from its start
+		var price float64
+		newest := startedAt
+		if len(latest) > 0 {
+			price, newest = latest[0].Price, latest[0].Timestamp
+		}
+		age := now.Sub(newest)
+		setGauge("tracker_price_age_seconds", map[string]string{"currency": currency}, age.Seconds())
+
+		since, wasStale := w.since[currency]
+		switch {
+		case age > limit && !wasStale:
+			slog.Error("No price stored for longer than the stale limit", "currency", currency,
+				"newest", newest.Format(time.RFC3339), "limit", limit)
+			w.since[currency] = newest
+		case age <= limit && wasStale:
+			// The recovery alert tells how long the gap between the two prices was
+			age = newest.Sub(since)
+			slog.Info("Prices are being stored again", "currency", currency, "price", price, "gap", age.Round(time.Second))
+			delete(w.since, currency)
+		default:
+			continue
+		}
+		fireAlert(w.repo, Alert{
+			Rule:  AlertRule{Kind: AlertStale, Threshold: float64(staleAlertIntervals), Window: limit, Currency: currency},
+			Price: price,
+			Age:   age,
+			Time:  now.UTC(),
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"  // Package for database call contexts
+	"fmt"      // Package for formatted errors
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables and the host name
+	"strconv"  // Package for parsing STANDBY and STANDBY_MISSED_HEARTBEATS
+	"time"     // Package for heartbeat intervals
+)
+
+// A warm standby is a second scheduler on the same database that serves the API, the
+// control socket, and health checks like the primary but runs none of the jobs. The
+// primary records a heartbeat in the database every HEARTBEAT_INTERVAL; once it has
+// missed STANDBY_MISSED_HEARTBEATS of them, the standby promotes itself and starts
+// fetching. Heartbeats are aged by the database clock, so clock skew between the two
+// hosts doesn't matter.
+//
+// With LEADER_ELECTION, identically configured replicas elect the primary themselves:
+// the heartbeat row becomes a lease that only its holder may renew and any instance
+// may take once it has expired, claimed in a single conditional upsert so that two
+// instances can never both hold it. A primary that fails to renew its lease steps down
+// before running another job.
+
+// EventStandbyPromoted is emitted when a standby takes over from a silent primary
+const EventStandbyPromoted = "standby.promoted"
+
+// StandbyConfig controls the scheduler's heartbeat and the warm standby
+type StandbyConfig struct {
+	Enabled   bool          // Start as a standby instead of running the jobs
+	Instance  string        // Name of this instance in the heartbeat
+	Heartbeat time.Duration // How often the primary records its heartbeat
+	Missed    int           // Heartbeats missed in a row after which a standby takes over
+	Election  bool          // Elect the primary through a lease instead of by configuration
+}
+
+// standbyConfig is the active configuration, loaded at startup
+var standbyConfig = StandbyConfig{Heartbeat: 30 * time.Second, Missed: 3}
+
+// standbyFlag holds the scheduler's --standby flag, which takes precedence over STANDBY
+var standbyFlag bool
+
+// loadStandbyConfig reads STANDBY, INSTANCE_NAME, HEARTBEAT_INTERVAL (e.g. 30s),
+// STANDBY_MISSED_HEARTBEATS, and LEADER_ELECTION; the instance name defaults to the
+// host name and process ID
+func loadStandbyConfig() (StandbyConfig, error) {
+	c := StandbyConfig{Enabled: standbyFlag, Heartbeat: 30 * time.Second, Missed: 3}
+	if v := os.Getenv("STANDBY"); v != "" && !c.Enabled {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid STANDBY %q", v)
+		}
+		c.Enabled = b
+	}
+
+	c.Instance = os.Getenv("INSTANCE_NAME")
+	if c.Instance == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "localhost"
+		}
+		c.Instance = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+
+	if v := os.Getenv("HEARTBEAT_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			return c, fmt.Errorf("invalid HEARTBEAT_INTERVAL %q (expected a duration of at least 1s, e.g. 30s)", v)
+		}
+		c.Heartbeat = d
+	}
+	if v := os.Getenv("STANDBY_MISSED_HEARTBEATS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c, fmt.Errorf("invalid STANDBY_MISSED_HEARTBEATS %q (expected a positive number)", v)
+		}
+		c.Missed = n
+	}
+	if v := os.Getenv("LEADER_ELECTION"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid LEADER_ELECTION %q", v)
+		}
+		c.Election = b
+	}
+	return c, nil
+}
+
+// Heartbeat is the primary's newest heartbeat
+type Heartbeat struct {
+	Instance string        // INSTANCE_NAME of the instance that beat
+	Interval time.Duration // Its HEARTBEAT_INTERVAL
+	BeatAt   time.Time     // When it beat
+	Age      time.Duration // Time since it beat, by the database clock
+}
+
+// StandbyStatus describes what a standby knows about the primary
+type StandbyStatus struct {
+	Primary    string    `json:"primary,omitempty"`   // Instance that last beat; empty when none has
+	LastBeat   time.Time `json:"last_beat,omitempty"` // When it last beat
+	TakeoverAt time.Time `json:"takeover_at"`         // When the standby takes over unless the primary beats again
+}
+
+// PromotionEventData is the payload of standby.promoted events
+type PromotionEventData struct {
+	Instance string    `json:"instance"`            // The standby that took over
+	Primary  string    `json:"primary,omitempty"`   // The primary that went silent; empty when none ever beat
+	LastBeat time.Time `json:"last_beat,omitempty"` // When the primary last beat
+	Missed   int       `json:"missed"`              // Heartbeats it missed
+}
+
+// heartbeats records this instance's heartbeat as the primary, or watches the primary's
+// as a standby; it runs on the scheduler goroutine
+type heartbeats struct {
+	repo     *Repository // Where the heartbeats and the leader lease are kept
+	ticker   *time.Ticker
+	interval time.Duration
+	election bool      // The primary holds a lease, as LEADER_ELECTION was set at startup
+	standby  bool      // Waiting for the primary to go silent
+	promoted bool      // Took over from a silent primary; steps back down when it beats again
+	beating  bool      // Recorded a heartbeat since it last stepped down, so any other instance in it beat since
+	since    time.Time // When the standby started waiting, standing in for a primary that never beat
+}
+
+// newHeartbeats starts the heartbeat of a scheduler in repo, as a standby when STANDBY
+// is set. With LEADER_ELECTION, the first beat decides whether it leads.
+func newHeartbeats(repo *Repository, c StandbyConfig) *heartbeats {
+	h := &heartbeats{repo: repo, ticker: time.NewTicker(c.Heartbeat), interval: c.Heartbeat, election: c.Election}
+	if c.Election {
+		slog.Info("Electing the primary through the heartbeat lease", "instance", c.Instance, "missed_heartbeats", c.Missed)
+	}
+	if c.Enabled {
+		slog.Info("Starting as a standby", "instance", c.Instance, "missed_heartbeats", c.Missed)
+		h.stepDown(time.Now())
+	} else {
+		setGauge("tracker_standby", nil, 0)
+	}
+	return h
+}
+
+// C returns the channel that receives when the next heartbeat is due
+func (h *heartbeats) C() <-chan time.Time { return h.ticker.C }
+
+// Stop stops the ticker; an elected primary gives up its lease, so a standby takes
+// over on its next heartbeat instead of waiting for the lease to expire
+func (h *heartbeats) Stop() {
+	h.ticker.Stop()
+	if h.election && !h.standby && h.beating {
+		if err := h.repo.ReleaseLeaderLease(context.Background(), standbyConfig.Instance); err != nil {
+			slog.Warn("Failed to release the leader lease", "error", err)
+		}
+	}
+}
+
+// reset applies a HEARTBEAT_INTERVAL changed by a reload
+func (h *heartbeats) reset() {
+	if standbyConfig.Heartbeat != h.interval {
+		h.interval = standbyConfig.Heartbeat
+		h.ticker.Reset(h.interval)
+	}
+}
+
+// stepDown makes this instance a standby that waits from now on
+func (h *heartbeats) stepDown(now time.Time) {
+	h.standby, h.promoted, h.beating, h.since = true, false, false, now
+	daemon.setStandby(&StandbyStatus{TakeoverAt: now.Add(time.Duration(standbyConfig.Missed) * h.interval)})
+	daemon.setSchedulerState("standby")
+	setGauge("tracker_standby", nil, 1)
+}
+
+// beat runs on every tick: the primary records its heartbeat, and a standby checks the
+// primary's. It returns true when the standby just took over, so the scheduler can
+// start fetching right away.
+func (h *heartbeats) beat(ctx context.Context) bool {
+	if h.election {
+		return h.elect(ctx)
+	}
+	hb, ok, err := h.repo.PrimaryHeartbeat(ctx)
+	if err != nil {
+		// A standby that can't read the database couldn't fetch into it either
+		slog.Warn("Failed to read the primary's heartbeat", "error", err)
+		if h.standby {
+			return false
+		}
+	}
+	now := time.Now()
+
+	if !h.standby {
+		// Another instance beat since this one last did, or recently before it first did
+		if ok && hb.Instance != standbyConfig.Instance && (h.beating || hb.Age < time.Duration(standbyConfig.Missed)*hb.Interval) {
+			if h.promoted {
+				slog.Warn("Primary is beating again, returning to standby", "primary", hb.Instance)
+				h.stepDown(now)
+				return false
+			}
+			slog.Warn("Another instance is running the jobs on this database", "instance", hb.Instance)
+		}
+		if err := h.repo.RecordHeartbeat(ctx, standbyConfig.Instance, h.interval); err != nil {
+			slog.Warn("Failed to record heartbeat", "error", err)
+			return false
+		}
+		h.beating = true
+		return false
+	}
+
+	// Without any heartbeat the primary has been silent since the standby started
+	interval, silence := h.interval, now.Sub(h.since)
+	status := &StandbyStatus{}
+	if ok {
+		interval, silence = hb.Interval, hb.Age
+		status.Primary, status.LastBeat = hb.Instance, hb.BeatAt
+	}
+	limit := time.Duration(standbyConfig.Missed) * interval
+	if silence < limit {
+		status.TakeoverAt = now.Add(limit - silence)
+		daemon.setStandby(status)
+		return false
+	}
+
+	missed := int(silence / interval)
+	slog.Warn("Primary missed its heartbeats, taking over", "primary", status.Primary, "missed", missed, "instance", standbyConfig.Instance)
+
+	// Claim the heartbeat at once, so the old primary warns about two instances running
+	// the jobs if it comes back
+	if err := h.repo.RecordHeartbeat(ctx, standbyConfig.Instance, h.interval); err != nil {
+		slog.Warn("Failed to record heartbeat", "error", err)
+	} else {
+		h.beating = true
+	}
+	h.promote(now, status, missed)
+	return true
+}
+
+// promote makes this standby the primary and announces it
+func (h *heartbeats) promote(now time.Time, status *StandbyStatus, missed int) {
+	h.standby, h.promoted = false, true
+	daemon.markPromoted(now)
+	daemon.setSchedulerState("idle")
+	setGauge("tracker_standby", nil, 0)
+	incCounter("tracker_standby_promotions_total", nil, 1)
+	publishEvent(h.repo, newEvent(EventStandbyPromoted, "scheduler/"+standbyConfig.Instance, PromotionEventData{
+		Instance: standbyConfig.Instance,
+		Primary:  status.Primary,
+		LastBeat: status.LastBeat,
+		Missed:   missed,
+	}))
+}
+
+// elect is the beat of LEADER_ELECTION: the primary renews its lease and steps down
+// when another instance holds it, and a standby takes the lease once it has expired.
+// It returns true when the standby just took over.
+func (h *heartbeats) elect(ctx context.Context) bool {
+	held, err := h.repo.AcquireLeaderLease(ctx, standbyConfig.Instance, h.interval, standbyConfig.Missed)
+	if err != nil {
+		// Without the database neither instance can fetch into it; the lease decides
+		// once it is back
+		slog.Warn("Failed to renew the leader lease", "error", err)
+		return false
+	}
+	now := time.Now()
+
+	if !h.standby {
+		if held {
+			h.beating = true
+			return false
+		}
+		if h.beating {
+			slog.Warn("Lost the leader lease, returning to standby", "instance", standbyConfig.Instance)
+		} else {
+			slog.Info("Another instance holds the leader lease, starting as a standby", "instance", standbyConfig.Instance)
+		}
+		h.stepDown(now)
+		h.watch(ctx, now)
+		return false
+	}
+
+	if !held {
+		h.watch(ctx, now)
+		return false
+	}
+	status, missed := &StandbyStatus{}, 0
+	if s := daemon.standbyStatus(); s != nil {
+		status = s
+		if !status.LastBeat.IsZero() {
+			missed = int(now.Sub(status.LastBeat) / h.interval)
+		}
+	}
+	slog.Warn("Took over the leader lease", "primary", status.Primary, "instance", standbyConfig.Instance)
+	h.beating = true
+	h.promote(now, status, missed)
+	return true
+}
+
+// watch records, for status, which instance holds the leader lease and when it expires
+func (h *heartbeats) watch(ctx context.Context, now time.Time) {
+	hb, ok, err := h.repo.PrimaryHeartbeat(ctx)
+	if err != nil || !ok {
+		return
+	}
+	daemon.setStandby(&StandbyStatus{
+		Primary:    hb.Instance,
+		LastBeat:   hb.BeatAt,
+		TakeoverAt: now.Add(time.Duration(standbyConfig.Missed)*hb.Interval - hb.Age),
+	})
+}
+
+// confirm renews the lease of an elected primary before it runs a job, so one that was
+// stalled past its lease steps down instead of fetching alongside the new primary
+func (h *heartbeats) confirm(ctx context.Context) {
+	if h.election && !h.standby {
+		h.elect(ctx)
+	}
+}
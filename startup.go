@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"  // Package for cancelling the retries and the fetches
+	"errors"   // Package for reporting a cancelled wait
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"strconv"  // Package for parsing DB_STARTUP_BUFFER
+	"time"     // Package for the retry backoff
+)
+
+// The database isn't always up when the tracker starts, e.g. when docker-compose starts
+// both at once. With DB_STARTUP_TIMEOUT, commands that need the database keep trying to
+// connect with backoff for that long instead of exiting on the first failure. While
+// the scheduler waits, it fetches prices on its interval anyway and keeps the newest
+// DB_STARTUP_BUFFER fetches in memory, or in SPOOL_FILE when set (see spool.go); they
+// are saved once the database is reachable, with the times they were fetched at.
+// Alerts and events don't fire for them.
+
+// Bounds of the delay between connection attempts, which doubles after each failure
+const (
+	dbStartupRetryMin = time.Second
+	dbStartupRetryMax = 30 * time.Second
+)
+
+// DBStartupConfig controls waiting for the database at startup
+type DBStartupConfig struct {
+	Timeout time.Duration // How long to keep trying to connect; 0 gives up after one attempt
+	Buffer  int           // Fetches kept while waiting; 0 fetches nothing until connected
+}
+
+// dbStartupConfig is the active configuration, loaded at startup
+var dbStartupConfig = DBStartupConfig{Buffer: 100}
+
+// loadDBStartupConfig reads DB_STARTUP_TIMEOUT (Go duration, e.g. 2m) and
+// DB_STARTUP_BUFFER (number of fetches)
+func loadDBStartupConfig() (DBStartupConfig, error) {
+	c := DBStartupConfig{Buffer: 100}
+	if v := os.Getenv("DB_STARTUP_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return c, fmt.Errorf("invalid DB_STARTUP_TIMEOUT %q (expected a duration, e.g. 2m, or 0)", v)
+		}
+		c.Timeout = d
+	}
+	if v := os.Getenv("DB_STARTUP_BUFFER"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return c, fmt.Errorf("invalid DB_STARTUP_BUFFER %q (expected a number of fetches, or 0)", v)
+		}
+		c.Buffer = n
+	}
+	return c, nil
+}
+
+// connectDatabase opens the database and returns its repository, retrying for up to
+// DB_STARTUP_TIMEOUT. Configuration errors aren't retried. With buffer, prices fetched
+// while waiting are saved once connected; with replicaReads, query reads go to
+// DATABASE_REPLICA_URL.
+func connectDatabase(ctx context.Context, buffer, replicaReads bool) (*Repository, error) {
+	deadline := time.Now().Add(dbStartupConfig.Timeout)
+	var pending *startupBuffer
+	delay := dbStartupRetryMin
+	for attempt := 1; ; attempt++ {
+		s, err := openDatabase(replicaReads)
+		if err == nil {
+			// The fetches stop before the repository is used, as they run without it
+			if pending != nil {
+				pending.stop()
+			}
+			repo := newRepository(s)
+			slog.Info("Database initialized successfully", "attempts", attempt)
+			if pending != nil {
+				pending.flush(ctx, repo)
+			}
+			if buffer {
+				if err := replaySpool(ctx, repo); err != nil {
+					slog.Warn("Failed to replay spooled prices", "error", err)
+				}
+			}
+			return repo, nil
+		}
+
+		wait := min(delay, time.Until(deadline))
+		if errorKind(err) == KindConfig || wait <= 0 {
+			if pending != nil {
+				pending.stop()
+				pending.drop()
+			}
+			if attempt > 1 {
+				return nil, fmt.Errorf("database still unreachable after %d attempts: %w", attempt, err)
+			}
+			return nil, err
+		}
+		slog.Warn("Database not reachable yet, retrying", "attempt", attempt, "retry_in", wait, "error", err)
+		if buffer && pending == nil && dbStartupConfig.Buffer > 0 {
+			pending = startStartupBuffer(ctx, dbStartupConfig.Buffer)
+		}
+
+		select {
+		case <-ctx.Done():
+			if pending != nil {
+				pending.stop()
+				pending.drop()
+			}
+			return nil, errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, dbStartupRetryMax)
+	}
+}
+
+// startupBuffer keeps the prices fetched while waiting for the database
+// Only its goroutine touches the fetches until stop returns.
+type startupBuffer struct {
+	limit   int // Fetches kept; older ones are dropped
+	cancel  context.CancelFunc
+	done    chan struct{}
+	fetches [][]PriceRecord
+	dropped int // Fetches dropped to stay within limit
+}
+
+// startStartupBuffer fetches prices now and then on every fetch interval, keeping the
+// newest limit fetches, until stop is called
+func startStartupBuffer(ctx context.Context, limit int) *startupBuffer {
+	ctx, cancel := context.WithCancel(ctx)
+	b := &startupBuffer{limit: limit, cancel: cancel, done: make(chan struct{})}
+	slog.Info("Fetching prices while waiting for the database", "interval", fetchInterval, "buffer", limit)
+	go func() {
+		defer close(b.done)
+		for {
+			if err := b.fetch(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("Failed to fetch price while waiting for the database", "coin", "bitcoin", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(fetchInterval):
+			}
+		}
+	}()
+	return b
+}
+
+// fetch fetches the current prices and keeps their records
+// There is no repository yet, so the calls aren't counted in the fetch budget.
+func (b *startupBuffer) fetch(ctx context.Context) error {
+	var repo *Repository
+	ctx, cancel := withFetchDeadline(ctx)
+	defer cancel()
+	resetMarketData()
+	prices, sources, quoted, err := fetchPricesWithRetry(ctx, repo, "bitcoin", fetchCurrencies(), nil)
+	if len(prices) == 0 {
+		return err
+	}
+
+	now := time.Now()
+	var records []PriceRecord
+	for source, group := range pricesBySource(prices, sources) {
+		group, rates := convertFXPrices(ctx, repo, group)
+		records = append(records, priceRecords(group, rates, quoted, source, now)...)
+	}
+	if len(records) == 0 {
+		return err
+	}
+	stampLatency(records, time.Now())
+	attachMarketData(records)
+
+	// With SPOOL_FILE the fetches wait on disk instead, so a restart doesn't lose them
+	if spoolConfig.Path != "" {
+		if serr := spoolPrices(records); serr != nil {
+			return serr
+		}
+		slog.Info("Spooled price until the database is reachable", "coin", "bitcoin", "currencies", len(records))
+		return err
+	}
+	b.fetches = append(b.fetches, records)
+	if len(b.fetches) > b.limit {
+		b.fetches = b.fetches[1:]
+		b.dropped++
+	}
+	slog.Info("Buffered price until the database is reachable", "coin", "bitcoin", "currencies", len(records), "buffered", len(b.fetches))
+	return err
+}
+
+// stop ends the fetches and waits for one in progress
+func (b *startupBuffer) stop() {
+	b.cancel()
+	<-b.done
+}
+
+// flush saves the buffered fetches with the times they were fetched at; a failure is
+// logged rather than holding up the start
+func (b *startupBuffer) flush(ctx context.Context, repo *Repository) {
+	if len(b.fetches) == 0 {
+		return
+	}
+	var records []PriceRecord
+	for _, fetch := range b.fetches {
+		records = append(records, fetch...)
+	}
+	saved, err := repo.SaveHistoricalPrices(ctx, records)
+	if err != nil {
+		slog.Error("Failed to save prices buffered while waiting for the database", "coin", "bitcoin", "fetches", len(b.fetches), "error", err)
+		return
+	}
+	slog.Info("Saved prices buffered while waiting for the database", "coin", "bitcoin", "fetches", len(b.fetches), "prices", saved, "dropped", b.dropped)
+}
+
+// drop reports the buffered fetches lost when the database never became reachable
+func (b *startupBuffer) drop() {
+	if n := len(b.fetches) + b.dropped; n > 0 {
+		slog.Warn("Discarding prices fetched while waiting for the database", "coin", "bitcoin", "fetches", n)
+	}
+}
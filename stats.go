@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"  // Package for cancelling statistics queries
+	"fmt"      // Package for formatted I/O operations
+	"net/http" // Package for the stats endpoint
+	"strconv"  // Package for parsing day windows
+	"strings"  // Package for string manipulation
+	"time"     // Package for windows
+)
+
+// statsWindows are the windows `stats` reports when no range is given
+var statsWindows = []string{"24h", "7d", "30d"}
+
+// PriceStats summarizes the prices recorded for a currency in [From, To)
+// Every figure is aggregated in SQL; the fields are zero when Samples is 0
+type PriceStats struct {
+	Currency  string    `json:"currency"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Samples   int       `json:"samples"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Mean      float64   `json:"mean"`
+	Median    float64   `json:"median"`
+	StdDev    float64   `json:"stddev"`     // Sample standard deviation; 0 with fewer than two samples
+	First     float64   `json:"first"`      // Oldest price in the window
+	Last      float64   `json:"last"`       // Newest price in the window
+	ChangePct float64   `json:"change_pct"` // Percent change from First to Last
+
+	// Summarized is whether the window's whole days were read from the daily summaries;
+	// Median and StdDev are then those of the daily averages
+	Summarized bool `json:"summarized,omitempty"`
+
+	// FearGreed is the Fear & Greed index of the window's days; nil when FEAR_GREED is
+	// off or none are stored
+	FearGreed *FearGreedStats `json:"fear_greed,omitempty"`
+
+	// AllTime is the all-time high and low of the currency, whatever the window; nil
+	// until they are seeded by the first fetch or a backfill
+	AllTime *PriceExtremes `json:"all_time,omitempty"`
+}
+
+// parseStatsWindow parses a window such as "24h", "90m", or "7d"
+// Go durations have no day unit, so a trailing "d" is handled here
+func parseStatsWindow(v string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(v)
+	}
+	if err != nil || d <= 0 {
+		return 0, validationErrorf("invalid window %q (expected e.g. 24h, 7d, or 30d)", v)
+	}
+	return d, nil
+}
+
+// computePriceStats returns the statistics for currency in [from, to)
+// Windows of DAILY_SUMMARY_MIN_RANGE or longer are read from the daily summaries.
+func computePriceStats(ctx context.Context, repo *Repository, currency string, from, to time.Time) (PriceStats, error) {
+	var stats PriceStats
+	summarized := false
+	var err error
+	if dailySummaryMinRange > 0 && to.Sub(from) >= dailySummaryMinRange {
+		stats, summarized, err = summarizedPriceStats(ctx, repo, strings.ToLower(currency), from, to)
+		if err != nil {
+			return stats, err
+		}
+	}
+	if !summarized {
+		if stats, err = repo.PriceStats(ctx, strings.ToLower(currency), from, to); err != nil {
+			return stats, err
+		}
+	}
+	stats.Currency, stats.From, stats.To = strings.ToLower(currency), from.UTC(), to.UTC()
+	stats.ChangePct = percentChange(stats.First, stats.Last)
+	if stats.FearGreed, err = fearGreedStats(ctx, repo, from, to); err != nil {
+		return stats, err
+	}
+	stats.AllTime, err = currencyExtremes(ctx, repo, stats.Currency)
+	return stats, err
+}
+
+// runStatsCommand handles "stats [currency] [--window 7d | --from ... --to ...] [--units sats,oz]"
+// Without a window or range it reports the last 24 hours, 7 days, and 30 days
+func runStatsCommand(repo *Repository, args []string) error {
+	currency := currencies[0]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		currency, args = args[0], args[1:]
+	}
+
+	fs := newFlagSet("stats")
+	window := fs.String("window", "", windowUsage)
+	fromFlag := fs.String("from", "", "Start of a custom range: YYYY-MM-DD or RFC 3339")
+	toFlag := fs.String("to", "now", "End of a custom range: now, YYYY-MM-DD, or RFC 3339")
+	unitsFlagValue := fs.String("units", "", "Also tell the newest price in these units: sats, oz (default: DERIVED_UNITS)")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	units, err := unitsFlag(*unitsFlagValue)
+	if err != nil {
+		return err
+	}
+
+	type span struct {
+		label    string
+		from, to time.Time
+	}
+	now := time.Now()
+	var spans []span
+	if *window == "" && *fromFlag == "" {
+		for _, w := range statsWindows {
+			from, _, _ := parseWindow(w, now)
+			spans = append(spans, span{w, from, now})
+		}
+	} else {
+		from, to, err := resolveWindow(*window, *fromFlag, *toFlag, "")
+		if err != nil {
+			return err
+		}
+		if to = windowEnd(to, now); !to.After(from) {
+			return validationErrorf("the range must end after it starts")
+		}
+		label := *window
+		if label == "" {
+			label = from.In(displayLocation).Format("2006-01-02") + ".." + to.In(displayLocation).Format("2006-01-02")
+		}
+		spans = append(spans, span{label, from, to})
+	}
+
+	fmt.Printf("\nPrice statistics (%s)\n", strings.ToUpper(currency))
+	fmt.Printf("%-22s %-8s %-12s %-12s %-12s %-12s %-10s %-9s",
+		"Window", "Samples", "Min", "Max", "Mean", "Median", "StdDev", "Change")
+	rule := "---------------------------------------------------------------------------------------------------"
+	if fearGreedConfig.Enabled {
+		fmt.Printf(" %s", "Fear & Greed")
+		rule += "------------------------------"
+	}
+	fmt.Printf("\n%s\n", rule)
+	var allTime *PriceExtremes
+	var last float64
+	summarized := false
+	for _, sp := range spans {
+		stats, err := computePriceStats(context.Background(), repo, currency, sp.from, sp.to)
+		if err != nil {
+			return err
+		}
+		allTime = stats.AllTime
+		if stats.Samples > 0 {
+			last = stats.Last
+		}
+		if stats.Samples == 0 {
+			fmt.Printf("%-22s %-8d no prices recorded\n", sp.label, 0)
+			continue
+		}
+		label := sp.label
+		if stats.Summarized {
+			label, summarized = label+" *", true
+		}
+		fmt.Printf("%-22s %-8d %-12.2f %-12.2f %-12.2f %-12.2f %-10.2f %+8.2f%%",
+			label, stats.Samples, stats.Min, stats.Max, stats.Mean, stats.Median, stats.StdDev, stats.ChangePct)
+		if fearGreedConfig.Enabled {
+			fmt.Printf("  %s", formatFearGreed(stats.FearGreed))
+		}
+		fmt.Println()
+	}
+	if summarized {
+		fmt.Println("\n* From the daily summaries: Median and StdDev are of the daily averages")
+	}
+	if allTime != nil {
+		fmt.Printf("\nAll-time high: %s\n", formatExtreme(allTime.High, allTime.HighAt, last))
+		fmt.Printf("All-time low:  %s\n", formatExtreme(allTime.Low, allTime.LowAt, last))
+	}
+	if fearGreedConfig.Enabled && attributionEnabled {
+		fmt.Printf("\n%s\n", attributionText(attributionsFor([]string{fearGreedSource})))
+	}
+	fmt.Println()
+	if last > 0 {
+		displayDerivedUnits(context.Background(), repo, map[string]float64{currency: last}, units)
+	}
+	return nil
+}
+
+// handleStats serves GET /stats?currency=usd&window=7d or /stats?currency=usd&from=...&to=...
+// The range defaults to the 24 hours before to, and to to now
+func (s *apiServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	from, to, err := requestWindow(r, "24h")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	to = windowEnd(to, time.Now())
+	if !to.After(from) {
+		writeAPIError(w, http.StatusBadRequest, "the range must end after it starts")
+		return
+	}
+
+	if err := checkAnalyticsRange(from, to, ""); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	ctx, cancel := withAnalyticsTimeout(r.Context())
+	defer cancel()
+	stats, err := computePriceStats(ctx, s.repo, requestCurrency(r), from, to)
+	if err != nil {
+		writeAnalyticsError(w, r, "statistics", err)
+		return
+	}
+	if stats.FearGreed != nil {
+		setAttribution(w, []string{"", fearGreedSource}) // The price providers and the index
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"      // Package for query deadlines
+	"database/sql" // Package for SQL database operations
+	"fmt"          // Package for formatted I/O operations
+	"net/url"      // Package for editing URL connection strings
+	"strings"      // Package for editing key=value connection strings
+	"time"         // Package for connection pool settings
+
+	"github.com/lib/pq" // PostgreSQL driver, also used to quote the query role
+)
+
+// postgresStore is the default Store, backed by PostgreSQL
+type postgresStore struct {
+	sqlStore
+}
+
+// utcSession makes every connection use the UTC session time zone
+// TIMESTAMPTZ values are stored as instants either way, but the session zone decides
+// what date_trunc and ::date group by, so it is pinned rather than left to the server.
+// Both URL and key=value connection strings are supported.
+func utcSession(dbURL string) (string, error) {
+	if !strings.HasPrefix(dbURL, "postgres://") && !strings.HasPrefix(dbURL, "postgresql://") {
+		return dbURL + " timezone=UTC", nil // Later keys override earlier ones
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid DATABASE_URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("timezone", "UTC")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// openPostgresStore connects to PostgreSQL and verifies the connection within ctx
+func openPostgresStore(ctx context.Context, dbURL string) (*postgresStore, error) {
+	dsn, err := utcSession(dbURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open database connection
+	// sql.Open doesn't actually connect, it just validates the DSN
+	db, err := openSQL("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Ping the database to verify connection
+	// This actually establishes a connection to the database
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	// Set connection pool settings for better performance
+	db.SetMaxOpenConns(10)                 // Maximum number of open connections
+	db.SetMaxIdleConns(5)                  // Maximum number of idle connections
+	db.SetConnMaxLifetime(5 * time.Minute) // Maximum connection lifetime
+
+	s := &postgresStore{sqlStore{db: db, dialect: "postgres"}}
+	if s.timescale, err = s.detectTimescale(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// WeeklyVolatility implements Store
+// The aggregation runs in SQL so raw samples never have to be loaded into Go
+func (s *postgresStore) WeeklyVolatility(currency string) ([]VolatilityRegime, error) {
+	week := "date_trunc('week', timestamp)"
+	if s.timescale {
+		week = "time_bucket(INTERVAL '1 week', timestamp)" // Weeks start on Monday either way
+	}
+	query := `
+	WITH returns AS (
+		SELECT timestamp,
+		       LN(price / LAG(price) OVER (ORDER BY timestamp)) AS r
+		FROM bitcoin_prices
+		WHERE currency = $1
+	)
+	SELECT ` + week + `::date AS week,
+	       STDDEV_SAMP(r),
+	       COUNT(r)
+	FROM returns
+	WHERE r IS NOT NULL
+	GROUP BY week
+	ORDER BY week
+	`
+
+	rows, err := s.db.Query(query, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query weekly volatility: %w", err)
+	}
+	defer rows.Close()
+
+	var periods []VolatilityRegime
+	for rows.Next() {
+		var p VolatilityRegime
+		var stddev sql.NullFloat64 // NULL when the week has a single return
+		if err := rows.Scan(&p.PeriodStart, &stddev, &p.Samples); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if !stddev.Valid {
+			continue
+		}
+		p.Currency = currency
+		p.StdDev = stddev.Float64
+		periods = append(periods, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return periods, nil
+}
+
+// PriceStats implements Store
+// Long ranges on TimescaleDB are read from the hourly aggregate instead of every price
+func (s *postgresStore) PriceStats(ctx context.Context, currency string, from, to time.Time) (PriceStats, error) {
+	if s.timescale && to.Sub(from) >= timescaleStatsMinRange {
+		return s.timescalePriceStats(ctx, currency, from, to)
+	}
+	query := `
+	WITH window_prices AS (
+		SELECT id, price, timestamp
+		FROM bitcoin_prices
+		WHERE currency = $1 AND timestamp >= $2 AND timestamp < $3
+	)
+	SELECT COUNT(*),
+	       MIN(price),
+	       MAX(price),
+	       AVG(price),
+	       STDDEV_SAMP(price),
+	       percentile_cont(0.5) WITHIN GROUP (ORDER BY price),
+	       (SELECT price FROM window_prices ORDER BY timestamp, id LIMIT 1),
+	       (SELECT price FROM window_prices ORDER BY timestamp DESC, id DESC LIMIT 1)
+	FROM window_prices
+	`
+
+	var stats PriceStats
+	var min, max, mean, stddev, median, first, last sql.NullFloat64 // NULL for an empty range
+	err := s.db.QueryRowContext(ctx, query, currency, s.timeArg(from), s.timeArg(to)).Scan(
+		&stats.Samples, &min, &max, &mean, &stddev, &median, &first, &last)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query price statistics: %w", err)
+	}
+	stats.Min, stats.Max, stats.Mean, stats.StdDev = min.Float64, max.Float64, mean.Float64, stddev.Float64
+	stats.Median, stats.First, stats.Last = median.Float64, first.Float64, last.Float64
+	return stats, nil
+}
+
+// ReadOnlyQuery implements Store
+// The statement runs in a READ ONLY transaction that is always rolled back, as
+// QUERY_ROLE when one is configured, and with a statement_timeout matching ctx's
+// deadline so the server stops working on it too
+func (s *postgresStore) ReadOnlyQuery(ctx context.Context, statement string, maxRows int) (QueryResult, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return QueryResult{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if queryConfig.Role != "" {
+		if _, err := tx.ExecContext(ctx, "SET LOCAL ROLE "+pq.QuoteIdentifier(queryConfig.Role)); err != nil {
+			return QueryResult{}, fmt.Errorf("failed to switch to query role %s: %w", queryConfig.Role, err)
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		ms := max(time.Until(deadline).Milliseconds(), 1)
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)); err != nil {
+			return QueryResult{}, fmt.Errorf("failed to set statement timeout: %w", err)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, statement)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	defer rows.Close()
+	return collectQueryRows(rows, maxRows)
+}
+
+// copyMinRows is the smallest write that SaveHistoricalPrices streams with COPY
+// Smaller writes don't repay the staging table and go through multi-row INSERTs.
+const copyMinRows = 1000
+
+// SaveHistoricalPrices implements Store
+// Large writes are streamed with COPY into a temporary staging table and moved into
+// bitcoin_prices with one INSERT ... SELECT, since COPY itself can't skip the rows
+// that collide with the unique index
+func (s *postgresStore) SaveHistoricalPrices(ctx context.Context, records []PriceRecord) (int, error) {
+	if len(records) < copyMinRows {
+		return s.sqlStore.SaveHistoricalPrices(ctx, records)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction has been committed
+
+	// The staging table has the columns' types but none of their constraints
+	if _, err := tx.ExecContext(ctx, `
+	CREATE TEMP TABLE price_batch ON COMMIT DROP AS
+	SELECT price, currency, source, fx_rate, latency, volume_24h, market_cap, timestamp FROM bitcoin_prices WITH NO DATA
+	`); err != nil {
+		return 0, fmt.Errorf("failed to create staging table: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("price_batch", "price", "currency", "source", "fx_rate", "latency", "volume_24h", "market_cap", "timestamp"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to start COPY: %w", err)
+	}
+	for _, r := range records {
+		// Timestamps are stored to the second
+		ts := r.Timestamp.UTC().Truncate(time.Second)
+		if _, err := stmt.ExecContext(ctx, storedPriceIn(r.Currency, r.Price), r.Currency, r.Source, r.FXRate, r.Latency, r.Volume, r.MarketCap, ts); err != nil {
+			stmt.Close()
+			return 0, fmt.Errorf("failed to copy historical prices: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil { // Flushes the buffered rows
+		stmt.Close()
+		return 0, fmt.Errorf("failed to copy historical prices: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, fmt.Errorf("failed to finish COPY: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+	INSERT INTO bitcoin_prices (price, currency, source, fx_rate, latency, volume_24h, market_cap, timestamp)
+	SELECT price, currency, source, fx_rate, latency, volume_24h, market_cap, timestamp FROM price_batch
+	ORDER BY timestamp
+	ON CONFLICT DO NOTHING
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save historical prices: %w", err)
+	}
+	inserted, _ := res.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit historical prices: %w", err)
+	}
+	return int(inserted), nil
+}
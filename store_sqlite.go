@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"      // Package for query deadlines
+	"database/sql" // Package for SQL database operations
+	"fmt"          // Package for formatted I/O operations
+	"math"         // Package for log returns and standard deviations
+	"time"         // Package for week boundaries
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver (imported for side effects, requires cgo)
+)
+
+// sqliteStore is a Store backed by a single SQLite file
+// It needs no database server, which suits small devices like a Raspberry Pi.
+// Timestamps are stored as UTC text ("YYYY-MM-DD HH:MM:SS") by CURRENT_TIMESTAMP defaults.
+type sqliteStore struct {
+	sqlStore
+	path string // Database file, reopened read-only by ReadOnlyQuery
+}
+
+// openSQLiteStore opens (creating if needed) the SQLite database at path
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	// WAL lets the status command read while the scheduler writes;
+	// the busy timeout covers the short moments a writer holds the lock
+	dsn := "file:" + path + "?_journal_mode=WAL&_busy_timeout=5000"
+	db, err := openSQL("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite database %s: %w", path, err)
+	}
+
+	// SQLite allows a single writer; one connection avoids lock contention entirely
+	db.SetMaxOpenConns(1)
+
+	return &sqliteStore{sqlStore: sqlStore{db: db, dialect: "sqlite"}, path: path}, nil
+}
+
+// WeeklyVolatility implements Store
+// SQLite has no LN or STDDEV unless specially compiled, so the returns are
+// aggregated in Go. The result matches the PostgreSQL implementation: weeks start
+// on Monday and a return belongs to the week of its later sample.
+func (s *sqliteStore) WeeklyVolatility(currency string) ([]VolatilityRegime, error) {
+	rows, err := s.db.Query(
+		`SELECT price, timestamp FROM bitcoin_prices WHERE currency = ?1 ORDER BY timestamp, id`,
+		currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query weekly volatility: %w", err)
+	}
+	defer rows.Close()
+
+	var periods []VolatilityRegime
+	var returns []float64
+	var week time.Time
+	prev := 0.0
+
+	// flush closes the current week, keeping it only if a stddev can be computed
+	flush := func() {
+		if len(returns) >= 2 {
+			periods = append(periods, VolatilityRegime{
+				Currency:    currency,
+				PeriodStart: week,
+				StdDev:      sampleStdDev(returns),
+				Samples:     len(returns),
+			})
+		}
+		returns = returns[:0]
+	}
+
+	for rows.Next() {
+		var price float64
+		var ts time.Time
+		if err := rows.Scan(&price, &ts); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		w := weekStart(ts)
+		if !w.Equal(week) {
+			flush()
+			week = w
+		}
+		if prev > 0 && price > 0 {
+			returns = append(returns, math.Log(price/prev))
+		}
+		prev = price
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	flush()
+	return periods, nil
+}
+
+// weekStart returns midnight UTC of the Monday starting t's ISO week
+func weekStart(t time.Time) time.Time {
+	t = t.UTC()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
+
+// PriceStats implements Store
+// SQLite has no STDDEV or median aggregate, so the sample variance is computed from
+// sums (the square root is taken in Go) and the median by sorting and picking the
+// middle one or two prices with LIMIT/OFFSET
+func (s *sqliteStore) PriceStats(ctx context.Context, currency string, from, to time.Time) (PriceStats, error) {
+	query := `
+	WITH window_prices AS (
+		SELECT id, price, timestamp
+		FROM bitcoin_prices
+		WHERE currency = ?1 AND timestamp >= ?2 AND timestamp < ?3
+	)
+	SELECT COUNT(*),
+	       MIN(price),
+	       MAX(price),
+	       AVG(price),
+	       CASE WHEN COUNT(*) > 1
+	            THEN (SUM(price * price) - SUM(price) * SUM(price) / COUNT(*)) / (COUNT(*) - 1)
+	       END,
+	       (SELECT AVG(price) FROM (
+	            SELECT price FROM window_prices ORDER BY price
+	            LIMIT 2 - (SELECT COUNT(*) FROM window_prices) % 2
+	            OFFSET ((SELECT COUNT(*) FROM window_prices) - 1) / 2)),
+	       (SELECT price FROM window_prices ORDER BY timestamp, id LIMIT 1),
+	       (SELECT price FROM window_prices ORDER BY timestamp DESC, id DESC LIMIT 1)
+	FROM window_prices
+	`
+
+	var stats PriceStats
+	var min, max, mean, variance, median, first, last sql.NullFloat64 // NULL for an empty range
+	err := s.db.QueryRowContext(ctx, query, currency, s.timeArg(from), s.timeArg(to)).Scan(
+		&stats.Samples, &min, &max, &mean, &variance, &median, &first, &last)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query price statistics: %w", err)
+	}
+	stats.Min, stats.Max, stats.Mean = min.Float64, max.Float64, mean.Float64
+	stats.StdDev = math.Sqrt(math.Max(variance.Float64, 0)) // Rounding can leave a tiny negative variance
+	stats.Median, stats.First, stats.Last = median.Float64, first.Float64, last.Float64
+	return stats, nil
+}
+
+// sampleStdDev returns the sample standard deviation (n-1 denominator), like STDDEV_SAMP
+func sampleStdDev(values []float64) float64 {
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// ReadOnlyQuery implements Store
+// SQLite has no roles, so the statement runs on a separate connection opened
+// read-only with query_only set: the file can't be written through it at all.
+// Cancelling ctx interrupts the statement.
+func (s *sqliteStore) ReadOnlyQuery(ctx context.Context, statement string, maxRows int) (QueryResult, error) {
+	db, err := sql.Open("sqlite3", "file:"+s.path+"?mode=ro&_query_only=true&_busy_timeout=5000")
+	if err != nil {
+		return QueryResult{}, fmt.Errorf("failed to open database read-only: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, statement)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	defer rows.Close()
+	return collectQueryRows(rows, maxRows)
+}
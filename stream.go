@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"       // Package for stopping the stream on shutdown
+	"encoding/json" // Package for feed messages
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"os"            // Package for environment variables
+	"strconv"       // Package for parsing string-encoded prices
+	"strings"       // Package for string manipulation
+	"time"          // Package for sampling and timeouts
+
+	"bitcoin-tracker/tracker" // Price validation
+)
+
+// Stream settings
+const (
+	defaultStreamSample = time.Minute      // Default spacing of persisted samples
+	minStreamSample     = time.Second      // Shortest allowed sample interval
+	streamIdleTimeout   = 60 * time.Second // Reconnect when a feed sends nothing, not even a ping, for this long
+)
+
+// streamFeed is an exchange WebSocket feed of ticker updates
+type streamFeed interface {
+	// Name is stored as the source of streamed samples
+	Name() string
+	// URL is the WebSocket endpoint to connect to
+	URL() string
+	// Subscribe sends any messages the feed needs after connecting
+	Subscribe(ws *wsConn) error
+	// Parse extracts a currency, last-trade price, and the exchange's time of the
+	// update from a message; ok is false for messages that carry no price (heartbeats,
+	// subscription confirmations)
+	Parse(message []byte) (tick streamTick, ok bool, err error)
+}
+
+// streamFeeds lists every built-in feed by its config name
+// Each builds a feed for an asset quoted in currencies, named as in symbols.go
+var streamFeeds = map[string]func(repo *Repository, asset string, currencies []string) (streamFeed, error){
+	"binance":  newBinanceFeed,
+	"coinbase": newCoinbaseFeed,
+}
+
+// binanceFeed reads the combined 24h ticker streams of Binance
+// Binance pings every few minutes and drops connections after 24 hours; the
+// pings are answered by wsConn and the drop is handled by reconnecting
+type binanceFeed struct {
+	streams []string          // Stream names, e.g. "btcusdt@ticker"
+	pairs   map[string]string // Binance symbol (e.g. "BTCUSDT") -> our currency
+}
+
+// newBinanceFeed builds a feed for asset quoted in currencies; USD is quoted via USDT
+func newBinanceFeed(repo *Repository, asset string, currencies []string) (streamFeed, error) {
+	f := &binanceFeed{pairs: make(map[string]string)}
+	for _, currency := range currencies {
+		market, err := marketSymbol(context.Background(), repo, "binance", asset, currency)
+		if err != nil {
+			return nil, err
+		}
+		f.pairs[market.Symbol] = currency
+		f.streams = append(f.streams, strings.ToLower(market.Symbol)+"@ticker")
+	}
+	return f, nil
+}
+
+// Name implements streamFeed
+func (f *binanceFeed) Name() string { return "binance-ws" }
+
+// URL implements streamFeed
+func (f *binanceFeed) URL() string {
+	return "wss://stream.binance.com:9443/stream?streams=" + strings.Join(f.streams, "/")
+}
+
+// Subscribe implements streamFeed; the streams are selected in the URL
+func (f *binanceFeed) Subscribe(ws *wsConn) error { return nil }
+
+// Parse implements streamFeed
+func (f *binanceFeed) Parse(message []byte) (streamTick, bool, error) {
+	// Message format: {"stream": "btcusdt@ticker", "data": {"e": "24hrTicker", "E": 1711356300123, "s": "BTCUSDT", "c": "43250.75", ...}}
+	var msg struct {
+		Data struct {
+			Event     string `json:"e"`
+			EventTime int64  `json:"E"` // Milliseconds since the epoch
+			Symbol    string `json:"s"`
+			Close     string `json:"c"` // Last price
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return streamTick{}, false, fmt.Errorf("failed to parse binance message: %w", err)
+	}
+	currency, known := f.pairs[msg.Data.Symbol]
+	if msg.Data.Event != "24hrTicker" || !known {
+		return streamTick{}, false, nil
+	}
+	tick := streamTick{currency: currency}
+	tick.price, _ = strconv.ParseFloat(msg.Data.Close, 64)
+	if msg.Data.EventTime > 0 {
+		tick.at = time.UnixMilli(msg.Data.EventTime)
+	}
+	return tick, true, nil
+}
+
+// coinbaseFeed reads the Coinbase Exchange ticker channel
+// The heartbeat channel is subscribed as well, so a quiet market still shows the
+// connection is alive
+type coinbaseFeed struct {
+	products []string          // Product ids, e.g. "BTC-USD"
+	pairs    map[string]string // Product id -> our currency
+}
+
+// newCoinbaseFeed builds a feed for asset quoted in currencies
+func newCoinbaseFeed(repo *Repository, asset string, currencies []string) (streamFeed, error) {
+	f := &coinbaseFeed{pairs: make(map[string]string)}
+	for _, currency := range currencies {
+		product, err := marketSymbol(context.Background(), repo, "coinbase", asset, currency)
+		if err != nil {
+			return nil, err
+		}
+		f.pairs[product.Symbol] = currency
+		f.products = append(f.products, product.Symbol)
+	}
+	return f, nil
+}
+
+// Name implements streamFeed
+func (f *coinbaseFeed) Name() string { return "coinbase-ws" }
+
+// URL implements streamFeed
+func (f *coinbaseFeed) URL() string { return "wss://ws-feed.exchange.coinbase.com" }
+
+// Subscribe implements streamFeed
+func (f *coinbaseFeed) Subscribe(ws *wsConn) error {
+	msg, err := json.Marshal(map[string]interface{}{
+		"type":        "subscribe",
+		"product_ids": f.products,
+		"channels":    []string{"ticker", "heartbeat"},
+	})
+	if err != nil {
+		return err
+	}
+	return ws.WriteText(msg)
+}
+
+// Parse implements streamFeed
+func (f *coinbaseFeed) Parse(message []byte) (streamTick, bool, error) {
+	// Message format: {"type": "ticker", "product_id": "BTC-USD", "price": "43250.75", "time": "2024-03-25T08:45:00.123456Z", ...}
+	var msg struct {
+		Type      string    `json:"type"`
+		ProductID string    `json:"product_id"`
+		Price     string    `json:"price"`
+		Time      time.Time `json:"time"`
+		Message   string    `json:"message"` // Set on errors
+		Reason    string    `json:"reason"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return streamTick{}, false, fmt.Errorf("failed to parse coinbase message: %w", err)
+	}
+	switch msg.Type {
+	case "error":
+		return streamTick{}, false, fmt.Errorf("coinbase error: %s %s", msg.Message, msg.Reason)
+	case "ticker":
+		currency, known := f.pairs[msg.ProductID]
+		if !known {
+			return streamTick{}, false, nil
+		}
+		tick := streamTick{currency: currency, at: msg.Time}
+		tick.price, _ = strconv.ParseFloat(msg.Price, 64)
+		return tick, true, nil
+	}
+	return streamTick{}, false, nil
+}
+
+// streamOptions are the settings of one stream command
+type streamOptions struct {
+	feed   streamFeed
+	sample time.Duration // Spacing of samples
+	batch  time.Duration // How long samples are buffered before they are written; 0 writes each at once
+}
+
+// parseStreamOptions handles "stream [--feed binance|coinbase] [--sample 1m] [--batch 5m]"
+// The flags override STREAM_FEED, STREAM_SAMPLE_INTERVAL, and STREAM_BATCH_INTERVAL.
+// --batch is only offered when batching is true, since relay stream stores nothing.
+func parseStreamOptions(repo *Repository, args []string, batching bool) (streamOptions, error) {
+	defaultFeed := os.Getenv("STREAM_FEED")
+	if defaultFeed == "" {
+		defaultFeed = "binance"
+	}
+	defaultSample := defaultStreamSample.String()
+	if v := os.Getenv("STREAM_SAMPLE_INTERVAL"); v != "" {
+		defaultSample = v
+	}
+	defaultBatch := "0s"
+	if v := os.Getenv("STREAM_BATCH_INTERVAL"); v != "" {
+		defaultBatch = v
+	}
+
+	fs := newFlagSet("stream")
+	feedName := fs.String("feed", defaultFeed, "WebSocket feed: binance or coinbase")
+	sampleFlag := fs.String("sample", defaultSample, "Interval between persisted samples (Go duration)")
+	batchFlag := &defaultBatch
+	if batching {
+		batchFlag = fs.String("batch", defaultBatch, "Buffer samples and write them this often, or every WRITE_BATCH_SIZE rows (Go duration; 0 = write each sample)")
+	}
+	if err := fs.Parse(args); err != nil {
+		return streamOptions{}, withKind(KindValidation, err)
+	}
+
+	newFeed, ok := streamFeeds[strings.ToLower(*feedName)]
+	if !ok {
+		return streamOptions{}, fmt.Errorf("unknown feed %q (expected binance or coinbase)", *feedName)
+	}
+	opts := streamOptions{}
+	var err error
+	if opts.sample, err = time.ParseDuration(*sampleFlag); err != nil {
+		return opts, fmt.Errorf("invalid sample interval %q: %w", *sampleFlag, err)
+	}
+	if opts.sample < minStreamSample {
+		return opts, fmt.Errorf("sample interval %s is below the minimum of %s", opts.sample, minStreamSample)
+	}
+	if batching {
+		if opts.batch, err = time.ParseDuration(*batchFlag); err != nil || opts.batch < 0 {
+			return opts, fmt.Errorf("invalid batch interval %q", *batchFlag)
+		}
+	}
+
+	if opts.feed, err = newFeed(repo, "bitcoin", fetchCurrencies()); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// batchedRecorder is the record function of stream --batch
+// Each sample is stamped with the time it was taken and buffered in a priceWriter,
+// which writes the buffer every interval or WRITE_BATCH_SIZE rows. Everything that
+// follows new samples (events, candles, alerts) runs once per write, with the newest
+// price of each currency in it. Close the returned writer to write what is left.
+func batchedRecorder(ctx context.Context, repo *Repository, interval time.Duration) (func(context.Context, map[string]float64, map[string]time.Time, string) error, *priceWriter) {
+	writer := newPriceWriter(ctx, repo, "stream", writeBatchConfig.Size, interval, func(ctx context.Context, records []PriceRecord, inserted int) {
+		if skipped := len(records) - inserted; skipped > 0 {
+			slog.Info("Skipped duplicate prices", "coin", "bitcoin", "count", skipped, "source", records[0].Source)
+			incCounter("tracker_duplicate_prices_total", map[string]string{"source": records[0].Source}, float64(skipped))
+		}
+		if inserted == 0 {
+			return // Every price was a duplicate, so nothing downstream changed
+		}
+		slog.Info("Saved streamed prices", "coin", "bitcoin", "rows", inserted, "source", records[0].Source)
+		observeLatency(records)
+
+		latest := make(map[string]float64)
+		for _, r := range records { // Oldest first, so the newest price wins
+			latest[r.Currency] = r.Price
+		}
+		processNewPrices(ctx, repo, latest, records[0].Source)
+		runPriceHooks(ctx, repo, records)
+	})
+
+	record := func(ctx context.Context, prices map[string]float64, quoted map[string]time.Time, source string) error {
+		prices, rates := convertFXPrices(ctx, repo, prices)
+		prices = screenPrices(repo, prices, source)
+		now := time.Now()
+		records := make([]PriceRecord, 0, len(prices))
+		for _, currency := range currencies {
+			if price, ok := prices[currency]; ok {
+				records = append(records, PriceRecord{Price: roundPriceIn(currency, price), Currency: currency, Source: source,
+					FXRate: rates[currency], Timestamp: now, QuotedAt: quotedAt(quoted, rates, currency, now)})
+			}
+		}
+		return writer.Add(records...)
+	}
+	return record, writer
+}
+
+// streamTick is one price update from a feed
+type streamTick struct {
+	currency string
+	price    float64
+	at       time.Time // When the exchange sent the update; when it arrived for feeds without a time
+}
+
+// streamConnection reads ticks from one feed connection until it fails or ctx is cancelled
+// It reports whether any price arrived, so a connection that worked resets the backoff
+func streamConnection(ctx context.Context, feed streamFeed, ticks chan<- streamTick) (bool, error) {
+	ws, err := dialWebSocket(ctx, feed.URL())
+	if err != nil {
+		return false, err
+	}
+	// Closing the connection unblocks the read loop once ctx is cancelled
+	stopClose := context.AfterFunc(ctx, func() { ws.conn.Close() })
+	defer stopClose()
+	defer ws.Close()
+
+	if err := feed.Subscribe(ws); err != nil {
+		return false, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	slog.Info("Connected to price stream", "feed", feed.Name())
+
+	received := false
+	for {
+		message, err := ws.ReadMessage(streamIdleTimeout)
+		if err != nil {
+			return received, err
+		}
+		tick, ok, err := feed.Parse(message)
+		if err != nil {
+			return received, err
+		}
+		if !ok || tracker.ValidatePrice(tick.currency, tick.price) != nil {
+			continue
+		}
+		if tick.at.IsZero() {
+			tick.at = time.Now()
+		}
+
+		received = true
+		select {
+		case ticks <- tick:
+		case <-ctx.Done():
+			return received, ctx.Err()
+		}
+	}
+}
+
+// streamTicks keeps a feed connected until ctx is cancelled, reconnecting with the
+// retry policy's backoff; the backoff starts over after a connection delivers prices
+func streamTicks(ctx context.Context, feed streamFeed, ticks chan<- streamTick) {
+	attempt := 0
+	for {
+		received, err := streamConnection(ctx, feed, ticks)
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			attempt = 0
+		}
+		attempt++
+
+		delay := retryPolicy.Backoff(attempt)
+		slog.Warn("Price stream disconnected, reconnecting", "feed", feed.Name(), "attempt", attempt,
+			"delay", delay.Round(time.Millisecond), "error", err)
+		incCounter("tracker_stream_reconnects_total", map[string]string{"feed": feed.Name()}, 1)
+		if sleepContext(ctx, delay) != nil {
+			return
+		}
+	}
+}
+
+// runStream records prices from feed until ctx is cancelled
+// Ticks are buffered and only the latest price per currency is kept; every sample
+// interval that saw a tick, one sample per currency is handed to record: recordPrices
+// saves it and runs the usual pipeline (events, candles, levels, alerts), relayPrices
+// only publishes it. Currencies without a tick in the interval keep their last price,
+// and the time of that tick as their quote time. Pending ticks are flushed on shutdown,
+// within the drain period.
+func runStream(ctx context.Context, feed streamFeed, sample time.Duration, record func(context.Context, map[string]float64, map[string]time.Time, string) error) {
+	slog.Info("Starting Bitcoin price stream", "feed", feed.Name(), "sample", sample)
+	work, cancelWork := drainContext(ctx)
+	defer cancelWork()
+
+	ticks := make(chan streamTick, 64)
+	go streamTicks(ctx, feed, ticks)
+
+	ticker := time.NewTicker(sample)
+	defer ticker.Stop()
+
+	latest := make(map[string]float64)
+	quoted := make(map[string]time.Time)
+	pending := false
+
+	flush := func() {
+		if !pending {
+			return
+		}
+		for _, currency := range fetchCurrencies() {
+			if latest[currency] == 0 {
+				slog.Warn("Waiting for a first tick before saving", "feed", feed.Name(), "currency", currency)
+				return
+			}
+		}
+
+		prices := make(map[string]float64, len(latest))
+		at := make(map[string]time.Time, len(quoted))
+		for currency, price := range latest {
+			prices[currency], at[currency] = price, quoted[currency]
+		}
+		if err := record(work, prices, at, feed.Name()); err != nil {
+			slog.Error("Failed to save streamed prices", "feed", feed.Name(), "error", err)
+			return
+		}
+		pending = false
+	}
+
+	for {
+		select {
+		case t := <-ticks:
+			latest[t.currency], quoted[t.currency] = t.price, t.at
+			pending = true
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			flush()
+			slog.Info("Price stream stopped", "feed", feed.Name())
+			return
+		}
+	}
+}
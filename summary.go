@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"         // Package for webhook request bodies
+	"context"       // Package for summary queries
+	"encoding/json" // Package for encoding webhook messages
+	"errors"        // Package for joining delivery errors
+	"fmt"           // Package for formatted I/O operations
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for webhook status codes
+	"os"            // Package for environment variables
+	"strings"       // Package for string manipulation
+	"time"          // Package for the time of day and report window
+)
+
+// SummaryConfig holds the schedule and destinations of the daily summary report
+type SummaryConfig struct {
+	At                string         // Time of day the report is posted, "HH:MM"; empty disables it
+	Hour, Minute      int            // At, parsed
+	Location          *time.Location // Time zone At is in
+	SlackWebhookURL   string         // Slack incoming webhook; defaults to SLACK_WEBHOOK_URL
+	DiscordWebhookURL string         // Discord channel webhook
+}
+
+// summaryConfig is the active configuration, loaded at startup
+var summaryConfig = SummaryConfig{Location: time.Local}
+
+// sparkBars are the block characters of a sparkline, lowest first
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// summaryPoints is the number of points in a summary's sparkline, one per hour
+const summaryPoints = 24
+
+// loadSummaryConfig reads SUMMARY_TIME, SUMMARY_TIMEZONE, SUMMARY_SLACK_WEBHOOK_URL,
+// and SUMMARY_DISCORD_WEBHOOK_URL
+func loadSummaryConfig() (SummaryConfig, error) {
+	c := SummaryConfig{
+		At:                strings.TrimSpace(os.Getenv("SUMMARY_TIME")),
+		Location:          time.Local,
+		SlackWebhookURL:   os.Getenv("SUMMARY_SLACK_WEBHOOK_URL"),
+		DiscordWebhookURL: os.Getenv("SUMMARY_DISCORD_WEBHOOK_URL"),
+	}
+	if c.SlackWebhookURL == "" {
+		c.SlackWebhookURL = os.Getenv("SLACK_WEBHOOK_URL")
+	}
+	if v := strings.TrimSpace(os.Getenv("SUMMARY_TIMEZONE")); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid SUMMARY_TIMEZONE %q: %w", v, err)
+		}
+		c.Location = loc
+	}
+	if c.At == "" {
+		return c, nil
+	}
+
+	t, err := time.Parse("15:04", c.At)
+	if err != nil {
+		return c, fmt.Errorf("invalid SUMMARY_TIME %q (expected HH:MM)", c.At)
+	}
+	c.Hour, c.Minute = t.Hour(), t.Minute()
+	if c.SlackWebhookURL == "" && c.DiscordWebhookURL == "" {
+		return c, fmt.Errorf("SUMMARY_TIME is set but no Slack or Discord webhook is (SUMMARY_SLACK_WEBHOOK_URL, SLACK_WEBHOOK_URL, or SUMMARY_DISCORD_WEBHOOK_URL)")
+	}
+	return c, nil
+}
+
+// enabled reports whether the scheduler posts a daily summary
+func (c SummaryConfig) enabled() bool { return c.At != "" }
+
+// DailySummary is one currency's prices over the 24 hours a summary report covers
+type DailySummary struct {
+	Currency  string
+	Samples   int
+	Open      float64 // First price in the window
+	High      float64
+	Low       float64
+	Close     float64  // Last price in the window
+	Change    float64  // Percent change from Open to Close
+	Sparkline string   // Hourly closes as block characters
+	Sources   []string // Providers that supplied the prices
+}
+
+// buildDailySummary summarizes a currency's prices in the 24 hours before to
+func buildDailySummary(repo *Repository, currency string, to time.Time) (DailySummary, error) {
+	from := to.Add(-24 * time.Hour)
+	stats, err := computePriceStats(context.Background(), repo, currency, from, to)
+	if err != nil {
+		return DailySummary{}, err
+	}
+	s := DailySummary{
+		Currency: stats.Currency, Samples: stats.Samples,
+		Open: stats.First, High: stats.Max, Low: stats.Min, Close: stats.Last, Change: stats.ChangePct,
+	}
+	if s.Samples == 0 {
+		return s, nil
+	}
+
+	prices, err := repo.PriceRange(s.Currency, from, to, maxRangeLimit)
+	if err != nil {
+		return s, err
+	}
+	s.Sparkline = sparkline(bucketCloses(prices, from, to, summaryPoints))
+	s.Sources = recordSources(prices)
+	return s, nil
+}
+
+// bucketCloses splits [from, to) into n equal buckets and returns the last price in
+// each, oldest first. Empty buckets repeat the previous close; leading empty buckets
+// are left out, so a sparkline starts with the first recorded price.
+func bucketCloses(prices []PriceRecord, from, to time.Time, n int) []float64 {
+	width := to.Sub(from) / time.Duration(n)
+	closes := make([]float64, 0, n)
+	i := 0
+	for b := 1; b <= n; b++ {
+		end := from.Add(time.Duration(b) * width)
+		found := false
+		var last float64
+		for ; i < len(prices) && prices[i].Timestamp.Before(end); i++ {
+			last, found = prices[i].Price, true
+		}
+		switch {
+		case found:
+			closes = append(closes, last)
+		case len(closes) > 0:
+			closes = append(closes, closes[len(closes)-1])
+		}
+	}
+	return closes
+}
+
+// sparkline renders values as a row of block characters scaled between their min and max
+// A flat series is drawn at mid height
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		level := len(sparkBars) / 2
+		if hi > lo {
+			level = int((v - lo) / (hi - lo) * float64(len(sparkBars)-1))
+		}
+		b.WriteRune(sparkBars[level])
+	}
+	return b.String()
+}
+
+// renderDailySummary builds the report text for every configured currency, telling each
+// closing price in units as well
+func renderDailySummary(ctx context.Context, repo *Repository, to time.Time, loc *time.Location, units []string) (string, error) {
+	lines := []string{renderMessage(defaultLocale, "summary.title", map[string]interface{}{
+		"Date": to.In(loc).Format("2006-01-02"),
+	})}
+	var sources []string
+	for _, currency := range currencies {
+		s, err := buildDailySummary(repo, currency, to)
+		if err != nil {
+			return "", err
+		}
+		key := "summary.daily"
+		if s.Samples == 0 {
+			key = "summary.nodata"
+		}
+		lines = append(lines, renderMessage(defaultLocale, key, s))
+		sources = append(sources, s.Sources...)
+		if len(units) == 0 || s.Samples == 0 {
+			continue
+		}
+		d, err := deriveUnits(ctx, repo, currency, s.Close, units)
+		if err != nil {
+			slog.Warn("Failed to get the gold price for the daily summary", "currency", currency, "error", err)
+		}
+		if text := formatDerivedUnits(d); text != "" {
+			lines = append(lines, renderMessage(defaultLocale, "summary.units", map[string]string{"Currency": currency, "Units": text}))
+		}
+	}
+	if fearGreedConfig.Enabled {
+		reading, ok, err := latestFearGreed(ctx, repo, to)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			lines = append(lines, renderMessage(defaultLocale, "summary.fear_greed", reading))
+			sources = append(sources, fearGreedSource)
+		}
+	}
+	if footer := summaryFooter(sources); footer != "" {
+		lines = append(lines, footer)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// summaryFooter credits the providers of a summary's prices; empty when none
+// were recorded or ATTRIBUTION is off
+func summaryFooter(sources []string) string {
+	if !attributionEnabled || len(sources) == 0 {
+		return ""
+	}
+	return attributionText(attributionsFor(sources))
+}
+
+// postSummary sends a report to the Slack and Discord webhooks that are configured
+// Each destination is tried even when another fails
+func postSummary(ctx context.Context, text string) error {
+	var errs []error
+	if summaryConfig.SlackWebhookURL != "" {
+		err := postSummaryWebhook(ctx, "slack", summaryConfig.SlackWebhookURL, map[string]string{"text": slackEscaper.Replace(text)})
+		errs = append(errs, err)
+	}
+	if summaryConfig.DiscordWebhookURL != "" {
+		err := postSummaryWebhook(ctx, "discord", summaryConfig.DiscordWebhookURL, map[string]string{"content": text})
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// postSummaryWebhook posts one JSON message to a webhook and counts the outcome
+func postSummaryWebhook(ctx context.Context, channel, url string, message map[string]string) error {
+	err := func() error {
+		body, err := json.Marshal(message)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s message: %w", channel, err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create %s request", channel)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			// The URL is a secret, so don't let it leak into logs via the error
+			return fmt.Errorf("failed to reach %s webhook", channel)
+		}
+		defer resp.Body.Close()
+
+		// Discord answers 204 No Content, Slack 200
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+			return fmt.Errorf("%s webhook returned status: %d", channel, resp.StatusCode)
+		}
+		return nil
+	}()
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	incCounter("tracker_summary_reports_total", map[string]string{"channel": channel, "result": result}, 1)
+	return err
+}
+
+// runScheduledSummary posts the daily summary on the scheduler's timer
+// Failures are logged; the next report is still scheduled
+func runScheduledSummary(ctx context.Context, repo *Repository) {
+	text, err := renderDailySummary(ctx, repo, time.Now(), summaryConfig.Location, unitsConfig.Units)
+	if err != nil {
+		slog.Error("Failed to build daily summary", "error", err)
+		return
+	}
+	if err := postSummary(ctx, text); err != nil {
+		slog.Error("Failed to post daily summary", "error", err)
+		return
+	}
+	slog.Info("Posted daily summary", "currencies", len(currencies))
+}
+
+// runSummaryCommand handles "summary [--send] [--units sats,oz]"
+// It prints the report for the last 24 hours, and posts it to the webhooks with --send
+func runSummaryCommand(repo *Repository, args []string) error {
+	fs := newFlagSet("summary")
+	send := fs.Bool("send", false, "Also post the report to the configured Slack and Discord webhooks")
+	unitsFlagValue := fs.String("units", "", "Also tell the closing prices in these units: sats, oz (default: DERIVED_UNITS)")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	units, err := unitsFlag(*unitsFlagValue)
+	if err != nil {
+		return err
+	}
+
+	text, err := renderDailySummary(context.Background(), repo, time.Now(), summaryConfig.Location, units)
+	if err != nil {
+		return err
+	}
+	fmt.Println(text)
+	if !*send {
+		return nil
+	}
+
+	if summaryConfig.SlackWebhookURL == "" && summaryConfig.DiscordWebhookURL == "" {
+		return fmt.Errorf("no summary webhook configured (SUMMARY_SLACK_WEBHOOK_URL, SLACK_WEBHOOK_URL, or SUMMARY_DISCORD_WEBHOOK_URL)")
+	}
+	if err := postSummary(context.Background(), text); err != nil {
+		return err
+	}
+	slog.Info("Posted daily summary")
+	return nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"  // Package for listing requests
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"slices"   // Package for sorting mappings
+	"strings"  // Package for string manipulation
+	"sync"     // Package for guarding the listing cache
+	"time"     // Package for listing refreshes
+
+	"bitcoin-tracker/tracker" // Tickers and built-in market names
+)
+
+// Listing refresh intervals
+const (
+	symbolListingTTL   = 24 * time.Hour // How long a provider's market listing is reused
+	symbolListingRetry = time.Hour      // How long to wait after a listing request failed
+)
+
+// SymbolMapping is one provider's identifier for an asset quoted in a currency
+type SymbolMapping struct {
+	Provider string
+	Asset    string // Canonical asset ID, e.g. "bitcoin"
+	Currency string // Empty when the provider takes the currency separately (CoinGecko)
+	Symbol   string // Provider identifier, e.g. "BTC-USD", "BTCUSDT", or "XBTUSD"
+	Origin   string // "override" (PROVIDER_SYMBOLS), "listing" (seeded), or "default" (built-in rule)
+}
+
+// symbolProvider describes how one provider names its markets
+// Markets the listing lacks are named by tracker.DefaultSymbol
+type symbolProvider struct {
+	// perCurrency is false when the identifier names the asset alone
+	perCurrency bool
+	// listing returns quote currency -> identifier for a ticker from the provider's market list
+	listing func(ctx context.Context, repo *Repository, ticker string) (map[string]string, error)
+}
+
+// symbolProviders lists how every built-in provider and feed names markets
+// The exchanges' WebSocket feeds share their REST API's identifiers
+var symbolProviders = map[string]symbolProvider{
+	"coingecko": {}, // Tracked asset IDs are CoinGecko coin IDs
+	"coinbase":  {perCurrency: true, listing: coinbaseMarkets},
+	"binance":   {perCurrency: true, listing: binanceMarkets},
+	"kraken":    {perCurrency: true, listing: krakenMarkets},
+}
+
+// symbolOverrides holds PROVIDER_SYMBOLS: "provider/asset[/currency]" -> identifier
+var symbolOverrides = map[string]string{}
+
+// symbolListings caches each provider's market listing per ticker
+var symbolListings = struct {
+	sync.Mutex
+	markets   map[string]map[string]string // "provider/TICKER" -> currency -> identifier
+	requested map[string]time.Time         // "provider/TICKER" -> when the listing was last requested
+}{markets: map[string]map[string]string{}, requested: map[string]time.Time{}}
+
+// loadSymbolOverrides parses PROVIDER_SYMBOLS, e.g.
+// "kraken/bitcoin/usd=XBTUSD,binance/bitcoin/usd=BTCFDUSD,coingecko/bitcoin=bitcoin"
+// An entry without a currency applies to every currency of the asset
+func loadSymbolOverrides() (map[string]string, error) {
+	overrides := make(map[string]string)
+	v := os.Getenv("PROVIDER_SYMBOLS")
+	if v == "" {
+		return overrides, nil
+	}
+
+	for _, entry := range strings.Split(v, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		key, symbol, ok := strings.Cut(entry, "=")
+		parts := strings.Split(strings.ToLower(strings.TrimSpace(key)), "/")
+		symbol = strings.TrimSpace(symbol)
+		if !ok || symbol == "" || len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+			return nil, fmt.Errorf("invalid PROVIDER_SYMBOLS entry %q (expected provider/asset[/currency]=symbol)", entry)
+		}
+		if _, known := symbolProviders[parts[0]]; !known {
+			return nil, fmt.Errorf("invalid PROVIDER_SYMBOLS entry %q: unknown provider %q", entry, parts[0])
+		}
+		overrides[strings.Join(parts, "/")] = symbol
+	}
+	return overrides, nil
+}
+
+// marketSymbol returns provider's identifier for asset quoted in currency
+// An override from PROVIDER_SYMBOLS wins; otherwise the provider's market listing is
+// consulted (fetched on first use and refreshed daily), and the built-in naming rule
+// covers markets the listing lacks or a listing that can't be fetched.
+func marketSymbol(ctx context.Context, repo *Repository, provider, asset, currency string) (SymbolMapping, error) {
+	p, ok := symbolProviders[provider]
+	if !ok {
+		return SymbolMapping{}, fmt.Errorf("no symbol mapping for provider %q", provider)
+	}
+	if !p.perCurrency {
+		currency = ""
+	}
+	m := SymbolMapping{Provider: provider, Asset: asset, Currency: currency}
+
+	if symbol, ok := symbolOverrides[provider+"/"+asset+"/"+currency]; ok && currency != "" {
+		m.Symbol, m.Origin = symbol, "override"
+		return m, nil
+	}
+	if symbol, ok := symbolOverrides[provider+"/"+asset]; ok {
+		m.Symbol, m.Origin = symbol, "override"
+		return m, nil
+	}
+
+	if p.perCurrency {
+		ticker, err := tracker.Ticker(asset)
+		if err != nil {
+			return m, err
+		}
+		if symbol, ok := symbolListing(ctx, repo, provider, p, ticker)[currency]; ok {
+			m.Symbol, m.Origin = symbol, "listing"
+			return m, nil
+		}
+	}
+	symbol, err := tracker.DefaultSymbol(provider, asset, currency)
+	if err != nil {
+		return m, err
+	}
+	m.Symbol, m.Origin = symbol, "default"
+	return m, nil
+}
+
+// symbolListing returns the cached market listing of a provider for a ticker
+// A failed request is logged and retried after symbolListingRetry; until then the
+// previous listing (or none) is used
+func symbolListing(ctx context.Context, repo *Repository, provider string, p symbolProvider, ticker string) map[string]string {
+	if p.listing == nil {
+		return nil
+	}
+	key := provider + "/" + ticker
+
+	symbolListings.Lock()
+	defer symbolListings.Unlock()
+	markets, requested := symbolListings.markets[key], symbolListings.requested[key]
+	wait := symbolListingTTL
+	if markets == nil {
+		wait = symbolListingRetry
+	}
+	if !requested.IsZero() && time.Since(requested) < wait {
+		return markets
+	}
+
+	symbolListings.requested[key] = time.Now()
+	fresh, err := p.listing(ctx, repo, ticker)
+	if err != nil {
+		slog.Warn("Failed to load provider markets; using built-in symbols", "source", provider, "ticker", ticker, "error", err)
+		return markets
+	}
+	slog.Debug("Loaded provider markets", "source", provider, "ticker", ticker, "markets", len(fresh))
+	symbolListings.markets[key] = fresh
+	return fresh
+}
+
+// coinbaseMarkets lists the Coinbase Exchange products for a base ticker
+// Retail spot prices also exist for fiat currencies without an exchange product;
+// those use the built-in "BTC-JPY" form
+func coinbaseMarkets(ctx context.Context, repo *Repository, ticker string) (map[string]string, error) {
+	// Response format: [{"id": "BTC-USD", "base_currency": "BTC", "quote_currency": "USD", ...}, ...]
+	var products []struct {
+		ID    string `json:"id"`
+		Base  string `json:"base_currency"`
+		Quote string `json:"quote_currency"`
+	}
+	if err := getJSON(ctx, repo, "coinbase", "bitcoin", "https://api.exchange.coinbase.com/products", &products); err != nil {
+		return nil, err
+	}
+	markets := make(map[string]string)
+	for _, product := range products {
+		if product.Base == ticker {
+			markets[strings.ToLower(product.Quote)] = product.ID
+		}
+	}
+	return markets, nil
+}
+
+// binanceMarkets lists the Binance symbols for a base ticker
+// USD, which Binance doesn't quote for most pairs, maps to the USDT market
+func binanceMarkets(ctx context.Context, repo *Repository, ticker string) (map[string]string, error) {
+	// Response format: [{"symbol": "BTCUSDT", "price": "43250.75000000"}, ...]
+	var tickers []struct {
+		Symbol string `json:"symbol"`
+	}
+	if err := getJSON(ctx, repo, "binance", "bitcoin", "https://api.binance.com/api/v3/ticker/price", &tickers); err != nil {
+		return nil, err
+	}
+
+	// Symbols join base and quote without a separator, so "BTCSTUSDT" (the BTCST token)
+	// also starts with BTC; a suffix only counts as a quote when another major asset
+	// (ETH, or BTC for ETH itself) trades against it too
+	listed := make(map[string]bool, len(tickers))
+	for _, t := range tickers {
+		listed[t.Symbol] = true
+	}
+	other := "ETH"
+	if ticker == "ETH" {
+		other = "BTC"
+	}
+	markets := make(map[string]string)
+	for _, t := range tickers {
+		quote, ok := strings.CutPrefix(t.Symbol, ticker)
+		if ok && quote != "" && listed[other+quote] {
+			markets[strings.ToLower(quote)] = t.Symbol
+		}
+	}
+	if _, ok := markets["usd"]; !ok && markets["usdt"] != "" {
+		markets["usd"] = markets["usdt"]
+	}
+	return markets, nil
+}
+
+// krakenMarkets lists the Kraken pairs for a base ticker by their REST names ("XBTUSD")
+func krakenMarkets(ctx context.Context, repo *Repository, ticker string) (map[string]string, error) {
+	// Response format: {"error": [], "result": {"XXBTZUSD": {"altname": "XBTUSD", "wsname": "XBT/USD", ...}, ...}}
+	var data struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			AltName string `json:"altname"`
+			WSName  string `json:"wsname"`
+		} `json:"result"`
+	}
+	if err := getJSON(ctx, repo, "kraken", "bitcoin", "https://api.kraken.com/0/public/AssetPairs", &data); err != nil {
+		return nil, err
+	}
+	if len(data.Error) > 0 {
+		return nil, fmt.Errorf("kraken error: %s", strings.Join(data.Error, "; "))
+	}
+
+	markets := make(map[string]string)
+	for _, pair := range data.Result {
+		if quote, ok := strings.CutPrefix(pair.WSName, tracker.KrakenTicker(ticker)+"/"); ok && pair.AltName != "" {
+			markets[strings.ToLower(quote)] = pair.AltName
+		}
+	}
+	return markets, nil
+}
+
+// displaySymbols prints the identifier every provider uses for each configured currency
+func displaySymbols(repo *Repository) {
+	var mappings []SymbolMapping
+	for provider, p := range symbolProviders {
+		for asset := range tickerSymbol {
+			list := currencies
+			if !p.perCurrency {
+				list = []string{""}
+			}
+			for _, currency := range list {
+				m, err := marketSymbol(context.Background(), repo, provider, asset, currency)
+				if err != nil {
+					m.Symbol, m.Origin = "-", err.Error()
+				}
+				mappings = append(mappings, m)
+			}
+		}
+	}
+	slices.SortFunc(mappings, func(a, b SymbolMapping) int {
+		return strings.Compare(a.Provider+"/"+a.Asset+"/"+a.Currency, b.Provider+"/"+b.Asset+"/"+b.Currency)
+	})
+
+	fmt.Println("\nProvider Symbols")
+	fmt.Println("------------------------------------------------------------")
+	fmt.Printf("%-10s %-10s %-9s %-16s %s\n", "Provider", "Asset", "Currency", "Symbol", "Origin")
+	for _, m := range mappings {
+		currency := m.Currency
+		if currency == "" {
+			currency = "(any)"
+		}
+		fmt.Printf("%-10s %-10s %-9s %-16s %s\n", m.Provider, m.Asset, currency, m.Symbol, m.Origin)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"       // Package for the evaluation's and the commands' database calls
+	"encoding/json" // Package for the API bodies
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for limiting request bodies
+	"log/slog"      // Package for structured logging
+	"net/http"      // Package for the /targets endpoints
+	"slices"        // Package for checking tracked currencies
+	"strconv"       // Package for parsing prices and IDs
+	"strings"       // Package for string manipulation
+	"time"          // Package for timestamps
+)
+
+// Price targets are one-shot alerts: "tell me once when BTC crosses 100k". A target
+// fires the first time a fetched price reaches it, through the same channels and
+// events as alert rules, and then stays fired, so a price hovering around it doesn't
+// notify again; `targets rearm` makes it pending once more. The side of the crossing
+// is the one the target is on from the newest stored price when it is set, unless
+// given. Targets are managed with the targets command and under /targets.
+
+// AlertTarget alerts fire when the price crosses a price target
+// They come from the price_targets table rather than from stored rules.
+const AlertTarget = "target"
+
+// Statuses of a price target
+const (
+	TargetPending = "pending" // Waiting for the price to cross it
+	TargetFired   = "fired"   // Crossed; no longer checked until re-armed
+)
+
+// PriceTarget is a price that notifies once when crossed
+type PriceTarget struct {
+	ID         int        `json:"id"`
+	Currency   string     `json:"currency"`
+	Price      float64    `json:"price"`
+	Direction  string     `json:"direction"` // above or below: the side the price crosses to
+	Note       string     `json:"note,omitempty"`
+	Status     string     `json:"status"` // pending or fired
+	CreatedAt  time.Time  `json:"created_at"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	FiredPrice float64    `json:"fired_price,omitempty"` // Price that crossed the target
+}
+
+// priceTargetRequest is the body of POST /targets
+type priceTargetRequest struct {
+	Price     float64 `json:"price"`
+	Currency  string  `json:"currency,omitempty"`  // The first of CURRENCIES when omitted
+	Direction string  `json:"direction,omitempty"` // above or below; from the newest price when omitted
+	Note      string  `json:"note,omitempty"`
+}
+
+// crossed reports whether a price reaches the target from its side
+func (t PriceTarget) crossed(price float64) bool {
+	if t.Direction == AlertBelow {
+		return price <= t.Price
+	}
+	return price >= t.Price
+}
+
+// target validates the request and returns the target it sets
+func (req priceTargetRequest) target(ctx context.Context, repo *Repository, now time.Time) (PriceTarget, error) {
+	t := PriceTarget{
+		Currency:  strings.ToLower(strings.TrimSpace(req.Currency)),
+		Price:     req.Price,
+		Direction: strings.ToLower(strings.TrimSpace(req.Direction)),
+		Note:      strings.TrimSpace(req.Note),
+		Status:    TargetPending,
+		CreatedAt: now.UTC(),
+	}
+	if t.Currency == "" {
+		t.Currency = currencies[0]
+	}
+	if !slices.Contains(currencies, t.Currency) {
+		return t, validationErrorf("currency %q is not tracked (CURRENCIES is %s)", t.Currency, strings.Join(currencies, ","))
+	}
+	if t.Price <= 0 {
+		return t, validationErrorf("invalid target price %g (expected a price above 0)", t.Price)
+	}
+	if t.Direction != "" {
+		if t.Direction != AlertAbove && t.Direction != AlertBelow {
+			return t, validationErrorf("invalid direction %q (expected above or below)", t.Direction)
+		}
+		return t, nil
+	}
+
+	latest, err := repo.LatestPrices(ctx, 1, t.Currency)
+	if err != nil {
+		return t, fmt.Errorf("failed to look up the latest price: %w", err)
+	}
+	if len(latest) == 0 {
+		return t, validationErrorf("no %s price stored yet to tell the target's side from; give a direction", strings.ToUpper(t.Currency))
+	}
+	t.Direction = AlertBelow
+	if t.Price > latest[0].Price {
+		t.Direction = AlertAbove
+	}
+	return t, nil
+}
+
+// evaluatePriceTargets fires the pending targets the new prices cross
+func evaluatePriceTargets(ctx context.Context, repo *Repository, prices map[string]float64) {
+	targets, err := repo.PriceTargets(ctx, TargetPending)
+	if err != nil {
+		slog.Error("Failed to load price targets", "error", err)
+		alertEngine.setError(err)
+		return
+	}
+
+	now := time.Now()
+	for _, t := range targets {
+		price, ok := prices[t.Currency]
+		if !ok || !t.crossed(price) {
+			continue
+		}
+		fired, err := repo.FirePriceTarget(ctx, t.ID, price, now)
+		if err != nil {
+			slog.Error("Failed to store price target state", "target", t.ID, "error", err)
+			continue
+		}
+		if !fired {
+			continue // Another instance got to it first
+		}
+		t.Status, t.FiredAt, t.FiredPrice = TargetFired, &now, price
+		slog.Info("Price target reached", "target", t.ID, "currency", t.Currency, "target_price", t.Price, "price", price)
+		fireAlert(repo, Alert{
+			Rule:   AlertRule{Kind: AlertTarget, Threshold: t.Price, Currency: t.Currency},
+			Price:  price,
+			Target: &t,
+			Time:   now.UTC(),
+		})
+	}
+}
+
+// runTargetCommand runs "targets add|list|rearm|remove"
+func runTargetCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: targets add|list|rearm|remove ...")
+	}
+
+	switch args[0] {
+	case "add":
+		// Options come before the price, e.g. "targets add --note 'take profit' 100000"
+		fs := newFlagSet("targets add")
+		currency := fs.String("currency", "", "Currency of the target price (default: the first of CURRENCIES)")
+		direction := fs.String("direction", "", "Side the price crosses to, above or below (default: from the latest price)")
+		note := fs.String("note", "", "Why the target was set, repeated in the notification")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if fs.NArg() != 1 {
+			return validationErrorf("usage: targets add [--currency usd] [--direction above|below] [--note text] <price>")
+		}
+		price, err := strconv.ParseFloat(strings.ReplaceAll(fs.Arg(0), ",", ""), 64)
+		if err != nil {
+			return validationErrorf("invalid target price %q", fs.Arg(0))
+		}
+		req := priceTargetRequest{Price: price, Currency: *currency, Direction: *direction, Note: *note}
+		t, err := req.target(ctx, repo, time.Now())
+		if err != nil {
+			return err
+		}
+		id, err := repo.SavePriceTarget(ctx, t)
+		if err != nil {
+			return err
+		}
+		slog.Info("Added price target", "id", id, "currency", t.Currency, "price", t.Price, "direction", t.Direction)
+
+	case "list":
+		fs := newFlagSet("targets list")
+		status := fs.String("status", "", "Only show targets in this state: pending or fired")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if *status != "" && *status != TargetPending && *status != TargetFired {
+			return validationErrorf("invalid --status %q (expected pending or fired)", *status)
+		}
+		targets, err := repo.PriceTargets(ctx, *status)
+		if err != nil {
+			return err
+		}
+		displayPriceTargets(targets)
+
+	case "rearm", "remove":
+		if len(args) < 2 {
+			return validationErrorf("usage: targets %s <id>", args[0])
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return validationErrorf("invalid target id %q", args[1])
+		}
+		if args[0] == "remove" {
+			if err := repo.DeletePriceTarget(ctx, id); err != nil {
+				return err
+			}
+			slog.Info("Removed price target", "id", id)
+			return nil
+		}
+		if err := repo.RearmPriceTarget(ctx, id); err != nil {
+			return err
+		}
+		slog.Info("Re-armed price target; it fires again the next time the price crosses it", "id", id)
+
+	default:
+		return validationErrorf("unknown targets command: %s", args[0])
+	}
+	return nil
+}
+
+// displayPriceTargets prints targets as a table
+func displayPriceTargets(targets []PriceTarget) {
+	if len(targets) == 0 {
+		slog.Info("No price targets found")
+		return
+	}
+
+	fmt.Printf("\n%-5s %-9s %-16s %-7s %-8s %-20s %-16s %s\n", "ID", "Currency", "Target", "Side", "Status", "Fired at", "Crossed at", "Note")
+	fmt.Println("--------------------------------------------------------------------------------------------------")
+	for _, t := range targets {
+		fired, firedPrice := "-", "-"
+		if t.FiredAt != nil {
+			fired, firedPrice = formatDisplayTime(*t.FiredAt), formatPrice(t.FiredPrice)
+		}
+		fmt.Printf("%-5d %-9s %-16s %-7s %-8s %-20s %-16s %s\n", t.ID, strings.ToUpper(t.Currency), formatPrice(t.Price),
+			t.Direction, t.Status, fired, firedPrice, t.Note)
+	}
+	fmt.Println()
+}
+
+// handleTargets serves GET and POST /targets, POST /targets/<id>/rearm, and
+// DELETE /targets/<id>
+func (s *apiServer) handleTargets(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/targets"), "/")
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			status := r.URL.Query().Get("status")
+			if status != "" && status != TargetPending && status != TargetFired {
+				writeAPIError(w, http.StatusBadRequest, "status must be pending or fired")
+				return
+			}
+			targets, err := s.repo.PriceTargets(r.Context(), status)
+			if err != nil {
+				slog.Error("API failed to fetch price targets", "path", r.URL.Path, "error", err)
+				writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to query price targets")
+				return
+			}
+			if targets == nil {
+				targets = []PriceTarget{} // Encode no targets as [] rather than null
+			}
+			writeJSON(w, http.StatusOK, targets)
+		case http.MethodPost:
+			s.handleCreatePriceTarget(w, r)
+		default:
+			writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	idText, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(idText)
+	if err != nil || (action != "" && action != "rearm") {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	var done string
+	switch {
+	case action == "rearm" && r.Method == http.MethodPost:
+		err, done = s.repo.RearmPriceTarget(r.Context(), id), "Re-armed price target"
+	case action == "" && r.Method == http.MethodDelete:
+		err, done = s.repo.DeletePriceTarget(r.Context(), id), "Removed price target"
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if errorKind(err) == KindValidation {
+		writeAPIError(w, http.StatusNotFound, "no price target with id %d", id)
+		return
+	}
+	if err != nil {
+		slog.Error("API failed to update price target", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to update price target")
+		return
+	}
+	slog.Info(done, "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreatePriceTarget serves POST /targets
+func (s *apiServer) handleCreatePriceTarget(w http.ResponseWriter, r *http.Request) {
+	var req priceTargetRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<12)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid target: %v", err)
+		return
+	}
+	t, err := req.target(r.Context(), s.repo, time.Now().Truncate(time.Second))
+	if errorKind(err) == KindValidation {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err == nil {
+		t.ID, err = s.repo.SavePriceTarget(r.Context(), t)
+	}
+	if err != nil {
+		slog.Error("API failed to save price target", "path", r.URL.Path, "error", err)
+		writeAPIProblem(w, http.StatusInternalServerError, KindStorage, "failed to save price target")
+		return
+	}
+
+	slog.Info("Added price target", "id", t.ID, "currency", t.Currency, "price", t.Price, "direction", t.Direction)
+	w.Header().Set("Location", fmt.Sprintf("/targets/%d", t.ID))
+	writeJSON(w, http.StatusCreated, t)
+}
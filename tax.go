@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"      // Package for matching trades
+	"encoding/csv" // Package for writing the reports
+	"fmt"          // Package for formatted I/O operations
+	"io"           // Package for report writers
+	"log/slog"     // Package for structured logging
+	"math"         // Package for rounding amounts
+	"os"           // Package for the output file
+	"sort"         // Package for ordering report rows
+	"strconv"      // Package for formatting quantities
+	"strings"      // Package for string manipulation
+	"time"         // Package for tax years and holding periods
+)
+
+// TaxLot is a disposal with its amounts rounded the way a tax format requires
+// Gain is computed from the rounded proceeds and cost, so the rows of a report add up
+type TaxLot struct {
+	Disposal
+	Proceeds float64
+	Cost     float64
+	Gain     float64
+	LongTerm bool // Held for more than a year
+}
+
+// TaxFormat is a country-specific capital gains report
+type TaxFormat struct {
+	Name     string
+	Country  string
+	Currency string // Sales in other currencies are left out of the report; empty for --currency
+	Decimals int    // Amounts are rounded half away from zero to this many decimals
+	write    func(w io.Writer, year int, lots []TaxLot) error
+}
+
+// taxFormats lists the supported report formats by name
+var taxFormats = map[string]TaxFormat{
+	// The IRS lets filers round to whole dollars, which keeps 8949 and Schedule D in step
+	"8949":      {Name: "8949", Country: "US", Currency: "usd", Decimals: 0, write: writeForm8949},
+	"anlage-so": {Name: "anlage-so", Country: "DE", Currency: "eur", Decimals: 2, write: writeAnlageSO},
+	// A plain gains table in any currency, e.g. for an accountant
+	"csv": {Name: "csv", Decimals: 2, write: writeGainsCSV},
+}
+
+// roundTaxAmount rounds half away from zero to the given number of decimals
+func roundTaxAmount(v float64, decimals int) float64 {
+	f := math.Pow(10, float64(decimals))
+	return math.Round(v*f) / f
+}
+
+// heldOverOneYear reports whether a lot was sold after the first anniversary of its
+// purchase, the long-term test in the US and the end of the speculation period in
+// Germany; a sale on the anniversary itself is still within the year
+func heldOverOneYear(acquired, disposed time.Time) bool {
+	y, m, d := acquired.UTC().Date()
+	return !disposed.UTC().Before(time.Date(y+1, m, d+1, 0, 0, 0, 0, time.UTC))
+}
+
+// taxLots converts disposals into report rows for a format
+// Disposals in another currency are left out with a warning; converting them would
+// need the exchange rate the tax authority accepts for the day of the sale
+func taxLots(format TaxFormat, disposals []Disposal) []TaxLot {
+	lots := make([]TaxLot, 0, len(disposals))
+	for _, d := range disposals {
+		if d.Currency != format.Currency {
+			slog.Warn("Sale is not in the report's currency, leaving it out", "holding", d.HoldingID,
+				"sold", d.Disposed.Format("2006-01-02"), "currency", d.Currency, "report_currency", format.Currency)
+			continue
+		}
+		if d.Cost == 0 {
+			slog.Warn("Cost of a sold holding is unknown, reporting a cost of zero", "holding", d.HoldingID, "sold", d.Disposed.Format("2006-01-02"))
+		}
+		lot := TaxLot{
+			Disposal: d,
+			Proceeds: roundTaxAmount(d.Proceeds, format.Decimals),
+			Cost:     roundTaxAmount(d.Cost, format.Decimals),
+			LongTerm: heldOverOneYear(d.Acquired, d.Disposed),
+		}
+		lot.Gain = roundTaxAmount(lot.Proceeds-lot.Cost, format.Decimals)
+		lots = append(lots, lot)
+	}
+	sort.SliceStable(lots, func(i, j int) bool { return lots[i].Disposed.Before(lots[j].Disposed) })
+	return lots
+}
+
+// formatTaxQuantity renders a quantity without trailing zeros, e.g. 0.5
+func formatTaxQuantity(q float64) string {
+	return strconv.FormatFloat(q, 'f', -1, 64)
+}
+
+// writeForm8949 writes the rows of IRS Form 8949, short-term (Part I) before long-term
+// (Part II), each followed by its totals for Schedule D. Crypto sales without a broker
+// statement go in box C (short-term) or F (long-term).
+func writeForm8949(w io.Writer, _ int, lots []TaxLot) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Part", "Box", "(a) Description of property", "(b) Date acquired", "(c) Date sold or disposed of",
+		"(d) Proceeds", "(e) Cost or other basis", "(f) Code", "(g) Amount of adjustment", "(h) Gain or (loss)"})
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', 0, 64) }
+
+	for _, part := range []struct {
+		name, box string
+		longTerm  bool
+	}{{"I", "C", false}, {"II", "F", true}} {
+		var proceeds, cost, gain float64
+		for _, lot := range lots {
+			if lot.LongTerm != part.longTerm {
+				continue
+			}
+			cw.Write([]string{part.name, part.box, formatTaxQuantity(lot.Quantity) + " " + tickerSymbol[lot.Asset],
+				lot.Acquired.UTC().Format("01/02/2006"), lot.Disposed.UTC().Format("01/02/2006"),
+				amount(lot.Proceeds), amount(lot.Cost), "", "", amount(lot.Gain)})
+			proceeds, cost, gain = proceeds+lot.Proceeds, cost+lot.Cost, gain+lot.Gain
+		}
+		cw.Write([]string{part.name, part.box, "Totals", "", "", amount(proceeds), amount(cost), "", "", amount(gain)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeGainsCSV writes one row per lot sold, oldest sale first, followed by the
+// short-term, long-term, and overall totals
+func writeGainsCSV(w io.Writer, _ int, lots []TaxLot) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Asset", "Quantity", "Date acquired", "Date sold", "Proceeds", "Cost basis", "Gain/loss", "Term", "Currency"})
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+	var totals [2]struct{ proceeds, cost, gain float64 }
+	for _, lot := range lots {
+		term, i := "short", 0
+		if lot.LongTerm {
+			term, i = "long", 1
+		}
+		cw.Write([]string{tickerSymbol[lot.Asset], formatTaxQuantity(lot.Quantity), lot.Acquired.UTC().Format("2006-01-02"),
+			lot.Disposed.UTC().Format("2006-01-02"), amount(lot.Proceeds), amount(lot.Cost), amount(lot.Gain), term, strings.ToUpper(lot.Currency)})
+		totals[i].proceeds += lot.Proceeds
+		totals[i].cost += lot.Cost
+		totals[i].gain += lot.Gain
+	}
+	for i, label := range []string{"Short-term total", "Long-term total"} {
+		t := totals[i]
+		cw.Write([]string{label, "", "", "", amount(t.proceeds), amount(t.cost), amount(t.gain), "", ""})
+	}
+	cw.Write([]string{"Total", "", "", "", amount(totals[0].proceeds + totals[1].proceeds), amount(totals[0].cost + totals[1].cost),
+		amount(totals[0].gain + totals[1].gain), "", ""})
+	cw.Flush()
+	return cw.Error()
+}
+
+// germanAmount formats an amount with a decimal comma and period thousands separators
+func germanAmount(v float64) string {
+	s := formatPrice(v)
+	return strings.NewReplacer(",", ".", ".", ",").Replace(s)
+}
+
+// privateSalesExemption returns the Freigrenze for private sales (§ 23 EStG) in a year:
+// gains below it are tax-free in full, gains at or above it are taxed in full
+func privateSalesExemption(year int) float64 {
+	if year >= 2024 {
+		return 1000
+	}
+	return 600
+}
+
+// writeAnlageSO writes a helper table for the private sales lines of the German
+// Anlage SO: only lots sold within a year of purchase are taxable, amounts are in
+// euros with cents, and the file uses a semicolon and decimal comma for spreadsheets
+func writeAnlageSO(w io.Writer, year int, lots []TaxLot) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	cw.Write([]string{"Wirtschaftsgut", "Anschaffung", "Veräußerung", "Veräußerungspreis", "Anschaffungskosten", "Gewinn/Verlust"})
+
+	var proceeds, cost, gain float64
+	exempt := 0
+	for _, lot := range lots {
+		if lot.LongTerm {
+			exempt++
+			continue
+		}
+		description := strings.Replace(formatTaxQuantity(lot.Quantity), ".", ",", 1) + " " + tickerSymbol[lot.Asset]
+		cw.Write([]string{description, lot.Acquired.UTC().Format("02.01.2006"), lot.Disposed.UTC().Format("02.01.2006"),
+			germanAmount(lot.Proceeds), germanAmount(lot.Cost), germanAmount(lot.Gain)})
+		proceeds, cost, gain = proceeds+lot.Proceeds, cost+lot.Cost, gain+lot.Gain
+	}
+	gain = roundTaxAmount(gain, 2)
+	cw.Write([]string{"Summe", "", "", germanAmount(proceeds), germanAmount(cost), germanAmount(gain)})
+	cw.Flush()
+
+	limit := privateSalesExemption(year)
+	slog.Info("Private sales summary", "year", year, "gain", gain, "exempt_lots", exempt,
+		"freigrenze", limit, "below_freigrenze", gain < limit)
+	return cw.Error()
+}
+
+// runTaxCommand handles "tax [--format 8949|anlage-so|csv] [--year 2025] [--source portfolio|trades]
+// [--method fifo|lifo] [--currency usd] [--output file]"
+// Output goes to stdout unless --output is given; log messages go to stderr
+func runTaxCommand(ctx context.Context, repo *Repository, args []string) error {
+	fs := newFlagSet("tax")
+	formatName := fs.String("format", "8949", "Report format: 8949 (US Form 8949), anlage-so (German Anlage SO), or csv (plain gains table)")
+	year := fs.Int("year", time.Now().Year()-1, "Tax year of the sales")
+	source := fs.String("source", "portfolio", "Sales to report: portfolio (recorded with portfolio sell) or trades (see trades)")
+	methodName := fs.String("method", matchFIFO, "How trades are matched: fifo (first in, first out) or lifo (last in, first out)")
+	currency := fs.String("currency", "", "Currency of a csv report (default: PORTFOLIO_CURRENCY)")
+	output := fs.String("output", "", "File to write (default: stdout)")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	format, ok := taxFormats[strings.ToLower(*formatName)]
+	if !ok {
+		return validationErrorf("unknown --format %q (expected 8949, anlage-so, or csv)", *formatName)
+	}
+	switch {
+	case format.Currency == "" && *currency == "":
+		format.Currency = portfolioConfig.Currency
+	case format.Currency == "":
+		format.Currency = strings.ToLower(*currency)
+	case *currency != "" && !strings.EqualFold(*currency, format.Currency):
+		return validationErrorf("--format %s is always in %s; --currency only applies to --format csv", format.Name, strings.ToUpper(format.Currency))
+	}
+	method, err := parseMatchMethod(*methodName)
+	if err != nil {
+		return err
+	}
+
+	from := time.Date(*year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var disposals []Disposal
+	switch *source {
+	case "portfolio":
+		if method != matchFIFO {
+			return validationErrorf("portfolio sales are matched first in, first out when recorded; --method only applies to --source trades")
+		}
+		disposals, err = repo.Disposals(cliTenant, from, from.AddDate(1, 0, 0))
+	case "trades":
+		disposals, err = tradeDisposals(ctx, repo, from, from.AddDate(1, 0, 0), method)
+	default:
+		return validationErrorf("unknown --source %q (expected portfolio or trades)", *source)
+	}
+	if err != nil {
+		return err
+	}
+	lots := taxLots(format, disposals)
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := format.write(w, *year, lots); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	slog.Info("Tax report written", "format", format.Name, "currency", format.Currency, "year", *year,
+		"source", *source, "method", method, "sales", len(lots))
+	return nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"         // Package for rendering templates into strings
+	"embed"         // Package for embedding the built-in locales
+	"encoding/json" // Package for parsing locale files
+	"fmt"           // Package for formatted I/O operations
+	"io/fs"         // Package for walking locale directories
+	"log/slog"      // Package for structured logging
+	"math"          // Package for detecting sub-unit prices
+	"os"            // Package for environment variables
+	"path"          // Package for locale file names
+	"sort"          // Package for stable output ordering
+	"strconv"       // Package for formatting sub-unit prices
+	"strings"       // Package for string manipulation
+	"sync"          // Package for guarding the catalog
+	"text/template" // Package for message templates
+)
+
+// builtinLocales holds the default message templates shipped with the binary
+//
+//go:embed locales/*.json
+var builtinLocales embed.FS
+
+// TemplateSource supplies message templates per locale
+// Each locale maps message keys (e.g. "price.latest") to text/template strings.
+// The built-in catalog and drop-in translation directories both implement it.
+type TemplateSource interface {
+	Locales() ([]string, error)
+	Templates(locale string) (map[string]string, error)
+}
+
+// fsTemplateSource reads "<locale>.json" files from a file system
+type fsTemplateSource struct {
+	fsys fs.FS
+	dir  string // Directory within fsys holding the locale files
+}
+
+// Locales lists the locales available in the file system
+func (s fsTemplateSource) Locales() ([]string, error) {
+	matches, err := fs.Glob(s.fsys, path.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	locales := make([]string, 0, len(matches))
+	for _, m := range matches {
+		locales = append(locales, strings.TrimSuffix(path.Base(m), ".json"))
+	}
+	return locales, nil
+}
+
+// Templates returns the raw templates for a locale
+func (s fsTemplateSource) Templates(locale string) (map[string]string, error) {
+	data, err := fs.ReadFile(s.fsys, path.Join(s.dir, locale+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var templates map[string]string
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("invalid locale file %s.json: %w", locale, err)
+	}
+	return templates, nil
+}
+
+// templateFuncs are available to every message template
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	// price formats a number with two decimals and thousands separators
+	"price": formatPrice,
+	// pct formats a percentage with an explicit sign, e.g. "+4.20%"
+	"pct": func(v float64) string { return fmt.Sprintf("%+.2f%%", v) },
+}
+
+// formatPrice renders 43250.7 as "43,250.70" and 0.0000231 as "0.0000231"
+func formatPrice(v float64) string {
+	return formatPriceAt(v, noPrecision)
+}
+
+// formatPriceAt is formatPrice with a fixed number of decimal places, e.g. 43250.7 at 4
+// as "43,250.7000"; noPrecision formats like formatPrice
+func formatPriceAt(v float64, precision int) string {
+	s := fmt.Sprintf("%.2f", v)
+	if precision != noPrecision {
+		s = strconv.FormatFloat(v, 'f', precision, 64)
+	} else if v != 0 && math.Abs(v) < 1 {
+		// Sub-unit prices (sats, small alts) show every stored digit, less trailing zeros
+		s = strings.TrimRight(strconv.FormatFloat(v, 'f', widestPriceScale(), 64), "0")
+		if whole, frac, _ := strings.Cut(s, "."); len(frac) < 2 {
+			s = whole + "." + (frac + "00")[:2]
+		}
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	if frac == "" {
+		return sign + b.String()
+	}
+	return sign + b.String() + "." + frac
+}
+
+// messageCatalog holds parsed templates for every known locale
+type messageCatalog struct {
+	mu      sync.RWMutex
+	locales map[string]map[string]*template.Template // locale -> key -> template
+}
+
+// catalog is the process-wide message catalog
+var catalog = &messageCatalog{locales: make(map[string]map[string]*template.Template)}
+
+// defaultLocale is used when a caller does not ask for a specific locale
+// Configured via LOCALE (e.g. "de"); falls back to English
+var defaultLocale = "en"
+
+// fallbackLocale supplies any key a translation does not define
+const fallbackLocale = "en"
+
+// load parses every template from the given sources
+// Later sources override keys from earlier ones, so drop-in translations win over built-ins
+func (c *messageCatalog) load(sources ...TemplateSource) error {
+	locales := make(map[string]map[string]*template.Template)
+
+	for _, source := range sources {
+		names, err := source.Locales()
+		if err != nil {
+			return fmt.Errorf("failed to list locales: %w", err)
+		}
+
+		for _, locale := range names {
+			raw, err := source.Templates(locale)
+			if err != nil {
+				return err
+			}
+			if locales[locale] == nil {
+				locales[locale] = make(map[string]*template.Template)
+			}
+			for key, text := range raw {
+				tmpl, err := template.New(key).Funcs(templateFuncs).Parse(text)
+				if err != nil {
+					return fmt.Errorf("invalid template %s/%s: %w", locale, key, err)
+				}
+				locales[locale][key] = tmpl
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.locales = locales
+	c.mu.Unlock()
+	return nil
+}
+
+// lookup finds a template, trying the exact locale, its base language ("pt-BR" -> "pt"),
+// and finally English
+func (c *messageCatalog) lookup(locale, key string) *template.Template {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	candidates := []string{locale}
+	if base, _, ok := strings.Cut(locale, "-"); ok {
+		candidates = append(candidates, base)
+	}
+	candidates = append(candidates, fallbackLocale)
+
+	for _, l := range candidates {
+		if tmpl, ok := c.locales[strings.ToLower(l)][key]; ok {
+			return tmpl
+		}
+	}
+	return nil
+}
+
+// render executes the template for key in the given locale
+func (c *messageCatalog) render(locale, key string, data interface{}) (string, error) {
+	tmpl := c.lookup(locale, key)
+	if tmpl == nil {
+		return "", fmt.Errorf("no template for message %q", key)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render message %q: %w", key, err)
+	}
+	return buf.String(), nil
+}
+
+// renderMessage renders a message in the given locale (or the default when empty)
+// Rendering problems are logged and the key itself is returned, so a broken
+// translation never prevents a notification from going out
+func renderMessage(locale, key string, data interface{}) string {
+	if locale == "" {
+		locale = defaultLocale
+	}
+
+	text, err := catalog.render(locale, key, data)
+	if err != nil {
+		slog.Warn("Failed to render message", "key", key, "error", err)
+		return key
+	}
+	return text
+}
+
+// loadMessageTemplates loads the built-in locales plus any drop-in translations
+// found in TEMPLATES_DIR (one "<locale>.json" file per language)
+func loadMessageTemplates() error {
+	sources := []TemplateSource{fsTemplateSource{fsys: builtinLocales, dir: "locales"}}
+	if dir := os.Getenv("TEMPLATES_DIR"); dir != "" {
+		sources = append(sources, fsTemplateSource{fsys: os.DirFS(dir), dir: "."})
+	}
+
+	if err := catalog.load(sources...); err != nil {
+		return err
+	}
+
+	if locale := os.Getenv("LOCALE"); locale != "" {
+		defaultLocale = strings.ToLower(locale)
+	} else {
+		defaultLocale = fallbackLocale
+	}
+	return nil
+}
+
+// sampleMessageData provides example values for previewing each built-in message
+var sampleMessageData = map[string]interface{}{
+	"price.latest": map[string]interface{}{"Price": 43250.75, "Currency": "usd"},
+	"price.change": map[string]interface{}{"Price": 43250.75, "Currency": "usd", "Change": 4.2, "Since": "24h"},
+	"reference.comparison": map[string]interface{}{
+		"Name": "bought", "Price": 28400.0, "Currency": "usd", "Change": 52.29, "Date": "2023-03-12",
+	},
+	"budget.exhausted": map[string]interface{}{"Scope": "global", "Used": 10000, "Limit": 10000},
+	"regime.changed":   map[string]interface{}{"Currency": "usd", "Regime": RegimeHigh},
+	"alert.above":      map[string]interface{}{"Price": 50120.5, "Currency": "usd", "Threshold": 50000.0},
+	"alert.below":      map[string]interface{}{"Price": 29870.0, "Currency": "usd", "Threshold": 30000.0},
+	"alert.change":     map[string]interface{}{"Price": 45100.0, "Currency": "usd", "Change": -5.3, "Window": "24h0m0s"},
+	"alert.accel":      map[string]interface{}{"Price": 46250.0, "Currency": "usd", "Change": 1.8, "PrevChange": 0.4, "Window": "5m0s"},
+	"alert.pattern":    map[string]interface{}{"Price": 44980.0, "Currency": "usd", "Pattern": "bullish_engulfing", "Resolution": "1d", "Confidence": 0.82},
+	"alert.level":      map[string]interface{}{"Price": 41820.0, "Currency": "usd", "Change": 0.55, "Level": 41592.0, "LevelKind": "support", "Touches": 3},
+	"alert.latency":    map[string]interface{}{"Price": 43250.75, "Currency": "usd", "Latency": "2m14.5s", "Limit": "1m0s"},
+	"alert.indicator":  map[string]interface{}{"Price": 43250.75, "Currency": "usd", "Indicator": "sma50 > sma200", "Resolution": "1d", "Left": 42110.4, "Right": 41876.2},
+	"alert.portfolio_above": map[string]interface{}{
+		"Currency": "eur", "Target": "portfolio", "Metric": "value", "Limit": "50,000.00 EUR", "Amount": "50,312.40 EUR",
+	},
+	"alert.portfolio_below": map[string]interface{}{
+		"Currency": "eur", "Target": "bitcoin", "Metric": "gain_pct", "Limit": "-10.00%", "Amount": "-11.84%",
+	},
+	"alert.basket_above":   map[string]interface{}{"Price": 2512000000000.0, "Currency": "usd", "Threshold": 2.5e12, "Basket": "top10"},
+	"alert.basket_below":   map[string]interface{}{"Price": 2890.5, "Currency": "usd", "Threshold": 3000.0, "Basket": "majors"},
+	"alert.basket_change":  map[string]interface{}{"Price": 2612000000000.0, "Currency": "usd", "Change": 6.1, "Window": "24h0m0s", "Basket": "top10"},
+	"alert.peg":            map[string]interface{}{"Price": 0.9912, "Currency": "usd", "Threshold": 0.5, "Change": -0.88, "Coin": "USDC", "Samples": 3},
+	"alert.peg_restored":   map[string]interface{}{"Price": 0.9984, "Currency": "usd", "Threshold": 0.5, "Change": -0.16, "Coin": "USDC", "Samples": 3},
+	"alert.digest":         map[string]interface{}{"Count": 4, "Since": "23:10"},
+	"alert.target_above":   map[string]interface{}{"Price": 100250.0, "Currency": "usd", "Threshold": 100000.0, "Note": "take some profit"},
+	"alert.target_below":   map[string]interface{}{"Price": 79900.0, "Currency": "usd", "Threshold": 80000.0, "Note": ""},
+	"alert.ath":            map[string]interface{}{"Price": 74120.0, "Currency": "usd", "Threshold": 73750.0, "Change": 0.5},
+	"alert.stale":          map[string]interface{}{"Price": 64210.0, "Currency": "usd", "Window": "15m0s", "Age": "17m2s", "Intervals": 3},
+	"alert.stale_restored": map[string]interface{}{"Price": 64380.0, "Currency": "usd", "Window": "15m0s", "Age": "42m10s", "Intervals": 3},
+	"bot.stats": map[string]interface{}{
+		"Currency": "usd", "Window": "30d", "Samples": 8640, "Min": 39850.0, "Max": 46120.0, "Mean": 42980.4, "Median": 43010.0, "Change": 6.1,
+	},
+	"bot.nodata":    map[string]interface{}{"Currency": "usd", "Window": "24h"},
+	"summary.title": map[string]interface{}{"Date": "2024-03-12"},
+	"summary.daily": DailySummary{
+		Currency: "usd", Samples: 1440, Open: 42110.4, High: 43480.0, Low: 41875.2, Close: 43250.75, Change: 2.71, Sparkline: "▁▂▂▃▂▄▅▄▅▆▇█",
+	},
+	"summary.nodata":      map[string]interface{}{"Currency": "eur"},
+	"summary.fear_greed":  FearGreedReading{Value: 72, Classification: "Greed"},
+	"report.title":        map[string]interface{}{"From": "2024-03-05", "To": "2024-03-12"},
+	"feed.milestone_up":   map[string]interface{}{"Currency": "usd", "Level": 70000.0, "Price": 70215.3},
+	"feed.milestone_down": map[string]interface{}{"Currency": "usd", "Level": 65000.0, "Price": 64890.1},
+}
+
+// previewMessages renders every known message in a locale using sample data
+// Handy for translators checking a drop-in locale file
+func previewMessages(locale string) {
+	if locale == "" {
+		locale = defaultLocale
+	}
+
+	keys := make([]string, 0, len(sampleMessageData))
+	for key := range sampleMessageData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("\nMessage templates (%s)\n", locale)
+	fmt.Println("------------------------------------------------------------")
+	for _, key := range keys {
+		fmt.Printf("%-22s %s\n", key, renderMessage(locale, key, sampleMessageData[key]))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"  // Package for carrying a request's tenant
+	"fmt"      // Package for formatted I/O operations
+	"net/http" // Package for the request's tenant
+	"os"       // Package for environment variables
+	"regexp"   // Package for validating tenant names
+	"strings"  // Package for string manipulation
+)
+
+// A deployment shared by a small group keeps each member's alert rules, holdings, sales,
+// and portfolio snapshots apart in tenants. Every API key belongs to a tenant, given
+// with `apikey create --tenant`, and requests made with it only see and change that
+// tenant's data; browsers signed in with a passkey use the default tenant, and so do
+// requests without a key when API_AUTH=off, as other modes refuse them tenant reads
+// (isTenantRead). The CLI works in the tenant named by TENANT. Prices, candles, targets,
+// and the rest of the tracked market data are shared, as are the notification channels.
+
+// defaultTenant holds the data of single-user deployments and of requests without a key
+const defaultTenant = "default"
+
+// allTenants asks the store for the rows of every tenant, e.g. to evaluate all rules
+const allTenants = "*"
+
+// tenantPattern matches tenant names
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// cliTenant is the tenant the CLI works in, configured via TENANT
+var cliTenant = defaultTenant
+
+// parseTenant validates a tenant name; empty is the default tenant
+func parseTenant(v string) (string, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == "" {
+		return defaultTenant, nil
+	}
+	if !tenantPattern.MatchString(v) {
+		return "", validationErrorf("invalid tenant %q (lowercase letters, digits, and . _ - only, at most 64)", v)
+	}
+	return v, nil
+}
+
+// loadCLITenant reads TENANT
+func loadCLITenant() (string, error) {
+	t, err := parseTenant(os.Getenv("TENANT"))
+	if err != nil {
+		return "", fmt.Errorf("invalid TENANT: %w", err)
+	}
+	return t, nil
+}
+
+// tenantOrDefault returns the tenant a row is stored under; rows built without one,
+// e.g. restored from an older backup, belong to the default tenant
+func tenantOrDefault(tenant string) string {
+	if tenant == "" {
+		return defaultTenant
+	}
+	return tenant
+}
+
+// tenantKey carries the tenant of an API request in its context
+type tenantKey struct{}
+
+// withTenant returns ctx carrying tenant
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// requestTenant returns the tenant an API request works in: that of the key it was
+// authenticated with, or the default tenant for passkey sessions and, with API_AUTH=off,
+// requests without a key
+func requestTenant(r *http.Request) string {
+	if t, ok := r.Context().Value(tenantKey{}).(string); ok && t != "" {
+		return t
+	}
+	return defaultTenant
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"      // Package for cancelling aggregate queries
+	"database/sql" // Package for nullable aggregates
+	"fmt"          // Package for formatted I/O operations
+	"log/slog"     // Package for structured logging
+	"os"           // Package for environment variables
+	"strings"      // Package for parsing TIMESCALE
+	"time"         // Package for the statistics cutoff
+)
+
+// Values of TIMESCALE
+const (
+	timescaleAuto = "auto" // Use TimescaleDB when its extension is installed in the database
+	timescaleOn   = "on"   // Install the extension if needed; fail when it isn't available
+	timescaleOff  = "off"  // Never convert bitcoin_prices
+)
+
+// timescaleStatsMinRange is the shortest range whose statistics are read from the
+// hourly aggregate; shorter ranges hold few enough prices to aggregate directly
+const timescaleStatsMinRange = 7 * 24 * time.Hour
+
+// loadTimescaleMode reads TIMESCALE (auto, on, or off)
+func loadTimescaleMode() (string, error) {
+	switch mode := strings.ToLower(os.Getenv("TIMESCALE")); mode {
+	case "":
+		return timescaleAuto, nil
+	case timescaleAuto, timescaleOn, timescaleOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid TIMESCALE %q (expected auto, on, or off)", mode)
+	}
+}
+
+// timescaleHypertableSQL turns bitcoin_prices into a hypertable in 7-day chunks
+// Unique indexes on a hypertable must contain its time column as a plain column, so
+// the primary key gains the timestamp and the one-price-per-minute index, an
+// expression index, is replaced by one on the exact timestamp. Existing rows are
+// moved into chunks, which rewrites the table under an exclusive lock.
+const timescaleHypertableSQL = `
+SET LOCAL lock_timeout = '5s';
+
+ALTER TABLE bitcoin_prices DROP CONSTRAINT IF EXISTS bitcoin_prices_pkey;
+ALTER TABLE bitcoin_prices ALTER COLUMN timestamp SET NOT NULL;
+ALTER TABLE bitcoin_prices ADD PRIMARY KEY (id, timestamp);
+
+DROP INDEX IF EXISTS idx_bitcoin_prices_coin_currency_minute;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bitcoin_prices_coin_currency_timestamp
+ON bitcoin_prices (coin, currency, timestamp);
+
+SELECT create_hypertable('bitcoin_prices', 'timestamp',
+    chunk_time_interval => INTERVAL '7 days', migrate_data => true);
+`
+
+// timescaleAggregateSQL creates the hourly candles of every currency as a continuous
+// aggregate, with the sums PriceStats needs for means and standard deviations.
+// materialized_only = false adds the hours not yet materialized at query time. Each
+// statement runs on its own: continuous aggregates can't be created in a transaction.
+var timescaleAggregateSQL = []string{`
+CREATE MATERIALIZED VIEW IF NOT EXISTS bitcoin_prices_hourly
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT currency,
+       time_bucket(INTERVAL '1 hour', timestamp) AS bucket_start, -- Start of the hour (UTC)
+       first(price, timestamp) AS open,  -- First price in the hour
+       MAX(price) AS high,               -- Highest price in the hour
+       MIN(price) AS low,                -- Lowest price in the hour
+       last(price, timestamp) AS close,  -- Last price in the hour
+       COUNT(*) AS samples,              -- Number of prices in the hour
+       SUM(price) AS total,              -- Sum of the prices, for the mean
+       SUM(price * price) AS squares     -- Sum of their squares, for the standard deviation
+FROM bitcoin_prices
+GROUP BY currency, time_bucket(INTERVAL '1 hour', timestamp)
+WITH NO DATA`, `
+-- Refreshing only recomputes hours whose prices changed since the last run, so the
+-- policy covers all history: backfilled, downsampled, archived, and purged hours are
+-- picked up within one schedule interval
+SELECT add_continuous_aggregate_policy('bitcoin_prices_hourly',
+    start_offset => NULL, end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '15 minutes', if_not_exists => true)`,
+}
+
+// detectTimescale reports whether setupTimescale has run on this database, which is
+// when the hourly aggregate exists
+func (s *postgresStore) detectTimescale(ctx context.Context) (bool, error) {
+	var ok bool
+	if err := s.db.QueryRowContext(ctx, `SELECT to_regclass('bitcoin_prices_hourly') IS NOT NULL`).Scan(&ok); err != nil {
+		return false, fmt.Errorf("failed to detect TimescaleDB: %w", err)
+	}
+	return ok, nil
+}
+
+// setupTimescale converts bitcoin_prices into a hypertable and creates the hourly
+// aggregate when TIMESCALE asks for it; every step is skipped once done
+func (s *postgresStore) setupTimescale(mode string) error {
+	if mode == timescaleOff {
+		return nil
+	}
+	if mode == timescaleOn {
+		if _, err := s.db.Exec(`CREATE EXTENSION IF NOT EXISTS timescaledb`); err != nil {
+			return fmt.Errorf("failed to install the timescaledb extension: %w", err)
+		}
+	}
+	var installed bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')`).Scan(&installed); err != nil {
+		return fmt.Errorf("failed to look for the timescaledb extension: %w", err)
+	}
+	if !installed {
+		return nil
+	}
+
+	var hypertable bool
+	err := s.db.QueryRow(`
+	SELECT EXISTS (
+		SELECT 1 FROM timescaledb_information.hypertables
+		WHERE hypertable_name = 'bitcoin_prices' AND hypertable_schema = current_schema()
+	)`).Scan(&hypertable)
+	if err != nil {
+		return fmt.Errorf("failed to look up hypertables: %w", err)
+	}
+	if !hypertable {
+		slog.Info("Converting bitcoin_prices into a TimescaleDB hypertable; large tables take a while")
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback() // No-op once the transaction has been committed
+		if _, err := tx.Exec(timescaleHypertableSQL); err != nil {
+			return fmt.Errorf("failed to convert bitcoin_prices into a hypertable: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit hypertable conversion: %w", err)
+		}
+	}
+
+	for _, statement := range timescaleAggregateSQL {
+		if _, err := s.db.Exec(statement); err != nil {
+			return fmt.Errorf("failed to create the hourly aggregate: %w", err)
+		}
+	}
+	if !s.timescale {
+		slog.Info("Using TimescaleDB", "hypertable", "bitcoin_prices", "aggregate", "bitcoin_prices_hourly")
+	}
+	s.timescale = true
+	return nil
+}
+
+// Init implements Store by applying every pending migration, then setting up
+// TimescaleDB as TIMESCALE says
+func (s *postgresStore) Init() error {
+	if err := s.sqlStore.Init(); err != nil {
+		return err
+	}
+	mode, err := loadTimescaleMode()
+	if err != nil {
+		return withKind(KindConfig, err)
+	}
+	return s.setupTimescale(mode)
+}
+
+// timescalePriceStats computes PriceStats from the hourly aggregate for the whole
+// hours in [from, to) and from the prices themselves for the partial hours at either
+// end. Sums give exact counts, means, and standard deviations; the median is taken
+// over hourly closes, since the individual prices of aggregated hours aren't read.
+func (s *postgresStore) timescalePriceStats(ctx context.Context, currency string, from, to time.Time) (PriceStats, error) {
+	query := `
+	WITH pieces AS (
+		SELECT samples, low, high, total, squares, open, close, bucket_start AS at
+		FROM bitcoin_prices_hourly
+		WHERE currency = $1 AND bucket_start >= $4 AND bucket_start < $5
+		UNION ALL
+		SELECT 1, price, price, price, price * price, price, price, timestamp
+		FROM bitcoin_prices
+		WHERE currency = $1 AND ((timestamp >= $2 AND timestamp < $4) OR (timestamp >= $5 AND timestamp < $3))
+	)
+	SELECT COALESCE(SUM(samples), 0)::bigint,
+	       MIN(low),
+	       MAX(high),
+	       SUM(total) / SUM(samples),
+	       CASE WHEN SUM(samples) > 1
+	            THEN SQRT(GREATEST((SUM(squares) - SUM(total) ^ 2 / SUM(samples)) / (SUM(samples) - 1), 0))
+	       END,
+	       percentile_cont(0.5) WITHIN GROUP (ORDER BY close),
+	       (SELECT open FROM pieces ORDER BY at LIMIT 1),
+	       (SELECT close FROM pieces ORDER BY at DESC LIMIT 1)
+	FROM pieces
+	`
+
+	// Whole hours run from the first hour starting at or after from to the hour holding to
+	firstHour := from.UTC().Truncate(time.Hour)
+	if firstHour.Before(from) {
+		firstHour = firstHour.Add(time.Hour)
+	}
+	lastHour := to.UTC().Truncate(time.Hour)
+
+	var stats PriceStats
+	var min, max, mean, stddev, median, first, last sql.NullFloat64 // NULL for an empty range
+	err := s.db.QueryRowContext(ctx, query, currency, s.timeArg(from), s.timeArg(to), s.timeArg(firstHour), s.timeArg(lastHour)).Scan(
+		&stats.Samples, &min, &max, &mean, &stddev, &median, &first, &last)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query price statistics: %w", err)
+	}
+	stats.Min, stats.Max, stats.Mean, stats.StdDev = min.Float64, max.Float64, mean.Float64, stddev.Float64
+	stats.Median, stats.First, stats.Last = median.Float64, first.Float64, last.Float64
+	return stats, nil
+}
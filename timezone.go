@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"  // Package for the candle queries
+	"errors"   // Package for stopping a price scan early
+	"flag"     // Package for the --tz flag
+	"fmt"      // Package for formatted I/O operations
+	"math"     // Package for combining candles
+	"net/http" // Package for the ?tz parameter
+	"os"       // Package for environment variables
+	"reflect"  // Package for moving response times into a zone
+	"regexp"   // Package for fixed offsets
+	"strconv"  // Package for parsing fixed offsets
+	"strings"  // Package for string manipulation
+	"time"     // Package for time zones
+)
+
+// Times are stored as instants (TIMESTAMPTZ in PostgreSQL, UTC in SQLite) and shown in
+// the display zone: --tz, else DISPLAY_TIMEZONE, else the local zone of the process
+// (TZ). Dates given to the CLI without a zone, e.g. --from 2024-03-01, are midnight
+// there, and daily candles run from its midnight to midnight. The API answers in UTC
+// unless a request asks for a zone with ?tz=Europe/Berlin (or ?tz=+05:30): every time in
+// its JSON response then carries that zone's offset, and its daily candles are aligned
+// to that zone's midnight.
+
+// tzFlag holds the --tz flag value, which takes precedence over DISPLAY_TIMEZONE
+var tzFlag = flag.String("tz", "", "time zone to show times in, e.g. Europe/Berlin or UTC (overrides DISPLAY_TIMEZONE)")
+
+// displayLocation is the zone the CLI shows times in, loaded at startup
+var displayLocation = time.Local
+
+// fixedOffsetPattern matches zones given as an offset from UTC, e.g. +05:30 or -08:00
+var fixedOffsetPattern = regexp.MustCompile(`^([+-])(\d{2}):?(\d{2})$`)
+
+// parseLocation parses a zone name: an IANA name, UTC, local, or a fixed offset
+func parseLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if strings.EqualFold(name, "local") {
+		return time.Local, nil
+	}
+	if m := fixedOffsetPattern.FindStringSubmatch(name); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3])
+		if hours > 14 || minutes > 59 {
+			return nil, validationErrorf("invalid time zone offset %q", name)
+		}
+		offset := hours*3600 + minutes*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone("UTC"+m[1]+m[2]+":"+m[3], offset), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" {
+		return nil, validationErrorf("unknown time zone %q (expected e.g. Europe/Berlin, UTC, or +05:30)", name)
+	}
+	return loc, nil
+}
+
+// loadDisplayLocation reads --tz and DISPLAY_TIMEZONE
+func loadDisplayLocation() (*time.Location, error) {
+	name, source := *tzFlag, "--tz"
+	if name == "" {
+		name, source = os.Getenv("DISPLAY_TIMEZONE"), "DISPLAY_TIMEZONE"
+	}
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := parseLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", source, err)
+	}
+	return loc, nil
+}
+
+// formatDisplayTime renders an instant in the display zone
+func formatDisplayTime(t time.Time) string {
+	return t.In(displayLocation).Format("2006-01-02 15:04:05")
+}
+
+// localMidnight returns the start of the day t falls on in loc
+func localMidnight(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// alignedToUTC reports whether days in loc run from UTC midnight to UTC midnight all
+// year, so the stored daily candles serve it
+func alignedToUTC(loc *time.Location) bool {
+	for _, month := range []time.Month{time.January, time.July} {
+		if _, offset := time.Date(2000, month, 1, 0, 0, 0, 0, loc).Zone(); offset != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// wholeHourOffsets reports whether loc is a whole number of hours from UTC at from and
+// to, so its days are made of whole hourly candles
+func wholeHourOffsets(loc *time.Location, from, to time.Time) bool {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	for _, t := range []time.Time{from, to} {
+		if _, offset := t.In(loc).Zone(); offset%3600 != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// errEnoughCandles stops a price scan once the requested number of candles is complete
+var errEnoughCandles = errors.New("enough candles")
+
+// candlesIn returns up to limit candles of currency starting in [from, to), like
+// repo.Candles, with daily candles running from midnight to midnight in loc. Days of
+// zones off UTC are rolled up from the hourly candles, or from the raw prices when the
+// zone is a fraction of an hour off. A zero to leaves the range open-ended.
+func candlesIn(ctx context.Context, repo *Repository, currency, resolution string, from, to time.Time, limit int, loc *time.Location) ([]Candle, error) {
+	if resolution != CandleDaily || alignedToUTC(loc) {
+		return repo.Candles(ctx, currency, resolution, from, to, limit)
+	}
+
+	var days []Candle
+	add := func(start time.Time, open, high, low, close float64, samples int) error {
+		day := localMidnight(start, loc)
+		if n := len(days); n > 0 && days[n-1].Start.Equal(day) {
+			d := &days[n-1]
+			d.High, d.Low = math.Max(d.High, high), math.Min(d.Low, low)
+			d.Close = close
+			d.Samples += samples
+			return nil
+		}
+		if len(days) == limit {
+			return errEnoughCandles
+		}
+		days = append(days, Candle{Currency: currency, Resolution: CandleDaily, Start: day,
+			Open: open, High: high, Low: low, Close: close, Samples: samples})
+		return nil
+	}
+
+	// Only whole days: a day starting before from is left out, as with stored candles
+	start := localMidnight(from, loc)
+	if start.Before(from) {
+		start = start.AddDate(0, 0, 1)
+	}
+	var err error
+	if wholeHourOffsets(loc, start, to) {
+		for page := start; ; {
+			var hours []Candle
+			if hours, err = repo.Candles(ctx, currency, CandleHourly, page, to, maxRangeLimit); err != nil {
+				return nil, err
+			}
+			for _, c := range hours {
+				if err = add(c.Start, c.Open, c.High, c.Low, c.Close, c.Samples); err != nil {
+					break
+				}
+			}
+			if err != nil || len(hours) < maxRangeLimit {
+				break
+			}
+			page = hours[len(hours)-1].Start.Add(time.Hour)
+		}
+	} else {
+		err = forEachPrice(repo, currency, start, to, func(r PriceRecord) error {
+			if err := add(r.Timestamp, r.Price, r.Price, r.Price, r.Price, 1); err != nil {
+				return err
+			}
+			return ctx.Err()
+		})
+	}
+	if err != nil && !errors.Is(err, errEnoughCandles) {
+		return nil, err
+	}
+	return days, nil
+}
+
+// requestLocation returns the zone an API request asks for with ?tz; UTC without one
+func requestLocation(r *http.Request) (*time.Location, error) {
+	v := r.URL.Query().Get("tz")
+	if v == "" {
+		return time.UTC, nil
+	}
+	return parseLocation(v)
+}
+
+// zonedResponseWriter carries the zone a request asked for to writeJSON
+type zonedResponseWriter struct {
+	http.ResponseWriter
+	loc *time.Location
+}
+
+// Flush implements http.Flusher for the price stream
+func (w *zonedResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withResponseZone serves requests with ?tz through a zonedResponseWriter, so the times
+// of their JSON responses carry that zone's offset; an unknown zone is refused
+func withResponseZone(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("tz") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		loc, err := requestLocation(r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		next.ServeHTTP(&zonedResponseWriter{ResponseWriter: w, loc: loc}, r)
+	})
+}
+
+// inZone returns a copy of v with every time.Time in its exported fields, elements, and
+// map values moved into loc; v itself is left unchanged
+func inZone(v reflect.Value, loc *time.Location) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return reflect.ValueOf(v.Interface().(time.Time).In(loc))
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				out.Field(i).Set(inZone(v.Field(i), loc))
+			}
+		}
+		return out
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(inZone(v.Elem(), loc))
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(inZone(v.Elem(), loc))
+		return out
+	case reflect.Slice:
+		if v.IsNil() || !holdsTimes(v.Type().Elem()) {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(inZone(v.Index(i), loc))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() || !holdsTimes(v.Type().Elem()) {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), inZone(iter.Value(), loc))
+		}
+		return out
+	}
+	return v
+}
+
+// holdsTimes reports whether values of t may contain a time.Time, so slices and maps of
+// numbers and strings needn't be copied
+func holdsTimes(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
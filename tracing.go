@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bytes"               // Package for the export request body
+	"context"             // Package for carrying spans
+	"crypto/rand"         // Package for trace and span IDs
+	"database/sql"        // Package for opening traced databases
+	"database/sql/driver" // Package for wrapping the database drivers
+	"encoding/binary"     // Package for the sampling decision
+	"encoding/hex"        // Package for traceparent headers and OTLP IDs
+	"encoding/json"       // Package for the OTLP/JSON payload
+	"fmt"                 // Package for formatted errors
+	"io"                  // Package for draining export responses
+	"log/slog"            // Package for structured logging
+	"math"                // Package for the sampling threshold
+	"net/http"            // Package for the exporter and the API middleware
+	"os"                  // Package for environment variables
+	"strconv"             // Package for parsing the sample ratio
+	"strings"             // Package for parsing OTLP headers
+	"sync"                // Package for stopping the exporter once
+	"time"                // Package for span times and export batching
+)
+
+// With OTEL_EXPORTER_OTLP_ENDPOINT, fetch cycles and API requests are traced and their
+// spans exported to an OpenTelemetry collector over OTLP/HTTP with JSON encoding. A
+// fetch cycle's span holds one span per provider request and per database query, so
+// a slow cycle shows where its time went. API requests continue the trace of an
+// incoming W3C traceparent header, and provider requests carry one onward. Database
+// queries and provider requests only get spans within a traced fetch or request, so
+// background jobs don't flood the backend.
+
+// TracingConfig controls tracing and where spans are exported
+type TracingConfig struct {
+	Endpoint    string            // OTLP/HTTP base URL; empty disables tracing
+	Headers     map[string]string // Sent with every export, e.g. an API key
+	ServiceName string            // service.name of the exported spans
+	SampleRatio float64           // Share of new traces recorded; incoming ones keep their decision
+}
+
+// tracingConfig is the active configuration, loaded at startup
+var tracingConfig = TracingConfig{ServiceName: "bitcoin-tracker", SampleRatio: 1}
+
+// loadTracingConfig reads OTEL_EXPORTER_OTLP_ENDPOINT (e.g. http://collector:4318),
+// OTEL_EXPORTER_OTLP_HEADERS (key=value,...), OTEL_SERVICE_NAME, and
+// OTEL_TRACES_SAMPLER_ARG (a ratio from 0 to 1)
+func loadTracingConfig() (TracingConfig, error) {
+	c := TracingConfig{ServiceName: "bitcoin-tracker", SampleRatio: 1}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		if !strings.HasPrefix(v, "http://") && !strings.HasPrefix(v, "https://") {
+			return c, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q (expected an http:// or https:// URL)", v)
+		}
+		c.Endpoint = strings.TrimSuffix(v, "/")
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); v != "" {
+		c.Headers = make(map[string]string)
+		for _, pair := range strings.Split(v, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return c, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS entry %q (expected key=value)", pair)
+			}
+			c.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if v := os.Getenv("OTEL_SERVICE_NAME"); v != "" {
+		c.ServiceName = v
+	}
+	if v := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return c, fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG %q (expected a ratio from 0 to 1)", v)
+		}
+		c.SampleRatio = ratio
+	}
+	return c, nil
+}
+
+// Span kinds of the OTLP protocol
+const (
+	spanInternal = 1
+	spanServer   = 2
+	spanClient   = 3
+)
+
+// traceSpan is one timed operation of a trace
+// A nil span is a no-op, so callers don't check whether tracing is on.
+type traceSpan struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte // Zero for the root of a trace
+	sampled  bool
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    map[string]any
+	err      error
+}
+
+// spanKey carries the current span in a context
+type spanKey struct{}
+
+// spanFrom returns the span of ctx, or nil
+func spanFrom(ctx context.Context) *traceSpan {
+	span, _ := ctx.Value(spanKey{}).(*traceSpan)
+	return span
+}
+
+// startSpan starts a span as a child of the one in ctx, or as the root of a new trace
+// With tracing off it returns ctx and a nil span.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *traceSpan) {
+	if spans == nil {
+		return ctx, nil
+	}
+	span := &traceSpan{name: name, kind: kind, start: time.Now(), attrs: make(map[string]any)}
+	rand.Read(span.spanID[:])
+	if parent := spanFrom(ctx); parent != nil {
+		span.traceID, span.parentID, span.sampled = parent.traceID, parent.spanID, parent.sampled
+	} else {
+		rand.Read(span.traceID[:])
+		span.sampled = sampleTrace(span.traceID)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// startChildSpan starts a span only within a traced operation; otherwise it returns
+// ctx and a nil span
+func startChildSpan(ctx context.Context, name string, kind int) (context.Context, *traceSpan) {
+	if spanFrom(ctx) == nil {
+		return ctx, nil
+	}
+	return startSpan(ctx, name, kind)
+}
+
+// sampleTrace decides whether a new trace is recorded, from the low bytes of its ID as
+// the OpenTelemetry ratio sampler does
+func sampleTrace(traceID [16]byte) bool {
+	ratio := tracingConfig.SampleRatio
+	if ratio >= 1 {
+		return true
+	}
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>1) < ratio*float64(math.MaxInt64)
+}
+
+// set records an attribute of the span
+func (s *traceSpan) set(key string, value any) {
+	if s != nil {
+		s.attrs[key] = value
+	}
+}
+
+// finish ends the span, marking it failed with a non-nil err, and queues it for export
+func (s *traceSpan) finish(err error) {
+	if s == nil || !s.sampled {
+		return
+	}
+	s.end, s.err = time.Now(), err
+	select {
+	case spans <- s:
+	default:
+		incCounter("tracker_trace_spans_dropped_total", nil, 1)
+	}
+}
+
+// traceparent formats the span as a W3C traceparent header
+func (s *traceSpan) traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-" + flags
+}
+
+// parseTraceparent returns a remote parent span from a W3C traceparent header; false
+// when the header is missing or malformed
+func parseTraceparent(header string) (*traceSpan, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil, false
+	}
+	var parent traceSpan
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return nil, false
+	}
+	if _, err := hex.Decode(parent.traceID[:], []byte(parts[1])); err != nil {
+		return nil, false
+	}
+	if _, err := hex.Decode(parent.spanID[:], []byte(parts[2])); err != nil {
+		return nil, false
+	}
+	if parent.traceID == [16]byte{} || parent.spanID == [8]byte{} {
+		return nil, false
+	}
+	parent.sampled = flags[0]&1 == 1
+	return &parent, true
+}
+
+// injectTraceparent adds the span of ctx to an outgoing request's headers
+func injectTraceparent(ctx context.Context, req *http.Request) {
+	if span := spanFrom(ctx); span != nil {
+		req.Header.Set("traceparent", span.traceparent())
+	}
+}
+
+// spans queues finished spans for the exporter; nil while tracing is off
+var spans chan *traceSpan
+
+// Export batching: spans are sent every spanExportEvery or once spanBatchSize are
+// waiting; up to spanQueueSize wait, and more are dropped
+const (
+	spanExportEvery = 5 * time.Second
+	spanBatchSize   = 512
+	spanQueueSize   = 4096
+)
+
+// startTracing starts exporting spans when OTEL_EXPORTER_OTLP_ENDPOINT is set. It
+// returns a function that exports the spans still waiting and stops the exporter.
+func startTracing() func() {
+	if tracingConfig.Endpoint == "" {
+		return func() {}
+	}
+	spans = make(chan *traceSpan, spanQueueSize)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	slog.Info("Exporting traces", "endpoint", tracingConfig.Endpoint, "service", tracingConfig.ServiceName, "sample_ratio", tracingConfig.SampleRatio)
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(spanExportEvery)
+		defer ticker.Stop()
+		var batch []*traceSpan
+		for {
+			select {
+			case s := <-spans:
+				if batch = append(batch, s); len(batch) < spanBatchSize {
+					continue
+				}
+			case <-ticker.C:
+			case <-done:
+				// Take what was queued before stopping
+				for len(spans) > 0 {
+					batch = append(batch, <-spans)
+				}
+				exportSpans(batch)
+				return
+			}
+			exportSpans(batch)
+			batch = nil
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// exportSpans posts a batch of spans to the collector; failures are logged and the
+// batch is dropped
+func exportSpans(batch []*traceSpan) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(otlpTraces(batch))
+	if err != nil {
+		slog.Warn("Failed to encode spans", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tracingConfig.Endpoint+"/v1/traces", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("Failed to create span export request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range tracingConfig.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.Warn("Failed to export spans", "spans", len(batch), "error", err)
+		incCounter("tracker_trace_export_failures_total", nil, 1)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		slog.Warn("Collector refused spans", "spans", len(batch), "status", resp.StatusCode)
+		incCounter("tracker_trace_export_failures_total", nil, 1)
+		return
+	}
+	incCounter("tracker_trace_spans_exported_total", nil, float64(len(batch)))
+}
+
+// otlpTraces builds the OTLP/JSON request of an export, with IDs in hex and times in
+// Unix nanoseconds as the JSON encoding of the protocol has them
+func otlpTraces(batch []*traceSpan) map[string]any {
+	out := make([]map[string]any, 0, len(batch))
+	for _, s := range batch {
+		span := map[string]any{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+			"status":            map[string]any{"code": 1}, // Ok
+		}
+		if s.parentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != nil {
+			span["status"] = map[string]any{"code": 2, "message": s.err.Error()} // Error
+		}
+		out = append(out, span)
+	}
+	return map[string]any{"resourceSpans": []any{map[string]any{
+		"resource": map[string]any{"attributes": otlpAttributes(map[string]any{
+			"service.name": tracingConfig.ServiceName,
+		})},
+		"scopeSpans": []any{map[string]any{
+			"scope": map[string]any{"name": "bitcoin-tracker"},
+			"spans": out,
+		}},
+	}}}
+}
+
+// otlpAttributes converts span attributes to OTLP key-values
+func otlpAttributes(attrs map[string]any) []any {
+	out := make([]any, 0, len(attrs))
+	for key, v := range attrs {
+		var value map[string]any
+		switch v := v.(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]any{"key": key, "value": value})
+	}
+	return out
+}
+
+// withTracing serves each request in a server span, continuing the trace of an
+// incoming traceparent header
+func withTracing(next http.Handler) http.Handler {
+	if tracingConfig.Endpoint == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = context.WithValue(ctx, spanKey{}, parent)
+		}
+		ctx, span := startSpan(ctx, r.Method+" "+r.URL.Path, spanServer)
+		span.set("http.request.method", r.Method)
+		span.set("url.path", r.URL.Path)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		span.set("http.response.status_code", rec.status)
+		var err error
+		if rec.status >= 500 {
+			err = fmt.Errorf("%s", http.StatusText(rec.status))
+		}
+		span.finish(err)
+	})
+}
+
+// statusRecorder remembers the status code of a response for its span
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush implements http.Flusher for the price stream and gRPC
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// openSQL opens a database like sql.Open; with tracing on, the queries made within a
+// traced operation get spans of their own
+func openSQL(driverName, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil || tracingConfig.Endpoint == "" {
+		return db, err
+	}
+	d := db.Driver()
+	db.Close() // sql.Open hasn't connected yet
+	return sql.OpenDB(&tracedConnector{driver: d, dsn: dsn, system: driverName}), nil
+}
+
+// tracedConnector opens tracedConns to a database
+type tracedConnector struct {
+	driver driver.Driver
+	dsn    string
+	system string // db.system attribute, e.g. postgres
+}
+
+// Connect implements driver.Connector
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, system: c.system}, nil
+}
+
+// Driver implements driver.Connector
+func (c *tracedConnector) Driver() driver.Driver { return c.driver }
+
+// tracedConn records a span for every query and statement run through it within a
+// traced operation, delegating to the driver's connection
+type tracedConn struct {
+	driver.Conn
+	system string
+}
+
+// querySpan starts the span of a statement
+func (c *tracedConn) querySpan(ctx context.Context, query string) (context.Context, *traceSpan) {
+	return dbSpan(ctx, c.system, query)
+}
+
+// dbSpan starts the span of a statement run on a database of system, e.g. postgres,
+// within a traced operation; otherwise it returns ctx and a nil span
+func dbSpan(ctx context.Context, system, query string) (context.Context, *traceSpan) {
+	if spanFrom(ctx) == nil {
+		return ctx, nil
+	}
+	query = strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(query, " ")
+	ctx, span := startSpan(ctx, "db "+strings.ToLower(operation), spanClient)
+	span.set("db.system", system)
+	if len(query) > 2000 {
+		query = query[:2000] + "…"
+	}
+	span.set("db.statement", query)
+	return ctx, span
+}
+
+// QueryContext implements driver.QueryerContext
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := c.querySpan(ctx, query)
+	rows, err := q.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		span.finish(err)
+	}
+	return rows, err
+}
+
+// ExecContext implements driver.ExecerContext
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := c.querySpan(ctx, query)
+	result, err := e.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		span.finish(err)
+	}
+	return result, err
+}
+
+// PrepareContext implements driver.ConnPrepareContext
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// BeginTx implements driver.ConnBeginTx
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+// Ping implements driver.Pinger
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession implements driver.SessionResetter
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid implements driver.Validator
+func (c *tracedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue implements driver.NamedValueChecker, e.g. for pq's arrays
+func (c *tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
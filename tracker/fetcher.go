@@ -0,0 +1,162 @@
+package tracker
+
+import (
+	"context"       // Package for request cancellation
+	"encoding/json" // Package for decoding provider responses
+	"fmt"           // Package for formatted errors
+	"maps"          // Package for copying the ticker table
+	"net/http"      // Package for provider requests
+	"strconv"       // Package for parsing Retry-After
+	"strings"       // Package for building market identifiers
+	"time"          // Package for Retry-After hints
+)
+
+// defaultUserAgent names the tracker to providers, some of which throttle Go's default
+const defaultUserAgent = "bitcoin-tracker"
+
+// Fetcher makes the requests of the built-in sources
+// The daemon's reuses cached responses, waits for each provider's rate limit, counts
+// requests against the fetch budget, and names markets by PROVIDER_SYMBOLS and the
+// providers' listings. HTTPFetcher sends the requests as they are.
+type Fetcher interface {
+	// GetJSON sends req and decodes the JSON response into out; a response other than
+	// 200 is a *StatusError
+	GetJSON(ctx context.Context, req Request, out any) error
+	// Symbol returns provider's identifier for asset quoted in currency
+	Symbol(ctx context.Context, provider, asset, currency string) (string, error)
+}
+
+// Request is a GET request a source makes to its provider
+type Request struct {
+	Provider string      // Source name, e.g. "kraken"
+	Asset    string      // Asset the request is for, e.g. "bitcoin"
+	URL      string      // Full request URL
+	Header   http.Header // Headers the provider needs, such as an API key; may be nil
+}
+
+// HTTPFetcher sends requests with an HTTP client and names markets by DefaultSymbol
+type HTTPFetcher struct {
+	Client    *http.Client // Default http.DefaultClient
+	UserAgent string       // Default "bitcoin-tracker"
+}
+
+// GetJSON implements Fetcher
+func (f HTTPFetcher) GetJSON(ctx context.Context, r Request, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", defaultUserAgent)
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	for name, values := range r.Header {
+		req.Header[name] = values
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode, RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+	return nil
+}
+
+// Symbol implements Fetcher
+func (HTTPFetcher) Symbol(_ context.Context, provider, asset, currency string) (string, error) {
+	return DefaultSymbol(provider, asset, currency)
+}
+
+// StatusError is returned when a provider answers with a non-200 status
+// It carries the Retry-After hint so the retry policy can honor it.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // Zero when the response had no usable Retry-After header
+}
+
+// Error implements error
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API request failed with status: %d", e.StatusCode)
+}
+
+// ParseRetryAfter reads a Retry-After header given either as seconds or as an HTTP date
+func ParseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// tickers maps asset IDs to their ticker symbol, which the exchanges' market
+// identifiers are built from
+var tickers = map[string]string{
+	"bitcoin":  "BTC",
+	"ethereum": "ETH",
+}
+
+// Tickers returns the supported assets by ID with their ticker symbol
+func Tickers() map[string]string {
+	return maps.Clone(tickers)
+}
+
+// Ticker returns the ticker symbol of an asset
+func Ticker(asset string) (string, error) {
+	symbol, ok := tickers[asset]
+	if !ok {
+		return "", fmt.Errorf("asset %q not supported", asset)
+	}
+	return symbol, nil
+}
+
+// KrakenTicker returns Kraken's name for a ticker; Kraken calls Bitcoin "XBT"
+func KrakenTicker(ticker string) string {
+	if ticker == "BTC" {
+		return "XBT"
+	}
+	return ticker
+}
+
+// DefaultSymbol returns provider's identifier for asset quoted in currency by the
+// provider's naming rule, e.g. "BTC-USD" on Coinbase. CoinGecko takes the currency
+// separately and names the asset by its ID.
+func DefaultSymbol(provider, asset, currency string) (string, error) {
+	if provider == "coingecko" {
+		return asset, nil
+	}
+	ticker, err := Ticker(asset)
+	if err != nil {
+		return "", err
+	}
+	quote := strings.ToUpper(currency)
+	switch provider {
+	case "coinbase":
+		return ticker + "-" + quote, nil
+	case "binance":
+		if quote == "USD" {
+			quote = "USDT" // Binance has no USD market for most pairs
+		}
+		return ticker + quote, nil
+	case "kraken":
+		return KrakenTicker(ticker) + quote, nil
+	}
+	return "", fmt.Errorf("no symbol mapping for provider %q", provider)
+}
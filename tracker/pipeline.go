@@ -0,0 +1,131 @@
+package tracker
+
+import (
+	"context" // Package for cancellation and fetch deadlines
+	"errors"  // Package for combining failover errors
+	"fmt"     // Package for formatted errors
+	"time"    // Package for quote times
+)
+
+// Pipeline fetches prices from a failover list of sources and retries what failed
+// It is the fetch the daemon runs for every tick, and what a Tracker runs in-process.
+type Pipeline struct {
+	Sources []Source    // Providers in failover order
+	Fetcher Fetcher     // Makes the sources' requests
+	Retry   RetryPolicy // How currencies that failed are retried
+
+	// Attempt replaces the failover across Sources in each attempt, e.g. to ask every
+	// source and aggregate their prices; optional
+	Attempt func(ctx context.Context, asset string, currencies []string) (map[string]float64, map[string]string, map[string]time.Time, error)
+	// BeforeAttempt runs before every attempt, and its error ends the fetch, e.g. for
+	// an exhausted request budget; optional
+	BeforeAttempt func() error
+	// OnSourceError is called when a source fails for some currencies of asset, which
+	// are then asked of the next source; optional
+	OnSourceError func(source, asset string, currencies []string, err error)
+}
+
+// Failover tries each source in order until every currency is priced
+// A source that fails for some currencies keeps the prices it got, and only the failed
+// currencies are asked of the next source. It returns the prices along with the source
+// that supplied each one and when it was quoted; when currencies are still missing after
+// the last source, the error is a *PartialError naming them (wrapped when no currency
+// succeeded). Once ctx is done the remaining sources are skipped.
+func (p Pipeline) Failover(ctx context.Context, asset string, currencies []string) (map[string]float64, map[string]string, map[string]time.Time, error) {
+	prices := make(map[string]float64, len(currencies))
+	sources := make(map[string]string, len(currencies))
+	quoted := make(map[string]time.Time, len(currencies))
+	failed := make(map[string][]error)
+	pending := currencies
+	for _, source := range p.Sources {
+		if len(pending) == 0 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			for _, currency := range pending {
+				failed[currency] = append(failed[currency], fmt.Errorf("%s and later sources skipped: %w", source.Name(), err))
+			}
+			break
+		}
+
+		got, at, err := FetchQuotes(ctx, p.Fetcher, source, asset, pending)
+		var missing []string
+		for _, currency := range pending {
+			var cerr error
+			if price, ok := got[currency]; ok {
+				// Custom sources may not validate
+				if cerr = ValidatePrice(currency, price); cerr == nil {
+					prices[currency], sources[currency], quoted[currency] = price, source.Name(), at[currency]
+					continue
+				}
+			} else {
+				cerr = CurrencyError(err, currency)
+			}
+			if cerr == nil {
+				cerr = fmt.Errorf("no %s price returned", currency)
+			}
+			failed[currency] = append(failed[currency], fmt.Errorf("%s: %w", source.Name(), cerr))
+			missing = append(missing, currency)
+		}
+		if len(missing) > 0 && p.OnSourceError != nil {
+			p.OnSourceError(source.Name(), asset, missing, err)
+		}
+		pending = missing
+	}
+
+	if len(pending) == 0 {
+		return prices, sources, quoted, nil
+	}
+	partial := &PartialError{Failed: make(map[string]error, len(pending))}
+	for _, currency := range pending {
+		partial.Failed[currency] = errors.Join(failed[currency]...)
+	}
+	if len(prices) == 0 {
+		return nil, nil, nil, fmt.Errorf("all price sources failed: %w", partial)
+	}
+	return prices, sources, quoted, partial
+}
+
+// Fetch fetches every currency within ctx, retrying only the currencies that failed
+// It returns whatever was priced, with the source of each price and when it was
+// quoted; the error is a *PartialError when some currencies are still missing.
+func (p Pipeline) Fetch(ctx context.Context, asset string, currencies []string) (map[string]float64, map[string]string, map[string]time.Time, error) {
+	attempt := p.Attempt
+	if attempt == nil {
+		attempt = p.Failover
+	}
+
+	prices := make(map[string]float64, len(currencies))
+	sources := make(map[string]string, len(currencies))
+	quoted := make(map[string]time.Time, len(currencies))
+	pending := currencies
+	err := p.Retry.Do(ctx, func() error {
+		if p.BeforeAttempt != nil {
+			if err := p.BeforeAttempt(); err != nil {
+				return err
+			}
+		}
+
+		got, from, at, err := attempt(ctx, asset, pending)
+		var missing []string
+		for _, currency := range pending {
+			if price, ok := got[currency]; ok {
+				prices[currency], sources[currency], quoted[currency] = price, from[currency], at[currency]
+			} else {
+				missing = append(missing, currency)
+			}
+		}
+		pending = missing
+		return err
+	})
+	if err == nil || len(prices) == 0 {
+		return prices, sources, quoted, err
+	}
+
+	// Keep the last error of each currency that never succeeded
+	partial := &PartialError{Failed: make(map[string]error, len(pending))}
+	for _, currency := range pending {
+		partial.Failed[currency] = CurrencyError(err, currency)
+	}
+	return prices, sources, quoted, partial
+}
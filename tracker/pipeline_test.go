@@ -0,0 +1,123 @@
+package tracker
+
+import (
+	"context"  // Package for fetch contexts
+	"errors"   // Package for inspecting fetch errors
+	"net/http" // Package for status codes
+	"testing"  // Package for the tests
+	"time"     // Package for retry delays
+)
+
+// stubSource returns fixed prices, failing the other currencies with err
+type stubSource struct {
+	name   string
+	prices map[string]float64
+	err    error
+}
+
+func (s *stubSource) Name() string { return s.name }
+
+func (s *stubSource) FetchPrices(_ context.Context, _ Fetcher, _ string, currencies []string) (map[string]float64, error) {
+	prices := make(map[string]float64)
+	failed := make(map[string]error)
+	for _, currency := range currencies {
+		if price, ok := s.prices[currency]; ok {
+			prices[currency] = price
+		} else {
+			failed[currency] = s.err
+		}
+	}
+	return PartialResult(prices, failed)
+}
+
+func TestFailoverAsksNextSourceForMissingCurrencies(t *testing.T) {
+	primary := &stubSource{name: "primary", prices: map[string]float64{"usd": 100, "gbp": -1}, err: &StatusError{StatusCode: http.StatusBadGateway}}
+	backup := &stubSource{name: "backup", prices: map[string]float64{"eur": 90, "gbp": 80}}
+	p := Pipeline{Sources: []Source{primary, backup}, Fetcher: HTTPFetcher{}}
+
+	prices, sources, _, err := p.Failover(context.Background(), "bitcoin", []string{"usd", "eur", "gbp", "jpy"})
+	want := map[string]float64{"usd": 100, "eur": 90, "gbp": 80}
+	for currency, price := range want {
+		if prices[currency] != price {
+			t.Errorf("%s price = %v, want %v", currency, prices[currency], price)
+		}
+	}
+	if sources["usd"] != "primary" || sources["eur"] != "backup" || sources["gbp"] != "backup" {
+		t.Errorf("sources = %v, want usd from primary and the rest from backup", sources)
+	}
+
+	var partial *PartialError
+	if !errors.As(err, &partial) || len(partial.Failed) != 1 || partial.Failed["jpy"] == nil {
+		t.Fatalf("err = %v, want a *PartialError for jpy alone", err)
+	}
+}
+
+func TestFetchRetriesOnlyFailedCurrencies(t *testing.T) {
+	source := &stubSource{name: "flaky", prices: map[string]float64{"usd": 100}, err: &StatusError{StatusCode: http.StatusServiceUnavailable}}
+	p := Pipeline{
+		Sources: []Source{source},
+		Fetcher: HTTPFetcher{},
+		Retry:   RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}
+	var retried [][]string
+	p.Attempt = func(ctx context.Context, asset string, currencies []string) (map[string]float64, map[string]string, map[string]time.Time, error) {
+		retried = append(retried, currencies)
+		return p.Failover(ctx, asset, currencies)
+	}
+
+	prices, _, _, err := p.Fetch(context.Background(), "bitcoin", []string{"usd", "eur"})
+	if prices["usd"] != 100 {
+		t.Errorf("usd price = %v, want 100", prices["usd"])
+	}
+	if len(retried) != 3 || len(retried[1]) != 1 || retried[1][0] != "eur" {
+		t.Errorf("attempts asked for %v, want usd and eur, then eur twice", retried)
+	}
+	var partial *PartialError
+	if !errors.As(err, &partial) || partial.Failed["eur"] == nil {
+		t.Errorf("err = %v, want a *PartialError for eur", err)
+	}
+}
+
+func TestRetryStopsOnClientErrorsAndPermanentErrors(t *testing.T) {
+	quota := errors.New("quota exhausted")
+	p := RetryPolicy{MaxAttempts: 5, Permanent: func(err error) bool { return errors.Is(err, quota) }}
+	for _, failure := range []error{&StatusError{StatusCode: http.StatusNotFound}, quota} {
+		calls := 0
+		err := p.Do(context.Background(), func() error {
+			calls++
+			return failure
+		})
+		if calls != 1 || !errors.Is(err, failure) {
+			t.Errorf("%v: %d calls, err %v; want 1 call returning it", failure, calls, err)
+		}
+	}
+}
+
+func TestRetryGivesUpWhenRetryAfterExceedsMaxDelay(t *testing.T) {
+	var reason error
+	p := RetryPolicy{MaxAttempts: 3, MaxDelay: time.Second, OnGiveUp: func(_ int, _ time.Duration, r error) { reason = r }}
+	calls := 0
+	p.Do(context.Background(), func() error {
+		calls++
+		return &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}
+	})
+	if calls != 1 || !errors.Is(reason, ErrRetryAfterTooLong) {
+		t.Errorf("%d calls, gave up with %v; want 1 call and ErrRetryAfterTooLong", calls, reason)
+	}
+}
+
+func TestDefaultSymbol(t *testing.T) {
+	tests := []struct{ provider, asset, currency, want string }{
+		{"coingecko", "bitcoin", "", "bitcoin"},
+		{"coinbase", "bitcoin", "eur", "BTC-EUR"},
+		{"binance", "bitcoin", "usd", "BTCUSDT"},
+		{"kraken", "bitcoin", "usd", "XBTUSD"},
+		{"kraken", "ethereum", "eur", "ETHEUR"},
+	}
+	for _, tt := range tests {
+		got, err := DefaultSymbol(tt.provider, tt.asset, tt.currency)
+		if err != nil || got != tt.want {
+			t.Errorf("DefaultSymbol(%q, %q, %q) = %q, %v; want %q", tt.provider, tt.asset, tt.currency, got, err, tt.want)
+		}
+	}
+}
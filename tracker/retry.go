@@ -0,0 +1,135 @@
+package tracker
+
+import (
+	"context"   // Package for the fetch deadline
+	"errors"    // Package for inspecting wrapped errors
+	"math/rand" // Package for jitter
+	"net/http"  // Package for HTTP status codes
+	"time"      // Package for delays
+)
+
+// Reasons retrying stops before MaxAttempts, passed to RetryPolicy.OnGiveUp
+var (
+	ErrRetryAfterTooLong = errors.New("provider asked to retry later than MaxDelay")
+	ErrRetryPastDeadline = errors.New("retry would pass the deadline")
+)
+
+// RetryPolicy controls how failed fetches are retried within one fetch
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts including the first one
+	BaseDelay   time.Duration // Delay before the first retry; doubles each attempt
+	MaxDelay    time.Duration // Upper bound on any single delay, including Retry-After
+	Jitter      float64       // Random +/- fraction applied to each delay (0-1)
+
+	// Permanent reports errors that won't go away by retrying besides client errors,
+	// such as an exhausted quota; optional
+	Permanent func(err error) bool
+	// OnRetry is called when attempt failed with err, before waiting delay; optional
+	OnRetry func(attempt int, delay time.Duration, err error)
+	// OnGiveUp is called when retrying stops early because the next wait, delay, is too
+	// long; reason is ErrRetryAfterTooLong or ErrRetryPastDeadline. Optional.
+	OnGiveUp func(attempt int, delay time.Duration, reason error)
+}
+
+// DefaultRetryPolicy returns the daemon's default policy: 3 attempts, 2s doubling up
+// to 1m, with 20% jitter
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, BaseDelay: 2 * time.Second, MaxDelay: time.Minute, Jitter: 0.2}
+}
+
+// Backoff returns the jittered exponential delay before retry number attempt (1-based)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay > p.MaxDelay || delay <= 0 { // delay <= 0 guards against shift overflow
+		delay = p.MaxDelay
+	}
+
+	// Spread retries from many instances so they don't hit the provider in lockstep
+	if p.Jitter > 0 {
+		factor := 1 + p.Jitter*(2*rand.Float64()-1)
+		delay = time.Duration(float64(delay) * factor)
+	}
+	return delay
+}
+
+// Retryable reports whether an error is worth retrying
+// Client errors other than 429 Too Many Requests will not go away by themselves, and
+// neither will the errors Permanent reports.
+func (p RetryPolicy) Retryable(err error) bool {
+	if p.Permanent != nil && p.Permanent(err) {
+		return false
+	}
+
+	// A partial failure is worth retrying when any failed currency is
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		for _, cerr := range partial.Failed {
+			if p.Retryable(cerr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// Do runs fn until it succeeds, fails permanently, or runs out of attempts
+// A Retry-After hint from the provider replaces the computed backoff; if it asks to
+// wait longer than MaxDelay, Do gives up and leaves it to the next fetch. Retrying also
+// stops once ctx is done or its deadline would pass during the delay.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	attempts := max(p.MaxAttempts, 1)
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			if errors.Is(err, ctx.Err()) {
+				return err
+			}
+			return errors.Join(err, ctx.Err())
+		}
+		if attempt == attempts || !p.Retryable(err) {
+			break
+		}
+
+		delay := p.Backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			if statusErr.RetryAfter > p.MaxDelay {
+				p.giveUp(attempt, statusErr.RetryAfter, ErrRetryAfterTooLong)
+				break
+			}
+			delay = statusErr.RetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			p.giveUp(attempt, delay, ErrRetryPastDeadline)
+			break
+		}
+
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, delay, err)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+	return err
+}
+
+// giveUp calls OnGiveUp when set
+func (p RetryPolicy) giveUp(attempt int, delay time.Duration, reason error) {
+	if p.OnGiveUp != nil {
+		p.OnGiveUp(attempt, delay, reason)
+	}
+}
@@ -0,0 +1,358 @@
+package tracker
+
+import (
+	"context"  // Package for request cancellation
+	"errors"   // Package for finding a currency's error
+	"fmt"      // Package for formatted errors
+	"net/http" // Package for API key headers
+	"slices"   // Package for sorting failed currencies
+	"strconv"  // Package for parsing string-encoded prices
+	"strings"  // Package for string manipulation
+	"time"     // Package for quote times
+)
+
+// Source is a price provider
+// FetchPrices returns the asset's price in each requested currency, keyed by lowercase
+// currency code, making its requests through f. When only some currencies fail, it
+// returns the prices it got together with a *PartialError naming the failed currencies.
+type Source interface {
+	Name() string
+	FetchPrices(ctx context.Context, f Fetcher, asset string, currencies []string) (map[string]float64, error)
+}
+
+// QuotingSource is a Source whose responses say when the provider quoted each price
+// FetchQuotes is FetchPrices that also returns those times, by currency.
+type QuotingSource interface {
+	Source
+	FetchQuotes(ctx context.Context, f Fetcher, asset string, currencies []string) (map[string]float64, map[string]time.Time, error)
+}
+
+// FetchQuotes fetches prices from a source along with when each was quoted
+// Prices from sources that don't say count as quoted when the response arrived.
+func FetchQuotes(ctx context.Context, f Fetcher, source Source, asset string, currencies []string) (map[string]float64, map[string]time.Time, error) {
+	if qs, ok := source.(QuotingSource); ok {
+		return qs.FetchQuotes(ctx, f, asset, currencies)
+	}
+	prices, err := source.FetchPrices(ctx, f, asset, currencies)
+	now := time.Now()
+	quoted := make(map[string]time.Time, len(prices))
+	for currency := range prices {
+		quoted[currency] = now
+	}
+	return prices, quoted, err
+}
+
+// SourceNamed returns the built-in source with a name as used in PRICE_SOURCES:
+// coingecko, coinbase, binance, or kraken
+func SourceNamed(name string) (Source, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "coingecko":
+		return CoinGecko(""), nil
+	case "coinbase":
+		return Coinbase(), nil
+	case "binance":
+		return Binance(), nil
+	case "kraken":
+		return Kraken(), nil
+	}
+	return nil, fmt.Errorf("unknown price source %q (expected coingecko, coinbase, binance, or kraken)", name)
+}
+
+// PartialError lists the currencies a fetch couldn't price and why
+// It accompanies the prices of the currencies that did succeed.
+type PartialError struct {
+	Failed map[string]error // Currency -> error
+}
+
+// Error implements error
+func (e *PartialError) Error() string {
+	currencies := make([]string, 0, len(e.Failed))
+	for currency := range e.Failed {
+		currencies = append(currencies, currency)
+	}
+	slices.Sort(currencies)
+	parts := make([]string, len(currencies))
+	for i, currency := range currencies {
+		parts[i] = currency + ": " + e.Failed[currency].Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Unwrap lets errors.Is and errors.As see every currency's error
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// CurrencyError returns the error of one currency: its entry in a *PartialError, or
+// err itself when it applies to every currency
+func CurrencyError(err error, currency string) error {
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		if cerr, ok := partial.Failed[currency]; ok {
+			return cerr
+		}
+	}
+	return err
+}
+
+// PartialResult returns prices, with a *PartialError when any currency failed
+func PartialResult(prices map[string]float64, failed map[string]error) (map[string]float64, error) {
+	if len(failed) == 0 {
+		return prices, nil
+	}
+	return prices, &PartialError{Failed: failed}
+}
+
+// ValidatePrice rejects zero, negative, and unparseable prices
+func ValidatePrice(currency string, price float64) error {
+	if price <= 0 {
+		return fmt.Errorf("invalid %s price received: %f", currency, price)
+	}
+	return nil
+}
+
+// FetchEach prices each currency with its own request; a failed currency doesn't stop
+// the others. Once ctx is done the remaining currencies fail with its error.
+func FetchEach(ctx context.Context, currencies []string, fetch func(currency string) (float64, error)) (map[string]float64, error) {
+	prices := make(map[string]float64, len(currencies))
+	failed := make(map[string]error)
+	for _, currency := range currencies {
+		if err := ctx.Err(); err != nil {
+			failed[currency] = err
+			continue
+		}
+		price, err := fetch(currency)
+		if err == nil {
+			err = ValidatePrice(currency, price)
+		}
+		if err != nil {
+			failed[currency] = err
+			continue
+		}
+		prices[currency] = price
+	}
+	return PartialResult(prices, failed)
+}
+
+// CoinGeckoAPI is the optional CoinGecko API key and the plan it belongs to
+type CoinGeckoAPI struct {
+	Key  string // Empty for the keyless public API
+	Plan string // "public", "demo", or "pro"
+}
+
+// BaseURL returns the API root for the plan; Pro keys only work on the Pro host
+func (api CoinGeckoAPI) BaseURL() string {
+	if api.Plan == "pro" {
+		return "https://pro-api.coingecko.com/api/v3"
+	}
+	return "https://api.coingecko.com/api/v3"
+}
+
+// Authorize adds the API key header for the plan, if a key is configured
+func (api CoinGeckoAPI) Authorize(header http.Header) {
+	switch api.Plan {
+	case "demo":
+		header.Set("x-cg-demo-api-key", api.Key)
+	case "pro":
+		header.Set("x-cg-pro-api-key", api.Key)
+	}
+}
+
+// MarketData is the market-wide figures CoinGecko returns alongside a price
+type MarketData struct {
+	Volume    float64 // 24h trading volume
+	MarketCap float64 // Market capitalization
+}
+
+// CoinGeckoSource fetches prices from CoinGecko's simple/price endpoint
+// A single request covers every currency.
+type CoinGeckoSource struct {
+	API CoinGeckoAPI
+	// MarketData, when set, also asks for the 24h volume and market cap, which cost no
+	// extra request, and is called with them by currency
+	MarketData func(asset string, data map[string]MarketData)
+}
+
+// CoinGecko returns the CoinGecko source, using a Demo API key when one is given
+// Pro keys are set with CoinGeckoSource{API: CoinGeckoAPI{Key: key, Plan: "pro"}}.
+func CoinGecko(apiKey string) Source {
+	api := CoinGeckoAPI{Key: apiKey, Plan: "public"}
+	if apiKey != "" {
+		api.Plan = "demo"
+	}
+	return CoinGeckoSource{API: api}
+}
+
+// Name implements Source
+func (CoinGeckoSource) Name() string { return "coingecko" }
+
+// FetchPrices implements Source
+func (s CoinGeckoSource) FetchPrices(ctx context.Context, f Fetcher, asset string, currencies []string) (map[string]float64, error) {
+	prices, _, err := s.FetchQuotes(ctx, f, asset, currencies)
+	return prices, err
+}
+
+// FetchQuotes implements QuotingSource
+// CoinGecko caches prices for up to a minute or two, so its last_updated_at is often
+// well before the request.
+func (s CoinGeckoSource) FetchQuotes(ctx context.Context, f Fetcher, asset string, currencies []string) (map[string]float64, map[string]time.Time, error) {
+	coin, err := f.Symbol(ctx, s.Name(), asset, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// vs_currencies accepts a comma-separated list; the response maps to the JSON format:
+	// {"bitcoin": {"usd": 43250.75, "eur": 39810.12, "last_updated_at": 1711356300}}
+	url := s.API.BaseURL() + "/simple/price?ids=" + coin +
+		"&vs_currencies=" + strings.Join(currencies, ",") + "&include_last_updated_at=true"
+	if s.MarketData != nil {
+		// Adds "usd_24h_vol" and "usd_market_cap" next to each price
+		url += "&include_24hr_vol=true&include_market_cap=true"
+	}
+	header := http.Header{}
+	s.API.Authorize(header)
+
+	var data map[string]map[string]float64
+	if err := f.GetJSON(ctx, Request{Provider: s.Name(), Asset: asset, URL: url, Header: header}, &data); err != nil {
+		return nil, nil, err
+	}
+	at := time.Now()
+	if updated := data[coin]["last_updated_at"]; updated > 0 {
+		at = time.Unix(int64(updated), 0)
+	}
+
+	prices := make(map[string]float64, len(currencies))
+	quoted := make(map[string]time.Time, len(currencies))
+	failed := make(map[string]error)
+	for _, currency := range currencies {
+		price := data[coin][currency]
+		if err := ValidatePrice(currency, price); err != nil {
+			failed[currency] = err
+			continue
+		}
+		prices[currency], quoted[currency] = price, at
+	}
+	if s.MarketData != nil {
+		market := make(map[string]MarketData, len(prices))
+		for currency := range prices {
+			market[currency] = MarketData{
+				Volume:    data[coin][currency+"_24h_vol"],
+				MarketCap: data[coin][currency+"_market_cap"],
+			}
+		}
+		s.MarketData(asset, market)
+	}
+	prices, err = PartialResult(prices, failed)
+	return prices, quoted, err
+}
+
+// coinbaseSource fetches spot prices from the Coinbase public API
+// One request is made per currency.
+type coinbaseSource struct{}
+
+// Coinbase returns the Coinbase source
+func Coinbase() Source { return coinbaseSource{} }
+
+// Name implements Source
+func (coinbaseSource) Name() string { return "coinbase" }
+
+// FetchPrices implements Source
+func (s coinbaseSource) FetchPrices(ctx context.Context, f Fetcher, asset string, currencies []string) (map[string]float64, error) {
+	return FetchEach(ctx, currencies, func(currency string) (float64, error) {
+		product, err := f.Symbol(ctx, s.Name(), asset, currency)
+		if err != nil {
+			return 0, err
+		}
+
+		// Response format: {"data": {"amount": "43250.75", "base": "BTC", "currency": "USD"}}
+		url := "https://api.coinbase.com/v2/prices/" + product + "/spot"
+		var data struct {
+			Data struct {
+				Amount string `json:"amount"`
+			} `json:"data"`
+		}
+		if err := f.GetJSON(ctx, Request{Provider: s.Name(), Asset: asset, URL: url}, &data); err != nil {
+			return 0, err
+		}
+		price, _ := strconv.ParseFloat(data.Data.Amount, 64)
+		return price, nil
+	})
+}
+
+// binanceSource fetches last-trade prices from the Binance public API
+// Binance has no USD market for most pairs, so USD is quoted via USDT (see DefaultSymbol).
+type binanceSource struct{}
+
+// Binance returns the Binance source
+func Binance() Source { return binanceSource{} }
+
+// Name implements Source
+func (binanceSource) Name() string { return "binance" }
+
+// FetchPrices implements Source
+func (s binanceSource) FetchPrices(ctx context.Context, f Fetcher, asset string, currencies []string) (map[string]float64, error) {
+	return FetchEach(ctx, currencies, func(currency string) (float64, error) {
+		market, err := f.Symbol(ctx, s.Name(), asset, currency)
+		if err != nil {
+			return 0, err
+		}
+
+		// Response format: {"symbol": "BTCUSDT", "price": "43250.75000000"}
+		url := "https://api.binance.com/api/v3/ticker/price?symbol=" + market
+		var data struct {
+			Price string `json:"price"`
+		}
+		if err := f.GetJSON(ctx, Request{Provider: s.Name(), Asset: asset, URL: url}, &data); err != nil {
+			return 0, err
+		}
+		price, _ := strconv.ParseFloat(data.Price, 64)
+		return price, nil
+	})
+}
+
+// krakenSource fetches last-trade prices from the Kraken public API
+// Kraken calls Bitcoin "XBT" (see KrakenTicker).
+type krakenSource struct{}
+
+// Kraken returns the Kraken source
+func Kraken() Source { return krakenSource{} }
+
+// Name implements Source
+func (krakenSource) Name() string { return "kraken" }
+
+// FetchPrices implements Source
+func (s krakenSource) FetchPrices(ctx context.Context, f Fetcher, asset string, currencies []string) (map[string]float64, error) {
+	return FetchEach(ctx, currencies, func(currency string) (float64, error) {
+		pair, err := f.Symbol(ctx, s.Name(), asset, currency)
+		if err != nil {
+			return 0, err
+		}
+
+		// Response format: {"error": [], "result": {"XXBTZUSD": {"c": ["43250.7", "0.01"], ...}}}
+		// The result key is Kraken's internal pair name, so we take the only entry
+		url := "https://api.kraken.com/0/public/Ticker?pair=" + pair
+		var data struct {
+			Error  []string `json:"error"`
+			Result map[string]struct {
+				Close []string `json:"c"` // Last trade closed: [price, lot volume]
+			} `json:"result"`
+		}
+		if err := f.GetJSON(ctx, Request{Provider: s.Name(), Asset: asset, URL: url}, &data); err != nil {
+			return 0, err
+		}
+		if len(data.Error) > 0 {
+			return 0, fmt.Errorf("kraken error: %s", strings.Join(data.Error, "; "))
+		}
+		var price float64
+		for _, ticker := range data.Result {
+			if len(ticker.Close) > 0 {
+				price, _ = strconv.ParseFloat(ticker.Close[0], 64)
+			}
+		}
+		return price, nil
+	})
+}
@@ -0,0 +1,203 @@
+// Package tracker runs the Bitcoin Price Tracker's fetch pipeline inside a Go program.
+// Prices are fetched on an interval from a failover list of providers, validated, and
+// retried by the same Pipeline the daemon runs, and every tick is handed to callbacks
+// instead of being stored.
+//
+//	t := tracker.New(tracker.Config{Currencies: []string{"usd", "eur"}}).
+//		OnPrice(func(q tracker.Quote) { log.Printf("%s %.2f", q.Currency, q.Price) })
+//	err := t.Run(ctx)
+package tracker
+
+import (
+	"context"  // Package for cancellation and fetch deadlines
+	"fmt"      // Package for formatted errors
+	"net/http" // Package for the provider client
+	"strings"  // Package for normalizing currencies
+	"sync"     // Package for guarding the callbacks
+	"time"     // Package for intervals and timestamps
+)
+
+// Quote is one price from a fetch
+type Quote struct {
+	Asset     string    // Asset ID, e.g. "bitcoin"
+	Currency  string    // Fiat currency code, e.g. "usd"
+	Price     float64   // Price of one unit of Asset in Currency
+	Source    string    // Provider that supplied the price
+	Timestamp time.Time // When the provider quoted the price
+}
+
+// Config controls what a Tracker fetches and how; zero fields take the defaults
+type Config struct {
+	Asset       string        // Asset ID: "bitcoin" (default) or "ethereum"
+	Currencies  []string      // Currencies fetched on every tick; default usd
+	Sources     []Source      // Providers in failover order; default CoinGecko("")
+	Interval    time.Duration // Time between fetches; default 5m
+	Deadline    time.Duration // Bound on one fetch across retries and sources; default 2m, at most Interval
+	MaxAttempts int           // Attempts per fetch including the first; default 3
+	RetryDelay  time.Duration // Delay before the first retry, doubling each attempt; default 2s
+	HTTPClient  *http.Client  // Client for provider requests; default one with a 30s timeout
+	Fetcher     Fetcher       // Makes the provider requests; default an HTTPFetcher on HTTPClient
+}
+
+// Tracker fetches prices on an interval and calls its callbacks with them
+// Register callbacks before calling Run; they are called from Run's goroutine.
+type Tracker struct {
+	cfg      Config
+	pipeline Pipeline
+	err      error // Configuration error, returned by Run and Fetch
+
+	mu      sync.Mutex
+	onPrice []func(Quote)
+	onError []func(error)
+}
+
+// New returns a tracker for a configuration
+// An invalid configuration is reported by Run and Fetch, so calls can be chained.
+func New(cfg Config) *Tracker {
+	t := &Tracker{}
+	t.cfg, t.err = cfg.withDefaults()
+	t.pipeline = Pipeline{Sources: t.cfg.Sources, Fetcher: t.cfg.Fetcher, Retry: DefaultRetryPolicy()}
+	t.pipeline.Retry.MaxAttempts, t.pipeline.Retry.BaseDelay = t.cfg.MaxAttempts, t.cfg.RetryDelay
+	return t
+}
+
+// withDefaults validates the configuration and fills in the defaults
+func (c Config) withDefaults() (Config, error) {
+	if c.Asset == "" {
+		c.Asset = "bitcoin"
+	}
+	if _, err := Ticker(c.Asset); err != nil {
+		return c, err
+	}
+	if len(c.Currencies) == 0 {
+		c.Currencies = []string{"usd"}
+	}
+	currencies := make([]string, len(c.Currencies))
+	for i, currency := range c.Currencies {
+		if currencies[i] = strings.ToLower(strings.TrimSpace(currency)); currencies[i] == "" {
+			return c, fmt.Errorf("empty currency in Currencies")
+		}
+	}
+	c.Currencies = currencies
+	if len(c.Sources) == 0 {
+		c.Sources = []Source{CoinGecko("")}
+	}
+	if c.Interval == 0 {
+		c.Interval = 5 * time.Minute
+	}
+	if c.Interval < time.Second {
+		return c, fmt.Errorf("invalid Interval %s (must be at least 1s)", c.Interval)
+	}
+	if c.Deadline == 0 {
+		c.Deadline = 2 * time.Minute
+	}
+	c.Deadline = min(c.Deadline, c.Interval)
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = 3
+	}
+	if c.MaxAttempts < 1 || c.RetryDelay < 0 || c.Deadline < 0 {
+		return c, fmt.Errorf("MaxAttempts, RetryDelay, and Deadline must not be negative")
+	}
+	if c.RetryDelay == 0 {
+		c.RetryDelay = 2 * time.Second
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if c.Fetcher == nil {
+		c.Fetcher = HTTPFetcher{Client: c.HTTPClient}
+	}
+	return c, nil
+}
+
+// OnPrice registers a callback for every quote of every tick, in Currencies order
+func (t *Tracker) OnPrice(fn func(Quote)) *Tracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onPrice = append(t.onPrice, fn)
+	return t
+}
+
+// OnError registers a callback for fetches that failed, fully or for some currencies
+// (a *PartialError), and for callbacks that panicked
+func (t *Tracker) OnError(fn func(error)) *Tracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onError = append(t.onError, fn)
+	return t
+}
+
+// Run fetches prices now and then every Interval, calling the callbacks with each
+// tick, until ctx is cancelled. It returns nil then, or the configuration error.
+func (t *Tracker) Run(ctx context.Context) error {
+	if t.err != nil {
+		return t.err
+	}
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		quotes, err := t.Fetch(ctx)
+		if ctx.Err() != nil {
+			return nil // Cancelled mid-fetch; the partial tick is dropped
+		}
+		t.dispatch(quotes, err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Fetch fetches the current prices once, without calling the callbacks
+// Currencies that still fail after the retries are named in a *PartialError returned
+// with the quotes of the others.
+func (t *Tracker) Fetch(ctx context.Context) ([]Quote, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.Deadline)
+	defer cancel()
+
+	prices, sources, quoted, err := t.pipeline.Fetch(ctx, t.cfg.Asset, t.cfg.Currencies)
+	quotes := make([]Quote, 0, len(prices))
+	for _, currency := range t.cfg.Currencies {
+		if price, ok := prices[currency]; ok {
+			quotes = append(quotes, Quote{Asset: t.cfg.Asset, Currency: currency, Price: price, Source: sources[currency], Timestamp: quoted[currency]})
+		}
+	}
+	return quotes, err
+}
+
+// dispatch calls the callbacks with one tick; a panicking callback is reported to the
+// error callbacks rather than stopping Run
+func (t *Tracker) dispatch(quotes []Quote, err error) {
+	t.mu.Lock()
+	onPrice, onError := t.onPrice, t.onError
+	t.mu.Unlock()
+
+	report := func(err error) {
+		for _, fn := range onError {
+			func() {
+				defer func() { recover() }() // An error callback has no one left to report to
+				fn(err)
+			}()
+		}
+	}
+	if err != nil {
+		report(err)
+	}
+	for _, q := range quotes {
+		for _, fn := range onPrice {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						report(fmt.Errorf("OnPrice callback panicked on %s: %v", q.Currency, r))
+					}
+				}()
+				fn(q)
+			}()
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"      // Package for the store queries and price lookups
+	"encoding/csv" // Package for importing trades
+	"errors"       // Package for the end of the import file
+	"fmt"          // Package for formatted I/O operations
+	"io"           // Package for reading the import file
+	"log/slog"     // Package for structured logging
+	"os"           // Package for the import file
+	"slices"       // Package for matching column names
+	"strconv"      // Package for parsing quantities and amounts
+	"strings"      // Package for string manipulation
+	"time"         // Package for trade times and tax years
+)
+
+// Trades are the buys and sells of an exchange account or wallet, entered one by one or
+// imported from a CSV export. Unlike portfolio holdings, which are sold first in, first
+// out as sales are recorded, trades are matched when a report is written, so the same
+// trades can be reported first in, first out or last in, first out. A trade without an
+// amount is valued at the stored bitcoin price of its time (see price-at).
+
+// Trade sides
+const (
+	tradeBuy  = "buy"
+	tradeSell = "sell"
+)
+
+// Lot matching methods: which of the units held a sale takes first
+const (
+	matchFIFO = "fifo" // The oldest units first
+	matchLIFO = "lifo" // The newest units bought on or before the sale first
+)
+
+// Trade is a buy or sell of an asset, e.g. 0.5 BTC bought for 14,200 USD
+type Trade struct {
+	ID       int       `json:"id"`       // Primary key (auto-increment)
+	Side     string    `json:"side"`     // buy or sell
+	Asset    string    `json:"asset"`    // Asset ID, e.g. "bitcoin"
+	Quantity float64   `json:"quantity"` // Units bought or sold
+	Amount   float64   `json:"amount"`   // Total paid or received, before fees; 0 values it at the stored price
+	Fee      float64   `json:"fee"`      // Fee paid; added to the cost of a buy, taken from the proceeds of a sell
+	Currency string    `json:"currency"` // Fiat currency of amount and fee
+	Traded   time.Time `json:"traded"`   // When the trade was made
+	Note     string    `json:"note"`     // Free text, e.g. the exchange or an order ID
+}
+
+// parseMatchMethod parses a lot matching method: fifo or lifo
+func parseMatchMethod(v string) (string, error) {
+	switch m := strings.ToLower(v); m {
+	case matchFIFO, matchLIFO:
+		return m, nil
+	}
+	return "", validationErrorf("invalid method %q (expected fifo or lifo)", v)
+}
+
+// parseTradeSide parses the side of a trade; "bought" and "sold" are accepted too, as
+// some exchanges export them
+func parseTradeSide(v string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "buy", "bought":
+		return tradeBuy, nil
+	case "sell", "sold":
+		return tradeSell, nil
+	}
+	return "", fmt.Errorf("invalid side %q (expected buy or sell)", v)
+}
+
+// parseTradeAmount parses an amount such as "14,200.50"; empty is 0
+func parseTradeAmount(name, v string) (float64, error) {
+	v = strings.ReplaceAll(strings.TrimSpace(v), ",", "")
+	if v == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return f, nil
+}
+
+// tradeValue returns what a trade was worth before fees: its amount, or else its
+// quantity at the stored price of its time
+func tradeValue(ctx context.Context, repo *Repository, t Trade) (float64, error) {
+	if t.Amount > 0 {
+		return t.Amount, nil
+	}
+	if t.Asset != "bitcoin" {
+		return 0, validationErrorf("trade #%d has no amount, and only bitcoin prices are stored to value it", t.ID)
+	}
+	p, err := lookupPriceAt(ctx, repo, t.Currency, t.Traded, true, defaultPriceAtMaxGap)
+	if errors.Is(err, errNoPriceAt) {
+		return 0, validationErrorf("trade #%d has no amount and no price is stored near %s; add its amount or backfill that day",
+			t.ID, t.Traded.In(displayLocation).Format("2006-01-02 15:04"))
+	}
+	if err != nil {
+		return 0, err
+	}
+	slog.Info("Valued trade at the stored price", "trade", t.ID, "traded", t.Traded.UTC().Format(time.RFC3339),
+		"price", p.Price, "method", p.Method, "currency", t.Currency)
+	return roundPrice(p.Price * t.Quantity), nil
+}
+
+// matchTrades replays trades oldest first and matches every sell against the buys of
+// its asset made on or before it, using method. The disposals' HoldingID is the ID of
+// the buy the units came from. Fees are added to the cost of buys and taken from the
+// proceeds of sells.
+func matchTrades(ctx context.Context, repo *Repository, trades []Trade, method string) ([]Disposal, error) {
+	var lots []Holding
+	var disposals []Disposal
+	for _, t := range trades {
+		value, err := tradeValue(ctx, repo, t)
+		if err != nil {
+			return nil, err
+		}
+		if t.Side == tradeBuy {
+			lots = append(lots, Holding{ID: t.ID, Asset: t.Asset, Quantity: t.Quantity, Cost: value + t.Fee, Currency: t.Currency, Acquired: t.Traded})
+			continue
+		}
+
+		sold, remaining, err := matchSale(lots, t.Asset, t.Quantity, max(value-t.Fee, 0), t.Currency, t.Traded, method)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match sell #%d: %w", t.ID, err)
+		}
+		disposals = append(disposals, sold...)
+		left := make(map[int]Holding, len(remaining))
+		for _, h := range remaining {
+			left[h.ID] = h
+		}
+		kept := lots[:0]
+		for _, h := range lots {
+			if r, ok := left[h.ID]; ok {
+				h = r
+			}
+			if h.Quantity > 0 {
+				kept = append(kept, h)
+			}
+		}
+		lots = kept
+	}
+	return disposals, nil
+}
+
+// tradeDisposals returns the disposals of the sells made in [from, to), matched with
+// method against every buy before them
+func tradeDisposals(ctx context.Context, repo *Repository, from, to time.Time, method string) ([]Disposal, error) {
+	trades, err := repo.Trades(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	disposals, err := matchTrades(ctx, repo, trades, method)
+	if err != nil {
+		return nil, err
+	}
+	var inRange []Disposal
+	for _, d := range disposals {
+		if !d.Disposed.Before(from) {
+			inRange = append(inRange, d)
+		}
+	}
+	return inRange, nil
+}
+
+// tradeColumns are the column names an import file may use, by field; the first row
+// must name the columns, in any order and case
+var tradeColumns = map[string][]string{
+	"time":     {"time", "date", "timestamp", "traded"},
+	"side":     {"side", "type"},
+	"asset":    {"asset", "coin"},
+	"quantity": {"quantity", "size"},
+	"amount":   {"amount", "total", "value"},
+	"fee":      {"fee", "fees"},
+	"currency": {"currency", "fiat"},
+	"note":     {"note", "notes", "description"},
+}
+
+// readTrades reads trades from CSV with a header row: time, side, and quantity are
+// required; asset defaults to bitcoin and currency to PORTFOLIO_CURRENCY
+func readTrades(r io.Reader) ([]Trade, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header row: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for field, names := range tradeColumns {
+			if _, seen := columns[field]; !seen && slices.Contains(names, name) {
+				columns[field] = i
+			}
+		}
+	}
+	for _, field := range []string{"time", "side", "quantity"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("no %s column (expected one of %s)", field, strings.Join(tradeColumns[field], ", "))
+		}
+	}
+
+	var trades []Trade
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read line %d: %w", line, err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		if strings.Join(row, "") == "" {
+			continue
+		}
+
+		t := Trade{Asset: "bitcoin", Currency: portfolioConfig.Currency, Note: field("note")}
+		if t.Traded, err = parsePriceTimeIn(field("time"), time.UTC); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if t.Side, err = parseTradeSide(field("side")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if v := field("asset"); v != "" {
+			if t.Asset, err = parseAsset(v); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		if t.Quantity, err = parseTradeAmount("quantity", field("quantity")); err != nil || t.Quantity <= quantityEpsilon {
+			return nil, fmt.Errorf("line %d: invalid quantity %q", line, field("quantity"))
+		}
+		if t.Amount, err = parseTradeAmount("amount", field("amount")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if t.Fee, err = parseTradeAmount("fee", field("fee")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if v := field("currency"); v != "" {
+			t.Currency = strings.ToLower(v)
+		}
+		trades = append(trades, t)
+	}
+	return trades, nil
+}
+
+// runTradesCommand handles the "trades" CLI command
+//
+//	trades add <buy|sell> <quantity> <asset> [--amount 14200] [--fee 5] [--currency usd] [--time 2023-06-01T12:00Z] [--note text]
+//	trades import <file.csv>
+//	trades list [year]
+//	trades delete <id>
+func runTradesCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "add":
+		fs := newFlagSet("trades add")
+		amount := fs.String("amount", "", "Total paid or received, before fees (default: the quantity at the stored price)")
+		fee := fs.String("fee", "", "Fee paid, in the trade's currency")
+		currency := fs.String("currency", portfolioConfig.Currency, "Fiat currency of amount and fee")
+		at := fs.String("time", "now", "When the trade was made, e.g. 2023-06-01T12:00Z")
+		note := fs.String("note", "", "Free text, e.g. the exchange or an order ID")
+		if len(args) < 4 {
+			if err := fs.Parse(args[1:]); err != nil {
+				return withKind(KindValidation, err)
+			}
+			return validationErrorf("usage: trades add <buy|sell> <quantity> <asset> [flags]")
+		}
+		if err := fs.Parse(args[4:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+
+		t := Trade{Currency: strings.ToLower(*currency), Note: *note, Traded: time.Now()}
+		var err error
+		if t.Side, err = parseTradeSide(args[1]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if t.Quantity, err = parseTradeAmount("quantity", args[2]); err != nil || t.Quantity <= quantityEpsilon {
+			return validationErrorf("invalid quantity %q", args[2])
+		}
+		if t.Asset, err = parseAsset(args[3]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if t.Amount, err = parseTradeAmount("amount", *amount); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if t.Fee, err = parseTradeAmount("fee", *fee); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if *at != "now" {
+			if t.Traded, err = parsePriceTime(*at); err != nil {
+				return err
+			}
+		}
+		if err := repo.SaveTrades(ctx, []Trade{t}); err != nil {
+			return err
+		}
+		slog.Info("Saved trade", "side", t.Side, "asset", t.Asset, "quantity", t.Quantity, "amount", t.Amount,
+			"fee", t.Fee, "currency", t.Currency, "traded", t.Traded.UTC().Format(time.RFC3339))
+
+	case "import":
+		if len(args) < 2 {
+			return validationErrorf("usage: trades import <file.csv>")
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to open trades file: %w", err)
+		}
+		defer f.Close()
+		trades, err := readTrades(f)
+		if err != nil {
+			return validationErrorf("invalid trades file %s: %v", args[1], err)
+		}
+		if err := repo.SaveTrades(ctx, trades); err != nil {
+			return err
+		}
+		slog.Info("Imported trades", "file", args[1], "trades", len(trades))
+
+	case "list":
+		trades, err := repo.Trades(ctx, time.Time{})
+		if err != nil {
+			return err
+		}
+		if len(args) > 1 {
+			year, err := strconv.Atoi(args[1])
+			if err != nil {
+				return validationErrorf("invalid year %q", args[1])
+			}
+			var inYear []Trade
+			for _, t := range trades {
+				if t.Traded.UTC().Year() == year {
+					inYear = append(inYear, t)
+				}
+			}
+			trades = inYear
+		}
+		if len(trades) == 0 {
+			slog.Info("No trades stored")
+			return nil
+		}
+
+		fmt.Printf("\n%-5s %-17s %-5s %-10s %14s %14s %10s %-8s %s\n", "ID", "Traded", "Side", "Asset", "Quantity", "Amount", "Fee", "Currency", "Note")
+		fmt.Println("----------------------------------------------------------------------------------------------------")
+		for _, t := range trades {
+			amount := "at price"
+			if t.Amount > 0 {
+				amount = fmt.Sprintf("%.2f", t.Amount)
+			}
+			fmt.Printf("%-5d %-17s %-5s %-10s %14.8g %14s %10.2f %-8s %s\n", t.ID, t.Traded.In(displayLocation).Format("2006-01-02 15:04"),
+				t.Side, t.Asset, t.Quantity, amount, t.Fee, strings.ToUpper(t.Currency), t.Note)
+		}
+		fmt.Println()
+
+	case "delete":
+		if len(args) < 2 {
+			return validationErrorf("usage: trades delete <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return validationErrorf("invalid trade id %q", args[1])
+		}
+		if err := repo.DeleteTrade(ctx, id); err != nil {
+			return err
+		}
+		slog.Info("Deleted trade", "id", id)
+
+	default:
+		return validationErrorf("unknown trades command: %s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"   // Package for cancelling the refresh loop
+	"fmt"       // Package for formatted I/O operations
+	"os"        // Package for the terminal and NO_COLOR
+	"os/signal" // Package for terminal resizes
+	"slices"    // Package for checking currencies
+	"strings"   // Package for building frames
+	"syscall"   // Package for the terminal size
+	"time"      // Package for the 24h window and polling
+	"unsafe"    // Package for the terminal size ioctl
+)
+
+// Terminal control sequences used by tui
+const (
+	tuiEnter     = "\x1b[?1049h\x1b[?25l" // Switch to the alternate screen and hide the cursor
+	tuiLeave     = "\x1b[?25h\x1b[?1049l" // Show the cursor and return to the normal screen
+	tuiHome      = "\x1b[H"               // Move to the top-left corner
+	tuiClearLine = "\x1b[K"               // Clear the rest of the line
+	tuiClearDown = "\x1b[J"               // Clear everything below the cursor
+	tuiGreen     = "\x1b[32m"
+	tuiRed       = "\x1b[31m"
+	tuiDim       = "\x1b[2m"
+	tuiReset     = "\x1b[0m"
+)
+
+// tuiRedrawInterval is how often the screen is redrawn without new prices, so the
+// 24h window and the clock move on
+const tuiRedrawInterval = time.Minute
+
+// terminalSize returns the columns and rows of the terminal f is attached to; false
+// when f is not a terminal
+func terminalSize(f *os.File) (int, int, bool) {
+	var ws struct{ Rows, Cols, X, Y uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.Cols == 0 || ws.Rows == 0 {
+		return 0, 0, false
+	}
+	return int(ws.Cols), int(ws.Rows), true
+}
+
+// tuiView is what one frame of the terminal dashboard shows
+type tuiView struct {
+	Currency string                // Currency of the chart and the records table
+	Stats    map[string]PriceStats // 24h statistics of every configured currency
+	Closes   []float64             // Closes of the chart's buckets, oldest first
+	Records  []PriceRecord         // Newest records of Currency, newest first
+	Now      time.Time
+	Poll     time.Duration
+	Color    bool
+}
+
+// loadTUIView reads the data of a frame; width sizes the chart and rows the table
+func loadTUIView(ctx context.Context, repo *Repository, currency string, width, rows int, now time.Time) (tuiView, error) {
+	view := tuiView{Currency: currency, Stats: make(map[string]PriceStats), Now: now}
+	from := now.Add(-24 * time.Hour)
+	for _, c := range currencies {
+		stats, err := computePriceStats(ctx, repo, c, from, now)
+		if err != nil {
+			return view, fmt.Errorf("failed to compute %s statistics: %w", strings.ToUpper(c), err)
+		}
+		view.Stats[c] = stats
+	}
+
+	prices, err := repo.PriceRange(currency, from, now, maxRangeLimit)
+	if err != nil {
+		return view, fmt.Errorf("failed to query prices: %w", err)
+	}
+	if len(prices) > 0 && width > 0 {
+		view.Closes = bucketCloses(prices, from, now, width)
+	}
+
+	if rows > 0 {
+		view.Records, err = repo.LatestPrices(ctx, rows, currency)
+		if err != nil {
+			return view, fmt.Errorf("failed to query the latest prices: %w", err)
+		}
+	}
+	return view, nil
+}
+
+// tuiLayout returns the width of the chart and the number of table rows that fit a
+// terminal of the given size
+func tuiLayout(width, height int) (chartWidth, tableRows int) {
+	chartWidth = max(width-4, 8)
+	tableRows = max(height-13, 0) // Header, ticker, chart, table header, and footer lines
+	return chartWidth, tableRows
+}
+
+// colorize wraps s in an ANSI color when colors are on
+func (v tuiView) colorize(color, s string) string {
+	if !v.Color {
+		return s
+	}
+	return color + s + tuiReset
+}
+
+// render draws the frame as lines of at most width columns
+func (v tuiView) render(width int) []string {
+	fit := func(s string) string {
+		if r := []rune(s); len(r) > width {
+			return string(r[:width])
+		}
+		return s
+	}
+	lines := []string{
+		fit(fmt.Sprintf(" Bitcoin Price Tracker — %s", v.Now.Format("2006-01-02 15:04:05 MST"))),
+		"",
+	}
+
+	// Ticker: every currency's latest price and 24h change, as many per line as fit
+	var line string
+	used := 0
+	for _, c := range currencies {
+		s := v.Stats[c]
+		entry := fmt.Sprintf(" %s %s", strings.ToUpper(c), "-")
+		change, color := "", ""
+		if s.Samples > 0 {
+			entry = fmt.Sprintf(" %s %s", strings.ToUpper(c), formatPrice(s.Last))
+			arrow, pct := "▲", s.ChangePct
+			color = tuiGreen
+			if pct < 0 {
+				arrow, color = "▼", tuiRed
+			}
+			change = fmt.Sprintf(" %s%+.2f%%", arrow, pct)
+		}
+		n := len([]rune(entry + change))
+		if used > 0 && used+n+2 > width {
+			lines = append(lines, line)
+			line, used = "", 0
+		}
+		if used > 0 {
+			line += "  "
+			used += 2
+		}
+		line += entry + v.colorize(color, change)
+		used += n
+	}
+	lines = append(lines, line, "")
+
+	// Chart of the selected currency's last 24 hours
+	s := v.Stats[v.Currency]
+	lines = append(lines, fit(fmt.Sprintf(" %s, last 24h", strings.ToUpper(v.Currency))))
+	if len(v.Closes) == 0 {
+		lines = append(lines, v.colorize(tuiDim, fit("   No prices in the last 24 hours")))
+	} else {
+		lines = append(lines, "   "+sparkline(v.Closes))
+	}
+	lines = append(lines, fit(fmt.Sprintf("   High %s  Low %s  Samples %d", formatPrice(s.Max), formatPrice(s.Min), s.Samples)), "")
+
+	// Newest records of the selected currency
+	lines = append(lines, fit(fmt.Sprintf(" %-7s %-14s %-12s %-19s", "ID", "Price", "Source", "Timestamp")))
+	for _, r := range v.Records {
+		source := r.Source
+		if r.Degraded {
+			source += "*"
+		}
+		if r.FXRate > 0 {
+			source += "†"
+		}
+		lines = append(lines, fit(fmt.Sprintf(" %-7d %-14s %-12s %-19s", r.ID, formatPrice(r.Price), source, r.Timestamp.In(displayLocation).Format("2006-01-02 15:04:05"))))
+	}
+
+	lines = append(lines, "", v.colorize(tuiDim, fit(fmt.Sprintf(" Checking for new prices every %s · Ctrl-C to quit", v.Poll))))
+	return lines
+}
+
+// runTUICommand handles "tui [currency] [--poll 5s]"
+// It shows a live dashboard of the stored prices on the terminal's alternate screen and
+// redraws it whenever a new price is stored, e.g. by a scheduler on the same database.
+func runTUICommand(ctx context.Context, repo *Repository, args []string) error {
+	currency := currencies[0]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		currency, args = strings.ToLower(args[0]), args[1:]
+	}
+	fs := newFlagSet("tui")
+	poll := fs.Duration("poll", 5*time.Second, "How often to check the database for new prices")
+	if err := fs.Parse(args); err != nil {
+		return withKind(KindValidation, err)
+	}
+	if !slices.Contains(currencies, currency) {
+		return validationErrorf("currency %q is not in CURRENCIES (%s)", currency, strings.Join(currencies, ","))
+	}
+	if *poll < time.Second {
+		return validationErrorf("--poll must be at least 1s")
+	}
+	if _, _, ok := terminalSize(os.Stdout); !ok {
+		return validationErrorf("tui needs a terminal; use display or export to print prices instead")
+	}
+
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	defer signal.Stop(resized)
+
+	fmt.Print(tuiEnter)
+	defer fmt.Print(tuiLeave)
+
+	pollTicker := time.NewTicker(*poll)
+	defer pollTicker.Stop()
+	redrawTicker := time.NewTicker(tuiRedrawInterval)
+	defer redrawTicker.Stop()
+
+	lastID := -1
+	for {
+		latest, err := repo.LatestPrices(ctx, 1, "")
+		if err != nil {
+			return err
+		}
+		id := 0
+		if len(latest) > 0 {
+			id = latest[0].ID
+		}
+
+		// Redraw on a new price, and on the resize and redraw cases below
+		if id != lastID {
+			lastID = id
+			if err := drawTUI(ctx, repo, currency, *poll); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-pollTicker.C:
+			continue
+		case <-resized:
+		case <-redrawTicker.C:
+		}
+		if err := drawTUI(ctx, repo, currency, *poll); err != nil {
+			return err
+		}
+	}
+}
+
+// drawTUI draws one frame sized to the terminal
+func drawTUI(ctx context.Context, repo *Repository, currency string, poll time.Duration) error {
+	width, height, ok := terminalSize(os.Stdout)
+	if !ok {
+		width, height = 80, 24
+	}
+	chartWidth, tableRows := tuiLayout(width, height)
+	view, err := loadTUIView(ctx, repo, currency, chartWidth, tableRows, time.Now())
+	if err != nil {
+		return err
+	}
+	view.Poll, view.Color = poll, os.Getenv("NO_COLOR") == ""
+
+	lines := view.render(width)
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	var b strings.Builder
+	b.WriteString(tuiHome)
+	for i, line := range lines {
+		b.WriteString(line + tuiClearLine)
+		if i < len(lines)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	b.WriteString(tuiClearDown)
+	_, err = os.Stdout.WriteString(b.String())
+	return err
+}
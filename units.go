@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"  // Package for fetching gold prices
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"net/url"  // Package for building provider queries
+	"os"       // Package for environment variables
+	"slices"   // Package for de-duplicating units
+	"sort"     // Package for ordering currencies
+	"strings"  // Package for string manipulation
+	"sync"     // Package for guarding the gold price cache
+	"time"     // Package for price ages
+)
+
+// Prices can also be told in units other than the currency they are quoted in: the
+// satoshis one unit of the currency buys, and the troy ounces of gold one bitcoin buys.
+// display, stats, and the daily summary report show them for the newest price with
+// --units or DERIVED_UNITS. The gold price comes from GOLD_PROVIDER, is fetched at most
+// once per GOLD_REFRESH, and is kept in fx_rates (base xau), so the last one is still
+// used for up to goldMaxAge while the provider fails.
+
+// Derived units
+const (
+	UnitSats = "sats" // Satoshis one unit of the currency buys
+	UnitGold = "oz"   // Troy ounces of gold one bitcoin buys
+)
+
+// derivedUnitAliases maps the accepted names of the derived units to the ones above
+var derivedUnitAliases = map[string]string{
+	"sats": UnitSats, "sat": UnitSats, "satoshi": UnitSats, "satoshis": UnitSats,
+	"oz": UnitGold, "ounces": UnitGold, "gold": UnitGold, "xau": UnitGold,
+}
+
+// goldMaxAge is how long the last gold price is used while GOLD_PROVIDER fails
+const goldMaxAge = 7 * 24 * time.Hour
+
+// GoldSource is implemented by every gold price provider
+// FetchGoldPrice returns the price of a troy ounce of gold in currency.
+type GoldSource interface {
+	Name() string
+	FetchGoldPrice(ctx context.Context, repo *Repository, currency string) (float64, error)
+}
+
+// availableGoldSources lists every built-in gold price provider by its config name
+var availableGoldSources = map[string]GoldSource{
+	"gold-api":      goldAPISource{},
+	"metalpriceapi": metalPriceAPISource{},
+}
+
+// UnitsConfig controls the derived units prices are shown in
+type UnitsConfig struct {
+	Units   []string      // Shown when no --units flag is given; empty shows none
+	Gold    GoldSource    // Gold price provider
+	APIKey  string        // Access key of providers that need one
+	Refresh time.Duration // How long a fetched gold price is used before it is fetched again
+}
+
+// unitsConfig is the active configuration, loaded at startup
+var unitsConfig = UnitsConfig{Gold: goldAPISource{}, Refresh: time.Hour}
+
+// loadUnitsConfig reads DERIVED_UNITS (e.g. "sats,oz"), GOLD_PROVIDER, GOLD_API_KEY,
+// and GOLD_REFRESH
+func loadUnitsConfig() (UnitsConfig, error) {
+	c := UnitsConfig{Gold: goldAPISource{}, APIKey: os.Getenv("GOLD_API_KEY"), Refresh: time.Hour}
+	units, err := parseDerivedUnits(os.Getenv("DERIVED_UNITS"))
+	if err != nil {
+		return c, fmt.Errorf("invalid DERIVED_UNITS: %w", err)
+	}
+	c.Units = units
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("GOLD_PROVIDER"))); v != "" {
+		source, ok := availableGoldSources[v]
+		if !ok {
+			return c, fmt.Errorf("unknown GOLD_PROVIDER %q (expected gold-api or metalpriceapi)", v)
+		}
+		c.Gold = source
+	}
+	if v := os.Getenv("GOLD_REFRESH"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return c, fmt.Errorf("invalid GOLD_REFRESH %q (expected a duration of at least 1m, e.g. 1h)", v)
+		}
+		c.Refresh = d
+	}
+	if _, ok := c.Gold.(metalPriceAPISource); ok && c.APIKey == "" && slices.Contains(c.Units, UnitGold) {
+		return c, fmt.Errorf("GOLD_PROVIDER=metalpriceapi needs GOLD_API_KEY")
+	}
+	return c, nil
+}
+
+// parseDerivedUnits parses a comma-separated list of derived units, e.g. "sats,gold"
+func parseDerivedUnits(v string) ([]string, error) {
+	var units []string
+	for _, name := range strings.Split(v, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		unit, ok := derivedUnitAliases[name]
+		if !ok {
+			return nil, validationErrorf("unknown unit %q (expected sats or oz)", name)
+		}
+		if !slices.Contains(units, unit) {
+			units = append(units, unit)
+		}
+	}
+	return units, nil
+}
+
+// unitsFlag parses a --units flag, falling back to DERIVED_UNITS when it wasn't given
+func unitsFlag(v string) ([]string, error) {
+	if v == "" {
+		return unitsConfig.Units, nil
+	}
+	units, err := parseDerivedUnits(v)
+	if err != nil {
+		return nil, withKind(KindValidation, fmt.Errorf("--units: %w", err))
+	}
+	return units, nil
+}
+
+// DerivedUnits is a Bitcoin price told in the derived units; a unit that wasn't asked
+// for, or couldn't be computed, is 0
+type DerivedUnits struct {
+	Currency  string  `json:"currency"`
+	Price     float64 `json:"price"`                // Bitcoin price in Currency
+	Sats      float64 `json:"sats,omitempty"`       // Satoshis one unit of Currency buys
+	GoldPrice float64 `json:"gold_price,omitempty"` // Price of a troy ounce of gold in Currency
+	Ounces    float64 `json:"gold_oz,omitempty"`    // Troy ounces of gold one bitcoin buys
+}
+
+// deriveUnits tells a Bitcoin price in currency in units. A gold price that can't be
+// had leaves Ounces out and is returned as the error, with the other units filled in.
+func deriveUnits(ctx context.Context, repo *Repository, currency string, price float64, units []string) (DerivedUnits, error) {
+	d := DerivedUnits{Currency: currency, Price: price}
+	if price <= 0 {
+		return d, nil
+	}
+	if slices.Contains(units, UnitSats) {
+		d.Sats = 1e8 / price
+	}
+	if slices.Contains(units, UnitGold) {
+		gold, err := currentGoldPrice(ctx, repo, currency)
+		if err != nil {
+			return d, err
+		}
+		d.GoldPrice, d.Ounces = gold, price/gold
+	}
+	return d, nil
+}
+
+// formatDerivedUnits renders the units of d that were computed, e.g. "1 USD = 1,538.46
+// sats · 1 BTC = 27.41 oz of gold (2,372.10 USD/oz)"; empty when none were
+func formatDerivedUnits(d DerivedUnits) string {
+	var parts []string
+	if d.Sats > 0 {
+		parts = append(parts, renderMessage(defaultLocale, "units.sats", d))
+	}
+	if d.Ounces > 0 {
+		parts = append(parts, renderMessage(defaultLocale, "units.gold", d))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// displayDerivedUnits prints the newest price of each currency in units, for the
+// display and stats commands
+func displayDerivedUnits(ctx context.Context, repo *Repository, latest map[string]float64, units []string) {
+	if len(units) == 0 || len(latest) == 0 {
+		return
+	}
+	names := make([]string, 0, len(latest))
+	for currency := range latest {
+		names = append(names, currency)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, currency := range names {
+		d, err := deriveUnits(ctx, repo, currency, latest[currency], units)
+		if err != nil {
+			slog.Warn("Failed to get the gold price", "currency", currency, "error", err)
+		}
+		if text := formatDerivedUnits(d); text != "" {
+			lines = append(lines, fmt.Sprintf("%-4s %s", strings.ToUpper(currency), text))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Println("In other units (newest price)")
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
+
+// goldPrices caches the newest gold price of each currency, as rates from xau
+var goldPrices = struct {
+	sync.Mutex
+	rates    map[string]FXRate
+	failedAt map[string]time.Time // Last failed fetch per currency
+}{rates: make(map[string]FXRate), failedAt: make(map[string]time.Time)}
+
+// currentGoldPrice returns the price of a troy ounce of gold in currency, fetching it
+// when the cached one is older than GOLD_REFRESH. While the provider fails, a price up
+// to goldMaxAge old is used, from the cache or else the database.
+func currentGoldPrice(ctx context.Context, repo *Repository, currency string) (float64, error) {
+	cfg := unitsConfig
+	goldPrices.Lock()
+	defer goldPrices.Unlock()
+
+	now := time.Now().UTC()
+	cached, ok := goldPrices.rates[currency]
+	if ok && now.Sub(cached.Timestamp) < cfg.Refresh {
+		return cached.Rate, nil
+	}
+
+	var err error
+	if now.Sub(goldPrices.failedAt[currency]) >= fxRetryDelay {
+		var price float64
+		price, err = cfg.Gold.FetchGoldPrice(ctx, repo, currency)
+		if err == nil && price <= 0 {
+			err = withKind(KindProvider, fmt.Errorf("%s returned an invalid gold price %g", cfg.Gold.Name(), price))
+		}
+		if err == nil {
+			r := FXRate{Base: "xau", Quote: currency, Rate: price, Source: cfg.Gold.Name(), Timestamp: now}
+			goldPrices.rates[currency] = r
+			delete(goldPrices.failedAt, currency)
+			slog.Info("Fetched gold price", "source", cfg.Gold.Name(), "currency", currency, "price", price)
+			// Relay mode has no database, and guarded ones take no writes; the price is only cached there
+			if repo != nil && writeMode == "" {
+				if serr := repo.SaveFXRates(ctx, []FXRate{r}); serr != nil {
+					slog.Error("Failed to save gold price", "error", serr)
+				}
+			}
+			return price, nil
+		}
+		err = withKind(KindProvider, fmt.Errorf("failed to fetch the gold price: %w", err))
+		incCounter("tracker_gold_failures_total", map[string]string{"source": cfg.Gold.Name()}, 1)
+		goldPrices.failedAt[currency] = now
+	} else {
+		err = withKind(KindProvider, fmt.Errorf("the gold price in %s failed to fetch less than %s ago", strings.ToUpper(currency), fxRetryDelay))
+	}
+
+	// After a restart the cache is empty, so fall back to the stored price
+	if repo != nil {
+		stored, serr := repo.LatestFXRates(ctx, "xau")
+		if serr != nil {
+			slog.Error("Failed to read stored gold prices", "error", serr)
+		}
+		for _, r := range stored {
+			if r.Quote == currency && (!ok || r.Timestamp.After(cached.Timestamp)) {
+				cached, ok = r, true
+				goldPrices.rates[currency] = r
+			}
+		}
+	}
+	if !ok || now.Sub(cached.Timestamp) > goldMaxAge {
+		return 0, err
+	}
+	slog.Warn("Using an earlier gold price", "currency", currency, "price", cached.Rate, "age", now.Sub(cached.Timestamp).Round(time.Minute))
+	return cached.Rate, nil
+}
+
+// goldAPISource fetches the spot gold price from gold-api.com
+// No key is needed, but prices are only quoted in US dollars.
+type goldAPISource struct{}
+
+// Name implements GoldSource
+func (goldAPISource) Name() string { return "gold-api" }
+
+// FetchGoldPrice implements GoldSource
+func (goldAPISource) FetchGoldPrice(ctx context.Context, repo *Repository, currency string) (float64, error) {
+	if currency != "usd" {
+		return 0, withKind(KindConfig, fmt.Errorf("gold-api quotes gold in USD only, not %s; use GOLD_PROVIDER=metalpriceapi", strings.ToUpper(currency)))
+	}
+	var result struct {
+		Price float64 `json:"price"`
+	}
+	if err := getJSON(ctx, repo, "gold-api", "gold", "https://api.gold-api.com/price/XAU", &result); err != nil {
+		return 0, err
+	}
+	return result.Price, nil
+}
+
+// metalPriceAPISource fetches gold prices in any currency from metalpriceapi.com, which
+// needs GOLD_API_KEY. Errors come back with success false, so they are checked in the body.
+type metalPriceAPISource struct{}
+
+// Name implements GoldSource
+func (metalPriceAPISource) Name() string { return "metalpriceapi" }
+
+// FetchGoldPrice implements GoldSource
+// The rate of XAU is the ounces one unit of the base currency buys.
+func (metalPriceAPISource) FetchGoldPrice(ctx context.Context, repo *Repository, currency string) (float64, error) {
+	var result struct {
+		Success bool               `json:"success"`
+		Rates   map[string]float64 `json:"rates"`
+		Error   struct {
+			Code int    `json:"statusCode"`
+			Info string `json:"message"`
+		} `json:"error"`
+	}
+	query := url.Values{"api_key": {unitsConfig.APIKey}, "base": {strings.ToUpper(currency)}, "currencies": {"XAU"}}
+	if err := getJSON(ctx, repo, "metalpriceapi", "gold", "https://api.metalpriceapi.com/v1/latest?"+query.Encode(), &result); err != nil {
+		return 0, err
+	}
+	if !result.Success {
+		return 0, withKind(KindProvider, fmt.Errorf("metalpriceapi error %d: %s", result.Error.Code, result.Error.Info))
+	}
+	ounces := result.Rates["XAU"]
+	if ounces <= 0 {
+		return 0, withKind(KindProvider, fmt.Errorf("metalpriceapi returned no gold rate for %s", strings.ToUpper(currency)))
+	}
+	return 1 / ounces, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"      // Package for formatted I/O operations
+	"log/slog" // Package for structured logging
+	"os"       // Package for environment variables
+	"strconv"  // Package for parsing numeric settings
+	"strings"  // Package for string manipulation
+	"time"     // Package for period boundaries
+)
+
+// Volatility regimes assigned to each weekly period
+const (
+	RegimeLow    = "low"
+	RegimeNormal = "normal"
+	RegimeHigh   = "high"
+)
+
+// VolatilityRegime is the classification of one weekly period for a currency
+type VolatilityRegime struct {
+	Currency    string    `json:"currency"`     // Fiat currency the prices are quoted in
+	PeriodStart time.Time `json:"period_start"` // Monday of the ISO week
+	StdDev      float64   `json:"stddev"`       // Standard deviation of log returns within the week
+	Percentile  float64   `json:"percentile"`   // Rank of StdDev among trailing weeks (0-100)
+	Regime      string    `json:"regime"`       // low, normal, or high
+	Samples     int       `json:"samples"`      // Number of returns the stddev is based on
+}
+
+// volatilityLookback is how many trailing weeks a period is ranked against
+const volatilityLookback = 52
+
+// volatilityMinHistory is how many weeks are needed before a period can be ranked
+// Until then every period is classified as normal
+const volatilityMinHistory = 4
+
+// volatilityThresholds returns the low/high percentile cut-offs
+// Configured via VOL_LOW_PERCENTILE and VOL_HIGH_PERCENTILE (defaults 25 and 75)
+func volatilityThresholds() (low, high float64) {
+	low, high = 25, 75
+	if v, err := strconv.ParseFloat(os.Getenv("VOL_LOW_PERCENTILE"), 64); err == nil {
+		low = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("VOL_HIGH_PERCENTILE"), 64); err == nil {
+		high = v
+	}
+	return low, high
+}
+
+// classifyVolatility ranks each period's stddev against the trailing lookback window
+// and assigns a regime from the configured percentile thresholds
+func classifyVolatility(periods []VolatilityRegime) {
+	low, high := volatilityThresholds()
+
+	for i := range periods {
+		start := i - volatilityLookback + 1
+		if start < 0 {
+			start = 0
+		}
+		window := periods[start : i+1]
+
+		if len(window) < volatilityMinHistory {
+			periods[i].Percentile = 50
+			periods[i].Regime = RegimeNormal
+			continue
+		}
+
+		// Percentile rank: share of trailing weeks at or below this week's stddev
+		atOrBelow := 0
+		for _, w := range window {
+			if w.StdDev <= periods[i].StdDev {
+				atOrBelow++
+			}
+		}
+		periods[i].Percentile = float64(atOrBelow) / float64(len(window)) * 100
+
+		switch {
+		case periods[i].Percentile <= low:
+			periods[i].Regime = RegimeLow
+		case periods[i].Percentile >= high:
+			periods[i].Regime = RegimeHigh
+		default:
+			periods[i].Regime = RegimeNormal
+		}
+	}
+}
+
+// updateVolatilityRegimes recomputes and stores the regimes for a currency
+func updateVolatilityRegimes(repo *Repository, currency string) error {
+	periods, err := repo.WeeklyVolatility(currency)
+	if err != nil {
+		return err
+	}
+	classifyVolatility(periods)
+	return repo.SaveVolatilityRegimes(periods)
+}
+
+// currentVolatilityRegime returns the regime of the current week for a currency
+// It falls back to "normal" when nothing has been classified yet
+func currentVolatilityRegime(repo *Repository, currency string) string {
+	regimes, err := repo.VolatilityRegimes(currency, 1)
+	if err != nil || len(regimes) == 0 {
+		return RegimeNormal
+	}
+	return regimes[0].Regime
+}
+
+// refreshVolatilityRegimes updates regimes for every configured currency
+// Failures are logged rather than returned so they never fail a fetch
+func refreshVolatilityRegimes(repo *Repository) {
+	for _, currency := range currencies {
+		if err := updateVolatilityRegimes(repo, currency); err != nil {
+			slog.Error("Failed to update volatility regimes", "currency", currency, "error", err)
+		}
+	}
+}
+
+// displayVolatilityRegimes prints the last 12 weekly regimes for a currency
+func displayVolatilityRegimes(repo *Repository, currency string) {
+	regimes, err := repo.VolatilityRegimes(currency, 12)
+	if err != nil {
+		slog.Error("Failed to fetch volatility regimes", "error", err)
+		return
+	}
+	if len(regimes) == 0 {
+		slog.Info("No volatility regimes computed yet")
+		return
+	}
+
+	fmt.Printf("\nWeekly volatility regimes (%s)\n", strings.ToUpper(currency))
+	fmt.Printf("%-12s %-10s %-12s %-8s %-8s\n", "Week", "Regime", "Stddev", "Pctl", "Samples")
+	fmt.Println("--------------------------------------------------")
+	for _, r := range regimes {
+		fmt.Printf("%-12s %-10s %-12.6f %-8.1f %-8d\n",
+			r.PeriodStart.Format("2006-01-02"), r.Regime, r.StdDev, r.Percentile, r.Samples)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"       // Package for delivery timeouts and the worker
+	"crypto/hmac"   // Package for payload signatures
+	"crypto/rand"   // Package for generating webhook secrets
+	"crypto/sha256" // Package for payload signatures
+	"encoding/hex"  // Package for encoding secrets and signatures
+	"encoding/json" // Package for payloads
+	"fmt"           // Package for formatted I/O operations
+	"io"            // Package for draining responses
+	"log/slog"      // Package for structured logging
+	"math"          // Package for threshold checks
+	"net/http"      // Package for delivering payloads
+	"net/url"       // Package for validating webhook URLs
+	"os"            // Package for environment variables
+	"slices"        // Package for checking currencies
+	"strconv"       // Package for parsing IDs and WEBHOOK_MAX_ATTEMPTS
+	"strings"       // Package for string manipulation
+	"time"          // Package for retries and timestamps
+)
+
+// Outgoing webhooks are URLs registered with the webhooks command. Each new sample is
+// queued for every webhook that wants it, as a row of webhooks_deliveries, and a worker
+// in the process recording prices POSTs the signed payload, retrying failed attempts
+// with a doubling delay. Queued payloads survive restarts.
+
+// States of a webhook delivery
+const (
+	webhookPending   = "pending"   // Waiting for its next attempt
+	webhookDelivered = "delivered" // Accepted with a 2xx response
+	webhookFailed    = "failed"    // Out of attempts, or refused with a 4xx response
+)
+
+// webhookPriceChanged is the payload type of webhooks with a threshold
+// Webhooks without one are sent price.recorded, like the event sinks.
+const webhookPriceChanged = "price.changed"
+
+// Webhook delivery settings that are not configurable
+const (
+	webhookPollInterval = 15 * time.Second // How often the queue is checked for due retries
+	webhookBatchSize    = 50               // Deliveries attempted per check
+	webhookMaxDelay     = time.Hour        // Longest wait between attempts
+	webhookSecretPrefix = "whsec_"
+)
+
+// Webhook is an outgoing webhook registered with "webhooks add"
+type Webhook struct {
+	ID        int
+	URL       string
+	Secret    string  // HMAC-SHA256 key of the payload signatures
+	Currency  string  // Currency sent; empty for every currency
+	Threshold float64 // Percent change since the last payload that sends one; 0 sends every sample
+	CreatedAt time.Time
+}
+
+// WebhookDelivery is one payload queued for a webhook
+type WebhookDelivery struct {
+	ID             int
+	WebhookID      int
+	URL            string // URL of the webhook, filled in by queries
+	Currency       string
+	Price          float64 // Price sent, the baseline of the webhook's threshold
+	Payload        string  // JSON body
+	Status         string  // One of the webhook delivery states
+	Attempts       int
+	ResponseStatus int    // HTTP status of the last attempt; 0 when none answered
+	Error          string // Why the last attempt failed
+	CreatedAt      time.Time
+	NextAttemptAt  time.Time
+	DeliveredAt    *time.Time
+
+	secret string // Secret of the webhook, filled in by DueWebhookDeliveries
+}
+
+// WebhookPayload is the JSON body POSTed to a webhook
+type WebhookPayload struct {
+	Type          string    `json:"type"` // price.recorded, or price.changed for webhooks with a threshold
+	WebhookID     int       `json:"webhook_id"`
+	Asset         string    `json:"asset"`
+	Currency      string    `json:"currency"`
+	Price         float64   `json:"price"`
+	PreviousPrice float64   `json:"previous_price,omitempty"` // Price of the webhook's last payload; omitted for the first
+	Change        float64   `json:"change_pct"`               // Percent change from PreviousPrice
+	Source        string    `json:"source"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// WebhookConfig controls the delivery of webhook payloads
+type WebhookConfig struct {
+	MaxAttempts int           // Attempts before a delivery fails
+	RetryDelay  time.Duration // Wait before the first retry, doubled for each one after
+	TTL         time.Duration // How long finished deliveries are kept
+}
+
+// webhookConfig is the active configuration, loaded at startup
+var webhookConfig = WebhookConfig{MaxAttempts: 5, RetryDelay: 30 * time.Second, TTL: 30 * 24 * time.Hour}
+
+// loadWebhookConfig reads WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_DELAY (e.g. 30s), and
+// WEBHOOK_DELIVERY_TTL (e.g. 30d)
+func loadWebhookConfig() (WebhookConfig, error) {
+	c := WebhookConfig{MaxAttempts: 5, RetryDelay: 30 * time.Second, TTL: 30 * 24 * time.Hour}
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %q (expected a positive number)", v)
+		}
+		c.MaxAttempts = n
+	}
+	if v := os.Getenv("WEBHOOK_RETRY_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c, fmt.Errorf("invalid WEBHOOK_RETRY_DELAY %q", v)
+		}
+		c.RetryDelay = d
+	}
+	if v := os.Getenv("WEBHOOK_DELIVERY_TTL"); v != "" {
+		d, err := parseStatsWindow(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid WEBHOOK_DELIVERY_TTL %q (expected e.g. 7d or 30d)", v)
+		}
+		c.TTL = d
+	}
+	return c, nil
+}
+
+// retryDelay returns the wait after a delivery's attempt-th failed attempt
+func (c WebhookConfig) retryDelay(attempt int) time.Duration {
+	d := c.RetryDelay
+	for i := 1; i < attempt && d < webhookMaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, webhookMaxDelay)
+}
+
+// generateWebhookSecret returns a new random signing secret
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
+
+// signWebhook returns the X-Webhook-Signature header of a payload sent at t: the
+// HMAC-SHA256 of "<unix seconds>.<body>" with the webhook's secret
+func signWebhook(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookHook queues the payloads of every new price; deliveries run in webhookDeliveries
+type webhookHook struct{}
+
+func init() { registerPriceHook(webhookHook{}) }
+
+// Name implements PriceHook
+func (webhookHook) Name() string { return "webhooks" }
+
+// OnPrice implements PriceHook
+// A webhook with a threshold is sent the price once it has moved at least that many
+// percent from the price of the webhook's last payload, and always its first one.
+func (webhookHook) OnPrice(ctx context.Context, repo *Repository, record PriceRecord) error {
+	webhooks, err := repo.Webhooks(ctx)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	queued := 0
+	for _, w := range webhooks {
+		if w.Currency != "" && w.Currency != record.Currency {
+			continue
+		}
+		payload := WebhookPayload{
+			Type: EventPriceRecorded, WebhookID: w.ID, Asset: "bitcoin", Currency: record.Currency,
+			Price: record.Price, Source: record.Source, Timestamp: record.Timestamp.UTC(),
+		}
+		previous, ok, err := repo.LastWebhookPrice(ctx, w.ID, record.Currency)
+		if err != nil {
+			return err
+		}
+		if ok {
+			payload.PreviousPrice, payload.Change = previous, percentChange(previous, record.Price)
+		}
+		if w.Threshold > 0 {
+			if ok && math.Abs(payload.Change) < w.Threshold {
+				continue
+			}
+			payload.Type = webhookPriceChanged
+		}
+
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode webhook payload: %w", err)
+		}
+		now := time.Now()
+		_, err = repo.QueueWebhookDelivery(ctx, WebhookDelivery{
+			WebhookID: w.ID, Currency: record.Currency, Price: record.Price, Payload: string(body),
+			Status: webhookPending, CreatedAt: now, NextAttemptAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		queued++
+	}
+	if queued > 0 {
+		webhookDeliveries.notify()
+	}
+	return nil
+}
+
+// webhookWorker delivers queued payloads in the background of a process recording prices
+type webhookWorker struct {
+	wake chan struct{} // Signalled when a payload is queued
+}
+
+// webhookDeliveries is the process-wide worker, started by the scheduler and stream
+var webhookDeliveries = &webhookWorker{wake: make(chan struct{}, 1)}
+
+// notify tells the worker a payload was queued
+func (w *webhookWorker) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default: // Already told
+	}
+}
+
+// start runs the worker in the background and returns a function that stops it
+func (w *webhookWorker) start(repo *Repository) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.loop(ctx, repo)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// loop delivers due payloads until ctx is cancelled, and removes expired deliveries
+// A standby leaves the queue to the primary.
+func (w *webhookWorker) loop(ctx context.Context, repo *Repository) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		if !daemon.isStandby() {
+			runRecovered("webhooks", func() error {
+				w.deliverDue(ctx, repo)
+				return nil
+			})
+			if n, err := repo.PruneWebhookDeliveries(ctx, time.Now().Add(-webhookConfig.TTL)); err != nil {
+				slog.Warn("Failed to prune webhook deliveries", "error", err)
+			} else if n > 0 {
+				slog.Info("Pruned webhook deliveries", "deliveries", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue attempts every payload whose next attempt is due, oldest first
+func (w *webhookWorker) deliverDue(ctx context.Context, repo *Repository) {
+	for ctx.Err() == nil {
+		due, err := repo.DueWebhookDeliveries(ctx, time.Now(), webhookBatchSize)
+		if err != nil {
+			slog.Error("Failed to query webhook deliveries", "error", err)
+			return
+		}
+		for _, d := range due {
+			if ctx.Err() != nil {
+				return
+			}
+			deliverWebhook(ctx, repo, d)
+		}
+		if len(due) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// deliverWebhook makes one attempt at a delivery and stores its outcome: delivered on a
+// 2xx response, failed on another 4xx (except 408 and 429) or after the last attempt,
+// and pending again with a doubled delay otherwise
+func deliverWebhook(ctx context.Context, repo *Repository, d WebhookDelivery) {
+	now := time.Now()
+	d.Attempts++
+	d.ResponseStatus, d.Error = 0, ""
+
+	status, err := postWebhook(ctx, d, now)
+	d.ResponseStatus = status
+	refused := status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+	result := "delivered"
+	switch {
+	case err == nil:
+		d.Status, d.DeliveredAt = webhookDelivered, &now
+	case d.Attempts >= webhookConfig.MaxAttempts || refused:
+		d.Status, d.Error, result = webhookFailed, err.Error(), "failed"
+		slog.Error("Webhook delivery failed", "delivery", d.ID, "webhook", d.WebhookID, "attempts", d.Attempts, "error", err)
+	default:
+		d.Status, d.Error, result = webhookPending, err.Error(), "retry"
+		d.NextAttemptAt = now.Add(webhookConfig.retryDelay(d.Attempts))
+		slog.Warn("Webhook delivery will be retried", "delivery", d.ID, "webhook", d.WebhookID, "attempts", d.Attempts,
+			"retry_at", d.NextAttemptAt.Format(time.RFC3339), "error", err)
+	}
+	incCounter("tracker_webhook_deliveries_total", map[string]string{"result": result}, 1)
+
+	if err := repo.UpdateWebhookDelivery(ctx, d); err != nil {
+		slog.Error("Failed to store webhook delivery", "delivery", d.ID, "error", err)
+	}
+}
+
+// postWebhook POSTs a delivery's payload with its signature and returns the response
+// status; 0 when no response arrived
+func postWebhook(ctx context.Context, d WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, strings.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bitcoin-tracker")
+	req.Header.Set("X-Webhook-ID", strconv.Itoa(d.WebhookID))
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-Webhook-Signature", signWebhook(d.secret, now, body))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096)) // Lets the connection be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute http(s) URL
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return validationErrorf("invalid webhook URL %q (expected an http:// or https:// URL)", raw)
+	}
+	return nil
+}
+
+// runWebhookCommand handles the webhooks subcommands:
+//
+//	webhooks add [--currency usd] [--threshold 2.5] <url>
+//	webhooks list
+//	webhooks remove <id>
+//	webhooks deliveries [--webhook id] [--status failed] [--limit 20]
+//	webhooks retry <delivery id>
+func runWebhookCommand(ctx context.Context, repo *Repository, args []string) error {
+	if len(args) == 0 {
+		return validationErrorf("usage: webhooks add|list|remove|deliveries|retry")
+	}
+
+	switch args[0] {
+	case "add":
+		// Options come before the URL, e.g. "webhooks add --threshold 2 https://..."
+		fs := newFlagSet("webhooks add")
+		currency := fs.String("currency", "", "Only send prices in this currency (default: every currency)")
+		threshold := fs.Float64("threshold", 0, "Only send a price once it moved this many percent since the last one sent (default: every sample)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if fs.NArg() != 1 {
+			return validationErrorf("usage: webhooks add [--currency usd] [--threshold 2.5] <url>")
+		}
+		if err := validateWebhookURL(fs.Arg(0)); err != nil {
+			return err
+		}
+		w := Webhook{URL: fs.Arg(0), Currency: strings.ToLower(*currency), Threshold: *threshold}
+		if w.Currency != "" && !slices.Contains(currencies, w.Currency) {
+			return validationErrorf("currency %q is not tracked (CURRENCIES is %s)", w.Currency, strings.Join(currencies, ","))
+		}
+		if w.Threshold < 0 {
+			return validationErrorf("invalid --threshold %g (expected a percentage of 0 or more)", w.Threshold)
+		}
+
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return err
+		}
+		w.Secret = secret
+		id, err := repo.SaveWebhook(ctx, w)
+		if err != nil {
+			return err
+		}
+		slog.Info("Added webhook", "id", id, "url", w.URL, "currency", w.Currency, "threshold", w.Threshold)
+		fmt.Println(secret)
+		fmt.Fprintln(os.Stderr, "Verify the X-Webhook-Signature of payloads with this secret.")
+
+	case "list":
+		webhooks, err := repo.Webhooks(ctx)
+		if err != nil {
+			return err
+		}
+		if len(webhooks) == 0 {
+			slog.Info("No webhooks registered")
+			return nil
+		}
+
+		fmt.Printf("\n%-5s %-9s %-14s %-20s %s\n", "ID", "Currency", "Sends", "Created", "URL")
+		fmt.Println("------------------------------------------------------------------------------------------")
+		for _, w := range webhooks {
+			currency, sends := "all", "every sample"
+			if w.Currency != "" {
+				currency = strings.ToUpper(w.Currency)
+			}
+			if w.Threshold > 0 {
+				sends = fmt.Sprintf("±%.2f%%", w.Threshold)
+			}
+			fmt.Printf("%-5d %-9s %-14s %-20s %s\n", w.ID, currency, sends, formatDisplayTime(w.CreatedAt), w.URL)
+		}
+		fmt.Println()
+
+	case "remove":
+		if len(args) < 2 {
+			return validationErrorf("usage: webhooks remove <id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return validationErrorf("invalid webhook id %q", args[1])
+		}
+		if err := repo.DeleteWebhook(ctx, id); err != nil {
+			return err
+		}
+		slog.Info("Removed webhook and its deliveries", "id", id)
+
+	case "deliveries":
+		fs := newFlagSet("webhooks deliveries")
+		webhook := fs.Int("webhook", 0, "Only show the deliveries of this webhook")
+		status := fs.String("status", "", "Only show deliveries in this state: pending, delivered, or failed")
+		limit := fs.Int("limit", 20, "Most deliveries shown, newest first")
+		if err := fs.Parse(args[1:]); err != nil {
+			return withKind(KindValidation, err)
+		}
+		if *status != "" && *status != webhookPending && *status != webhookDelivered && *status != webhookFailed {
+			return validationErrorf("invalid --status %q (expected pending, delivered, or failed)", *status)
+		}
+		if *limit < 1 {
+			return validationErrorf("invalid --limit %d", *limit)
+		}
+		deliveries, err := repo.WebhookDeliveries(ctx, *webhook, *status, *limit)
+		if err != nil {
+			return err
+		}
+		displayWebhookDeliveries(deliveries)
+
+	case "retry":
+		if len(args) < 2 {
+			return validationErrorf("usage: webhooks retry <delivery id>")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return validationErrorf("invalid delivery id %q", args[1])
+		}
+		if err := repo.RetryWebhookDelivery(ctx, id); err != nil {
+			return err
+		}
+		slog.Info("Queued webhook delivery again; the scheduler sends it on its next check", "delivery", id)
+
+	default:
+		return validationErrorf("unknown webhooks command: %s", args[0])
+	}
+	return nil
+}
+
+// displayWebhookDeliveries prints deliveries as a table, with the error of each failed attempt
+func displayWebhookDeliveries(deliveries []WebhookDelivery) {
+	if len(deliveries) == 0 {
+		slog.Info("No webhook deliveries found")
+		return
+	}
+
+	fmt.Printf("\n%-7s %-8s %-9s %-16s %-10s %-9s %-5s %-20s\n", "ID", "Webhook", "Currency", "Price", "Status", "Attempts", "HTTP", "Queued")
+	fmt.Println("------------------------------------------------------------------------------------------")
+	for _, d := range deliveries {
+		code := "-"
+		if d.ResponseStatus != 0 {
+			code = strconv.Itoa(d.ResponseStatus)
+		}
+		fmt.Printf("%-7d %-8d %-9s %-16s %-10s %-9d %-5s %-20s\n", d.ID, d.WebhookID, strings.ToUpper(d.Currency),
+			formatPrice(d.Price), d.Status, d.Attempts, code, formatDisplayTime(d.CreatedAt))
+		switch {
+		case d.Status == webhookPending && d.Attempts > 0:
+			fmt.Printf("        retry at %s: %s\n", formatDisplayTime(d.NextAttemptAt), d.Error)
+		case d.Error != "":
+			fmt.Printf("        %s\n", d.Error)
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"           // Package for buffered frame reads
+	"context"         // Package for cancelling the dial
+	"crypto/rand"     // Package for the handshake key and frame masks
+	"crypto/sha1"     // Package for verifying the handshake
+	"crypto/tls"      // Package for wss:// connections
+	"encoding/base64" // Package for the handshake key
+	"encoding/binary" // Package for frame lengths
+	"errors"          // Package for the close error
+	"fmt"             // Package for formatted I/O operations
+	"io"              // Package for reading frame payloads
+	"net"             // Package for the TCP connection
+	"net/http"        // Package for the upgrade request and response
+	"net/url"         // Package for parsing the feed URL
+	"time"            // Package for deadlines
+
+	"bitcoin-tracker/tracker" // Provider status errors
+)
+
+// WebSocket opcodes (RFC 6455 section 5.2)
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsMaxMessage caps the size of one message, protecting against a misbehaving feed
+const wsMaxMessage = 1 << 20
+
+// wsAcceptGUID is appended to the handshake key to compute Sec-WebSocket-Accept
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// errWebSocketClosed is returned once the server has sent a close frame
+var errWebSocketClosed = errors.New("websocket closed by server")
+
+// wsConn is a minimal client-side WebSocket connection
+// It covers what exchange ticker feeds need: text messages, fragmentation, and
+// answering pings. Reads and writes must each come from a single goroutine.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialWebSocket opens a ws:// or wss:// connection and performs the opening handshake
+func dialWebSocket(ctx context.Context, rawURL string) (*wsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket URL: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "wss":
+			host += ":443"
+		case "ws":
+			host += ":80"
+		default:
+			return nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", host, err)
+	}
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with %s failed: %w", host, err)
+		}
+		conn = tlsConn
+	}
+
+	ws := &wsConn{conn: conn, r: bufio.NewReader(conn)}
+	if err := ws.handshake(u); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// handshake sends the HTTP upgrade request and checks the server's answer
+func (ws *wsConn) handshake(u *url.URL) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate handshake key: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: u.EscapedPath(), RawQuery: u.RawQuery},
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+
+	ws.conn.SetDeadline(time.Now().Add(30 * time.Second))
+	defer ws.conn.SetDeadline(time.Time{})
+
+	if err := req.Write(ws.conn); err != nil {
+		return fmt.Errorf("failed to send upgrade request: %w", err)
+	}
+	resp, err := http.ReadResponse(ws.r, req)
+	if err != nil {
+		return fmt.Errorf("failed to read upgrade response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return &tracker.StatusError{StatusCode: resp.StatusCode, RetryAfter: tracker.ParseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return fmt.Errorf("invalid Sec-WebSocket-Accept in upgrade response")
+	}
+	return nil
+}
+
+// readFrame reads one frame and returns its final flag, opcode, and unmasked payload
+func (ws *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxMessage {
+		return false, 0, nil, fmt.Errorf("websocket frame of %d bytes exceeds the %d byte limit", length, wsMaxMessage)
+	}
+
+	var mask [4]byte
+	if masked { // Servers must not mask, but tolerate it
+		if _, err := io.ReadFull(ws.r, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends one final frame; client frames are always masked
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return fmt.Errorf("failed to generate frame mask: %w", err)
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	ws.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// ReadMessage returns the next text or binary message
+// Pings are answered and pongs skipped along the way; a read that sees nothing at
+// all for idle (pings included) fails, so a silently dead feed is noticed
+func (ws *wsConn) ReadMessage(idle time.Duration) ([]byte, error) {
+	var message []byte
+	for {
+		ws.conn.SetReadDeadline(time.Now().Add(idle))
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return nil, fmt.Errorf("failed to answer ping: %w", err)
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			ws.writeFrame(wsClose, payload) // Echo the close; the connection is done either way
+			return nil, errWebSocketClosed
+		case wsText, wsBinary, wsContinuation:
+			message = append(message, payload...)
+			if len(message) > wsMaxMessage {
+				return nil, fmt.Errorf("websocket message exceeds the %d byte limit", wsMaxMessage)
+			}
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("unexpected websocket opcode %#x", opcode)
+		}
+	}
+}
+
+// WriteText sends a text message
+func (ws *wsConn) WriteText(data []byte) error {
+	return ws.writeFrame(wsText, data)
+}
+
+// Close sends a normal-closure frame and closes the connection
+func (ws *wsConn) Close() error {
+	ws.writeFrame(wsClose, []byte{0x03, 0xE8}) // 1000: normal closure
+	return ws.conn.Close()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"      // Package for formatted I/O operations
+	"net/http" // Package for reading the window of a request
+	"strconv"  // Package for parsing window counts
+	"strings"  // Package for string manipulation
+	"time"     // Package for time ranges
+)
+
+// Every command and endpoint that reads a range of time takes it as one window
+// expression, --window on the command line and window= in the API:
+//
+//	24h, 90m, 7d     a duration ending now
+//	2w, 3mo, 1y      weeks, calendar months, or calendar years ending now
+//	today, yesterday the calendar day, in DISPLAY_TIMEZONE
+//	mtd, ytd         the month or year to date
+//	2024, 2024-03    a whole calendar year, month, or (2024-03-01) day
+//	FROM..TO         an explicit range of now, YYYY-MM-DD, or RFC 3339 ends; an
+//	                 omitted TO ends it now
+//
+// A window replaces --from/--to (from=/to=), which keep working but can't be combined
+// with it.
+
+// windowUsage describes the --window flag of every command that takes one
+const windowUsage = "Range of time, e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31"
+
+// parseWindow returns the range [from, to) named by a window expression, relative to now.
+// to is zero when the window ends now, leaving it open like an omitted --to.
+func parseWindow(v string, now time.Time) (from, to time.Time, err error) {
+	v = strings.TrimSpace(v)
+	invalid := validationErrorf("invalid window %q (expected e.g. 24h, 7d, 3mo, ytd, 2024-03, or 2024-01-01..2024-03-31)", v)
+	local := now.In(displayLocation)
+	midnight := localMidnight(now, displayLocation)
+
+	// The ends of a range keep their case, as RFC 3339 times may be written with T and Z
+	if start, end, ok := strings.Cut(v, ".."); ok {
+		if start == "" {
+			return from, to, invalid
+		}
+		if from, err = parseTimeFlag("window", start); err != nil {
+			return from, to, invalid
+		}
+		if end != "" && !strings.EqualFold(end, "now") {
+			if to, err = parseTimeFlag("window", end); err != nil {
+				return from, to, invalid
+			}
+			if !to.After(from) {
+				return from, to, validationErrorf("invalid window %q: it must end after it starts", v)
+			}
+		}
+		return from, to, nil
+	}
+
+	v = strings.ToLower(v)
+	switch v {
+	case "today":
+		return midnight, time.Time{}, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), midnight, nil
+	case "mtd":
+		return time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, displayLocation), time.Time{}, nil
+	case "ytd":
+		return time.Date(local.Year(), time.January, 1, 0, 0, 0, 0, displayLocation), time.Time{}, nil
+	}
+
+	// A calendar period: the whole year, month, or day
+	for _, p := range []struct {
+		layout              string
+		years, months, days int
+	}{{"2006", 1, 0, 0}, {"2006-01", 0, 1, 0}, {"2006-01-02", 0, 0, 1}} {
+		if t, err := time.ParseInLocation(p.layout, v, displayLocation); err == nil {
+			return t, t.AddDate(p.years, p.months, p.days), nil
+		}
+	}
+
+	// A count of calendar units, which vary in length, ending now
+	for _, u := range []struct {
+		suffix       string
+		months, days int
+	}{{"mo", 1, 0}, {"y", 12, 0}, {"w", 0, 7}} {
+		if count, ok := strings.CutSuffix(v, u.suffix); ok {
+			n, err := strconv.Atoi(count)
+			if err != nil || n <= 0 {
+				return from, to, invalid
+			}
+			return monthsBefore(now, n*u.months).AddDate(0, 0, -n*u.days), time.Time{}, nil
+		}
+	}
+
+	d, err := parseStatsWindow(v)
+	if err != nil {
+		return from, to, invalid
+	}
+	return now.Add(-d), time.Time{}, nil
+}
+
+// monthsBefore returns t moved back n calendar months, on the last day of the month
+// when that month is shorter, so 1mo before March 31 is February 28 or 29 rather than
+// the March 2 or 3 time.AddDate normalizes to
+func monthsBefore(t time.Time, n int) time.Time {
+	local := t.In(displayLocation)
+	first := time.Date(local.Year(), local.Month()-time.Month(n), 1, local.Hour(), local.Minute(),
+		local.Second(), local.Nanosecond(), displayLocation)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(local.Day(), lastDay)-1)
+}
+
+// resolveWindow returns the range of a command's --window flag, or of its --from and
+// --to flags, which can't be combined with it. When neither --window nor --from is
+// given, the range starts fallback before its end, e.g. "24h" before --to; an empty
+// fallback leaves it open. to is zero when the range ends now.
+func resolveWindow(window, fromFlag, toFlag, fallback string) (from, to time.Time, err error) {
+	if window != "" {
+		if fromFlag != "" || (toFlag != "" && !strings.EqualFold(toFlag, "now")) {
+			return from, to, validationErrorf("use either --window or --from/--to, not both")
+		}
+		return parseWindow(window, time.Now())
+	}
+
+	end := time.Now()
+	if toFlag != "" && !strings.EqualFold(toFlag, "now") {
+		if to, err = parseTimeFlag("to", toFlag); err != nil {
+			return from, to, err
+		}
+		end = to
+	}
+	switch {
+	case fromFlag != "":
+		if from, err = parseTimeFlag("from", fromFlag); err != nil {
+			return from, to, err
+		}
+	case fallback != "":
+		if from, _, err = parseWindow(fallback, end); err != nil {
+			return from, to, err
+		}
+	}
+	if !to.IsZero() && !to.After(from) {
+		return from, to, validationErrorf("--to must be after --from")
+	}
+	return from, to, nil
+}
+
+// requestWindow returns the range of a request's window parameter, or of its from and
+// to parameters in RFC 3339, which can't be combined with it. Like resolveWindow, the
+// range starts fallback before its end when no start is given, and to is zero when it
+// ends now.
+func requestWindow(r *http.Request, fallback string) (from, to time.Time, err error) {
+	q := r.URL.Query()
+	if window := q.Get("window"); window != "" {
+		if q.Get("from") != "" || q.Get("to") != "" {
+			return from, to, fmt.Errorf("use either window or from/to, not both")
+		}
+		return parseWindow(window, time.Now())
+	}
+
+	if to, err = parseTimeParam(r, "to", time.Time{}); err != nil {
+		return from, to, err
+	}
+	end := to
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if from, err = parseTimeParam(r, "from", time.Time{}); err != nil {
+		return from, to, err
+	}
+	if from.IsZero() && fallback != "" {
+		if from, _, err = parseWindow(fallback, end); err != nil {
+			return from, to, err
+		}
+	}
+	if !to.IsZero() && !to.After(from) {
+		return from, to, fmt.Errorf("to must be after from")
+	}
+	return from, to, nil
+}
+
+// windowEnd returns to, or now when the range is open
+func windowEnd(to, now time.Time) time.Time {
+	if to.IsZero() {
+		return now
+	}
+	return to
+}
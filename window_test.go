@@ -0,0 +1,151 @@
+package main
+
+import (
+	"testing" // Package for the tests
+	"time"    // Package for the expected ranges
+)
+
+// useDisplayLocation sets displayLocation for one test
+func useDisplayLocation(t *testing.T, loc *time.Location) {
+	t.Helper()
+	saved := displayLocation
+	displayLocation = loc
+	t.Cleanup(func() { displayLocation = saved })
+}
+
+func TestParseWindow(t *testing.T) {
+	useDisplayLocation(t, time.UTC)
+	now := time.Date(2024, time.March, 31, 15, 30, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	open := time.Time{}
+
+	tests := []struct {
+		window   string
+		from, to time.Time
+	}{
+		// Durations ending now
+		{"90m", now.Add(-90 * time.Minute), open},
+		{"24h", now.Add(-24 * time.Hour), open},
+		{"7d", now.AddDate(0, 0, -7), open},
+		{" 7D ", now.AddDate(0, 0, -7), open},
+
+		// Calendar units ending now, clamped to the end of shorter months
+		{"2w", now.AddDate(0, 0, -14), open},
+		{"1mo", time.Date(2024, time.February, 29, 15, 30, 0, 0, time.UTC), open},
+		{"3mo", time.Date(2023, time.December, 31, 15, 30, 0, 0, time.UTC), open},
+		{"13mo", time.Date(2023, time.February, 28, 15, 30, 0, 0, time.UTC), open},
+		{"1y", time.Date(2023, time.March, 31, 15, 30, 0, 0, time.UTC), open},
+
+		// Named periods
+		{"today", day(2024, time.March, 31), open},
+		{"yesterday", day(2024, time.March, 30), day(2024, time.March, 31)},
+		{"mtd", day(2024, time.March, 1), open},
+		{"ytd", day(2024, time.January, 1), open},
+
+		// Whole calendar periods
+		{"2023", day(2023, time.January, 1), day(2024, time.January, 1)},
+		{"2024-02", day(2024, time.February, 1), day(2024, time.March, 1)},
+		{"2023-12", day(2023, time.December, 1), day(2024, time.January, 1)},
+		{"2024-02-29", day(2024, time.February, 29), day(2024, time.March, 1)},
+
+		// Explicit ranges
+		{"2024-01-01..2024-03-01", day(2024, time.January, 1), day(2024, time.March, 1)},
+		{"2024-01-01..", day(2024, time.January, 1), open},
+		{"2024-01-01..now", day(2024, time.January, 1), open},
+		{"2024-01-01T06:00:00Z..2024-01-01T18:00:00Z",
+			time.Date(2024, time.January, 1, 6, 0, 0, 0, time.UTC), time.Date(2024, time.January, 1, 18, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		from, to, err := parseWindow(tt.window, now)
+		if err != nil {
+			t.Errorf("parseWindow(%q): %v", tt.window, err)
+			continue
+		}
+		if !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("parseWindow(%q) = [%s, %s), want [%s, %s)", tt.window, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestParseWindowDisplayZone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	useDisplayLocation(t, berlin)
+
+	// 23:30 UTC on December 31 is already January 1 in Berlin
+	now := time.Date(2023, time.December, 31, 23, 30, 0, 0, time.UTC)
+	from, to, err := parseWindow("ytd", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, time.January, 1, 0, 0, 0, 0, berlin); !from.Equal(want) || !to.IsZero() {
+		t.Errorf("ytd = [%s, %s), want [%s, now)", from, to, want)
+	}
+	from, to, err = parseWindow("2024-03", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, time.March, 1, 0, 0, 0, 0, berlin); !from.Equal(want) || !to.Equal(want.AddDate(0, 1, 0)) {
+		t.Errorf("2024-03 = [%s, %s), want the month in Berlin", from, to)
+	}
+}
+
+func TestParseWindowInvalid(t *testing.T) {
+	useDisplayLocation(t, time.UTC)
+	now := time.Date(2024, time.March, 31, 15, 30, 0, 0, time.UTC)
+	for _, window := range []string{
+		"", "bogus", "0d", "-7d", "0mo", "-3mo", "3x", "mo", "1.5y",
+		"2024-13", "2024-02-30",
+		"..2024-01-01", "2024-01-01..soon", "2024-03-01..2024-02-01", "2024-03-01..2024-03-01",
+	} {
+		if from, to, err := parseWindow(window, now); err == nil {
+			t.Errorf("parseWindow(%q) = [%s, %s), want an error", window, from, to)
+		} else if errorKind(err) != KindValidation {
+			t.Errorf("parseWindow(%q) error %v is not a validation error", window, err)
+		}
+	}
+}
+
+func TestResolveWindow(t *testing.T) {
+	useDisplayLocation(t, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name                       string
+		window, from, to, fallback string
+		wantFrom, wantTo           time.Time
+	}{
+		{name: "window", window: "2024-02", wantFrom: day(2024, time.February, 1), wantTo: day(2024, time.March, 1)},
+		{name: "window with --to now", window: "2024", to: "now", wantFrom: day(2024, time.January, 1), wantTo: day(2025, time.January, 1)},
+		{name: "from and to", from: "2024-01-01", to: "2024-02-01", wantFrom: day(2024, time.January, 1), wantTo: day(2024, time.February, 1)},
+		{name: "from, open end", from: "2024-01-01", to: "now", wantFrom: day(2024, time.January, 1)},
+		{name: "fallback before --to", to: "2024-03-01", fallback: "24h", wantFrom: day(2024, time.February, 29), wantTo: day(2024, time.March, 1)},
+		{name: "fallback months before --to", to: "2024-03-31", fallback: "1mo", wantFrom: day(2024, time.February, 29), wantTo: day(2024, time.March, 31)},
+		{name: "no range", to: "now"},
+	}
+	for _, tt := range tests {
+		from, to, err := resolveWindow(tt.window, tt.from, tt.to, tt.fallback)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+			t.Errorf("%s: got [%s, %s), want [%s, %s)", tt.name, from, to, tt.wantFrom, tt.wantTo)
+		}
+	}
+
+	for _, bad := range [][3]string{
+		{"7d", "2024-01-01", ""},         // --window with --from
+		{"7d", "", "2024-01-01"},         // --window with --to
+		{"", "2024-02-01", "2024-01-01"}, // --to before --from
+		{"", "2024-01-01", "2024-01-01"}, // An empty range
+		{"", "yesterday-ish", "now"},     // An unreadable --from
+		{"bogus", "", ""},                // An unreadable --window
+	} {
+		if _, _, err := resolveWindow(bad[0], bad[1], bad[2], ""); err == nil {
+			t.Errorf("resolveWindow(%q, %q, %q) succeeded, want an error", bad[0], bad[1], bad[2])
+		}
+	}
+}